@@ -0,0 +1,81 @@
+// Command gotsunami-protocol-echo is an example protocol plugin that echoes
+// the request body back as the response. Build it into a plugin directory:
+//
+//	go build -o ~/.gotsunami/plugins/gotsunami-protocol-echo ./examples/plugins/echo
+//
+// and select it in a scenario with "protocol": "echo".
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexandredias/gotsunami/pkg/plugin"
+)
+
+// EchoProtocol implements plugin.Protocol
+type EchoProtocol struct {
+	requests int64
+	latency  time.Duration
+}
+
+// Name returns the protocol name
+func (p *EchoProtocol) Name() string {
+	return "echo"
+}
+
+// Version returns the protocol version
+func (p *EchoProtocol) Version() string {
+	return "1.0"
+}
+
+// Execute echoes the request body
+func (p *EchoProtocol) Execute(req *plugin.Request) (*plugin.Response, error) {
+	start := time.Now()
+	atomic.AddInt64(&p.requests, 1)
+
+	if p.latency > 0 {
+		time.Sleep(p.latency)
+	}
+
+	return &plugin.Response{
+		StatusCode:    200,
+		Headers:       map[string]string{"Content-Type": "application/octet-stream"},
+		Body:          req.Body,
+		ResponseTime:  time.Since(start),
+		ContentLength: int64(len(req.Body)),
+	}, nil
+}
+
+// ValidateConfig accepts an optional "latency" duration
+func (p *EchoProtocol) ValidateConfig(config map[string]interface{}) error {
+	value, ok := config["latency"]
+	if !ok {
+		return nil
+	}
+
+	latency, err := time.ParseDuration(fmt.Sprintf("%v", value))
+	if err != nil {
+		return fmt.Errorf("invalid latency: %v", value)
+	}
+	p.latency = latency
+
+	return nil
+}
+
+// GetMetrics returns protocol metrics
+func (p *EchoProtocol) GetMetrics() map[string]interface{} {
+	return map[string]interface{}{
+		"requests": atomic.LoadInt64(&p.requests),
+	}
+}
+
+// Close releases resources
+func (p *EchoProtocol) Close() error {
+	return nil
+}
+
+func main() {
+	plugin.Serve(&EchoProtocol{})
+}
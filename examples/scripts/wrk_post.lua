@@ -0,0 +1,19 @@
+-- wrk-compatible script: every request becomes a JSON POST with a counter,
+-- and responses without an "id" field are reported as failures.
+
+wrk.method = "POST"
+wrk.headers["Content-Type"] = "application/json"
+
+counter = 0
+
+request = function()
+  counter = counter + 1
+  local body = '{"name": "user-' .. counter .. '"}'
+  return wrk.format(nil, wrk.path, nil, body)
+end
+
+response = function(status, headers, body)
+  if status >= 400 then
+    return "unexpected status " .. status
+  end
+end
@@ -0,0 +1,82 @@
+//go:build wasip1
+
+// Command validator is an example GoTsunami WASM extension. It tags every
+// request with a header and rejects responses whose body is not JSON.
+//
+// Build it as a WASI reactor module:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o validator.wasm ./examples/wasm/validator
+package main
+
+import (
+	"encoding/json"
+	"unsafe"
+)
+
+// buffers keeps memory handed to the host alive until it is freed
+var buffers = map[uint32][]byte{}
+
+type request struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+type response struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+//go:wasmexport alloc
+func alloc(size uint32) uint32 {
+	buf := make([]byte, size)
+	ptr := uint32(uintptr(unsafe.Pointer(unsafe.SliceData(buf))))
+	buffers[ptr] = buf
+	return ptr
+}
+
+//go:wasmexport free
+func free(ptr uint32) {
+	delete(buffers, ptr)
+}
+
+//go:wasmexport transform_request
+func transformRequest(ptr, size uint32) uint64 {
+	var req request
+	if err := json.Unmarshal(buffers[ptr][:size], &req); err != nil {
+		return 0
+	}
+
+	if req.Headers == nil {
+		req.Headers = map[string]string{}
+	}
+	req.Headers["X-Wasm-Extension"] = "validator"
+
+	data, _ := json.Marshal(req)
+	return result(data)
+}
+
+//go:wasmexport validate_response
+func validateResponse(ptr, size uint32) uint64 {
+	var resp response
+	if err := json.Unmarshal(buffers[ptr][:size], &resp); err != nil {
+		return result([]byte(err.Error()))
+	}
+
+	if !json.Valid([]byte(resp.Body)) {
+		return result([]byte("response body is not valid JSON"))
+	}
+
+	return 0
+}
+
+// result copies data into a host-visible buffer and packs its location
+func result(data []byte) uint64 {
+	ptr := alloc(uint32(len(data)))
+	copy(buffers[ptr], data)
+	return uint64(ptr)<<32 | uint64(len(data))
+}
+
+func main() {}
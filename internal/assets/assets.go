@@ -0,0 +1,328 @@
+// Package assets lists the files a static site or CDN origin serves, with
+// their sizes, from a sitemap, an HTTP directory listing or a local
+// directory, to build request mixes that reflect real asset distributions
+package assets
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// maxSitemapDepth bounds how deep sitemap indexes may nest
+const maxSitemapDepth = 3
+
+// Asset is a file served at Path, Size bytes long; a size of -1 is unknown
+type Asset struct {
+	Path string
+	Size int64
+}
+
+// sitemap is a sitemap or a sitemap index, see sitemaps.org
+type sitemap struct {
+	URLs     []location `xml:"url"`
+	Sitemaps []location `xml:"sitemap"`
+}
+
+type location struct {
+	Loc string `xml:"loc"`
+}
+
+// FromSitemap returns the URLs listed by a sitemap, read from a URL or a
+// file, following sitemap indexes
+func FromSitemap(ctx context.Context, client *http.Client, source string) ([]string, error) {
+	return readSitemap(ctx, client, source, 0)
+}
+
+func readSitemap(ctx context.Context, client *http.Client, source string, depth int) ([]string, error) {
+	content, err := open(ctx, client, source)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	var parsed sitemap
+	if err := xml.NewDecoder(content).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("invalid sitemap %s: %w", source, err)
+	}
+
+	var urls []string
+	for _, u := range parsed.URLs {
+		if loc := strings.TrimSpace(u.Loc); loc != "" {
+			urls = append(urls, loc)
+		}
+	}
+	for _, s := range parsed.Sitemaps {
+		if depth >= maxSitemapDepth {
+			return nil, fmt.Errorf("sitemap indexes nested deeper than %d levels at %s", maxSitemapDepth, source)
+		}
+		nested, err := readSitemap(ctx, client, strings.TrimSpace(s.Loc), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, nested...)
+	}
+	return urls, nil
+}
+
+// open reads source from the network when it is an http(s) URL, or from
+// the local file system
+func open(ctx context.Context, client *http.Client, source string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", source, err)
+		}
+		return file, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %w", source, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", source, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s: %s", source, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// FromListing returns the URLs of the files of an HTTP directory listing,
+// such as the autoindex pages of nginx or Apache, descending into
+// subdirectories up to depth levels. Only links below the listing are
+// followed.
+func FromListing(ctx context.Context, client *http.Client, listing string, depth int) ([]string, error) {
+	root, err := url.Parse(listing)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listing URL %s: %w", listing, err)
+	}
+	if !strings.HasSuffix(root.Path, "/") {
+		root.Path += "/"
+	}
+
+	var files []string
+	visited := make(map[string]bool)
+	var walk func(dir *url.URL, level int) error
+	walk = func(dir *url.URL, level int) error {
+		if visited[dir.Path] {
+			return nil
+		}
+		visited[dir.Path] = true
+
+		content, err := open(ctx, client, dir.String())
+		if err != nil {
+			return err
+		}
+		links, err := pageLinks(content)
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("invalid listing %s: %w", dir, err)
+		}
+
+		for _, link := range links {
+			target, err := dir.Parse(link)
+			if err != nil || target.Host != root.Host || target.RawQuery != "" ||
+				!strings.HasPrefix(target.Path, root.Path) || len(target.Path) <= len(dir.Path) {
+				// Parents, sort links and other sites are not part of the listing
+				continue
+			}
+			target.Fragment = ""
+			if strings.HasSuffix(target.Path, "/") {
+				if level < depth {
+					if err := walk(target, level+1); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			files = append(files, target.String())
+		}
+		return nil
+	}
+
+	if err := walk(root, 0); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// pageLinks returns the href of every link of an HTML page
+func pageLinks(page io.Reader) ([]string, error) {
+	var links []string
+	tokens := html.NewTokenizer(page)
+	for {
+		switch tokens.Next() {
+		case html.ErrorToken:
+			if tokens.Err() == io.EOF {
+				return links, nil
+			}
+			return nil, tokens.Err()
+		case html.StartTagToken:
+			name, hasAttributes := tokens.TagName()
+			if string(name) != "a" {
+				continue
+			}
+			for hasAttributes {
+				var key, value []byte
+				key, value, hasAttributes = tokens.TagAttr()
+				if string(key) == "href" {
+					links = append(links, string(value))
+				}
+			}
+		}
+	}
+}
+
+// FromDirectory returns the regular files below the root of fsys, such as
+// the document root of an origin, with paths relative to it. Hidden files
+// and directories are skipped.
+func FromDirectory(fsys fs.FS) ([]Asset, error) {
+	var assets []Asset
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != "." && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		assets = append(assets, Asset{Path: (&url.URL{Path: "/" + name}).EscapedPath(), Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directory: %w", err)
+	}
+	return assets, nil
+}
+
+// Sizes finds the size of each URL with a HEAD request, or a GET for the
+// first byte when the server omits the length, sending up to concurrency
+// requests at once. Assets keep the order of urls; sizes that cannot be
+// found are -1.
+func Sizes(ctx context.Context, client *http.Client, urls []string, concurrency int) []Asset {
+	assets := make([]Asset, len(urls))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < max(concurrency, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				assets[i] = Asset{Path: urls[i], Size: size(ctx, client, urls[i])}
+			}
+		}()
+	}
+	for i := range urls {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return assets
+}
+
+// size returns the size of the file at target, or -1
+func size(ctx context.Context, client *http.Client, target string) int64 {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, target, nil)
+	if err != nil {
+		return -1
+	}
+	resp, err := client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK && resp.ContentLength >= 0 {
+			return resp.ContentLength
+		}
+	}
+
+	// Chunked responses only tell their size in the range of a partial one
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return -1
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err = client.Do(req)
+	if err != nil {
+		return -1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return -1
+	}
+	// bytes 0-0/12345
+	_, total, found := strings.Cut(resp.Header.Get("Content-Range"), "/")
+	if !found {
+		return -1
+	}
+	n, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// Relative splits URLs into the origin (scheme and host) of the first one
+// and the paths, with their queries, of the assets on that origin. Assets
+// on other origins are returned apart.
+func Relative(assets []Asset) (origin string, relative []Asset, others []Asset) {
+	for _, asset := range assets {
+		u, err := url.Parse(asset.Path)
+		if err != nil || u.Host == "" {
+			others = append(others, asset)
+			continue
+		}
+		if origin == "" {
+			origin = u.Scheme + "://" + u.Host
+		}
+		if u.Scheme+"://"+u.Host != origin {
+			others = append(others, asset)
+			continue
+		}
+		u.Scheme, u.Host, u.User, u.Fragment = "", "", nil, ""
+		p := u.String()
+		if p == "" {
+			p = "/"
+		}
+		relative = append(relative, Asset{Path: p, Size: asset.Size})
+	}
+	return origin, relative, others
+}
+
+// WriteCSV writes the assets as a data file with path and size columns,
+// largest first, ready to feed a scenario
+func WriteCSV(w io.Writer, assets []Asset) error {
+	sorted := append([]Asset(nil), assets...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Size > sorted[j].Size })
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"path", "size"})
+	for _, asset := range sorted {
+		writer.Write([]string{asset.Path, strconv.FormatInt(max(asset.Size, 0), 10)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/protocols/plugins"
+	"github.com/alexandredias/gotsunami/internal/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// NewAgentCommand creates the agent command
+func NewAgentCommand(version string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Run GoTsunami as a worker node taking instructions over HTTP",
+		Long: `Run GoTsunami as an agent, a load generator node that waits for instructions,
+so a single scenario can be executed from several machines when one generator
+cannot saturate the target. A "gotsunami coordinator" drives the agents over
+gRPC; over HTTP, send the same run to every agent with a common start_at and
+merge their reports with "gotsunami merge".
+
+HTTP endpoints:
+  GET  /api/v1/health
+  GET  /api/v1/agent                agent name, CPUs and status
+  POST /api/v1/agent/run            start a run ({"scenario": {...}, "start_at": "..."})
+  GET  /api/v1/agent/run            run status
+  POST /api/v1/agent/run/stop       stop the run
+  POST /api/v1/agent/run/vus        change the active VUs ({"vus": 50})
+  GET  /api/v1/agent/run/metrics    stream live metrics (server-sent events)
+  GET  /api/v1/agent/run/report     fetch the final report
+
+An agent refuses to listen on a non-loopback address without --token, which
+coordinators and HTTP clients then send as a bearer token, unless --insecure
+is passed on a trusted network. Scenarios with command hooks, scripts, data or
+tenant files, gRPC proto files, secrets or {{env.NAME}} templates are refused
+unless --allow-host-access is set, since they run code on this host or send its
+environment, files and credentials to the target. Runs with more VUs, workers
+or connections than --confirm-vus are refused unless the coordinator passes
+--yes or the request sets "confirm": true.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAgent(version)
+		},
+	}
+
+	cmd.Flags().String("listen", ":7070", "address to listen on")
+	cmd.Flags().String("grpc-listen", ":7071", "address coordinators connect to over gRPC (empty = off)")
+	cmd.Flags().String("name", "", "agent name added as the agent label of its reports (default: hostname)")
+	cmd.Flags().String("token", "", "bearer token required on every request but the health check")
+	cmd.Flags().Bool("insecure", false, "listen on non-loopback addresses without --token")
+	cmd.Flags().Bool("allow-host-access", false, "accept scenarios with command hooks, scripts, data or tenant files, gRPC proto files, secrets or {{env.NAME}} templates")
+	cmd.Flags().Int("confirm-vus", server.DefaultConfirmVUs, "runs with more VUs, workers or connections than this need \"confirm\": true or coordinator --yes (0 = no limit)")
+
+	viper.BindPFlag("agent.listen", cmd.Flags().Lookup("listen"))
+	viper.BindPFlag("agent.grpc_listen", cmd.Flags().Lookup("grpc-listen"))
+	viper.BindPFlag("agent.name", cmd.Flags().Lookup("name"))
+	viper.BindPFlag("agent.token", cmd.Flags().Lookup("token"))
+	viper.BindPFlag("agent.insecure", cmd.Flags().Lookup("insecure"))
+	viper.BindPFlag("agent.allow_host_access", cmd.Flags().Lookup("allow-host-access"))
+	viper.BindPFlag("agent.confirm_vus", cmd.Flags().Lookup("confirm-vus"))
+
+	return cmd
+}
+
+// runAgent starts the agent and blocks until interrupted
+func runAgent(version string) error {
+	if _, err := plugins.RegisterDiscovered(viper.GetStringSlice("plugin_dirs")); err != nil {
+		return fmt.Errorf("failed to discover plugins: %w", err)
+	}
+
+	token, insecure := viper.GetString("agent.token"), viper.GetBool("agent.insecure")
+	for _, addr := range []string{viper.GetString("agent.listen"), viper.GetString("agent.grpc_listen")} {
+		if addr == "" {
+			continue
+		}
+		if err := server.CheckExposure(addr, token, insecure); err != nil {
+			return err
+		}
+	}
+
+	agent := server.NewAgent(
+		viper.GetString("agent.listen"),
+		viper.GetString("agent.name"),
+		version,
+		token,
+	)
+	agent.AllowHostAccess(viper.GetBool("agent.allow_host_access"))
+	agent.SetConfirmVUs(viper.GetInt("agent.confirm_vus"))
+
+	errChan := make(chan error, 2)
+	go func() {
+		errChan <- agent.ListenAndServe()
+	}()
+	if addr := viper.GetString("agent.grpc_listen"); addr != "" {
+		go func() {
+			errChan <- agent.ListenAndServeGRPC(addr)
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-signals:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := agent.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shut down agent: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/alexandredias/gotsunami/internal/protocols/plugins"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// BuildInfo is the build metadata of the binary, for tooling that checks
+// agents before a distributed run
+type BuildInfo struct {
+	Version    string            `json:"version"`
+	Commit     string            `json:"commit,omitempty"`
+	CommitTime string            `json:"commit_time,omitempty"`
+	Modified   bool              `json:"modified,omitempty"`
+	BuildTime  string            `json:"build_time"`
+	GoVersion  string            `json:"go_version"`
+	Platform   string            `json:"platform"`
+	Compiler   string            `json:"compiler"`
+	Protocols  []string          `json:"protocols"`
+	Plugins    map[string]string `json:"plugins,omitempty"`
+}
+
+// NewBuildInfoCommand creates the build-info command
+func NewBuildInfoCommand(version, buildTime string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "build-info",
+		Short: "Print build metadata as JSON",
+		Long: `Print the version, commit, platform and available protocols of this
+binary as JSON, so fleet tooling can verify agents before a distributed run.
+
+Protocols include the plugins found in the plugin directories.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info, err := buildInfo(version, buildTime)
+			if err != nil {
+				return err
+			}
+
+			data, err := json.MarshalIndent(info, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal build info: %w", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// buildInfo collects the build metadata, taking the commit from the version
+// control information Go embeds in the binary
+func buildInfo(version, buildTime string) (*BuildInfo, error) {
+	info := &BuildInfo{
+		Version:   version,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Compiler:  runtime.Compiler,
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+			case "vcs.time":
+				info.CommitTime = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	found, err := plugins.RegisterDiscovered(viper.GetStringSlice("plugin_dirs"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover plugins: %w", err)
+	}
+	if len(found) > 0 {
+		info.Plugins = found
+	}
+
+	// HTTP is built into the engine rather than registered, and a plugin
+	// named after it is never used
+	info.Protocols = []string{"http"}
+	for _, name := range protocols.Names() {
+		if name != "http" {
+			info.Protocols = append(info.Protocols, name)
+		}
+	}
+	sort.Strings(info.Protocols)
+	return info, nil
+}
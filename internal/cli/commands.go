@@ -3,7 +3,11 @@ package cli
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/cpu"
+	"github.com/alexandredias/gotsunami/internal/protocols/plugins"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -17,24 +21,47 @@ func NewRootCommand(version, buildTime string) *cobra.Command {
 It provides comprehensive testing capabilities with real-time metrics,
 advanced validation, and detailed reporting for production environments.`,
 		Version: fmt.Sprintf("%s (built %s)", version, buildTime),
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Size the Go scheduler after the container CPU limit rather
+			// than the CPUs of the host
+			cpu.Tune()
+			if err := bindSettings(cmd); err != nil {
+				return err
+			}
+			return interpolateSettings(config.NewEnvironment())
+		},
 	}
 
 	// Add subcommands
 	rootCmd.AddCommand(NewRunCommand())
 	rootCmd.AddCommand(NewValidateCommand())
+	rootCmd.AddCommand(NewSchemaCommand())
+	rootCmd.AddCommand(NewServeCommand())
+	rootCmd.AddCommand(NewAgentCommand(version))
+	rootCmd.AddCommand(NewCoordinatorCommand())
+	rootCmd.AddCommand(NewMockCommand())
+	rootCmd.AddCommand(NewMergeCommand())
+	rootCmd.AddCommand(NewCompareCommand())
+	rootCmd.AddCommand(NewConfigCommand())
+	rootCmd.AddCommand(NewImportCommand())
+	rootCmd.AddCommand(NewPluginsCommand())
 	rootCmd.AddCommand(NewVersionCommand(version, buildTime))
+	rootCmd.AddCommand(NewBuildInfoCommand(version, buildTime))
+	rootCmd.AddCommand(NewSelfUpdateCommand(version))
 
 	// Global flags
 	rootCmd.PersistentFlags().StringP("config", "c", "", "config file (default is $HOME/.gotsunami.yaml)")
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "quiet mode (only errors)")
 	rootCmd.PersistentFlags().String("log-level", "info", "log level (debug, info, warn, error)")
+	rootCmd.PersistentFlags().StringSlice("plugin-dir", plugins.DefaultDirs(), "directories searched for protocol plugins")
 
 	// Bind flags to viper
 	viper.BindPFlag("config", rootCmd.PersistentFlags().Lookup("config"))
 	viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
 	viper.BindPFlag("quiet", rootCmd.PersistentFlags().Lookup("quiet"))
 	viper.BindPFlag("log.level", rootCmd.PersistentFlags().Lookup("log-level"))
+	viper.BindPFlag("plugin_dirs", rootCmd.PersistentFlags().Lookup("plugin-dir"))
 
 	// Initialize configuration
 	cobra.OnInitialize(initConfig)
@@ -58,7 +85,9 @@ func initConfig() {
 		viper.SetConfigName(".gotsunami")
 	}
 
-	// Environment variables
+	// Environment variables, such as GOTSUNAMI_RUN_VUS for run.vus
+	viper.SetEnvPrefix(config.EnvPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
 	viper.AutomaticEnv()
 
 	// Read config file if it exists
@@ -66,3 +95,71 @@ func initConfig() {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
+
+// interpolateSettings resolves ${VAR} references in flag and config file
+// values, so CI templates can pass --outfile ${REPORT_DIR}/run.json without
+// relying on shell expansion
+func interpolateSettings(env *config.Environment) error {
+	for _, key := range viper.AllKeys() {
+		setting := viper.Get(key)
+		if !strings.Contains(fmt.Sprint(setting), "${") {
+			continue
+		}
+
+		var (
+			value interface{}
+			err   error
+		)
+		switch setting := setting.(type) {
+		case string:
+			value, err = env.Interpolate(setting)
+		case []string:
+			value, err = interpolateSlice(env, setting)
+		case []interface{}:
+			values := make([]string, len(setting))
+			for i, element := range setting {
+				values[i] = fmt.Sprint(element)
+			}
+			value, err = interpolateSlice(env, values)
+		case map[string]string:
+			value, err = interpolateStringMap(env, setting)
+		case map[string]interface{}:
+			values := make(map[string]string, len(setting))
+			for name, element := range setting {
+				values[name] = fmt.Sprint(element)
+			}
+			value, err = interpolateStringMap(env, values)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value of %s: %w", key, err)
+		}
+		viper.Set(key, value)
+	}
+	return nil
+}
+
+// interpolateSlice interpolates every element of a list setting
+func interpolateSlice(env *config.Environment, values []string) ([]string, error) {
+	interpolated := make([]string, len(values))
+	for i, value := range values {
+		var err error
+		if interpolated[i], err = env.Interpolate(value); err != nil {
+			return nil, err
+		}
+	}
+	return interpolated, nil
+}
+
+// interpolateStringMap interpolates every value of a key=value setting
+func interpolateStringMap(env *config.Environment, values map[string]string) (map[string]string, error) {
+	interpolated := make(map[string]string, len(values))
+	for key, value := range values {
+		var err error
+		if interpolated[key], err = env.Interpolate(value); err != nil {
+			return nil, err
+		}
+	}
+	return interpolated, nil
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/alexandredias/gotsunami/internal/reporting"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// NewCompareCommand creates the compare command
+func NewCompareCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compare <baseline> <candidate>",
+		Short: "Compare results with another run or another tool",
+		Long: `Compare the headline metrics of two load test results side by side. Either
+result may be a GoTsunami JSON report, a k6 summary (--summary-export or
+handleSummary JSON) or the text output of wrk, so GoTsunami can be
+benchmarked against legacy tooling during a migration. The format of each
+file is detected from its content unless given explicitly.`,
+		Args: cobra.ExactArgs(2),
+		RunE: compareReports,
+	}
+
+	cmd.Flags().String("baseline-format", "", "format of the baseline (gotsunami, k6, wrk; default detected)")
+	cmd.Flags().String("candidate-format", "", "format of the candidate (gotsunami, k6, wrk; default detected)")
+
+	viper.BindPFlag("compare.baseline_format", cmd.Flags().Lookup("baseline-format"))
+	viper.BindPFlag("compare.candidate_format", cmd.Flags().Lookup("candidate-format"))
+
+	return cmd
+}
+
+// compareReports loads two results and prints their comparison
+func compareReports(cmd *cobra.Command, args []string) error {
+	baseline, err := reporting.LoadAnyReport(args[0], viper.GetString("compare.baseline_format"))
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", args[0], err)
+	}
+	candidate, err := reporting.LoadAnyReport(args[1], viper.GetString("compare.candidate_format"))
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", args[1], err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Metric\t%s\t%s\tDelta\n", reportLabel(baseline, args[0]), reportLabel(candidate, args[1]))
+	for _, row := range reporting.CompareReports(baseline, candidate) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", row.Metric, row.Baseline, row.Candidate, row.Delta)
+	}
+
+	return w.Flush()
+}
+
+// reportLabel names a compared result by the tool that produced it
+func reportLabel(report *reporting.Report, filename string) string {
+	if report.Metadata.Tool == "" {
+		return filename
+	}
+	return fmt.Sprintf("%s (%s)", filename, report.Metadata.Tool)
+}
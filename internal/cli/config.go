@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// NewConfigCommand creates the config command
+func NewConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration of runs",
+	}
+	cmd.AddCommand(newConfigResolveCommand())
+	return cmd
+}
+
+// newConfigResolveCommand creates the config resolve command
+func newConfigResolveCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "resolve [scenario.json]",
+		Short: "Print the effective configuration of a run",
+		Long: fmt.Sprintf(`Print every run setting with the value a run would use and where it comes
+from. It takes the same flags as run; each setting takes the value of its
+source of highest precedence:
+
+  %s
+
+The config file is .gotsunami.yaml (or --config), with run settings under
+run:, and environment variables are named after the setting, such as
+GOTSUNAMI_RUN_VUS for run.vus. Given a scenario, its timeout, http_version,
+bandwidth, outfile, stages, load_pattern and validation rules take the place
+of the matching settings from the config file and defaults.`, strings.Join(config.SettingSources, " < ")),
+		Args: cobra.MaximumNArgs(1),
+		RunE: resolveConfig,
+	}
+
+	addRunFlags(cmd)
+	cmd.Flags().String("format", "table", "output format (table, json)")
+	viper.BindPFlag("config.format", cmd.Flags().Lookup("format"))
+
+	return cmd
+}
+
+// resolvedConfig is the JSON output of config resolve
+type resolvedConfig struct {
+	ConfigFile string           `json:"config_file,omitempty"`
+	Scenario   string           `json:"scenario,omitempty"`
+	Precedence []string         `json:"precedence"`
+	Settings   []config.Setting `json:"settings"`
+}
+
+// resolveConfig prints the effective run settings
+func resolveConfig(cmd *cobra.Command, args []string) error {
+	resolved := resolvedConfig{
+		ConfigFile: viper.ConfigFileUsed(),
+		Precedence: config.SettingSources,
+	}
+
+	var scenario *config.Scenario
+	if len(args) == 1 {
+		var err error
+		if scenario, err = config.LoadScenarioFromFile(args[0]); err != nil {
+			return fmt.Errorf("failed to load scenario: %w", err)
+		}
+		resolved.Scenario = args[0]
+	}
+	resolved.Settings = resolveSettings(scenario)
+
+	// Settings a run would reject fail here too
+	if _, err := newLoadConfig(scenario); err != nil {
+		return err
+	}
+
+	switch format := viper.GetString("config.format"); format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(resolved)
+	case "table", "":
+		return writeResolvedConfig(os.Stdout, resolved)
+	default:
+		return fmt.Errorf("unknown format %q (supported: table, json)", format)
+	}
+}
+
+// writeResolvedConfig prints the settings as a table
+func writeResolvedConfig(out io.Writer, resolved resolvedConfig) error {
+	configFile := resolved.ConfigFile
+	if configFile == "" {
+		configFile = "none"
+	}
+	fmt.Fprintf(out, "Config file: %s\n", configFile)
+	if resolved.Scenario != "" {
+		fmt.Fprintf(out, "Scenario: %s\n", resolved.Scenario)
+	}
+	fmt.Fprintf(out, "Precedence: %s\n\n", strings.Join(resolved.Precedence, " < "))
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Setting\tValue\tSource")
+	for _, setting := range resolved.Settings {
+		source := setting.Source
+		switch source {
+		case config.SourceFlag:
+			source += " (" + setting.Flag + ")"
+		case config.SourceEnv:
+			source += " (" + setting.Env + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", setting.Key, settingValue(setting.Value), source)
+	}
+	return w.Flush()
+}
+
+// settingValue formats a setting value for the table, in JSON unless it is a
+// scalar
+func settingValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	switch reflect.Indirect(reflect.ValueOf(value)).Kind() {
+	case reflect.Slice, reflect.Map, reflect.Struct:
+		if data, err := json.Marshal(value); err == nil {
+			return string(data)
+		}
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/reporting"
+	"github.com/alexandredias/gotsunami/internal/server"
+	"github.com/alexandredias/gotsunami/pkg/loadpattern"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// NewCoordinatorCommand creates the coordinator command
+func NewCoordinatorCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "coordinator <scenario.json>",
+		Short: "Run a scenario across several agents and merge their reports",
+		Long: `Distribute a scenario across agents started with "gotsunami agent", over
+gRPC. The VUs, and the rates of arrival-rate stages, are split in proportion
+to the CPUs of each agent, every agent starts at the same time, their live
+metrics are aggregated while the test runs, and their reports are merged into
+one. Interrupting the coordinator stops every agent.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runCoordinator,
+	}
+
+	cmd.Flags().StringArray("agent", nil, "gRPC address of an agent, e.g. gen-1:7071 (repeatable)")
+	cmd.Flags().String("token", "", "bearer token of the agents")
+	cmd.Flags().IntP("vus", "u", 10, "number of virtual users, split across the agents")
+	cmd.Flags().DurationP("duration", "d", 30*time.Second, "test duration")
+	cmd.Flags().Duration("ramp-up", 10*time.Second, "ramp-up duration")
+	cmd.Flags().Duration("ramp-down", 5*time.Second, "ramp-down duration")
+	cmd.Flags().Int("max-requests", 0, "maximum requests per user (0 = unlimited)")
+	cmd.Flags().Duration("timeout", 30*time.Second, "global timeout for requests")
+	cmd.Flags().Bool("skip-preflight", false, "skip the probe request each agent sends before starting the load")
+	cmd.Flags().Int64("seed", 0, "seed for all randomized behavior (0 = random per agent)")
+	cmd.Flags().String("pattern", "steady", fmt.Sprintf("load pattern (%s)", strings.Join(loadpattern.Names(), ", ")))
+	cmd.Flags().StringToString("label", nil, "label attached to the report metadata, e.g. --label git_sha=abc123 (repeatable)")
+	cmd.Flags().Duration("start-delay", server.DefaultStartDelay, "time between sending the runs and the common start of the load")
+	cmd.Flags().Bool("yes", false, "run even when an agent's share of the VUs exceeds its --confirm-vus")
+	cmd.Flags().String("outfile", "", "output file for the merged report; supports {{scenario}}, {{timestamp}}, {{date}}, {{seed}} and {{label.<key>}}")
+
+	viper.BindPFlag("coordinator.agents", cmd.Flags().Lookup("agent"))
+	viper.BindPFlag("coordinator.token", cmd.Flags().Lookup("token"))
+	viper.BindPFlag("coordinator.vus", cmd.Flags().Lookup("vus"))
+	viper.BindPFlag("coordinator.duration", cmd.Flags().Lookup("duration"))
+	viper.BindPFlag("coordinator.ramp_up", cmd.Flags().Lookup("ramp-up"))
+	viper.BindPFlag("coordinator.ramp_down", cmd.Flags().Lookup("ramp-down"))
+	viper.BindPFlag("coordinator.max_requests", cmd.Flags().Lookup("max-requests"))
+	viper.BindPFlag("coordinator.timeout", cmd.Flags().Lookup("timeout"))
+	viper.BindPFlag("coordinator.skip_preflight", cmd.Flags().Lookup("skip-preflight"))
+	viper.BindPFlag("coordinator.seed", cmd.Flags().Lookup("seed"))
+	viper.BindPFlag("coordinator.pattern", cmd.Flags().Lookup("pattern"))
+	viper.BindPFlag("coordinator.start_delay", cmd.Flags().Lookup("start-delay"))
+	viper.BindPFlag("coordinator.outfile", cmd.Flags().Lookup("outfile"))
+	viper.BindPFlag("coordinator.yes", cmd.Flags().Lookup("yes"))
+
+	return cmd
+}
+
+// runCoordinator runs the scenario on the agents and writes the merged report
+func runCoordinator(cmd *cobra.Command, args []string) error {
+	addrs := viper.GetStringSlice("coordinator.agents")
+	if len(addrs) == 0 {
+		return fmt.Errorf("at least one --agent is required")
+	}
+
+	scenario, err := config.LoadScenarioFromFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load scenario: %w", err)
+	}
+	labels, err := cmd.Flags().GetStringToString("label")
+	if err != nil {
+		return err
+	}
+
+	agents := make([]*server.AgentClient, 0, len(addrs))
+	defer func() {
+		for _, agent := range agents {
+			agent.Close()
+		}
+	}()
+	for _, addr := range addrs {
+		agent, err := server.DialAgent(addr, viper.GetString("coordinator.token"))
+		if err != nil {
+			return err
+		}
+		agents = append(agents, agent)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	coordinator := server.NewCoordinator(agents)
+	coordinator.StartDelay = viper.GetDuration("coordinator.start_delay")
+	report, err := coordinator.Run(ctx, server.RunRequest{
+		Scenario:      scenario,
+		VirtualUsers:  viper.GetInt("coordinator.vus"),
+		Duration:      viper.GetDuration("coordinator.duration").String(),
+		RampUp:        viper.GetDuration("coordinator.ramp_up").String(),
+		RampDown:      viper.GetDuration("coordinator.ramp_down").String(),
+		MaxRequests:   viper.GetInt("coordinator.max_requests"),
+		Timeout:       viper.GetDuration("coordinator.timeout").String(),
+		Pattern:       viper.GetString("coordinator.pattern"),
+		Seed:          viper.GetInt64("coordinator.seed"),
+		SkipPreflight: viper.GetBool("coordinator.skip_preflight"),
+		Labels:        labels,
+		Confirm:       viper.GetBool("coordinator.yes"),
+	})
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Distributed test completed: %d requests from %d agents, %.2f%% success rate, %.2f req/s",
+		report.Summary.TotalRequests, len(report.Metadata.Sources), report.Summary.SuccessRate, report.Throughput.RequestsPerSecond)
+
+	outfile, err := reporting.OutfileName(viper.GetString("coordinator.outfile"), report)
+	if err != nil {
+		return err
+	}
+	reporter := reporting.NewJSONReporter(nil)
+	if err := reporter.WriteReport(report, outfile); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/protocols/grpc"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// NewImportCommand creates the import command
+func NewImportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Generate scenarios from API descriptions and static sites",
+	}
+
+	cmd.AddCommand(newImportGRPCCommand())
+	cmd.AddCommand(newImportStaticCommand())
+
+	return cmd
+}
+
+// newImportGRPCCommand creates the import grpc command
+func newImportGRPCCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "grpc --reflect <host:port>",
+		Short: "Generate scenarios for the methods of a gRPC server",
+		Long: `List the services and methods of a gRPC server through server reflection
+and write one scenario file per unary method, with a sample request message
+holding every field of the input type.
+
+The server health is checked with the standard grpc.health.v1 service when
+the server offers it.`,
+		Args: cobra.NoArgs,
+		RunE: importGRPC,
+	}
+
+	cmd.Flags().String("reflect", "", "address (host:port) of the server to describe through reflection")
+	cmd.Flags().String("outdir", ".", "directory the scenario files are written to")
+	cmd.Flags().StringSlice("service", nil, "only import these services (full names)")
+	cmd.Flags().Bool("list", false, "only list services and methods, without writing scenarios")
+	cmd.Flags().Bool("force", false, "overwrite existing scenario files")
+	cmd.Flags().Bool("plaintext", false, "connect without TLS")
+	cmd.Flags().Bool("tls-skip-verify", false, "skip TLS certificate verification")
+	cmd.Flags().Duration("timeout", 10*time.Second, "timeout for reflection and health requests")
+	cmd.MarkFlagRequired("reflect")
+
+	viper.BindPFlag("import.grpc.reflect", cmd.Flags().Lookup("reflect"))
+	viper.BindPFlag("import.grpc.outdir", cmd.Flags().Lookup("outdir"))
+	viper.BindPFlag("import.grpc.services", cmd.Flags().Lookup("service"))
+	viper.BindPFlag("import.grpc.list", cmd.Flags().Lookup("list"))
+	viper.BindPFlag("import.grpc.force", cmd.Flags().Lookup("force"))
+	viper.BindPFlag("import.grpc.plaintext", cmd.Flags().Lookup("plaintext"))
+	viper.BindPFlag("import.grpc.tls_skip_verify", cmd.Flags().Lookup("tls-skip-verify"))
+	viper.BindPFlag("import.grpc.timeout", cmd.Flags().Lookup("timeout"))
+
+	return cmd
+}
+
+// importGRPC describes a gRPC server and scaffolds its scenarios
+func importGRPC(cmd *cobra.Command, args []string) error {
+	target := viper.GetString("import.grpc.reflect")
+	dialConfig := grpc.DialConfig{
+		Plaintext:     viper.GetBool("import.grpc.plaintext"),
+		TLSSkipVerify: viper.GetBool("import.grpc.tls_skip_verify"),
+	}
+
+	conn, err := grpc.Dial(target, dialConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), viper.GetDuration("import.grpc.timeout"))
+	defer cancel()
+
+	if health, err := grpc.CheckHealth(ctx, conn, ""); err != nil {
+		logrus.Debugf("Skipping health status: %v", err)
+	} else {
+		fmt.Printf("Health: %s\n", health)
+	}
+
+	services, err := grpc.Describe(ctx, conn)
+	if err != nil {
+		return err
+	}
+	services = filterServices(services, viper.GetStringSlice("import.grpc.services"))
+	if len(services) == 0 {
+		return fmt.Errorf("no services found on %s", target)
+	}
+
+	list := viper.GetBool("import.grpc.list")
+	outdir := viper.GetString("import.grpc.outdir")
+	if !list {
+		if err := os.MkdirAll(outdir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	written := 0
+	for _, service := range services {
+		fmt.Println(service.FullName())
+		methods := service.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			method := methods.Get(i)
+			fmt.Printf("  %s(%s) returns (%s)\n", method.Name(),
+				streamingName(method.IsStreamingClient(), method.Input()),
+				streamingName(method.IsStreamingServer(), method.Output()))
+
+			if list {
+				continue
+			}
+			if method.IsStreamingClient() || method.IsStreamingServer() {
+				logrus.Warnf("Skipping streaming method %s: only unary calls can be load tested", grpc.MethodPath(method))
+				continue
+			}
+
+			filename := filepath.Join(outdir, fmt.Sprintf("%s.%s.json", service.FullName(), method.Name()))
+			if err := writeGRPCScenario(filename, target, dialConfig, method); err != nil {
+				return err
+			}
+			written++
+		}
+	}
+
+	if !list {
+		fmt.Printf("Wrote %d scenario(s) to %s\n", written, outdir)
+	}
+
+	return nil
+}
+
+// filterServices keeps the services whose full name is in names, or all
+// services when names is empty
+func filterServices(services []protoreflect.ServiceDescriptor, names []string) []protoreflect.ServiceDescriptor {
+	if len(names) == 0 {
+		return services
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	var filtered []protoreflect.ServiceDescriptor
+	for _, service := range services {
+		if wanted[string(service.FullName())] {
+			filtered = append(filtered, service)
+		}
+	}
+
+	return filtered
+}
+
+// streamingName formats a method argument as written in a .proto file
+func streamingName(streaming bool, message protoreflect.MessageDescriptor) string {
+	if streaming {
+		return "stream " + string(message.FullName())
+	}
+	return string(message.FullName())
+}
+
+// writeGRPCScenario writes a scenario calling method with a sample request
+func writeGRPCScenario(filename, target string, dialConfig grpc.DialConfig, method protoreflect.MethodDescriptor) error {
+	if !viper.GetBool("import.grpc.force") {
+		if _, err := os.Stat(filename); err == nil {
+			return fmt.Errorf("%s already exists; use --force to overwrite it", filename)
+		}
+	}
+
+	scheme := "grpcs"
+	if dialConfig.Plaintext {
+		scheme = "grpc"
+	}
+
+	path := grpc.MethodPath(method)
+	scenario := &config.Scenario{
+		Name:        strings.TrimPrefix(path, "/"),
+		Description: fmt.Sprintf("Generated from the server reflection of %s", target),
+		Protocol:    "grpc",
+		Method:      strings.TrimPrefix(path, "/"),
+		URL:         path,
+		BaseURL:     fmt.Sprintf("%s://%s", scheme, target),
+		Body:        grpc.SampleMessage(method.Input()),
+		ProtocolConfig: map[string]interface{}{
+			"reflection": true,
+		},
+	}
+	if dialConfig.TLSSkipVerify {
+		scenario.ProtocolConfig["tls_skip_verify"] = true
+	}
+
+	data, err := json.MarshalIndent(scenario, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode scenario: %w", err)
+	}
+
+	if err := os.WriteFile(filename, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write scenario: %w", err)
+	}
+
+	return nil
+}
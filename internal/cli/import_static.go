@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/assets"
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Weightings of the requests of a static mix
+const (
+	weightSize    = "size"
+	weightUniform = "uniform"
+)
+
+// newImportStaticCommand creates the import static command
+func newImportStaticCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "static (--sitemap <url|file> | --listing <url> | --dir <path> --base-url <url>)",
+		Short: "Generate a CDN scenario from the assets of a static site",
+		Long: `List the assets of a static site or CDN origin, with their sizes, and write
+a scenario requesting them at random, in proportion to their size by default,
+so the load reflects the real distribution of the assets.
+
+Assets come from a sitemap (following sitemap indexes), an HTTP directory
+listing such as nginx or Apache autoindex pages, or a local directory such as
+the document root of the origin. Sizes of remote assets are found with HEAD
+requests. The assets are written to a CSV data file next to the scenario.`,
+		Args: cobra.NoArgs,
+		RunE: importStatic,
+	}
+
+	cmd.Flags().String("sitemap", "", "URL or file of a sitemap listing the assets")
+	cmd.Flags().String("listing", "", "URL of an HTTP directory listing of the assets")
+	cmd.Flags().String("dir", "", "local directory holding the assets, such as the origin's document root")
+	cmd.Flags().String("base-url", "", "base URL of the scenario (default: origin of the listed URLs; required with --dir)")
+	cmd.Flags().String("output", "static.json", "scenario file to write; the data file is written next to it")
+	cmd.Flags().String("weight", weightSize, "request weighting: size (larger assets requested more often) or uniform")
+	cmd.Flags().Int("depth", 5, "subdirectory levels followed in a directory listing")
+	cmd.Flags().Int("concurrency", 8, "concurrent requests finding asset sizes")
+	cmd.Flags().Bool("force", false, "overwrite existing files")
+	cmd.Flags().Bool("tls-skip-verify", false, "skip TLS certificate verification")
+	cmd.Flags().Duration("timeout", 10*time.Second, "timeout of each request")
+	cmd.MarkFlagsMutuallyExclusive("sitemap", "listing", "dir")
+	cmd.MarkFlagsOneRequired("sitemap", "listing", "dir")
+
+	viper.BindPFlag("import.static.sitemap", cmd.Flags().Lookup("sitemap"))
+	viper.BindPFlag("import.static.listing", cmd.Flags().Lookup("listing"))
+	viper.BindPFlag("import.static.dir", cmd.Flags().Lookup("dir"))
+	viper.BindPFlag("import.static.base_url", cmd.Flags().Lookup("base-url"))
+	viper.BindPFlag("import.static.output", cmd.Flags().Lookup("output"))
+	viper.BindPFlag("import.static.weight", cmd.Flags().Lookup("weight"))
+	viper.BindPFlag("import.static.depth", cmd.Flags().Lookup("depth"))
+	viper.BindPFlag("import.static.concurrency", cmd.Flags().Lookup("concurrency"))
+	viper.BindPFlag("import.static.force", cmd.Flags().Lookup("force"))
+	viper.BindPFlag("import.static.tls_skip_verify", cmd.Flags().Lookup("tls-skip-verify"))
+	viper.BindPFlag("import.static.timeout", cmd.Flags().Lookup("timeout"))
+
+	return cmd
+}
+
+// importStatic lists the assets of a static site and writes their scenario
+func importStatic(cmd *cobra.Command, args []string) error {
+	weight := viper.GetString("import.static.weight")
+	if weight != weightSize && weight != weightUniform {
+		return fmt.Errorf("invalid weight %q: use %s or %s", weight, weightSize, weightUniform)
+	}
+	baseURL := strings.TrimSuffix(viper.GetString("import.static.base_url"), "/")
+	// The data file takes the name of the scenario with a .csv extension
+	output := viper.GetString("import.static.output")
+	if strings.EqualFold(filepath.Ext(output), ".csv") {
+		return fmt.Errorf("invalid output %s: the data file would overwrite the scenario, use a .json name", output)
+	}
+
+	client := &http.Client{
+		Timeout: viper.GetDuration("import.static.timeout"),
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: viper.GetBool("import.static.tls_skip_verify")},
+		},
+	}
+
+	var list []assets.Asset
+	if dir := viper.GetString("import.static.dir"); dir != "" {
+		if baseURL == "" {
+			return fmt.Errorf("--base-url is required with --dir")
+		}
+		found, err := assets.FromDirectory(os.DirFS(dir))
+		if err != nil {
+			return err
+		}
+		list = found
+	} else {
+		var urls []string
+		var err error
+		if sitemap := viper.GetString("import.static.sitemap"); sitemap != "" {
+			urls, err = assets.FromSitemap(cmd.Context(), client, sitemap)
+		} else {
+			urls, err = assets.FromListing(cmd.Context(), client, viper.GetString("import.static.listing"), viper.GetInt("import.static.depth"))
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Finding the sizes of %d asset(s)...\n", len(urls))
+		origin, relative, others := assets.Relative(assets.Sizes(cmd.Context(), client, urls, viper.GetInt("import.static.concurrency")))
+		if len(others) > 0 {
+			logrus.Warnf("Skipping %d asset(s) outside %s, such as %s", len(others), origin, others[0].Path)
+		}
+		if baseURL == "" {
+			baseURL = origin
+		}
+		list = relative
+	}
+
+	// Assets of unknown size would never be requested in a mix weighed by size
+	var unknown int
+	var total int64
+	for _, asset := range list {
+		if asset.Size < 0 {
+			unknown++
+		} else {
+			total += asset.Size
+		}
+	}
+	if unknown > 0 {
+		logrus.Warnf("%d asset(s) have an unknown size and weigh 0", unknown)
+	}
+	if len(list) == 0 || (weight == weightSize && total == 0) {
+		return fmt.Errorf("no assets of known size found")
+	}
+
+	dataFile := strings.TrimSuffix(output, filepath.Ext(output)) + ".csv"
+	var data bytes.Buffer
+	if err := assets.WriteCSV(&data, list); err != nil {
+		return fmt.Errorf("failed to encode assets: %w", err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(output), filepath.Ext(output))
+	scenario := &config.Scenario{
+		Name:        name,
+		Description: fmt.Sprintf("Static assets of %s, weighed by %s", baseURL, weight),
+		Method:      "GET",
+		URL:         "{{csv.path}}",
+		BaseURL:     baseURL,
+		Data:        &config.DataConfig{File: filepath.Base(dataFile), Strategy: config.DataRandom},
+	}
+	if weight == weightSize {
+		scenario.Data.Weight = "size"
+	}
+	encoded, err := json.MarshalIndent(scenario, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode scenario: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if !viper.GetBool("import.static.force") {
+		for _, filename := range []string{dataFile, output} {
+			if _, err := os.Stat(filename); err == nil {
+				return fmt.Errorf("%s already exists; use --force to overwrite it", filename)
+			}
+		}
+	}
+	if err := os.WriteFile(dataFile, data.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write data file: %w", err)
+	}
+	if err := os.WriteFile(output, append(encoded, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write scenario: %w", err)
+	}
+
+	fmt.Printf("Wrote %d asset(s), %s in total, to %s and scenario %s\n", len(list), formatBytes(total), dataFile, output)
+	return nil
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/alexandredias/gotsunami/internal/reporting"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// NewMergeCommand creates the merge command
+func NewMergeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "merge <report.json> <report.json> [report.json...]",
+		Short: "Merge reports from multiple load generators",
+		Long: `Merge JSON reports produced by several independent generators running the
+same test concurrently into a single report. Request counts, status codes,
+errors and throughput are summed and latency percentiles are recomputed from
+the merged latency histograms instead of being averaged.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: mergeReports,
+	}
+
+	cmd.Flags().String("outfile", "", "output file for the merged report (default stdout)")
+
+	viper.BindPFlag("merge.outfile", cmd.Flags().Lookup("outfile"))
+
+	return cmd
+}
+
+// mergeReports loads, merges and writes reports
+func mergeReports(cmd *cobra.Command, args []string) error {
+	reports := make([]*reporting.Report, 0, len(args))
+	for _, filename := range args {
+		report, err := reporting.LoadReport(filename)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", filename, err)
+		}
+		reports = append(reports, report)
+	}
+
+	merged, err := reporting.MergeReports(reports, args)
+	if err != nil {
+		return fmt.Errorf("failed to merge reports: %w", err)
+	}
+
+	outfile, err := reporting.OutfileName(viper.GetString("merge.outfile"), merged)
+	if err != nil {
+		return err
+	}
+
+	reporter := reporting.NewJSONReporter(nil)
+	if err := reporter.WriteReport(merged, outfile); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	return nil
+}
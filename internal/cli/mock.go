@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/mock"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// NewMockCommand creates the mock command
+func NewMockCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mock",
+		Short: "Run a local mock server to try scenarios against",
+		Long: `Run a mock HTTP server to validate scenarios and load patterns locally,
+without depending on a real API or the network.
+
+Without --endpoints every path echoes the request back as JSON, with the latency
+and errors set by the flags. An endpoints file declares endpoints instead, each
+with its own status, headers, body, latency distribution (fixed, uniform,
+normal, exponential) and error rates.`,
+		Args: cobra.NoArgs,
+		RunE: runMock,
+	}
+
+	cmd.Flags().String("listen", ":9000", "address to listen on")
+	cmd.Flags().String("endpoints", "", "JSON file declaring the mock endpoints")
+	cmd.Flags().Duration("latency", 0, "mean latency of the echo endpoint")
+	cmd.Flags().Duration("jitter", 0, "standard deviation of the echo latency (normal distribution)")
+	cmd.Flags().Float64("error-rate", 0, "share of echo requests that fail, between 0 and 1")
+	cmd.Flags().Int("error-status", 500, "status of failed echo requests (0 closes the connection)")
+
+	viper.BindPFlag("mock.listen", cmd.Flags().Lookup("listen"))
+	viper.BindPFlag("mock.endpoints", cmd.Flags().Lookup("endpoints"))
+	viper.BindPFlag("mock.latency", cmd.Flags().Lookup("latency"))
+	viper.BindPFlag("mock.jitter", cmd.Flags().Lookup("jitter"))
+	viper.BindPFlag("mock.error_rate", cmd.Flags().Lookup("error-rate"))
+	viper.BindPFlag("mock.error_status", cmd.Flags().Lookup("error-status"))
+
+	return cmd
+}
+
+// runMock starts the mock server and blocks until interrupted
+func runMock(cmd *cobra.Command, args []string) error {
+	cfg, err := mockConfig()
+	if err != nil {
+		return err
+	}
+
+	srv, err := mock.NewServer(viper.GetString("mock.listen"), cfg)
+	if err != nil {
+		return err
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-signals:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shut down mock server: %w", err)
+	}
+
+	return nil
+}
+
+// mockConfig loads the endpoints file, or builds the echo endpoint from flags
+func mockConfig() (*mock.Config, error) {
+	if filename := viper.GetString("mock.endpoints"); filename != "" {
+		return mock.LoadConfig(filename)
+	}
+
+	var latency *mock.LatencyConfig
+	if mean, jitter := viper.GetDuration("mock.latency"), viper.GetDuration("mock.jitter"); mean > 0 || jitter > 0 {
+		latency = &mock.LatencyConfig{Mean: mean.String()}
+		if jitter > 0 {
+			latency.Distribution = mock.LatencyNormal
+			latency.StdDev = jitter.String()
+		}
+	}
+
+	var errors []mock.ErrorConfig
+	if rate := viper.GetFloat64("mock.error_rate"); rate > 0 {
+		errors = append(errors, mock.ErrorConfig{Rate: rate, Status: viper.GetInt("mock.error_status")})
+	}
+
+	return mock.EchoConfig(latency, errors), nil
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/alexandredias/gotsunami/internal/engine"
+	"github.com/spf13/viper"
+)
+
+// planLimits are the sizes above which a test only runs with --yes; 0
+// disables a limit
+type planLimits struct {
+	vus      int
+	rps      float64
+	requests int64
+}
+
+// newPlanLimits reads the confirmation limits from the run flags
+func newPlanLimits() planLimits {
+	return planLimits{
+		vus:      viper.GetInt("run.confirm_vus"),
+		rps:      viper.GetFloat64("run.confirm_rps"),
+		requests: viper.GetInt64("run.confirm_requests"),
+	}
+}
+
+// exceeded describes the limits the plan goes over
+func (l planLimits) exceeded(plan *engine.Plan) []string {
+	var exceeded []string
+	if l.vus > 0 && plan.VUs > l.vus {
+		exceeded = append(exceeded, fmt.Sprintf("%d VUs (limit %d, --confirm-vus)", plan.VUs, l.vus))
+	}
+	if l.rps > 0 && plan.PeakRPS > l.rps {
+		exceeded = append(exceeded, fmt.Sprintf("%.0f req/s (limit %.0f, --confirm-rps)", plan.PeakRPS, l.rps))
+	}
+	if l.requests > 0 && plan.Requests > l.requests {
+		exceeded = append(exceeded, fmt.Sprintf("%d requests (limit %d, --confirm-requests)", plan.Requests, l.requests))
+	}
+	return exceeded
+}
+
+// writePlan prints the plan of a test: its phases, then its totals
+func writePlan(out io.Writer, plan *engine.Plan) error {
+	bound := "up to "
+	if plan.Assumptions.Latency > 0 {
+		bound = "~"
+	}
+
+	fmt.Fprintf(out, "Test plan: %s (%s pattern, %v, %d VUs)\n\n", plan.Scenario, plan.Pattern, plan.Duration, plan.VUs)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	if len(plan.Phases) > 0 {
+		fmt.Fprintf(w, "Phase\tStart\tDuration\tIntensity\tPeak req/s\n")
+		for _, phase := range plan.Phases {
+			intensity := fmt.Sprintf("%.0f%%", phase.From*100)
+			if phase.To != phase.From {
+				intensity += fmt.Sprintf(" -> %.0f%%", phase.To*100)
+			}
+			fmt.Fprintf(w, "%s\t%v\t%v\t%s\t%.1f\n", phase.Name, phase.Start, phase.Duration, intensity, phase.PeakRPS)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintln(out)
+	}
+
+	fmt.Fprintf(w, "Requests:\t%s%d (%d per iteration)\n", bound, plan.Requests, plan.StepsPerIteration)
+	fmt.Fprintf(w, "Peak rate:\t%s%.1f req/s\n", bound, plan.PeakRPS)
+	fmt.Fprintf(w, "Data sent:\t%s%s (~%s per request)\n", bound, formatBytes(plan.BytesSent), formatBytes(plan.RequestSize))
+	if plan.Assumptions.ResponseSize > 0 {
+		fmt.Fprintf(w, "Data received:\t%s%s (%s per response)\n", bound, formatBytes(plan.BytesReceived), formatBytes(plan.Assumptions.ResponseSize))
+	} else {
+		fmt.Fprintf(w, "Data received:\tnot estimated (set --plan-response-size)\n")
+	}
+	if plan.Warmup > 0 {
+		fmt.Fprintf(w, "Warm-up:\tup to %v at %d VUs before the test, not included\n", plan.Warmup, plan.WarmupVUs)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if plan.Assumptions.Latency > 0 {
+		fmt.Fprintf(out, "\nEstimated with %v per response.\n", plan.Assumptions.Latency)
+	} else {
+		fmt.Fprintf(out, "\nUpper bounds: responses are assumed instant (set --plan-latency).\n")
+	}
+	return nil
+}
+
+// formatBytes formats a byte count with binary units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n)
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB"}
+	i := -1
+	for value >= unit && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
+
+// planAssumptions reads the plan assumptions from the run flags
+func planAssumptions() engine.PlanAssumptions {
+	return engine.PlanAssumptions{
+		Latency:      viper.GetDuration("run.plan_latency"),
+		ResponseSize: viper.GetInt64("run.plan_response_size"),
+	}
+}
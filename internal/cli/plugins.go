@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/alexandredias/gotsunami/internal/protocols/plugins"
+	"github.com/alexandredias/gotsunami/pkg/plugin"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// NewPluginsCommand creates the plugins command
+func NewPluginsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plugins",
+		Short: "List discovered protocol plugins",
+		Long: fmt.Sprintf(`List protocol plugins found in the plugin directories.
+
+Plugins are executables named %s<name>. A scenario selects one
+with "protocol": "<name>" and configures it through "protocol_config".`, plugin.BinaryPrefix),
+		Args: cobra.NoArgs,
+		RunE: listPlugins,
+	}
+
+	return cmd
+}
+
+// listPlugins prints discovered plugins
+func listPlugins(cmd *cobra.Command, args []string) error {
+	found, err := plugins.Discover(viper.GetStringSlice("plugin_dirs"))
+	if err != nil {
+		return err
+	}
+
+	if len(found) == 0 {
+		fmt.Println("No protocol plugins found")
+		return nil
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Printf("%-20s %s\n", name, found[name])
+	}
+
+	return nil
+}
@@ -1,13 +1,25 @@
 package cli
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/alexandredias/gotsunami/internal/config"
 	"github.com/alexandredias/gotsunami/internal/engine"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/protocols/plugins"
 	"github.com/alexandredias/gotsunami/internal/reporting"
+	"github.com/alexandredias/gotsunami/pkg/loadpattern"
+	"github.com/alexandredias/gotsunami/pkg/reporter"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -19,11 +31,19 @@ func NewRunCommand() *cobra.Command {
 		Short: "Run a load test scenario",
 		Long: `Run a load test scenario defined in a JSON configuration file.
 The scenario file contains all the necessary configuration for the test including
-the target URL, request parameters, validation rules, and load patterns.`,
+the target URL, request parameters, validation rules, and load patterns.
+Use - as the scenario file to read it from stdin.`,
 		Args: cobra.ExactArgs(1),
 		RunE: runLoadTest,
 	}
 
+	addRunFlags(cmd)
+
+	return cmd
+}
+
+// addRunFlags adds the flags configuring a run to cmd
+func addRunFlags(cmd *cobra.Command) {
 	// Load test configuration flags
 	cmd.Flags().IntP("vus", "u", 10, "number of virtual users (threads)")
 	cmd.Flags().DurationP("duration", "d", 30*time.Second, "test duration")
@@ -32,66 +52,161 @@ the target URL, request parameters, validation rules, and load patterns.`,
 	cmd.Flags().Duration("delay", 0, "delay between requests per user")
 	cmd.Flags().Int("max-requests", 0, "maximum requests per user (0 = unlimited)")
 	cmd.Flags().Duration("timeout", 30*time.Second, "global timeout for requests")
+	cmd.Flags().Bool("skip-preflight", false, "skip the probe request sent before starting the load")
+	cmd.Flags().Int64("seed", 0, "seed for all randomized behavior (0 = random, logged and reported)")
 
 	// Load patterns
-	cmd.Flags().String("pattern", "steady", "load pattern (spike, steady, ramp-up, stress)")
+	cmd.Flags().String("pattern", "steady", fmt.Sprintf("load pattern (%s)", strings.Join(loadpattern.Names(), ", ")))
+	cmd.Flags().StringArray("stage", nil, "arrival-rate stage DURATION:TARGET, e.g. 2m:500rps, ramping linearly from the previous target (repeatable; replaces --pattern, --duration and the scenario stages)")
+
+	// Test plan: estimated before anything is sent
+	cmd.Flags().Bool("plan", false, "print the test plan (phases, requests, peak rate, data transfer) and exit without running")
+	cmd.Flags().Bool("yes", false, "run even when the test plan exceeds a --confirm-* limit")
+	cmd.Flags().Int("confirm-vus", 1000, "tests with more VUs than this need --yes (0 = no limit)")
+	cmd.Flags().Float64("confirm-rps", 0, "tests whose planned peak rate exceeds this many req/s need --yes (0 = no limit)")
+	cmd.Flags().Int64("confirm-requests", 0, "tests planning more requests than this need --yes (0 = no limit)")
+	cmd.Flags().Duration("plan-latency", 0, "response time the plan assumes (0 = instant, giving upper bounds)")
+	cmd.Flags().Int64("plan-response-size", 0, "response size in bytes the plan assumes (0 = data received not estimated)")
 
 	// Output configuration
 	cmd.Flags().Bool("live", false, "show real-time metrics in terminal")
-	cmd.Flags().String("report-format", "json", "report format (json, yaml, csv)")
-	cmd.Flags().String("outfile", "", "output file for report")
+	cmd.Flags().StringArray("goal", nil, "latency goal the report estimates the sustainable rate for from the stages, e.g. p95=200ms (repeatable; default: the scenario SLO latency objectives)")
+	cmd.Flags().StringArray("out", nil, fmt.Sprintf("stream metrics during the run to an output such as statsd://localhost:8125 or influxdb=http://localhost:8086/mydb (repeatable; %s)", strings.Join(metrics.OutputSchemes, ", ")))
+	cmd.Flags().String("metrics-addr", "", "serve live metrics on /metrics in Prometheus format at this address, e.g. :9090")
+	cmd.Flags().String("report-format", "json", fmt.Sprintf("report format (%s)", strings.Join(reporter.Formats(), ", ")))
+	cmd.Flags().String("outfile", "", "output file for report; supports {{scenario}}, {{timestamp}}, {{date}}, {{seed}} and {{label.<key>}}")
+	cmd.Flags().String("raw-out", "", "write one JSON line per request to this file")
+	cmd.Flags().Int("trace-vus", 0, "write an ordered trace of everything the first N VUs do (variables, requests, responses)")
+	cmd.Flags().String("trace-out", "gotsunami-trace.jsonl", "file receiving the --trace-vus trace")
+	cmd.Flags().String("otlp-endpoint", "", "OTLP/HTTP collector receiving one trace per iteration, e.g. http://localhost:4318")
+	cmd.Flags().Float64("otlp-sample", 1, "share of iterations exported with --otlp-endpoint, above 0 and at most 1")
 	cmd.Flags().Bool("stdout", false, "force output to stdout (for CI/CD)")
+	cmd.Flags().Uint("histogram-precision", 0, fmt.Sprintf("latency histogram precision in bits, 2-%d; error below 2^-bits (0 = %d, under 1%%)",
+		metrics.MaxHistogramPrecision, metrics.DefaultHistogramPrecision))
+	cmd.Flags().Bool("high-precision", false, fmt.Sprintf("benchmark-grade percentiles: %d-bit histograms, error under 0.1%%, ~7x the memory",
+		metrics.HighHistogramPrecision))
+	cmd.Flags().StringToString("label", nil, "label attached to the report metadata, e.g. --label git_sha=abc123 (repeatable; also GOTSUNAMI_LABEL_<KEY>)")
 
-	// Validation flags
-	cmd.Flags().IntSlice("expect-status", []int{200}, "expected status codes")
+	// Validation flags override the scenario validation rules when set
+	cmd.Flags().IntSlice("expect-status", nil, "expected status codes (default from scenario, or 200)")
 	cmd.Flags().String("expect-body", "", "content that should be in response body")
 	cmd.Flags().String("expect-body-not", "", "content that should NOT be in response body")
 	cmd.Flags().Duration("expect-response-time", 0, "maximum expected response time")
 
 	// Advanced configuration
-	cmd.Flags().Int("workers", 0, "number of workers (0 = CPU cores)")
+	cmd.Flags().Duration("drain", 5*time.Second, "time in-flight requests may finish after the test ends")
+	cmd.Flags().Duration("warmup", 0, "hold at --warmup-vus for up to this long until p95 is stable before the measured test (0 = off)")
+	cmd.Flags().Int("warmup-vus", 1, "virtual users sending the warm-up requests")
+	cmd.Flags().Duration("warmup-window", 10*time.Second, "window p95 is measured over during the warm-up; three in a row must agree")
+	cmd.Flags().Float64("warmup-tolerance", 0.1, "largest relative standard deviation of the warm-up p95 considered stable")
+	cmd.Flags().Int("workers", 0, "number of workers (0 = one per virtual user)")
 	cmd.Flags().Int("connections", 100, "HTTP connection pool size")
-	cmd.Flags().Bool("keep-alive", true, "keep HTTP connections alive")
-	cmd.Flags().Bool("disable-keep-alive", false, "disable HTTP keep-alive")
+	cmd.Flags().Int("max-conns-per-host", 0, "maximum open connections per host (0 = unlimited)")
+	cmd.Flags().Int("max-requests-per-conn", 0, "close each connection after this many requests (0 = unlimited)")
+	cmd.Flags().Int("pipeline", 0, "experimental: requests sent on a connection without waiting for responses (HTTP/1.1 pipelining; 0 or 1 = off)")
+	cmd.Flags().Duration("conn-soft-start", 0, "pace the requests of connections younger than this, starting at --conn-soft-start-rate (0 = off)")
+	cmd.Flags().Float64("conn-soft-start-rate", 10, "requests per second a new connection starts at during --conn-soft-start")
+	cmd.Flags().Int64("max-decompressed-size", 0, "bytes a compressed response body may decompress to (0 = 64MB, -1 = no limit)")
+	cmd.Flags().Float64("max-decompression-ratio", 0, "times a compressed response body may expand past 1MB (0 = 100, -1 = no limit)")
+	cmd.Flags().Bool("client-per-vu", false, "give each virtual user its own HTTP client and connection pool")
+	cmd.Flags().String("global-limit", "", "URL of a limit served by 'gotsunami serve' capping requests in flight across agents, e.g. http://host:8080/api/v1/limits/checkout")
+	cmd.Flags().String("global-limit-token", "", "bearer token of the server serving --global-limit")
+	cmd.Flags().Bool("keep-alive", true, "keep HTTP connections alive (--keep-alive=false is the same as --disable-keep-alive)")
+	cmd.Flags().Bool("disable-keep-alive", false, "disable HTTP keep-alive; conflicts with an explicit --keep-alive")
 	cmd.Flags().Bool("tls-skip-verify", false, "skip TLS verification (testing only)")
+	cmd.Flags().String("client-certs", "", "directory of client certificates for mTLS, <name>.crt (or .pem) with <name>.key, assigned one per VU")
+	cmd.Flags().String("http-version", "", "HTTP version: 1.1, 2 (h2, or h2c for http://), 3 (QUIC, https:// only) or auto (h2 when the TLS server offers it); default from scenario, or 1.1")
 	cmd.Flags().String("proxy", "", "HTTP/HTTPS proxy")
 	cmd.Flags().String("user-agent", "GoTsunami/1.0", "custom user agent")
+	cmd.Flags().Bool("identity-headers", false, "inject per-VU client ID and per-request ID headers")
+	cmd.Flags().String("client-id-header", "X-Client-Id", "header carrying the stable per-VU identifier")
+	cmd.Flags().String("request-id-header", "X-Request-Id", "header carrying the unique per-request identifier")
+	cmd.Flags().String("bandwidth", "", fmt.Sprintf("per-connection bandwidth: profile (%s) or download/upload rates, e.g. 1.5mbps/384kbps",
+		strings.Join(config.BandwidthProfileNames(), ", ")))
 
-	// Bind flags to viper
-	viper.BindPFlag("run.vus", cmd.Flags().Lookup("vus"))
-	viper.BindPFlag("run.duration", cmd.Flags().Lookup("duration"))
-	viper.BindPFlag("run.ramp_up", cmd.Flags().Lookup("ramp-up"))
-	viper.BindPFlag("run.ramp_down", cmd.Flags().Lookup("ramp-down"))
-	viper.BindPFlag("run.delay", cmd.Flags().Lookup("delay"))
-	viper.BindPFlag("run.max_requests", cmd.Flags().Lookup("max-requests"))
-	viper.BindPFlag("run.timeout", cmd.Flags().Lookup("timeout"))
-	viper.BindPFlag("run.pattern", cmd.Flags().Lookup("pattern"))
-	viper.BindPFlag("run.live", cmd.Flags().Lookup("live"))
-	viper.BindPFlag("run.report_format", cmd.Flags().Lookup("report-format"))
-	viper.BindPFlag("run.outfile", cmd.Flags().Lookup("outfile"))
-	viper.BindPFlag("run.stdout", cmd.Flags().Lookup("stdout"))
-	viper.BindPFlag("run.expect_status", cmd.Flags().Lookup("expect-status"))
-	viper.BindPFlag("run.expect_body", cmd.Flags().Lookup("expect-body"))
-	viper.BindPFlag("run.expect_body_not", cmd.Flags().Lookup("expect-body-not"))
-	viper.BindPFlag("run.expect_response_time", cmd.Flags().Lookup("expect-response-time"))
-	viper.BindPFlag("run.workers", cmd.Flags().Lookup("workers"))
-	viper.BindPFlag("run.connections", cmd.Flags().Lookup("connections"))
-	viper.BindPFlag("run.keep_alive", cmd.Flags().Lookup("keep-alive"))
-	viper.BindPFlag("run.disable_keep_alive", cmd.Flags().Lookup("disable-keep-alive"))
-	viper.BindPFlag("run.tls_skip_verify", cmd.Flags().Lookup("tls-skip-verify"))
-	viper.BindPFlag("run.proxy", cmd.Flags().Lookup("proxy"))
-	viper.BindPFlag("run.user_agent", cmd.Flags().Lookup("user-agent"))
-
-	return cmd
+	// Bind flags to settings when the command runs, so config resolve can
+	// share them
+	bindSetting(cmd, "run.vus", "vus")
+	bindSetting(cmd, "run.duration", "duration")
+	bindSetting(cmd, "run.ramp_up", "ramp-up")
+	bindSetting(cmd, "run.ramp_down", "ramp-down")
+	bindSetting(cmd, "run.delay", "delay")
+	bindSetting(cmd, "run.max_requests", "max-requests")
+	bindSetting(cmd, "run.timeout", "timeout")
+	bindSetting(cmd, "run.seed", "seed")
+	bindSetting(cmd, "run.skip_preflight", "skip-preflight")
+	bindSetting(cmd, "run.pattern", "pattern")
+	bindSetting(cmd, "run.stages", "stage")
+	bindSetting(cmd, "run.plan", "plan")
+	bindSetting(cmd, "run.yes", "yes")
+	bindSetting(cmd, "run.confirm_vus", "confirm-vus")
+	bindSetting(cmd, "run.confirm_rps", "confirm-rps")
+	bindSetting(cmd, "run.confirm_requests", "confirm-requests")
+	bindSetting(cmd, "run.plan_latency", "plan-latency")
+	bindSetting(cmd, "run.plan_response_size", "plan-response-size")
+	bindSetting(cmd, "run.live", "live")
+	bindSetting(cmd, "run.goals", "goal")
+	bindSetting(cmd, "run.outputs", "out")
+	bindSetting(cmd, "run.metrics_addr", "metrics-addr")
+	bindSetting(cmd, "run.report_format", "report-format")
+	bindSetting(cmd, "run.outfile", "outfile")
+	bindSetting(cmd, "run.stdout", "stdout")
+	bindSetting(cmd, "run.histogram_precision", "histogram-precision")
+	bindSetting(cmd, "run.high_precision", "high-precision")
+	bindSetting(cmd, "run.labels", "label")
+	bindSetting(cmd, "run.expect_status", "expect-status")
+	bindSetting(cmd, "run.expect_body", "expect-body")
+	bindSetting(cmd, "run.expect_body_not", "expect-body-not")
+	bindSetting(cmd, "run.expect_response_time", "expect-response-time")
+	bindSetting(cmd, "run.drain", "drain")
+	bindSetting(cmd, "run.warmup", "warmup")
+	bindSetting(cmd, "run.warmup_vus", "warmup-vus")
+	bindSetting(cmd, "run.warmup_window", "warmup-window")
+	bindSetting(cmd, "run.warmup_tolerance", "warmup-tolerance")
+	bindSetting(cmd, "run.workers", "workers")
+	bindSetting(cmd, "run.connections", "connections")
+	bindSetting(cmd, "run.max_conns_per_host", "max-conns-per-host")
+	bindSetting(cmd, "run.max_requests_per_conn", "max-requests-per-conn")
+	bindSetting(cmd, "run.pipeline", "pipeline")
+	bindSetting(cmd, "run.conn_soft_start", "conn-soft-start")
+	bindSetting(cmd, "run.conn_soft_start_rate", "conn-soft-start-rate")
+	bindSetting(cmd, "run.max_decompressed_size", "max-decompressed-size")
+	bindSetting(cmd, "run.max_decompression_ratio", "max-decompression-ratio")
+	bindSetting(cmd, "run.client_per_vu", "client-per-vu")
+	bindSetting(cmd, "run.global_limit", "global-limit")
+	bindSetting(cmd, "run.global_limit_token", "global-limit-token")
+	bindSetting(cmd, "run.keep_alive", "keep-alive")
+	bindSetting(cmd, "run.disable_keep_alive", "disable-keep-alive")
+	bindSetting(cmd, "run.tls_skip_verify", "tls-skip-verify")
+	bindSetting(cmd, "run.client_certs", "client-certs")
+	bindSetting(cmd, "run.http_version", "http-version")
+	bindSetting(cmd, "run.proxy", "proxy")
+	bindSetting(cmd, "run.user_agent", "user-agent")
+	bindSetting(cmd, "run.bandwidth", "bandwidth")
+	bindSetting(cmd, "run.raw_out", "raw-out")
+	bindSetting(cmd, "run.trace_vus", "trace-vus")
+	bindSetting(cmd, "run.trace_out", "trace-out")
+	bindSetting(cmd, "run.otlp_endpoint", "otlp-endpoint")
+	bindSetting(cmd, "run.otlp_sample", "otlp-sample")
+	bindSetting(cmd, "run.identity_headers", "identity-headers")
+	bindSetting(cmd, "run.client_id_header", "client-id-header")
+	bindSetting(cmd, "run.request_id_header", "request-id-header")
 }
 
 // runLoadTest executes the load test
 func runLoadTest(cmd *cobra.Command, args []string) error {
 	scenarioFile := args[0]
 
-	// Check if scenario file exists
-	if _, err := os.Stat(scenarioFile); os.IsNotExist(err) {
-		return fmt.Errorf("scenario file not found: %s", scenarioFile)
+	// Check if scenario file exists; "-" reads it from stdin
+	if scenarioFile != config.StdinScenario {
+		if _, err := os.Stat(scenarioFile); os.IsNotExist(err) {
+			return fmt.Errorf("scenario file not found: %s", scenarioFile)
+		}
+	}
+
+	// A timeline runs several scenarios, each from its own offset
+	if scenarioFile != config.StdinScenario && isTimelineFile(scenarioFile) {
+		return runTimeline(scenarioFile)
 	}
 
 	// Load scenario configuration
@@ -100,27 +215,34 @@ func runLoadTest(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load scenario: %w", err)
 	}
 
-	// Create load test configuration
-	loadConfig := &config.LoadTestConfig{
-		Scenario:      scenario,
-		VirtualUsers:  viper.GetInt("run.vus"),
-		Duration:      viper.GetDuration("run.duration"),
-		RampUp:        viper.GetDuration("run.ramp_up"),
-		RampDown:      viper.GetDuration("run.ramp_down"),
-		Delay:         viper.GetDuration("run.delay"),
-		MaxRequests:   viper.GetInt("run.max_requests"),
-		Timeout:       viper.GetDuration("run.timeout"),
-		Pattern:       viper.GetString("run.pattern"),
-		Live:          viper.GetBool("run.live"),
-		ReportFormat:  viper.GetString("run.report_format"),
-		Outfile:       viper.GetString("run.outfile"),
-		Stdout:        viper.GetBool("run.stdout"),
-		Workers:       viper.GetInt("run.workers"),
-		Connections:   viper.GetInt("run.connections"),
-		KeepAlive:     viper.GetBool("run.keep_alive"),
-		TLSSkipVerify: viper.GetBool("run.tls_skip_verify"),
-		Proxy:         viper.GetString("run.proxy"),
-		UserAgent:     viper.GetString("run.user_agent"),
+	// Make external protocol plugins available to the engine
+	if _, err := plugins.RegisterDiscovered(viper.GetStringSlice("plugin_dirs")); err != nil {
+		return fmt.Errorf("failed to discover plugins: %w", err)
+	}
+
+	loadConfig, err := newLoadConfig(scenario)
+	if err != nil {
+		return err
+	}
+
+	// Estimate the test first: --plan stops there, and a test exceeding the
+	// confirmation limits needs --yes
+	plan, err := engine.NewPlan(loadConfig, scenario, planAssumptions())
+	if err != nil {
+		return fmt.Errorf("failed to plan the test: %w", err)
+	}
+	if viper.GetBool("run.plan") {
+		return writePlan(os.Stdout, plan)
+	}
+	if exceeded := newPlanLimits().exceeded(plan); len(exceeded) > 0 && !viper.GetBool("run.yes") {
+		writePlan(os.Stderr, plan)
+		return fmt.Errorf("the test plan exceeds %s; review it and rerun with --yes to proceed", strings.Join(exceeded, ", "))
+	}
+
+	// Resolve the report format before spending time on the test
+	formatter, err := reporter.New(loadConfig.ReportFormat, loadConfig)
+	if err != nil {
+		return err
 	}
 
 	// Create and run load engine
@@ -133,37 +255,288 @@ func runLoadTest(cmd *cobra.Command, args []string) error {
 	var liveReporter *reporting.LiveReporter
 	if loadConfig.Live {
 		liveReporter = reporting.NewLiveReporter(engine.GetCollector(), 1*time.Second)
-		liveReporter.Start()
-		defer liveReporter.Stop()
+		liveReporter.ShowConnections(engine.ConnectionPool)
+		liveReporter.ShowSteps(reporting.ScenarioStepNames(scenario))
+		// The terminal takes commands unless stdin carried the scenario
+		if scenarioFile != config.StdinScenario {
+			liveReporter.ShowVUs(engine.ActiveVUs)
+			go readLiveCommands(engine, liveReporter, os.Stdin)
+		}
+		liveReporter.Start(engine.GetContext())
 	}
 
+	// Serve live metrics to Prometheus if enabled
+	if addr := viper.GetString("run.metrics_addr"); addr != "" {
+		exporter := reporting.NewPrometheusExporter(engine.GetCollector(), scenario.Name, loadConfig.Labels)
+		exporter.ShowVUs(engine.ActiveVUs)
+		exporter.ShowConnections(engine.ConnectionPool)
+		if err := exporter.Start(addr); err != nil {
+			engine.Close()
+			return err
+		}
+		defer exporter.Stop()
+	}
+
+	// Stop the test early, still reporting what ran, on Ctrl+C
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			engine.Stop()
+		case <-engine.GetContext().Done():
+		}
+	}()
+
 	// Run the load test
 	summary, err := engine.Run()
+	if liveReporter != nil {
+		liveReporter.Stop()
+	}
 	if err != nil {
 		return fmt.Errorf("load test failed: %w", err)
 	}
 
 	// Generate and write report
-	reporter := reporting.NewJSONReporter(loadConfig)
-	report, err := reporter.GenerateReport(summary, scenario)
+	report, err := formatter.GenerateReport(summary, scenario)
 	if err != nil {
 		return fmt.Errorf("failed to generate report: %w", err)
 	}
 
-	// Write report
+	// Write report; the flag takes precedence over the scenario file name
 	outfile := loadConfig.Outfile
+	if outfile == "" {
+		outfile = scenario.Outfile
+	}
 	if loadConfig.Stdout {
 		outfile = ""
 	}
+	if outfile, err = reporting.OutfileName(outfile, report); err != nil {
+		return err
+	}
 
-	if err := reporter.WriteReport(report, outfile); err != nil {
+	if err := formatter.WriteReport(report, outfile); err != nil {
 		return fmt.Errorf("failed to write report: %w", err)
 	}
 
+	failures := reporting.CheckThresholds(summary)
+
+	// Publish job summary and annotations when running in GitHub Actions
+	if reporting.IsGitHubActions() {
+		if err := reporting.NewGitHubReporter().Publish(report, failures); err != nil {
+			logrus.WithError(err).Warn("Failed to publish GitHub Actions summary")
+		}
+	}
+
 	// Exit with appropriate code based on results
-	if summary.SuccessRate < 95.0 {
+	if len(failures) > 0 {
 		os.Exit(2) // Validation failed
 	}
 
 	return nil
 }
+
+// newLoadConfig builds the load test configuration of a scenario from the
+// run settings, settling those the scenario also sets by precedence
+func newLoadConfig(scenario *config.Scenario) (*config.LoadTestConfig, error) {
+	cfg, err := runSettings(scenario)
+	if err != nil || scenario == nil {
+		return cfg, err
+	}
+	config.ResolveScenarioSettings(cfg, scenario, runSources())
+	return cfg, nil
+}
+
+// runSettings reads the load test configuration from the run settings as
+// they are: flags, environment variables, config file and defaults
+func runSettings(scenario *config.Scenario) (*config.LoadTestConfig, error) {
+	bandwidth, err := config.ParseBandwidthFlag(viper.GetString("run.bandwidth"))
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := config.CollectLabels(viper.GetStringMapString("run.labels"))
+	if err != nil {
+		return nil, err
+	}
+
+	var stages []config.StageConfig
+	for _, flag := range viper.GetStringSlice("run.stages") {
+		stage, err := config.ParseStageFlag(flag)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, stage)
+	}
+	if len(stages) > 0 {
+		if err := config.ValidateStages(stages); err != nil {
+			return nil, fmt.Errorf("invalid --stage: %w", err)
+		}
+	}
+
+	var goals []config.LatencyObjective
+	for _, flag := range viper.GetStringSlice("run.goals") {
+		goal, err := config.ParseLatencyGoal(flag)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, goal)
+	}
+
+	keepAlive, err := config.ResolveKeepAlive(optionalBool("run.keep_alive"), optionalBool("run.disable_keep_alive"))
+	if err != nil {
+		return nil, err
+	}
+
+	// An explicit precision wins over --high-precision
+	precision := viper.GetUint("run.histogram_precision")
+	if precision == 0 && viper.GetBool("run.high_precision") {
+		precision = metrics.HighHistogramPrecision
+	}
+
+	return &config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  viper.GetInt("run.vus"),
+		Duration:      viper.GetDuration("run.duration"),
+		RampUp:        viper.GetDuration("run.ramp_up"),
+		RampDown:      viper.GetDuration("run.ramp_down"),
+		Delay:         viper.GetDuration("run.delay"),
+		MaxRequests:   viper.GetInt("run.max_requests"),
+		Timeout:       viper.GetDuration("run.timeout"),
+		Pattern:       viper.GetString("run.pattern"),
+		Stages:        stages,
+		Seed:          viper.GetInt64("run.seed"),
+		Labels:        labels,
+		SkipPreflight: viper.GetBool("run.skip_preflight"),
+		Live:          viper.GetBool("run.live"),
+		ReportFormat:  viper.GetString("run.report_format"),
+		Outfile:       viper.GetString("run.outfile"),
+		Stdout:        viper.GetBool("run.stdout"),
+		Drain:         viper.GetDuration("run.drain"),
+		Workers:       viper.GetInt("run.workers"),
+		Connections:   viper.GetInt("run.connections"),
+		KeepAlive:     keepAlive,
+		TLSSkipVerify: viper.GetBool("run.tls_skip_verify"),
+		ClientCerts:   viper.GetString("run.client_certs"),
+		Proxy:         viper.GetString("run.proxy"),
+		UserAgent:     viper.GetString("run.user_agent"),
+		Bandwidth:     bandwidth,
+		HTTPVersion:   viper.GetString("run.http_version"),
+
+		HistogramPrecision: precision,
+
+		Warmup:          viper.GetDuration("run.warmup"),
+		WarmupVUs:       viper.GetInt("run.warmup_vus"),
+		WarmupWindow:    viper.GetDuration("run.warmup_window"),
+		WarmupTolerance: viper.GetFloat64("run.warmup_tolerance"),
+
+		MaxRequestsPerConn: viper.GetInt("run.max_requests_per_conn"),
+		Pipeline:           viper.GetInt("run.pipeline"),
+
+		ConnSoftStart:     viper.GetDuration("run.conn_soft_start"),
+		ConnSoftStartRate: viper.GetFloat64("run.conn_soft_start_rate"),
+
+		MaxDecompressedSize:   viper.GetInt64("run.max_decompressed_size"),
+		MaxDecompressionRatio: viper.GetFloat64("run.max_decompression_ratio"),
+
+		OTLPEndpoint: viper.GetString("run.otlp_endpoint"),
+		OTLPSample:   viper.GetFloat64("run.otlp_sample"),
+
+		IdentityHeaders: viper.GetBool("run.identity_headers"),
+		ClientIDHeader:  viper.GetString("run.client_id_header"),
+		RequestIDHeader: viper.GetString("run.request_id_header"),
+		RawOut:          viper.GetString("run.raw_out"),
+		Outputs:         viper.GetStringSlice("run.outputs"),
+		LatencyGoals:    goals,
+		TraceVUs:        viper.GetInt("run.trace_vus"),
+		TraceOut:        viper.GetString("run.trace_out"),
+		MaxConnsPerHost: viper.GetInt("run.max_conns_per_host"),
+		ClientPerVU:     viper.GetBool("run.client_per_vu"),
+		GlobalLimit:     viper.GetString("run.global_limit"),
+
+		GlobalLimitToken:   viper.GetString("run.global_limit_token"),
+		ExpectStatus:       viper.GetIntSlice("run.expect_status"),
+		ExpectBody:         viper.GetString("run.expect_body"),
+		ExpectBodyNot:      viper.GetString("run.expect_body_not"),
+		ExpectResponseTime: viper.GetDuration("run.expect_response_time"),
+	}, nil
+}
+
+// optionalBool returns a boolean setting given by flag, config file or
+// environment, or nil when it was left at its default
+func optionalBool(key string) *bool {
+	if !viper.IsSet(key) {
+		return nil
+	}
+	value := viper.GetBool(key)
+	return &value
+}
+
+// readLiveCommands applies the commands typed during a live run: +N adds N
+// VUs, -N removes N and N sets the count (+ and - alone add or remove one);
+// e, s and p toggle the errors, status codes and steps panels, r resets the
+// rate window and m <note> annotates the report
+func readLiveCommands(loadEngine *engine.LoadEngine, live *reporting.LiveReporter, input io.Reader) {
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var err error
+		switch command, argument, _ := strings.Cut(line, " "); command {
+		case "e":
+			live.ToggleErrors()
+		case "s":
+			live.ToggleStatusCodes()
+		case "p":
+			live.ToggleSteps()
+		case "r":
+			live.ResetRate()
+			live.Notify("Rate window reset")
+		case "m":
+			var annotation metrics.Annotation
+			if annotation, err = loadEngine.Annotate(argument); err == nil {
+				live.Notify(fmt.Sprintf("Annotated %q at %s", annotation.Text, annotation.Offset))
+			}
+		default:
+			var vus int
+			if vus, err = parseVUCommand(line, loadEngine.ActiveVUs()); err == nil {
+				err = loadEngine.SetVUs(vus)
+			}
+		}
+		if errors.Is(err, engine.ErrNotRunning) {
+			return
+		}
+		if err != nil {
+			live.Notify(err.Error())
+		}
+	}
+}
+
+// parseVUCommand returns the VU count asked for by a scaling command
+func parseVUCommand(command string, current int) (int, error) {
+	sign := command[0]
+	if sign == '+' || sign == '-' {
+		step := 1
+		if len(command) > 1 {
+			n, err := strconv.Atoi(command[1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid command %q: use +N, -N, N, e, s, p, r or m <note>", command)
+			}
+			step = n
+		}
+		if sign == '-' {
+			step = -step
+		}
+		return current + step, nil
+	}
+
+	vus, err := strconv.Atoi(command)
+	if err != nil {
+		return 0, fmt.Errorf("invalid command %q: use +N, -N, N, e, s, p, r or m <note>", command)
+	}
+	return vus, nil
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// NewSchemaCommand creates the schema command
+func NewSchemaCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of scenario files",
+		Long: `Print the JSON Schema of scenario files, for editor completion and
+validation. Save it with --outfile and reference it from a scenario with a
+"$schema" field, or map it to scenario files in the editor settings.`,
+		Args: cobra.NoArgs,
+		RunE: printSchema,
+	}
+
+	cmd.Flags().StringP("outfile", "o", "", "write the schema to a file instead of stdout")
+
+	viper.BindPFlag("schema.outfile", cmd.Flags().Lookup("outfile"))
+
+	return cmd
+}
+
+// printSchema writes the embedded scenario schema
+func printSchema(cmd *cobra.Command, args []string) error {
+	outfile := viper.GetString("schema.outfile")
+	if outfile == "" {
+		_, err := os.Stdout.Write(config.ScenarioSchema())
+		return err
+	}
+
+	if err := os.WriteFile(outfile, config.ScenarioSchema(), 0644); err != nil {
+		return fmt.Errorf("failed to write schema: %w", err)
+	}
+	fmt.Printf("Schema written to %s\n", outfile)
+	return nil
+}
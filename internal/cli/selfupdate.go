@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/alexandredias/gotsunami/internal/update"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// NewSelfUpdateCommand creates the self-update command
+func NewSelfUpdateCommand(version string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "self-update",
+		Short: "Update GoTsunami to the latest release",
+		Long: `Check GitHub releases for a newer GoTsunami version, verify the downloaded
+binary against the release checksums (and ed25519 signature when a public key
+is configured) and replace the running executable.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return selfUpdate(version)
+		},
+	}
+
+	cmd.Flags().Bool("check", false, "only check whether an update is available")
+	cmd.Flags().String("version", "", "install a specific release tag instead of the latest")
+	cmd.Flags().String("public-key", "", "base64 ed25519 public key used to verify checksums.txt.sig")
+	cmd.Flags().String("repository", update.DefaultRepository, "GitHub repository to fetch releases from")
+	cmd.Flags().String("api-url", update.DefaultAPIURL, "GitHub API base URL (for GitHub Enterprise or mirrors)")
+	cmd.Flags().Bool("force", false, "reinstall even if already on the requested version, or downgrade to the latest")
+
+	viper.BindPFlag("self_update.check", cmd.Flags().Lookup("check"))
+	viper.BindPFlag("self_update.version", cmd.Flags().Lookup("version"))
+	viper.BindPFlag("self_update.public_key", cmd.Flags().Lookup("public-key"))
+	viper.BindPFlag("self_update.repository", cmd.Flags().Lookup("repository"))
+	viper.BindPFlag("self_update.api_url", cmd.Flags().Lookup("api-url"))
+	viper.BindPFlag("self_update.force", cmd.Flags().Lookup("force"))
+
+	return cmd
+}
+
+// selfUpdate checks for and installs a new release
+func selfUpdate(version string) error {
+	updater := update.NewUpdater(&update.Config{
+		Repository:     viper.GetString("self_update.repository"),
+		APIURL:         viper.GetString("self_update.api_url"),
+		CurrentVersion: version,
+		PublicKey:      viper.GetString("self_update.public_key"),
+	})
+
+	requested := viper.GetString("self_update.version")
+	release, err := updater.FetchRelease(requested)
+	if err != nil {
+		return err
+	}
+
+	// A downgrade must be asked for, with --version or --force
+	switch {
+	case updater.IsNewer(release), viper.GetBool("self_update.force"):
+	case updater.IsOlder(release) && requested != "":
+	case updater.IsOlder(release):
+		fmt.Printf("GoTsunami %s is ahead of the latest release %s; pass --version %s or --force to downgrade\n",
+			version, release.TagName, release.TagName)
+		return nil
+	default:
+		fmt.Printf("GoTsunami %s is already up to date\n", version)
+		return nil
+	}
+
+	if viper.GetBool("self_update.check") {
+		fmt.Printf("Update available: %s -> %s\n", version, release.TagName)
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+	executable, err = filepath.EvalSymlinks(executable)
+	if err != nil {
+		return fmt.Errorf("failed to resolve executable path: %w", err)
+	}
+
+	fmt.Printf("Updating GoTsunami %s -> %s...\n", version, release.TagName)
+	if err := updater.Install(release, executable); err != nil {
+		return fmt.Errorf("self-update failed: %w", err)
+	}
+
+	fmt.Printf("GoTsunami updated to %s\n", release.TagName)
+	return nil
+}
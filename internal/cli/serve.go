@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/protocols/plugins"
+	"github.com/alexandredias/gotsunami/internal/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// NewServeCommand creates the serve command
+func NewServeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run GoTsunami as a REST API server",
+		Long: `Run GoTsunami in server mode, exposing a REST API to submit scenarios,
+start and stop runs, stream live metrics and fetch reports.
+
+Endpoints:
+  GET  /api/v1/health
+  GET  /api/v1/scenarios            list submitted scenarios
+  POST /api/v1/scenarios            submit a scenario
+  GET  /api/v1/scenarios/{id}       fetch a scenario
+  GET  /api/v1/runs                 list runs
+  POST /api/v1/runs                 start a run
+  GET  /api/v1/runs/{id}            run status
+  POST /api/v1/runs/{id}/stop       stop a run
+  POST /api/v1/runs/{id}/vus        change the active VUs ({"vus": 50})
+  GET  /api/v1/runs/{id}/metrics    stream live metrics (server-sent events)
+  GET  /api/v1/runs/{id}/report     fetch the final report
+  GET  /api/v1/limits               list global in-flight limits
+  GET  /api/v1/limits/{name}        limit usage per agent
+  POST /api/v1/limits/{name}/acquire  lease slots (used by run --global-limit)
+  POST /api/v1/limits/{name}/release  return slots
+
+The API listens on 127.0.0.1 by default. To listen on other interfaces set
+--token, which every request but the health check must then carry as a bearer
+token, or pass --insecure on a trusted network. Scenarios with command hooks,
+scripts, data or tenant files, gRPC proto files, secrets or {{env.NAME}}
+templates are refused unless --allow-host-access is set, since they run code
+on this host or send its environment, files and credentials to the target.
+Runs with more VUs, workers or connections than --confirm-vus are refused
+unless the request sets "confirm": true, the --yes of the API.`,
+		Args: cobra.NoArgs,
+		RunE: runServer,
+	}
+
+	cmd.Flags().String("listen", "127.0.0.1:8080", "address to listen on")
+	cmd.Flags().String("token", "", "bearer token required on every request but the health check")
+	cmd.Flags().Bool("insecure", false, "listen on a non-loopback address without --token")
+	cmd.Flags().Bool("allow-host-access", false, "accept scenarios with command hooks, scripts, data or tenant files, gRPC proto files, secrets or {{env.NAME}} templates")
+	cmd.Flags().Int("confirm-vus", server.DefaultConfirmVUs, "runs with more VUs, workers or connections than this need \"confirm\": true (0 = no limit)")
+	cmd.Flags().StringToInt("inflight-limit", nil, "global limit of requests in flight shared by agents, e.g. --inflight-limit checkout=500 (repeatable)")
+	cmd.Flags().Duration("lease-ttl", server.DefaultLeaseTTL, "time after which the slots of an agent that stopped renewing return to the pool")
+
+	viper.BindPFlag("serve.listen", cmd.Flags().Lookup("listen"))
+	viper.BindPFlag("serve.lease_ttl", cmd.Flags().Lookup("lease-ttl"))
+	viper.BindPFlag("serve.token", cmd.Flags().Lookup("token"))
+	viper.BindPFlag("serve.insecure", cmd.Flags().Lookup("insecure"))
+	viper.BindPFlag("serve.allow_host_access", cmd.Flags().Lookup("allow-host-access"))
+	viper.BindPFlag("serve.confirm_vus", cmd.Flags().Lookup("confirm-vus"))
+
+	return cmd
+}
+
+// runServer starts the API server and blocks until interrupted
+func runServer(cmd *cobra.Command, args []string) error {
+	if _, err := plugins.RegisterDiscovered(viper.GetStringSlice("plugin_dirs")); err != nil {
+		return fmt.Errorf("failed to discover plugins: %w", err)
+	}
+
+	addr, token := viper.GetString("serve.listen"), viper.GetString("serve.token")
+	if err := server.CheckExposure(addr, token, viper.GetBool("serve.insecure")); err != nil {
+		return err
+	}
+
+	srv := server.NewServer(addr)
+	srv.SetToken(token)
+	srv.AllowHostAccess(viper.GetBool("serve.allow_host_access"))
+	srv.SetConfirmVUs(viper.GetInt("serve.confirm_vus"))
+	if ttl := viper.GetDuration("serve.lease_ttl"); ttl > 0 {
+		srv.SetLeaseTTL(ttl)
+	}
+	limits, err := cmd.Flags().GetStringToInt("inflight-limit")
+	if err != nil {
+		return err
+	}
+	for name, size := range limits {
+		if err := srv.SetLimit(name, size); err != nil {
+			return err
+		}
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-signals:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shut down API server: %w", err)
+	}
+
+	return nil
+}
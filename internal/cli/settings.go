@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// settingAnnotation marks a flag with the setting key it sets
+const settingAnnotation = "gotsunami_setting"
+
+// settingFlags are the flags of the running command bound to settings, by key
+var settingFlags = map[string]*pflag.Flag{}
+
+// bindSetting marks a flag of cmd as setting key. Flags are bound when their
+// command runs, since viper binds a key to a single flag and several
+// commands share the run flags.
+func bindSetting(cmd *cobra.Command, key, flag string) {
+	cmd.Flags().SetAnnotation(flag, settingAnnotation, []string{key})
+}
+
+// bindSettings binds the marked flags of the running command
+func bindSettings(cmd *cobra.Command) error {
+	var err error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		keys := flag.Annotations[settingAnnotation]
+		if len(keys) == 0 || err != nil {
+			return
+		}
+		settingFlags[keys[0]] = flag
+		err = viper.BindPFlag(keys[0], flag)
+	})
+	return err
+}
+
+// settingSource returns where the value of a setting comes from, leaving
+// the scenario aside
+func settingSource(key string) string {
+	if flag := settingFlags[key]; flag != nil && flag.Changed {
+		return config.SourceFlag
+	}
+	if value, exists := os.LookupEnv(config.SettingEnv(key)); exists && value != "" {
+		return config.SourceEnv
+	}
+	if viper.InConfig(key) {
+		return config.SourceConfigFile
+	}
+	return config.SourceDefault
+}
+
+// runSources returns the source of every run setting a scenario can also
+// set, by name within the run section
+func runSources() map[string]string {
+	sources := make(map[string]string, len(config.ScenarioSettings))
+	for _, name := range config.ScenarioSettings {
+		sources[name] = settingSource("run." + name)
+	}
+	return sources
+}
+
+// resolveSettings returns the effective value and source of every setting
+// bound by the running command, by key. scenario, if any, takes precedence
+// over the config file and defaults for the settings it also sets.
+func resolveSettings(scenario *config.Scenario) []config.Setting {
+	keys := make([]string, 0, len(settingFlags))
+	for key := range settingFlags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	settings := make([]config.Setting, 0, len(keys))
+	for _, key := range keys {
+		setting := config.Setting{
+			Key:    key,
+			Value:  viper.Get(key),
+			Source: settingSource(key),
+			Flag:   "--" + settingFlags[key].Name,
+			Env:    config.SettingEnv(key),
+		}
+		if strings.HasSuffix(key, "token") && setting.Value != "" {
+			// Tokens are credentials, not to be printed
+			setting.Value = "********"
+		}
+		if name, isRun := strings.CutPrefix(key, "run."); isRun && scenario != nil && !config.Overrides(setting.Source, config.SourceScenario) {
+			if value, set := scenario.RunSetting(name); set {
+				setting.Value, setting.Source = value, config.SourceScenario
+			}
+		}
+		settings = append(settings, setting)
+	}
+	return settings
+}
@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/engine"
+	"github.com/alexandredias/gotsunami/internal/protocols/plugins"
+	"github.com/alexandredias/gotsunami/internal/reporting"
+	"github.com/alexandredias/gotsunami/pkg/reporter"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// isTimelineFile reports whether a file holds a timeline instead of a scenario
+func isTimelineFile(filename string) bool {
+	data, err := os.ReadFile(filename)
+	return err == nil && config.IsTimeline(data)
+}
+
+// runTimeline runs every phase of a timeline at its offset and writes one
+// report covering them all
+func runTimeline(timelineFile string) error {
+	timeline, err := config.LoadTimelineFromFile(timelineFile)
+	if err != nil {
+		return fmt.Errorf("failed to load timeline: %w", err)
+	}
+
+	// Make external protocol plugins available to the engines
+	if _, err := plugins.RegisterDiscovered(viper.GetStringSlice("plugin_dirs")); err != nil {
+		return fmt.Errorf("failed to discover plugins: %w", err)
+	}
+
+	base, err := newLoadConfig(nil)
+	if err != nil {
+		return err
+	}
+	if base.Live {
+		logrus.Warn("--live is not supported with timelines; showing the final report only")
+	}
+	if viper.GetString("run.metrics_addr") != "" {
+		logrus.Warn("--metrics-addr is not supported with timelines; no metrics are served")
+	}
+
+	// Resolve the report format before spending time on the test
+	formatter, err := reporter.New(base.ReportFormat, base)
+	if err != nil {
+		return err
+	}
+
+	enginePhases := make([]engine.TimelinePhase, len(timeline.Phases))
+	for i, phase := range timeline.Phases {
+		loadConfig := *base
+		loadConfig.Scenario = phase.Scenario
+		loadConfig.Duration = phase.GetDuration()
+		loadConfig.Live = false
+		if phase.VUs > 0 {
+			loadConfig.VirtualUsers = phase.VUs
+		}
+		if phase.Pattern != "" {
+			loadConfig.Pattern = phase.Pattern
+		}
+		// Engines are created when their phase starts; catch bad patterns now
+		if _, err := engine.NewLoadPattern(&loadConfig); err != nil {
+			return fmt.Errorf("phase %s: %w", phase.Name, err)
+		}
+		// Every phase writes its own raw results and trace
+		loadConfig.RawOut = phaseFile(base.RawOut, phase.Name)
+		loadConfig.TraceOut = phaseFile(base.TraceOut, phase.Name)
+
+		enginePhases[i] = engine.TimelinePhase{
+			Name:     phase.Name,
+			Start:    phase.GetStart(),
+			Config:   &loadConfig,
+			Scenario: phase.Scenario,
+		}
+	}
+
+	runner := engine.NewTimeline(enginePhases)
+	if len(timeline.Mix) > 0 {
+		vus := timeline.VUs
+		if vus == 0 {
+			vus = base.VirtualUsers
+		}
+		stages := make([]engine.MixStage, len(timeline.Mix))
+		for i, stage := range timeline.Mix {
+			stages[i] = engine.MixStage{Duration: stage.GetDuration(), Weights: stage.Weights}
+		}
+		runner.SetMix(vus, stages)
+	}
+
+	// Stop the timeline early, still reporting what ran, on Ctrl+C
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-signals:
+			runner.Stop()
+		case <-done:
+		}
+	}()
+
+	results, elapsed := runner.Run()
+
+	var failures []string
+	phases := make([]reporting.ReportPhase, len(results))
+	reports := make([]*reporting.Report, len(results))
+	for i, result := range results {
+		phase := &phases[i]
+		phase.Name = result.Phase.Name
+		phase.Start = result.Started.Round(time.Millisecond).String()
+
+		if result.Err != nil {
+			phase.Error = result.Err.Error()
+			if !errors.Is(result.Err, engine.ErrPhaseSkipped) {
+				failures = append(failures, fmt.Sprintf("phase %s failed: %v", result.Phase.Name, result.Err))
+			}
+			continue
+		}
+
+		phaseReporter, err := reporter.New(base.ReportFormat, result.Phase.Config)
+		if err != nil {
+			return err
+		}
+		if reports[i], err = phaseReporter.GenerateReport(result.Summary, result.Phase.Scenario); err != nil {
+			return fmt.Errorf("failed to generate report of phase %s: %w", result.Phase.Name, err)
+		}
+		for _, failure := range reporting.CheckThresholds(result.Summary) {
+			failures = append(failures, fmt.Sprintf("phase %s: %s", result.Phase.Name, failure))
+		}
+	}
+
+	name := timeline.Name
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(timelineFile), filepath.Ext(timelineFile))
+	}
+	report, err := reporting.MergeTimeline(name, phases, reports, elapsed)
+	if err != nil {
+		return fmt.Errorf("failed to generate report: %w", err)
+	}
+
+	outfile := base.Outfile
+	if base.Stdout {
+		outfile = ""
+	}
+	if outfile, err = reporting.OutfileName(outfile, report); err != nil {
+		return err
+	}
+	if err := formatter.WriteReport(report, outfile); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	// Publish job summary and annotations when running in GitHub Actions
+	if reporting.IsGitHubActions() {
+		if err := reporting.NewGitHubReporter().Publish(report, failures); err != nil {
+			logrus.WithError(err).Warn("Failed to publish GitHub Actions summary")
+		}
+	}
+
+	// Exit with appropriate code based on results
+	if len(failures) > 0 {
+		os.Exit(2) // Validation failed
+	}
+
+	return nil
+}
+
+// phaseFile inserts the phase name before the extension of an output file
+func phaseFile(filename, phase string) string {
+	if filename == "" {
+		return ""
+	}
+	safe := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '-'
+	}, phase)
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "-" + safe + ext
+}
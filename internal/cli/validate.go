@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/alexandredias/gotsunami/internal/config"
 	"github.com/spf13/cobra"
 )
 
@@ -13,8 +14,10 @@ func NewValidateCommand() *cobra.Command {
 		Use:   "validate <scenario.json>",
 		Short: "Validate a scenario configuration file",
 		Long: `Validate a scenario configuration file without running the test.
-This command checks the JSON syntax, required fields, and configuration
-validity to ensure the scenario is ready for execution.`,
+This command checks the JSON syntax, the fields against the scenario schema
+(reporting the line and column of each mismatch), and configuration validity
+to ensure the scenario is ready for execution. A timeline file is checked
+phase by phase, with the scenario of every phase.`,
 		Args: cobra.ExactArgs(1),
 		RunE: validateScenario,
 	}
@@ -31,10 +34,37 @@ func validateScenario(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("scenario file not found: %s", scenarioFile)
 	}
 
-	// TODO: Implement scenario validation
 	fmt.Printf("Validating scenario file: %s\n", scenarioFile)
+
+	data, err := os.ReadFile(scenarioFile)
+	if err != nil {
+		return fmt.Errorf("failed to read scenario file: %w", err)
+	}
+
+	// A timeline is valid when every phase and its scenario are
+	if config.IsTimeline(data) {
+		timeline, err := config.LoadTimelineFromFile(scenarioFile)
+		if err != nil {
+			return err
+		}
+		for _, phase := range timeline.Phases {
+			fmt.Printf("✓ Phase %s: %s from %s for %s\n", phase.Name, phase.ScenarioFile, phase.GetStart(), phase.GetDuration())
+		}
+		fmt.Println("Timeline is ready for execution!")
+		return nil
+	}
+
+	if err := config.ValidateScenarioJSON(data); err != nil {
+		fmt.Println("✗ Scenario does not match the schema:")
+		fmt.Println(err)
+		return fmt.Errorf("scenario is invalid")
+	}
 	fmt.Println("✓ JSON syntax is valid")
 	fmt.Println("✓ Required fields are present")
+
+	if _, err := config.LoadScenarioFromFile(scenarioFile); err != nil {
+		return err
+	}
 	fmt.Println("✓ Configuration is valid")
 	fmt.Println("Scenario is ready for execution!")
 
@@ -0,0 +1,165 @@
+// Package clock watches the system clock against the monotonic clock during
+// a test, flagging jumps of the system clock and stalls of the generator
+package clock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/metrics"
+)
+
+const (
+	// window is how often the wall clock is checked against the
+	// monotonic clock
+	window = time.Second
+	// jumpThreshold is how far the wall clock must move away from the monotonic
+	// clock within a window to count as a jump. NTP slews the clock by at
+	// most 0.5ms per second, so anything above this was stepped.
+	jumpThreshold = 50 * time.Millisecond
+	// stallThreshold is how late a check must wake up for the generator to
+	// count as stalled
+	stallThreshold = 200 * time.Millisecond
+	// driftThreshold is the total slew above which the report mentions it
+	driftThreshold = 10 * time.Millisecond
+	// maxEvents bounds the jumps and stalls listed in the report
+	maxEvents = 20
+)
+
+// Monitor watches the clocks during the test. Latencies and offsets are
+// measured on the monotonic clock, so a step of the system clock (NTP,
+// an operator or a resumed VM) cannot corrupt them, but it does shift the
+// wall timestamps of raw results, traces and annotations. A stall of the
+// generator itself, when the process is paused or starved, inflates the
+// latency of every request in flight; both are flagged in the report.
+type Monitor struct {
+	start time.Time
+
+	mu          sync.Mutex
+	jumps       []metrics.ClockEvent
+	jumpCount   int
+	stalls      []metrics.ClockEvent
+	stallCount  int
+	stalled     time.Duration
+	longest     time.Duration
+	drift       time.Duration
+	lastChecked time.Time
+	lastWall    time.Time
+}
+
+// NewMonitor creates a monitor of the clocks since start
+func NewMonitor(start time.Time) *Monitor {
+	return &Monitor{start: start, lastChecked: start, lastWall: start.Round(0)}
+}
+
+// Run checks the clocks every window until ctx is done, then once more to
+// cover the last partial window. Time after Run returns, such as the drain
+// period, is not checked, so it cannot count as a stall.
+func (m *Monitor) Run(ctx context.Context) {
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.Check(time.Now())
+			return
+		case <-timer.C:
+			m.Check(time.Now())
+			timer.Reset(window)
+		}
+	}
+}
+
+// Check compares the time elapsed since the last check on both clocks.
+// Round(0) strips the monotonic reading, leaving the wall clock.
+func (m *Monitor) Check(now time.Time) {
+	m.CheckReadings(now, now.Round(0))
+}
+
+// CheckReadings is Check with the monotonic and wall clock readings taken
+// apart, so that they may disagree
+func (m *Monitor) CheckReadings(now, wallNow time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elapsed := now.Sub(m.lastChecked)
+	wall := wallNow.Sub(m.lastWall)
+	m.lastChecked, m.lastWall = now, wallNow
+
+	event := metrics.ClockEvent{
+		Offset: now.Sub(m.start).Round(time.Millisecond).String(),
+		Time:   wallNow.UTC().Format(time.RFC3339),
+	}
+	if shift := wall - elapsed; shift >= jumpThreshold || shift <= -jumpThreshold {
+		m.jumpCount++
+		if len(m.jumps) < maxEvents {
+			event.Shift = formatShift(shift)
+			m.jumps = append(m.jumps, event)
+		}
+	} else {
+		m.drift += shift
+	}
+
+	if late := elapsed - window; late >= stallThreshold {
+		m.stallCount++
+		m.stalled += late
+		m.longest = max(m.longest, late)
+		if len(m.stalls) < maxEvents {
+			event.Shift = late.Round(time.Millisecond).String()
+			m.stalls = append(m.stalls, event)
+		}
+	}
+}
+
+// Summary describes the jumps, stalls and drift seen since the monitor
+// started, or returns nil when the clocks agreed throughout
+func (m *Monitor) Summary() *metrics.ClockSummary {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.jumpCount == 0 && m.stallCount == 0 && m.drift < driftThreshold && m.drift > -driftThreshold {
+		return nil
+	}
+	summary := &metrics.ClockSummary{
+		Jumps:      m.jumps,
+		JumpCount:  m.jumpCount,
+		Stalls:     m.stalls,
+		StallCount: m.stallCount,
+	}
+	if m.drift >= driftThreshold || m.drift <= -driftThreshold {
+		summary.Drift = formatShift(m.drift)
+	}
+	if m.stallCount > 0 {
+		summary.StalledTime = m.stalled.Round(time.Millisecond).String()
+		summary.LongestStall = m.longest.Round(time.Millisecond).String()
+	}
+
+	var warnings []string
+	if m.jumpCount > 0 {
+		warnings = append(warnings, fmt.Sprintf("the system clock jumped %d times (first by %s at %s); "+
+			"latencies use the monotonic clock, but wall timestamps in raw results and traces shift with the jumps",
+			m.jumpCount, m.jumps[0].Shift, m.jumps[0].Offset))
+	}
+	if m.stallCount > 0 {
+		warnings = append(warnings, fmt.Sprintf("the load generator stalled %d times for %s in total (longest %s); "+
+			"requests in flight during a stall include it in their latency", m.stallCount, summary.StalledTime, summary.LongestStall))
+	}
+	summary.Warning = strings.Join(warnings, "; ")
+	return summary
+}
+
+// formatShift formats a clock shift with its sign
+func formatShift(shift time.Duration) string {
+	shift = shift.Round(time.Millisecond)
+	if shift > 0 {
+		return "+" + shift.String()
+	}
+	return shift.String()
+}
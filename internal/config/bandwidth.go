@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BandwidthConfig limits per-connection bandwidth to simulate slow clients.
+// Rates are bit rates such as "1.5mbps" or "384kbps".
+type BandwidthConfig struct {
+	Profile  string `json:"profile,omitempty"`
+	Download string `json:"download,omitempty"`
+	Upload   string `json:"upload,omitempty"`
+}
+
+// BandwidthProfiles are common client network profiles
+var BandwidthProfiles = map[string]BandwidthConfig{
+	"gprs":      {Download: "50kbps", Upload: "20kbps"},
+	"slow-3g":   {Download: "400kbps", Upload: "400kbps"},
+	"3g":        {Download: "1.6mbps", Upload: "768kbps"},
+	"dsl":       {Download: "1.5mbps", Upload: "384kbps"},
+	"cable":     {Download: "5mbps", Upload: "1mbps"},
+	"4g":        {Download: "9mbps", Upload: "9mbps"},
+	"lte":       {Download: "12mbps", Upload: "12mbps"},
+	"fiber-100": {Download: "100mbps", Upload: "50mbps"},
+}
+
+// BandwidthProfileNames returns the profile names in alphabetical order
+func BandwidthProfileNames() []string {
+	names := make([]string, 0, len(BandwidthProfiles))
+	for name := range BandwidthProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Validate validates the bandwidth configuration
+func (b *BandwidthConfig) Validate() error {
+	_, _, err := b.Rates()
+	return err
+}
+
+// Rates returns the download and upload limits in bytes per second, where 0
+// means unlimited. Explicit rates override those of the profile.
+func (b *BandwidthConfig) Rates() (download, upload int64, err error) {
+	resolved := *b
+	if b.Profile != "" {
+		profile, exists := BandwidthProfiles[strings.ToLower(b.Profile)]
+		if !exists {
+			return 0, 0, fmt.Errorf("unknown bandwidth profile: %s (available: %s)",
+				b.Profile, strings.Join(BandwidthProfileNames(), ", "))
+		}
+		if resolved.Download == "" {
+			resolved.Download = profile.Download
+		}
+		if resolved.Upload == "" {
+			resolved.Upload = profile.Upload
+		}
+	}
+
+	if download, err = ParseBandwidth(resolved.Download); err != nil {
+		return 0, 0, err
+	}
+	if upload, err = ParseBandwidth(resolved.Upload); err != nil {
+		return 0, 0, err
+	}
+
+	return download, upload, nil
+}
+
+// ParseBandwidthFlag parses the --bandwidth flag, which is either a profile
+// name or "download/upload" rates
+func ParseBandwidthFlag(value string) (*BandwidthConfig, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	bandwidth := &BandwidthConfig{Profile: value}
+	if download, upload, found := strings.Cut(value, "/"); found {
+		bandwidth = &BandwidthConfig{Download: download, Upload: upload}
+	}
+
+	if err := bandwidth.Validate(); err != nil {
+		return nil, err
+	}
+
+	return bandwidth, nil
+}
+
+// ParseBandwidth converts a bit rate such as "1.5mbps" to bytes per second.
+// An empty string means unlimited.
+func ParseBandwidth(rate string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(rate))
+	if value == "" {
+		return 0, nil
+	}
+
+	multiplier := 1.0
+	for _, unit := range []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"gbps", 1e9},
+		{"mbps", 1e6},
+		{"kbps", 1e3},
+		{"bps", 1},
+	} {
+		if strings.HasSuffix(value, unit.suffix) {
+			multiplier = unit.multiplier
+			value = strings.TrimSuffix(value, unit.suffix)
+			break
+		}
+	}
+
+	bits, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || bits <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth: %s", rate)
+	}
+
+	bytesPerSecond := int64(bits * multiplier / 8)
+	if bytesPerSecond < 1 {
+		bytesPerSecond = 1
+	}
+
+	return bytesPerSecond, nil
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// EndpointParam replaces the path segments NormalizePath takes for IDs
+const EndpointParam = ":id"
+
+// idSegment matches path segments that look like identifiers: numbers, UUIDs
+// and long hexadecimal strings
+var idSegment = regexp.MustCompile(`^(\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{16,})$`)
+
+// ValidateURLTemplate checks a URL template: a path whose segments are
+// literal, a :name parameter matching any one segment, or a final *
+// matching the rest of the path
+func ValidateURLTemplate(template string) error {
+	if !strings.HasPrefix(template, "/") {
+		return fmt.Errorf("must be a path starting with /")
+	}
+
+	segments := strings.Split(template[1:], "/")
+	for i, segment := range segments {
+		if segment == ":" {
+			return fmt.Errorf("parameter without a name")
+		}
+		if segment == "*" && i != len(segments)-1 {
+			return fmt.Errorf("* must be the last segment")
+		}
+	}
+	return nil
+}
+
+// MatchURLTemplate reports whether path matches a valid URL template
+func MatchURLTemplate(template, path string) bool {
+	patterns := strings.Split(strings.TrimPrefix(template, "/"), "/")
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	for i, pattern := range patterns {
+		if pattern == "*" {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		switch {
+		case strings.HasPrefix(pattern, ":"):
+			if segments[i] == "" {
+				return false
+			}
+		case pattern != segments[i]:
+			return false
+		}
+	}
+	return len(segments) == len(patterns)
+}
+
+// NormalizePath replaces the segments of path that look like identifiers
+// with EndpointParam, for paths matching no URL template
+func NormalizePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if idSegment.MatchString(segment) {
+			segments[i] = EndpointParam
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
@@ -83,6 +85,106 @@ func (e *Environment) ExpandVariables(template string) string {
 	return result
 }
 
+// Interpolate replaces ${NAME} with the value of the environment variable
+// NAME and ${NAME:-default} with default when NAME is unset or empty; $${
+// stands for a literal ${. Unlike {{env.NAME}} templates, which are expanded
+// for every request, references are resolved once, and one to an unset
+// variable without a default is an error, so a typo never silently becomes
+// an empty value.
+func (e *Environment) Interpolate(value string) (string, error) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+
+	var b strings.Builder
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			b.WriteString(value)
+			return b.String(), nil
+		}
+		if start > 0 && value[start-1] == '$' {
+			b.WriteString(value[:start-1] + "${")
+			value = value[start+2:]
+			continue
+		}
+
+		end := strings.IndexByte(value[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", value)
+		}
+		reference := value[start+2 : start+end]
+		name, fallback, hasFallback := strings.Cut(reference, ":-")
+		if name == "" {
+			return "", fmt.Errorf("empty variable name in %q", value)
+		}
+
+		resolved, exists := e.variables[name]
+		if !exists {
+			resolved, exists = os.LookupEnv(name)
+		}
+		switch {
+		case hasFallback && resolved == "":
+			resolved = fallback
+		case !exists:
+			return "", fmt.Errorf("undefined environment variable %s", name)
+		}
+
+		b.WriteString(value[:start] + resolved)
+		value = value[start+end+1:]
+	}
+}
+
+// InterpolateJSON interpolates every string of a JSON document, naming the
+// field of a failed reference
+func (e *Environment) InterpolateJSON(data []byte) ([]byte, error) {
+	if !bytes.Contains(data, []byte("${")) {
+		return data, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	document, err := e.interpolateValue(document, "")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+// interpolateValue interpolates the strings of a decoded JSON value
+func (e *Environment) interpolateValue(value interface{}, field string) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		interpolated, err := e.Interpolate(value)
+		if err != nil && field != "" {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		return interpolated, err
+	case map[string]interface{}:
+		for key, child := range value {
+			interpolated, err := e.interpolateValue(child, joinField(field, key))
+			if err != nil {
+				return nil, err
+			}
+			value[key] = interpolated
+		}
+	case []interface{}:
+		for i, child := range value {
+			interpolated, err := e.interpolateValue(child, fmt.Sprintf("%s[%d]", field, i))
+			if err != nil {
+				return nil, err
+			}
+			value[i] = interpolated
+		}
+	}
+	return value, nil
+}
+
 // ExpandMap expands template variables in a map
 func (e *Environment) ExpandMap(data map[string]string) map[string]string {
 	result := make(map[string]string)
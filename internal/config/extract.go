@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Sources an extract rule reads its value from, written as a prefix of the
+// rule. A rule without a prefix is a gjson path into the JSON body.
+const (
+	// ExtractJSON reads the JSON body by gjson path or by JSONPath ($.a.b[0])
+	ExtractJSON = "json:"
+
+	// ExtractHeader reads a response header, by case-insensitive name
+	ExtractHeader = "header:"
+
+	// ExtractRegex reads the body with a regular expression, taking its first
+	// capture group or, without one, the whole match
+	ExtractRegex = "regex:"
+)
+
+// jsonPathIndex matches the brackets of a JSONPath: [0], ['key'] or ["key"]
+var jsonPathIndex = regexp.MustCompile(`\[(\d+|'[^']*'|"[^"]*")\]`)
+
+// ParseExtract splits an extract rule into its source and expression. JSON
+// expressions are returned as gjson paths.
+func ParseExtract(rule string) (source, expression string) {
+	switch {
+	case strings.HasPrefix(rule, ExtractHeader):
+		return ExtractHeader, strings.TrimPrefix(rule, ExtractHeader)
+	case strings.HasPrefix(rule, ExtractRegex):
+		return ExtractRegex, strings.TrimPrefix(rule, ExtractRegex)
+	default:
+		return ExtractJSON, gjsonPath(strings.TrimPrefix(rule, ExtractJSON))
+	}
+}
+
+// gjsonPath converts a JSONPath such as $.items[0].id to the gjson path
+// items.0.id; other paths are returned as is
+func gjsonPath(path string) string {
+	if !strings.HasPrefix(path, "$") {
+		return path
+	}
+
+	path = jsonPathIndex.ReplaceAllStringFunc(strings.TrimPrefix(path, "$"), func(index string) string {
+		return "." + strings.Trim(index, `[]'"`)
+	})
+	return strings.TrimPrefix(path, ".")
+}
+
+// validateExtract checks the extract rules of a request
+func validateExtract(extract map[string]string) error {
+	for variable, rule := range extract {
+		if variable == "" || strings.ContainsAny(variable, "{} ") {
+			return fmt.Errorf("invalid extract variable %q", variable)
+		}
+
+		source, expression := ParseExtract(rule)
+		if expression == "" {
+			return fmt.Errorf("extract rule of %s is empty", variable)
+		}
+		if source == ExtractRegex {
+			if _, err := regexp.Compile(expression); err != nil {
+				return fmt.Errorf("invalid extract regex of %s: %w", variable, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// envTemplatePattern matches a template reading the environment, as a
+// variable ({{env.HOME}}) or a function argument ({{upper env.HOME}})
+var envTemplatePattern = regexp.MustCompile(`\{\{[^}]*\benv\.`)
+
+// HostAccess lists the parts of a scenario that reach into the host running
+// it: command hooks, scripts, data and tenant files, gRPC proto files and
+// import paths, secrets and {{env.NAME}} templates. They are fine in a local
+// file, but let a scenario received over the network run code on the
+// generator or send its environment, files and credentials to a target.
+func (s *Scenario) HostAccess() []string {
+	var access []string
+
+	if s.Hooks != nil {
+		for event, hooks := range map[string][]HookConfig{
+			"on_start": s.Hooks.OnStart,
+			"on_stage": s.Hooks.OnStage,
+			"on_end":   s.Hooks.OnEnd,
+		} {
+			for i, hook := range hooks {
+				if hook.Command != "" {
+					access = append(access, fmt.Sprintf("command hook hooks.%s[%d]", event, i))
+				}
+			}
+		}
+	}
+
+	// Lua scripts may use the os and io libraries, and both kinds are
+	// loaded from the host
+	if s.Script != "" {
+		access = append(access, fmt.Sprintf("script %s", s.Script))
+	}
+	if s.Data != nil && s.Data.File != "" {
+		access = append(access, fmt.Sprintf("data file %s", s.Data.File))
+	}
+	if s.Tenants != nil && s.Tenants.File != "" {
+		access = append(access, fmt.Sprintf("tenants file %s", s.Tenants.File))
+	}
+
+	// gRPC proto files, and their imports, are parsed from the host
+	if strings.EqualFold(s.Protocol, "grpc") {
+		access = append(access, protoAccess("", s.ProtocolConfig)...)
+	}
+	for i, step := range s.Steps {
+		if strings.EqualFold(step.Protocol, "grpc") {
+			access = append(access, protoAccess(fmt.Sprintf("steps[%d] ", i), step.ProtocolConfig)...)
+		}
+	}
+
+	// Vault and AWS secrets resolve with the credentials of the host
+	for name, reference := range s.Secrets {
+		access = append(access, fmt.Sprintf("secret %s from %s", name, reference))
+	}
+
+	if data, err := json.Marshal(s); err == nil && envTemplatePattern.Match(data) {
+		access = append(access, "{{env.NAME}} template")
+	}
+
+	sort.Strings(access)
+	return access
+}
+
+// protoAccess lists the proto files and import paths of a gRPC protocol_config
+func protoAccess(prefix string, protocolConfig map[string]interface{}) []string {
+	var access []string
+	for _, file := range configStrings(protocolConfig["proto"]) {
+		access = append(access, fmt.Sprintf("%sproto file %s", prefix, file))
+	}
+	for _, path := range configStrings(protocolConfig["import_paths"]) {
+		access = append(access, fmt.Sprintf("%sproto import path %s", prefix, path))
+	}
+	return access
+}
+
+// configStrings reads a protocol_config setting holding a string or a list
+// of strings
+func configStrings(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	case []interface{}:
+		strs := make([]string, 0, len(value))
+		for _, item := range value {
+			strs = append(strs, fmt.Sprint(item))
+		}
+		return strs
+	}
+	return nil
+}
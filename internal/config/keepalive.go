@@ -0,0 +1,24 @@
+package config
+
+import "fmt"
+
+// ResolveKeepAlive reconciles the keep-alive settings of a run, each nil
+// when not given, into whether connections are kept alive. Neither given
+// keeps them alive; one given alone decides; both given must agree, so
+// --keep-alive --disable-keep-alive is rejected rather than guessed.
+func ResolveKeepAlive(keepAlive, disableKeepAlive *bool) (bool, error) {
+	switch {
+	case keepAlive != nil && disableKeepAlive != nil:
+		if *keepAlive == *disableKeepAlive {
+			return false, fmt.Errorf("conflicting keep-alive settings: keep-alive=%t and disable-keep-alive=%t; set only one of them",
+				*keepAlive, *disableKeepAlive)
+		}
+		return *keepAlive, nil
+	case keepAlive != nil:
+		return *keepAlive, nil
+	case disableKeepAlive != nil:
+		return !*disableKeepAlive, nil
+	default:
+		return true, nil
+	}
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LabelEnvPrefix marks environment variables that become run labels, e.g.
+// GOTSUNAMI_LABEL_GIT_SHA=abc123 adds the label git_sha=abc123
+const LabelEnvPrefix = "GOTSUNAMI_LABEL_"
+
+// CollectLabels merges labels from the environment with those given on the
+// command line, which take precedence
+func CollectLabels(flagLabels map[string]string) (map[string]string, error) {
+	labels := make(map[string]string)
+
+	for _, env := range os.Environ() {
+		key, value, found := strings.Cut(env, "=")
+		if !found || !strings.HasPrefix(key, LabelEnvPrefix) {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(key, LabelEnvPrefix))
+		if name != "" {
+			labels[name] = value
+		}
+	}
+
+	for key, value := range flagLabels {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("label keys must not be empty")
+		}
+		labels[key] = value
+	}
+
+	if len(labels) == 0 {
+		return nil, nil
+	}
+
+	return labels, nil
+}
@@ -1,9 +1,17 @@
 package config
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -11,6 +19,7 @@ import (
 type Scenario struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
+	Protocol    string                 `json:"protocol,omitempty"`
 	Method      string                 `json:"method"`
 	URL         string                 `json:"url"`
 	BaseURL     string                 `json:"base_url"`
@@ -22,8 +31,103 @@ type Scenario struct {
 	Validation  *ValidationConfig      `json:"validation,omitempty"`
 	Environment map[string]string      `json:"environment,omitempty"`
 	Variables   map[string]string      `json:"variables,omitempty"`
+	Script      string                 `json:"script,omitempty"`
+	LoadPattern *LoadPatternConfig     `json:"load_pattern,omitempty"`
+	Hooks       *HooksConfig           `json:"hooks,omitempty"`
+	Chaos       *ChaosConfig           `json:"chaos,omitempty"`
+	Bandwidth   *BandwidthConfig       `json:"bandwidth,omitempty"`
+	Cleanup     *CleanupConfig         `json:"cleanup,omitempty"`
+	SLO         *SLOConfig             `json:"slo,omitempty"`
+	Cache       *CacheConfig           `json:"cache,omitempty"`
+	RateLimit   *RateLimitConfig       `json:"rate_limit,omitempty"`
+	Idempotency *IdempotencyConfig     `json:"idempotency,omitempty"`
+	Tenants     *TenantConfig          `json:"tenants,omitempty"`
+	Consistency *ConsistencyConfig     `json:"consistency,omitempty"`
+	Redaction   *RedactionConfig       `json:"redaction,omitempty"`
+	Signing     *SigningConfig         `json:"signing,omitempty"`
+	Outfile     string                 `json:"outfile,omitempty"`
+
+	// AllowCustomMethods accepts any method that is a valid HTTP token, for
+	// APIs using non-standard methods such as PURGE or PROPFIND
+	AllowCustomMethods bool `json:"allow_custom_methods,omitempty"`
+
+	// VariableScopes sets how often each variable is evaluated: once for the
+	// whole test, once per VU, or for every request (see ScopeGlobal)
+	VariableScopes map[string]string `json:"variable_scopes,omitempty"`
+
+	// ProtocolConfig holds settings for non-HTTP protocols such as plugins
+	ProtocolConfig map[string]interface{} `json:"protocol_config,omitempty"`
+
+	// Group names the logical endpoint every request of the scenario is
+	// reported under in the per-endpoint breakdown
+	Group string `json:"group,omitempty"`
+
+	// URLTemplates name endpoints by path, so /users/1 and /users/2 are both
+	// reported under /users/:id (see MatchURLTemplate)
+	URLTemplates []string `json:"url_templates,omitempty"`
+
+	// Steps chain several requests, sent in order in every iteration, in
+	// place of the scenario's own method, URL and body
+	Steps []StepConfig `json:"steps,omitempty"`
+
+	// Extract sets variables from the response of the scenario's own
+	// request, kept for the VU's following iterations (see ParseExtract)
+	Extract map[string]string `json:"extract,omitempty"`
+
+	// Secrets name credentials read from external providers when the test
+	// starts, used as {{secret.NAME}} so they never live in the file (see
+	// ParseSecret). Their values are redacted from every artifact.
+	Secrets map[string]string `json:"secrets,omitempty"`
+
+	// Data feeds every iteration a row of a CSV file, exposed to templates as
+	// {{csv.COLUMN}}
+	Data *DataConfig `json:"data,omitempty"`
+
+	// CaptureHeaders are response headers, such as X-Cache or X-Backend,
+	// whose values break the responses down in the report. "Name:regex"
+	// reports the first capture group of the regex instead of the value,
+	// e.g. the data center of "CF-Ray:-(\\w+)$".
+	CaptureHeaders []string `json:"capture_headers,omitempty"`
+
+	// HTTPVersion is the HTTP version requests are sent with: 1.1 (the
+	// default), 2, 3 (QUIC), or auto to negotiate h2 over TLS (see
+	// ValidateHTTPVersion)
+	HTTPVersion string `json:"http_version,omitempty"`
+
+	// Stages drive the test at an arrival rate instead of a load pattern:
+	// iterations start at the rate of the stages whether or not earlier
+	// ones finished, up to one in flight per VU
+	Stages []StageConfig `json:"stages,omitempty"`
 }
 
+// HTTP versions a scenario may be sent with
+const (
+	HTTPVersion11   = "1.1"
+	HTTPVersion2    = "2"
+	HTTPVersion3    = "3"
+	HTTPVersionAuto = "auto"
+)
+
+// ValidateHTTPVersion checks an HTTP version setting; empty means 1.1
+func ValidateHTTPVersion(version string) error {
+	switch version {
+	case "", HTTPVersion11, HTTPVersion2, HTTPVersion3, HTTPVersionAuto:
+		return nil
+	default:
+		return fmt.Errorf("invalid HTTP version %q: use %s, %s, %s or %s", version, HTTPVersion11, HTTPVersion2, HTTPVersion3, HTTPVersionAuto)
+	}
+}
+
+// Variable scopes decide how often a templated variable is evaluated
+const (
+	// ScopeGlobal variables are evaluated once and shared by every VU
+	ScopeGlobal = "global"
+	// ScopeVU variables are evaluated once per VU and kept across iterations
+	ScopeVU = "vu"
+	// ScopeIteration variables are evaluated for every request (the default)
+	ScopeIteration = "iteration"
+)
+
 // RetryConfig defines retry behavior
 type RetryConfig struct {
 	Attempts int    `json:"attempts"`
@@ -31,6 +135,244 @@ type RetryConfig struct {
 	MaxDelay string `json:"max_delay"`
 }
 
+// LoadPatternConfig declares a custom load pattern as a list of phases
+type LoadPatternConfig struct {
+	Name   string        `json:"name,omitempty"`
+	Phases []PhaseConfig `json:"phases"`
+}
+
+// PhaseConfig defines a phase of a custom load pattern
+type PhaseConfig struct {
+	Duration  string  `json:"duration"`
+	Intensity float64 `json:"intensity"`
+	Ramp      bool    `json:"ramp,omitempty"`
+
+	// Name labels the phase in the per-stage breakdown of reports
+	Name string `json:"name,omitempty"`
+}
+
+// HooksConfig defines lifecycle hooks run at test start, on every load
+// pattern stage transition and at test end
+type HooksConfig struct {
+	OnStart []HookConfig `json:"on_start,omitempty"`
+	OnStage []HookConfig `json:"on_stage,omitempty"`
+	OnEnd   []HookConfig `json:"on_end,omitempty"`
+}
+
+// HookConfig defines a shell command or webhook hook
+type HookConfig struct {
+	Name        string            `json:"name,omitempty"`
+	Command     string            `json:"command,omitempty"`
+	Webhook     string            `json:"webhook,omitempty"`
+	Method      string            `json:"method,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Timeout     string            `json:"timeout,omitempty"`
+	FailOnError bool              `json:"fail_on_error,omitempty"`
+}
+
+// ChaosConfig defines client-side fault injection. Rates are probabilities
+// between 0 and 1.
+type ChaosConfig struct {
+	Latency      string  `json:"latency,omitempty"`
+	LatencyRate  float64 `json:"latency_rate,omitempty"`
+	DropRate     float64 `json:"drop_rate,omitempty"`
+	TruncateRate float64 `json:"truncate_rate,omitempty"`
+}
+
+// CacheConfig makes each virtual user behave like a caching client: it
+// remembers the validators of every URL it fetched and revalidates with
+// conditional requests, so CDN and cache layers can be load tested
+type CacheConfig struct {
+	// ETag sends If-None-Match with the last ETag seen for the URL
+	ETag bool `json:"etag"`
+	// LastModified sends If-Modified-Since with the last Last-Modified seen
+	LastModified bool `json:"last_modified"`
+}
+
+// Enabled reports whether any conditional request header is sent
+func (c *CacheConfig) Enabled() bool {
+	return c != nil && (c.ETag || c.LastModified)
+}
+
+// RateLimitConfig makes the test back off when the target rate limits it,
+// waiting as long as its Retry-After header asks, so the test measures the
+// throughput the target allows instead of a storm of rejected requests
+type RateLimitConfig struct {
+	// Statuses are the statuses that signal throttling; 429 by default
+	Statuses []int `json:"statuses,omitempty"`
+	// Backoff is the first wait when a response has no Retry-After; it
+	// doubles while responses keep being throttled
+	Backoff string `json:"backoff,omitempty"`
+	// MaxBackoff caps any single wait, including Retry-After
+	MaxBackoff string `json:"max_backoff,omitempty"`
+}
+
+// IdempotencyConfig sends an idempotency key with every logical operation.
+// Failed operations are retried with the same key, following the retry
+// settings; with Capture set, every attempt sharing a key must return the
+// same resource.
+type IdempotencyConfig struct {
+	// Header carries the key; Idempotency-Key by default
+	Header string `json:"header,omitempty"`
+	// Capture is the JSON path of the resource ID in successful responses
+	Capture string `json:"capture,omitempty"`
+	// Replay is the fraction of successful operations sent once more with
+	// the same key, to check the target without waiting for failures
+	Replay float64 `json:"replay,omitempty"`
+}
+
+// ConsistencyConfig hashes the body of every GET response per URL and
+// reports URLs that returned different content during the run, revealing
+// cache poisoning or replicas out of sync under load
+type ConsistencyConfig struct {
+	// Statuses are the statuses whose bodies are compared; 200 by default
+	Statuses []int `json:"statuses,omitempty"`
+	// Ignore lists JSON fields left out of the comparison, such as
+	// timestamps, as dot-separated paths; a path crossing an array applies
+	// to each of its elements
+	Ignore []string `json:"ignore,omitempty"`
+}
+
+// RedactionConfig masks sensitive values before they are written to
+// reports, raw results or traces, so auth tokens and personal data never
+// land in test artifacts
+type RedactionConfig struct {
+	// Headers are header names whose values are masked, in any case
+	Headers []string `json:"headers,omitempty"`
+	// Fields are JSON body fields whose values are masked, as dot-separated
+	// paths; a path crossing an array applies to each of its elements
+	Fields []string `json:"fields,omitempty"`
+	// Patterns are regular expressions whose matches are masked in URLs,
+	// bodies, variables and error messages
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// SigningConfig signs every request with an HMAC of its canonical form, for
+// APIs that reject unsigned requests. The canonical form joins Components,
+// in order, with Separator.
+type SigningConfig struct {
+	// Secret is the HMAC key, usually "${VAR}" so it stays out of the file;
+	// SecretEncoding decodes it from hex or base64 (raw by default)
+	Secret         string `json:"secret"`
+	SecretEncoding string `json:"secret_encoding,omitempty"`
+	// Algorithm is the hash: sha256 (the default), sha1 or sha512
+	Algorithm string `json:"algorithm,omitempty"`
+	// Header carries the signature, X-Signature by default, as Prefix
+	// followed by the signature in Encoding: hex (the default) or base64
+	Header   string `json:"header,omitempty"`
+	Prefix   string `json:"prefix,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	// Components are the signed parts of the request (see SignMethod);
+	// method, path and body by default
+	Components []string `json:"components,omitempty"`
+	// Separator joins the components; a newline by default
+	Separator string `json:"separator,omitempty"`
+	// TimestampHeader receives the Unix time of the timestamp component,
+	// X-Timestamp by default
+	TimestampHeader string `json:"timestamp_header,omitempty"`
+}
+
+// Signed components of a request; SignHeader followed by a header name signs
+// that header
+const (
+	// SignMethod is the request method in upper case
+	SignMethod = "method"
+	// SignPath is the escaped URL path
+	SignPath = "path"
+	// SignQuery is the query string sorted by name, then value
+	SignQuery = "query"
+	// SignBody is the raw request body
+	SignBody = "body"
+	// SignBodySHA256 is the hex SHA-256 digest of the body
+	SignBodySHA256 = "body_sha256"
+	// SignTimestamp is the Unix time the request was signed at, also sent
+	// in the timestamp header
+	SignTimestamp = "timestamp"
+	// SignHeader prefixes the name of a signed header
+	SignHeader = "header:"
+)
+
+// TenantConfig tags every request with a tenant drawn from a data feed, so
+// latency and errors are reported per tenant. A tenant listed several times
+// gets a matching share of the requests.
+type TenantConfig struct {
+	// Values lists the tenants inline
+	Values []string `json:"values,omitempty"`
+	// File reads the tenants from a file, one per line, or from Column of a
+	// CSV file with a header row
+	File   string `json:"file,omitempty"`
+	Column string `json:"column,omitempty"`
+	// Variable exposes the tenant to templates; tenant by default
+	Variable string `json:"variable,omitempty"`
+	// Header sends the tenant in a request header unless the scenario sets it
+	Header string `json:"header,omitempty"`
+	// Distribution picks the tenant of each request (see TenantRoundRobin)
+	Distribution string `json:"distribution,omitempty"`
+}
+
+// DataConfig feeds iterations the rows of a CSV file with a header row
+// naming its columns
+type DataConfig struct {
+	File string `json:"file"`
+	// Strategy assigns rows to iterations (see DataSequential)
+	Strategy string `json:"strategy,omitempty"`
+	// Delimiter separates the fields of a row; a comma by default
+	Delimiter string `json:"delimiter,omitempty"`
+	// Weight names a column of non-negative numbers making the random
+	// strategy pick each row in proportion to its value
+	Weight string `json:"weight,omitempty"`
+}
+
+// Data strategies decide which row each iteration reads
+const (
+	// DataSequential reads the rows in order across every VU, starting over
+	// after the last (the default)
+	DataSequential = "sequential"
+	// DataRandom reads a row at random in every iteration
+	DataRandom = "random"
+	// DataUnique reads every row once across every VU; a VU stops when the
+	// rows run out
+	DataUnique = "unique"
+)
+
+// Tenant distributions decide which tenant each request is made for
+const (
+	// TenantRoundRobin cycles through the feed across every VU (the default)
+	TenantRoundRobin = "round_robin"
+	// TenantRandom picks a tenant at random for every request
+	TenantRandom = "random"
+	// TenantVU keeps one tenant per VU for the whole test
+	TenantVU = "vu"
+)
+
+// CleanupConfig deletes resources created by the test once it ends. The ID
+// of each created resource is captured from successful responses with a JSON
+// path and exposed to the cleanup URL and headers as a template variable.
+type CleanupConfig struct {
+	Capture  string            `json:"capture"`
+	Variable string            `json:"variable,omitempty"`
+	Method   string            `json:"method,omitempty"`
+	URL      string            `json:"url"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Rate     float64           `json:"rate,omitempty"`
+	Timeout  string            `json:"timeout,omitempty"`
+}
+
+// SLOConfig defines service level objectives evaluated continuously during
+// the run and once more at the end
+type SLOConfig struct {
+	SuccessRate float64            `json:"success_rate,omitempty"` // minimum percentage of successful requests
+	Latency     []LatencyObjective `json:"latency,omitempty"`
+	Interval    string             `json:"interval,omitempty"`
+	Webhook     string             `json:"webhook,omitempty"`
+}
+
+// LatencyObjective requires a latency percentile to stay under a maximum
+type LatencyObjective struct {
+	Percentile float64 `json:"percentile"`
+	Max        string  `json:"max"`
+}
+
 // ValidationConfig defines response validation rules
 type ValidationConfig struct {
 	StatusCodes     []int             `json:"status_codes,omitempty"`
@@ -42,6 +384,12 @@ type ValidationConfig struct {
 	Headers         map[string]string `json:"headers,omitempty"`
 	MinResponseSize int               `json:"min_response_size,omitempty"`
 	MaxResponseSize int               `json:"max_response_size,omitempty"`
+
+	// SampleRate is the share of responses, above 0 and at most 1, whose
+	// body, size and headers are checked, sparing the CPU of expensive rules;
+	// every response is still held to the status code and response time
+	// rules (0 = all)
+	SampleRate float64 `json:"sample_rate,omitempty"`
 }
 
 // LoadTestConfig represents the complete load test configuration
@@ -55,6 +403,13 @@ type LoadTestConfig struct {
 	MaxRequests  int           `json:"max_requests"`
 	Timeout      time.Duration `json:"timeout"`
 	Pattern      string        `json:"pattern"`
+	Seed         int64         `json:"seed"`
+
+	// Labels are free-form run metadata embedded in every report
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// SkipPreflight disables the probe request sent before the test
+	SkipPreflight bool `json:"skip_preflight,omitempty"`
 
 	// Output configuration
 	Live         bool   `json:"live"`
@@ -68,22 +423,120 @@ type LoadTestConfig struct {
 	ExpectBodyNot      string        `json:"expect_body_not,omitempty"`
 	ExpectResponseTime time.Duration `json:"expect_response_time,omitempty"`
 
+	// Drain is how long in-flight requests may finish after the test ends
+	Drain time.Duration `json:"drain,omitempty"`
+
+	// Warmup holds the test at WarmupVUs for up to this long before the
+	// measured test starts, until the p95 latency of consecutive
+	// WarmupWindow windows varies by less than WarmupTolerance (0 = off)
+	Warmup          time.Duration `json:"warmup,omitempty"`
+	WarmupVUs       int           `json:"warmup_vus,omitempty"`
+	WarmupWindow    time.Duration `json:"warmup_window,omitempty"`
+	WarmupTolerance float64       `json:"warmup_tolerance,omitempty"`
+
+	// LatencyGoals are the latency targets the capacity section of the
+	// report estimates the sustainable rate for; the SLO latency objectives
+	// of the scenario by default
+	LatencyGoals []LatencyObjective `json:"latency_goals,omitempty"`
+
+	// Outputs stream every request outcome to external systems, such as
+	// statsd://localhost:8125 (see metrics.NewSink)
+	Outputs []string `json:"outputs,omitempty"`
+
+	// GlobalLimit is the URL of a limit served by `gotsunami serve`; requests
+	// in flight across every agent using it never exceed its size
+	GlobalLimit string `json:"global_limit,omitempty"`
+	// GlobalLimitToken is the token of the server serving GlobalLimit
+	GlobalLimitToken string `json:"-"`
+
 	// Advanced configuration
-	Workers       int    `json:"workers"`
-	Connections   int    `json:"connections"`
-	KeepAlive     bool   `json:"keep_alive"`
-	TLSSkipVerify bool   `json:"tls_skip_verify"`
-	Proxy         string `json:"proxy,omitempty"`
-	UserAgent     string `json:"user_agent,omitempty"`
+	Workers         int    `json:"workers"`
+	Connections     int    `json:"connections"`
+	MaxConnsPerHost int    `json:"max_conns_per_host,omitempty"`
+	ClientPerVU     bool   `json:"client_per_vu,omitempty"`
+	KeepAlive       bool   `json:"keep_alive"`
+	TLSSkipVerify   bool   `json:"tls_skip_verify"`
+	Proxy           string `json:"proxy,omitempty"`
+	UserAgent       string `json:"user_agent,omitempty"`
+
+	// ClientCerts is a directory of client certificate and key pairs for
+	// mTLS, one per VU so services see as many distinct identities
+	ClientCerts string `json:"client_certs,omitempty"`
+
+	// MaxRequestsPerConn replaces each connection after it carried this
+	// many requests; Pipeline sends up to this many requests on a connection
+	// without waiting for their responses (HTTP/1.1 pipelining, experimental)
+	MaxRequestsPerConn int `json:"max_requests_per_conn,omitempty"`
+	Pipeline           int `json:"pipeline,omitempty"`
+
+	// Bandwidth overrides the scenario bandwidth limits when set
+	Bandwidth *BandwidthConfig `json:"bandwidth,omitempty"`
+
+	// HTTPVersion overrides the scenario HTTP version when set
+	HTTPVersion string `json:"http_version,omitempty"`
+
+	// Stages override the stages of the scenario when set
+	Stages []StageConfig `json:"stages,omitempty"`
+
+	// ConnSoftStart paces the requests of connections younger than this:
+	// they start at ConnSoftStartRate requests per second (0 = off)
+	ConnSoftStart     time.Duration `json:"conn_soft_start,omitempty"`
+	ConnSoftStartRate float64       `json:"conn_soft_start_rate,omitempty"`
+
+	// MaxDecompressedSize and MaxDecompressionRatio cap how far compressed
+	// response bodies may expand, in bytes and as decompressed over
+	// compressed size (0 = default, negative = no limit)
+	MaxDecompressedSize   int64   `json:"max_decompressed_size,omitempty"`
+	MaxDecompressionRatio float64 `json:"max_decompression_ratio,omitempty"`
+
+	// HistogramPrecision is the sub-bucket bits of latency histograms
+	// (0 = default); higher values trade memory for percentile accuracy
+	HistogramPrecision uint `json:"histogram_precision,omitempty"`
+
+	// Request correlation
+	IdentityHeaders bool   `json:"identity_headers,omitempty"`
+	ClientIDHeader  string `json:"client_id_header,omitempty"`
+	RequestIDHeader string `json:"request_id_header,omitempty"`
+	RawOut          string `json:"raw_out,omitempty"`
+
+	// TraceVUs is how many VUs, starting from the first, write everything
+	// they do to TraceOut
+	TraceVUs int    `json:"trace_vus,omitempty"`
+	TraceOut string `json:"trace_out,omitempty"`
+
+	// OTLPEndpoint receives one OpenTelemetry trace per iteration, for a
+	// share OTLPSample of the iterations
+	OTLPEndpoint string  `json:"otlp_endpoint,omitempty"`
+	OTLPSample   float64 `json:"otlp_sample,omitempty"`
 }
 
-// LoadScenarioFromFile loads a scenario configuration from a JSON file
+// StdinScenario is the scenario file name that reads the scenario from
+// stdin, so generated scenarios can be piped in
+const StdinScenario = "-"
+
+// LoadScenarioFromFile loads a scenario configuration from a JSON file, or
+// from stdin when filename is StdinScenario
 func LoadScenarioFromFile(filename string) (*Scenario, error) {
-	data, err := os.ReadFile(filename)
+	var data []byte
+	var err error
+	if filename == StdinScenario {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(filename)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to read scenario file: %w", err)
 	}
 
+	if err := ValidateScenarioJSON(data); err != nil {
+		return nil, fmt.Errorf("scenario does not match the schema:\n%w", err)
+	}
+
+	// Resolve ${VAR} references once, before the scenario is parsed
+	if data, err = NewEnvironment().InterpolateJSON(data); err != nil {
+		return nil, fmt.Errorf("failed to interpolate scenario: %w", err)
+	}
+
 	var scenario Scenario
 	if err := json.Unmarshal(data, &scenario); err != nil {
 		return nil, fmt.Errorf("failed to parse scenario JSON: %w", err)
@@ -93,34 +546,103 @@ func LoadScenarioFromFile(filename string) (*Scenario, error) {
 		return nil, fmt.Errorf("scenario validation failed: %w", err)
 	}
 
+	// Resolve referenced files relative to the scenario file; a scenario
+	// read from stdin resolves them relative to the working directory
+	if scenario.Script != "" && !filepath.IsAbs(scenario.Script) {
+		scenario.Script = filepath.Join(filepath.Dir(filename), scenario.Script)
+	}
+	if scenario.Data != nil && scenario.Data.File != "" && !filepath.IsAbs(scenario.Data.File) {
+		scenario.Data.File = filepath.Join(filepath.Dir(filename), scenario.Data.File)
+	}
+	if scenario.Tenants != nil && scenario.Tenants.File != "" && !filepath.IsAbs(scenario.Tenants.File) {
+		scenario.Tenants.File = filepath.Join(filepath.Dir(filename), scenario.Tenants.File)
+	}
+	for name, reference := range scenario.Secrets {
+		if path := strings.TrimPrefix(reference, SecretFile); path != reference && !filepath.IsAbs(path) {
+			scenario.Secrets[name] = SecretFile + filepath.Join(filepath.Dir(filename), path)
+		}
+	}
+	if strings.EqualFold(scenario.Protocol, "grpc") && scenario.ProtocolConfig != nil {
+		resolveImportPaths(scenario.ProtocolConfig, filepath.Dir(filename))
+	}
+	for _, step := range scenario.Steps {
+		if strings.EqualFold(step.Protocol, "grpc") && step.ProtocolConfig != nil {
+			resolveImportPaths(step.ProtocolConfig, filepath.Dir(filename))
+		}
+	}
+
 	return &scenario, nil
 }
 
+// resolveImportPaths makes the import paths of a gRPC scenario, which its
+// proto files are found in, relative to dir; without any, proto files are
+// found in dir itself
+func resolveImportPaths(protocolConfig map[string]interface{}, dir string) {
+	if _, hasProto := protocolConfig["proto"]; !hasProto {
+		return
+	}
+
+	var paths []interface{}
+	switch value := protocolConfig["import_paths"].(type) {
+	case nil:
+		paths = []interface{}{"."}
+	case string:
+		paths = []interface{}{value}
+	case []interface{}:
+		paths = value
+	default:
+		// Left for the protocol to reject
+		return
+	}
+
+	resolved := make([]interface{}, len(paths))
+	for i, path := range paths {
+		if str, isString := path.(string); isString && !filepath.IsAbs(str) {
+			path = filepath.Join(dir, str)
+		}
+		resolved[i] = path
+	}
+	protocolConfig["import_paths"] = resolved
+}
+
 // Validate validates the scenario configuration
 func (s *Scenario) Validate() error {
 	if s.Name == "" {
 		return fmt.Errorf("scenario name is required")
 	}
 
-	if s.Method == "" {
-		return fmt.Errorf("scenario method is required")
-	}
+	// A chain of steps replaces the scenario's own request
+	if len(s.Steps) == 0 {
+		if s.Method == "" {
+			return fmt.Errorf("scenario method is required")
+		}
 
-	if s.URL == "" {
-		return fmt.Errorf("scenario URL is required")
+		if s.URL == "" {
+			return fmt.Errorf("scenario URL is required")
+		}
 	}
 
 	if s.BaseURL == "" {
 		return fmt.Errorf("scenario base_url is required")
 	}
 
-	// Validate method
-	validMethods := map[string]bool{
-		"GET": true, "POST": true, "PUT": true, "DELETE": true,
-		"PATCH": true, "HEAD": true, "OPTIONS": true,
+	if s.Method != "" {
+		if err := s.validateMethod(s.Method, s.IsHTTP()); err != nil {
+			return err
+		}
+	}
+
+	if len(s.Extract) > 0 && len(s.Steps) > 0 {
+		return fmt.Errorf("scenario extract does not apply to steps; set extract on each step")
 	}
-	if !validMethods[s.Method] {
-		return fmt.Errorf("invalid HTTP method: %s", s.Method)
+	if err := validateExtract(s.Extract); err != nil {
+		return err
+	}
+
+	for i := range s.Steps {
+		if err := s.Steps[i].Validate(s); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
 	}
 
 	// Validate timeout if provided
@@ -130,6 +652,145 @@ func (s *Scenario) Validate() error {
 		}
 	}
 
+	// Validate script type if provided
+	if s.Script != "" {
+		if ext := strings.ToLower(filepath.Ext(s.Script)); ext != ".lua" && ext != ".wasm" {
+			return fmt.Errorf("unsupported script type: %s", s.Script)
+		}
+	}
+
+	// Validate load pattern if provided
+	if s.LoadPattern != nil {
+		if err := s.LoadPattern.Validate(); err != nil {
+			return fmt.Errorf("load pattern validation failed: %w", err)
+		}
+	}
+
+	if len(s.Stages) > 0 {
+		if err := ValidateStages(s.Stages); err != nil {
+			return fmt.Errorf("stages validation failed: %w", err)
+		}
+		if s.LoadPattern != nil {
+			return fmt.Errorf("stages and load_pattern are mutually exclusive")
+		}
+	}
+
+	// Validate hooks if provided
+	if s.Hooks != nil {
+		if err := s.Hooks.Validate(); err != nil {
+			return fmt.Errorf("hooks validation failed: %w", err)
+		}
+	}
+
+	// Validate chaos config if provided
+	if s.Chaos != nil {
+		if err := s.Chaos.Validate(); err != nil {
+			return fmt.Errorf("chaos validation failed: %w", err)
+		}
+	}
+
+	// Validate bandwidth config if provided
+	if s.Bandwidth != nil {
+		if err := s.Bandwidth.Validate(); err != nil {
+			return fmt.Errorf("bandwidth validation failed: %w", err)
+		}
+	}
+
+	// Validate cleanup config if provided
+	if s.Cleanup != nil {
+		if err := s.Cleanup.Validate(); err != nil {
+			return fmt.Errorf("cleanup validation failed: %w", err)
+		}
+	}
+
+	for name, scope := range s.VariableScopes {
+		if _, exists := s.Variables[name]; !exists {
+			return fmt.Errorf("variable scope set for undefined variable: %s", name)
+		}
+		if scope != ScopeGlobal && scope != ScopeVU && scope != ScopeIteration {
+			return fmt.Errorf("invalid scope for variable %s: %s (use %s, %s or %s)", name, scope, ScopeGlobal, ScopeVU, ScopeIteration)
+		}
+	}
+
+	for _, template := range s.URLTemplates {
+		if err := ValidateURLTemplate(template); err != nil {
+			return fmt.Errorf("invalid URL template %q: %w", template, err)
+		}
+	}
+
+	// Validate rate limit config if provided
+	if s.RateLimit != nil {
+		if err := s.RateLimit.Validate(); err != nil {
+			return fmt.Errorf("rate limit validation failed: %w", err)
+		}
+	}
+
+	// Validate idempotency config if provided
+	if s.Idempotency != nil {
+		if err := s.Idempotency.Validate(); err != nil {
+			return fmt.Errorf("idempotency validation failed: %w", err)
+		}
+	}
+
+	// Validate tenant config if provided
+	if s.Tenants != nil {
+		if err := s.Tenants.Validate(); err != nil {
+			return fmt.Errorf("tenants validation failed: %w", err)
+		}
+	}
+
+	for _, capture := range s.CaptureHeaders {
+		if _, _, err := ParseCaptureHeader(capture); err != nil {
+			return err
+		}
+	}
+
+	if err := ValidateHTTPVersion(s.HTTPVersion); err != nil {
+		return err
+	}
+	if s.HTTPVersion != "" && !s.SendsHTTP() {
+		return fmt.Errorf("http_version applies to HTTP scenarios only, not %s", s.Protocol)
+	}
+
+	// Validate data config if provided
+	if s.Data != nil {
+		if err := s.Data.Validate(); err != nil {
+			return fmt.Errorf("data validation failed: %w", err)
+		}
+	}
+
+	// Validate consistency config if provided
+	if s.Consistency != nil {
+		if err := s.Consistency.Validate(); err != nil {
+			return fmt.Errorf("consistency validation failed: %w", err)
+		}
+	}
+
+	// Validate redaction config if provided
+	if s.Redaction != nil {
+		if err := s.Redaction.Validate(); err != nil {
+			return fmt.Errorf("redaction validation failed: %w", err)
+		}
+	}
+
+	if err := validateSecrets(s.Secrets); err != nil {
+		return err
+	}
+
+	// Validate signing config if provided
+	if s.Signing != nil {
+		if err := s.Signing.Validate(); err != nil {
+			return fmt.Errorf("signing validation failed: %w", err)
+		}
+	}
+
+	// Validate SLO config if provided
+	if s.SLO != nil {
+		if err := s.SLO.Validate(); err != nil {
+			return fmt.Errorf("slo validation failed: %w", err)
+		}
+	}
+
 	// Validate retry config if provided
 	if s.Retry != nil {
 		if err := s.Retry.Validate(); err != nil {
@@ -173,6 +834,495 @@ func (r *RetryConfig) Validate() error {
 	return nil
 }
 
+// retryBaseDelay is the wait before the first retry
+const retryBaseDelay = 100 * time.Millisecond
+
+// GetDelay returns the wait before the given retry, counting from 1
+func (r *RetryConfig) GetDelay(attempt int) time.Duration {
+	delay := retryBaseDelay
+	switch r.Backoff {
+	case "fixed":
+	case "linear":
+		delay *= time.Duration(attempt)
+	default:
+		delay <<= min(attempt-1, 16)
+	}
+
+	if maxDelay, err := time.ParseDuration(r.MaxDelay); err == nil && maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// Validate validates the load pattern configuration
+func (l *LoadPatternConfig) Validate() error {
+	for i, phase := range l.Phases {
+		duration, err := time.ParseDuration(phase.Duration)
+		if err != nil {
+			return fmt.Errorf("invalid duration in phase %d: %s", i+1, phase.Duration)
+		}
+		if duration < 0 {
+			return fmt.Errorf("phase %d duration must be non-negative", i+1)
+		}
+		if phase.Intensity < 0 {
+			return fmt.Errorf("phase %d intensity must be non-negative", i+1)
+		}
+	}
+
+	return nil
+}
+
+// Validate validates the hooks configuration
+func (h *HooksConfig) Validate() error {
+	groups := map[string][]HookConfig{
+		"on_start": h.OnStart,
+		"on_stage": h.OnStage,
+		"on_end":   h.OnEnd,
+	}
+
+	for group, hooks := range groups {
+		for i, hook := range hooks {
+			if (hook.Command == "") == (hook.Webhook == "") {
+				return fmt.Errorf("%s hook %d must define exactly one of command or webhook", group, i+1)
+			}
+			if hook.Webhook != "" {
+				if _, err := url.ParseRequestURI(hook.Webhook); err != nil {
+					return fmt.Errorf("%s hook %d has invalid webhook URL: %w", group, i+1, err)
+				}
+			}
+			if hook.Timeout != "" {
+				if _, err := time.ParseDuration(hook.Timeout); err != nil {
+					return fmt.Errorf("%s hook %d has invalid timeout: %s", group, i+1, hook.Timeout)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetTimeout returns the hook timeout, defaulting to 30 seconds
+func (h HookConfig) GetTimeout() time.Duration {
+	if h.Timeout == "" {
+		return 30 * time.Second
+	}
+
+	timeout, err := time.ParseDuration(h.Timeout)
+	if err != nil {
+		return 30 * time.Second
+	}
+
+	return timeout
+}
+
+// Validate validates the chaos configuration
+func (c *ChaosConfig) Validate() error {
+	if c.Latency != "" {
+		if _, err := time.ParseDuration(c.Latency); err != nil {
+			return fmt.Errorf("invalid latency: %s", c.Latency)
+		}
+	}
+
+	rates := map[string]float64{
+		"latency_rate":  c.LatencyRate,
+		"drop_rate":     c.DropRate,
+		"truncate_rate": c.TruncateRate,
+	}
+	for name, rate := range rates {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%s must be between 0 and 1", name)
+		}
+	}
+
+	return nil
+}
+
+// GetLatency returns the maximum injected latency
+func (c *ChaosConfig) GetLatency() time.Duration {
+	latency, _ := time.ParseDuration(c.Latency)
+	return latency
+}
+
+// Validate validates the rate limit configuration
+func (r *RateLimitConfig) Validate() error {
+	for name, value := range map[string]string{"backoff": r.Backoff, "max_backoff": r.MaxBackoff} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s: %s", name, value)
+		}
+	}
+
+	for _, status := range r.Statuses {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("invalid status: %d", status)
+		}
+	}
+
+	return nil
+}
+
+// GetStatuses returns the statuses that signal throttling
+func (r *RateLimitConfig) GetStatuses() []int {
+	if len(r.Statuses) == 0 {
+		return []int{429}
+	}
+	return r.Statuses
+}
+
+// GetBackoff returns the wait used when a response has no Retry-After
+func (r *RateLimitConfig) GetBackoff() time.Duration {
+	if backoff, err := time.ParseDuration(r.Backoff); err == nil && backoff > 0 {
+		return backoff
+	}
+	return time.Second
+}
+
+// GetMaxBackoff returns the longest single wait
+func (r *RateLimitConfig) GetMaxBackoff() time.Duration {
+	if maxBackoff, err := time.ParseDuration(r.MaxBackoff); err == nil && maxBackoff > 0 {
+		return maxBackoff
+	}
+	return time.Minute
+}
+
+// Validate validates the idempotency configuration
+func (i *IdempotencyConfig) Validate() error {
+	if i.Replay < 0 || i.Replay > 1 {
+		return fmt.Errorf("replay must be between 0 and 1")
+	}
+	if i.Replay > 0 && i.Capture == "" {
+		return fmt.Errorf("replay requires capture to compare resources")
+	}
+
+	return nil
+}
+
+// GetHeader returns the header carrying the idempotency key
+func (i *IdempotencyConfig) GetHeader() string {
+	if i.Header == "" {
+		return "Idempotency-Key"
+	}
+	return i.Header
+}
+
+// Validate validates the consistency configuration
+func (c *ConsistencyConfig) Validate() error {
+	for _, status := range c.Statuses {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("invalid status: %d", status)
+		}
+	}
+	for _, path := range c.Ignore {
+		if path == "" || strings.HasPrefix(path, ".") || strings.HasSuffix(path, ".") || strings.Contains(path, "..") {
+			return fmt.Errorf("invalid ignore path: %q", path)
+		}
+	}
+
+	return nil
+}
+
+// GetStatuses returns the statuses whose bodies are compared
+func (c *ConsistencyConfig) GetStatuses() []int {
+	if len(c.Statuses) == 0 {
+		return []int{200}
+	}
+	return c.Statuses
+}
+
+// Validate validates the redaction configuration
+func (r *RedactionConfig) Validate() error {
+	for _, header := range r.Headers {
+		if !isToken(header) {
+			return fmt.Errorf("invalid header name: %q", header)
+		}
+	}
+	for _, path := range r.Fields {
+		if path == "" || strings.HasPrefix(path, ".") || strings.HasSuffix(path, ".") || strings.Contains(path, "..") {
+			return fmt.Errorf("invalid field path: %q", path)
+		}
+	}
+	for _, pattern := range r.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate validates the signing configuration
+func (s *SigningConfig) Validate() error {
+	if s.Secret == "" {
+		return fmt.Errorf("secret is required")
+	}
+	if _, err := s.Key(); err != nil {
+		return err
+	}
+	switch s.Algorithm {
+	case "", "sha1", "sha256", "sha512":
+	default:
+		return fmt.Errorf("invalid algorithm: %s (use sha256, sha1 or sha512)", s.Algorithm)
+	}
+	switch s.Encoding {
+	case "", "hex", "base64":
+	default:
+		return fmt.Errorf("invalid encoding: %s (use hex or base64)", s.Encoding)
+	}
+	for _, header := range []string{s.Header, s.TimestampHeader} {
+		if header != "" && !isToken(header) {
+			return fmt.Errorf("invalid header name: %q", header)
+		}
+	}
+	for _, component := range s.Components {
+		switch component {
+		case SignMethod, SignPath, SignQuery, SignBody, SignBodySHA256, SignTimestamp:
+		default:
+			if !strings.HasPrefix(component, SignHeader) || !isToken(strings.TrimPrefix(component, SignHeader)) {
+				return fmt.Errorf("invalid component: %q", component)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Key returns the decoded HMAC key
+func (s *SigningConfig) Key() ([]byte, error) {
+	switch s.SecretEncoding {
+	case "", "raw":
+		return []byte(s.Secret), nil
+	case "hex":
+		key, err := hex.DecodeString(s.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("secret is not valid hex: %w", err)
+		}
+		return key, nil
+	case "base64":
+		key, err := base64.StdEncoding.DecodeString(s.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("secret is not valid base64: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("invalid secret encoding: %s (use raw, hex or base64)", s.SecretEncoding)
+	}
+}
+
+// GetComponents returns the signed components
+func (s *SigningConfig) GetComponents() []string {
+	if len(s.Components) == 0 {
+		return []string{SignMethod, SignPath, SignBody}
+	}
+	return s.Components
+}
+
+// GetHeader returns the header carrying the signature
+func (s *SigningConfig) GetHeader() string {
+	if s.Header == "" {
+		return "X-Signature"
+	}
+	return s.Header
+}
+
+// GetTimestampHeader returns the header carrying the signing time
+func (s *SigningConfig) GetTimestampHeader() string {
+	if s.TimestampHeader == "" {
+		return "X-Timestamp"
+	}
+	return s.TimestampHeader
+}
+
+// GetSeparator returns the string joining the components
+func (s *SigningConfig) GetSeparator() string {
+	if s.Separator == "" {
+		return "\n"
+	}
+	return s.Separator
+}
+
+// Validate validates the tenant configuration
+func (t *TenantConfig) Validate() error {
+	if len(t.Values) == 0 && t.File == "" {
+		return fmt.Errorf("values or file is required")
+	}
+	if len(t.Values) > 0 && t.File != "" {
+		return fmt.Errorf("values and file are mutually exclusive")
+	}
+	if t.Column != "" && t.File == "" {
+		return fmt.Errorf("column requires file")
+	}
+	switch t.Distribution {
+	case "", TenantRoundRobin, TenantRandom, TenantVU:
+	default:
+		return fmt.Errorf("invalid distribution: %s (use %s, %s or %s)", t.Distribution, TenantRoundRobin, TenantRandom, TenantVU)
+	}
+
+	return nil
+}
+
+// ParseCaptureHeader splits a captured header into its name and the regex
+// its values are reduced with, nil when values are reported as they are
+func ParseCaptureHeader(capture string) (string, *regexp.Regexp, error) {
+	name, pattern, hasPattern := strings.Cut(capture, ":")
+	if !isToken(name) {
+		return "", nil, fmt.Errorf("invalid capture header name: %q", name)
+	}
+	if !hasPattern {
+		return name, nil, nil
+	}
+
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid capture header regex of %s: %w", name, err)
+	}
+	return name, regex, nil
+}
+
+// Validate validates the data configuration
+func (d *DataConfig) Validate() error {
+	if d.File == "" {
+		return fmt.Errorf("file is required")
+	}
+	switch d.Strategy {
+	case "", DataSequential, DataRandom, DataUnique:
+	default:
+		return fmt.Errorf("invalid strategy: %s (use %s, %s or %s)", d.Strategy, DataSequential, DataRandom, DataUnique)
+	}
+	if _, err := d.GetDelimiter(); err != nil {
+		return err
+	}
+	if d.Weight != "" && d.Strategy != DataRandom {
+		return fmt.Errorf("weight needs the %s strategy", DataRandom)
+	}
+	return nil
+}
+
+// GetDelimiter returns the field delimiter, a comma by default
+func (d *DataConfig) GetDelimiter() (rune, error) {
+	if d.Delimiter == "" {
+		return ',', nil
+	}
+	runes := []rune(d.Delimiter)
+	if len(runes) != 1 || runes[0] == '"' || runes[0] == '\r' || runes[0] == '\n' {
+		return 0, fmt.Errorf("invalid delimiter: %q", d.Delimiter)
+	}
+	return runes[0], nil
+}
+
+// GetVariable returns the template variable holding the tenant
+func (t *TenantConfig) GetVariable() string {
+	if t.Variable == "" {
+		return "tenant"
+	}
+	return t.Variable
+}
+
+// Validate validates the cleanup configuration
+func (c *CleanupConfig) Validate() error {
+	if c.Capture == "" {
+		return fmt.Errorf("capture path is required")
+	}
+	if c.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if c.Rate < 0 {
+		return fmt.Errorf("rate must be non-negative")
+	}
+	if c.Timeout != "" {
+		if _, err := time.ParseDuration(c.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout: %s", c.Timeout)
+		}
+	}
+
+	return nil
+}
+
+// GetVariable returns the template variable holding the captured ID
+func (c *CleanupConfig) GetVariable() string {
+	if c.Variable == "" {
+		return "id"
+	}
+	return c.Variable
+}
+
+// GetMethod returns the cleanup HTTP method, defaulting to DELETE
+func (c *CleanupConfig) GetMethod() string {
+	if c.Method == "" {
+		return "DELETE"
+	}
+	return strings.ToUpper(c.Method)
+}
+
+// GetRate returns the cleanup rate in requests per second, defaulting to 10
+func (c *CleanupConfig) GetRate() float64 {
+	if c.Rate <= 0 {
+		return 10
+	}
+	return c.Rate
+}
+
+// GetTimeout returns the maximum cleanup duration, defaulting to 5 minutes
+func (c *CleanupConfig) GetTimeout() time.Duration {
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil || timeout <= 0 {
+		return 5 * time.Minute
+	}
+	return timeout
+}
+
+// Validate validates the SLO configuration
+func (s *SLOConfig) Validate() error {
+	if s.SuccessRate < 0 || s.SuccessRate >= 100 {
+		return fmt.Errorf("success_rate must be between 0 and 100 (exclusive)")
+	}
+	for i, objective := range s.Latency {
+		if objective.Percentile <= 0 || objective.Percentile >= 100 {
+			return fmt.Errorf("latency objective %d percentile must be between 0 and 100 (exclusive)", i+1)
+		}
+		if _, err := time.ParseDuration(objective.Max); err != nil {
+			return fmt.Errorf("latency objective %d has invalid max: %s", i+1, objective.Max)
+		}
+	}
+	if s.Interval != "" {
+		if _, err := time.ParseDuration(s.Interval); err != nil {
+			return fmt.Errorf("invalid interval: %s", s.Interval)
+		}
+	}
+	if s.Webhook != "" {
+		if _, err := url.ParseRequestURI(s.Webhook); err != nil {
+			return fmt.Errorf("invalid webhook URL: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ParseLatencyGoal parses a --goal flag, "pPERCENTILE=MAX" such as
+// "p95=200ms" or "p99.9=1s"
+func ParseLatencyGoal(value string) (LatencyObjective, error) {
+	percentile, max, found := strings.Cut(strings.TrimSpace(value), "=")
+	rest, hasPrefix := strings.CutPrefix(strings.ToLower(percentile), "p")
+	parsed, err := strconv.ParseFloat(rest, 64)
+	if !found || !hasPrefix || err != nil || parsed <= 0 || parsed >= 100 {
+		return LatencyObjective{}, fmt.Errorf("invalid goal %q: use pPERCENTILE=MAX, e.g. p95=200ms", value)
+	}
+	if duration, err := time.ParseDuration(max); err != nil || duration <= 0 {
+		return LatencyObjective{}, fmt.Errorf("invalid goal %q: invalid max: %s", value, max)
+	}
+	return LatencyObjective{Percentile: parsed, Max: max}, nil
+}
+
+// GetInterval returns how often SLOs are evaluated, defaulting to 10 seconds
+func (s *SLOConfig) GetInterval() time.Duration {
+	interval, err := time.ParseDuration(s.Interval)
+	if err != nil || interval <= 0 {
+		return 10 * time.Second
+	}
+	return interval
+}
+
 // Validate validates the validation configuration
 func (v *ValidationConfig) Validate() error {
 	if len(v.StatusCodes) > 0 {
@@ -197,9 +1347,43 @@ func (v *ValidationConfig) Validate() error {
 		return fmt.Errorf("min_response_size cannot be greater than max_response_size")
 	}
 
+	if v.SampleRate < 0 || v.SampleRate > 1 {
+		return fmt.Errorf("sample_rate must be between 0 and 1")
+	}
+
 	return nil
 }
 
+// IsHTTP reports whether the scenario uses the built-in HTTP protocol
+func (s *Scenario) IsHTTP() bool {
+	return isHTTPProtocol(s.Protocol)
+}
+
+// SendsHTTP reports whether any request of the scenario, its own or one of
+// its steps, uses the built-in HTTP protocol
+func (s *Scenario) SendsHTTP() bool {
+	if len(s.Steps) == 0 {
+		return s.IsHTTP()
+	}
+	for i := range s.Steps {
+		if s.Steps[i].IsHTTP(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHTTPProtocol reports whether a protocol name selects the built-in HTTP
+// protocol
+func isHTTPProtocol(name string) bool {
+	switch strings.ToLower(name) {
+	case "", "http", "https":
+		return true
+	default:
+		return false
+	}
+}
+
 // GetTimeout returns the timeout as a time.Duration
 func (s *Scenario) GetTimeout() time.Duration {
 	if s.Timeout == "" {
@@ -226,6 +1410,14 @@ func (s *Scenario) GetRetryConfig() *RetryConfig {
 	return s.Retry
 }
 
+// VariableScope returns the scope of a variable
+func (s *Scenario) VariableScope(name string) string {
+	if scope, exists := s.VariableScopes[name]; exists {
+		return scope
+	}
+	return ScopeIteration
+}
+
 // GetValidationConfig returns the validation configuration with defaults
 func (s *Scenario) GetValidationConfig() *ValidationConfig {
 	if s.Validation == nil {
@@ -235,3 +1427,35 @@ func (s *Scenario) GetValidationConfig() *ValidationConfig {
 	}
 	return s.Validation
 }
+
+// validateMethod checks the method of a request sent over HTTP when isHTTP
+// is set; other protocols define their own method semantics
+func (s *Scenario) validateMethod(method string, isHTTP bool) error {
+	validMethods := map[string]bool{
+		"GET": true, "POST": true, "PUT": true, "DELETE": true,
+		"PATCH": true, "HEAD": true, "OPTIONS": true, "TRACE": true, "CONNECT": true,
+	}
+	if isHTTP && !validMethods[method] {
+		if !s.AllowCustomMethods {
+			return fmt.Errorf("invalid HTTP method: %s (set allow_custom_methods for non-standard methods)", method)
+		}
+		if !isToken(method) {
+			return fmt.Errorf("invalid HTTP method: %q is not a valid token", method)
+		}
+	}
+	return nil
+}
+
+// isToken reports whether s is a valid HTTP token, as methods must be
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		isAlnum := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+		if !isAlnum && !strings.ContainsRune("!#$%&'*+-.^_`|~", r) {
+			return false
+		}
+	}
+	return true
+}
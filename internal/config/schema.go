@@ -0,0 +1,336 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+//go:generate go run ../../tools/schemagen -out scenario.schema.json
+
+// scenarioSchema is the JSON Schema of scenario files, generated from the
+// Scenario type; go generate keeps it up to date
+//
+//go:embed scenario.schema.json
+var scenarioSchema []byte
+
+// SchemaID identifies the scenario schema; scenario files may reference it
+// in a $schema field for editor completion
+const SchemaID = "https://github.com/alexandrehpiva/gotsunami/scenario.schema.json"
+
+// schemaEnums restricts fields to known values, by field path; * stands for
+// any key of a map
+var schemaEnums = map[string][]string{
+	"data.strategy":           {DataSequential, DataRandom, DataUnique},
+	"retry.backoff":           {"linear", "exponential", "fixed"},
+	"signing.algorithm":       {"sha256", "sha1", "sha512"},
+	"signing.encoding":        {"hex", "base64"},
+	"signing.secret_encoding": {"raw", "hex", "base64"},
+	"tenants.distribution":    {TenantRoundRobin, TenantRandom, TenantVU},
+	"variable_scopes.*":       {ScopeGlobal, ScopeVU, ScopeIteration},
+}
+
+// schemaRequired lists the fields objects must set, by field path. The
+// method and URL of a scenario may be left to its steps.
+var schemaRequired = map[string][]string{
+	"":        {"name", "base_url"},
+	"data":    {"file"},
+	"steps[]": {"method", "url"},
+}
+
+// ScenarioSchema returns the JSON Schema of scenario files
+func ScenarioSchema() []byte {
+	return scenarioSchema
+}
+
+// GenerateScenarioSchema builds the JSON Schema of scenario files from the
+// Scenario type
+func GenerateScenarioSchema() ([]byte, error) {
+	schema := typeSchema(reflect.TypeOf(Scenario{}), "")
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = SchemaID
+	schema["title"] = "GoTsunami scenario"
+	schema["properties"].(map[string]interface{})["$schema"] = map[string]interface{}{"type": "string"}
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// typeSchema describes a Go type as a JSON Schema
+func typeSchema(t reflect.Type, path string) map[string]interface{} {
+	schema := map[string]interface{}{}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem(), path)
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = typeSchema(field.Type, joinField(path, name))
+		}
+		schema["type"] = "object"
+		schema["properties"] = properties
+		schema["additionalProperties"] = false
+		if required, ok := schemaRequired[path]; ok {
+			schema["required"] = required
+		}
+	case reflect.Map:
+		schema["type"] = "object"
+		schema["additionalProperties"] = typeSchema(t.Elem(), joinField(path, "*"))
+	case reflect.Slice, reflect.Array:
+		schema["type"] = "array"
+		schema["items"] = typeSchema(t.Elem(), path+"[]")
+	case reflect.String:
+		schema["type"] = "string"
+	case reflect.Bool:
+		schema["type"] = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema["type"] = "integer"
+	case reflect.Float32, reflect.Float64:
+		schema["type"] = "number"
+	}
+
+	if values, ok := schemaEnums[path]; ok {
+		schema["enum"] = values
+	}
+	return schema
+}
+
+// joinField appends a property to a field path
+func joinField(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// SchemaError is a part of a scenario file that does not match the schema
+type SchemaError struct {
+	Line    int
+	Column  int
+	Field   string
+	Message string
+}
+
+// Error describes the mismatch with its position
+func (e SchemaError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("line %d, column %d: %s: %s", e.Line, e.Column, e.Field, e.Message)
+}
+
+// SchemaErrors lists every mismatch found in a scenario file
+type SchemaErrors []SchemaError
+
+// Error lists the mismatches, one per line
+func (e SchemaErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+var (
+	parsedSchemaOnce sync.Once
+	parsedSchema     map[string]interface{}
+)
+
+// ValidateScenarioJSON checks a scenario file against the schema. It returns
+// SchemaErrors locating every mismatch, or a SchemaError for invalid JSON.
+func ValidateScenarioJSON(data []byte) error {
+	parsedSchemaOnce.Do(func() {
+		if err := json.Unmarshal(scenarioSchema, &parsedSchema); err != nil {
+			panic(fmt.Sprintf("invalid embedded scenario schema: %v", err))
+		}
+	})
+
+	v := &schemaValidator{data: data, dec: json.NewDecoder(strings.NewReader(string(data)))}
+	v.dec.UseNumber()
+
+	if err := v.value(parsedSchema, ""); err != nil {
+		return v.syntaxError(err)
+	}
+	if _, err := v.dec.Token(); err != io.EOF {
+		return SchemaError{Line: 1, Column: 1, Message: "unexpected data after the scenario object"}
+	}
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	return nil
+}
+
+// schemaValidator walks the tokens of a document alongside the schema
+type schemaValidator struct {
+	data   []byte
+	dec    *json.Decoder
+	errors SchemaErrors
+}
+
+// position returns the line and column of the token following offset
+func (v *schemaValidator) position(offset int64) (int, int) {
+	for int(offset) < len(v.data) && strings.ContainsRune(" \t\r\n,:", rune(v.data[offset])) {
+		offset++
+	}
+
+	before := v.data[:offset]
+	line := 1 + strings.Count(string(before), "\n")
+	column := int(offset) - strings.LastIndex(string(before), "\n")
+	return line, column
+}
+
+// fail records a mismatch of the token following offset
+func (v *schemaValidator) fail(offset int64, field, format string, args ...interface{}) {
+	line, column := v.position(offset)
+	v.errors = append(v.errors, SchemaError{Line: line, Column: column, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// syntaxError locates a JSON syntax error
+func (v *schemaValidator) syntaxError(err error) error {
+	var syntax *json.SyntaxError
+	if errors.As(err, &syntax) {
+		line, column := v.position(syntax.Offset - 1)
+		return SchemaError{Line: line, Column: column, Message: syntax.Error()}
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		line, column := v.position(int64(len(v.data)))
+		return SchemaError{Line: line, Column: column, Message: "unexpected end of JSON"}
+	}
+	return err
+}
+
+// value checks the next value against schema; a nil schema accepts anything
+func (v *schemaValidator) value(schema map[string]interface{}, field string) error {
+	offset := v.dec.InputOffset()
+	token, err := v.dec.Token()
+	if err != nil {
+		return err
+	}
+
+	expected, _ := schema["type"].(string)
+	mismatch := func(actual string) bool {
+		if expected == "" || expected == actual || (expected == "number" && actual == "integer") {
+			return false
+		}
+		v.fail(offset, field, "expected %s, got %s", expected, actual)
+		return true
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '{' {
+			if mismatch("object") {
+				schema = nil
+			}
+			return v.object(schema, field, offset)
+		}
+		if mismatch("array") {
+			schema = nil
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i := 0; v.dec.More(); i++ {
+			if err := v.value(items, fmt.Sprintf("%s[%d]", field, i)); err != nil {
+				return err
+			}
+		}
+		_, err := v.dec.Token()
+		return err
+	case string:
+		if !mismatch("string") {
+			if enum, ok := schema["enum"].([]interface{}); ok && !inEnum(enum, token) {
+				v.fail(offset, field, "%q is not one of %s", token, enumList(enum))
+			}
+		}
+	case json.Number:
+		actual := "integer"
+		if strings.ContainsAny(string(token), ".eE") {
+			actual = "number"
+		}
+		mismatch(actual)
+	case bool:
+		mismatch("boolean")
+	}
+	// null leaves a field unset, whatever its type
+
+	return nil
+}
+
+// object checks the members of an object whose opening brace was read
+func (v *schemaValidator) object(schema map[string]interface{}, field string, offset int64) error {
+	properties, _ := schema["properties"].(map[string]interface{})
+	seen := make(map[string]bool)
+
+	for v.dec.More() {
+		keyOffset := v.dec.InputOffset()
+		token, err := v.dec.Token()
+		if err != nil {
+			return err
+		}
+		key := token.(string)
+		seen[key] = true
+		child := joinField(field, key)
+
+		property, known := properties[key].(map[string]interface{})
+		if !known && schema != nil {
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					v.fail(keyOffset, child, "unknown field")
+				}
+			case map[string]interface{}:
+				property = additional
+			}
+		}
+		if err := v.value(property, child); err != nil {
+			return err
+		}
+	}
+	if _, err := v.dec.Token(); err != nil {
+		return err
+	}
+
+	required, _ := schema["required"].([]interface{})
+	for _, name := range required {
+		if name, ok := name.(string); ok && !seen[name] {
+			v.fail(offset, joinField(field, name), "required field is missing")
+		}
+	}
+	return nil
+}
+
+// inEnum reports whether value is one of enum
+func inEnum(enum []interface{}, value string) bool {
+	for _, allowed := range enum {
+		if allowed == value {
+			return true
+		}
+	}
+	return false
+}
+
+// enumList formats the allowed values of a field
+func enumList(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, value := range enum {
+		values[i] = fmt.Sprint(value)
+	}
+	return strings.Join(values, ", ")
+}
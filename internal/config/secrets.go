@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Providers a secret reference reads from, written as a prefix of the
+// reference
+const (
+	// SecretEnv reads an environment variable: env:API_KEY
+	SecretEnv = "env:"
+
+	// SecretFile reads a file, without its trailing newline, relative to the
+	// scenario file: file:secrets/api_key
+	SecretFile = "file:"
+
+	// SecretVault reads a key of a HashiCorp Vault secret, at VAULT_ADDR with
+	// VAULT_TOKEN: vault:secret/data/loadtest#api_key
+	SecretVault = "vault:"
+
+	// SecretAWS reads an AWS Secrets Manager secret, or a key of its JSON
+	// value, with the credentials of the environment: aws:prod/api#api_key
+	SecretAWS = "aws:"
+)
+
+// secretProviders lists the prefixes of the supported providers
+var secretProviders = []string{SecretEnv, SecretFile, SecretVault, SecretAWS}
+
+// ParseSecret splits a secret reference into its provider and the location
+// of the secret, with the key of a Vault or AWS secret after "#"
+func ParseSecret(reference string) (provider, location, key string, err error) {
+	for _, prefix := range secretProviders {
+		if strings.HasPrefix(reference, prefix) {
+			provider, location = prefix, strings.TrimPrefix(reference, prefix)
+			break
+		}
+	}
+	if provider == "" {
+		return "", "", "", fmt.Errorf("unknown secret provider in %q (use env:, file:, vault: or aws:)", reference)
+	}
+
+	if provider == SecretVault || provider == SecretAWS {
+		location, key, _ = strings.Cut(location, "#")
+	}
+	if location == "" {
+		return "", "", "", fmt.Errorf("secret reference %q has no location", reference)
+	}
+	if provider == SecretVault && key == "" {
+		return "", "", "", fmt.Errorf("vault secret reference %q has no #key", reference)
+	}
+	return provider, location, key, nil
+}
+
+// validateSecrets checks the secret references of a scenario
+func validateSecrets(secrets map[string]string) error {
+	for name, reference := range secrets {
+		if name == "" || strings.ContainsAny(name, "{} .") {
+			return fmt.Errorf("invalid secret name %q", name)
+		}
+		if _, _, _, err := ParseSecret(reference); err != nil {
+			return fmt.Errorf("secret %s: %w", name, err)
+		}
+	}
+	return nil
+}
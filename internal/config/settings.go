@@ -0,0 +1,159 @@
+package config
+
+import "strings"
+
+// Sources of a run setting. A setting takes the value of its source of
+// highest precedence, in the order of SettingSources.
+const (
+	SourceDefault    = "default"
+	SourceConfigFile = "config"
+	SourceScenario   = "scenario"
+	SourceEnv        = "env"
+	SourceFlag       = "flag"
+)
+
+// SettingSources are the sources of run settings from lowest to highest
+// precedence: built-in defaults, the config file (.gotsunami.yaml), the
+// scenario, environment variables and command-line flags
+var SettingSources = []string{SourceDefault, SourceConfigFile, SourceScenario, SourceEnv, SourceFlag}
+
+// EnvPrefix prefixes the environment variables of settings
+const EnvPrefix = "GOTSUNAMI"
+
+// Setting is the effective value of a run setting and where it came from
+type Setting struct {
+	// Key is the setting in the config file, such as run.ramp_up
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+	// Flag and Env are the flag and environment variable setting it
+	Flag string `json:"flag,omitempty"`
+	Env  string `json:"env,omitempty"`
+}
+
+// SettingEnv returns the environment variable of a setting key, such as
+// GOTSUNAMI_RUN_RAMP_UP for run.ramp_up
+func SettingEnv(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// Overrides reports whether a value from source takes precedence over one
+// from other
+func Overrides(source, other string) bool {
+	return sourceRank(source) > sourceRank(other)
+}
+
+// sourceRank returns the position of a source in SettingSources
+func sourceRank(source string) int {
+	for i, s := range SettingSources {
+		if s == source {
+			return i
+		}
+	}
+	return -1
+}
+
+// ScenarioSettings are the run settings a scenario can also set, by name
+// within the run section: the scenario's timeout, http_version, bandwidth,
+// outfile, stages, load_pattern and validation rules
+var ScenarioSettings = []string{
+	"timeout", "http_version", "bandwidth", "outfile", "stages", "pattern",
+	"expect_status", "expect_body", "expect_body_not", "expect_response_time",
+}
+
+// RunSetting returns the value the scenario gives a run setting of
+// ScenarioSettings, reporting whether it sets one
+func (s *Scenario) RunSetting(name string) (interface{}, bool) {
+	validation := s.Validation
+	if validation == nil {
+		validation = &ValidationConfig{}
+	}
+
+	switch name {
+	case "timeout":
+		return s.Timeout, s.Timeout != ""
+	case "http_version":
+		return s.HTTPVersion, s.HTTPVersion != ""
+	case "bandwidth":
+		return s.Bandwidth, s.Bandwidth != nil
+	case "outfile":
+		return s.Outfile, s.Outfile != ""
+	case "stages":
+		return s.Stages, len(s.Stages) > 0
+	case "pattern":
+		return s.LoadPattern, s.LoadPattern != nil && len(s.LoadPattern.Phases) > 0
+	case "expect_status":
+		return validation.StatusCodes, len(validation.StatusCodes) > 0
+	case "expect_body":
+		return validation.BodyContains, len(validation.BodyContains) > 0
+	case "expect_body_not":
+		return validation.BodyNotContains, len(validation.BodyNotContains) > 0
+	case "expect_response_time":
+		return validation.ResponseTimeMax, validation.ResponseTimeMax != ""
+	}
+	return nil, false
+}
+
+// ResolveScenarioSettings settles the run settings cfg and the scenario both
+// set, given where each value of cfg came from (sources, by name within the
+// run section; missing means the default). Values from environment variables
+// and flags replace the scenario's, which replace those from the config file
+// and defaults. The loser is cleared or overwritten, so the engine only sees
+// the winner.
+func ResolveScenarioSettings(cfg *LoadTestConfig, scenario *Scenario, sources map[string]string) {
+	for _, name := range ScenarioSettings {
+		source := sources[name]
+		if source == "" {
+			source = SourceDefault
+		}
+		_, set := scenario.RunSetting(name)
+		flagWins := !set || Overrides(source, SourceScenario)
+
+		switch name {
+		case "timeout":
+			// Requests are sent with the scenario timeout
+			if flagWins && cfg.Timeout > 0 {
+				scenario.Timeout = cfg.Timeout.String()
+			} else {
+				cfg.Timeout = scenario.GetTimeout()
+			}
+		case "http_version":
+			if !flagWins {
+				cfg.HTTPVersion = scenario.HTTPVersion
+			}
+		case "bandwidth":
+			if !flagWins {
+				cfg.Bandwidth = nil
+			}
+		case "outfile":
+			if !flagWins {
+				cfg.Outfile = scenario.Outfile
+			}
+		case "stages":
+			if !flagWins {
+				cfg.Stages = nil
+			}
+		case "pattern":
+			// A scenario load pattern otherwise replaces any --pattern
+			if set && flagWins {
+				scenario.LoadPattern = nil
+			}
+		case "expect_status":
+			if !flagWins {
+				cfg.ExpectStatus = nil
+			}
+		case "expect_body":
+			if !flagWins {
+				cfg.ExpectBody = ""
+			}
+		case "expect_body_not":
+			if !flagWins {
+				cfg.ExpectBodyNot = ""
+			}
+		case "expect_response_time":
+			if !flagWins {
+				cfg.ExpectResponseTime = 0
+			}
+		}
+	}
+}
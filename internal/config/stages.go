@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StageConfig is a stage of an arrival-rate load: iterations start at a
+// rate ramping linearly from the target of the previous stage (0 before
+// the first) to Target over Duration, however long they take. A stage of
+// 0s jumps to its target.
+type StageConfig struct {
+	Duration string `json:"duration"`
+	// Target is the iteration rate reached at the end of the stage, such
+	// as "500rps", "500/s" or "30/m"; a bare number is per second
+	Target string `json:"target"`
+
+	// Name labels the stage in the per-stage breakdown of reports
+	Name string `json:"name,omitempty"`
+}
+
+// GetDuration returns the duration of the stage
+func (s *StageConfig) GetDuration() (time.Duration, error) {
+	duration, err := time.ParseDuration(s.Duration)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration: %s", s.Duration)
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("duration must be non-negative")
+	}
+	return duration, nil
+}
+
+// GetTarget returns the target rate of the stage in iterations per second
+func (s *StageConfig) GetTarget() (float64, error) {
+	return ParseRate(s.Target)
+}
+
+// ValidateStages checks the stages of an arrival-rate load, which must
+// last and reach a rate above 0
+func ValidateStages(stages []StageConfig) error {
+	var total time.Duration
+	peak := 0.0
+	for i := range stages {
+		duration, err := stages[i].GetDuration()
+		if err != nil {
+			return fmt.Errorf("stage %d: %w", i+1, err)
+		}
+		target, err := stages[i].GetTarget()
+		if err != nil {
+			return fmt.Errorf("stage %d: %w", i+1, err)
+		}
+		total += duration
+		peak = max(peak, target)
+	}
+	if total <= 0 {
+		return fmt.Errorf("stages must last longer than 0s")
+	}
+	if peak <= 0 {
+		return fmt.Errorf("stages must reach a rate above 0")
+	}
+	return nil
+}
+
+// ParseRate parses a rate such as "500rps", "500/s", "30/m" or "2/h" into
+// a rate per second; a bare number is per second
+func ParseRate(value string) (float64, error) {
+	text := strings.ToLower(strings.TrimSpace(value))
+	unit := time.Second
+	switch {
+	case strings.HasSuffix(text, "rps"):
+		text = strings.TrimSuffix(text, "rps")
+	case strings.HasSuffix(text, "/s"):
+		text = strings.TrimSuffix(text, "/s")
+	case strings.HasSuffix(text, "/m"):
+		text, unit = strings.TrimSuffix(text, "/m"), time.Minute
+	case strings.HasSuffix(text, "/h"):
+		text, unit = strings.TrimSuffix(text, "/h"), time.Hour
+	}
+
+	rate, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil || rate < 0 {
+		return 0, fmt.Errorf("invalid rate %q: use a non-negative number with rps, /s, /m or /h", value)
+	}
+	return rate / unit.Seconds(), nil
+}
+
+// ParseStageFlag parses a --stage flag, "DURATION:TARGET" such as
+// "2m:500rps"
+func ParseStageFlag(value string) (StageConfig, error) {
+	duration, target, found := strings.Cut(value, ":")
+	if !found {
+		return StageConfig{}, fmt.Errorf("invalid stage %q: use DURATION:TARGET, e.g. 2m:500rps", value)
+	}
+	stage := StageConfig{Duration: strings.TrimSpace(duration), Target: strings.TrimSpace(target)}
+	if _, err := stage.GetDuration(); err != nil {
+		return StageConfig{}, fmt.Errorf("invalid stage %q: %w", value, err)
+	}
+	if _, err := stage.GetTarget(); err != nil {
+		return StageConfig{}, fmt.Errorf("invalid stage %q: %w", value, err)
+	}
+	return stage, nil
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StepConfig is one request of a multi-step scenario, such as login, fetch,
+// update and delete. Every step of an iteration shares its variables, and
+// the headers of a step are added to the scenario's. A step without
+// validation rules is validated by the scenario's. A step may use another
+// protocol than the scenario, such as a gRPC call after a REST login; the
+// variables it extracts reach the following steps all the same.
+type StepConfig struct {
+	Name        string                 `json:"name,omitempty"`
+	Method      string                 `json:"method"`
+	URL         string                 `json:"url"`
+	Headers     map[string]string      `json:"headers,omitempty"`
+	QueryParams map[string]interface{} `json:"query_params,omitempty"`
+	Body        interface{}            `json:"body,omitempty"`
+	Validation  *ValidationConfig      `json:"validation,omitempty"`
+
+	// Extract sets variables for the following steps from the response (see
+	// ParseExtract): "token": "data.access_token", "id": "header:Location"
+	Extract map[string]string `json:"extract,omitempty"`
+
+	// Protocol sends the step with another protocol than the scenario's,
+	// such as grpc, or http in a scenario of another protocol
+	Protocol string `json:"protocol,omitempty"`
+	// ProtocolConfig holds the settings of the step's own protocol
+	ProtocolConfig map[string]interface{} `json:"protocol_config,omitempty"`
+	// BaseURL replaces the scenario base_url for this step, as the servers
+	// of different protocols usually listen on different addresses
+	BaseURL string `json:"base_url,omitempty"`
+
+	// Timeout replaces the scenario timeout, and --timeout, for this step
+	Timeout string `json:"timeout,omitempty"`
+	// Budget is the latency a response of the step should stay within;
+	// the report ranks the steps by their responses over budget
+	Budget string `json:"budget,omitempty"`
+	// Rate paces the step at that many requests per second per VU, such as
+	// polling a status at 1 while the other steps run at full speed; the
+	// VU skips the step in the iterations before it is due again
+	Rate float64 `json:"rate,omitempty"`
+}
+
+// Validate checks a step of scenario
+func (c *StepConfig) Validate(scenario *Scenario) error {
+	if c.Method == "" {
+		return fmt.Errorf("method is required")
+	}
+	if c.URL == "" {
+		return fmt.Errorf("URL is required")
+	}
+	if err := scenario.validateMethod(c.Method, c.IsHTTP(scenario)); err != nil {
+		return err
+	}
+	if c.ProtocolConfig != nil && c.SameProtocol(scenario) {
+		return fmt.Errorf("protocol_config applies to a protocol of the step's own; the step uses the scenario's protocol_config")
+	}
+
+	if c.Timeout != "" {
+		if timeout, err := time.ParseDuration(c.Timeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid timeout: %s", c.Timeout)
+		}
+	}
+
+	if c.Rate < 0 {
+		return fmt.Errorf("invalid rate: %g", c.Rate)
+	}
+
+	if c.Budget != "" {
+		if budget, err := time.ParseDuration(c.Budget); err != nil || budget <= 0 {
+			return fmt.Errorf("invalid budget: %s", c.Budget)
+		}
+	}
+
+	if err := validateExtract(c.Extract); err != nil {
+		return err
+	}
+
+	if c.Validation != nil {
+		if err := c.Validation.Validate(); err != nil {
+			return fmt.Errorf("validation config validation failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetName returns the name of the i-th step, numbered from 1 when unnamed
+func (c *StepConfig) GetName(i int) string {
+	if c.Name == "" {
+		return fmt.Sprintf("step %d", i+1)
+	}
+	return c.Name
+}
+
+// SameProtocol reports whether the step is sent with the scenario's protocol
+func (c *StepConfig) SameProtocol(scenario *Scenario) bool {
+	if c.Protocol == "" {
+		return true
+	}
+	if isHTTPProtocol(c.Protocol) {
+		return scenario.IsHTTP()
+	}
+	return strings.EqualFold(c.Protocol, scenario.Protocol)
+}
+
+// IsHTTP reports whether the step is sent with the built-in HTTP protocol
+func (c *StepConfig) IsHTTP(scenario *Scenario) bool {
+	if c.Protocol == "" {
+		return scenario.IsHTTP()
+	}
+	return isHTTPProtocol(c.Protocol)
+}
+
+// GetTimeout returns the timeout of the step: its own, or the scenario's
+func (c *StepConfig) GetTimeout(scenario *Scenario) time.Duration {
+	if timeout, err := time.ParseDuration(c.Timeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return scenario.GetTimeout()
+}
+
+// GetBaseURL returns the base URL of the step: its own, or the scenario's
+func (c *StepConfig) GetBaseURL(scenario *Scenario) string {
+	if c.BaseURL != "" {
+		return c.BaseURL
+	}
+	return scenario.BaseURL
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Timeline runs several scenarios in one test, each activating at its own
+// offset, to model composite events such as a sale starting while the
+// usual background traffic keeps flowing
+type Timeline struct {
+	Name   string          `json:"name"`
+	Phases []TimelinePhase `json:"phases"`
+
+	// VUs is the pool shared by the phases named in Mix; the run flags by
+	// default
+	VUs int `json:"vus,omitempty"`
+	// Mix moves VUs between phases as their weights change, so the traffic
+	// composition evolves within one run, such as read-heavy early and
+	// write-heavy late
+	Mix []MixStage `json:"mix,omitempty"`
+}
+
+// MixStage ramps the weights of timeline phases linearly, from those of the
+// previous stage to Weights, over Duration; the first stage starts at its
+// own weights and the last one's hold once it ends. Phases missing from a
+// stage weigh 0 in it.
+type MixStage struct {
+	Duration string             `json:"duration"`
+	Weights  map[string]float64 `json:"weights"`
+}
+
+// TimelinePhase runs one scenario for Duration, starting Start after the
+// timeline began
+type TimelinePhase struct {
+	// Name identifies the phase in logs and reports; the scenario name by default
+	Name string `json:"name,omitempty"`
+	// ScenarioFile is the scenario to run, relative to the timeline file
+	ScenarioFile string `json:"scenario"`
+	Start        string `json:"start,omitempty"`
+	Duration     string `json:"duration"`
+	// VUs and Pattern default to the run flags
+	VUs     int    `json:"vus,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+
+	// Scenario is the loaded scenario file
+	Scenario *Scenario `json:"-"`
+}
+
+// IsTimeline reports whether a JSON document is a timeline rather than a
+// scenario: its top-level object has a phases field
+func IsTimeline(data []byte) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false
+	}
+	_, exists := fields["phases"]
+	return exists
+}
+
+// LoadTimelineFromFile loads a timeline and the scenario of every phase
+func LoadTimelineFromFile(filename string) (*Timeline, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read timeline file: %w", err)
+	}
+	if data, err = NewEnvironment().InterpolateJSON(data); err != nil {
+		return nil, fmt.Errorf("failed to interpolate timeline: %w", err)
+	}
+
+	var timeline Timeline
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&timeline); err != nil {
+		return nil, fmt.Errorf("failed to parse timeline JSON: %w", err)
+	}
+
+	if err := timeline.Validate(); err != nil {
+		return nil, fmt.Errorf("timeline validation failed: %w", err)
+	}
+
+	names := make(map[string]bool, len(timeline.Phases))
+	for i := range timeline.Phases {
+		phase := &timeline.Phases[i]
+		path := phase.ScenarioFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(filename), path)
+		}
+
+		phase.Scenario, err = LoadScenarioFromFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("phase %d: failed to load scenario %s: %w", i+1, phase.ScenarioFile, err)
+		}
+		if phase.Name == "" {
+			phase.Name = phase.Scenario.Name
+		}
+		if names[phase.Name] {
+			return nil, fmt.Errorf("phase %d: duplicate phase name %q; set a distinct name", i+1, phase.Name)
+		}
+		names[phase.Name] = true
+	}
+	if err := timeline.validateMix(); err != nil {
+		return nil, err
+	}
+
+	return &timeline, nil
+}
+
+// Validate validates the timeline configuration
+func (t *Timeline) Validate() error {
+	if len(t.Phases) == 0 {
+		return fmt.Errorf("at least one phase is required")
+	}
+
+	for i, phase := range t.Phases {
+		if err := phase.Validate(); err != nil {
+			return fmt.Errorf("phase %d: %w", i+1, err)
+		}
+	}
+
+	if t.VUs < 0 {
+		return fmt.Errorf("vus must not be negative")
+	}
+	for i, stage := range t.Mix {
+		if err := stage.Validate(); err != nil {
+			return fmt.Errorf("mix stage %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// validateMix checks the mix refers to phases by name, once names are
+// resolved, and that mixed phases leave their VUs to the mix
+func (t *Timeline) validateMix() error {
+	phases := make(map[string]*TimelinePhase, len(t.Phases))
+	for i := range t.Phases {
+		phases[t.Phases[i].Name] = &t.Phases[i]
+	}
+	for i, stage := range t.Mix {
+		for name := range stage.Weights {
+			phase, exists := phases[name]
+			if !exists {
+				return fmt.Errorf("mix stage %d: unknown phase %q", i+1, name)
+			}
+			if phase.VUs > 0 {
+				return fmt.Errorf("phase %s: vus is set by the mix; remove it or the phase from the mix", name)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate validates a mix stage
+func (s *MixStage) Validate() error {
+	if duration, err := time.ParseDuration(s.Duration); err != nil || duration < 0 {
+		return fmt.Errorf("invalid duration: %q", s.Duration)
+	}
+	var total float64
+	for name, weight := range s.Weights {
+		if weight < 0 {
+			return fmt.Errorf("weight of %s must not be negative", name)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return fmt.Errorf("at least one positive weight is required")
+	}
+	return nil
+}
+
+// GetDuration returns how long the stage ramps the weights
+func (s *MixStage) GetDuration() time.Duration {
+	duration, _ := time.ParseDuration(s.Duration)
+	return duration
+}
+
+// Validate validates a timeline phase
+func (p *TimelinePhase) Validate() error {
+	if p.ScenarioFile == "" {
+		return fmt.Errorf("scenario is required")
+	}
+	if p.Start != "" {
+		if start, err := time.ParseDuration(p.Start); err != nil || start < 0 {
+			return fmt.Errorf("invalid start: %s", p.Start)
+		}
+	}
+	if duration, err := time.ParseDuration(p.Duration); err != nil || duration <= 0 {
+		return fmt.Errorf("invalid duration: %q", p.Duration)
+	}
+	if p.VUs < 0 {
+		return fmt.Errorf("vus must not be negative")
+	}
+
+	return nil
+}
+
+// GetStart returns the offset of the phase from the timeline start
+func (p *TimelinePhase) GetStart() time.Duration {
+	start, _ := time.ParseDuration(p.Start)
+	return start
+}
+
+// GetDuration returns how long the phase runs
+func (p *TimelinePhase) GetDuration() time.Duration {
+	duration, _ := time.ParseDuration(p.Duration)
+	return duration
+}
@@ -0,0 +1,176 @@
+// Package cpu finds the CPUs the process may use, such as the CPU limit of
+// its container, and measures how busy it keeps them
+package cpu
+
+import (
+	"bufio"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tune sets GOMAXPROCS to the CPU limit of the container the process runs
+// in, rounded down to at least 1. Go sizes it after the CPUs of the host
+// instead, so a container limited to 2 of 64 CPUs runs 64 threads that the
+// limit keeps throttling. An explicit GOMAXPROCS environment variable wins.
+// It returns the GOMAXPROCS in effect and the limit, 0 when there is none.
+func Tune() (procs int, limit float64) {
+	limit, found := Limit()
+	procs = runtime.GOMAXPROCS(0)
+	if !found || os.Getenv("GOMAXPROCS") != "" {
+		return procs, limit
+	}
+
+	if tuned := max(int(math.Floor(limit)), 1); tuned < procs {
+		runtime.GOMAXPROCS(tuned)
+		procs = tuned
+	}
+	return procs, limit
+}
+
+// Limit returns the CPU limit of the process's cgroup, in CPUs, and whether
+// there is one
+func Limit() (float64, bool) {
+	return CgroupLimit(os.DirFS("/"))
+}
+
+// Throttled returns how long the process's cgroup was held back by its CPU
+// limit since it started, and whether that is known
+func Throttled() (time.Duration, bool) {
+	return CgroupThrottled(os.DirFS("/"))
+}
+
+// CgroupLimit reads the CPU limit of the process's cgroup from fsys, the
+// root file system: cpu.max with cgroup v2, cpu.cfs_quota_us and
+// cpu.cfs_period_us with v1
+func CgroupLimit(fsys fs.FS) (float64, bool) {
+	for _, dir := range cgroupDirs(fsys) {
+		if dir.v2 {
+			content, err := fs.ReadFile(fsys, path.Join(dir.path, "cpu.max"))
+			if err != nil {
+				continue
+			}
+			fields := strings.Fields(string(content))
+			if len(fields) != 2 || fields[0] == "max" {
+				return 0, false
+			}
+			return quota(fields[0], fields[1])
+		}
+
+		quotaUs, err := fs.ReadFile(fsys, path.Join(dir.path, "cpu.cfs_quota_us"))
+		if err != nil {
+			continue
+		}
+		periodUs, err := fs.ReadFile(fsys, path.Join(dir.path, "cpu.cfs_period_us"))
+		if err != nil {
+			continue
+		}
+		return quota(strings.TrimSpace(string(quotaUs)), strings.TrimSpace(string(periodUs)))
+	}
+	return 0, false
+}
+
+// CgroupThrottled reads from fsys how long the process's cgroup was
+// throttled: throttled_usec of cpu.stat with cgroup v2, throttled_time
+// (nanoseconds) with v1
+func CgroupThrottled(fsys fs.FS) (time.Duration, bool) {
+	for _, dir := range cgroupDirs(fsys) {
+		file, err := fsys.Open(path.Join(dir.path, "cpu.stat"))
+		if err != nil {
+			continue
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			key, value, _ := strings.Cut(scanner.Text(), " ")
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch {
+			case dir.v2 && key == "throttled_usec":
+				return time.Duration(n) * time.Microsecond, true
+			case !dir.v2 && key == "throttled_time":
+				return time.Duration(n), true
+			}
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// cgroupDir is a directory holding the CPU controller files of a cgroup
+type cgroupDir struct {
+	path string
+	v2   bool
+}
+
+// cgroupDirs lists where the CPU controller of the process's cgroup may be,
+// most specific first. Inside a container the cgroup paths of
+// /proc/self/cgroup are often those of the host, so the root of each
+// hierarchy is tried as well.
+func cgroupDirs(fsys fs.FS) []cgroupDir {
+	content, err := fs.ReadFile(fsys, "proc/self/cgroup")
+	if err != nil {
+		return nil
+	}
+
+	var dirs []cgroupDir
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			for _, root := range []string{"sys/fs/cgroup", "sys/fs/cgroup/unified"} {
+				dirs = append(dirs,
+					cgroupDir{path: path.Join(root, parts[2]), v2: true},
+					cgroupDir{path: root, v2: true})
+			}
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "cpu" {
+				root := path.Join("sys/fs/cgroup", parts[1])
+				dirs = append(dirs,
+					cgroupDir{path: path.Join(root, parts[2])},
+					cgroupDir{path: root},
+					cgroupDir{path: path.Join("sys/fs/cgroup/cpu", parts[2])},
+					cgroupDir{path: "sys/fs/cgroup/cpu"})
+			}
+		}
+	}
+
+	// cgroup v1 controllers come first: in hybrid setups the v2 hierarchy
+	// carries no CPU controller
+	v1 := dirs[:0:0]
+	var v2 []cgroupDir
+	for _, dir := range dirs {
+		if dir.v2 {
+			v2 = append(v2, dir)
+		} else {
+			v1 = append(v1, dir)
+		}
+	}
+	return append(v1, v2...)
+}
+
+// quota divides a CPU quota by its period; a negative quota means none
+func quota(quota, period string) (float64, bool) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	return q / p, true
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package cpu
+
+import "time"
+
+// ProcessTime returns the CPU time the process used so far; it is not
+// measured on this platform
+func ProcessTime() (time.Duration, bool) {
+	return 0, false
+}
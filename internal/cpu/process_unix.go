@@ -0,0 +1,18 @@
+//go:build unix
+
+package cpu
+
+import (
+	"syscall"
+	"time"
+)
+
+// ProcessTime returns the CPU time the process used so far, user and
+// system, and whether it is known
+func ProcessTime() (time.Duration, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), true
+}
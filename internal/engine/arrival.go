@@ -0,0 +1,269 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+)
+
+// RatePattern is an arrival-rate load made of stages: iterations start at
+// a rate ramping linearly between the targets of consecutive stages,
+// however long earlier iterations take. Its intensity is the rate relative
+// to the peak target.
+type RatePattern struct {
+	Stages []RateStage `json:"stages"`
+	peak   float64
+}
+
+// RateStage is a stage of a rate pattern
+type RateStage struct {
+	Duration time.Duration `json:"duration"`
+	// Target is the rate reached at the end of the stage, in iterations
+	// per second
+	Target float64 `json:"target"`
+
+	// Name labels the stage in reports
+	Name string `json:"name,omitempty"`
+}
+
+// configStages returns the stages of a test: those given on the command
+// line, or else the scenario's
+func configStages(cfg *config.LoadTestConfig) []config.StageConfig {
+	if len(cfg.Stages) > 0 {
+		return cfg.Stages
+	}
+	if cfg.Scenario != nil {
+		return cfg.Scenario.Stages
+	}
+	return nil
+}
+
+// NewRatePattern builds a rate pattern from stages
+func NewRatePattern(stages []config.StageConfig) (*RatePattern, error) {
+	if err := config.ValidateStages(stages); err != nil {
+		return nil, err
+	}
+
+	pattern := &RatePattern{Stages: make([]RateStage, 0, len(stages))}
+	for _, stage := range stages {
+		duration, _ := stage.GetDuration()
+		target, _ := stage.GetTarget()
+		pattern.Stages = append(pattern.Stages, RateStage{Duration: duration, Target: target, Name: stage.Name})
+		pattern.peak = max(pattern.peak, target)
+	}
+	return pattern, nil
+}
+
+// Name returns the pattern name
+func (p *RatePattern) Name() string {
+	return "arrival-rate"
+}
+
+// Duration returns how long the stages last
+func (p *RatePattern) Duration() time.Duration {
+	var total time.Duration
+	for _, stage := range p.Stages {
+		total += stage.Duration
+	}
+	return total
+}
+
+// Peak returns the highest target, in iterations per second
+func (p *RatePattern) Peak() float64 {
+	return p.peak
+}
+
+// Rate returns the iteration rate at elapsed, 0 once the stages are over
+func (p *RatePattern) Rate(elapsed time.Duration) float64 {
+	var start time.Duration
+	previous := 0.0
+	for _, stage := range p.Stages {
+		if elapsed < start+stage.Duration {
+			progress := float64(elapsed-start) / float64(stage.Duration)
+			return previous + (stage.Target-previous)*progress
+		}
+		start += stage.Duration
+		previous = stage.Target
+	}
+	return 0
+}
+
+// Intensity returns the rate at elapsed relative to the peak target
+func (p *RatePattern) Intensity(elapsed time.Duration) float64 {
+	if p.peak <= 0 {
+		return 0
+	}
+	return p.Rate(elapsed) / p.peak
+}
+
+// Stage returns the index of the stage active at elapsed
+func (p *RatePattern) Stage(elapsed time.Duration) int {
+	var start time.Duration
+	for i, stage := range p.Stages {
+		start += stage.Duration
+		if elapsed < start {
+			return i
+		}
+	}
+	return -1
+}
+
+// Arrivals returns how many iterations start during the stages
+func (p *RatePattern) Arrivals() float64 {
+	total := 0.0
+	previous := 0.0
+	for _, stage := range p.Stages {
+		total += (previous + stage.Target) / 2 * stage.Duration.Seconds()
+		previous = stage.Target
+	}
+	return total
+}
+
+// describeStages names the stages of a summary after the stages of the
+// pattern, with their offset, duration, target rate and throughput
+func (p *RatePattern) describeStages(stages []*metrics.StageSummary, elapsed time.Duration) {
+	starts := make([]time.Duration, len(p.Stages))
+	var start time.Duration
+	for i, stage := range p.Stages {
+		starts[i] = start
+		start += stage.Duration
+	}
+
+	for _, summary := range stages {
+		if summary.Stage >= len(p.Stages) {
+			continue
+		}
+		stage := p.Stages[summary.Stage]
+		summary.Name = stage.Name
+		summary.Start = starts[summary.Stage].String()
+		summary.Duration = stage.Duration.String()
+		summary.TargetRPS = stage.Target
+		if p.peak > 0 {
+			summary.Intensity = stage.Target / p.peak
+		}
+
+		// A stage cut short by the end of the test ran for less
+		ran := min(stage.Duration, elapsed-starts[summary.Stage])
+		if ran > 0 {
+			summary.RequestsPerSecond = float64(summary.Requests) / ran.Seconds()
+		}
+	}
+}
+
+// arrivalTime returns when the stages have started n iterations, solving
+// the linear ramp of the stage it falls in, or false when they end first
+func (p *RatePattern) arrivalTime(n float64) (time.Duration, bool) {
+	var start time.Duration
+	count := 0.0
+	previous := 0.0
+	for _, stage := range p.Stages {
+		seconds := stage.Duration.Seconds()
+		arrivals := (previous + stage.Target) / 2 * seconds
+		if n < count+arrivals {
+			// previous*t + slope/2*t² = n - count
+			remaining := n - count
+			slope := (stage.Target - previous) / seconds
+			var t float64
+			if math.Abs(slope) < 1e-12 {
+				t = remaining / previous
+			} else {
+				t = (-previous + math.Sqrt(previous*previous+2*slope*remaining)) / slope
+			}
+			return start + time.Duration(t*float64(time.Second)), true
+		}
+		count += arrivals
+		start += stage.Duration
+		previous = stage.Target
+	}
+	return 0, false
+}
+
+// arrivals starts the iterations of a rate pattern: each arrival hands a
+// ticket to an idle worker, or is dropped when every worker is busy
+type arrivals struct {
+	pattern *RatePattern
+	tickets chan struct{}
+
+	started int64
+	dropped int64
+}
+
+// newArrivals creates the arrivals of a rate pattern, or returns nil for
+// any other pattern
+func newArrivals(pattern LoadPattern) *arrivals {
+	rate, ok := pattern.(*RatePattern)
+	if !ok {
+		return nil
+	}
+	return &arrivals{pattern: rate, tickets: make(chan struct{})}
+}
+
+// run hands out tickets on schedule from start until the stages end or ctx
+// is done. Arrivals sit in the middle of their share of the rate, and late
+// ones are handed out at once, so the count stays on schedule.
+func (a *arrivals) run(ctx context.Context, start time.Time) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	for n := 0.5; ; n++ {
+		at, ok := a.pattern.arrivalTime(n)
+		if !ok {
+			return
+		}
+		if wait := time.Until(start.Add(at)); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case a.tickets <- struct{}{}:
+			atomic.AddInt64(&a.started, 1)
+		default:
+			atomic.AddInt64(&a.dropped, 1)
+		}
+	}
+}
+
+// wait blocks a worker until its next iteration may start, and reports
+// whether it should keep going
+func (a *arrivals) wait(ctx context.Context, stop <-chan struct{}) bool {
+	select {
+	case <-a.tickets:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-stop:
+		return false
+	}
+}
+
+// counts returns the arrivals handed to a worker and those no worker was
+// free to start
+func (a *arrivals) counts() (started, dropped int64) {
+	if a == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&a.started), atomic.LoadInt64(&a.dropped)
+}
+
+// validateArrivals rejects settings that make no sense when iterations
+// start at a rate
+func validateArrivals(cfg *config.LoadTestConfig) error {
+	if cfg.Delay > 0 {
+		return fmt.Errorf("stages set the iteration rate; --delay does not apply")
+	}
+	return nil
+}
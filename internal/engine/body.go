@@ -0,0 +1,213 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"mime"
+	"net/url"
+	"strings"
+
+	"github.com/alexandredias/gotsunami/pkg/templates"
+)
+
+const (
+	contentTypeJSON = "application/json"
+	contentTypeForm = "application/x-www-form-urlencoded"
+	contentTypeText = "text/plain; charset=utf-8"
+)
+
+// requestBody encodes the scenario body for each request. Raw strings are
+// sent untouched; objects and arrays are encoded according to the scenario
+// Content-Type, JSON by default.
+type requestBody struct {
+	raw         string
+	value       interface{}
+	form        bool
+	contentType string
+
+	// template is the compiled raw body. compiled is value with its
+	// templated strings compiled; when it has none, static holds the
+	// body encoded once.
+	template *templates.Template
+	compiled interface{}
+	static   []byte
+}
+
+// newRequestBody prepares the scenario body for encoding. contentType is the
+// Content-Type header configured in the scenario, if any.
+func newRequestBody(body interface{}, contentType string) (*requestBody, error) {
+	b := &requestBody{}
+
+	switch v := body.(type) {
+	case nil:
+		return b, nil
+	case string:
+		b.raw = v
+		if contentType == "" && v != "" {
+			b.contentType = contentTypeText
+			if trimmed := strings.TrimSpace(v); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+				b.contentType = contentTypeJSON
+			}
+		}
+		template, err := templates.Compile(v)
+		if err != nil {
+			return nil, err
+		}
+		b.template = template
+		return b, nil
+	}
+
+	b.value = body
+	if contentType == "" {
+		b.contentType = contentTypeJSON
+	} else {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Content-Type %q: %w", contentType, err)
+		}
+		switch {
+		case mediaType == contentTypeForm:
+			if _, ok := body.(map[string]interface{}); !ok {
+				return nil, fmt.Errorf("a form body must be an object")
+			}
+			b.form = true
+		case mediaType == contentTypeJSON || strings.HasSuffix(mediaType, "+json"):
+		default:
+			return nil, fmt.Errorf("cannot encode a structured body as %s; use a string body instead", mediaType)
+		}
+	}
+
+	// Encoding once up front catches values JSON cannot represent
+	encoded, err := b.encode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	templated := false
+	b.compiled, err = compileValue(body, &templated)
+	if err != nil {
+		return nil, err
+	}
+	if !templated {
+		b.static, b.compiled = encoded, nil
+	}
+	return b, nil
+}
+
+// Encode expands templates and returns the body of a single request
+func (b *requestBody) Encode(vars map[string]string, rng *rand.Rand) ([]byte, error) {
+	if b.value == nil {
+		if b.raw == "" {
+			return nil, nil
+		}
+		body, err := b.template.Expand(vars, rng)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(body), nil
+	}
+	if b.static != nil {
+		// A copy, since the request may be changed by hooks and plugins
+		return append([]byte(nil), b.static...), nil
+	}
+
+	// Templates are expanded inside the values so their output is escaped
+	expanded, err := expandValue(b.compiled, vars, rng)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.encode(expanded)
+}
+
+// ContentType returns the Content-Type to send when the scenario sets none
+func (b *requestBody) ContentType() string {
+	return b.contentType
+}
+
+// encode serializes a structured body
+func (b *requestBody) encode(value interface{}) ([]byte, error) {
+	if !b.form {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode body: %w", err)
+		}
+		return data, nil
+	}
+
+	fields := value.(map[string]interface{})
+	form := url.Values{}
+	for _, key := range sortedKeys(fields) {
+		values, ok := fields[key].([]interface{})
+		if !ok {
+			values = []interface{}{fields[key]}
+		}
+		for _, v := range values {
+			switch v.(type) {
+			case map[string]interface{}, []interface{}:
+				return nil, fmt.Errorf("form field %s must be a scalar or a list of scalars", key)
+			}
+			form.Add(key, fmt.Sprint(v))
+		}
+	}
+
+	return []byte(form.Encode()), nil
+}
+
+// compileValue returns a copy of a decoded JSON value with every templated
+// string replaced by its compiled template, setting templated when it finds
+// one
+func compileValue(value interface{}, templated *bool) (interface{}, error) {
+	return walkValues(value, func(value interface{}) (interface{}, error) {
+		s, ok := value.(string)
+		if !ok {
+			return value, nil
+		}
+		template, err := templates.Compile(s)
+		if err != nil || template.Static() {
+			return s, err
+		}
+		*templated = true
+		return template, nil
+	})
+}
+
+// expandValue returns a copy of a compiled value with its templates expanded
+func expandValue(value interface{}, vars map[string]string, rng *rand.Rand) (interface{}, error) {
+	return walkValues(value, func(value interface{}) (interface{}, error) {
+		if template, ok := value.(*templates.Template); ok {
+			return template.Expand(vars, rng)
+		}
+		return value, nil
+	})
+}
+
+// walkValues rebuilds a decoded JSON value, replacing every value that is
+// not an object or an array with the result of fn
+func walkValues(value interface{}, fn func(interface{}) (interface{}, error)) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for _, key := range sortedKeys(v) {
+			expanded, err := walkValues(v[key], fn)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = expanded
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			expanded, err := walkValues(item, fn)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = expanded
+		}
+		return out, nil
+	default:
+		return fn(value)
+	}
+}
@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"net/http"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+)
+
+// maxCachedURLs bounds the validators a virtual user remembers, for
+// scenarios whose URLs change on every request
+const maxCachedURLs = 1000
+
+// cacheValidators are the response headers used to revalidate a URL
+type cacheValidators struct {
+	etag         string
+	lastModified string
+}
+
+// validatorCache remembers the validators of the URLs one virtual user
+// fetched and turns repeat requests into conditional ones
+type validatorCache struct {
+	config *config.CacheConfig
+	urls   map[string]cacheValidators
+}
+
+// newValidatorCache returns a cache for one virtual user, or nil when
+// conditional requests are disabled
+func newValidatorCache(cfg *config.CacheConfig) *validatorCache {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &validatorCache{config: cfg, urls: make(map[string]cacheValidators)}
+}
+
+// apply adds conditional headers to a GET or HEAD request for a URL
+// fetched before, unless the scenario already sets them
+func (c *validatorCache) apply(req *protocols.Request) {
+	if c == nil || !cacheable(req.Method) {
+		return
+	}
+
+	validators, exists := c.urls[req.URL]
+	if !exists {
+		return
+	}
+	if c.config.ETag && validators.etag != "" {
+		setDefaultHeader(req, "If-None-Match", validators.etag)
+	}
+	if c.config.LastModified && validators.lastModified != "" {
+		setDefaultHeader(req, "If-Modified-Since", validators.lastModified)
+	}
+}
+
+// store remembers the validators of a full response
+func (c *validatorCache) store(req *protocols.Request, resp *protocols.Response) {
+	if c == nil || !cacheable(req.Method) || resp.Error != nil || resp.StatusCode != http.StatusOK {
+		return
+	}
+
+	_, etag := findHeader(resp.Headers, "ETag")
+	_, lastModified := findHeader(resp.Headers, "Last-Modified")
+	if etag == "" && lastModified == "" {
+		return
+	}
+
+	if len(c.urls) >= maxCachedURLs {
+		c.urls = make(map[string]cacheValidators)
+	}
+	c.urls[req.URL] = cacheValidators{etag: etag, lastModified: lastModified}
+}
+
+// cacheable reports whether conditional requests apply to a method
+func cacheable(method string) bool {
+	return method == "" || method == http.MethodGet || method == http.MethodHead
+}
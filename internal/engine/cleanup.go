@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/alexandredias/gotsunami/pkg/templates"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// resourceTracker remembers resources created during the test so they can
+// be deleted afterwards
+type resourceTracker struct {
+	config *config.CleanupConfig
+	mu     sync.Mutex
+	ids    []string
+}
+
+// newResourceTracker returns a tracker, or nil when cleanup is not configured
+func newResourceTracker(cfg *config.CleanupConfig) *resourceTracker {
+	if cfg == nil {
+		return nil
+	}
+	return &resourceTracker{config: cfg}
+}
+
+// capture records the resource ID found in a successful response
+func (t *resourceTracker) capture(resp *protocols.Response) {
+	if t == nil || resp == nil || resp.Error != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return
+	}
+
+	result := gjson.GetBytes(resp.Body, t.config.Capture)
+	if !result.Exists() || result.String() == "" {
+		return
+	}
+
+	t.mu.Lock()
+	t.ids = append(t.ids, result.String())
+	t.mu.Unlock()
+}
+
+// runCleanup deletes captured resources at the configured rate, giving up
+// when the cleanup timeout expires
+func (e *LoadEngine) runCleanup() *metrics.CleanupSummary {
+	tracker := e.resources
+	if tracker == nil {
+		return nil
+	}
+
+	tracker.mu.Lock()
+	ids := tracker.ids
+	tracker.ids = nil
+	tracker.mu.Unlock()
+
+	cfg := tracker.config
+	summary := &metrics.CleanupSummary{Captured: len(ids)}
+	if len(ids) == 0 {
+		return summary
+	}
+
+	logrus.Infof("Cleaning up %d created resources at %.0f req/s", len(ids), cfg.GetRate())
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.GetTimeout())
+	defer cancel()
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.GetRate()))
+	defer ticker.Stop()
+
+	rng := e.VURand(0)
+	variables := make(map[string]string, len(e.globals)+1)
+	for key, value := range e.globals {
+		variables[key] = value
+	}
+
+	for i, id := range ids {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+			case <-ticker.C:
+			}
+		}
+		if ctx.Err() != nil {
+			summary.Remaining = len(ids) - i
+			logrus.Warnf("Cleanup timed out with %d resources left", summary.Remaining)
+			break
+		}
+
+		variables[cfg.GetVariable()] = id
+		if err := e.deleteResource(ctx, variables, rng); err != nil {
+			summary.Failed++
+			logrus.WithError(err).Debugf("Failed to clean up resource %s", id)
+			continue
+		}
+		summary.Deleted++
+	}
+
+	summary.Duration = time.Since(start).String()
+	logrus.Infof("Cleanup finished: %d deleted, %d failed, %d remaining",
+		summary.Deleted, summary.Failed, summary.Remaining)
+
+	return summary
+}
+
+// deleteResource sends one cleanup request
+func (e *LoadEngine) deleteResource(ctx context.Context, variables map[string]string, rng *rand.Rand) error {
+	cfg := e.resources.config
+
+	url, err := templates.ExpandRand(cfg.URL, variables, rng)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(url, "://") {
+		url = e.scenario.BaseURL + url
+	}
+
+	headers := make(map[string]string, len(cfg.Headers))
+	for key, value := range cfg.Headers {
+		if headers[key], err = templates.ExpandRand(value, variables, rng); err != nil {
+			return err
+		}
+	}
+
+	req := &protocols.Request{
+		Method:  cfg.GetMethod(),
+		URL:     url,
+		Headers: headers,
+		Timeout: e.scenario.GetTimeout(),
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, req.Timeout)
+	defer cancel()
+
+	resp, err := e.protocol.Execute(reqCtx, req)
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode != 404 {
+		return fmt.Errorf("cleanup returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxConsistencyURLs bounds the URLs compared, for scenarios whose URLs
+	// change on every request; later URLs are not compared
+	maxConsistencyURLs = 10000
+	// maxBodyVariants bounds the distinct bodies kept per URL; further
+	// ones are counted together
+	maxBodyVariants = 10
+	// maxReportedURLs bounds the inconsistent URLs listed in the summary
+	maxReportedURLs = 20
+)
+
+// otherVariants counts the bodies of a URL beyond maxBodyVariants
+const otherVariants = "other"
+
+// consistencyTracker hashes response bodies per URL and remembers every
+// distinct body each URL returned
+type consistencyTracker struct {
+	statuses map[int]bool
+	ignore   [][]string
+
+	mu        sync.Mutex
+	responses int64
+	urls      map[string]map[string]int64
+}
+
+// newConsistencyTracker returns a tracker, or nil when responses are not
+// compared
+func newConsistencyTracker(cfg *config.ConsistencyConfig) *consistencyTracker {
+	if cfg == nil {
+		return nil
+	}
+
+	tracker := &consistencyTracker{
+		statuses: make(map[int]bool),
+		urls:     make(map[string]map[string]int64),
+	}
+	for _, status := range cfg.GetStatuses() {
+		tracker.statuses[status] = true
+	}
+	for _, path := range cfg.Ignore {
+		tracker.ignore = append(tracker.ignore, strings.Split(path, "."))
+	}
+	return tracker
+}
+
+// observe hashes the body of a GET response
+func (t *consistencyTracker) observe(req *protocols.Request, resp *protocols.Response) {
+	if t == nil || resp == nil || resp.Error != nil || !t.statuses[resp.StatusCode] {
+		return
+	}
+	if req.Method != "" && req.Method != http.MethodGet {
+		return
+	}
+
+	hash := t.hash(resp.Body)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	variants, exists := t.urls[req.URL]
+	if !exists {
+		if len(t.urls) >= maxConsistencyURLs {
+			return
+		}
+		variants = make(map[string]int64)
+		t.urls[req.URL] = variants
+	}
+	t.responses++
+
+	if _, known := variants[hash]; !known {
+		if len(variants) >= maxBodyVariants {
+			hash = otherVariants
+		} else if len(variants) == 1 {
+			logrus.Debugf("%s returned a different body (%s)", req.URL, hash)
+		}
+	}
+	variants[hash]++
+}
+
+// hash identifies a body, leaving out the ignored JSON fields
+func (t *consistencyTracker) hash(body []byte) string {
+	if len(t.ignore) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+
+		var document interface{}
+		if err := decoder.Decode(&document); err == nil {
+			for _, path := range t.ignore {
+				removeField(document, path)
+			}
+			// Map keys are sorted, so equal documents hash the same
+			if canonical, err := json.Marshal(document); err == nil {
+				body = canonical
+			}
+		}
+	}
+
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:8])
+}
+
+// removeField deletes a field from a decoded JSON document, in every
+// element of the arrays the path crosses
+func removeField(document interface{}, path []string) {
+	switch value := document.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			delete(value, path[0])
+			return
+		}
+		if child, exists := value[path[0]]; exists {
+			removeField(child, path[1:])
+		}
+	case []interface{}:
+		for _, element := range value {
+			removeField(element, path)
+		}
+	}
+}
+
+// summary reports the URLs compared so far, the inconsistent ones with the
+// most variants first
+func (t *consistencyTracker) summary() *metrics.ConsistencySummary {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	summary := &metrics.ConsistencySummary{Checked: int64(len(t.urls)), Responses: t.responses}
+	for url, variants := range t.urls {
+		if len(variants) < 2 {
+			continue
+		}
+		summary.Inconsistent++
+
+		copied := make(map[string]int64, len(variants))
+		for hash, count := range variants {
+			copied[hash] = count
+		}
+		summary.URLs = append(summary.URLs, metrics.InconsistentURL{URL: url, Variants: copied})
+	}
+
+	sort.Slice(summary.URLs, func(i, j int) bool {
+		a, b := summary.URLs[i], summary.URLs[j]
+		if len(a.Variants) != len(b.Variants) {
+			return len(a.Variants) > len(b.Variants)
+		}
+		return a.URL < b.URL
+	})
+	if len(summary.URLs) > maxReportedURLs {
+		summary.URLs = summary.URLs[:maxReportedURLs]
+	}
+	return summary
+}
@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/cpu"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+)
+
+const (
+	// cpuWindow is how often the generator's CPU use is sampled
+	cpuWindow = time.Second
+	// cpuSaturation is the share of its CPUs the generator must keep busy
+	// for a window to count as saturated
+	cpuSaturation = 0.9
+	// cpuSaturatedShare is the share of saturated windows, or of the test
+	// spent throttled, above which the report warns the generator was the
+	// bottleneck
+	cpuSaturatedShare = 0.1
+)
+
+// cpuMonitor samples how busy the generator keeps the CPUs it may use, so
+// a report can tell a slow target from a saturated load generator
+type cpuMonitor struct {
+	procs int
+	limit float64
+
+	mu             sync.Mutex
+	start          time.Time
+	startCPU       time.Duration
+	startThrottled time.Duration
+	throttled      bool
+	windows        int
+	saturated      int
+	peak           float64
+}
+
+// newCPUMonitor creates a monitor, or returns nil when the CPU time of the
+// process cannot be measured on this platform
+func newCPUMonitor() *cpuMonitor {
+	used, ok := cpu.ProcessTime()
+	if !ok {
+		return nil
+	}
+	limit, _ := cpu.Limit()
+	m := &cpuMonitor{procs: runtime.GOMAXPROCS(0), limit: limit, start: time.Now(), startCPU: used}
+	m.startThrottled, m.throttled = cpu.Throttled()
+	return m
+}
+
+// capacity returns the CPUs the generator can keep busy: GOMAXPROCS, or the
+// container limit when lower
+func (m *cpuMonitor) capacity() float64 {
+	if m.limit > 0 && m.limit < float64(m.procs) {
+		return m.limit
+	}
+	return float64(m.procs)
+}
+
+// run samples the CPU use every window until ctx is done
+func (m *cpuMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(cpuWindow)
+	defer ticker.Stop()
+
+	last, lastCPU := m.start, m.startCPU
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			used, ok := cpu.ProcessTime()
+			if !ok {
+				return
+			}
+			usage := float64(used-lastCPU) / float64(now.Sub(last)) / m.capacity()
+			last, lastCPU = now, used
+
+			m.mu.Lock()
+			m.windows++
+			if usage >= cpuSaturation {
+				m.saturated++
+			}
+			m.peak = max(m.peak, usage)
+			m.mu.Unlock()
+		}
+	}
+}
+
+// summary describes the CPU use of the generator since the monitor started,
+// warning when it was saturated or throttled for a significant share of it
+func (m *cpuMonitor) summary() *metrics.GeneratorSummary {
+	if m == nil {
+		return nil
+	}
+	used, _ := cpu.ProcessTime()
+	elapsed := time.Since(m.start)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	summary := &metrics.GeneratorSummary{
+		GOMAXPROCS: m.procs,
+		CPULimit:   m.limit,
+		CPUUsage:   100 * float64(used-m.startCPU) / float64(elapsed) / m.capacity(),
+		PeakUsage:  100 * m.peak,
+	}
+	if m.saturated > 0 {
+		summary.SaturatedTime = (time.Duration(m.saturated) * cpuWindow).String()
+	}
+
+	var throttled time.Duration
+	if m.throttled {
+		if total, ok := cpu.Throttled(); ok && total > m.startThrottled {
+			throttled = total - m.startThrottled
+			summary.Throttled = throttled.Round(time.Millisecond).String()
+		}
+	}
+
+	switch {
+	case m.windows > 0 && float64(m.saturated)/float64(m.windows) >= cpuSaturatedShare:
+		summary.Warning = fmt.Sprintf("the load generator kept its %.4g CPUs over %.0f%% busy for %s of the test; "+
+			"latency and throughput may reflect the generator rather than the target", m.capacity(), 100*cpuSaturation, summary.SaturatedTime)
+	case elapsed > 0 && float64(throttled)/float64(elapsed) >= cpuSaturatedShare:
+		summary.Warning = fmt.Sprintf("the container CPU limit throttled the load generator for %s; "+
+			"latency and throughput may reflect the generator rather than the target", summary.Throttled)
+	}
+	return summary
+}
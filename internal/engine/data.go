@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+)
+
+// dataVariable prefixes the columns of the data file in templates
+const dataVariable = "csv."
+
+// dataFeed hands out the CSV row each iteration reads; a nil feed hands out
+// none
+type dataFeed struct {
+	// rows hold the variables of each row, by csv.COLUMN
+	rows     []map[string]string
+	strategy string
+	next     uint64
+
+	// cumulative holds the running total of the row weights, when rows
+	// are weighed
+	cumulative []float64
+}
+
+// newDataFeed loads the data file of a scenario, or returns nil when
+// iterations are not fed data
+func newDataFeed(cfg *config.DataConfig) (*dataFeed, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	delimiter, err := cfg.GetDelimiter()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := readDataRows(cfg.File, delimiter)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no rows found in data file %s", cfg.File)
+	}
+
+	strategy := cfg.Strategy
+	if strategy == "" {
+		strategy = config.DataSequential
+	}
+	feed := &dataFeed{rows: rows, strategy: strategy}
+	if cfg.Weight != "" {
+		if feed.cumulative, err = weighRows(rows, cfg.Weight); err != nil {
+			return nil, err
+		}
+	}
+	return feed, nil
+}
+
+// weighRows returns the running total of the weights of the rows, read
+// from column
+func weighRows(rows []map[string]string, column string) ([]float64, error) {
+	cumulative := make([]float64, len(rows))
+	total := 0.0
+	for i, row := range rows {
+		value, exists := row[dataVariable+column]
+		if !exists {
+			return nil, fmt.Errorf("weight column %s not found in data file", column)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q in row %d of the data file", value, i+1)
+		}
+		total += weight
+		cumulative[i] = total
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("every row of the data file weighs 0")
+	}
+	return cumulative, nil
+}
+
+// readDataRows reads a CSV file whose header row names the columns,
+// skipping blank lines
+func readDataRows(path string, delimiter rune) ([]map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comma = delimiter
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data file header: %w", err)
+	}
+	columns := make([]string, len(header))
+	for i, name := range header {
+		columns[i] = strings.TrimSpace(name)
+		if columns[i] == "" {
+			return nil, fmt.Errorf("column %d of the data file has no name", i+1)
+		}
+	}
+
+	var rows []map[string]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read data file: %w", err)
+		}
+
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			row[dataVariable+column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// pick returns the row of the next iteration, or false once a unique feed
+// has handed out every row
+func (f *dataFeed) pick(rng *rand.Rand) (map[string]string, bool) {
+	if f == nil {
+		return nil, true
+	}
+
+	switch f.strategy {
+	case config.DataRandom:
+		return f.random(rng), true
+	case config.DataUnique:
+		next := atomic.AddUint64(&f.next, 1) - 1
+		if next >= uint64(len(f.rows)) {
+			return nil, false
+		}
+		return f.rows[next], true
+	default:
+		next := atomic.AddUint64(&f.next, 1) - 1
+		return f.rows[next%uint64(len(f.rows))], true
+	}
+}
+
+// sample returns a row at random without handing it out, for requests sent
+// outside the iterations such as preflight
+func (f *dataFeed) sample(rng *rand.Rand) map[string]string {
+	if f == nil {
+		return nil
+	}
+	return f.random(rng)
+}
+
+// random returns a row at random, in proportion to its weight when rows
+// are weighed
+func (f *dataFeed) random(rng *rand.Rand) map[string]string {
+	if f.cumulative == nil {
+		return f.rows[rng.Intn(len(f.rows))]
+	}
+	target := rng.Float64() * f.cumulative[len(f.cumulative)-1]
+	return f.rows[sort.Search(len(f.cumulative), func(i int) bool { return f.cumulative[i] > target })]
+}
@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+)
+
+// endpointNamer names the logical endpoint of each request, so metrics
+// aggregate by endpoint rather than by parameterized URL; a nil namer leaves
+// requests ungrouped
+type endpointNamer struct {
+	group     string
+	templates []string
+}
+
+// newEndpointNamer returns a namer, or nil when the scenario sets neither a
+// group, URL templates nor steps
+func newEndpointNamer(scenario *config.Scenario) *endpointNamer {
+	if scenario.Group == "" && len(scenario.URLTemplates) == 0 && len(scenario.Steps) == 0 {
+		return nil
+	}
+	return &endpointNamer{group: scenario.Group, templates: scenario.URLTemplates}
+}
+
+// name returns the endpoint of req, sent for the named step of a chain:
+// the step name, or the scenario group, or the method with the first URL
+// template the path matches, or else the path with its identifiers
+// normalized. Without a request, as when its template failed, only the step
+// or group is known.
+func (n *endpointNamer) name(req *protocols.Request, step string) string {
+	if n == nil {
+		return ""
+	}
+	if step != "" {
+		return step
+	}
+	if n.group != "" || req == nil {
+		return n.group
+	}
+
+	path := req.URL
+	if u, err := url.Parse(req.URL); err == nil {
+		path = u.Path
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	method := strings.ToUpper(req.Method)
+	for _, template := range n.templates {
+		if config.MatchURLTemplate(template, path) {
+			return method + " " + template
+		}
+	}
+	return method + " " + config.NormalizePath(path)
+}
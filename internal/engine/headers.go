@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+)
+
+// capturedHeader is a response header whose values break responses down
+type capturedHeader struct {
+	name string
+	// regex reduces values to their first capture group, or whole match,
+	// when set; values it does not match count as missing
+	regex *regexp.Regexp
+}
+
+// newCapturedHeaders returns the headers a scenario captures, once each
+func newCapturedHeaders(scenario *config.Scenario) ([]capturedHeader, error) {
+	var headers []capturedHeader
+	for _, capture := range scenario.CaptureHeaders {
+		name, regex, err := config.ParseCaptureHeader(capture)
+		if err != nil {
+			return nil, err
+		}
+
+		duplicate := false
+		for _, header := range headers {
+			duplicate = duplicate || strings.EqualFold(header.name, name)
+		}
+		if !duplicate {
+			headers = append(headers, capturedHeader{name: name, regex: regex})
+		}
+	}
+	return headers, nil
+}
+
+// value returns the value of the header reported for resp
+func (h capturedHeader) value(resp *protocols.Response) string {
+	name, value := findHeader(resp.Headers, h.name)
+	if name == "" {
+		return metrics.MissingHeader
+	}
+	if h.regex == nil {
+		return value
+	}
+
+	match := h.regex.FindStringSubmatch(value)
+	switch {
+	case match == nil:
+		return metrics.MissingHeader
+	case len(match) > 1:
+		return match[1]
+	default:
+		return match[0]
+	}
+}
+
+// RecordHeaders adds a response to the breakdown of each captured header by
+// value; requests that got no response are only in the totals
+func (e *LoadEngine) RecordHeaders(resp *protocols.Response, passed bool) {
+	if len(e.capturedHeaders) == 0 || resp.TransportError() {
+		return
+	}
+
+	values := make(map[string]string, len(e.capturedHeaders))
+	for _, header := range e.capturedHeaders {
+		values[header.name] = header.value(resp)
+	}
+	e.collector.RecordHeaders(values, resp, passed)
+}
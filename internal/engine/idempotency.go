@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"sync/atomic"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// idempotencyTracker counts operations sent with an idempotency key and the
+// duplicate resources they revealed
+type idempotencyTracker struct {
+	config *config.IdempotencyConfig
+	retry  *config.RetryConfig
+
+	operations int64
+	retries    int64
+	replays    int64
+	checked    int64
+	duplicates int64
+}
+
+// newIdempotencyTracker returns a tracker, or nil when idempotency keys are
+// not configured
+func newIdempotencyTracker(scenario *config.Scenario) *idempotencyTracker {
+	if scenario.Idempotency == nil {
+		return nil
+	}
+	return &idempotencyTracker{config: scenario.Idempotency, retry: scenario.GetRetryConfig()}
+}
+
+// summary reports the operations tracked so far
+func (t *idempotencyTracker) summary() *metrics.IdempotencySummary {
+	if t == nil {
+		return nil
+	}
+
+	return &metrics.IdempotencySummary{
+		Operations: atomic.LoadInt64(&t.operations),
+		Retries:    atomic.LoadInt64(&t.retries),
+		Replays:    atomic.LoadInt64(&t.replays),
+		Checked:    atomic.LoadInt64(&t.checked),
+		Duplicates: atomic.LoadInt64(&t.duplicates),
+	}
+}
+
+// operation follows the attempts of one logical operation
+type operation struct {
+	key       string
+	capture   string
+	id        string
+	ids       int
+	duplicate bool
+}
+
+// observe compares the resource returned by an attempt with earlier ones
+func (o *operation) observe(resp *protocols.Response) {
+	if o.capture == "" || !succeeded(resp) {
+		return
+	}
+
+	result := gjson.GetBytes(resp.Body, o.capture)
+	if !result.Exists() || result.String() == "" {
+		return
+	}
+
+	o.ids++
+	if o.id == "" {
+		o.id = result.String()
+	} else if result.String() != o.id && !o.duplicate {
+		o.duplicate = true
+		logrus.Debugf("Idempotency key %s returned resources %s and %s", o.key, o.id, result.String())
+	}
+}
+
+// sendIdempotent sends an operation under an idempotency key, retrying
+// failed attempts and replaying some successful ones with the same key.
+// Only operations with a key are retried: without one, a retry of a request
+// the target did process would create a duplicate.
+func (w *Worker) sendIdempotent(req *protocols.Request, requestNum int, requestID string) {
+	tracker := w.engine.idempotency
+	setDefaultHeader(req, tracker.config.GetHeader(), requestID)
+	atomic.AddInt64(&tracker.operations, 1)
+
+	op := &operation{key: req.Headers[tracker.config.GetHeader()], capture: tracker.config.Capture}
+	defer func() {
+		if op.ids > 1 {
+			atomic.AddInt64(&tracker.checked, 1)
+		}
+		if op.duplicate {
+			atomic.AddInt64(&tracker.duplicates, 1)
+		}
+	}()
+
+	resp := w.send(req, requestNum, requestID)
+	op.observe(resp)
+
+	for attempt := 1; attempt <= tracker.retry.Attempts && retryable(resp); attempt++ {
+		if !w.sleep(tracker.retry.GetDelay(attempt)) || !w.engine.throttle.wait(w.engine.GetContext()) {
+			return
+		}
+		atomic.AddInt64(&tracker.retries, 1)
+		resp = w.send(req, requestNum, requestID)
+		op.observe(resp)
+	}
+
+	// Check the target honours the key even when nothing failed
+	if succeeded(resp) && tracker.config.Replay > 0 && w.rand.Float64() < tracker.config.Replay && w.engine.GetContext().Err() == nil {
+		atomic.AddInt64(&tracker.replays, 1)
+		op.observe(w.send(req, requestNum, requestID))
+	}
+}
+
+// succeeded reports whether resp is a successful response
+func succeeded(resp *protocols.Response) bool {
+	return resp != nil && resp.Error == nil && resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// retryable reports whether an attempt failed in a way worth retrying:
+// transport errors, rate limiting and server errors
+func retryable(resp *protocols.Response) bool {
+	if resp == nil {
+		return false
+	}
+	return resp.Error != nil || resp.StatusCode == 429 || resp.StatusCode >= 500
+}
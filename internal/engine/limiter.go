@@ -0,0 +1,280 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	stdhttp "net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// limiterRetry is how long a worker waits before asking again when the
+	// global limit has no free slots
+	limiterRetry = 50 * time.Millisecond
+	// limiterTimeout bounds each call to the limit server
+	limiterTimeout = 5 * time.Second
+	// limiterBatch is the most slots leased per call to the limit server
+	limiterBatch = 10
+	// limiterReturnInterval is how often slots left idle for a whole interval
+	// are handed back for other agents to use
+	limiterReturnInterval = 250 * time.Millisecond
+)
+
+// Limiter caps the number of requests in flight. Workers hold a slot for
+// the whole request.
+type Limiter interface {
+	// Acquire waits for a free slot until ctx ends
+	Acquire(ctx context.Context) error
+	// Release returns a slot taken by Acquire
+	Release()
+	// Close gives back every slot held
+	Close() error
+}
+
+// limitResponse mirrors the limit server's acquire and release response
+type limitResponse struct {
+	Granted  int    `json:"granted"`
+	Held     int    `json:"held"`
+	Share    int    `json:"share"`
+	LeaseTTL string `json:"lease_ttl"`
+}
+
+// remoteLimiter leases slots from a global limit served by `gotsunami serve`,
+// so several agents together never exceed it. Slots are leased in batches and
+// reused across requests to keep the server off the request path; slots that
+// stay unused, or exceed the agent's share while others wait, are handed back.
+type remoteLimiter struct {
+	url    string
+	token  string
+	agent  string
+	batch  int
+	client *stdhttp.Client
+
+	// calls serializes requests to the server, so responses are applied in order
+	calls sync.Mutex
+
+	mu sync.Mutex
+	// held is the number of slots the server granted this agent; inUse of
+	// them are taken by requests and releasing are being handed back
+	held       int
+	share      int
+	inUse      int
+	releasing  int
+	leaseTTL   time.Duration
+	leaseUntil time.Time
+	lastCall   time.Time
+	// minIdle is the fewest idle slots seen since the last return check
+	minIdle int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newRemoteLimiter connects to the limit at url (…/api/v1/limits/<name>) on
+// behalf of agent, with the server's token if it has one. batch is how many
+// slots are leased per request to the server.
+func newRemoteLimiter(url, token, agent string, batch int) (*remoteLimiter, error) {
+	if batch < 1 {
+		batch = 1
+	}
+
+	l := &remoteLimiter{
+		url:    strings.TrimSuffix(url, "/"),
+		token:  token,
+		agent:  agent,
+		batch:  batch,
+		client: &stdhttp.Client{Timeout: limiterTimeout},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	// Fail before the test starts if the limit does not exist
+	if _, err := l.call("acquire", 0); err != nil {
+		return nil, err
+	}
+
+	go l.renew()
+
+	return l, nil
+}
+
+// Acquire takes an idle slot, leasing more from the server when there are none
+func (l *remoteLimiter) Acquire(ctx context.Context) error {
+	for {
+		if l.take() {
+			return nil
+		}
+
+		// Another worker may have leased slots while this one waited
+		l.calls.Lock()
+		if l.take() {
+			l.calls.Unlock()
+			return nil
+		}
+		granted, err := l.call("acquire", l.batch)
+		l.calls.Unlock()
+
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to lease slots from the global limit")
+		} else if granted > 0 {
+			continue
+		}
+
+		// The limit is saturated or unreachable; never exceed it
+		timer := time.NewTimer(limiterRetry)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// take claims an idle slot while the lease is valid
+func (l *remoteLimiter) take() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.idle() == 0 || time.Now().After(l.leaseUntil) {
+		return false
+	}
+	l.inUse++
+	if idle := l.idle(); idle < l.minIdle {
+		l.minIdle = idle
+	}
+	return true
+}
+
+// idle returns the number of leased slots free for requests. The caller
+// must hold mu.
+func (l *remoteLimiter) idle() int {
+	if idle := l.held - l.inUse - l.releasing; idle > 0 {
+		return idle
+	}
+	return 0
+}
+
+// Release makes a slot idle again; it goes back to the server on the next renewal
+func (l *remoteLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inUse--
+}
+
+// Close stops renewing the lease and returns every slot
+func (l *remoteLimiter) Close() error {
+	close(l.stop)
+	<-l.done
+
+	l.calls.Lock()
+	defer l.calls.Unlock()
+
+	l.mu.Lock()
+	held := l.held
+	l.mu.Unlock()
+
+	_, err := l.call("release", held)
+	return err
+}
+
+// renew hands back idle slots that were not needed for a whole interval or
+// exceed the agent's share, and keeps the lease alive
+func (l *remoteLimiter) renew() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(limiterReturnInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		l.calls.Lock()
+		l.mu.Lock()
+		l.releasing = min(max(l.minIdle, l.held-l.share), l.idle())
+		action, count := "acquire", 0
+		if l.releasing > 0 {
+			action, count = "release", l.releasing
+		}
+		due := l.releasing > 0 || time.Since(l.lastCall) >= l.leaseTTL/3
+		l.mu.Unlock()
+
+		if due {
+			if _, err := l.call(action, count); err != nil {
+				// Keep the slots; they stop being usable when the lease runs out
+				logrus.WithError(err).Warn("Failed to renew the global limit lease")
+			}
+		}
+
+		l.mu.Lock()
+		l.releasing = 0
+		l.minIdle = l.idle()
+		l.mu.Unlock()
+		l.calls.Unlock()
+	}
+}
+
+// call sends an acquire or release request and records the outcome. It
+// returns the number of slots granted. Callers other than the constructor
+// must hold calls.
+func (l *remoteLimiter) call(action string, count int) (int, error) {
+	payload, err := json.Marshal(map[string]interface{}{"agent": l.agent, "count": count})
+	if err != nil {
+		return 0, err
+	}
+
+	sent := time.Now()
+	req, err := stdhttp.NewRequest(stdhttp.MethodPost, l.url+"/"+action, bytes.NewReader(payload))
+	if err != nil {
+		return 0, fmt.Errorf("invalid global limit URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.token != "" {
+		req.Header.Set("Authorization", "Bearer "+l.token)
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("global limit request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != stdhttp.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, fmt.Errorf("global limit %s returned %d: %s", l.url, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result limitResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("invalid global limit response: %w", err)
+	}
+	ttl, err := time.ParseDuration(result.LeaseTTL)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid global limit lease: %q", result.LeaseTTL)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// The server is authoritative: slots of an expired lease are gone even
+	// if requests still use them, so no new ones start until they finish
+	l.held = result.Held
+	l.share = result.Share
+	l.leaseTTL = ttl
+	// Measured from when the request was sent, so the lease never outlives
+	// the server's view of it
+	l.leaseUntil = sent.Add(ttl)
+	l.lastCall = sent
+
+	return result.Granted, nil
+}
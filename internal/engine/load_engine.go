@@ -2,122 +2,990 @@ package engine
 
 import (
 	"context"
+	crand "crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math/rand"
+	stdhttp "net/http"
+	"os"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/alexandredias/gotsunami/internal/clock"
 	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/cpu"
+	"github.com/alexandredias/gotsunami/internal/hooks"
 	"github.com/alexandredias/gotsunami/internal/metrics"
 	"github.com/alexandredias/gotsunami/internal/protocols"
+	// Register the built-in gRPC and WebSocket protocols
+	_ "github.com/alexandredias/gotsunami/internal/protocols/grpc"
 	"github.com/alexandredias/gotsunami/internal/protocols/http"
+	_ "github.com/alexandredias/gotsunami/internal/protocols/websocket"
+	"github.com/alexandredias/gotsunami/internal/scripting"
+	"github.com/alexandredias/gotsunami/internal/secrets"
+	"github.com/alexandredias/gotsunami/internal/slo"
 	"github.com/alexandredias/gotsunami/internal/validation"
+	"github.com/alexandredias/gotsunami/pkg/templates"
 	"github.com/sirupsen/logrus"
 )
 
 // LoadEngine orchestrates the load testing process
 type LoadEngine struct {
-	config    *config.LoadTestConfig
-	scenario  *config.Scenario
-	protocol  protocols.Protocol
+	config   *config.LoadTestConfig
+	scenario *config.Scenario
+	protocol protocols.Protocol
+	// vuClients holds one client per worker when ClientPerVU is set or
+	// the protocol is PerVU; SetVUs grows it under vuMu
+	vuClients []protocols.Protocol
+	// newVUClient creates the client of a VU, nil when VUs share protocol
+	newVUClient func(vu int) (protocols.Protocol, error)
+	// stepProtocols send the steps using another protocol than the scenario
+	stepProtocols []protocols.Protocol
+	pattern       LoadPattern
+	// arrivals is nil unless iterations start at the rate of stages
+	arrivals  *arrivals
 	collector *metrics.Collector
 	validator *validation.ResponseValidator
+	hooks     *hooks.Runner
+	steps     []*step
+	variables map[string]string
+	globals   map[string]string
+	// compiled holds the templated scenario variables, parsed once
+	compiled  map[string]*templates.Template
+	runID     string
+	sinks     []metrics.Sink
+	resources *resourceTracker
+	throttle  *throttle
+	limiter   Limiter
 	workers   []*Worker
+	startTime time.Time
 	ctx       context.Context
 	cancel    context.CancelFunc
 	wg        sync.WaitGroup
+
+	// idempotency is nil unless the scenario sends idempotency keys
+	idempotency *idempotencyTracker
+	// consistency is nil unless response bodies are compared per URL
+	consistency *consistencyTracker
+	// methods is nil unless the scenario's method has specific metrics
+	methods *methodTracker
+	// tenants is nil unless requests are tagged with tenants
+	tenants *tenantFeed
+	// data is nil unless iterations read rows of a data file
+	data *dataFeed
+	// capturedHeaders break responses down by their values
+	capturedHeaders []capturedHeader
+	// validationSample picks the responses validated in full when
+	// validation is sampled
+	validationSample *validationSampler
+
+	// endpoints is nil unless requests are grouped by endpoint
+	endpoints *endpointNamer
+	// tracer is nil unless sample VUs are traced
+	tracer *tracer
+	// otlp is nil unless iterations are exported as OpenTelemetry traces
+	otlp *otlpExporter
+	// redact is nil unless the scenario masks sensitive values
+	redact *redactor
+	// signer is nil unless requests are signed
+	signer *signer
+
+	// vuMu guards the active workers, which SetVUs changes during the run;
+	// live counts worker goroutines still running, scaled down ones included
+	vuMu    sync.Mutex
+	active  []*Worker
+	live    int
+	started bool
+
+	// annotations mark moments of the run in the final report
+	annotationsMu sync.Mutex
+	annotations   []metrics.Annotation
+
+	// In-flight requests outlive ctx by up to the drain period
+	requestCtx    context.Context
+	abortRequests context.CancelFunc
+	aborted       int64
+	inFlight      int64
+
+	// The limiter and the rest are released once, by Run or Close
+	limiterOnce sync.Once
+	closeOnce   sync.Once
 }
 
 // NewLoadEngine creates a new load testing engine
 func NewLoadEngine(cfg *config.LoadTestConfig, scenario *config.Scenario) (*LoadEngine, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.Duration)
+	// The run deadline starts with the load itself, see Run
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Release what is set up so far when a later step fails, such as the
+	// process of a plugin protocol, which would otherwise outlive the engine
+	cleanups := []func(){cancel}
+	ready := false
+	defer func() {
+		if ready {
+			return
+		}
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}()
+
+	// Pick a seed up front so any run can be reproduced with --seed
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
 
-	// Create HTTP client
+	// Create HTTP client, or the scenario's registered protocol
 	httpConfig := &http.Config{
-		Timeout:        cfg.Timeout,
-		KeepAlive:      cfg.KeepAlive,
-		MaxConnections: cfg.Connections,
-		TLSSkipVerify:  cfg.TLSSkipVerify,
-		Proxy:          cfg.Proxy,
-		UserAgent:      cfg.UserAgent,
+		Timeout:         cfg.Timeout,
+		KeepAlive:       cfg.KeepAlive,
+		MaxConnections:  cfg.Connections,
+		MaxConnsPerHost: cfg.MaxConnsPerHost,
+		TLSSkipVerify:   cfg.TLSSkipVerify,
+		Proxy:           cfg.Proxy,
+		UserAgent:       cfg.UserAgent,
+	}
+	// Steps may wait longer than the scenario; every request is still bounded
+	// by the timeout of its own step
+	for i := range scenario.Steps {
+		if timeout := scenario.Steps[i].GetTimeout(scenario); httpConfig.Timeout > 0 && timeout > httpConfig.Timeout {
+			httpConfig.Timeout = timeout
+		}
+	}
+	if cfg.MaxRequestsPerConn < 0 || cfg.Pipeline < 0 {
+		return nil, fmt.Errorf("max requests per connection and pipeline depth must not be negative")
+	}
+	if (cfg.MaxRequestsPerConn > 0 || cfg.Pipeline > 1) && cfg.Proxy != "" {
+		return nil, fmt.Errorf("max requests per connection and pipelining do not support proxies")
+	}
+	if cfg.Warmup < 0 || cfg.WarmupVUs < 0 || cfg.WarmupWindow < 0 || cfg.WarmupTolerance < 0 {
+		return nil, fmt.Errorf("warm-up settings must not be negative")
+	}
+	if cfg.ConnSoftStart < 0 || cfg.ConnSoftStartRate < 0 {
+		return nil, fmt.Errorf("connection soft start settings must not be negative")
+	}
+	if cfg.ConnSoftStart > 0 {
+		if cfg.ConnSoftStartRate == 0 {
+			return nil, fmt.Errorf("connection soft start needs a starting rate")
+		}
+		if cfg.MaxRequestsPerConn > 0 || cfg.Pipeline > 1 {
+			return nil, fmt.Errorf("connection soft start does not support max requests per connection nor pipelining")
+		}
+		httpConfig.SoftStart = &http.SoftStartConfig{Duration: cfg.ConnSoftStart, Rate: cfg.ConnSoftStartRate}
+	}
+	httpConfig.Decompression = decompressionLimits(cfg)
+	httpConfig.MaxRequestsPerConn = cfg.MaxRequestsPerConn
+	httpConfig.Pipeline = cfg.Pipeline
+	httpVersion := scenario.HTTPVersion
+	if cfg.HTTPVersion != "" {
+		httpVersion = cfg.HTTPVersion
+	}
+	if err := config.ValidateHTTPVersion(httpVersion); err != nil {
+		return nil, err
+	}
+	if httpVersion == config.HTTPVersion2 || httpVersion == config.HTTPVersion3 || httpVersion == config.HTTPVersionAuto {
+		if cfg.MaxRequestsPerConn > 0 || cfg.Pipeline > 1 {
+			return nil, fmt.Errorf("max requests per connection and pipelining need HTTP/1.1")
+		}
+	}
+	if (httpVersion == config.HTTPVersion2 || httpVersion == config.HTTPVersion3) && (cfg.Proxy != "" || !cfg.KeepAlive) {
+		return nil, fmt.Errorf("HTTP/%s does not support proxies nor disabling keep-alive", httpVersion)
+	}
+	httpConfig.HTTPVersion = httpVersion
+	bandwidth := scenario.Bandwidth
+	if cfg.Bandwidth != nil {
+		bandwidth = cfg.Bandwidth
+	}
+	if bandwidth != nil {
+		download, upload, err := bandwidth.Rates()
+		if err != nil {
+			return nil, err
+		}
+		httpConfig.Bandwidth = &http.BandwidthConfig{Download: download, Upload: upload}
+	}
+	if scenario.Chaos != nil {
+		httpConfig.Chaos = &http.ChaosConfig{
+			Latency:      scenario.Chaos.GetLatency(),
+			LatencyRate:  scenario.Chaos.LatencyRate,
+			DropRate:     scenario.Chaos.DropRate,
+			TruncateRate: scenario.Chaos.TruncateRate,
+			Seed:         cfg.Seed,
+		}
+	}
+
+	// Each VU presents a certificate of its own, see the per-VU clients
+	// below; shared clients, such as the preflight's, present the first
+	var certificates []tls.Certificate
+	if cfg.ClientCerts != "" {
+		if !scenario.IsHTTP() {
+			return nil, fmt.Errorf("client certificates need an HTTP scenario")
+		}
+		var err error
+		if certificates, err = http.LoadClientCertificates(cfg.ClientCerts); err != nil {
+			return nil, err
+		}
+		httpConfig.Certificates = certificates[:1]
+	}
+
+	// QUIC runs over UDP, below which the TCP dial chain cannot reach
+	if httpVersion == config.HTTPVersion3 && (httpConfig.Bandwidth.Enabled() || httpConfig.Chaos.Enabled() || httpConfig.SoftStart.Enabled()) {
+		return nil, fmt.Errorf("HTTP/3 does not support bandwidth throttling, chaos nor connection soft start")
+	}
+
+	var protocol protocols.Protocol = http.NewHTTPClient(httpConfig)
+	if !scenario.IsHTTP() {
+		var err error
+		protocol, err = protocols.New(scenario.Protocol, scenario.ProtocolConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s protocol: %w", scenario.Protocol, err)
+		}
+	}
+	cleanups = append(cleanups, func() { protocol.Close() })
+
+	pattern, err := NewLoadPattern(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if rate, ok := pattern.(*RatePattern); ok {
+		if err := validateArrivals(cfg); err != nil {
+			return nil, err
+		}
+		// Stages decide how long the test lasts, whatever --duration says
+		cfg.Duration = rate.Duration()
+		cfg.Pattern = rate.Name()
+	}
+
+	// Fail fast on broken scripts instead of in every worker
+	if scenario.Script != "" {
+		script, err := scripting.Load(scenario.Script)
+		if err != nil {
+			return nil, err
+		}
+		script.Close()
 	}
 
-	protocol := http.NewHTTPClient(httpConfig)
-	collector := metrics.NewCollector()
-	validator := validation.NewResponseValidator(scenario.GetValidationConfig())
+	_, contentType := findHeader(scenario.Headers, "Content-Type")
+	body, err := newRequestBody(scenario.Body, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body: %w", err)
+	}
+
+	// Reject unknown template functions before the test starts
+	if err := validateTemplates(scenario); err != nil {
+		return nil, err
+	}
+
+	// Secrets are read once, before any template uses them
+	secretValues, err := secrets.NewResolver().Resolve(ctx, scenario.Secrets)
+	if err != nil {
+		return nil, err
+	}
 
-	// Determine number of workers
+	// Global variables are evaluated once, before any VU reads them
+	variables := templateVariables(scenario, secretValues)
+	compiled, err := compileVariables(scenario)
+	if err != nil {
+		return nil, err
+	}
+	globals, err := evaluateScope(scenario, compiled, variables, config.ScopeGlobal, rand.New(rand.NewSource(cfg.Seed)))
+	if err != nil {
+		return nil, err
+	}
+
+	tenants, err := newTenantFeed(scenario.Tenants)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenants: %w", err)
+	}
+
+	data, err := newDataFeed(scenario.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data: %w", err)
+	}
+
+	capturedHeaders, err := newCapturedHeaders(scenario)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.HistogramPrecision == 1 || cfg.HistogramPrecision > metrics.MaxHistogramPrecision {
+		return nil, fmt.Errorf("histogram precision must be between 2 and %d bits", metrics.MaxHistogramPrecision)
+	}
+	collector := metrics.NewCollectorWithPrecision(cfg.HistogramPrecision)
+	newValidator := func(rules *config.ValidationConfig, method string) *validation.ResponseValidator {
+		// Without validation rules, any status below 400 counts as success
+		if rules == nil {
+			rules = &config.ValidationConfig{}
+		}
+		return validation.NewResponseValidator(rules).WithOverrides(&validation.ValidationOverrides{
+			ExpectStatus:       cfg.ExpectStatus,
+			ExpectResponseTime: cfg.ExpectResponseTime,
+			ExpectBody:         cfg.ExpectBody,
+			ExpectBodyNot:      cfg.ExpectBodyNot,
+		}).WithMethod(method)
+	}
+	steps, err := newSteps(scenario, body, newValidator)
+	if err != nil {
+		return nil, err
+	}
+	// The scenario's own request, or else the first step, validates
+	// preflight and RecordResponse
+	validator := steps[0].validator
+
+	// Each worker is a virtual user unless overridden
 	workers := cfg.Workers
 	if workers == 0 {
-		workers = runtime.NumCPU()
+		workers = cfg.VirtualUsers
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+
+	redact, err := newRedactor(scenario.Redaction)
+	if err != nil {
+		return nil, err
+	}
+	redact = redact.withSecrets(secretValues)
+	signer, err := newSigner(scenario.Signing)
+	if err != nil {
+		return nil, err
+	}
+
+	sinks, err := newSinks(cfg, scenario)
+	if err != nil {
+		return nil, err
+	}
+	cleanups = append(cleanups, func() {
+		for _, sink := range sinks {
+			sink.Close()
+		}
+	})
+
+	var trace *tracer
+	if cfg.TraceVUs > 0 {
+		trace, err = newTracer(cfg.TraceOut, redact)
+		if err != nil {
+			return nil, err
+		}
+		cleanups = append(cleanups, func() { trace.Close() })
 	}
 
 	engine := &LoadEngine{
 		config:    cfg,
 		scenario:  scenario,
 		protocol:  protocol,
+		pattern:   pattern,
 		collector: collector,
 		validator: validator,
+		hooks:     hooks.NewRunner(scenario.Hooks),
+		steps:     steps,
+		variables: variables,
+		globals:   globals,
+		compiled:  compiled,
+		runID:     newRunID(),
+		sinks:     sinks,
+		resources: newResourceTracker(scenario.Cleanup),
+		throttle:  newThrottle(scenario.RateLimit),
 		workers:   make([]*Worker, workers),
 		ctx:       ctx,
 		cancel:    cancel,
 	}
+	engine.requestCtx, engine.abortRequests = context.WithCancel(context.Background())
+	engine.arrivals = newArrivals(pattern)
+	engine.idempotency = newIdempotencyTracker(scenario)
+	engine.consistency = newConsistencyTracker(scenario.Consistency)
+	engine.methods = newMethodTracker(scenario.Method)
+	engine.tenants = tenants
+	engine.data = data
+	engine.capturedHeaders = capturedHeaders
+	engine.validationSample = newValidationSampler(cfg.Seed)
+	engine.endpoints = newEndpointNamer(scenario)
+	engine.tracer = trace
+	engine.redact = redact
+	engine.signer = signer
+
+	// Steps sent with another protocol than the scenario's, such as a gRPC
+	// call after a REST login, have a client of their own
+	engine.stepProtocols, err = newStepProtocols(scenario, steps, httpConfig)
+	if err != nil {
+		return nil, err
+	}
+	cleanups = append(cleanups, func() { closeAll(engine.stepProtocols) })
+
+	if cfg.OTLPEndpoint != "" {
+		sample := cfg.OTLPSample
+		if sample == 0 {
+			sample = 1
+		}
+		exporter, err := newOTLPExporter(cfg.OTLPEndpoint, sample, cfg.Seed, scenario.Name, engine.runID)
+		if err != nil {
+			return nil, err
+		}
+		exporter.redact = redact
+		engine.otlp = exporter
+		cleanups = append(cleanups, func() { exporter.Close() })
+	}
+
+	if cfg.GlobalLimit != "" {
+		agent := "gotsunami-" + engine.runID
+		if hostname, err := os.Hostname(); err == nil {
+			agent = hostname + "-" + engine.runID
+		}
+		limiter, err := newRemoteLimiter(cfg.GlobalLimit, cfg.GlobalLimitToken, agent, min(workers, limiterBatch))
+		if err != nil {
+			return nil, fmt.Errorf("failed to join global limit: %w", err)
+		}
+		engine.limiter = limiter
+		cleanups = append(cleanups, engine.closeLimiter)
+	}
+
+	// Separate clients avoid contention on a single connection pool at high
+	// VU counts, at the cost of more connections, and let every VU present
+	// its own client certificate
+	if (cfg.ClientPerVU || len(certificates) > 0) && scenario.IsHTTP() {
+		if len(certificates) > 0 && len(certificates) < workers {
+			logrus.Warnf("%d client certificates for %d VUs: VUs share them in turn", len(certificates), workers)
+		}
+		connections := cfg.Connections / workers
+		if connections < 2 {
+			connections = 2
+		}
+		engine.newVUClient = func(vu int) (protocols.Protocol, error) {
+			vuConfig := *httpConfig
+			vuConfig.MaxConnections = connections
+			if vuConfig.Chaos != nil {
+				chaos := *vuConfig.Chaos
+				chaos.Seed += int64(vu+1) * 7919
+				vuConfig.Chaos = &chaos
+			}
+			if len(certificates) > 0 {
+				certificate := vu % len(certificates)
+				vuConfig.Certificates = certificates[certificate : certificate+1]
+			}
+			return http.NewHTTPClient(&vuConfig), nil
+		}
+	}
+	// Protocols keeping a session, such as a WebSocket, need one per VU
+	if perVU, ok := protocol.(protocols.PerVU); ok && perVU.PerVU() {
+		engine.newVUClient = func(int) (protocols.Protocol, error) {
+			return protocols.New(scenario.Protocol, scenario.ProtocolConfig)
+		}
+	}
+	cleanups = append(cleanups, func() { closeAll(engine.vuClients) })
+	if err := engine.growVUClients(workers); err != nil {
+		return nil, err
+	}
 
 	// Create workers
 	for i := 0; i < workers; i++ {
 		engine.workers[i] = NewWorker(i, engine)
 	}
 
+	ready = true
 	return engine, nil
 }
 
 // Run executes the load test
 func (e *LoadEngine) Run() (*metrics.Summary, error) {
 	logrus.Info("Starting load test...")
-	logrus.Infof("Configuration: %d VUs, %v duration, %s pattern",
-		e.config.VirtualUsers, e.config.Duration, e.config.Pattern)
+	logrus.Infof("Configuration: %d VUs, %v duration, %s pattern, seed %d",
+		e.config.VirtualUsers, e.config.Duration, e.pattern.Name(), e.config.Seed)
+	if limit, ok := cpu.Limit(); ok {
+		logrus.Infof("Container CPU limit: %.4g CPUs, GOMAXPROCS %d", limit, runtime.GOMAXPROCS(0))
+	}
 
-	// Start metrics collection
+	// Run start hooks; a failing required hook aborts the test
+	hookResults := e.hooks.Run(e.ctx, hooks.Event{Type: hooks.EventStart, Scenario: e.scenario.Name})
+	if failed := hooks.Failed(hookResults); failed != nil {
+		e.Close()
+		return nil, fmt.Errorf("start hook %s failed: %s", failed.Name, failed.Error)
+	}
+
+	if !e.config.SkipPreflight {
+		if err := e.Preflight(e.ctx); err != nil {
+			e.Close()
+			return nil, err
+		}
+	}
+
+	var warmup *metrics.WarmupSummary
+	if e.config.Warmup > 0 {
+		warmup = e.warmUp()
+	}
+
+	// Start metrics collection; patterns are driven by time since this point
+	e.startTime = time.Now()
 	e.collector.Start()
+	deadline := time.AfterFunc(e.config.Duration, e.cancel)
+	defer deadline.Stop()
 
 	// Start workers
+	e.vuMu.Lock()
+	e.started = true
+	e.active = append(e.active, e.workers...)
 	for _, worker := range e.workers {
-		e.wg.Add(1)
-		go worker.Run(&e.wg)
+		e.startWorker(worker)
+	}
+	e.vuMu.Unlock()
+	workersDone := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(workersDone)
+	}()
+
+	// Background watchers stop with the engine context
+	var watchers sync.WaitGroup
+
+	// Start iterations at the rate of the stages, whenever a worker is free
+	if e.arrivals != nil {
+		watchers.Add(1)
+		go func() {
+			defer watchers.Done()
+			e.arrivals.run(e.ctx, e.startTime)
+		}()
+	}
+
+	// Watch SLOs and warn as soon as the run is projected to violate one
+	var monitor *slo.Monitor
+	if e.scenario.SLO != nil {
+		monitor = slo.NewMonitor(e.scenario.SLO, e.scenario.Name, e.config.Labels)
+		watchers.Add(1)
+		go func() {
+			defer watchers.Done()
+			monitor.Run(e.ctx, e.collector, e.startTime, e.config.Duration)
+		}()
+	}
+
+	// Watch the generator's own CPU, which may be the bottleneck
+	generator := newCPUMonitor()
+	if generator != nil {
+		watchers.Add(1)
+		go func() {
+			defer watchers.Done()
+			generator.run(e.ctx)
+		}()
 	}
 
-	// Wait for completion or timeout
+	// Watch the clocks for jumps of the system clock and generator stalls
+	clocks := clock.NewMonitor(e.startTime)
+	watchers.Add(1)
+	go func() {
+		defer watchers.Done()
+		clocks.Run(e.ctx)
+	}()
+
+	// Fire stage hooks as the load pattern moves between stages
+	var stageResults []hooks.Result
+	watchers.Add(1)
+	go func() {
+		defer watchers.Done()
+		stageResults = e.watchStages()
+	}()
+
+	// Run until the deadline, Stop, or every worker is done (e.g. max requests)
 	select {
 	case <-e.ctx.Done():
 		logrus.Info("Load test completed")
-	case <-time.After(e.config.Duration + 5*time.Second):
-		logrus.Warn("Load test timeout exceeded")
+	case <-workersDone:
+		logrus.Info("All workers finished")
+	}
+	e.cancel()
+	elapsed := e.Elapsed()
+
+	// No new iterations start now; give in-flight requests the drain period
+	// to finish before aborting them
+	drain := &metrics.DrainSummary{InFlight: atomic.LoadInt64(&e.inFlight)}
+	drainStart := time.Now()
+	select {
+	case <-workersDone:
+	case <-time.After(e.config.Drain):
+		e.abortRequests()
+		<-workersDone
+	}
+	e.abortRequests()
+	drain.Abandoned = atomic.LoadInt64(&e.aborted)
+	drain.Completed = max(drain.InFlight-drain.Abandoned, 0)
+	drain.Duration = time.Since(drainStart).Round(time.Millisecond).String()
+	if drain.Abandoned > 0 {
+		logrus.Infof("Aborted %d in-flight requests after the %v drain period", drain.Abandoned, e.config.Drain)
 	}
 
 	// Stop metrics collection
 	e.collector.Stop()
+	watchers.Wait()
+	cpuSummary := generator.summary()
+	if cpuSummary != nil && cpuSummary.Warning != "" {
+		logrus.Warnf("CPU saturated: %s", cpuSummary.Warning)
+	}
+	clockSummary := clocks.Summary()
+	if clockSummary != nil && clockSummary.Warning != "" {
+		logrus.Warnf("Clock: %s", clockSummary.Warning)
+	}
+	e.closeLimiter()
+	throttled := e.throttle.summary(e.Elapsed())
+
+	// Delete resources created by the test before tearing down the client
+	cleanup := e.runCleanup()
 
-	// Wait for all workers to finish
-	e.wg.Wait()
+	if faults := e.chaosFaults(); faults != nil {
+		logrus.Infof("Injected faults: %v", faults)
+	}
+	connections := e.ConnectionPool()
+	httpVersions := e.httpVersions()
 
 	// Clean up
-	e.protocol.Close()
+	e.Close()
 
 	// Get final summary
 	summary := e.collector.GetSummary()
 
+	hookResults = append(hookResults, stageResults...)
+	hookResults = append(hookResults, e.hooks.Run(context.Background(),
+		hooks.Event{Type: hooks.EventEnd, Scenario: e.scenario.Name})...)
+	summary.Hooks = hookResults
+	summary.Cleanup = cleanup
+	summary.Throttle = throttled
+	summary.Drain = drain
+	summary.Warmup = warmup
+	summary.Idempotency = e.idempotency.summary()
+	summary.Consistency = e.consistency.summary()
+	summary.Annotations = e.Annotations()
+	if summary.Consistency != nil && summary.Consistency.Inconsistent > 0 {
+		logrus.Warnf("%d of %d URLs returned differing content", summary.Consistency.Inconsistent, summary.Consistency.Checked)
+	}
+	summary.MethodMetrics = e.methods.summary()
+	summary.ConnectionPool = connections
+	summary.HTTPVersions = httpVersions
+	summary.Generator = cpuSummary
+	summary.Clock = clockSummary
+	if started, dropped := e.arrivals.counts(); dropped > 0 {
+		summary.DroppedIterations = dropped
+		logrus.Warnf("Dropped %d of %d iterations the stages started: every VU was busy; raise --vus to keep up",
+			dropped, started+dropped)
+	}
+	// A single stage would only repeat the totals
+	if len(summary.Stages) > 1 {
+		e.describeStages(summary.Stages, elapsed)
+	} else {
+		summary.Stages = nil
+	}
+	if monitor != nil {
+		summary.SLOViolations = monitor.Evaluate(e.collector)
+	}
+	e.redact.summary(summary)
+
 	logrus.Infof("Load test completed: %d requests, %.2f%% success rate, %.2f req/s",
 		summary.TotalRequests, summary.SuccessRate, summary.RequestsPerSecond)
+	if summary.Latency != nil && summary.Latency.P99CI != nil && !summary.Latency.P99CI.Bounded {
+		logrus.Warnf("p99 rests on too few samples (%d) to bound; read it as somewhere between %v and %v",
+			summary.Latency.Samples, summary.Latency.P99CI.Lower, summary.Latency.P99CI.Upper)
+	}
 
 	return summary, nil
 }
 
+// watchStages runs stage hooks whenever the load pattern enters a new stage,
+// until the test ends
+func (e *LoadEngine) watchStages() []hooks.Result {
+	staged, ok := e.pattern.(StagedPattern)
+	if !ok || e.scenario.Hooks == nil || len(e.scenario.Hooks.OnStage) == 0 {
+		<-e.ctx.Done()
+		return nil
+	}
+
+	var results []hooks.Result
+	current := -1
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		stage := staged.Stage(e.Elapsed())
+		if stage >= 0 && stage != current {
+			current = stage
+			results = append(results, e.hooks.Run(e.ctx, hooks.Event{
+				Type:     hooks.EventStage,
+				Scenario: e.scenario.Name,
+				Stage:    stage,
+			})...)
+		}
+
+		select {
+		case <-e.ctx.Done():
+			return results
+		case <-ticker.C:
+		}
+	}
+}
+
 // Stop gracefully stops the load test
 func (e *LoadEngine) Stop() {
 	logrus.Info("Stopping load test...")
 	e.cancel()
 }
 
+// Close releases what NewLoadEngine set up: the protocol clients, the
+// result sinks, the trace writers and the global limit slots. Run closes the
+// engine when the test ends; an engine that is never run, such as a
+// scheduled run stopped before its start, must be closed instead.
+func (e *LoadEngine) Close() {
+	e.closeOnce.Do(func() {
+		e.cancel()
+		e.abortRequests()
+		e.closeLimiter()
+		e.closeProtocols()
+		for _, sink := range e.sinks {
+			if err := sink.Close(); err != nil {
+				logrus.WithError(err).Warn("Failed to write request results")
+			}
+		}
+		if e.tracer != nil {
+			if err := e.tracer.Close(); err != nil {
+				logrus.WithError(err).Warn("Failed to write VU trace")
+			}
+		}
+		if e.otlp != nil {
+			if err := e.otlp.Close(); err != nil {
+				logrus.WithError(err).Warn("Failed to export OTLP traces")
+			}
+		}
+	})
+}
+
+// ErrNotRunning is returned when changing a test that is not running
+var ErrNotRunning = errors.New("load test is not running")
+
+// SetVUs changes the number of active VUs while the test runs. New VUs start
+// right away; removed ones, the most recently added first, finish their
+// current iteration and stop. New VUs get a client of their own, as the
+// initial ones do, when each VU has its own.
+func (e *LoadEngine) SetVUs(vus int) error {
+	if vus < 1 {
+		return fmt.Errorf("at least one VU is required")
+	}
+
+	e.vuMu.Lock()
+	defer e.vuMu.Unlock()
+
+	// live > 0 also keeps the wait group from reaching zero while adding
+	if !e.started || e.ctx.Err() != nil || e.live == 0 {
+		return ErrNotRunning
+	}
+
+	if err := e.growVUClients(vus); err != nil {
+		return err
+	}
+
+	previous := len(e.active)
+	for len(e.active) < vus {
+		worker := NewWorker(len(e.active), e)
+		e.active = append(e.active, worker)
+		e.startWorker(worker)
+	}
+	for len(e.active) > vus {
+		last := len(e.active) - 1
+		close(e.active[last].stop)
+		e.active = e.active[:last]
+	}
+
+	if vus != previous {
+		logrus.Infof("Scaled from %d to %d VUs", previous, vus)
+	}
+	return nil
+}
+
+// ActiveVUs returns the number of active VUs
+func (e *LoadEngine) ActiveVUs() int {
+	e.vuMu.Lock()
+	defer e.vuMu.Unlock()
+	return len(e.active)
+}
+
+// Annotate marks the current moment of the run, such as a deploy, in the
+// final report
+func (e *LoadEngine) Annotate(text string) (metrics.Annotation, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return metrics.Annotation{}, fmt.Errorf("annotation text is required")
+	}
+
+	e.vuMu.Lock()
+	running := e.started && e.ctx.Err() == nil
+	e.vuMu.Unlock()
+	if !running {
+		return metrics.Annotation{}, ErrNotRunning
+	}
+
+	now := time.Now()
+	annotation := metrics.Annotation{
+		Offset: now.Sub(e.startTime).Round(time.Millisecond).String(),
+		Time:   now.UTC().Format(time.RFC3339),
+		Text:   text,
+	}
+
+	e.annotationsMu.Lock()
+	defer e.annotationsMu.Unlock()
+	e.annotations = append(e.annotations, annotation)
+	logrus.Infof("Annotated %s at %s", text, annotation.Offset)
+	return annotation, nil
+}
+
+// Annotations returns the annotations made so far, oldest first
+func (e *LoadEngine) Annotations() []metrics.Annotation {
+	e.annotationsMu.Lock()
+	defer e.annotationsMu.Unlock()
+	return append([]metrics.Annotation(nil), e.annotations...)
+}
+
+// startWorker runs a worker. The caller must hold vuMu.
+func (e *LoadEngine) startWorker(worker *Worker) {
+	e.live++
+	e.wg.Add(1)
+	go worker.Run(&e.wg)
+}
+
+// workerStopped records that a worker goroutine returned
+func (e *LoadEngine) workerStopped() {
+	e.vuMu.Lock()
+	defer e.vuMu.Unlock()
+	e.live--
+}
+
+// ProtocolFor returns the protocol used by a worker: its own HTTP client when
+// ClientPerVU is set or its own instance of a PerVU protocol, the shared one
+// otherwise. Once the test runs, the caller must hold vuMu.
+func (e *LoadEngine) ProtocolFor(worker int) protocols.Protocol {
+	if worker < len(e.vuClients) {
+		return e.vuClients[worker]
+	}
+	return e.protocol
+}
+
+// growVUClients creates the clients of VUs up to vus when each VU has its
+// own. Once the test runs, the caller must hold vuMu.
+func (e *LoadEngine) growVUClients(vus int) error {
+	if e.newVUClient == nil {
+		return nil
+	}
+	for vu := len(e.vuClients); vu < vus; vu++ {
+		client, err := e.newVUClient(vu)
+		if err != nil {
+			return fmt.Errorf("failed to create %s protocol: %w", e.scenario.Protocol, err)
+		}
+		e.vuClients = append(e.vuClients, client)
+	}
+	return nil
+}
+
+// closeProtocols closes the shared protocol, any per-VU clients and the
+// protocols of steps
+func (e *LoadEngine) closeProtocols() {
+	closeAll(e.allProtocols())
+}
+
+// allProtocols returns the shared protocol, the per-VU clients and the
+// protocols of steps
+func (e *LoadEngine) allProtocols() []protocols.Protocol {
+	e.vuMu.Lock()
+	defer e.vuMu.Unlock()
+	all := append([]protocols.Protocol{e.protocol}, e.vuClients...)
+	return append(all, e.stepProtocols...)
+}
+
+// Limiter returns the limiter capping requests in flight, or nil
+func (e *LoadEngine) Limiter() Limiter {
+	return e.limiter
+}
+
+// closeLimiter hands every slot of the global limit back
+func (e *LoadEngine) closeLimiter() {
+	if e.limiter == nil {
+		return
+	}
+	e.limiterOnce.Do(func() {
+		if err := e.limiter.Close(); err != nil {
+			logrus.WithError(err).Warn("Failed to release global limit slots")
+		}
+	})
+}
+
+// chaosFaults sums the faults injected by every client, or nil without chaos
+func (e *LoadEngine) chaosFaults() map[string]int64 {
+	var faults map[string]int64
+	for _, protocol := range e.allProtocols() {
+		counts, ok := protocol.GetMetrics()["chaos"].(map[string]int64)
+		if !ok {
+			continue
+		}
+		if faults == nil {
+			faults = make(map[string]int64, len(counts))
+		}
+		for fault, count := range counts {
+			faults[fault] += count
+		}
+	}
+	return faults
+}
+
+// ConnectionPool sums the connection pool stats of every HTTP client, or
+// returns nil when no request uses HTTP
+func (e *LoadEngine) ConnectionPool() *metrics.ConnectionPoolSummary {
+	var stats http.PoolStats
+	found := false
+	for _, protocol := range e.allProtocols() {
+		if client, ok := protocol.(*http.HTTPClient); ok {
+			stats.Add(client.PoolStats())
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	summary := &metrics.ConnectionPoolSummary{
+		Dials:        stats.Dials,
+		DialFailures: stats.DialFailures,
+		Reused:       stats.Reused,
+		Open:         stats.Open,
+		InUse:        stats.InUse,
+		Idle:         stats.Idle(),
+		Waiting:      stats.Waiting,
+		PeakOpen:     stats.PeakOpen,
+		PeakInUse:    stats.PeakInUse,
+		PeakWaiting:  stats.PeakWaiting,
+		Waits:        stats.Waits,
+	}
+	if stats.Waits > 0 {
+		summary.WaitTime = stats.WaitTime.Round(time.Microsecond).String()
+		summary.MaxWait = stats.MaxWait.Round(time.Microsecond).String()
+	}
+	return summary
+}
+
+// httpVersions sums the responses of every HTTP client by the protocol
+// version negotiated, or returns nil when there were none
+func (e *LoadEngine) httpVersions() map[string]int64 {
+	var versions map[string]int64
+	for _, protocol := range e.allProtocols() {
+		client, ok := protocol.(*http.HTTPClient)
+		if !ok {
+			continue
+		}
+		for proto, count := range client.Versions() {
+			if versions == nil {
+				versions = make(map[string]int64)
+			}
+			versions[proto] += count
+		}
+	}
+	return versions
+}
+
 // GetCollector returns the metrics collector
 func (e *LoadEngine) GetCollector() *metrics.Collector {
 	return e.collector
@@ -128,6 +996,17 @@ func (e *LoadEngine) GetContext() context.Context {
 	return e.ctx
 }
 
+// RequestContext returns the context requests run under. Unlike the engine
+// context it stays alive after the test ends, until the drain period is over.
+func (e *LoadEngine) RequestContext() context.Context {
+	return e.requestCtx
+}
+
+// RecordAborted counts a request abandoned at the end of the drain period
+func (e *LoadEngine) RecordAborted() {
+	atomic.AddInt64(&e.aborted, 1)
+}
+
 // GetConfig returns the load test configuration
 func (e *LoadEngine) GetConfig() *config.LoadTestConfig {
 	return e.config
@@ -143,45 +1022,393 @@ func (e *LoadEngine) GetProtocol() protocols.Protocol {
 	return e.protocol
 }
 
+// Elapsed returns how long the load test has been running, or zero before it starts
+func (e *LoadEngine) Elapsed() time.Duration {
+	if e.startTime.IsZero() {
+		return 0
+	}
+	return time.Since(e.startTime)
+}
+
+// GetPattern returns the load pattern
+func (e *LoadEngine) GetPattern() LoadPattern {
+	return e.pattern
+}
+
 // GetValidator returns the response validator
 func (e *LoadEngine) GetValidator() *validation.ResponseValidator {
 	return e.validator
 }
 
-// CreateRequest creates a protocol request from the scenario
-func (e *LoadEngine) CreateRequest() *protocols.Request {
-	// Build full URL
-	fullURL := e.scenario.BaseURL + e.scenario.URL
+// CreateRequest creates a protocol request from the scenario, expanding
+// templates in headers and body with random values drawn from rng.
+// VU-scoped variables are evaluated afresh; workers keep theirs across
+// iterations with CreateVURequest.
+func (e *LoadEngine) CreateRequest(rng *rand.Rand) (*protocols.Request, error) {
+	vu, err := e.VUVariables(rng)
+	if err != nil {
+		return nil, err
+	}
+	return e.CreateVURequest(rng, vu)
+}
+
+// VUVariables evaluates the VU-scoped variables of a virtual user. The
+// result belongs to that VU and is only read afterwards.
+func (e *LoadEngine) VUVariables(rng *rand.Rand) (map[string]string, error) {
+	return evaluateScope(e.scenario, e.compiled, e.globals, config.ScopeVU, rng)
+}
+
+// CreateVURequest creates a request for a virtual user whose variables were
+// returned by VUVariables, evaluating the per-iteration variables
+func (e *LoadEngine) CreateVURequest(rng *rand.Rand, vu map[string]string) (*protocols.Request, error) {
+	req, _, err := e.createRequest(rng, vu)
+	return req, err
+}
+
+// createRequest creates a request like CreateVURequest, also returning the
+// variables it was expanded with. In a multi-step scenario it is the first
+// step's request.
+func (e *LoadEngine) createRequest(rng *rand.Rand, vu map[string]string) (*protocols.Request, map[string]string, error) {
+	variables, err := evaluateScope(e.scenario, e.compiled, withValues(vu, e.data.sample(rng)), config.ScopeIteration, rng)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := e.buildRequest(e.steps[0], variables, rng)
+	return req, variables, err
+}
+
+// evaluateScope expands the templated variables of a scope against base,
+// which holds the values of broader scopes, so a variable such as
+// {{random.uuid}} has the same value everywhere it is used within the scope.
+// base is never modified; it is returned as-is when nothing needs expanding.
+// compiled holds the scenario variables parsed by compileVariables; values
+// replaced since, such as by a data file, are parsed again.
+func evaluateScope(scenario *config.Scenario, compiled map[string]*templates.Template, base map[string]string, scope string, rng *rand.Rand) (map[string]string, error) {
+	var variables map[string]string
+	for _, key := range sortedKeys(base) {
+		value := base[key]
+		if !strings.Contains(value, "{{") || scenario.VariableScope(key) != scope {
+			continue
+		}
+		if variables == nil {
+			variables = make(map[string]string, len(base))
+			for k, v := range base {
+				variables[k] = v
+			}
+		}
+		var expanded string
+		var err error
+		if template := compiled[key]; template != nil && template.String() == value {
+			expanded, err = template.Expand(base, rng)
+		} else {
+			expanded, err = templates.ExpandRand(value, base, rng)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %w", key, err)
+		}
+		variables[key] = expanded
+	}
+
+	if variables == nil {
+		return base, nil
+	}
+	return variables, nil
+}
+
+// compileVariables compiles the templated variables of a scenario
+func compileVariables(scenario *config.Scenario) (map[string]*templates.Template, error) {
+	compiled := make(map[string]*templates.Template)
+	for key, value := range scenario.Variables {
+		if !strings.Contains(value, "{{") {
+			continue
+		}
+		template, err := templates.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %w", key, err)
+		}
+		compiled[key] = template
+	}
+	return compiled, nil
+}
+
+// validateTemplates checks every templated field of the scenario
+func validateTemplates(scenario *config.Scenario) error {
+	fields := map[string]string{"url": scenario.BaseURL + scenario.URL}
+	for key, value := range scenario.Variables {
+		fields["variable "+key] = value
+	}
+	for key, value := range scenario.Headers {
+		fields["header "+key] = value
+	}
+	for key, value := range scenario.QueryParams {
+		if s, ok := value.(string); ok {
+			fields["query param "+key] = s
+		}
+	}
+	if scenario.Cleanup != nil {
+		fields["cleanup url"] = scenario.Cleanup.URL
+	}
+	for i, step := range scenario.Steps {
+		name := step.GetName(i)
+		fields[name+" url"] = step.GetBaseURL(scenario) + step.URL
+		for key, value := range step.Headers {
+			fields[name+" header "+key] = value
+		}
+		for key, value := range step.QueryParams {
+			if s, ok := value.(string); ok {
+				fields[name+" query param "+key] = s
+			}
+		}
+	}
+
+	for field, value := range fields {
+		if err := templates.Validate(value); err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+	}
+
+	return nil
+}
+
+// decompressionLimits returns the limits on compressed response bodies, with
+// the defaults filled in
+func decompressionLimits(cfg *config.LoadTestConfig) *http.DecompressionConfig {
+	limits := &http.DecompressionConfig{MaxSize: cfg.MaxDecompressedSize, MaxRatio: cfg.MaxDecompressionRatio}
+	switch {
+	case limits.MaxSize == 0:
+		limits.MaxSize = http.DefaultMaxDecompressedSize
+	case limits.MaxSize < 0:
+		limits.MaxSize = 0
+	}
+	switch {
+	case limits.MaxRatio == 0:
+		limits.MaxRatio = http.DefaultMaxDecompressionRatio
+	case limits.MaxRatio < 0:
+		limits.MaxRatio = 0
+	}
+	return limits
+}
+
+// sortedKeys returns the keys of m in order, so templates draw from a seeded
+// source in the same order on every run
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// findHeader looks up a header by case-insensitive name
+func findHeader(headers map[string]string, name string) (string, string) {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return key, value
+		}
+	}
+	return "", ""
+}
+
+// templateVariables collects the values available to templates: scenario
+// variables by name, scenario environment entries as env.NAME and secrets
+// as secret.NAME
+func templateVariables(scenario *config.Scenario, secrets map[string]string) map[string]string {
+	variables := make(map[string]string, len(scenario.Variables)+len(scenario.Environment)+len(secrets))
+	for key, value := range scenario.Variables {
+		variables[key] = value
+	}
+	for key, value := range scenario.Environment {
+		variables["env."+key] = value
+	}
+	for name, value := range secrets {
+		variables["secret."+name] = value
+	}
+
+	return variables
+}
+
+// traceVU returns the trace of a worker, or nil unless it is a traced sample VU
+func (e *LoadEngine) traceVU(worker int) *vuTrace {
+	if e.tracer == nil || worker >= e.config.TraceVUs {
+		return nil
+	}
+	return &vuTrace{tracer: e.tracer, vu: worker + 1}
+}
+
+// ClientID returns the stable identifier of a virtual user for this run
+func (e *LoadEngine) ClientID(vu int) string {
+	return fmt.Sprintf("gotsunami-%s-vu-%d", e.runID, vu)
+}
+
+// RecordRaw sends a request outcome to the raw results output and the
+// --out sinks, if any
+func (e *LoadEngine) RecordRaw(result metrics.RawResult) {
+	if len(e.sinks) == 0 {
+		return
+	}
+	result.URL = e.redact.text(result.URL)
+	result.Error = e.redact.text(result.Error)
+	result.Endpoint = e.redact.text(result.Endpoint)
+	for _, sink := range e.sinks {
+		if err := sink.Write(result); err != nil {
+			logrus.WithError(err).Debug("Failed to write raw result")
+		}
+	}
+}
 
-	// Convert body to bytes if needed
-	var bodyBytes []byte
-	if e.scenario.Body != nil {
-		// TODO: Handle different body types (JSON, form data, etc.)
-		bodyBytes = []byte(fmt.Sprintf("%v", e.scenario.Body))
+// newSinks opens the raw results output and the --out sinks of a test,
+// tagging streamed metrics with the scenario and the run labels
+func newSinks(cfg *config.LoadTestConfig, scenario *config.Scenario) ([]metrics.Sink, error) {
+	var sinks []metrics.Sink
+	closeAll := func() {
+		for _, sink := range sinks {
+			sink.Close()
+		}
 	}
 
-	// Convert query params to string map
-	queryParams := make(map[string]interface{})
-	for key, value := range e.scenario.QueryParams {
-		queryParams[key] = value
+	if cfg.RawOut != "" {
+		raw, err := metrics.NewRawWriter(cfg.RawOut)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, raw)
 	}
 
-	return &protocols.Request{
-		Method:      e.scenario.Method,
-		URL:         fullURL,
-		Headers:     e.scenario.Headers,
-		Body:        bodyBytes,
-		Timeout:     e.scenario.GetTimeout(),
-		QueryParams: queryParams,
+	if len(cfg.Outputs) > 0 {
+		tags := []string{"scenario:" + scenario.Name}
+		for _, key := range sortedKeys(cfg.Labels) {
+			tags = append(tags, key+":"+cfg.Labels[key])
+		}
+		for _, output := range cfg.Outputs {
+			sink, err := metrics.NewSink(output, tags)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		}
 	}
+	return sinks, nil
+}
+
+// VURand returns the random source of a virtual user, derived from the seed
+func (e *LoadEngine) VURand(vu int) *rand.Rand {
+	return rand.New(rand.NewSource(e.config.Seed + int64(vu)*7919))
+}
+
+// newRunID returns a short random identifier distinguishing test runs
+func newRunID() string {
+	var b [4]byte
+	crand.Read(b[:])
+	return hex.EncodeToString(b[:])
 }
 
-// RecordResponse records a response in the metrics collector
-func (e *LoadEngine) RecordResponse(resp *protocols.Response) {
-	// Validate response
-	validationResult := e.validator.Validate(resp)
+// RecordResponse records a response in the metrics collector and reports
+// whether it passed validation
+func (e *LoadEngine) RecordResponse(resp *protocols.Response) bool {
+	return e.recordResponse(resp, e.validator)
+}
+
+// recordResponse records a response validated by the validator of its step
+func (e *LoadEngine) recordResponse(resp *protocols.Response, validator *validation.ResponseValidator) bool {
+	// A 304 to a conditional request is a cache hit; its empty body was
+	// validated when the response was first cached
+	if e.scenario.Cache.Enabled() && resp.Error == nil && resp.StatusCode == stdhttp.StatusNotModified {
+		e.collector.RecordValidation(true, "")
+		e.collector.RecordResult(resp, true)
+		return true
+	}
+
+	// Validate response, in full when it falls in the validation sample
+	var validationResult *validation.ValidationResult
+	if rate := validator.SampleRate(); rate >= 1 || e.validationSample.sample(rate) {
+		validationResult = validator.Validate(resp)
+	} else {
+		validationResult = validator.ValidateStatus(resp)
+		e.collector.RecordUnsampled()
+	}
 	e.collector.RecordValidation(validationResult.Passed, validationResult.ErrorType)
 
-	// Record response metrics
-	e.collector.RecordResponse(resp)
+	// Validation decides success; the status distribution is kept as-is
+	e.collector.RecordResult(resp, validationResult.Passed)
+
+	e.resources.capture(resp)
+
+	return validationResult.Passed
+}
+
+// RecordResponseFailure records a response that failed a check outside the
+// validator, such as a script hook
+func (e *LoadEngine) RecordResponseFailure(resp *protocols.Response, errorType string) {
+	e.collector.RecordValidation(false, errorType)
+	e.collector.RecordResult(resp, false)
+}
+
+// RecordTenant adds a request outcome to the breakdown of its tenant; requests
+// without a tenant are only in the totals
+func (e *LoadEngine) RecordTenant(tenant string, resp *protocols.Response, passed bool) {
+	if tenant == "" {
+		return
+	}
+	e.collector.RecordTenant(tenant, resp, passed)
+}
+
+// RecordEndpoint adds a request outcome to the breakdown of its endpoint;
+// ungrouped requests are only in the totals
+func (e *LoadEngine) RecordEndpoint(endpoint string, resp *protocols.Response, passed bool) {
+	if endpoint == "" {
+		return
+	}
+	e.collector.RecordEndpoint(endpoint, resp, passed)
+}
+
+// RecordStage adds a response to the breakdown of the load pattern stage its
+// request started in, when the pattern has stages
+func (e *LoadEngine) RecordStage(resp *protocols.Response, passed bool) {
+	staged, ok := e.pattern.(StagedPattern)
+	if !ok {
+		return
+	}
+	if stage := staged.Stage(e.Elapsed() - resp.ResponseTime); stage >= 0 {
+		e.collector.RecordStage(stage, resp, passed)
+	}
+}
+
+// describeStages names the stages of a summary after the phases of the load
+// pattern, with their offset, duration, intensity and throughput
+func (e *LoadEngine) describeStages(stages []*metrics.StageSummary, elapsed time.Duration) {
+	if rate, ok := e.pattern.(*RatePattern); ok {
+		rate.describeStages(stages, elapsed)
+		return
+	}
+	phased, ok := e.pattern.(*PhasedPattern)
+	if !ok {
+		return
+	}
+
+	starts := make([]time.Duration, len(phased.Phases))
+	var start time.Duration
+	for i, phase := range phased.Phases {
+		starts[i] = start
+		start += phase.Duration
+	}
+
+	for _, stage := range stages {
+		if stage.Stage >= len(phased.Phases) {
+			continue
+		}
+		phase := phased.Phases[stage.Stage]
+		stage.Name = phase.Name
+		stage.Start = starts[stage.Stage].String()
+		stage.Duration = phase.Duration.String()
+		stage.Intensity = phase.Intensity
+
+		// A stage cut short by the end of the test ran for less
+		ran := min(phase.Duration, elapsed-starts[stage.Stage])
+		if ran > 0 {
+			stage.RequestsPerSecond = float64(stage.Requests) / ran.Seconds()
+		}
+	}
 }
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+)
+
+// maxAllowValues bounds the distinct Allow values kept for OPTIONS
+const maxAllowValues = 20
+
+// methodTracker collects metrics that only make sense for some methods:
+// the body size HEAD responses declare without sending it, and the methods
+// OPTIONS responses advertise
+type methodTracker struct {
+	method string
+
+	mu            sync.Mutex
+	declaredBytes int64
+	allow         map[string]int64
+}
+
+// newMethodTracker returns a tracker, or nil for methods without specific metrics
+func newMethodTracker(method string) *methodTracker {
+	switch method {
+	case "HEAD", "OPTIONS":
+		return &methodTracker{method: method, allow: make(map[string]int64)}
+	}
+	return nil
+}
+
+// observe records the method-specific details of a response
+func (t *methodTracker) observe(resp *protocols.Response) {
+	if t == nil || resp == nil || resp.Error != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch t.method {
+	case "HEAD":
+		if _, value := findHeader(resp.Headers, "Content-Length"); value != "" {
+			if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+				t.declaredBytes += size
+			}
+		}
+	case "OPTIONS":
+		// CORS preflights answer with Access-Control-Allow-Methods instead
+		_, value := findHeader(resp.Headers, "Allow")
+		if value == "" {
+			_, value = findHeader(resp.Headers, "Access-Control-Allow-Methods")
+		}
+		value = strings.Join(strings.Fields(strings.ReplaceAll(value, ",", " ")), ", ")
+		if value == "" {
+			value = "(none)"
+		}
+		if _, exists := t.allow[value]; exists || len(t.allow) < maxAllowValues {
+			t.allow[value]++
+		}
+	}
+}
+
+// summary reports the metrics collected so far
+func (t *methodTracker) summary() *metrics.MethodSummary {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	summary := &metrics.MethodSummary{Method: t.method, DeclaredBytes: t.declaredBytes}
+	if len(t.allow) > 0 {
+		summary.Allow = make(map[string]int64, len(t.allow))
+		for value, count := range t.allow {
+			summary.Allow[value] = count
+		}
+	}
+
+	return summary
+}
@@ -0,0 +1,427 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/sirupsen/logrus"
+)
+
+// Batching of exported traces
+const (
+	// otlpBatchSpans sends a batch once it holds this many spans
+	otlpBatchSpans = 512
+	// otlpFlushInterval sends a partial batch after this long
+	otlpFlushInterval = time.Second
+	// otlpQueue is how many traces wait for export before new ones are dropped
+	otlpQueue = 4096
+	// otlpTimeout bounds each export request
+	otlpTimeout = 10 * time.Second
+)
+
+// OTLP span kinds and status codes
+const (
+	otlpKindInternal = 1
+	otlpKindClient   = 3
+	otlpStatusOK     = 1
+	otlpStatusError  = 2
+)
+
+// traceparentHeader propagates the request span to the target, so its own
+// spans join the iteration trace
+const traceparentHeader = "traceparent"
+
+// otlpSpan is a span in the OTLP/HTTP JSON encoding
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+
+	// start and end are encoded into the fields above on export
+	start time.Time
+	end   time.Time
+}
+
+// otlpAttribute is a key-value attribute of a span or resource
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// otlpStatus is the status of a span
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// stringAttribute creates a string attribute
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]interface{}{"stringValue": value}}
+}
+
+// intAttribute creates an integer attribute; OTLP JSON encodes int64 as a
+// string
+func intAttribute(key string, value int64) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}}
+}
+
+// doubleAttribute creates a floating-point attribute
+func doubleAttribute(key string, value float64) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]interface{}{"doubleValue": value}}
+}
+
+// otlpExporter sends one trace per sampled VU iteration to an OTLP/HTTP
+// collector such as Jaeger or Tempo. Traces are queued and exported in
+// batches in the background; when the collector cannot keep up, new traces
+// are dropped rather than slowing the test down.
+type otlpExporter struct {
+	url      string
+	client   *http.Client
+	sample   float64
+	scenario string
+	runID    string
+	// redact masks the URLs and errors of spans
+	redact *redactor
+
+	rngMu sync.Mutex
+	rng   *rand.Rand
+
+	queue   chan []otlpSpan
+	done    chan struct{}
+	dropped int64
+	failed  int64
+}
+
+// newOTLPExporter creates an exporter sending to endpoint, the base URL of
+// an OTLP/HTTP collector; /v1/traces is appended when it has no path
+func newOTLPExporter(endpoint string, sample float64, seed int64, scenario, runID string) (*otlpExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint: %s", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	if sample <= 0 || sample > 1 {
+		return nil, fmt.Errorf("OTLP sample rate must be above 0 and at most 1")
+	}
+
+	x := &otlpExporter{
+		url:      u.String(),
+		client:   &http.Client{Timeout: otlpTimeout},
+		sample:   sample,
+		scenario: scenario,
+		runID:    runID,
+		rng:      rand.New(rand.NewSource(seed)),
+		queue:    make(chan []otlpSpan, otlpQueue),
+		done:     make(chan struct{}),
+	}
+	go x.run()
+
+	return x, nil
+}
+
+// newID returns a random span or trace ID of n bytes, as hex
+func (x *otlpExporter) newID(n int) string {
+	id := make([]byte, n)
+	x.rngMu.Lock()
+	x.rng.Read(id)
+	x.rngMu.Unlock()
+	return hex.EncodeToString(id)
+}
+
+// sampled decides whether an iteration is traced
+func (x *otlpExporter) sampled() bool {
+	if x.sample >= 1 {
+		return true
+	}
+	x.rngMu.Lock()
+	defer x.rngMu.Unlock()
+	return x.rng.Float64() < x.sample
+}
+
+// beginIteration starts the trace of an iteration, or returns nil when the
+// exporter is disabled or the iteration is not sampled
+func (x *otlpExporter) beginIteration(vu, iteration int, requestID, tenant string) *iterationTrace {
+	if x == nil || !x.sampled() {
+		return nil
+	}
+
+	root := otlpSpan{
+		TraceID: x.newID(16),
+		SpanID:  x.newID(8),
+		Name:    x.scenario,
+		Kind:    otlpKindInternal,
+		Attributes: []otlpAttribute{
+			stringAttribute("gotsunami.run_id", x.runID),
+			intAttribute("gotsunami.vu", int64(vu)),
+			intAttribute("gotsunami.iteration", int64(iteration)),
+			stringAttribute("gotsunami.request_id", requestID),
+		},
+		start: time.Now(),
+	}
+	if tenant != "" {
+		root.Attributes = append(root.Attributes, stringAttribute("gotsunami.tenant", tenant))
+	}
+
+	return &iterationTrace{exporter: x, root: root, current: -1}
+}
+
+// enqueue queues the spans of a finished trace, dropping them when the
+// queue is full
+func (x *otlpExporter) enqueue(spans []otlpSpan) {
+	select {
+	case x.queue <- spans:
+	default:
+		atomic.AddInt64(&x.dropped, 1)
+	}
+}
+
+// run exports queued traces in batches until the queue is closed
+func (x *otlpExporter) run() {
+	defer close(x.done)
+
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	var batch []otlpSpan
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := x.export(batch); err != nil {
+			atomic.AddInt64(&x.failed, int64(len(batch)))
+			logrus.WithError(err).Debug("Failed to export OTLP traces")
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case spans, ok := <-x.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, spans...)
+			if len(batch) >= otlpBatchSpans {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// export sends a batch of spans
+func (x *otlpExporter) export(spans []otlpSpan) error {
+	for i := range spans {
+		spans[i].StartTimeUnixNano = strconv.FormatInt(spans[i].start.UnixNano(), 10)
+		spans[i].EndTimeUnixNano = strconv.FormatInt(spans[i].end.UnixNano(), 10)
+	}
+
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpAttribute{stringAttribute("service.name", "gotsunami")},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "gotsunami"},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), otlpTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, x.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := x.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Close exports the traces still queued
+func (x *otlpExporter) Close() error {
+	close(x.queue)
+	<-x.done
+
+	dropped, failed := atomic.LoadInt64(&x.dropped), atomic.LoadInt64(&x.failed)
+	if dropped > 0 || failed > 0 {
+		return fmt.Errorf("%d traces dropped by a full queue, %d spans failed to export", dropped, failed)
+	}
+	return nil
+}
+
+// iterationTrace collects the spans of one iteration: a root span, a child
+// span per request attempt and, under it, a span per latency phase. A nil
+// iterationTrace records nothing.
+type iterationTrace struct {
+	exporter *otlpExporter
+	root     otlpSpan
+	spans    []otlpSpan
+	// current is the index of the request span awaiting its response
+	current int
+	// parent is the traceparent value set on the request, if any
+	parent string
+}
+
+// request starts the span of an attempt of a step's request, counted from
+// 1, and propagates it to the target unless the scenario sets its own
+// traceparent
+func (t *iterationTrace) request(req *protocols.Request, s *step, attempt int) {
+	if t == nil {
+		return
+	}
+
+	span := otlpSpan{
+		TraceID:      t.root.TraceID,
+		SpanID:       t.exporter.newID(8),
+		ParentSpanID: t.root.SpanID,
+		Name:         req.Method + " " + s.route,
+		Kind:         otlpKindClient,
+		Attributes: []otlpAttribute{
+			stringAttribute("http.request.method", req.Method),
+			stringAttribute("http.route", s.route),
+			stringAttribute("url.full", t.exporter.redact.text(req.URL)),
+			intAttribute("gotsunami.attempt", int64(attempt)),
+		},
+		start: time.Now(),
+	}
+	if s.name != "" {
+		span.Attributes = append(span.Attributes, stringAttribute("gotsunami.step", s.name))
+	}
+	if attempt > 1 {
+		// The semantic convention counts resends only
+		span.Attributes = append(span.Attributes, intAttribute("http.request.resend_count", int64(attempt-1)))
+	}
+	t.spans = append(t.spans, span)
+	t.current = len(t.spans) - 1
+
+	key, value := findHeader(req.Headers, traceparentHeader)
+	if key == "" || value == t.parent {
+		if key == "" {
+			key = traceparentHeader
+		}
+		t.parent = fmt.Sprintf("00-%s-%s-01", span.TraceID, span.SpanID)
+		req.Headers[key] = t.parent
+	}
+}
+
+// response ends the request span with its outcome, the latency measured
+// like in the report and the latency phases
+func (t *iterationTrace) response(resp *protocols.Response, passed bool) {
+	if t == nil || t.current < 0 {
+		return
+	}
+
+	span := &t.spans[t.current]
+	span.end = time.Now()
+	if resp.StatusCode > 0 {
+		span.Attributes = append(span.Attributes, intAttribute("http.response.status_code", int64(resp.StatusCode)))
+	}
+	span.Attributes = append(span.Attributes,
+		intAttribute("http.response.body.size", resp.ContentLength),
+		doubleAttribute("gotsunami.latency_ms", float64(resp.ResponseTime)/float64(time.Millisecond)))
+	switch {
+	case resp.Error != nil:
+		span.Status = &otlpStatus{Code: otlpStatusError, Message: t.exporter.redact.text(resp.Error.Error())}
+	case !passed:
+		span.Status = &otlpStatus{Code: otlpStatusError, Message: "validation failed"}
+	default:
+		span.Status = &otlpStatus{Code: otlpStatusOK}
+	}
+	if span.Status.Code == otlpStatusError {
+		t.root.Status = &otlpStatus{Code: otlpStatusError, Message: span.Status.Message}
+	}
+
+	// Phases are relative to the start of the request in the protocol,
+	// which follows the span start closely
+	parent, traceID, start := span.SpanID, span.TraceID, span.start
+	for _, phase := range resp.Phases {
+		t.spans = append(t.spans, otlpSpan{
+			TraceID:      traceID,
+			SpanID:       t.exporter.newID(8),
+			ParentSpanID: parent,
+			Name:         phase.Name,
+			Kind:         otlpKindInternal,
+			start:        start.Add(phase.Start),
+			end:          start.Add(phase.End),
+		})
+	}
+	t.current = -1
+}
+
+// failure marks the iteration failed outside the request, such as a template
+// or script error
+func (t *iterationTrace) failure(stage string, err error) {
+	if t == nil {
+		return
+	}
+	t.root.Status = &otlpStatus{Code: otlpStatusError, Message: fmt.Sprintf("%s: %v", stage, err)}
+}
+
+// aborted ends the request span of a request abandoned at the end of the
+// drain period
+func (t *iterationTrace) aborted() {
+	if t == nil || t.current < 0 {
+		return
+	}
+	span := &t.spans[t.current]
+	span.end = time.Now()
+	span.Status = &otlpStatus{Code: otlpStatusError, Message: "aborted after the drain period"}
+	t.current = -1
+}
+
+// end ends the iteration and queues its trace for export
+func (t *iterationTrace) end() {
+	if t == nil {
+		return
+	}
+
+	now := time.Now()
+	t.root.end = now
+	if t.current >= 0 {
+		t.spans[t.current].end = now
+	}
+	if t.root.Status == nil {
+		t.root.Status = &otlpStatus{Code: otlpStatusOK}
+	}
+	t.exporter.enqueue(append([]otlpSpan{t.root}, t.spans...))
+}
@@ -0,0 +1,224 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/pkg/loadpattern"
+)
+
+// LoadPattern determines the load intensity over the course of a test
+type LoadPattern = loadpattern.Pattern
+
+// StagedPattern is implemented by load patterns made of discrete stages
+type StagedPattern = loadpattern.Staged
+
+// PatternFactory creates a load pattern for a test configuration
+type PatternFactory = loadpattern.Factory
+
+func init() {
+	loadpattern.Register("spike", newSpikePattern)
+	loadpattern.Register("steady", newSteadyPattern)
+	loadpattern.Register("ramp-up", newRampUpPattern)
+	loadpattern.Register("stress", newStressPattern)
+}
+
+// NewLoadPattern resolves the load pattern for a test. Stages, which start
+// iterations at a rate, take precedence over phases declared in the
+// scenario, which take precedence over the pattern selected on the command
+// line.
+func NewLoadPattern(cfg *config.LoadTestConfig) (LoadPattern, error) {
+	if stages := configStages(cfg); len(stages) > 0 {
+		return NewRatePattern(stages)
+	}
+
+	if cfg.Scenario != nil && cfg.Scenario.LoadPattern != nil && len(cfg.Scenario.LoadPattern.Phases) > 0 {
+		return NewScenarioPattern(cfg.Scenario.LoadPattern)
+	}
+
+	name := cfg.Pattern
+	if name == "" {
+		name = "steady"
+	}
+
+	factory, exists := loadpattern.Lookup(name)
+	if !exists {
+		return nil, fmt.Errorf("unknown load pattern: %s (available: %s)", name, strings.Join(loadpattern.Names(), ", "))
+	}
+
+	return factory(cfg), nil
+}
+
+// NewScenarioPattern builds a phased pattern from a scenario declaration
+func NewScenarioPattern(patternConfig *config.LoadPatternConfig) (*PhasedPattern, error) {
+	pattern := &PhasedPattern{
+		Type:   "custom",
+		Phases: make([]LoadPhase, 0, len(patternConfig.Phases)),
+	}
+	if patternConfig.Name != "" {
+		pattern.Type = patternConfig.Name
+	}
+
+	for i, phase := range patternConfig.Phases {
+		duration, err := time.ParseDuration(phase.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration in phase %d: %s", i+1, phase.Duration)
+		}
+		pattern.Phases = append(pattern.Phases, LoadPhase{
+			Duration:  duration,
+			Intensity: phase.Intensity,
+			Ramp:      phase.Ramp,
+			Name:      phase.Name,
+		})
+	}
+
+	return pattern, nil
+}
+
+// PhasedPattern is a load pattern made of consecutive phases
+type PhasedPattern struct {
+	Type   string      `json:"type"`
+	Phases []LoadPhase `json:"phases"`
+}
+
+// LoadPhase represents a phase in a load pattern
+type LoadPhase struct {
+	Duration  time.Duration `json:"duration"`
+	Intensity float64       `json:"intensity"` // 0.0 to 2.0 (0% to 200% of base load)
+	Ramp      bool          `json:"ramp"`      // ramp linearly from the previous phase's intensity
+
+	// Name labels the phase in reports
+	Name string `json:"name,omitempty"`
+}
+
+// Name returns the pattern name
+func (p *PhasedPattern) Name() string {
+	return p.Type
+}
+
+// Intensity returns the intensity of the phase active at elapsed. Once all
+// phases are over the pattern holds full load.
+func (p *PhasedPattern) Intensity(elapsed time.Duration) float64 {
+	var phaseStart time.Duration
+	previous := 0.0
+
+	for _, phase := range p.Phases {
+		if elapsed < phaseStart+phase.Duration {
+			if !phase.Ramp || phase.Duration == 0 {
+				return phase.Intensity
+			}
+			progress := float64(elapsed-phaseStart) / float64(phase.Duration)
+			return previous + (phase.Intensity-previous)*progress
+		}
+		phaseStart += phase.Duration
+		previous = phase.Intensity
+	}
+
+	return 1.0
+}
+
+// Stage returns the index of the phase active at elapsed
+func (p *PhasedPattern) Stage(elapsed time.Duration) int {
+	var phaseStart time.Duration
+	for i, phase := range p.Phases {
+		phaseStart += phase.Duration
+		if elapsed < phaseStart {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// newSpikePattern creates the spike load pattern
+func newSpikePattern(cfg *config.LoadTestConfig) LoadPattern {
+	duration := cfg.Duration
+
+	return &PhasedPattern{
+		Type: "spike",
+		Phases: []LoadPhase{
+			{
+				Duration:  duration / 4,
+				Intensity: 0.2, // 20% of max load
+			},
+			{
+				Duration:  duration / 4,
+				Intensity: 1.0, // 100% of max load (spike)
+			},
+			{
+				Duration:  duration / 2,
+				Intensity: 0.2, // Back to 20%
+			},
+		},
+	}
+}
+
+// newSteadyPattern creates the steady load pattern
+func newSteadyPattern(cfg *config.LoadTestConfig) LoadPattern {
+	rampUp, rampDown := cfg.RampUp, cfg.RampDown
+
+	// Shrink ramps proportionally when they don't fit in the test
+	if total := rampUp + rampDown; total > cfg.Duration && total > 0 {
+		rampUp = time.Duration(float64(cfg.Duration) * float64(rampUp) / float64(total))
+		rampDown = cfg.Duration - rampUp
+	}
+
+	return &PhasedPattern{
+		Type: "steady",
+		Phases: []LoadPhase{
+			{
+				Duration:  rampUp,
+				Intensity: 1.0, // Ramp up from 0
+				Ramp:      true,
+			},
+			{
+				Duration:  cfg.Duration - rampUp - rampDown,
+				Intensity: 1.0, // Full load
+			},
+			{
+				Duration:  rampDown,
+				Intensity: 0.0, // Ramp down to 0
+				Ramp:      true,
+			},
+		},
+	}
+}
+
+// newRampUpPattern creates the ramp-up load pattern
+func newRampUpPattern(cfg *config.LoadTestConfig) LoadPattern {
+	return &PhasedPattern{
+		Type: "ramp-up",
+		Phases: []LoadPhase{
+			{
+				Duration:  cfg.Duration,
+				Intensity: 1.0, // Linear ramp from 0 to 1
+				Ramp:      true,
+			},
+		},
+	}
+}
+
+// newStressPattern creates the stress test pattern
+func newStressPattern(cfg *config.LoadTestConfig) LoadPattern {
+	duration := cfg.Duration
+
+	return &PhasedPattern{
+		Type: "stress",
+		Phases: []LoadPhase{
+			{
+				Duration:  duration / 3,
+				Intensity: 0.5, // 50% load
+			},
+			{
+				Duration:  duration / 3,
+				Intensity: 1.0, // 100% load
+			},
+			{
+				Duration:  duration / 3,
+				Intensity: 1.5, // 150% load (stress)
+			},
+		},
+	}
+}
@@ -0,0 +1,273 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/validation"
+)
+
+// PlanAssumptions are what a plan cannot know before the test runs
+type PlanAssumptions struct {
+	// Latency is the response time assumed for every request; 0 makes the
+	// plan an upper bound
+	Latency time.Duration
+	// ResponseSize is the size assumed for every response, in bytes; 0
+	// leaves the data received out of the plan
+	ResponseSize int64
+}
+
+// Plan estimates what a test will send before it runs. Workers never send
+// faster than the load pattern lets them, so with no assumed latency every
+// figure is an upper bound; throttling, failures and retries only lower it.
+type Plan struct {
+	Scenario string
+	Pattern  string
+	Duration time.Duration
+	// VUs is the number of workers sending requests concurrently
+	VUs int
+	// StepsPerIteration is the number of requests of every iteration
+	StepsPerIteration int
+	Phases            []PlanPhase
+
+	Requests int64
+	PeakRPS  float64
+	// RequestSize is the estimated size of one request, in bytes, with its
+	// templates unexpanded
+	RequestSize int64
+	BytesSent   int64
+	// BytesReceived is 0 unless a response size is assumed
+	BytesReceived int64
+
+	// Warmup is the longest warm-up sent before the test, at WarmupVUs
+	// without pacing, which the estimates leave out
+	Warmup    time.Duration
+	WarmupVUs int
+
+	Assumptions PlanAssumptions
+}
+
+// PlanPhase is one phase of a phased load pattern, cut to the test duration
+type PlanPhase struct {
+	Name     string
+	Start    time.Duration
+	Duration time.Duration
+	// From and To are the intensities at the start and end of the phase
+	From float64
+	To   float64
+	// PeakRPS is the highest request rate reached during the phase
+	PeakRPS float64
+}
+
+// NewPlan estimates the requests, peak rate and data transfer of a test by
+// replaying the pacing of a worker: each iteration waits for the pattern
+// delay, sends its steps, then waits for the configured delay.
+func NewPlan(cfg *config.LoadTestConfig, scenario *config.Scenario, assumptions PlanAssumptions) (*Plan, error) {
+	pattern, err := NewLoadPattern(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	_, contentType := findHeader(scenario.Headers, "Content-Type")
+	body, err := newRequestBody(scenario.Body, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body: %w", err)
+	}
+	steps, err := newSteps(scenario, body, func(*config.ValidationConfig, string) *validation.ResponseValidator { return nil })
+	if err != nil {
+		return nil, err
+	}
+
+	workers := cfg.Workers
+	if workers == 0 {
+		workers = cfg.VirtualUsers
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+
+	plan := &Plan{
+		Scenario:          scenario.Name,
+		Pattern:           pattern.Name(),
+		Duration:          cfg.Duration,
+		VUs:               workers,
+		StepsPerIteration: len(steps),
+		Assumptions:       assumptions,
+	}
+	if cfg.Warmup > 0 {
+		plan.Warmup = cfg.Warmup
+		plan.WarmupVUs = cfg.WarmupVUs
+		if plan.WarmupVUs <= 0 {
+			plan.WarmupVUs = 1
+		}
+	}
+	for _, s := range steps {
+		size, err := s.estimatedSize()
+		if err != nil {
+			return nil, err
+		}
+		plan.RequestSize += size
+	}
+	if len(steps) > 0 {
+		plan.RequestSize /= int64(len(steps))
+	}
+
+	// Iterations of stages start at their rate, up to one in flight per VU
+	if rate, ok := pattern.(*RatePattern); ok {
+		rate.planArrivals(plan, workers, cfg.MaxRequests, time.Duration(len(steps))*assumptions.Latency)
+		return plan, nil
+	}
+
+	// The time an iteration takes besides the pattern delay
+	busy := time.Duration(len(steps))*assumptions.Latency + cfg.Delay
+	rate := func(elapsed time.Duration) float64 {
+		return float64(workers*len(steps)) / (PatternDelay(pattern, elapsed) + busy).Seconds()
+	}
+
+	// Every worker paces itself alike, so one stands for all of them
+	var iterations int64
+	for elapsed := time.Duration(0); cfg.MaxRequests <= 0 || iterations < int64(cfg.MaxRequests); {
+		elapsed += PatternDelay(pattern, elapsed)
+		if elapsed >= cfg.Duration {
+			break
+		}
+		if r := rate(elapsed); r > plan.PeakRPS {
+			plan.PeakRPS = r
+		}
+		iterations++
+		elapsed += busy
+	}
+
+	plan.Requests = iterations * int64(workers*len(steps))
+	plan.BytesSent = plan.Requests * plan.RequestSize
+	plan.BytesReceived = plan.Requests * assumptions.ResponseSize
+
+	if phased, ok := pattern.(*PhasedPattern); ok {
+		plan.Phases = phased.plan(cfg.Duration, rate)
+	}
+
+	return plan, nil
+}
+
+// planArrivals fills in the plan of the stages: each starts iterations at
+// its rate, or as fast as the VUs finish them when an iteration takes busy
+func (p *RatePattern) planArrivals(plan *Plan, workers, maxRequests int, busy time.Duration) {
+	steps := float64(plan.StepsPerIteration)
+	capacity := math.Inf(1)
+	if busy > 0 {
+		capacity = float64(workers) / busy.Seconds()
+	}
+
+	plan.Duration = p.Duration()
+	iterations := 0.0
+	var start time.Duration
+	previous := 0.0
+	for i, stage := range p.Stages {
+		planned := PlanPhase{
+			Name:     stage.Name,
+			Start:    start,
+			Duration: stage.Duration,
+			From:     previous / p.peak,
+			To:       stage.Target / p.peak,
+			PeakRPS:  min(max(previous, stage.Target), capacity) * steps,
+		}
+		if planned.Name == "" {
+			planned.Name = fmt.Sprintf("stage %d", i+1)
+		}
+		if stage.Duration == 0 {
+			planned.From = planned.To
+		}
+		plan.Phases = append(plan.Phases, planned)
+		plan.PeakRPS = max(plan.PeakRPS, planned.PeakRPS)
+
+		// Sum the rate, capped by what the VUs keep up with, over slices of
+		// the stage
+		const slices = 1000
+		width := stage.Duration.Seconds() / slices
+		for j := 0; j < slices; j++ {
+			at := (float64(j) + 0.5) / slices
+			iterations += min(previous+(stage.Target-previous)*at, capacity) * width
+		}
+
+		start += stage.Duration
+		previous = stage.Target
+	}
+
+	total := int64(iterations)
+	if maxRequests > 0 {
+		total = min(total, int64(maxRequests*workers))
+	}
+	plan.Requests = total * int64(plan.StepsPerIteration)
+	plan.BytesSent = plan.Requests * plan.RequestSize
+	plan.BytesReceived = plan.Requests * plan.Assumptions.ResponseSize
+}
+
+// plan lists the phases starting within duration with the peak rate of
+// each, computed by rate at their start and end
+func (p *PhasedPattern) plan(duration time.Duration, rate func(time.Duration) float64) []PlanPhase {
+	var phases []PlanPhase
+	var start time.Duration
+	previous := 0.0
+	for i, phase := range p.Phases {
+		if start >= duration {
+			break
+		}
+		length := phase.Duration
+		if start+length > duration {
+			length = duration - start
+		}
+
+		planned := PlanPhase{
+			Name:     phase.Name,
+			Start:    start,
+			Duration: length,
+			From:     phase.Intensity,
+			To:       phase.Intensity,
+		}
+		if planned.Name == "" {
+			planned.Name = fmt.Sprintf("phase %d", i+1)
+		}
+		if phase.Ramp && phase.Duration > 0 {
+			planned.From = previous
+			planned.To = previous + (phase.Intensity-previous)*float64(length)/float64(phase.Duration)
+		}
+
+		planned.PeakRPS = rate(start)
+		if length > 0 {
+			if end := rate(start + length - time.Nanosecond); end > planned.PeakRPS {
+				planned.PeakRPS = end
+			}
+		}
+		phases = append(phases, planned)
+
+		start += phase.Duration
+		previous = phase.Intensity
+	}
+	return phases
+}
+
+// estimatedSize returns the approximate size of the step's request on the
+// wire, its request line, headers and body, with templates unexpanded
+func (s *step) estimatedSize() (int64, error) {
+	size := len(s.method) + len(s.url) + len(" HTTP/1.1\r\n")
+	for key, value := range s.headers {
+		size += len(key) + len(value) + len(": \r\n")
+	}
+	for key, value := range s.queryParams {
+		size += len(key) + len(fmt.Sprint(value)) + len("&=")
+	}
+	size += len("\r\n")
+
+	if s.body.value != nil {
+		encoded, err := s.body.encode(s.body.value)
+		if err != nil {
+			return 0, err
+		}
+		size += len(encoded)
+	} else {
+		size += len(s.body.raw)
+	}
+	return int64(size), nil
+}
@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/alexandredias/gotsunami/internal/scripting"
+	"github.com/sirupsen/logrus"
+)
+
+// Preflight sends a single probe request and fails fast if the target is
+// unreachable or the response does not pass validation, so a broken scenario
+// doesn't burn the whole test duration on errors
+func (e *LoadEngine) Preflight(ctx context.Context) error {
+	req, err := e.CreateRequest(e.VURand(0))
+	if err != nil {
+		return fmt.Errorf("preflight request could not be built: %w", err)
+	}
+
+	if path := e.scenario.Script; path != "" {
+		script, err := scripting.Load(path)
+		if err != nil {
+			return err
+		}
+		defer script.Close()
+
+		if err := script.TransformRequest(req); err != nil {
+			return fmt.Errorf("preflight script failed: %w", err)
+		}
+	}
+
+	e.signer.sign(req)
+
+	logrus.Infof("Preflight: %s %s", req.Method, req.URL)
+
+	ctx, cancel := context.WithTimeout(ctx, req.Timeout)
+	defer cancel()
+
+	resp, err := e.steps[0].sender(e.protocol).Execute(ctx, req)
+	if err == nil && resp != nil {
+		err = resp.Error
+	}
+	if err != nil {
+		return fmt.Errorf("preflight request failed: %s: %w", describeProbeError(err), err)
+	}
+
+	// The probe may have created a resource too
+	e.resources.capture(resp)
+
+	if resp.StatusCode == 401 || resp.StatusCode == 403 {
+		return fmt.Errorf("preflight request failed: authentication rejected with status %d", resp.StatusCode)
+	}
+
+	if result := e.validator.Validate(resp); !result.Passed {
+		return fmt.Errorf("preflight response failed validation (%s): %s", result.ErrorType, result.Message)
+	}
+
+	logrus.Infof("Preflight passed: status %d in %v", resp.StatusCode, resp.ResponseTime)
+
+	return nil
+}
+
+// describeProbeError names the layer a probe failed at
+func describeProbeError(err error) string {
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return fmt.Sprintf("DNS lookup of %s failed", dnsErr.Name)
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr):
+		return "TLS certificate verification failed"
+	case errors.As(err, &recordErr):
+		return "TLS handshake failed"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "request timed out"
+	default:
+		return "target unreachable"
+	}
+}
@@ -0,0 +1,226 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+)
+
+// redacted replaces every masked value
+const redacted = "[REDACTED]"
+
+// redactor masks sensitive values before they are written to reports, raw
+// results, traces or OTLP spans; a nil redactor leaves everything as is
+type redactor struct {
+	headers  map[string]bool
+	fields   [][]string
+	patterns []*regexp.Regexp
+}
+
+// newRedactor returns a redactor, or nil when nothing is redacted
+func newRedactor(cfg *config.RedactionConfig) (*redactor, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	r := &redactor{headers: make(map[string]bool)}
+	for _, header := range cfg.Headers {
+		r.headers[strings.ToLower(header)] = true
+	}
+	for _, path := range cfg.Fields {
+		r.fields = append(r.fields, strings.Split(path, "."))
+	}
+	for _, pattern := range cfg.Patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, compiled)
+	}
+	return r, nil
+}
+
+// withSecrets returns a redactor that also masks the values of secrets,
+// creating one when nothing else is redacted
+func (r *redactor) withSecrets(secrets map[string]string) *redactor {
+	values := make([]string, 0, len(secrets))
+	for _, value := range secrets {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return r
+	}
+
+	if r == nil {
+		r = &redactor{headers: make(map[string]bool)}
+	}
+	// Mask longer values first, so one containing another is masked whole
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+		return values[i] < values[j]
+	})
+	for _, value := range values {
+		r.patterns = append(r.patterns, regexp.MustCompile(regexp.QuoteMeta(value)))
+	}
+	return r
+}
+
+// text masks the matches of the patterns in s
+func (r *redactor) text(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, pattern := range r.patterns {
+		s = pattern.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+// headerValues returns a copy of headers with the values of the redacted
+// headers masked and the patterns masked in the others
+func (r *redactor) headerValues(headers map[string]string) map[string]string {
+	if r == nil || len(headers) == 0 {
+		return headers
+	}
+
+	masked := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if r.headers[strings.ToLower(name)] {
+			masked[name] = redacted
+		} else {
+			masked[name] = r.text(value)
+		}
+	}
+	return masked
+}
+
+// values returns a copy of values with the patterns masked, such as the
+// variables resolved for an iteration
+func (r *redactor) values(values map[string]string) map[string]string {
+	if r == nil || len(values) == 0 {
+		return values
+	}
+
+	masked := make(map[string]string, len(values))
+	for name, value := range values {
+		masked[name] = r.text(value)
+	}
+	return masked
+}
+
+// body masks the redacted fields of a JSON body, then the patterns
+func (r *redactor) body(body []byte) []byte {
+	if r == nil || len(body) == 0 {
+		return body
+	}
+
+	if len(r.fields) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+
+		var document interface{}
+		if err := decoder.Decode(&document); err == nil {
+			changed := false
+			for _, path := range r.fields {
+				changed = maskField(document, path) || changed
+			}
+			// Bodies without redacted fields keep their formatting
+			if changed {
+				if masked, err := json.Marshal(document); err == nil {
+					body = masked
+				}
+			}
+		}
+	}
+
+	if len(r.patterns) == 0 {
+		return body
+	}
+	return []byte(r.text(string(body)))
+}
+
+// maskField replaces a field of a decoded JSON document, in every element of
+// the arrays the path crosses, and reports whether it was found
+func maskField(document interface{}, path []string) bool {
+	switch value := document.(type) {
+	case map[string]interface{}:
+		child, exists := value[path[0]]
+		if !exists {
+			return false
+		}
+		if len(path) == 1 {
+			value[path[0]] = redacted
+			return true
+		}
+		return maskField(child, path[1:])
+	case []interface{}:
+		found := false
+		for _, element := range value {
+			found = maskField(element, path) || found
+		}
+		return found
+	}
+	return false
+}
+
+// summary masks the patterns in the parts of a summary taken from requests
+// and responses: error messages, endpoint names, captured header values,
+// hook output and compared URLs
+func (r *redactor) summary(summary *metrics.Summary) {
+	if r == nil {
+		return
+	}
+
+	// Values of captured headers are masked like the headers themselves
+	for header, values := range summary.Headers {
+		if r.headers[strings.ToLower(header)] {
+			summary.Headers[header] = metrics.MergeHeaderValues(values, func(value string) string {
+				if value == metrics.MissingHeader || value == metrics.OtherHeaderValues {
+					return value
+				}
+				return redacted
+			})
+		} else if len(r.patterns) > 0 {
+			summary.Headers[header] = metrics.MergeHeaderValues(values, r.text)
+		}
+	}
+	if len(r.patterns) == 0 {
+		return
+	}
+
+	// Errors differing only by a masked value are counted together
+	errors := make(map[string]int64, len(summary.Errors))
+	for message, count := range summary.Errors {
+		errors[r.text(message)] += count
+	}
+	summary.Errors = errors
+
+	if summary.Endpoints != nil {
+		endpoints := make(map[string]*metrics.EndpointSummary, len(summary.Endpoints))
+		for name, endpoint := range summary.Endpoints {
+			name = r.text(name)
+			endpoints[name] = metrics.MergeEndpointSummaries(endpoints[name], endpoint)
+		}
+		summary.Endpoints = endpoints
+	}
+
+	for i := range summary.Hooks {
+		summary.Hooks[i].Output = r.text(summary.Hooks[i].Output)
+		summary.Hooks[i].Error = r.text(summary.Hooks[i].Error)
+	}
+	if summary.Consistency != nil {
+		for i := range summary.Consistency.URLs {
+			summary.Consistency.URLs[i].URL = r.text(summary.Consistency.URLs[i].URL)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package engine
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// validationSampler picks the responses validated in full when their
+// validator samples them, from a random source derived from the seed
+type validationSampler struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func newValidationSampler(seed int64) *validationSampler {
+	return &validationSampler{rng: rand.New(rand.NewSource(seed))}
+}
+
+// sample reports whether a response falls in a sample of the given rate
+func (s *validationSampler) sample(rate float64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rng.Float64() < rate
+}
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+)
+
+// signer adds an HMAC signature to every request; a nil signer leaves
+// requests unsigned
+type signer struct {
+	config *config.SigningConfig
+	key    []byte
+	hash   func() hash.Hash
+}
+
+// newSigner returns a signer, or nil when requests are not signed
+func newSigner(cfg *config.SigningConfig) (*signer, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	key, err := cfg.Key()
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing secret: %w", err)
+	}
+
+	s := &signer{config: cfg, key: key, hash: sha256.New}
+	switch cfg.Algorithm {
+	case "sha1":
+		s.hash = sha1.New
+	case "sha512":
+		s.hash = sha512.New
+	}
+	return s, nil
+}
+
+// sign sets the signature header, and the timestamp header when it is
+// signed, from the request as it is about to be sent
+func (s *signer) sign(req *protocols.Request) {
+	if s == nil {
+		return
+	}
+
+	mac := hmac.New(s.hash, s.key)
+	mac.Write([]byte(s.canonical(req, time.Now())))
+	sum := mac.Sum(nil)
+
+	signature := hex.EncodeToString(sum)
+	if s.config.Encoding == "base64" {
+		signature = base64.StdEncoding.EncodeToString(sum)
+	}
+	setHeader(req, s.config.GetHeader(), s.config.Prefix+signature)
+}
+
+// canonical builds the string signed for req, setting the timestamp header
+// when the timestamp is one of the components
+func (s *signer) canonical(req *protocols.Request, now time.Time) string {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		u = &url.URL{Path: req.URL}
+	}
+
+	// Signed headers may include the timestamp header, so set it first
+	components := s.config.GetComponents()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	for _, component := range components {
+		if component == config.SignTimestamp {
+			setHeader(req, s.config.GetTimestampHeader(), timestamp)
+		}
+	}
+
+	parts := make([]string, len(components))
+	for i, component := range components {
+		switch component {
+		case config.SignMethod:
+			parts[i] = strings.ToUpper(req.Method)
+		case config.SignPath:
+			parts[i] = u.EscapedPath()
+			if parts[i] == "" {
+				parts[i] = "/"
+			}
+		case config.SignQuery:
+			parts[i] = canonicalQuery(u.Query(), req.QueryParams)
+		case config.SignBody:
+			parts[i] = string(req.Body)
+		case config.SignBodySHA256:
+			sum := sha256.Sum256(req.Body)
+			parts[i] = hex.EncodeToString(sum[:])
+		case config.SignTimestamp:
+			parts[i] = timestamp
+		default:
+			_, parts[i] = findHeader(req.Headers, strings.TrimPrefix(component, config.SignHeader))
+		}
+	}
+	return strings.Join(parts, s.config.GetSeparator())
+}
+
+// canonicalQuery encodes the query of the URL and the query parameters
+// added when the request is sent, sorted by name, then value, since the
+// parameters are sent in no particular order
+func canonicalQuery(query url.Values, params map[string]interface{}) string {
+	for name, value := range params {
+		query.Add(name, fmt.Sprint(value))
+	}
+
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, url.QueryEscape(name)+"="+url.QueryEscape(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// setHeader sets a header, replacing it in whatever case the scenario wrote it
+func setHeader(req *protocols.Request, name, value string) {
+	if key, _ := findHeader(req.Headers, name); key != "" {
+		name = key
+	}
+	if req.Headers == nil {
+		req.Headers = make(map[string]string)
+	}
+	req.Headers[name] = value
+}
@@ -0,0 +1,334 @@
+package engine
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/alexandredias/gotsunami/internal/protocols/http"
+	"github.com/alexandredias/gotsunami/internal/validation"
+	"github.com/alexandredias/gotsunami/pkg/templates"
+	"github.com/tidwall/gjson"
+)
+
+// step is a request sent in every iteration: the scenario's own request, or
+// one step of its chain
+type step struct {
+	// name is empty for the scenario's own request
+	name        string
+	method      string
+	route       string
+	url         string
+	headers     map[string]string
+	queryParams map[string]interface{}
+	// headerKeys and queryKeys are the names of the headers and query
+	// params in order, sorted once rather than for every request
+	headerKeys []string
+	queryKeys  []string
+	// urlTemplate, headerTemplates (in the order of headerKeys) and
+	// queryTemplates (string query params only) are compiled once rather
+	// than parsed for every request
+	urlTemplate     *templates.Template
+	headerTemplates []*templates.Template
+	queryTemplates  map[string]*templates.Template
+	body            *requestBody
+	validator       *validation.ResponseValidator
+	extract         []*extractRule
+	// timeout bounds each request of the step
+	timeout time.Duration
+	// interval is the time between two sends of a paced step, 0 when the
+	// step is sent in every iteration
+	interval time.Duration
+
+	// config is the step of the scenario, nil for the scenario's own request
+	config *config.StepConfig
+	// protocol sends the step when it uses another protocol than the
+	// scenario, nil otherwise
+	protocol protocols.Protocol
+}
+
+// extractRule reads one variable from a response
+type extractRule struct {
+	variable   string
+	source     string
+	expression string
+	regex      *regexp.Regexp
+}
+
+// newExtractRules compiles the extract rules of a request, sorted by variable
+func newExtractRules(extract map[string]string) ([]*extractRule, error) {
+	rules := make([]*extractRule, 0, len(extract))
+	for _, variable := range sortedKeys(extract) {
+		rule := &extractRule{variable: variable}
+		rule.source, rule.expression = config.ParseExtract(extract[variable])
+		if rule.source == config.ExtractRegex {
+			regex, err := regexp.Compile(rule.expression)
+			if err != nil {
+				return nil, fmt.Errorf("invalid extract regex of %s: %w", variable, err)
+			}
+			rule.regex = regex
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// value reads the rule's value from resp, reporting whether it was found
+func (r *extractRule) value(resp *protocols.Response) (string, bool) {
+	switch r.source {
+	case config.ExtractHeader:
+		name, value := findHeader(resp.Headers, r.expression)
+		return value, name != ""
+	case config.ExtractRegex:
+		match := r.regex.FindSubmatch(resp.Body)
+		if match == nil {
+			return "", false
+		}
+		if len(match) > 1 {
+			return string(match[1]), true
+		}
+		return string(match[0]), true
+	default:
+		result := gjson.GetBytes(resp.Body, r.expression)
+		return result.String(), result.Exists()
+	}
+}
+
+// newSteps returns the requests of an iteration. newValidator builds the
+// validator of a step from its rules and method.
+func newSteps(scenario *config.Scenario, body *requestBody, newValidator func(*config.ValidationConfig, string) *validation.ResponseValidator) ([]*step, error) {
+	if len(scenario.Steps) == 0 {
+		extract, err := newExtractRules(scenario.Extract)
+		if err != nil {
+			return nil, err
+		}
+		s := &step{
+			method:      scenario.Method,
+			route:       scenario.URL,
+			url:         scenario.BaseURL + scenario.URL,
+			headers:     scenario.Headers,
+			queryParams: scenario.QueryParams,
+			headerKeys:  sortedKeys(scenario.Headers),
+			queryKeys:   sortedKeys(scenario.QueryParams),
+			body:        body,
+			validator:   newValidator(scenario.Validation, scenario.Method),
+			extract:     extract,
+			timeout:     scenario.GetTimeout(),
+		}
+		if err := s.compile(); err != nil {
+			return nil, err
+		}
+		return []*step{s}, nil
+	}
+
+	steps := make([]*step, len(scenario.Steps))
+	for i, cfg := range scenario.Steps {
+		headers := make(map[string]string, len(scenario.Headers)+len(cfg.Headers))
+		for key, value := range scenario.Headers {
+			headers[key] = value
+		}
+		for key, value := range cfg.Headers {
+			// Replace the scenario header whatever case either is written in
+			if existing, _ := findHeader(headers, key); existing != "" {
+				delete(headers, existing)
+			}
+			headers[key] = value
+		}
+
+		_, contentType := findHeader(headers, "Content-Type")
+		stepBody, err := newRequestBody(cfg.Body, contentType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body of %s: %w", cfg.GetName(i), err)
+		}
+
+		extract, err := newExtractRules(cfg.Extract)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cfg.GetName(i), err)
+		}
+
+		rules := cfg.Validation
+		if rules == nil {
+			rules = scenario.Validation
+		}
+		steps[i] = &step{
+			name:        cfg.GetName(i),
+			method:      cfg.Method,
+			route:       cfg.URL,
+			url:         cfg.GetBaseURL(scenario) + cfg.URL,
+			headers:     headers,
+			queryParams: cfg.QueryParams,
+			headerKeys:  sortedKeys(headers),
+			queryKeys:   sortedKeys(cfg.QueryParams),
+			body:        stepBody,
+			validator:   newValidator(rules, cfg.Method),
+			extract:     extract,
+			timeout:     cfg.GetTimeout(scenario),
+			config:      &scenario.Steps[i],
+		}
+		if cfg.Rate > 0 {
+			steps[i].interval = time.Duration(float64(time.Second) / cfg.Rate)
+		}
+		if err := steps[i].compile(); err != nil {
+			return nil, fmt.Errorf("%s: %w", steps[i].name, err)
+		}
+	}
+	return steps, nil
+}
+
+// allPaced reports whether every step is paced, so iterations have to wait
+// for one to be due rather than send nothing
+func allPaced(steps []*step) bool {
+	for _, s := range steps {
+		if s.interval == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// compile parses the templates of the step's URL, headers and query params
+func (s *step) compile() error {
+	var err error
+	if s.urlTemplate, err = templates.Compile(s.url); err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+
+	s.headerTemplates = make([]*templates.Template, len(s.headerKeys))
+	for i, key := range s.headerKeys {
+		if s.headerTemplates[i], err = templates.Compile(s.headers[key]); err != nil {
+			return fmt.Errorf("header %s: %w", key, err)
+		}
+	}
+
+	s.queryTemplates = make(map[string]*templates.Template, len(s.queryParams))
+	for key, value := range s.queryParams {
+		if str, ok := value.(string); ok {
+			if s.queryTemplates[key], err = templates.Compile(str); err != nil {
+				return fmt.Errorf("query param %s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// newStepProtocols creates the protocol of every step sent with another
+// protocol than the scenario's, returning the ones it created. Steps sent
+// over HTTP share one client built from httpConfig; any other protocol gets
+// an instance per step, from the step's protocol_config.
+func newStepProtocols(scenario *config.Scenario, steps []*step, httpConfig *http.Config) ([]protocols.Protocol, error) {
+	var created []protocols.Protocol
+	var httpClient protocols.Protocol
+	for _, s := range steps {
+		if s.config == nil || s.config.SameProtocol(scenario) {
+			continue
+		}
+
+		if s.config.IsHTTP(scenario) {
+			if httpClient == nil {
+				httpClient = http.NewHTTPClient(httpConfig)
+				created = append(created, httpClient)
+			}
+			s.protocol = httpClient
+			continue
+		}
+
+		protocol, err := protocols.New(s.config.Protocol, s.config.ProtocolConfig)
+		if err != nil {
+			closeAll(created)
+			return nil, fmt.Errorf("failed to create %s protocol of %s: %w", s.config.Protocol, s.name, err)
+		}
+		created = append(created, protocol)
+		// A session per VU, such as a WebSocket, would outlive the step
+		if perVU, ok := protocol.(protocols.PerVU); ok && perVU.PerVU() {
+			closeAll(created)
+			return nil, fmt.Errorf("%s: the %s protocol keeps a session per VU and can only be the scenario's protocol", s.name, s.config.Protocol)
+		}
+		s.protocol = protocol
+	}
+	return created, nil
+}
+
+// closeAll closes every protocol of a list
+func closeAll(list []protocols.Protocol) {
+	for _, protocol := range list {
+		protocol.Close()
+	}
+}
+
+// sender returns the protocol the step is sent with: its own, or else vu,
+// the protocol of the VU sending it
+func (s *step) sender(vu protocols.Protocol) protocols.Protocol {
+	if s.protocol != nil {
+		return s.protocol
+	}
+	return vu
+}
+
+// buildRequest expands the templates of a step with the variables of the
+// iteration
+func (e *LoadEngine) buildRequest(s *step, variables map[string]string, rng *rand.Rand) (*protocols.Request, error) {
+	// Build full URL
+	fullURL, err := s.urlTemplate.Expand(variables, rng)
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+
+	headers := make(map[string]string, len(s.headers))
+	for i, key := range s.headerKeys {
+		expanded, err := s.headerTemplates[i].Expand(variables, rng)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", key, err)
+		}
+		headers[key] = expanded
+	}
+
+	body, err := s.body.Encode(variables, rng)
+	if err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+	if contentType := s.body.ContentType(); contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+
+	// Expand string query params; other values are sent as-is
+	queryParams := make(map[string]interface{}, len(s.queryParams))
+	for _, key := range s.queryKeys {
+		value := s.queryParams[key]
+		if template, ok := s.queryTemplates[key]; ok {
+			if value, err = template.Expand(variables, rng); err != nil {
+				return nil, fmt.Errorf("query param %s: %w", key, err)
+			}
+		}
+		queryParams[key] = value
+	}
+
+	return &protocols.Request{
+		Method:      s.method,
+		URL:         fullURL,
+		Headers:     headers,
+		Body:        body,
+		Timeout:     s.timeout,
+		QueryParams: queryParams,
+	}, nil
+}
+
+// extractValues reads the variables a step extracts from its response,
+// failing when one is missing since later requests need it
+func (s *step) extractValues(resp *protocols.Response) (map[string]string, error) {
+	if len(s.extract) == 0 {
+		return nil, nil
+	}
+
+	values := make(map[string]string, len(s.extract))
+	for _, rule := range s.extract {
+		value, found := rule.value(resp)
+		if !found {
+			return nil, fmt.Errorf("no %s%s in the response for %s", rule.source, rule.expression, rule.variable)
+		}
+		values[rule.variable] = value
+	}
+	return values, nil
+}
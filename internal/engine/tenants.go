@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+)
+
+// tenantFeed hands out the tenant each request is made for
+type tenantFeed struct {
+	tenants      []string
+	variable     string
+	header       string
+	distribution string
+	next         uint64
+}
+
+// newTenantFeed loads the tenants of a scenario, or returns nil when requests
+// are not tagged with tenants
+func newTenantFeed(cfg *config.TenantConfig) (*tenantFeed, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	tenants := cfg.Values
+	if cfg.File != "" {
+		var err error
+		if tenants, err = readTenants(cfg.File, cfg.Column); err != nil {
+			return nil, err
+		}
+	}
+	if len(tenants) == 0 {
+		return nil, fmt.Errorf("no tenants found")
+	}
+
+	distribution := cfg.Distribution
+	if distribution == "" {
+		distribution = config.TenantRoundRobin
+	}
+
+	return &tenantFeed{
+		tenants:      tenants,
+		variable:     cfg.GetVariable(),
+		header:       cfg.Header,
+		distribution: distribution,
+	}, nil
+}
+
+// readTenants reads one tenant per line, skipping blank lines and # comments,
+// or the given column of a CSV file with a header row
+func readTenants(path, column string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tenants file: %w", err)
+	}
+	defer file.Close()
+
+	var tenants []string
+	if column == "" {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			tenants = append(tenants, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read tenants file: %w", err)
+		}
+		return tenants, nil
+	}
+
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants file header: %w", err)
+	}
+	index := -1
+	for i, name := range header {
+		if strings.TrimSpace(name) == column {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("column %s not found in tenants file", column)
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tenants file: %w", err)
+		}
+		if index < len(record) {
+			if tenant := strings.TrimSpace(record[index]); tenant != "" {
+				tenants = append(tenants, tenant)
+			}
+		}
+	}
+
+	return tenants, nil
+}
+
+// pick returns the tenant of the next request of a VU
+func (f *tenantFeed) pick(vu int, rng *rand.Rand) string {
+	switch f.distribution {
+	case config.TenantRandom:
+		return f.tenants[rng.Intn(len(f.tenants))]
+	case config.TenantVU:
+		return f.tenants[vu%len(f.tenants)]
+	default:
+		next := atomic.AddUint64(&f.next, 1) - 1
+		return f.tenants[next%uint64(len(f.tenants))]
+	}
+}
+
+// variables returns a copy of base with the tenant variable set; base belongs
+// to the VU and is never modified
+func (f *tenantFeed) variables(base map[string]string, tenant string) map[string]string {
+	variables := make(map[string]string, len(base)+1)
+	for key, value := range base {
+		variables[key] = value
+	}
+	variables[f.variable] = tenant
+	return variables
+}
@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"context"
+	stdhttp "net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+)
+
+// maxBackoffDoublings bounds the exponential backoff so it cannot overflow
+const maxBackoffDoublings = 16
+
+// throttle pauses every virtual user while the target rate limits the test.
+// Rate limits usually apply to the whole client (API key, source IP), so one
+// throttled response holds back all VUs.
+type throttle struct {
+	statuses   map[int]bool
+	backoff    time.Duration
+	maxBackoff time.Duration
+
+	mu          sync.Mutex
+	until       time.Time
+	consecutive int
+	responses   int64
+	total       time.Duration
+}
+
+// newThrottle creates the throttle of a scenario, or nil when rate limit
+// handling is disabled
+func newThrottle(cfg *config.RateLimitConfig) *throttle {
+	if cfg == nil {
+		return nil
+	}
+
+	statuses := make(map[int]bool)
+	for _, status := range cfg.GetStatuses() {
+		statuses[status] = true
+	}
+
+	return &throttle{
+		statuses:   statuses,
+		backoff:    cfg.GetBackoff(),
+		maxBackoff: cfg.GetMaxBackoff(),
+	}
+}
+
+// wait blocks while the test is backing off, and reports whether the worker
+// should keep going
+func (t *throttle) wait(ctx context.Context) bool {
+	if t == nil {
+		return true
+	}
+
+	t.mu.Lock()
+	d := time.Until(t.until)
+	t.mu.Unlock()
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// observe starts or extends the backoff when resp signals throttling
+func (t *throttle) observe(resp *protocols.Response) {
+	if t == nil || resp.Error != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.statuses[resp.StatusCode] {
+		t.consecutive = 0
+		return
+	}
+	t.responses++
+
+	now := time.Now()
+	wait, ok := retryAfter(resp.Headers, now)
+	if !ok {
+		// Responses to requests sent before the backoff started do not
+		// escalate it
+		if now.Before(t.until) {
+			return
+		}
+		wait = t.backoff << t.consecutive
+		if t.consecutive < maxBackoffDoublings {
+			t.consecutive++
+		}
+	}
+	if wait > t.maxBackoff || wait < 0 {
+		wait = t.maxBackoff
+	}
+
+	// Overlapping backoffs only count once towards the throttled time
+	until := now.Add(wait)
+	if until.After(t.until) {
+		start := now
+		if t.until.After(now) {
+			start = t.until
+		}
+		t.total += until.Sub(start)
+		t.until = until
+	}
+}
+
+// summary reports the throttling of a test that ran for duration
+func (t *throttle) summary(duration time.Duration) *metrics.ThrottleSummary {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// A backoff still running when the test ended did not hold anything back
+	// past the end
+	throttled := t.total
+	if remaining := time.Until(t.until); remaining > 0 {
+		throttled -= remaining
+	}
+
+	summary := &metrics.ThrottleSummary{
+		Responses: t.responses,
+		Duration:  throttled.Round(time.Millisecond).String(),
+	}
+	if duration > 0 {
+		summary.Percentage = float64(throttled) / float64(duration) * 100
+	}
+
+	return summary
+}
+
+// retryAfter parses the Retry-After header, in seconds or as an HTTP date
+func retryAfter(headers map[string]string, now time.Time) (time.Duration, bool) {
+	_, value := findHeader(headers, "Retry-After")
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := stdhttp.ParseTime(value); err == nil {
+		wait := date.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,306 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrPhaseSkipped is the error of timeline phases that never started
+// because the timeline was stopped first
+var ErrPhaseSkipped = errors.New("timeline stopped before the phase started")
+
+// TimelinePhase is one scenario of a timeline. Its engine is created when
+// the phase starts, so phases waiting for their offset hold no connections.
+type TimelinePhase struct {
+	Name     string
+	Start    time.Duration
+	Config   *config.LoadTestConfig
+	Scenario *config.Scenario
+}
+
+// TimelineResult is the outcome of a timeline phase. Summary is nil when the
+// phase was skipped or failed; Started is its actual offset.
+type TimelineResult struct {
+	Phase   TimelinePhase
+	Started time.Duration
+	Summary *metrics.Summary
+	Err     error
+}
+
+// mixInterval is how often the VUs of mixed phases are rebalanced
+const mixInterval = time.Second
+
+// MixStage ramps the weights of timeline phases, see config.MixStage
+type MixStage struct {
+	Duration time.Duration
+	Weights  map[string]float64
+}
+
+// Timeline runs several load engines in one test, each started at the
+// offset of its phase
+type Timeline struct {
+	phases []TimelinePhase
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mix splits mixVUs between the phases it names by their weights
+	mix    []MixStage
+	mixVUs int
+
+	mu      sync.Mutex
+	engines map[string]*LoadEngine
+	split   string
+}
+
+// NewTimeline creates a timeline of phases
+func NewTimeline(phases []TimelinePhase) *Timeline {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Timeline{phases: phases, ctx: ctx, cancel: cancel, engines: make(map[string]*LoadEngine)}
+}
+
+// SetMix makes the phases named in stages share vus, moving them between
+// the phases as their weights ramp. It must be called before Run.
+func (t *Timeline) SetMix(vus int, stages []MixStage) {
+	t.mixVUs = vus
+	t.mix = stages
+}
+
+// Run starts every phase at its offset and returns once all of them ended,
+// with their results in phase order and the time the timeline took
+func (t *Timeline) Run() ([]TimelineResult, time.Duration) {
+	start := time.Now()
+	results := make([]TimelineResult, len(t.phases))
+
+	var phases sync.WaitGroup
+	var wg sync.WaitGroup
+	if len(t.mix) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.rebalance(start)
+		}()
+	}
+	for i, phase := range t.phases {
+		phases.Add(1)
+		go func(i int, phase TimelinePhase) {
+			defer phases.Done()
+			results[i] = t.runPhase(phase, start)
+		}(i, phase)
+	}
+	phases.Wait()
+	t.cancel()
+	wg.Wait()
+
+	return results, time.Since(start)
+}
+
+// runPhase waits for the offset of a phase, then runs its engine
+func (t *Timeline) runPhase(phase TimelinePhase, start time.Time) TimelineResult {
+	result := TimelineResult{Phase: phase}
+
+	timer := time.NewTimer(time.Until(start.Add(phase.Start)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-t.ctx.Done():
+		result.Err = ErrPhaseSkipped
+		return result
+	}
+
+	result.Started = time.Since(start)
+	logrus.Infof("Timeline phase %s starting at %v", phase.Name, result.Started.Round(time.Second))
+
+	if vus, mixed := t.mixAt(result.Started)[phase.Name]; mixed {
+		cfg := *phase.Config
+		cfg.VirtualUsers = vus
+		phase.Config = &cfg
+		result.Phase = phase
+	}
+
+	engine, err := NewLoadEngine(phase.Config, phase.Scenario)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	t.mu.Lock()
+	t.engines[phase.Name] = engine
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.engines, phase.Name)
+		t.mu.Unlock()
+	}()
+
+	// Stopping the timeline stops the running phases
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-t.ctx.Done():
+			engine.Stop()
+		case <-done:
+		}
+	}()
+
+	result.Summary, result.Err = engine.Run()
+	logrus.Infof("Timeline phase %s finished", phase.Name)
+	return result
+}
+
+// Stop skips the phases still waiting and stops the running ones
+func (t *Timeline) Stop() {
+	logrus.Info("Stopping timeline...")
+	t.cancel()
+}
+
+// rebalance moves the VUs of mixed phases as their weights ramp, until the
+// timeline ends
+func (t *Timeline) rebalance(start time.Time) {
+	ticker := time.NewTicker(mixInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		split := t.mixAt(time.Since(start))
+		t.mu.Lock()
+		for name, engine := range t.engines {
+			vus, mixed := split[name]
+			if !mixed || engine.ActiveVUs() == vus {
+				continue
+			}
+			if err := engine.SetVUs(vus); err != nil && !errors.Is(err, ErrNotRunning) {
+				logrus.WithError(err).Warnf("Failed to rebalance timeline phase %s", name)
+			}
+		}
+		t.mu.Unlock()
+		t.logSplit(split)
+	}
+}
+
+// logSplit logs the VUs of mixed phases when they change
+func (t *Timeline) logSplit(split map[string]int) {
+	parts := make([]string, 0, len(split))
+	for _, name := range sortedKeys(split) {
+		parts = append(parts, fmt.Sprintf("%s=%d", name, split[name]))
+	}
+	line := strings.Join(parts, " ")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if line != t.split && line != "" {
+		logrus.Infof("Timeline mix: %s", line)
+	}
+	t.split = line
+}
+
+// mixAt splits the mixed VUs between the mixed phases scheduled at offset
+func (t *Timeline) mixAt(offset time.Duration) map[string]int {
+	if len(t.mix) == 0 {
+		return nil
+	}
+	weights := MixWeights(t.mix, offset)
+	active := make(map[string]float64)
+	for _, phase := range t.phases {
+		weight, mixed := weights[phase.Name]
+		if !mixed || offset < phase.Start || offset >= phase.Start+phase.Config.Duration {
+			continue
+		}
+		active[phase.Name] = weight
+	}
+	return SplitByWeight(t.mixVUs, active)
+}
+
+// MixWeights returns the weights of a mix at offset, ramped linearly from
+// the previous stage and held after the last
+func MixWeights(stages []MixStage, offset time.Duration) map[string]float64 {
+	if len(stages) == 0 {
+		return nil
+	}
+
+	from := stages[0].Weights
+	var elapsed time.Duration
+	for _, stage := range stages {
+		if offset < elapsed+stage.Duration {
+			progress := float64(offset-elapsed) / float64(stage.Duration)
+			weights := make(map[string]float64, len(stage.Weights))
+			for name := range from {
+				weights[name] = from[name] * (1 - progress)
+			}
+			for name, weight := range stage.Weights {
+				weights[name] += weight * progress
+			}
+			return weights
+		}
+		elapsed += stage.Duration
+		from = stage.Weights
+	}
+
+	// Phases missing from the last stage still weigh 0 in it
+	weights := make(map[string]float64)
+	for _, stage := range stages {
+		for name := range stage.Weights {
+			weights[name] = 0
+		}
+	}
+	for name, weight := range from {
+		weights[name] = weight
+	}
+	return weights
+}
+
+// SplitByWeight splits vus by weight with the largest remainder method,
+// giving at least one VU to every entry so none of them stops. Entries
+// weighing nothing share the VUs equally when all of them do.
+func SplitByWeight(vus int, weights map[string]float64) map[string]int {
+	if len(weights) == 0 {
+		return nil
+	}
+
+	names := sortedKeys(weights)
+	var total float64
+	for _, name := range names {
+		total += weights[name]
+	}
+
+	split := make(map[string]int, len(names))
+	remainders := make([]float64, len(names))
+	assigned := 0
+	for i, name := range names {
+		share := float64(vus) / float64(len(names))
+		if total > 0 {
+			share = float64(vus) * weights[name] / total
+		}
+		split[name] = int(math.Floor(share))
+		remainders[i] = share - math.Floor(share)
+		assigned += split[name]
+	}
+
+	order := make([]int, len(names))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for _, i := range order[:max(0, min(vus-assigned, len(order)))] {
+		split[names[i]]++
+	}
+
+	for _, name := range names {
+		split[name] = max(split[name], 1)
+	}
+	return split
+}
@@ -0,0 +1,183 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/protocols"
+)
+
+// traceBodyLimit bounds the bytes of each body written to the trace
+const traceBodyLimit = 4096
+
+// Trace events, in the order a VU goes through them
+const (
+	traceStart     = "start"
+	traceIteration = "iteration"
+	traceRequest   = "request"
+	traceResponse  = "response"
+	traceFailure   = "failure"
+	traceAborted   = "aborted"
+	traceStop      = "stop"
+)
+
+// traceEvent is one line of the trace file
+type traceEvent struct {
+	Time      string            `json:"time"`
+	VU        int               `json:"vu"`
+	Iteration int               `json:"iteration,omitempty"`
+	Event     string            `json:"event"`
+	RequestID string            `json:"request_id,omitempty"`
+	Tenant    string            `json:"tenant,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+	Method    string            `json:"method,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      string            `json:"body,omitempty"`
+	Status    int               `json:"status,omitempty"`
+	LatencyMs float64           `json:"latency_ms,omitempty"`
+	Passed    *bool             `json:"passed,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+}
+
+// tracer writes the trace of sample VUs, one JSON line per event. Each VU
+// writes its events in order; events of different VUs are interleaved.
+type tracer struct {
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	redact *redactor
+}
+
+// newTracer creates the trace file at path, masking what redact redacts
+func newTracer(path string, redact *redactor) (*tracer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace file: %w", err)
+	}
+
+	return &tracer{file: file, writer: bufio.NewWriter(file), redact: redact}, nil
+}
+
+// write appends an event
+func (t *tracer) write(event traceEvent) {
+	event.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	event.URL = t.redact.text(event.URL)
+	event.Headers = t.redact.headerValues(event.Headers)
+	event.Variables = t.redact.values(event.Variables)
+	event.Error = t.redact.text(event.Error)
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.writer.Write(data)
+	t.writer.WriteByte('\n')
+}
+
+// Close flushes pending events and closes the file
+func (t *tracer) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.writer.Flush(); err != nil {
+		t.file.Close()
+		return err
+	}
+	return t.file.Close()
+}
+
+// vuTrace records what one VU does; a nil vuTrace records nothing
+type vuTrace struct {
+	tracer    *tracer
+	vu        int
+	iteration int
+}
+
+// event writes an event of the current iteration
+func (v *vuTrace) event(event traceEvent) {
+	if v == nil {
+		return
+	}
+	event.VU = v.vu
+	event.Iteration = v.iteration
+	v.tracer.write(event)
+}
+
+// start records the variables the VU keeps across iterations
+func (v *vuTrace) start(variables map[string]string) {
+	v.event(traceEvent{Event: traceStart, Variables: variables})
+}
+
+// beginIteration records the variables an iteration resolved
+func (v *vuTrace) beginIteration(iteration int, requestID, tenant string, variables map[string]string) {
+	if v == nil {
+		return
+	}
+	v.iteration = iteration
+	v.event(traceEvent{Event: traceIteration, RequestID: requestID, Tenant: tenant, Variables: variables})
+}
+
+// request records a request as sent
+func (v *vuTrace) request(req *protocols.Request) {
+	if v == nil {
+		return
+	}
+	v.event(traceEvent{
+		Event:   traceRequest,
+		Method:  req.Method,
+		URL:     req.URL,
+		Headers: req.Headers,
+		Body:    traceBody(v.tracer.redact.body(req.Body)),
+	})
+}
+
+// response records a response and whether it passed validation
+func (v *vuTrace) response(resp *protocols.Response, passed bool) {
+	if v == nil {
+		return
+	}
+	event := traceEvent{
+		Event:     traceResponse,
+		Status:    resp.StatusCode,
+		Headers:   resp.Headers,
+		Body:      traceBody(v.tracer.redact.body(resp.Body)),
+		LatencyMs: float64(resp.ResponseTime) / float64(time.Millisecond),
+		Passed:    &passed,
+	}
+	if resp.Error != nil {
+		event.Error = resp.Error.Error()
+	}
+	v.event(event)
+}
+
+// failure records an iteration that failed outside the request, such as a
+// template or script error
+func (v *vuTrace) failure(stage string, err error) {
+	v.event(traceEvent{Event: traceFailure, Error: fmt.Sprintf("%s: %v", stage, err)})
+}
+
+// aborted records a request abandoned at the end of the drain period
+func (v *vuTrace) aborted() {
+	v.event(traceEvent{Event: traceAborted})
+}
+
+// stop records why the VU stopped
+func (v *vuTrace) stop(reason string) {
+	v.event(traceEvent{Event: traceStop, Reason: reason})
+}
+
+// traceBody returns a body for the trace, cut at traceBodyLimit
+func traceBody(body []byte) string {
+	if len(body) > traceBodyLimit {
+		return string(body[:traceBodyLimit]) + fmt.Sprintf("... (%d bytes)", len(body))
+	}
+	return string(body)
+}
@@ -0,0 +1,199 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/scripting"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// warmupWindows is how many consecutive windows must agree on p95
+	warmupWindows = 3
+	// Defaults of the warm-up settings left unset
+	defaultWarmupWindow    = 10 * time.Second
+	defaultWarmupTolerance = 0.1
+)
+
+// warmup measures the p95 latency of the warm-up responses window by window
+type warmup struct {
+	mu        sync.Mutex
+	histogram *metrics.Histogram
+	requests  int64
+}
+
+// record adds the latency of a warm-up response
+func (w *warmup) record(latency time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.histogram.Record(latency)
+}
+
+// window returns the p95 of the window that just ended and starts a new
+// one; ok is false when no request succeeded in it
+func (w *warmup) window() (p95 time.Duration, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.histogram.Count() == 0 {
+		return 0, false
+	}
+	p95 = w.histogram.Percentile(95)
+	w.histogram = metrics.NewHistogram(w.histogram.Precision())
+	return p95, true
+}
+
+// p95Stable reports whether the p95 of windows varies by less than tolerance,
+// as its standard deviation relative to its mean
+func p95Stable(windows []time.Duration, tolerance float64) bool {
+	if len(windows) < warmupWindows {
+		return false
+	}
+
+	var sum float64
+	for _, p95 := range windows {
+		sum += float64(p95)
+	}
+	mean := sum / float64(len(windows))
+	if mean == 0 {
+		return true
+	}
+
+	var variance float64
+	for _, p95 := range windows {
+		variance += (float64(p95) - mean) * (float64(p95) - mean)
+	}
+	return math.Sqrt(variance/float64(len(windows)))/mean < tolerance
+}
+
+// warmUp holds the test at a low load until p95 latency stabilizes, so
+// caches, connection pools and JIT compilers are warm before the measured
+// test starts, or until the warm-up time runs out. Nothing it sends is part
+// of the results.
+func (e *LoadEngine) warmUp() *metrics.WarmupSummary {
+	window := e.config.WarmupWindow
+	if window <= 0 {
+		window = defaultWarmupWindow
+	}
+	tolerance := e.config.WarmupTolerance
+	if tolerance <= 0 {
+		tolerance = defaultWarmupTolerance
+	}
+	vus := e.config.WarmupVUs
+	if vus <= 0 {
+		vus = 1
+	}
+
+	logrus.Infof("Warming up with %d VUs until p95 is stable, for up to %v", vus, e.config.Warmup)
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(e.ctx, e.config.Warmup)
+	defer cancel()
+
+	w := &warmup{histogram: metrics.NewHistogram(e.config.HistogramPrecision)}
+	var wg sync.WaitGroup
+	for vu := 0; vu < vus; vu++ {
+		wg.Add(1)
+		go func(vu int) {
+			defer wg.Done()
+			e.warmUpVU(ctx, vu, w)
+		}(vu)
+	}
+
+	summary := &metrics.WarmupSummary{}
+	var windows []time.Duration
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+	for !summary.Stable && ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+			p95, ok := w.window()
+			if !ok {
+				// A window without successful responses starts over
+				windows = windows[:0]
+				continue
+			}
+			windows = append(windows, p95)
+			if len(windows) > warmupWindows {
+				windows = windows[1:]
+			}
+			summary.P95 = p95.String()
+			summary.Stable = p95Stable(windows, tolerance)
+			logrus.Debugf("Warm-up window p95: %v", p95)
+		}
+	}
+	cancel()
+	wg.Wait()
+
+	summary.Requests = atomic.LoadInt64(&w.requests)
+	summary.Duration = time.Since(start).Round(time.Millisecond).String()
+	switch {
+	case summary.Stable:
+		logrus.Infof("Warm-up done after %s: p95 stable at %s", summary.Duration, summary.P95)
+	case e.ctx.Err() == nil:
+		logrus.Warnf("p95 did not stabilize within the %v warm-up; starting the test anyway", e.config.Warmup)
+	}
+	return summary
+}
+
+// warmUpVU sends warm-up requests back to back until ctx ends
+func (e *LoadEngine) warmUpVU(ctx context.Context, vu int, w *warmup) {
+	rng := e.VURand(-vu - 1)
+
+	var script scripting.Script
+	if path := e.scenario.Script; path != "" {
+		loaded, err := scripting.Load(path)
+		if err != nil {
+			logrus.WithError(err).Warn("Warm-up failed to load the script")
+			return
+		}
+		script = loaded
+		defer script.Close()
+	}
+
+	protocol := e.steps[0].sender(e.ProtocolFor(vu))
+	for ctx.Err() == nil {
+		req, err := e.CreateRequest(rng)
+		if err != nil {
+			logrus.WithError(err).Debug("Warm-up request could not be built")
+			return
+		}
+		if script != nil {
+			if err := script.TransformRequest(req); err != nil {
+				logrus.WithError(err).Debug("Warm-up script failed")
+				return
+			}
+		}
+
+		e.signer.sign(req)
+
+		reqCtx, cancel := context.WithTimeout(ctx, req.Timeout)
+		resp, err := protocol.Execute(reqCtx, req)
+		cancel()
+		if err == nil && resp != nil && resp.Error == nil {
+			// Resources created while warming up are cleaned up too
+			e.resources.capture(resp)
+		}
+		// Requests cut off by the end of the warm-up are not counted
+		if ctx.Err() != nil {
+			return
+		}
+		atomic.AddInt64(&w.requests, 1)
+		if err == nil && resp != nil && resp.Error == nil {
+			w.record(resp.ResponseTime)
+		}
+
+		if delay := e.config.Delay; delay > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+		}
+	}
+}
@@ -2,36 +2,118 @@ package engine
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/alexandredias/gotsunami/internal/scripting"
 	"github.com/sirupsen/logrus"
 )
 
+// maxPatternDelay caps the delay at very low intensities so workers keep
+// checking for cancellation and intensity changes
+const maxPatternDelay = time.Second
+
 // Worker represents a load testing worker
 type Worker struct {
 	id       int
+	clientID string
+	rand     *rand.Rand
 	engine   *LoadEngine
+	protocol protocols.Protocol
+	cache    *validatorCache
+	script   scripting.Script
 	requests int
 	mu       sync.Mutex
+
+	// variables hold this VU's evaluated VU-scoped variables
+	variables map[string]string
+	// tenant is the tenant of the current iteration, if any
+	tenant string
+	// row is the data row of the current iteration, if any
+	row map[string]string
+	// endpoint is the endpoint of the current iteration, if grouped
+	endpoint string
+	// step is the step of the iteration being sent and passed whether its
+	// last attempt passed
+	step   *step
+	passed bool
+	// attempt counts the attempts of the step being sent, from 1
+	attempt int
+	// extracted holds the values extracted from this VU's responses, which
+	// override its variables in later requests and iterations
+	extracted map[string]string
+	// due holds when each paced step of the chain is to be sent next
+	due []time.Time
+	// trace is nil unless this is a traced sample VU
+	trace *vuTrace
+	// iteration is the OpenTelemetry trace of the current iteration, nil
+	// unless it is exported
+	iteration *iterationTrace
+	// stop is closed when the VU is scaled down
+	stop chan struct{}
 }
 
 // NewWorker creates a new worker
 func NewWorker(id int, engine *LoadEngine) *Worker {
 	return &Worker{
-		id:     id,
-		engine: engine,
+		id:       id,
+		clientID: engine.ClientID(id + 1),
+		rand:     engine.VURand(id + 1),
+		engine:   engine,
+		protocol: engine.ProtocolFor(id),
+		cache:    newValidatorCache(engine.GetScenario().Cache),
+		trace:    engine.traceVU(id),
+		stop:     make(chan struct{}),
 	}
 }
 
 // Run executes the worker's load testing loop
 func (w *Worker) Run(wg *sync.WaitGroup) {
 	defer wg.Done()
+	defer w.engine.workerStopped()
 
 	logrus.Debugf("Worker %d started", w.id)
 
-	// Calculate load pattern
-	pattern := w.calculateLoadPattern()
+	stopped := "test ended"
+	defer func() {
+		select {
+		case <-w.stop:
+			stopped = "scaled down"
+		default:
+		}
+		w.trace.stop(stopped)
+	}()
+
+	// Scripts keep per-worker state, so each worker loads its own copy
+	if path := w.engine.GetScenario().Script; path != "" {
+		script, err := scripting.Load(path)
+		if err != nil {
+			logrus.WithError(err).Errorf("Worker %d failed to load script", w.id)
+			stopped = "script failed to load"
+			return
+		}
+		w.script = script
+		defer script.Close()
+	}
+
+	// VU-scoped variables persist across this VU's iterations
+	variables, err := w.engine.VUVariables(w.rand)
+	if err != nil {
+		logrus.WithError(err).Errorf("Worker %d failed to evaluate its variables", w.id)
+		w.trace.failure("variables", err)
+		stopped = "variables failed to evaluate"
+		return
+	}
+	w.variables = variables
+	w.trace.start(variables)
+
+	pattern := w.engine.GetPattern()
 
 	// Execute requests according to pattern
 	for {
@@ -39,213 +121,426 @@ func (w *Worker) Run(wg *sync.WaitGroup) {
 		case <-w.engine.GetContext().Done():
 			logrus.Debugf("Worker %d stopping", w.id)
 			return
+		case <-w.stop:
+			logrus.Debugf("Worker %d scaled down", w.id)
+			return
 		default:
 			// Check if we've reached max requests
 			if w.engine.GetConfig().MaxRequests > 0 && w.requests >= w.engine.GetConfig().MaxRequests {
 				logrus.Debugf("Worker %d reached max requests (%d)", w.id, w.requests)
+				stopped = "max requests reached"
+				return
+			}
+
+			// Wait for the pattern to start the next iteration
+			if !w.pace(pattern) {
+				return
+			}
+
+			// Back off while the target is rate limiting the test
+			if !w.engine.throttle.wait(w.engine.GetContext()) {
+				return
+			}
+
+			// With every step paced, wait for the first one due
+			if !w.waitForStep() {
 				return
 			}
 
-			// Calculate delay based on pattern
-			delay := w.calculateDelay(pattern)
-			if delay > 0 {
-				time.Sleep(delay)
+			// Every row of a unique data feed is read once
+			row, ok := w.engine.data.pick(w.rand)
+			if !ok {
+				logrus.Debugf("Worker %d ran out of data rows", w.id)
+				stopped = "data rows exhausted"
+				return
 			}
+			w.row = row
 
 			// Execute request
 			w.executeRequest()
 
 			// Apply delay between requests
-			if w.engine.GetConfig().Delay > 0 {
-				time.Sleep(w.engine.GetConfig().Delay)
+			if !w.sleep(w.engine.GetConfig().Delay) {
+				return
 			}
 		}
 	}
 }
 
-// calculateLoadPattern calculates the load pattern for this worker
-func (w *Worker) calculateLoadPattern() *LoadPattern {
-	config := w.engine.GetConfig()
-	pattern := &LoadPattern{
-		Type: config.Pattern,
+// sleep waits for d unless the engine stops first, and reports whether the
+// worker should keep going
+func (w *Worker) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return true
 	}
 
-	switch config.Pattern {
-	case "spike":
-		pattern = w.calculateSpikePattern()
-	case "steady":
-		pattern = w.calculateSteadyPattern()
-	case "ramp-up":
-		pattern = w.calculateRampUpPattern()
-	case "stress":
-		pattern = w.calculateStressPattern()
-	default:
-		pattern = w.calculateSteadyPattern()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-w.engine.GetContext().Done():
+		return false
+	case <-w.stop:
+		return false
+	case <-timer.C:
+		// Both may be ready at the deadline; never start a request after it
+		return w.engine.GetContext().Err() == nil
 	}
-
-	return pattern
 }
 
-// calculateSpikePattern calculates spike load pattern
-func (w *Worker) calculateSpikePattern() *LoadPattern {
-	config := w.engine.GetConfig()
-	duration := config.Duration
-
-	return &LoadPattern{
-		Type: "spike",
-		Phases: []LoadPhase{
-			{
-				Duration:  duration / 4,
-				Intensity: 0.2, // 20% of max load
-			},
-			{
-				Duration:  duration / 4,
-				Intensity: 1.0, // 100% of max load (spike)
-			},
-			{
-				Duration:  duration / 2,
-				Intensity: 0.2, // Back to 20%
-			},
-		},
+// pace waits until the pattern starts the worker's next iteration: the next
+// arrival when iterations start at a rate, the pattern delay otherwise. It
+// reports whether the worker should keep going.
+func (w *Worker) pace(pattern LoadPattern) bool {
+	if arrivals := w.engine.arrivals; arrivals != nil {
+		return arrivals.wait(w.engine.GetContext(), w.stop)
 	}
+	return w.sleep(w.calculateDelay(pattern))
+}
+
+// calculateDelay calculates the delay between requests based on load pattern
+func (w *Worker) calculateDelay(pattern LoadPattern) time.Duration {
+	return PatternDelay(pattern, w.engine.Elapsed())
 }
 
-// calculateSteadyPattern calculates steady load pattern
-func (w *Worker) calculateSteadyPattern() *LoadPattern {
-	config := w.engine.GetConfig()
-
-	return &LoadPattern{
-		Type: "steady",
-		Phases: []LoadPhase{
-			{
-				Duration:  config.RampUp,
-				Intensity: 0.0, // Ramp up from 0
-			},
-			{
-				Duration:  config.Duration - config.RampUp - config.RampDown,
-				Intensity: 1.0, // Full load
-			},
-			{
-				Duration:  config.RampDown,
-				Intensity: 0.0, // Ramp down to 0
-			},
-		},
+// PatternDelay converts the pattern intensity at elapsed into the delay
+// before the next request (higher intensity = lower delay)
+func PatternDelay(pattern LoadPattern, elapsed time.Duration) time.Duration {
+	intensity := pattern.Intensity(elapsed)
+	if intensity <= 0 {
+		return maxPatternDelay
 	}
+
+	baseDelay := 100 * time.Millisecond
+	delay := time.Duration(float64(baseDelay) / intensity)
+	if delay > maxPatternDelay {
+		delay = maxPatternDelay
+	}
+
+	return delay
 }
 
-// calculateRampUpPattern calculates ramp-up load pattern
-func (w *Worker) calculateRampUpPattern() *LoadPattern {
-	config := w.engine.GetConfig()
-	duration := config.Duration
+// executeRequest executes one iteration: the scenario's request, or each
+// step of its chain in order until one fails
+func (w *Worker) executeRequest() {
+	w.mu.Lock()
+	w.requests++
+	requestNum := w.requests
+	w.mu.Unlock()
+
+	// Tag the iteration with its tenant, exposed to templates as a variable
+	variables := w.variables
+	if tenants := w.engine.tenants; tenants != nil {
+		w.tenant = tenants.pick(w.id, w.rand)
+		variables = tenants.variables(w.variables, w.tenant)
+	}
+	variables = withValues(variables, w.row)
+	variables = withValues(variables, w.extracted)
+
+	requestID := fmt.Sprintf("%s-%d", w.clientID, requestNum)
+	w.iteration = w.engine.otlp.beginIteration(w.id+1, requestNum, requestID, w.tenant)
+	defer w.iteration.end()
+
+	steps := w.engine.steps
+	w.step = steps[0]
+	w.endpoint = w.engine.endpoints.name(nil, w.step.name)
+	resolved, err := evaluateScope(w.engine.GetScenario(), w.engine.compiled, variables, config.ScopeIteration, w.rand)
+	if resolved == nil {
+		resolved = variables
+	}
+	w.trace.beginIteration(requestNum, requestID, w.tenant, resolved)
+	if err != nil {
+		w.templateFailed(requestNum, err)
+		return
+	}
+
+	for i, step := range steps {
+		// A stopped test sends no further steps of the iteration, though the
+		// one in flight may still finish within the drain period
+		if i > 0 && w.engine.ctx.Err() != nil {
+			return
+		}
+		// Paced steps keep their own schedule, skipping iterations
+		if !w.stepDue(i, step) {
+			continue
+		}
+
+		stepID := requestID
+		if len(steps) > 1 {
+			stepID = fmt.Sprintf("%s.%d", requestID, i+1)
+		}
+		if !w.executeStep(step, resolved, requestNum, stepID) {
+			return
+		}
 
-	return &LoadPattern{
-		Type: "ramp-up",
-		Phases: []LoadPhase{
-			{
-				Duration:  duration,
-				Intensity: 0.0, // Linear ramp from 0 to 1
-			},
-		},
+		// Values extracted from the response are available to later steps
+		if len(step.extract) > 0 {
+			resolved = withValues(resolved, w.extracted)
+		}
 	}
 }
 
-// calculateStressPattern calculates stress test pattern
-func (w *Worker) calculateStressPattern() *LoadPattern {
-	config := w.engine.GetConfig()
-	duration := config.Duration
-
-	return &LoadPattern{
-		Type: "stress",
-		Phases: []LoadPhase{
-			{
-				Duration:  duration / 3,
-				Intensity: 0.5, // 50% load
-			},
-			{
-				Duration:  duration / 3,
-				Intensity: 1.0, // 100% load
-			},
-			{
-				Duration:  duration / 3,
-				Intensity: 1.5, // 150% load (stress)
-			},
-		},
+// stepDue reports whether the i-th step is to be sent in this iteration,
+// scheduling the next send of a paced step when it is. A step falling
+// behind its rate, as when iterations take longer than its interval, is
+// not sent in bursts to catch up.
+func (w *Worker) stepDue(i int, s *step) bool {
+	if s.interval == 0 {
+		return true
+	}
+	if w.due == nil {
+		w.due = make([]time.Time, len(w.engine.steps))
+	}
+
+	now := time.Now()
+	if now.Before(w.due[i]) {
+		return false
 	}
+	next := w.due[i].Add(s.interval)
+	if next.Before(now) {
+		next = now.Add(s.interval)
+	}
+	w.due[i] = next
+	return true
 }
 
-// calculateDelay calculates the delay between requests based on load pattern
-func (w *Worker) calculateDelay(pattern *LoadPattern) time.Duration {
-	config := w.engine.GetConfig()
-	elapsed := time.Since(time.Now().Add(-config.Duration))
-
-	// Find current phase
-	var currentPhase *LoadPhase
-	var phaseStart time.Duration
-
-	for _, phase := range pattern.Phases {
-		if elapsed < phaseStart+phase.Duration {
-			currentPhase = &phase
-			break
+// waitForStep waits, when every step is paced, until the first of them is
+// due, and reports whether the worker should keep going
+func (w *Worker) waitForStep() bool {
+	if !allPaced(w.engine.steps) || w.due == nil {
+		return true
+	}
+
+	next := w.due[0]
+	for _, due := range w.due[1:] {
+		if due.Before(next) {
+			next = due
 		}
-		phaseStart += phase.Duration
+	}
+	return w.sleep(time.Until(next))
+}
+
+// withValues returns a copy of variables overridden by values, or variables
+// itself when there are no values
+func withValues(variables, values map[string]string) map[string]string {
+	if len(values) == 0 {
+		return variables
 	}
 
-	if currentPhase == nil {
-		return 0 // No delay if no active phase
+	merged := make(map[string]string, len(variables)+len(values))
+	for key, value := range variables {
+		merged[key] = value
 	}
+	for key, value := range values {
+		merged[key] = value
+	}
+	return merged
+}
 
-	// Calculate intensity for current time
-	intensity := w.calculateIntensity(currentPhase, elapsed-phaseStart)
+// executeStep sends the request of one step and reports whether it passed
+func (w *Worker) executeStep(step *step, variables map[string]string, requestNum int, requestID string) bool {
+	w.step = step
+	w.passed = false
+	w.attempt = 0
 
-	// Convert intensity to delay (higher intensity = lower delay)
-	baseDelay := 100 * time.Millisecond
-	delay := time.Duration(float64(baseDelay) / intensity)
+	// Until the request is built, only the step or scenario group names its
+	// endpoint
+	w.endpoint = w.engine.endpoints.name(nil, step.name)
 
-	return delay
-}
+	req, err := w.engine.buildRequest(step, variables, w.rand)
+	if err != nil {
+		w.templateFailed(requestNum, err)
+		return false
+	}
+	if tenants := w.engine.tenants; tenants != nil {
+		setDefaultHeader(req, tenants.header, w.tenant)
+	}
 
-// calculateIntensity calculates the current intensity based on phase and time
-func (w *Worker) calculateIntensity(phase *LoadPhase, elapsed time.Duration) float64 {
-	if phase.Duration == 0 {
-		return phase.Intensity
+	if cfg := w.engine.GetConfig(); cfg.IdentityHeaders {
+		setDefaultHeader(req, cfg.ClientIDHeader, w.clientID)
+		setDefaultHeader(req, cfg.RequestIDHeader, requestID)
 	}
 
-	// Linear interpolation for ramp phases
-	progress := float64(elapsed) / float64(phase.Duration)
-	if progress > 1.0 {
-		progress = 1.0
+	if w.script != nil {
+		if err := w.script.TransformRequest(req); err != nil {
+			logrus.WithError(err).Debugf("Worker %d request %d script failed", w.id, requestNum)
+			w.trace.failure("script", err)
+			w.iteration.failure("script", err)
+			w.recordFailure(&protocols.Response{
+				Headers: make(map[string]string),
+				Error:   err,
+			}, "script")
+			return false
+		}
 	}
 
-	// For ramp-up pattern, intensity increases linearly
-	if w.engine.GetConfig().Pattern == "ramp-up" {
-		return progress
+	w.endpoint = w.engine.endpoints.name(req, step.name)
+
+	// Revalidate URLs this VU fetched before, like a caching client
+	w.cache.apply(req)
+
+	if w.engine.idempotency != nil {
+		w.sendIdempotent(req, requestNum, requestID)
+	} else {
+		w.send(req, requestNum, requestID)
 	}
+	return w.passed
+}
 
-	// For other patterns, use phase intensity
-	return phase.Intensity
+// templateFailed records an iteration whose templates could not be expanded
+func (w *Worker) templateFailed(requestNum int, err error) {
+	logrus.WithError(err).Debugf("Worker %d request %d template failed", w.id, requestNum)
+	w.trace.failure("template", err)
+	w.iteration.failure("template", err)
+	w.recordFailure(&protocols.Response{
+		Headers: make(map[string]string),
+		Error:   err,
+	}, "template")
 }
 
-// executeRequest executes a single request
-func (w *Worker) executeRequest() {
-	w.mu.Lock()
-	w.requests++
-	requestNum := w.requests
-	w.mu.Unlock()
+// send executes one attempt of a request and records its outcome. It
+// returns nil when the attempt did not reach the target or was aborted.
+func (w *Worker) send(req *protocols.Request, requestNum int, requestID string) *protocols.Response {
+	// Hold a slot of the global limit shared with other agents; waiting for
+	// one is not part of the request latency
+	if limiter := w.engine.Limiter(); limiter != nil {
+		if err := limiter.Acquire(w.engine.GetContext()); err != nil {
+			return nil
+		}
+		defer limiter.Release()
+	}
 
-	// Create request
-	req := w.engine.CreateRequest()
+	// Every attempt is signed as it is sent, with a fresh timestamp
+	w.engine.signer.sign(req)
 
-	// Execute request
-	ctx, cancel := context.WithTimeout(w.engine.GetContext(), req.Timeout)
+	// Execute request; it keeps its full timeout even if the test ends
+	ctx, cancel := context.WithTimeout(w.engine.RequestContext(), req.Timeout)
 	defer cancel()
+	if w.iteration != nil {
+		ctx = protocols.WithPhases(ctx)
+	}
 
-	resp, err := w.engine.GetProtocol().Execute(ctx, req)
+	w.attempt++
+	w.iteration.request(req, w.step, w.attempt)
+	w.trace.request(req)
+	atomic.AddInt64(&w.engine.inFlight, 1)
+	resp, err := w.step.sender(w.protocol).Execute(ctx, req)
+	atomic.AddInt64(&w.engine.inFlight, -1)
 	if err != nil {
 		logrus.WithError(err).Debugf("Worker %d request %d failed", w.id, requestNum)
 	}
 
+	// Requests cut off after the drain period say nothing about the target
+	if resp.Error != nil && w.engine.RequestContext().Err() != nil {
+		w.engine.RecordAborted()
+		w.trace.aborted()
+		w.iteration.aborted()
+		return nil
+	}
+
+	w.cache.store(req, resp)
+	w.engine.consistency.observe(req, resp)
+	w.engine.throttle.observe(resp)
+	w.engine.methods.observe(resp)
+
+	// Let the script post-process the response
+	if w.script != nil {
+		if err := w.script.ProcessResponse(resp); err != nil {
+			logrus.WithError(err).Debugf("Worker %d request %d rejected by script", w.id, requestNum)
+			w.trace.response(resp, false)
+			w.trace.failure("script", err)
+			w.iteration.response(resp, false)
+			w.iteration.failure("script", err)
+			w.recordFailure(resp, "script")
+			return resp
+		}
+	}
+
+	// Some protocols check responses themselves, like a WebSocket echo
+	if resp.FailedCheck != "" {
+		logrus.WithError(resp.CheckError).Debugf("Worker %d request %d failed the %s check", w.id, requestNum, resp.FailedCheck)
+		w.trace.response(resp, false)
+		w.trace.failure(resp.FailedCheck, resp.CheckError)
+		w.iteration.response(resp, false)
+		w.iteration.failure(resp.FailedCheck, resp.CheckError)
+		w.recordFailure(resp, resp.FailedCheck)
+		return resp
+	}
+
+	// Later requests need the values this one extracts
+	if len(w.step.extract) > 0 && resp.Error == nil && resp.StatusCode < 400 {
+		extracted, err := w.step.extractValues(resp)
+		if err != nil {
+			logrus.WithError(err).Debugf("Worker %d request %d extraction failed", w.id, requestNum)
+			w.trace.response(resp, false)
+			w.trace.failure("extract", err)
+			w.iteration.response(resp, false)
+			w.iteration.failure("extract", err)
+			w.recordFailure(resp, "extract")
+			return resp
+		}
+		if w.extracted == nil {
+			w.extracted = make(map[string]string, len(extracted))
+		}
+		for variable, value := range extracted {
+			w.extracted[variable] = value
+		}
+	}
+
 	// Record response
-	w.engine.RecordResponse(resp)
+	passed := w.engine.recordResponse(resp, w.step.validator)
+	w.passed = passed
+	w.engine.RecordTenant(w.tenant, resp, passed)
+	w.engine.RecordEndpoint(w.endpoint, resp, passed)
+	w.engine.RecordStage(resp, passed)
+	w.engine.RecordHeaders(resp, passed)
+	w.trace.response(resp, passed)
+	w.iteration.response(resp, passed)
+	w.recordRaw(req, resp, requestID)
+
+	return resp
+}
+
+// recordFailure records a response that failed a check outside the validator
+func (w *Worker) recordFailure(resp *protocols.Response, errorType string) {
+	w.engine.RecordResponseFailure(resp, errorType)
+	w.engine.RecordTenant(w.tenant, resp, false)
+	w.engine.RecordEndpoint(w.endpoint, resp, false)
+	w.engine.RecordStage(resp, false)
+	w.engine.RecordHeaders(resp, false)
+}
+
+// recordRaw writes the request outcome to the raw results output
+func (w *Worker) recordRaw(req *protocols.Request, resp *protocols.Response, requestID string) {
+	result := metrics.RawResult{
+		OffsetMs:  float64(w.engine.Elapsed()) / float64(time.Millisecond),
+		VU:        w.id + 1,
+		ClientID:  w.clientID,
+		RequestID: requestID,
+		Method:    req.Method,
+		URL:       req.URL,
+		Status:    resp.StatusCode,
+		LatencyMs: float64(resp.ResponseTime) / float64(time.Millisecond),
+		Bytes:     resp.ContentLength,
+		Tenant:    w.tenant,
+		Endpoint:  w.endpoint,
+	}
+	if resp.Error != nil {
+		result.Error = resp.Error.Error()
+	}
+
+	w.engine.RecordRaw(result)
+}
+
+// setDefaultHeader sets a header unless the scenario already defines it
+func setDefaultHeader(req *protocols.Request, name, value string) {
+	if name == "" {
+		return
+	}
+	if key, _ := findHeader(req.Headers, name); key != "" {
+		return
+	}
+	req.Headers[name] = value
 }
 
 // GetRequestCount returns the number of requests executed by this worker
@@ -254,15 +549,3 @@ func (w *Worker) GetRequestCount() int {
 	defer w.mu.Unlock()
 	return w.requests
 }
-
-// LoadPattern represents a load testing pattern
-type LoadPattern struct {
-	Type   string      `json:"type"`
-	Phases []LoadPhase `json:"phases"`
-}
-
-// LoadPhase represents a phase in a load pattern
-type LoadPhase struct {
-	Duration  time.Duration `json:"duration"`
-	Intensity float64       `json:"intensity"` // 0.0 to 2.0 (0% to 200% of base load)
-}
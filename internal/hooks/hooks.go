@@ -0,0 +1,210 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Event types fired during a test
+const (
+	EventStart = "start"
+	EventStage = "stage"
+	EventEnd   = "end"
+)
+
+// maxOutputSize limits the hook output kept in results
+const maxOutputSize = 1024
+
+// Event describes a lifecycle event passed to hooks
+type Event struct {
+	Type      string `json:"event"`
+	Scenario  string `json:"scenario"`
+	Stage     int    `json:"stage"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Result records the outcome of a hook execution
+type Result struct {
+	Name     string `json:"name"`
+	Event    string `json:"event"`
+	Stage    int    `json:"stage"`
+	Success  bool   `json:"success"`
+	Required bool   `json:"required,omitempty"`
+	Duration string `json:"duration"`
+	Output   string `json:"output,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Runner executes the hooks configured in a scenario
+type Runner struct {
+	config *config.HooksConfig
+	client *http.Client
+}
+
+// NewRunner creates a hook runner; a nil config runs no hooks
+func NewRunner(cfg *config.HooksConfig) *Runner {
+	return &Runner{
+		config: cfg,
+		client: &http.Client{},
+	}
+}
+
+// Run executes every hook registered for the event, in order
+func (r *Runner) Run(ctx context.Context, event Event) []Result {
+	if r.config == nil {
+		return nil
+	}
+
+	var hooks []config.HookConfig
+	switch event.Type {
+	case EventStart:
+		hooks = r.config.OnStart
+	case EventStage:
+		hooks = r.config.OnStage
+	case EventEnd:
+		hooks = r.config.OnEnd
+	}
+
+	if event.Timestamp == "" {
+		event.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	results := make([]Result, 0, len(hooks))
+	for i, hook := range hooks {
+		result := r.execute(ctx, hook, event)
+		if result.Name == "" {
+			result.Name = fmt.Sprintf("%s-%d", event.Type, i+1)
+		}
+
+		if result.Success {
+			logrus.Debugf("Hook %s succeeded in %s", result.Name, result.Duration)
+		} else {
+			logrus.Warnf("Hook %s failed: %s", result.Name, result.Error)
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// Failed returns the first failed required hook, if any
+func Failed(results []Result) *Result {
+	for i := range results {
+		if results[i].Required && !results[i].Success {
+			return &results[i]
+		}
+	}
+	return nil
+}
+
+// execute runs a single hook
+func (r *Runner) execute(ctx context.Context, hook config.HookConfig, event Event) Result {
+	result := Result{
+		Name:     hook.Name,
+		Event:    event.Type,
+		Stage:    event.Stage,
+		Required: hook.FailOnError,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hook.GetTimeout())
+	defer cancel()
+
+	start := time.Now()
+	var output string
+	var err error
+	if hook.Command != "" {
+		output, err = runCommand(ctx, hook.Command, event)
+	} else {
+		output, err = r.callWebhook(ctx, hook, event)
+	}
+	result.Duration = time.Since(start).String()
+
+	result.Output = truncate(strings.TrimSpace(output))
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Success = true
+	}
+
+	return result
+}
+
+// runCommand runs a shell command with the event exposed as environment variables
+func runCommand(ctx context.Context, command string, event Event) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	cmd.Env = append(os.Environ(),
+		"GOTSUNAMI_EVENT="+event.Type,
+		"GOTSUNAMI_SCENARIO="+event.Scenario,
+		"GOTSUNAMI_STAGE="+strconv.Itoa(event.Stage),
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("command failed: %w", err)
+	}
+
+	return string(output), nil
+}
+
+// callWebhook sends the event as JSON to the hook URL
+func (r *Runner) callWebhook(ctx context.Context, hook config.HookConfig, event Event) (string, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+
+	method := hook.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, hook.Webhook, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range hook.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("webhook failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxOutputSize))
+	if resp.StatusCode >= 300 {
+		return string(body), fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return string(body), nil
+}
+
+// truncate limits output kept in results
+func truncate(s string) string {
+	if len(s) <= maxOutputSize {
+		return s
+	}
+	return s[:maxOutputSize] + "..."
+}
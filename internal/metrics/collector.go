@@ -1,10 +1,12 @@
 package metrics
 
 import (
+	"net/http"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/alexandredias/gotsunami/internal/hooks"
 	"github.com/alexandredias/gotsunami/internal/protocols"
 )
 
@@ -16,19 +18,39 @@ type Collector struct {
 	totalRequests      int64
 	successfulRequests int64
 	failedRequests     int64
+	transportErrors    int64
+	httpErrors         int64
+	notModified        int64
 	totalBytes         int64
 
-	// Latency metrics
-	latencies    []time.Duration
-	minLatency   time.Duration
-	maxLatency   time.Duration
-	totalLatency time.Duration
+	// Latency metrics. Percentiles come from the histogram so summaries of
+	// merged collectors match a single collector that saw every sample.
+	histogram *Histogram
+	precision uint
 
-	// Status code distribution
-	statusCodes map[int]int64
+	// Latency split by status code or error class (see StatusKey), so fast
+	// errors do not hide the tail latency of successful requests
+	statusHistograms map[string]*Histogram
 
-	// Error tracking
-	errors map[string]int64
+	// Requests per tenant, when requests are tagged with one
+	tenants map[string]*tenantStats
+
+	// Requests per load pattern stage, when the pattern has stages
+	stages map[int]*stageStats
+
+	// Requests per logical endpoint, when requests are grouped
+	endpoints map[string]*endpointStats
+
+	// Responses per value of each captured response header
+	headers map[string]map[string]*headerValueStats
+
+	// Status code distribution and error messages, counted without the
+	// collector lock so recording scales with the number of workers
+	statusCodes *statusCounter
+	errors      *errorCounter
+
+	// Requests over time, by when they completed
+	series *timeSeries
 
 	// Time tracking
 	startTime time.Time
@@ -44,13 +66,35 @@ type ValidationResults struct {
 	PassedValidations int64
 	FailedValidations int64
 	ValidationErrors  map[string]int64
+	// Unsampled counts responses outside the validation sample, held to
+	// the status code and response time rules only
+	Unsampled int64
 }
 
 // NewCollector creates a new metrics collector
 func NewCollector() *Collector {
+	return NewCollectorWithPrecision(DefaultHistogramPrecision)
+}
+
+// NewCollectorWithPrecision creates a metrics collector whose latency
+// histograms use precision sub-bucket bits (0 = default)
+func NewCollectorWithPrecision(precision uint) *Collector {
+	if precision == 0 {
+		precision = DefaultHistogramPrecision
+	}
+
 	return &Collector{
-		statusCodes: make(map[int]int64),
-		errors:      make(map[string]int64),
+		precision:   precision,
+		statusCodes: newStatusCounter(),
+		errors:      newErrorCounter(),
+		histogram:   NewHistogram(precision),
+		series:      newTimeSeries(),
+
+		statusHistograms: make(map[string]*Histogram),
+		tenants:          make(map[string]*tenantStats),
+		stages:           make(map[int]*stageStats),
+		endpoints:        make(map[string]*endpointStats),
+		headers:          make(map[string]map[string]*headerValueStats),
 		validationResults: &ValidationResults{
 			ValidationErrors: make(map[string]int64),
 		},
@@ -71,47 +115,69 @@ func (c *Collector) Stop() {
 	c.endTime = time.Now()
 }
 
-// RecordResponse records a response and its metrics
+// RecordResponse records a response and its metrics, counting it as
+// successful unless it failed at the transport or HTTP level
 func (c *Collector) RecordResponse(resp *protocols.Response) {
+	c.RecordResult(resp, !resp.Failed())
+}
+
+// RecordResult records a response whose success was decided by validation.
+// Transport errors and error statuses are still counted separately, so a
+// test expecting 404s succeeds while reporting every 404.
+func (c *Collector) RecordResult(resp *protocols.Response, passed bool) {
 	atomic.AddInt64(&c.totalRequests, 1)
 	atomic.AddInt64(&c.totalBytes, resp.ContentLength)
 
 	// Update latency metrics
-	c.updateLatency(resp.ResponseTime)
+	c.updateLatency(resp, StatusKey(resp.StatusCode, resp.Error), passed)
 
 	// Update status code distribution
 	c.updateStatusCode(resp.StatusCode)
 
 	// Update success/failure counts
-	if resp.Error != nil || resp.StatusCode >= 400 {
+	if passed {
+		atomic.AddInt64(&c.successfulRequests, 1)
+	} else {
 		atomic.AddInt64(&c.failedRequests, 1)
+	}
+
+	switch {
+	case resp.TransportError():
+		atomic.AddInt64(&c.transportErrors, 1)
 		c.recordError(resp.Error)
-	} else {
-		atomic.AddInt64(&c.successfulRequests, 1)
+	case resp.HTTPError():
+		atomic.AddInt64(&c.httpErrors, 1)
+	case resp.StatusCode == http.StatusNotModified:
+		atomic.AddInt64(&c.notModified, 1)
 	}
 }
 
-// updateLatency updates latency-related metrics
-func (c *Collector) updateLatency(latency time.Duration) {
+// updateLatency updates latency-related metrics and the time series
+func (c *Collector) updateLatency(resp *protocols.Response, statusKey string, passed bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.latencies = append(c.latencies, latency)
-	c.totalLatency += latency
-
-	if c.minLatency == 0 || latency < c.minLatency {
-		c.minLatency = latency
+	c.histogram.Record(resp.ResponseTime)
+	c.statusHistogram(statusKey).Record(resp.ResponseTime)
+	if !c.startTime.IsZero() {
+		c.series.record(time.Since(c.startTime), resp.ResponseTime, resp.ContentLength, !passed)
 	}
-	if latency > c.maxLatency {
-		c.maxLatency = latency
+}
+
+// statusHistogram returns the histogram for statusKey, creating it if needed.
+// The caller must hold the write lock.
+func (c *Collector) statusHistogram(statusKey string) *Histogram {
+	histogram, exists := c.statusHistograms[statusKey]
+	if !exists {
+		histogram = NewHistogram(c.precision)
+		c.statusHistograms[statusKey] = histogram
 	}
+	return histogram
 }
 
 // updateStatusCode updates status code distribution
 func (c *Collector) updateStatusCode(statusCode int) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.statusCodes[statusCode]++
+	c.statusCodes.add(statusCode, 1)
 }
 
 // recordError records an error occurrence
@@ -119,10 +185,7 @@ func (c *Collector) recordError(err error) {
 	if err == nil {
 		return
 	}
-
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.errors[err.Error()]++
+	c.errors.add(err.Error(), 1)
 }
 
 // RecordValidation records a validation result
@@ -141,6 +204,152 @@ func (c *Collector) RecordValidation(passed bool, errorType string) {
 	}
 }
 
+// RecordUnsampled counts a response whose content was not validated,
+// being outside the validation sample
+func (c *Collector) RecordUnsampled() {
+	atomic.AddInt64(&c.validationResults.Unsampled, 1)
+}
+
+// Merge adds everything recorded by other into c, so collectors owned by
+// separate workers or agents can be combined. Histograms are added bucket by
+// bucket; percentiles are never averaged.
+func (c *Collector) Merge(other *Collector) {
+	if other == nil || other == c {
+		return
+	}
+
+	// Copy other first so the two collectors are never locked together
+	clone := other.clone()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	atomic.AddInt64(&c.totalRequests, clone.totalRequests)
+	atomic.AddInt64(&c.successfulRequests, clone.successfulRequests)
+	atomic.AddInt64(&c.failedRequests, clone.failedRequests)
+	atomic.AddInt64(&c.transportErrors, clone.transportErrors)
+	atomic.AddInt64(&c.httpErrors, clone.httpErrors)
+	atomic.AddInt64(&c.notModified, clone.notModified)
+	atomic.AddInt64(&c.totalBytes, clone.totalBytes)
+
+	c.histogram.Merge(clone.histogram)
+	for key, histogram := range clone.statusHistograms {
+		c.statusHistogram(key).Merge(histogram)
+	}
+	for tenant, stats := range clone.tenants {
+		c.mergeTenant(tenant, stats)
+	}
+	for stage, stats := range clone.stages {
+		c.mergeStage(stage, stats)
+	}
+	for endpoint, stats := range clone.endpoints {
+		c.mergeEndpoint(endpoint, stats)
+	}
+	for header, values := range clone.headers {
+		for value, stats := range values {
+			c.mergeHeaderValue(header, value, stats)
+		}
+	}
+
+	for code, count := range clone.statusCodes.snapshot() {
+		c.statusCodes.add(code, count)
+	}
+	for err, count := range clone.errors.snapshot() {
+		c.errors.add(err, count)
+	}
+
+	validation := clone.validationResults
+	atomic.AddInt64(&c.validationResults.TotalValidations, validation.TotalValidations)
+	atomic.AddInt64(&c.validationResults.PassedValidations, validation.PassedValidations)
+	atomic.AddInt64(&c.validationResults.FailedValidations, validation.FailedValidations)
+	atomic.AddInt64(&c.validationResults.Unsampled, validation.Unsampled)
+	for errorType, count := range validation.ValidationErrors {
+		c.validationResults.ValidationErrors[errorType] += count
+	}
+
+	// The merged run spans from the first start to the last stop, so the
+	// series shifts when the other run started first
+	if !clone.startTime.IsZero() && (c.startTime.IsZero() || clone.startTime.Before(c.startTime)) {
+		if !c.startTime.IsZero() {
+			series := newTimeSeries()
+			series.merge(c.series, c.startTime.Sub(clone.startTime))
+			c.series = series
+		}
+		c.startTime = clone.startTime
+	}
+	if !clone.startTime.IsZero() {
+		c.series.merge(clone.series, clone.startTime.Sub(c.startTime))
+	}
+	if clone.endTime.After(c.endTime) {
+		c.endTime = clone.endTime
+	}
+}
+
+// clone returns a consistent copy of everything the collector recorded
+func (c *Collector) clone() *Collector {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	clone := NewCollectorWithPrecision(c.precision)
+	clone.totalRequests = atomic.LoadInt64(&c.totalRequests)
+	clone.successfulRequests = atomic.LoadInt64(&c.successfulRequests)
+	clone.failedRequests = atomic.LoadInt64(&c.failedRequests)
+	clone.transportErrors = atomic.LoadInt64(&c.transportErrors)
+	clone.httpErrors = atomic.LoadInt64(&c.httpErrors)
+	clone.notModified = atomic.LoadInt64(&c.notModified)
+	clone.totalBytes = atomic.LoadInt64(&c.totalBytes)
+	clone.startTime, clone.endTime = c.startTime, c.endTime
+
+	clone.histogram.Merge(c.histogram)
+	clone.series.merge(c.series, 0)
+	for key, histogram := range c.statusHistograms {
+		clone.statusHistogram(key).Merge(histogram)
+	}
+	for tenant, stats := range c.tenants {
+		clone.mergeTenant(tenant, stats)
+	}
+	for stage, stats := range c.stages {
+		clone.mergeStage(stage, stats)
+	}
+	for endpoint, stats := range c.endpoints {
+		clone.mergeEndpoint(endpoint, stats)
+	}
+	for header, values := range c.headers {
+		for value, stats := range values {
+			clone.mergeHeaderValue(header, value, stats)
+		}
+	}
+	for code, count := range c.statusCodes.snapshot() {
+		clone.statusCodes.add(code, count)
+	}
+	for err, count := range c.errors.snapshot() {
+		clone.errors.add(err, count)
+	}
+
+	validation := clone.validationResults
+	validation.TotalValidations = atomic.LoadInt64(&c.validationResults.TotalValidations)
+	validation.PassedValidations = atomic.LoadInt64(&c.validationResults.PassedValidations)
+	validation.FailedValidations = atomic.LoadInt64(&c.validationResults.FailedValidations)
+	validation.Unsampled = atomic.LoadInt64(&c.validationResults.Unsampled)
+	for errorType, count := range c.validationResults.ValidationErrors {
+		validation.ValidationErrors[errorType] = count
+	}
+
+	return clone
+}
+
+// Counts returns the total and failed request counts so far
+func (c *Collector) Counts() (total, failed int64) {
+	return atomic.LoadInt64(&c.totalRequests), atomic.LoadInt64(&c.failedRequests)
+}
+
+// CountSlowerThan returns how many requests took longer than d so far
+func (c *Collector) CountSlowerThan(d time.Duration) int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.histogram.CountAbove(d)
+}
+
 // GetSummary returns a summary of collected metrics
 func (c *Collector) GetSummary() *Summary {
 	c.mu.RLock()
@@ -150,104 +359,271 @@ func (c *Collector) GetSummary() *Summary {
 		TotalRequests:      atomic.LoadInt64(&c.totalRequests),
 		SuccessfulRequests: atomic.LoadInt64(&c.successfulRequests),
 		FailedRequests:     atomic.LoadInt64(&c.failedRequests),
+		TransportErrors:    atomic.LoadInt64(&c.transportErrors),
+		HTTPErrors:         atomic.LoadInt64(&c.httpErrors),
+		NotModified:        atomic.LoadInt64(&c.notModified),
 		TotalBytes:         atomic.LoadInt64(&c.totalBytes),
-		StatusCodes:        make(map[int]int64),
-		Errors:             make(map[string]int64),
+		StatusCodes:        c.statusCodes.snapshot(),
+		Errors:             TopErrors(c.errors.snapshot(), MaxErrors),
 		ValidationResults:  c.validationResults,
 	}
 
-	// Copy status codes
-	for code, count := range c.statusCodes {
-		summary.StatusCodes[code] = count
-	}
-
-	// Copy errors
-	for err, count := range c.errors {
-		summary.Errors[err] = count
-	}
-
 	// Calculate latency statistics
-	if len(c.latencies) > 0 {
-		summary.Latency = c.calculateLatencyStats()
+	if c.histogram.Count() > 0 {
+		summary.Latency = HistogramLatencyStats(c.histogram)
+		summary.Histogram = c.histogram.Snapshot()
+
+		summary.LatencyByStatus = make(map[string]*LatencyStats, len(c.statusHistograms))
+		summary.StatusHistograms = make(map[string]*HistogramSnapshot, len(c.statusHistograms))
+		for key, histogram := range c.statusHistograms {
+			summary.LatencyByStatus[key] = HistogramLatencyStats(histogram)
+			summary.StatusHistograms[key] = histogram.Snapshot()
+		}
 	}
 
+	summary.Tenants = c.tenantSummaries()
+	summary.Stages = c.stageSummaries()
+	summary.Endpoints = c.endpointSummaries()
+	summary.Headers = c.headerSummaries()
+
 	// Calculate success rate
 	if summary.TotalRequests > 0 {
 		summary.SuccessRate = float64(summary.SuccessfulRequests) / float64(summary.TotalRequests) * 100
 	}
 
 	// Calculate throughput
+	var duration time.Duration
 	if !c.startTime.IsZero() && !c.endTime.IsZero() {
-		duration := c.endTime.Sub(c.startTime)
+		duration = c.endTime.Sub(c.startTime)
 		if duration > 0 {
 			summary.RequestsPerSecond = float64(summary.TotalRequests) / duration.Seconds()
 			summary.BytesPerSecond = float64(summary.TotalBytes) / duration.Seconds()
 		}
 	}
+	summary.Series = c.series.summary(duration)
 
 	return summary
 }
 
-// calculateLatencyStats calculates latency statistics
-func (c *Collector) calculateLatencyStats() *LatencyStats {
-	if len(c.latencies) == 0 {
-		return &LatencyStats{}
+// HistogramLatencyStats summarizes the latency recorded in a histogram
+func HistogramLatencyStats(h *Histogram) *LatencyStats {
+	return &LatencyStats{
+		Min:    h.Min(),
+		Max:    h.Max(),
+		Mean:   h.Mean(),
+		Median: h.Percentile(50),
+		P90:    h.Percentile(90),
+		P95:    h.Percentile(95),
+		P99:    h.Percentile(99),
+		P99_9:  h.Percentile(99.9),
+
+		Samples: h.Count(),
+		P95CI:   histogramInterval(h, 95),
+		P99CI:   histogramInterval(h, 99),
 	}
+}
 
-	// Sort latencies for percentile calculation
-	sortedLatencies := make([]time.Duration, len(c.latencies))
-	copy(sortedLatencies, c.latencies)
-
-	// Simple sort (in production, use a more efficient algorithm)
-	for i := 0; i < len(sortedLatencies); i++ {
-		for j := i + 1; j < len(sortedLatencies); j++ {
-			if sortedLatencies[i] > sortedLatencies[j] {
-				sortedLatencies[i], sortedLatencies[j] = sortedLatencies[j], sortedLatencies[i]
-			}
-		}
+// histogramInterval returns the confidence interval of a percentile
+func histogramInterval(h *Histogram, percentile float64) *PercentileInterval {
+	if h.Count() == 0 {
+		return nil
 	}
+	lower, upper, bounded := h.PercentileInterval(percentile)
+	return &PercentileInterval{Lower: lower, Upper: upper, Bounded: bounded}
+}
 
-	stats := &LatencyStats{
-		Min:    c.minLatency,
-		Max:    c.maxLatency,
-		Mean:   c.totalLatency / time.Duration(len(c.latencies)),
-		Median: c.calculatePercentile(sortedLatencies, 50),
-		P90:    c.calculatePercentile(sortedLatencies, 90),
-		P95:    c.calculatePercentile(sortedLatencies, 95),
-		P99:    c.calculatePercentile(sortedLatencies, 99),
-		P99_9:  c.calculatePercentile(sortedLatencies, 99.9),
-	}
+// Summary represents aggregated metrics
+type Summary struct {
+	TotalRequests      int64                         `json:"total_requests"`
+	SuccessfulRequests int64                         `json:"successful_requests"`
+	FailedRequests     int64                         `json:"failed_requests"`
+	TransportErrors    int64                         `json:"transport_errors"`
+	HTTPErrors         int64                         `json:"http_errors"`
+	NotModified        int64                         `json:"not_modified"`
+	SuccessRate        float64                       `json:"success_rate"`
+	TotalBytes         int64                         `json:"total_bytes"`
+	RequestsPerSecond  float64                       `json:"requests_per_second"`
+	BytesPerSecond     float64                       `json:"bytes_per_second"`
+	Latency            *LatencyStats                 `json:"latency"`
+	Histogram          *HistogramSnapshot            `json:"histogram,omitempty"`
+	LatencyByStatus    map[string]*LatencyStats      `json:"latency_by_status,omitempty"`
+	StatusHistograms   map[string]*HistogramSnapshot `json:"status_histograms,omitempty"`
+	StatusCodes        map[int]int64                 `json:"status_codes"`
+	Errors             map[string]int64              `json:"errors"`
+	ValidationResults  *ValidationResults            `json:"validation_results"`
+	Hooks              []hooks.Result                `json:"hooks,omitempty"`
+	Cleanup            *CleanupSummary               `json:"cleanup,omitempty"`
+	Throttle           *ThrottleSummary              `json:"throttle,omitempty"`
+	Drain              *DrainSummary                 `json:"drain,omitempty"`
+	Warmup             *WarmupSummary                `json:"warmup,omitempty"`
+	Idempotency        *IdempotencySummary           `json:"idempotency,omitempty"`
+	Consistency        *ConsistencySummary           `json:"consistency,omitempty"`
+	Annotations        []Annotation                  `json:"annotations,omitempty"`
+	MethodMetrics      *MethodSummary                `json:"method_metrics,omitempty"`
+	Tenants            map[string]*TenantSummary     `json:"tenants,omitempty"`
+	Stages             []*StageSummary               `json:"stages,omitempty"`
+	Endpoints          map[string]*EndpointSummary   `json:"endpoints,omitempty"`
+	SLOViolations      []string                      `json:"slo_violations,omitempty"`
+
+	ConnectionPool *ConnectionPoolSummary `json:"connection_pool,omitempty"`
+
+	// DroppedIterations counts the iterations stages were due to start while
+	// every VU was busy
+	DroppedIterations int64 `json:"dropped_iterations,omitempty"`
+
+	// Generator describes the CPU use of the load generator itself
+	Generator *GeneratorSummary `json:"generator,omitempty"`
+
+	// Clock flags system clock jumps and generator stalls during the test
+	Clock *ClockSummary `json:"clock,omitempty"`
+
+	// HTTPVersions counts the responses by the HTTP version negotiated,
+	// such as HTTP/1.1 or HTTP/2.0
+	HTTPVersions map[string]int64 `json:"http_versions,omitempty"`
+
+	// Headers break the responses down by the value of each captured header
+	Headers map[string]map[string]*HeaderValueSummary `json:"headers,omitempty"`
+
+	// Series is the test over time
+	Series *SeriesSummary `json:"series,omitempty"`
+}
 
-	return stats
+// CleanupSummary reports the deletion of resources created during the test
+type CleanupSummary struct {
+	Captured  int    `json:"captured"`
+	Deleted   int    `json:"deleted"`
+	Failed    int    `json:"failed"`
+	Remaining int    `json:"remaining"`
+	Duration  string `json:"duration,omitempty"`
 }
 
-// calculatePercentile calculates a percentile from sorted latencies
-func (c *Collector) calculatePercentile(sortedLatencies []time.Duration, percentile float64) time.Duration {
-	if len(sortedLatencies) == 0 {
-		return 0
-	}
+// DrainSummary reports the requests still in flight when the test ended:
+// those that completed during the drain period are in the totals, those
+// abandoned at its end are not
+type DrainSummary struct {
+	InFlight  int64  `json:"in_flight"`
+	Completed int64  `json:"completed"`
+	Abandoned int64  `json:"abandoned"`
+	Duration  string `json:"duration"`
+}
 
-	index := int(float64(len(sortedLatencies)-1) * percentile / 100)
-	if index >= len(sortedLatencies) {
-		index = len(sortedLatencies) - 1
-	}
+// WarmupSummary reports the warm-up held before the measured test; its
+// requests are in no other metric. P95 is the latency of the last window.
+type WarmupSummary struct {
+	Duration string `json:"duration"`
+	Requests int64  `json:"requests"`
+	Stable   bool   `json:"stable"`
+	P95      string `json:"p95,omitempty"`
+}
 
-	return sortedLatencies[index]
+// ThrottleSummary reports how long the target's rate limiting held the test
+// back. Percentage is the share of the test spent backing off.
+type ThrottleSummary struct {
+	Responses  int64   `json:"responses"`
+	Duration   string  `json:"duration"`
+	Percentage float64 `json:"percentage"`
 }
 
-// Summary represents aggregated metrics
-type Summary struct {
-	TotalRequests      int64              `json:"total_requests"`
-	SuccessfulRequests int64              `json:"successful_requests"`
-	FailedRequests     int64              `json:"failed_requests"`
-	SuccessRate        float64            `json:"success_rate"`
-	TotalBytes         int64              `json:"total_bytes"`
-	RequestsPerSecond  float64            `json:"requests_per_second"`
-	BytesPerSecond     float64            `json:"bytes_per_second"`
-	Latency            *LatencyStats      `json:"latency"`
-	StatusCodes        map[int]int64      `json:"status_codes"`
-	Errors             map[string]int64   `json:"errors"`
-	ValidationResults  *ValidationResults `json:"validation_results"`
+// ConnectionPoolSummary describes the client connection pool, so an
+// exhausted pool shows as waits rather than as unexplained latency. Open,
+// InUse, Idle and Waiting are counts at the time of the summary; Waits
+// counts requests that found no idle connection, for WaitTime in total.
+type ConnectionPoolSummary struct {
+	Dials        int64  `json:"dials"`
+	DialFailures int64  `json:"dial_failures"`
+	Reused       int64  `json:"reused"`
+	Open         int64  `json:"open"`
+	InUse        int64  `json:"in_use"`
+	Idle         int64  `json:"idle"`
+	Waiting      int64  `json:"waiting"`
+	PeakOpen     int64  `json:"peak_open"`
+	PeakInUse    int64  `json:"peak_in_use"`
+	PeakWaiting  int64  `json:"peak_waiting"`
+	Waits        int64  `json:"waits"`
+	WaitTime     string `json:"wait_time,omitempty"`
+	MaxWait      string `json:"max_wait,omitempty"`
+}
+
+// GeneratorSummary describes how busy the load generator kept the CPUs it
+// may use: GOMAXPROCS, or CPULimit, the CPU limit of its container, when
+// lower. Usages are percentages of those CPUs, PeakUsage over one second.
+// Warning is set when the generator was saturated or throttled long enough
+// to distort the results.
+type GeneratorSummary struct {
+	GOMAXPROCS    int     `json:"gomaxprocs"`
+	CPULimit      float64 `json:"cpu_limit,omitempty"`
+	CPUUsage      float64 `json:"cpu_usage"`
+	PeakUsage     float64 `json:"peak_cpu_usage"`
+	SaturatedTime string  `json:"saturated_time,omitempty"`
+	Throttled     string  `json:"throttled,omitempty"`
+	Warning       string  `json:"warning,omitempty"`
+}
+
+// ClockSummary reports what the clocks revealed during the test: jumps of
+// the system clock away from the monotonic clock latencies are measured on,
+// stalls of the generator, and the total slew when NTP adjusted the clock
+// gradually. Jumps and stalls list the first few of JumpCount and StallCount.
+type ClockSummary struct {
+	Jumps        []ClockEvent `json:"jumps,omitempty"`
+	JumpCount    int          `json:"jump_count,omitempty"`
+	Drift        string       `json:"drift,omitempty"`
+	Stalls       []ClockEvent `json:"stalls,omitempty"`
+	StallCount   int          `json:"stall_count,omitempty"`
+	StalledTime  string       `json:"stalled_time,omitempty"`
+	LongestStall string       `json:"longest_stall,omitempty"`
+	Warning      string       `json:"warning,omitempty"`
+}
+
+// ClockEvent is a clock jump, or a stall, of Shift at an offset from the
+// start of the load
+type ClockEvent struct {
+	Offset string `json:"offset"`
+	Time   string `json:"time"`
+	Shift  string `json:"shift"`
+}
+
+// IdempotencySummary reports operations sent with an idempotency key.
+// Checked operations got a resource ID from more than one attempt; in
+// duplicates, those attempts returned different resources.
+type IdempotencySummary struct {
+	Operations int64 `json:"operations"`
+	Retries    int64 `json:"retries"`
+	Replays    int64 `json:"replays"`
+	Checked    int64 `json:"checked"`
+	Duplicates int64 `json:"duplicates"`
+}
+
+// ConsistencySummary reports the URLs whose response bodies were compared.
+// Inconsistent URLs returned more than one body; URLs lists them, up to a
+// limit, with how many responses carried each body hash.
+type ConsistencySummary struct {
+	Checked      int64             `json:"checked"`
+	Responses    int64             `json:"responses"`
+	Inconsistent int64             `json:"inconsistent"`
+	URLs         []InconsistentURL `json:"urls,omitempty"`
+}
+
+// InconsistentURL is a URL that returned different bodies during the test
+type InconsistentURL struct {
+	URL      string           `json:"url"`
+	Variants map[string]int64 `json:"variants"`
+}
+
+// Annotation marks a moment of the run, such as a deploy, at an offset from
+// the start of the load
+type Annotation struct {
+	Offset string `json:"offset"`
+	Time   string `json:"time"`
+	Text   string `json:"text"`
+}
+
+// MethodSummary reports metrics specific to the scenario's method: the body
+// size HEAD responses declared in total, and how often OPTIONS responses
+// allowed each set of methods
+type MethodSummary struct {
+	Method        string           `json:"method"`
+	DeclaredBytes int64            `json:"declared_bytes,omitempty"`
+	Allow         map[string]int64 `json:"allow,omitempty"`
 }
 
 // LatencyStats represents latency statistics
@@ -260,4 +636,19 @@ type LatencyStats struct {
 	P95    time.Duration `json:"p95"`
 	P99    time.Duration `json:"p99"`
 	P99_9  time.Duration `json:"p99_9"`
+
+	// Samples behind the percentiles, and 95% confidence intervals of the
+	// tail percentiles, so a p99 taken from a short run is not over-read
+	Samples int64               `json:"samples"`
+	P95CI   *PercentileInterval `json:"p95_ci,omitempty"`
+	P99CI   *PercentileInterval `json:"p99_ci,omitempty"`
+}
+
+// PercentileInterval is a 95% confidence interval of a percentile. Bounded is
+// false when there are too few samples to bound it, and the interval then
+// runs into the smallest or largest latency.
+type PercentileInterval struct {
+	Lower   time.Duration `json:"lower"`
+	Upper   time.Duration `json:"upper"`
+	Bounded bool          `json:"bounded"`
 }
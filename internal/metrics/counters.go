@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// MaxErrors bounds the error messages reported separately; the less
+	// frequent ones are counted together under OtherErrors
+	MaxErrors = 100
+
+	// OtherErrors groups the error messages not reported separately
+	OtherErrors = "(other errors)"
+
+	// maxTrackedErrors bounds the distinct messages counted during a test, so
+	// an error storm with unique messages cannot exhaust memory. Messages
+	// first seen after that are counted under OtherErrors.
+	maxTrackedErrors = 10 * MaxErrors
+
+	// errorShards spreads the error messages over separately locked maps
+	errorShards = 16
+
+	// maxStatusCode bounds the status codes counted without a lock; HTTP
+	// status codes have three digits and gRPC codes are smaller
+	maxStatusCode = 1000
+)
+
+// statusCounter counts responses by status code with an atomic counter per
+// code, so recording never waits on a lock
+type statusCounter struct {
+	counts [maxStatusCode]int64
+
+	// Codes out of range, which only unusual protocols produce
+	mu    sync.Mutex
+	other map[int]int64
+}
+
+func newStatusCounter() *statusCounter {
+	return &statusCounter{other: make(map[int]int64)}
+}
+
+// add counts n responses with code
+func (s *statusCounter) add(code int, n int64) {
+	if code >= 0 && code < maxStatusCode {
+		atomic.AddInt64(&s.counts[code], n)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.other[code] += n
+}
+
+// snapshot returns the count of every code seen
+func (s *statusCounter) snapshot() map[int]int64 {
+	codes := make(map[int]int64)
+	for code := range s.counts {
+		if count := atomic.LoadInt64(&s.counts[code]); count > 0 {
+			codes[code] = count
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for code, count := range s.other {
+		codes[code] += count
+	}
+	return codes
+}
+
+// errorShard holds the counters of the messages hashed to it. Counters are
+// only created under the write lock and incremented atomically.
+type errorShard struct {
+	mu     sync.RWMutex
+	counts map[string]*int64
+}
+
+// errorCounter counts error messages over sharded maps of atomic counters,
+// tracking at most maxTrackedErrors distinct messages
+type errorCounter struct {
+	shards  [errorShards]errorShard
+	tracked int64
+	other   int64
+}
+
+func newErrorCounter() *errorCounter {
+	e := &errorCounter{}
+	for i := range e.shards {
+		e.shards[i].counts = make(map[string]*int64)
+	}
+	return e
+}
+
+// add counts n occurrences of message
+func (e *errorCounter) add(message string, n int64) {
+	if message == OtherErrors {
+		atomic.AddInt64(&e.other, n)
+		return
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(message))
+	shard := &e.shards[hash.Sum32()%errorShards]
+
+	shard.mu.RLock()
+	count, exists := shard.counts[message]
+	shard.mu.RUnlock()
+	if !exists {
+		if count = e.track(shard, message); count == nil {
+			atomic.AddInt64(&e.other, n)
+			return
+		}
+	}
+	atomic.AddInt64(count, n)
+}
+
+// track returns the counter of message, creating it unless maxTrackedErrors
+// messages are already tracked, in which case it returns nil
+func (e *errorCounter) track(shard *errorShard, message string) *int64 {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if count, exists := shard.counts[message]; exists {
+		return count
+	}
+	if atomic.AddInt64(&e.tracked, 1) > maxTrackedErrors {
+		atomic.AddInt64(&e.tracked, -1)
+		return nil
+	}
+	count := new(int64)
+	shard.counts[message] = count
+	return count
+}
+
+// snapshot returns the count of every tracked message, and of OtherErrors
+// when messages went untracked
+func (e *errorCounter) snapshot() map[string]int64 {
+	errors := make(map[string]int64)
+	for i := range e.shards {
+		shard := &e.shards[i]
+		shard.mu.RLock()
+		for message, count := range shard.counts {
+			errors[message] = atomic.LoadInt64(count)
+		}
+		shard.mu.RUnlock()
+	}
+	if other := atomic.LoadInt64(&e.other); other > 0 {
+		errors[OtherErrors] = other
+	}
+	return errors
+}
+
+// TopErrors keeps the k most frequent error messages and counts the others
+// under OtherErrors. errors is returned as is when it has no more than k.
+func TopErrors(errors map[string]int64, k int) map[string]int64 {
+	messages := make([]string, 0, len(errors))
+	for message := range errors {
+		if message != OtherErrors {
+			messages = append(messages, message)
+		}
+	}
+	if len(messages) <= k {
+		return errors
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		if errors[messages[i]] != errors[messages[j]] {
+			return errors[messages[i]] > errors[messages[j]]
+		}
+		return messages[i] < messages[j]
+	})
+
+	top := make(map[string]int64, k+1)
+	for _, message := range messages[:k] {
+		top[message] = errors[message]
+	}
+	other := errors[OtherErrors]
+	for _, message := range messages[k:] {
+		other += errors[message]
+	}
+	top[OtherErrors] = other
+	return top
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"github.com/alexandredias/gotsunami/internal/protocols"
+)
+
+// MaxEndpoints bounds the endpoints reported separately; requests to further
+// endpoints are grouped under OtherEndpoints, in case paths that are not
+// normalized make every URL a new endpoint
+const MaxEndpoints = 1000
+
+// OtherEndpoints groups the endpoints seen after MaxEndpoints
+const OtherEndpoints = "(other)"
+
+// endpointStats holds the requests recorded for one endpoint
+type endpointStats struct {
+	requests        int64
+	failed          int64
+	transportErrors int64
+	httpErrors      int64
+	histogram       *Histogram
+}
+
+// EndpointSummary reports the requests to one logical endpoint, named by
+// the scenario group or the URL template its path matched
+type EndpointSummary struct {
+	Requests        int64              `json:"requests"`
+	Failed          int64              `json:"failed"`
+	TransportErrors int64              `json:"transport_errors"`
+	HTTPErrors      int64              `json:"http_errors"`
+	SuccessRate     float64            `json:"success_rate"`
+	Latency         *LatencyStats      `json:"latency"`
+	Histogram       *HistogramSnapshot `json:"histogram,omitempty"`
+}
+
+// RecordEndpoint adds a response, already recorded with RecordResult, to the
+// breakdown of endpoint
+func (c *Collector) RecordEndpoint(endpoint string, resp *protocols.Response, passed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.endpointStats(endpoint)
+	stats.requests++
+	if !passed {
+		stats.failed++
+	}
+	switch {
+	case resp.TransportError():
+		stats.transportErrors++
+	case resp.HTTPError():
+		stats.httpErrors++
+	}
+	stats.histogram.Record(resp.ResponseTime)
+}
+
+// endpointStats returns the stats of endpoint, creating them if needed. The
+// caller must hold the write lock.
+func (c *Collector) endpointStats(endpoint string) *endpointStats {
+	stats, exists := c.endpoints[endpoint]
+	if exists {
+		return stats
+	}
+	if len(c.endpoints) >= MaxEndpoints {
+		if stats, exists := c.endpoints[OtherEndpoints]; exists {
+			return stats
+		}
+		endpoint = OtherEndpoints
+	}
+
+	stats = &endpointStats{histogram: NewHistogram(c.precision)}
+	c.endpoints[endpoint] = stats
+	return stats
+}
+
+// mergeEndpoint adds the stats of another collector's endpoint. The caller
+// must hold the write lock.
+func (c *Collector) mergeEndpoint(endpoint string, other *endpointStats) {
+	stats := c.endpointStats(endpoint)
+	stats.requests += other.requests
+	stats.failed += other.failed
+	stats.transportErrors += other.transportErrors
+	stats.httpErrors += other.httpErrors
+	stats.histogram.Merge(other.histogram)
+}
+
+// endpointSummaries summarizes every endpoint, or returns nil when requests
+// were not grouped. The caller must hold the read lock.
+func (c *Collector) endpointSummaries() map[string]*EndpointSummary {
+	if len(c.endpoints) == 0 {
+		return nil
+	}
+
+	summaries := make(map[string]*EndpointSummary, len(c.endpoints))
+	for endpoint, stats := range c.endpoints {
+		summary := &EndpointSummary{
+			Requests:        stats.requests,
+			Failed:          stats.failed,
+			TransportErrors: stats.transportErrors,
+			HTTPErrors:      stats.httpErrors,
+		}
+		if stats.requests > 0 {
+			summary.SuccessRate = float64(stats.requests-stats.failed) / float64(stats.requests) * 100
+		}
+		if stats.histogram.Count() > 0 {
+			summary.Latency = HistogramLatencyStats(stats.histogram)
+			summary.Histogram = stats.histogram.Snapshot()
+		}
+		summaries[endpoint] = summary
+	}
+
+	return summaries
+}
+
+// MergeEndpointSummaries combines the summaries of two endpoints reported
+// under the same name; either may be nil
+func MergeEndpointSummaries(a, b *EndpointSummary) *EndpointSummary {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	merged := &EndpointSummary{
+		Requests:        a.Requests + b.Requests,
+		Failed:          a.Failed + b.Failed,
+		TransportErrors: a.TransportErrors + b.TransportErrors,
+		HTTPErrors:      a.HTTPErrors + b.HTTPErrors,
+	}
+	if merged.Requests > 0 {
+		merged.SuccessRate = float64(merged.Requests-merged.Failed) / float64(merged.Requests) * 100
+	}
+	if a.Histogram != nil && b.Histogram != nil {
+		histogram := NewHistogramFromSnapshot(a.Histogram)
+		histogram.Merge(NewHistogramFromSnapshot(b.Histogram))
+		merged.Latency = HistogramLatencyStats(histogram)
+		merged.Histogram = histogram.Snapshot()
+	} else if a.Histogram != nil {
+		merged.Latency, merged.Histogram = a.Latency, a.Histogram
+	} else {
+		merged.Latency, merged.Histogram = b.Latency, b.Histogram
+	}
+	return merged
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// Error classes used to group failed requests that produced no status code
+const (
+	ErrorClassTimeout           = "timeout"
+	ErrorClassDNS               = "dns"
+	ErrorClassTLS               = "tls"
+	ErrorClassConnectionRefused = "connection_refused"
+	ErrorClassConnectionReset   = "connection_reset"
+	ErrorClassCanceled          = "canceled"
+	ErrorClassOther             = "other"
+)
+
+// ErrorClass returns a coarse class for a request error
+func ErrorClass(err error) string {
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return ErrorClassDNS
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthority),
+		errors.As(err, &hostnameErr), errors.As(err, &recordErr):
+		return ErrorClassTLS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorClassConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ErrorClassConnectionReset
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	default:
+		return ErrorClassOther
+	}
+}
+
+// StatusKey returns the key a response is grouped under in per-status
+// latency: its status code, or "error:<class>" when it has none
+func StatusKey(statusCode int, err error) string {
+	if err != nil && statusCode == 0 {
+		return "error:" + ErrorClass(err)
+	}
+	return strconv.Itoa(statusCode)
+}
@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"github.com/alexandredias/gotsunami/internal/protocols"
+)
+
+const (
+	// MaxHeaderValues bounds the values reported separately for a captured
+	// header; further values are grouped under OtherHeaderValues, in case a
+	// header such as a request ID is unique to every response
+	MaxHeaderValues = 100
+
+	// OtherHeaderValues groups the values seen after MaxHeaderValues
+	OtherHeaderValues = "(other)"
+
+	// MissingHeader counts the responses without the captured header
+	MissingHeader = "(none)"
+)
+
+// headerValueStats holds the responses carrying one value of a header
+type headerValueStats struct {
+	responses int64
+	failed    int64
+	histogram *Histogram
+}
+
+// HeaderValueSummary reports the responses carrying one value of a captured
+// header, such as the cache hits or the responses of one backend.
+// Percentage is their share of the responses with the header captured.
+type HeaderValueSummary struct {
+	Responses   int64              `json:"responses"`
+	Failed      int64              `json:"failed"`
+	Percentage  float64            `json:"percentage"`
+	SuccessRate float64            `json:"success_rate"`
+	Latency     *LatencyStats      `json:"latency"`
+	Histogram   *HistogramSnapshot `json:"histogram,omitempty"`
+}
+
+// RecordHeaders adds a response, already recorded with RecordResult, to the
+// breakdown of each captured header by value; values holds the value of
+// each header, MissingHeader when the response lacked it
+func (c *Collector) RecordHeaders(values map[string]string, resp *protocols.Response, passed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for header, value := range values {
+		stats := c.headerValueStats(header, value)
+		stats.responses++
+		if !passed {
+			stats.failed++
+		}
+		stats.histogram.Record(resp.ResponseTime)
+	}
+}
+
+// headerValueStats returns the stats of a value of header, creating them if
+// needed. The caller must hold the write lock.
+func (c *Collector) headerValueStats(header, value string) *headerValueStats {
+	values, exists := c.headers[header]
+	if !exists {
+		values = make(map[string]*headerValueStats)
+		c.headers[header] = values
+	}
+
+	stats, exists := values[value]
+	if exists {
+		return stats
+	}
+	if len(values) >= MaxHeaderValues {
+		if stats, exists := values[OtherHeaderValues]; exists {
+			return stats
+		}
+		value = OtherHeaderValues
+	}
+
+	stats = &headerValueStats{histogram: NewHistogram(c.precision)}
+	values[value] = stats
+	return stats
+}
+
+// mergeHeaderValue adds the stats of a value of another collector's header.
+// The caller must hold the write lock.
+func (c *Collector) mergeHeaderValue(header, value string, other *headerValueStats) {
+	stats := c.headerValueStats(header, value)
+	stats.responses += other.responses
+	stats.failed += other.failed
+	stats.histogram.Merge(other.histogram)
+}
+
+// headerSummaries summarizes every value of every captured header, or
+// returns nil when no header was captured. The caller must hold the read
+// lock.
+func (c *Collector) headerSummaries() map[string]map[string]*HeaderValueSummary {
+	if len(c.headers) == 0 {
+		return nil
+	}
+
+	summaries := make(map[string]map[string]*HeaderValueSummary, len(c.headers))
+	for header, values := range c.headers {
+		var total int64
+		for _, stats := range values {
+			total += stats.responses
+		}
+
+		summaries[header] = make(map[string]*HeaderValueSummary, len(values))
+		for value, stats := range values {
+			summary := &HeaderValueSummary{Responses: stats.responses, Failed: stats.failed}
+			if total > 0 {
+				summary.Percentage = float64(stats.responses) / float64(total) * 100
+			}
+			if stats.responses > 0 {
+				summary.SuccessRate = float64(stats.responses-stats.failed) / float64(stats.responses) * 100
+			}
+			if stats.histogram.Count() > 0 {
+				summary.Latency = HistogramLatencyStats(stats.histogram)
+				summary.Histogram = stats.histogram.Snapshot()
+			}
+			summaries[header][value] = summary
+		}
+	}
+	return summaries
+}
+
+// MergeHeaderValues combines the values of a captured header that are
+// reported under the same name, such as values masked alike, computing the
+// percentages again
+func MergeHeaderValues(values map[string]*HeaderValueSummary, rename func(string) string) map[string]*HeaderValueSummary {
+	merged := make(map[string]*HeaderValueSummary, len(values))
+	var total int64
+	for value, summary := range values {
+		value = rename(value)
+		total += summary.Responses
+
+		existing, exists := merged[value]
+		if !exists {
+			copied := *summary
+			merged[value] = &copied
+			continue
+		}
+
+		existing.Responses += summary.Responses
+		existing.Failed += summary.Failed
+		switch {
+		case existing.Histogram != nil && summary.Histogram != nil:
+			histogram := NewHistogramFromSnapshot(existing.Histogram)
+			histogram.Merge(NewHistogramFromSnapshot(summary.Histogram))
+			existing.Latency = HistogramLatencyStats(histogram)
+			existing.Histogram = histogram.Snapshot()
+		case existing.Histogram == nil:
+			existing.Latency, existing.Histogram = summary.Latency, summary.Histogram
+		}
+	}
+
+	for _, summary := range merged {
+		if total > 0 {
+			summary.Percentage = float64(summary.Responses) / float64(total) * 100
+		}
+		if summary.Responses > 0 {
+			summary.SuccessRate = float64(summary.Responses-summary.Failed) / float64(summary.Responses) * 100
+		}
+	}
+	return merged
+}
@@ -0,0 +1,292 @@
+package metrics
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Histogram precisions, in sub-bucket bits. The relative error of a value is
+// at most 2^-precision, and each extra bit doubles the memory per histogram:
+// for latencies up to a minute, about 10KB at 7 bits, 72KB at 10 and 900KB
+// at 14.
+const (
+	// DefaultHistogramPrecision keeps the relative error below 1%
+	DefaultHistogramPrecision = 7
+	// HighHistogramPrecision keeps the relative error below 0.1%, for
+	// benchmark-grade runs
+	HighHistogramPrecision = 10
+	// MaxHistogramPrecision keeps the relative error below 0.01%
+	MaxHistogramPrecision = 14
+)
+
+// confidenceZ is the standard normal quantile of 95% confidence intervals
+const confidenceZ = 1.96
+
+// Histogram is a log-linear latency histogram in the spirit of HDR histograms.
+// Values are recorded in microseconds; each power-of-two range is split into
+// 2^(precision-1) linear sub-buckets, so memory stays constant regardless of
+// the number of samples and two histograms can be merged exactly.
+type Histogram struct {
+	precision uint
+	counts    []int64
+	total     int64
+	sum       int64
+	min       int64
+	max       int64
+}
+
+// HistogramBucket is a non-empty histogram bucket
+type HistogramBucket struct {
+	Value int64 `json:"value_us"` // representative value of the bucket in microseconds
+	Count int64 `json:"count"`
+}
+
+// HistogramSnapshot is the serializable form of a histogram
+type HistogramSnapshot struct {
+	Unit      string            `json:"unit"`
+	Precision uint              `json:"precision"`
+	Count     int64             `json:"count"`
+	Sum       int64             `json:"sum_us"`
+	Min       int64             `json:"min_us"`
+	Max       int64             `json:"max_us"`
+	Buckets   []HistogramBucket `json:"buckets"`
+}
+
+// NewHistogram creates a histogram with the given sub-bucket precision in bits
+func NewHistogram(precision uint) *Histogram {
+	if precision < 2 {
+		precision = 2
+	}
+	if precision > MaxHistogramPrecision {
+		precision = MaxHistogramPrecision
+	}
+	return &Histogram{
+		precision: precision,
+		min:       math.MaxInt64,
+	}
+}
+
+// NewHistogramFromSnapshot rebuilds a histogram from its serialized form
+func NewHistogramFromSnapshot(snapshot *HistogramSnapshot) *Histogram {
+	h := NewHistogram(snapshot.Precision)
+	for _, bucket := range snapshot.Buckets {
+		h.recordMicros(bucket.Value, bucket.Count)
+	}
+	if snapshot.Count > 0 {
+		h.sum = snapshot.Sum
+		h.min = snapshot.Min
+		h.max = snapshot.Max
+	}
+	return h
+}
+
+// Record adds a latency sample
+func (h *Histogram) Record(d time.Duration) {
+	h.recordMicros(d.Microseconds(), 1)
+}
+
+// recordMicros adds count samples of value v (in microseconds)
+func (h *Histogram) recordMicros(v, count int64) {
+	if count <= 0 {
+		return
+	}
+	if v < 0 {
+		v = 0
+	}
+
+	index := h.bucketIndex(v)
+	if index >= len(h.counts) {
+		grown := make([]int64, index+1)
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+
+	h.counts[index] += count
+	h.total += count
+	h.sum += v * count
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// Merge adds all samples of other into h
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || other.total == 0 {
+		return
+	}
+
+	if other.precision == h.precision {
+		if len(other.counts) > len(h.counts) {
+			grown := make([]int64, len(other.counts))
+			copy(grown, h.counts)
+			h.counts = grown
+		}
+		for i, count := range other.counts {
+			h.counts[i] += count
+		}
+		h.total += other.total
+		h.sum += other.sum
+	} else {
+		sum := h.sum
+		for i, count := range other.counts {
+			h.recordMicros(bucketValue(other.precision, i), count)
+		}
+		h.sum = sum + other.sum
+	}
+
+	if other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+// Precision returns the sub-bucket precision in bits
+func (h *Histogram) Precision() uint {
+	return h.precision
+}
+
+// Count returns the number of recorded samples
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+// CountAbove returns the number of samples in buckets above the one holding d
+func (h *Histogram) CountAbove(d time.Duration) int64 {
+	var count int64
+	for i := h.bucketIndex(d.Microseconds()) + 1; i < len(h.counts); i++ {
+		count += h.counts[i]
+	}
+	return count
+}
+
+// Min returns the smallest recorded value
+func (h *Histogram) Min() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.min) * time.Microsecond
+}
+
+// Max returns the largest recorded value
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max) * time.Microsecond
+}
+
+// Mean returns the average recorded value
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/h.total) * time.Microsecond
+}
+
+// Percentile returns the value at the given percentile (0-100)
+func (h *Histogram) Percentile(percentile float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+
+	return h.valueAtRank(int64(math.Ceil(percentile / 100 * float64(h.total))))
+}
+
+// PercentileInterval returns a distribution-free 95% confidence interval of
+// the value at percentile, from the ranks that bound it under the binomial
+// distribution. Ranks past the samples are clamped to Min and Max, and
+// bounded reports whether they fit, so an interval that runs into Max means
+// the percentile rests on too few samples.
+func (h *Histogram) PercentileInterval(percentile float64) (lower, upper time.Duration, bounded bool) {
+	if h.total == 0 {
+		return 0, 0, false
+	}
+
+	n, q := float64(h.total), percentile/100
+	spread := confidenceZ * math.Sqrt(n*q*(1-q))
+	lowerRank := int64(math.Floor(n*q - spread))
+	upperRank := int64(math.Ceil(n*q+spread)) + 1
+	bounded = lowerRank >= 1 && upperRank <= h.total
+	return h.valueAtRank(lowerRank), h.valueAtRank(upperRank), bounded
+}
+
+// valueAtRank returns the value of the rank-th smallest sample, clamping rank
+// to the recorded samples
+func (h *Histogram) valueAtRank(rank int64) time.Duration {
+	if rank < 1 {
+		rank = 1
+	}
+
+	var cumulative int64
+	for i, count := range h.counts {
+		cumulative += count
+		if cumulative >= rank {
+			value := bucketValue(h.precision, i)
+			if value < h.min {
+				value = h.min
+			}
+			if value > h.max {
+				value = h.max
+			}
+			return time.Duration(value) * time.Microsecond
+		}
+	}
+
+	return h.Max()
+}
+
+// Snapshot returns the serializable form of the histogram
+func (h *Histogram) Snapshot() *HistogramSnapshot {
+	snapshot := &HistogramSnapshot{
+		Unit:      "us",
+		Precision: h.precision,
+		Count:     h.total,
+		Sum:       h.sum,
+		Max:       h.max,
+		Buckets:   make([]HistogramBucket, 0),
+	}
+	if h.total > 0 {
+		snapshot.Min = h.min
+	}
+
+	for i, count := range h.counts {
+		if count > 0 {
+			snapshot.Buckets = append(snapshot.Buckets, HistogramBucket{
+				Value: bucketValue(h.precision, i),
+				Count: count,
+			})
+		}
+	}
+
+	return snapshot
+}
+
+// bucketIndex maps a value to its bucket
+func (h *Histogram) bucketIndex(v int64) int {
+	linear := int64(1) << h.precision
+	if v < linear {
+		return int(v)
+	}
+
+	shift := uint(bits.Len64(uint64(v))) - h.precision
+	mantissa := v >> shift
+	return int(int64(shift)*(linear/2) + mantissa)
+}
+
+// bucketValue returns the representative (midpoint) value of a bucket
+func bucketValue(precision uint, index int) int64 {
+	linear := int64(1) << precision
+	if int64(index) < linear {
+		return int64(index)
+	}
+
+	half := linear / 2
+	shift := int64(index)/half - 1
+	mantissa := int64(index) - shift*half
+	lower := mantissa << uint(shift)
+	upper := ((mantissa + 1) << uint(shift)) - 1
+	return lower + (upper-lower)/2
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// RawResult is a single request outcome written to the raw results output
+type RawResult struct {
+	Timestamp string  `json:"timestamp"`
+	VU        int     `json:"vu"`
+	ClientID  string  `json:"client_id,omitempty"`
+	RequestID string  `json:"request_id,omitempty"`
+	Method    string  `json:"method"`
+	URL       string  `json:"url"`
+	Status    int     `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Bytes     int64   `json:"bytes"`
+	Error     string  `json:"error,omitempty"`
+	Tenant    string  `json:"tenant,omitempty"`
+	Endpoint  string  `json:"endpoint,omitempty"`
+	// OffsetMs is when the request completed since the start of the load,
+	// on the monotonic clock, so it orders results even across clock jumps
+	OffsetMs float64 `json:"offset_ms"`
+}
+
+// RawWriter writes one JSON line per request. It is safe for concurrent use.
+type RawWriter struct {
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// NewRawWriter creates a raw results writer for path
+func NewRawWriter(path string) (*RawWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create raw results file: %w", err)
+	}
+
+	return &RawWriter{
+		file:   file,
+		writer: bufio.NewWriter(file),
+	}, nil
+}
+
+// Write appends a result
+func (w *RawWriter) Write(result RawResult) error {
+	if result.Timestamp == "" {
+		result.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.writer.Write(data)
+	return w.writer.WriteByte('\n')
+}
+
+// Close flushes pending results and closes the file
+func (w *RawWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.writer.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+
+	return w.file.Close()
+}
@@ -0,0 +1,160 @@
+package metrics
+
+import "time"
+
+// Time series bounds. Points start SeriesInterval apart; when a test outgrows
+// MaxSeriesPoints the interval doubles and neighbouring points merge, so
+// memory stays bounded however long the test runs.
+const (
+	SeriesInterval  = time.Second
+	MaxSeriesPoints = 600
+	// seriesPrecision keeps the percentiles of each point within about 6%,
+	// at about 2KB per point
+	seriesPrecision = 4
+)
+
+// timeSeries holds the requests completed in each interval of the test
+type timeSeries struct {
+	interval time.Duration
+	points   []*seriesPoint
+}
+
+// seriesPoint holds the requests completed in one interval
+type seriesPoint struct {
+	requests  int64
+	failed    int64
+	bytes     int64
+	histogram *Histogram
+}
+
+// SeriesSummary is the test over time, in points Interval apart by when
+// their requests completed
+type SeriesSummary struct {
+	Interval string        `json:"interval"`
+	Points   []SeriesPoint `json:"points"`
+}
+
+// SeriesPoint reports the requests completed in one interval, starting
+// Offset seconds into the test. Latency percentiles are in milliseconds.
+type SeriesPoint struct {
+	Offset            float64 `json:"offset_s"`
+	Requests          int64   `json:"requests"`
+	Failed            int64   `json:"failed"`
+	Bytes             int64   `json:"bytes"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	P50               float64 `json:"p50_ms"`
+	P95               float64 `json:"p95_ms"`
+	P99               float64 `json:"p99_ms"`
+}
+
+// newTimeSeries creates an empty series
+func newTimeSeries() *timeSeries {
+	return &timeSeries{interval: SeriesInterval}
+}
+
+// record adds a request completed offset into the test
+func (s *timeSeries) record(offset, latency time.Duration, bytes int64, failed bool) {
+	point := s.point(offset)
+	point.requests++
+	if failed {
+		point.failed++
+	}
+	point.bytes += bytes
+	point.histogram.Record(latency)
+}
+
+// point returns the point covering offset, creating it and widening the
+// series as needed
+func (s *timeSeries) point(offset time.Duration) *seriesPoint {
+	if offset < 0 {
+		offset = 0
+	}
+	index := int(offset / s.interval)
+	for index >= MaxSeriesPoints {
+		s.widen()
+		index = int(offset / s.interval)
+	}
+	for len(s.points) <= index {
+		s.points = append(s.points, nil)
+	}
+	if s.points[index] == nil {
+		s.points[index] = &seriesPoint{histogram: NewHistogram(seriesPrecision)}
+	}
+	return s.points[index]
+}
+
+// widen doubles the interval, merging the points in pairs
+func (s *timeSeries) widen() {
+	merged := make([]*seriesPoint, (len(s.points)+1)/2)
+	for i, point := range s.points {
+		if point == nil {
+			continue
+		}
+		if merged[i/2] == nil {
+			merged[i/2] = point
+			continue
+		}
+		merged[i/2].merge(point)
+	}
+	s.points = merged
+	s.interval *= 2
+}
+
+// merge adds the points of other, whose test started shift after s's
+func (s *timeSeries) merge(other *timeSeries, shift time.Duration) {
+	for s.interval < other.interval {
+		s.widen()
+	}
+	for i, point := range other.points {
+		if point != nil {
+			s.point(shift + time.Duration(i)*other.interval).merge(point)
+		}
+	}
+}
+
+// merge adds the requests of other to the point
+func (p *seriesPoint) merge(other *seriesPoint) {
+	p.requests += other.requests
+	p.failed += other.failed
+	p.bytes += other.bytes
+	p.histogram.Merge(other.histogram)
+}
+
+// summary reports every point up to the last recorded, including empty ones
+// so the series stays continuous. The rate of the last point is over the part
+// of it the test lasted, when duration is known.
+func (s *timeSeries) summary(duration time.Duration) *SeriesSummary {
+	if len(s.points) == 0 {
+		return nil
+	}
+
+	summary := &SeriesSummary{Interval: s.interval.String(), Points: make([]SeriesPoint, len(s.points))}
+	for i, point := range s.points {
+		start := time.Duration(i) * s.interval
+		summary.Points[i].Offset = start.Seconds()
+		if point == nil {
+			continue
+		}
+
+		width := s.interval
+		if duration > start && duration-start < width {
+			width = duration - start
+		}
+		summary.Points[i] = SeriesPoint{
+			Offset:            start.Seconds(),
+			Requests:          point.requests,
+			Failed:            point.failed,
+			Bytes:             point.bytes,
+			RequestsPerSecond: float64(point.requests) / width.Seconds(),
+			P50:               millis(point.histogram.Percentile(50)),
+			P95:               millis(point.histogram.Percentile(95)),
+			P99:               millis(point.histogram.Percentile(99)),
+		}
+	}
+	return summary
+}
+
+// millis converts a duration to fractional milliseconds
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
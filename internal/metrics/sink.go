@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Sink receives every request outcome as it completes, streaming it to a
+// file or an external system during the run. Sinks are safe for concurrent
+// use and must not hold workers up waiting on the network.
+type Sink interface {
+	Write(result RawResult) error
+	Close() error
+}
+
+// OutputSchemes are the outputs accepted by NewSink
+var OutputSchemes = []string{"statsd", "influxdb"}
+
+// NewSink creates the sink of an --out value: a URL whose scheme names the
+// output, such as statsd://localhost:8125?prefix=loadtest&tag=env:staging,
+// or <output>=<URL> as k6 takes them, such as
+// influxdb=http://localhost:8086/k6. Every metric carries tags, as
+// key:value, before those given in the URL.
+func NewSink(output string, tags []string) (Sink, error) {
+	name, address, named := strings.Cut(output, "=")
+	if !named || strings.ContainsAny(name, ":/?") {
+		name, address = "", output
+	}
+	if name == "statsd" && !strings.Contains(address, "://") {
+		// statsd=host:port
+		address = "statsd://" + address
+	}
+	target, err := url.Parse(address)
+	if err != nil || target.Host == "" {
+		return nil, fmt.Errorf("invalid output %q: expected <output>://<host>:<port> or <output>=<URL>", output)
+	}
+	if name == "" {
+		name = target.Scheme
+	}
+
+	switch name {
+	case "influxdb":
+		if target.Scheme == "influxdb" {
+			// influxdb://host:port/database
+			plain := *target
+			plain.Scheme = "http"
+			target = &plain
+		}
+		sink, err := NewInfluxDBSink(target, tags)
+		if err != nil {
+			return nil, err
+		}
+		return sink, nil
+	case "statsd":
+		query := target.Query()
+		sink, err := NewStatsDSink(target.Host, query.Get("prefix"), append(append([]string{}, tags...), query["tag"]...))
+		if err != nil {
+			return nil, err
+		}
+		return sink, nil
+	default:
+		return nil, fmt.Errorf("unknown output %q (supported: %s)", name, strings.Join(OutputSchemes, ", "))
+	}
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"sort"
+
+	"github.com/alexandredias/gotsunami/internal/protocols"
+)
+
+// stageStats holds the requests started during one stage of the load pattern
+type stageStats struct {
+	requests  int64
+	failed    int64
+	histogram *Histogram
+}
+
+// StageSummary reports the requests started during one stage of the load
+// pattern, so latency reads directly against load along the test. Name,
+// Start, Duration and Intensity describe the stage when the pattern is known,
+// and TargetRPS the iteration rate it ramps to when iterations start at a
+// rate.
+type StageSummary struct {
+	Stage             int                `json:"stage"`
+	Name              string             `json:"name,omitempty"`
+	Start             string             `json:"start,omitempty"`
+	Duration          string             `json:"duration,omitempty"`
+	Intensity         float64            `json:"intensity,omitempty"`
+	TargetRPS         float64            `json:"target_rps,omitempty"`
+	Requests          int64              `json:"requests"`
+	Failed            int64              `json:"failed"`
+	SuccessRate       float64            `json:"success_rate"`
+	RequestsPerSecond float64            `json:"requests_per_second,omitempty"`
+	Latency           *LatencyStats      `json:"latency"`
+	Histogram         *HistogramSnapshot `json:"histogram,omitempty"`
+}
+
+// RecordStage adds a response, already recorded with RecordResult, to the
+// breakdown of the stage its request started in
+func (c *Collector) RecordStage(stage int, resp *protocols.Response, passed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stageStats(stage)
+	stats.requests++
+	if !passed {
+		stats.failed++
+	}
+	stats.histogram.Record(resp.ResponseTime)
+}
+
+// stageStats returns the stats of stage, creating them if needed. The caller
+// must hold the write lock.
+func (c *Collector) stageStats(stage int) *stageStats {
+	stats, exists := c.stages[stage]
+	if !exists {
+		stats = &stageStats{histogram: NewHistogram(c.precision)}
+		c.stages[stage] = stats
+	}
+	return stats
+}
+
+// mergeStage adds the stats of another collector's stage. The caller must
+// hold the write lock.
+func (c *Collector) mergeStage(stage int, other *stageStats) {
+	stats := c.stageStats(stage)
+	stats.requests += other.requests
+	stats.failed += other.failed
+	stats.histogram.Merge(other.histogram)
+}
+
+// stageSummaries summarizes every stage in order, or returns nil when no
+// stage was recorded. The caller must hold the read lock.
+func (c *Collector) stageSummaries() []*StageSummary {
+	if len(c.stages) == 0 {
+		return nil
+	}
+
+	summaries := make([]*StageSummary, 0, len(c.stages))
+	for stage, stats := range c.stages {
+		summary := &StageSummary{Stage: stage, Requests: stats.requests, Failed: stats.failed}
+		if stats.requests > 0 {
+			summary.SuccessRate = float64(stats.requests-stats.failed) / float64(stats.requests) * 100
+		}
+		if stats.histogram.Count() > 0 {
+			summary.Latency = HistogramLatencyStats(stats.histogram)
+			summary.Histogram = stats.histogram.Snapshot()
+		}
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Stage < summaries[j].Stage })
+	return summaries
+}
@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// statsdPacketSize keeps StatsD datagrams within the usual MTU
+	statsdPacketSize = 1432
+	// statsdFlushInterval bounds how long metrics wait in a partial packet
+	statsdFlushInterval = time.Second
+	// DefaultStatsDPrefix is the prefix of StatsD metric names
+	DefaultStatsDPrefix = "gotsunami"
+)
+
+// StatsDSink sends a timing and counters per request to a StatsD server
+// over UDP, with tags in the DogStatsD format understood by the Datadog
+// agent, Telegraf and statsd_exporter. Metrics are batched into packets;
+// UDP never blocks on a slow or missing server, which just loses them.
+type StatsDSink struct {
+	conn   net.Conn
+	prefix string
+	tags   string
+
+	mu     sync.Mutex
+	buffer []byte
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewStatsDSink creates a sink sending to the StatsD server at addr, naming
+// metrics <prefix>.<metric> and tagging them with tags (key:value)
+func NewStatsDSink(addr, prefix string, tags []string) (*StatsDSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to StatsD at %s: %w", addr, err)
+	}
+	if prefix == "" {
+		prefix = DefaultStatsDPrefix
+	}
+
+	sanitized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag = statsdTag(tag); tag != "" {
+			sanitized = append(sanitized, tag)
+		}
+	}
+
+	s := &StatsDSink{
+		conn:   conn,
+		prefix: strings.TrimSuffix(prefix, "."),
+		tags:   strings.Join(sanitized, ","),
+		buffer: make([]byte, 0, statsdPacketSize),
+		done:   make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.flushPeriodically()
+	return s, nil
+}
+
+// Write sends the metrics of a request: <prefix>.request.duration (ms),
+// <prefix>.requests, <prefix>.bytes and, for errors and error statuses,
+// <prefix>.errors, tagged with the status, method and endpoint
+func (s *StatsDSink) Write(result RawResult) error {
+	status := "error"
+	if result.Status > 0 {
+		status = strconv.Itoa(result.Status)
+	}
+	tags := s.tags
+	for _, tag := range []string{"status:" + status, "method:" + result.Method, "endpoint:" + result.Endpoint, "tenant:" + result.Tenant} {
+		if strings.HasSuffix(tag, ":") {
+			continue
+		}
+		if tags != "" {
+			tags += ","
+		}
+		tags += statsdTag(tag)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.add("request.duration", strconv.FormatFloat(result.LatencyMs, 'f', 3, 64), "ms", tags); err != nil {
+		return err
+	}
+	if err := s.add("requests", "1", "c", tags); err != nil {
+		return err
+	}
+	if result.Bytes > 0 {
+		if err := s.add("bytes", strconv.FormatInt(result.Bytes, 10), "c", tags); err != nil {
+			return err
+		}
+	}
+	if result.Error != "" || result.Status >= 400 {
+		return s.add("errors", "1", "c", tags)
+	}
+	return nil
+}
+
+// add appends a metric line to the packet, sending the packet first when the
+// line does not fit. The caller holds the lock.
+func (s *StatsDSink) add(name, value, kind, tags string) error {
+	line := s.prefix + "." + name + ":" + value + "|" + kind
+	if tags != "" {
+		line += "|#" + tags
+	}
+
+	var err error
+	if len(s.buffer) > 0 && len(s.buffer)+1+len(line) > statsdPacketSize {
+		err = s.flush()
+	}
+	if len(s.buffer) > 0 {
+		s.buffer = append(s.buffer, '\n')
+	}
+	s.buffer = append(s.buffer, line...)
+	return err
+}
+
+// flush sends the pending packet. The caller holds the lock.
+func (s *StatsDSink) flush() error {
+	if len(s.buffer) == 0 {
+		return nil
+	}
+	_, err := s.conn.Write(s.buffer)
+	s.buffer = s.buffer[:0]
+	return err
+}
+
+// flushPeriodically sends partial packets so quiet tests still report
+func (s *StatsDSink) flushPeriodically() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(statsdFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.flush()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Close sends the pending metrics and closes the connection
+func (s *StatsDSink) Close() error {
+	close(s.done)
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.flush()
+	if closeErr := s.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// statsdTag replaces the characters that delimit StatsD lines and tags
+func statsdTag(tag string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '|', ',', '#', '\n', '\r':
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(tag))
+}
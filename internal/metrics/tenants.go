@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"github.com/alexandredias/gotsunami/internal/protocols"
+)
+
+// MaxTenants bounds the tenants reported separately; requests of further
+// tenants are grouped under OtherTenants so a huge feed cannot exhaust memory
+const MaxTenants = 1000
+
+// OtherTenants groups the tenants seen after MaxTenants
+const OtherTenants = "(other)"
+
+// tenantStats holds the requests recorded for one tenant
+type tenantStats struct {
+	requests        int64
+	failed          int64
+	transportErrors int64
+	httpErrors      int64
+	histogram       *Histogram
+}
+
+// TenantSummary reports the requests made on behalf of one tenant, so a
+// noisy neighbor shows up as tenants whose latency or errors diverge
+type TenantSummary struct {
+	Requests        int64              `json:"requests"`
+	Failed          int64              `json:"failed"`
+	TransportErrors int64              `json:"transport_errors"`
+	HTTPErrors      int64              `json:"http_errors"`
+	SuccessRate     float64            `json:"success_rate"`
+	Latency         *LatencyStats      `json:"latency"`
+	Histogram       *HistogramSnapshot `json:"histogram,omitempty"`
+}
+
+// RecordTenant adds a response, already recorded with RecordResult, to the
+// breakdown of tenant
+func (c *Collector) RecordTenant(tenant string, resp *protocols.Response, passed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.tenantStats(tenant)
+	stats.requests++
+	if !passed {
+		stats.failed++
+	}
+	switch {
+	case resp.TransportError():
+		stats.transportErrors++
+	case resp.HTTPError():
+		stats.httpErrors++
+	}
+	stats.histogram.Record(resp.ResponseTime)
+}
+
+// tenantStats returns the stats of tenant, creating them if needed. The
+// caller must hold the write lock.
+func (c *Collector) tenantStats(tenant string) *tenantStats {
+	stats, exists := c.tenants[tenant]
+	if exists {
+		return stats
+	}
+	if len(c.tenants) >= MaxTenants {
+		if stats, exists := c.tenants[OtherTenants]; exists {
+			return stats
+		}
+		tenant = OtherTenants
+	}
+
+	stats = &tenantStats{histogram: NewHistogram(c.precision)}
+	c.tenants[tenant] = stats
+	return stats
+}
+
+// mergeTenant adds the stats of another collector's tenant. The caller must
+// hold the write lock.
+func (c *Collector) mergeTenant(tenant string, other *tenantStats) {
+	stats := c.tenantStats(tenant)
+	stats.requests += other.requests
+	stats.failed += other.failed
+	stats.transportErrors += other.transportErrors
+	stats.httpErrors += other.httpErrors
+	stats.histogram.Merge(other.histogram)
+}
+
+// tenantSummaries summarizes every tenant, or returns nil when requests were
+// not tagged. The caller must hold the read lock.
+func (c *Collector) tenantSummaries() map[string]*TenantSummary {
+	if len(c.tenants) == 0 {
+		return nil
+	}
+
+	summaries := make(map[string]*TenantSummary, len(c.tenants))
+	for tenant, stats := range c.tenants {
+		summary := &TenantSummary{
+			Requests:        stats.requests,
+			Failed:          stats.failed,
+			TransportErrors: stats.transportErrors,
+			HTTPErrors:      stats.httpErrors,
+		}
+		if stats.requests > 0 {
+			summary.SuccessRate = float64(stats.requests-stats.failed) / float64(stats.requests) * 100
+		}
+		if stats.histogram.Count() > 0 {
+			summary.Latency = HistogramLatencyStats(stats.histogram)
+			summary.Histogram = stats.histogram.Snapshot()
+		}
+		summaries[tenant] = summary
+	}
+
+	return summaries
+}
@@ -0,0 +1,209 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Latency distributions
+const (
+	// LatencyFixed waits mean on every request (the default)
+	LatencyFixed = "fixed"
+	// LatencyUniform waits between min and max
+	LatencyUniform = "uniform"
+	// LatencyNormal waits around mean with stddev, at least min
+	LatencyNormal = "normal"
+	// LatencyExponential waits a long-tailed delay averaging mean
+	LatencyExponential = "exponential"
+)
+
+// Config declares the endpoints served by the mock server
+type Config struct {
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+// Endpoint is a route of the mock server. Requests are served by the first
+// endpoint whose method and path match.
+type Endpoint struct {
+	// Method matches any method when empty
+	Method string `json:"method,omitempty"`
+	// Path matches exactly, or as a prefix when it ends with *
+	Path    string            `json:"path"`
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Body is sent as is when it is a string and as JSON otherwise
+	Body interface{} `json:"body,omitempty"`
+	// Echo answers with the request as JSON instead of Body
+	Echo    bool           `json:"echo,omitempty"`
+	Latency *LatencyConfig `json:"latency,omitempty"`
+	Errors  []ErrorConfig  `json:"errors,omitempty"`
+}
+
+// LatencyConfig sets the delay added before each response
+type LatencyConfig struct {
+	Distribution string `json:"distribution,omitempty"`
+	Mean         string `json:"mean,omitempty"`
+	StdDev       string `json:"stddev,omitempty"`
+	Min          string `json:"min,omitempty"`
+	Max          string `json:"max,omitempty"`
+}
+
+// ErrorConfig makes a share of the requests fail. Rate is a probability
+// between 0 and 1; status 0 closes the connection without a response.
+type ErrorConfig struct {
+	Rate   float64 `json:"rate"`
+	Status int     `json:"status"`
+	Body   string  `json:"body,omitempty"`
+}
+
+// LoadConfig reads a mock server configuration from a JSON file
+func LoadConfig(filename string) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mock config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse mock config JSON: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// EchoConfig serves every path by echoing the request back
+func EchoConfig(latency *LatencyConfig, errors []ErrorConfig) *Config {
+	return &Config{Endpoints: []Endpoint{{Path: "/*", Echo: true, Latency: latency, Errors: errors}}}
+}
+
+// Validate validates the configuration
+func (c *Config) Validate() error {
+	if len(c.Endpoints) == 0 {
+		return fmt.Errorf("at least one endpoint is required")
+	}
+
+	for i, endpoint := range c.Endpoints {
+		if err := endpoint.validate(); err != nil {
+			return fmt.Errorf("endpoint %d (%s): %w", i+1, endpoint.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// validate validates an endpoint
+func (e *Endpoint) validate() error {
+	if !strings.HasPrefix(e.Path, "/") {
+		return fmt.Errorf("path must start with /")
+	}
+	if e.Status != 0 && (e.Status < 100 || e.Status > 599) {
+		return fmt.Errorf("invalid status: %d", e.Status)
+	}
+	if e.Latency != nil {
+		if _, err := e.Latency.sampler(); err != nil {
+			return fmt.Errorf("latency: %w", err)
+		}
+	}
+
+	total := 0.0
+	for _, errorConfig := range e.Errors {
+		if errorConfig.Rate < 0 || errorConfig.Rate > 1 {
+			return fmt.Errorf("error rate must be between 0 and 1")
+		}
+		if errorConfig.Status != 0 && (errorConfig.Status < 100 || errorConfig.Status > 599) {
+			return fmt.Errorf("invalid error status: %d", errorConfig.Status)
+		}
+		total += errorConfig.Rate
+	}
+	if total > 1 {
+		return fmt.Errorf("error rates add up to more than 1")
+	}
+
+	return nil
+}
+
+// matches reports whether the endpoint serves a request
+func (e *Endpoint) matches(r *http.Request) bool {
+	if e.Method != "" && !strings.EqualFold(e.Method, r.Method) {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(e.Path, "*"); ok {
+		return strings.HasPrefix(r.URL.Path, prefix)
+	}
+	return r.URL.Path == e.Path
+}
+
+// pickError returns the error a request should fail with, if any
+func (e *Endpoint) pickError(rng *rand.Rand) *ErrorConfig {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	roll := rng.Float64()
+	for i := range e.Errors {
+		if roll < e.Errors[i].Rate {
+			return &e.Errors[i]
+		}
+		roll -= e.Errors[i].Rate
+	}
+	return nil
+}
+
+// sampler returns a function drawing delays from the distribution
+func (l *LatencyConfig) sampler() (func(rng *rand.Rand) time.Duration, error) {
+	durations := map[string]time.Duration{}
+	for name, value := range map[string]string{"mean": l.Mean, "stddev": l.StdDev, "min": l.Min, "max": l.Max} {
+		if value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < 0 {
+			return nil, fmt.Errorf("invalid %s: %s", name, value)
+		}
+		durations[name] = duration
+	}
+	mean, stddev, min, max := durations["mean"], durations["stddev"], durations["min"], durations["max"]
+	if l.Max != "" && max < min {
+		return nil, fmt.Errorf("max must not be below min")
+	}
+
+	// clamp keeps a delay between min and max, when max is set
+	clamp := func(delay time.Duration) time.Duration {
+		if delay < min {
+			delay = min
+		}
+		if l.Max != "" && delay > max {
+			delay = max
+		}
+		return delay
+	}
+
+	switch l.Distribution {
+	case "", LatencyFixed:
+		return func(*rand.Rand) time.Duration { return clamp(mean) }, nil
+	case LatencyUniform:
+		if l.Max == "" {
+			return nil, fmt.Errorf("uniform latency requires max")
+		}
+		return func(rng *rand.Rand) time.Duration {
+			return min + time.Duration(rng.Int63n(int64(max-min)+1))
+		}, nil
+	case LatencyNormal:
+		return func(rng *rand.Rand) time.Duration {
+			return clamp(mean + time.Duration(rng.NormFloat64()*float64(stddev)))
+		}, nil
+	case LatencyExponential:
+		return func(rng *rand.Rand) time.Duration {
+			return clamp(time.Duration(math.Round(rng.ExpFloat64() * float64(mean))))
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown distribution: %s (use %s, %s, %s or %s)",
+			l.Distribution, LatencyFixed, LatencyUniform, LatencyNormal, LatencyExponential)
+	}
+}
@@ -0,0 +1,195 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// route is an endpoint ready to serve requests
+type route struct {
+	endpoint *Endpoint
+	latency  func(rng *rand.Rand) time.Duration
+	body     []byte
+}
+
+// Server serves the endpoints of a mock configuration, so scenarios and load
+// patterns can be tried locally without a real API
+type Server struct {
+	addr       string
+	httpServer *http.Server
+	routes     []route
+
+	rngMu sync.Mutex
+	rng   *rand.Rand
+}
+
+// echo is the response of an echo endpoint
+type echo struct {
+	Method  string              `json:"method"`
+	Path    string              `json:"path"`
+	Query   map[string][]string `json:"query,omitempty"`
+	Headers map[string]string   `json:"headers"`
+	Body    string              `json:"body,omitempty"`
+}
+
+// NewServer creates a mock server listening on addr
+func NewServer(addr string, cfg *Config) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid mock config: %w", err)
+	}
+
+	s := &Server{
+		addr: addr,
+		rng:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for i := range cfg.Endpoints {
+		endpoint := &cfg.Endpoints[i]
+		r := route{endpoint: endpoint}
+		if endpoint.Latency != nil {
+			r.latency, _ = endpoint.Latency.sampler()
+		}
+		switch body := endpoint.Body.(type) {
+		case nil:
+		case string:
+			r.body = []byte(body)
+		default:
+			data, err := json.Marshal(body)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode body of %s: %w", endpoint.Path, err)
+			}
+			r.body = data
+		}
+		s.routes = append(s.routes, r)
+	}
+
+	s.httpServer = &http.Server{
+		Addr:              addr,
+		Handler:           http.HandlerFunc(s.serve),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s, nil
+}
+
+// Handler returns the HTTP handler serving the endpoints
+func (s *Server) Handler() http.Handler {
+	return s.httpServer.Handler
+}
+
+// ListenAndServe starts serving until Shutdown is called
+func (s *Server) ListenAndServe() error {
+	logrus.Infof("GoTsunami mock server listening on %s", s.addr)
+	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("mock server failed: %w", err)
+	}
+	return nil
+}
+
+// Shutdown gracefully shuts down the HTTP server
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
+
+// serve answers a request with the first matching endpoint
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	var matched *route
+	for i := range s.routes {
+		if s.routes[i].endpoint.matches(r) {
+			matched = &s.routes[i]
+			break
+		}
+	}
+	if matched == nil {
+		http.NotFound(w, r)
+		return
+	}
+	endpoint := matched.endpoint
+
+	var delay time.Duration
+	var failure *ErrorConfig
+	s.rngMu.Lock()
+	if matched.latency != nil {
+		delay = matched.latency(s.rng)
+	}
+	failure = endpoint.pickError(s.rng)
+	s.rngMu.Unlock()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		}
+	}
+
+	if failure != nil {
+		s.fail(w, failure)
+		return
+	}
+
+	for name, value := range endpoint.Headers {
+		w.Header().Set(name, value)
+	}
+	status := endpoint.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if endpoint.Echo {
+		s.echo(w, r, status)
+		return
+	}
+	w.WriteHeader(status)
+	w.Write(matched.body)
+}
+
+// fail answers with an injected error, or drops the connection for status 0
+func (s *Server) fail(w http.ResponseWriter, failure *ErrorConfig) {
+	if failure.Status == 0 {
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			panic(http.ErrAbortHandler)
+		}
+		conn, _, err := hijacker.Hijack()
+		if err == nil {
+			conn.Close()
+		}
+		return
+	}
+
+	w.WriteHeader(failure.Status)
+	io.WriteString(w, failure.Body)
+}
+
+// echo answers with the request as JSON
+func (s *Server) echo(w http.ResponseWriter, r *http.Request, status int) {
+	body, _ := io.ReadAll(r.Body)
+	response := echo{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Headers: make(map[string]string, len(r.Header)),
+		Body:    string(body),
+	}
+	if query := r.URL.Query(); len(query) > 0 {
+		response.Query = query
+	}
+	for name := range r.Header {
+		response.Headers[name] = r.Header.Get(name)
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
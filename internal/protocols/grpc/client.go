@@ -0,0 +1,399 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Protocol is the name scenarios select gRPC with
+const Protocol = "grpc"
+
+func init() {
+	protocols.Register(Protocol, func(config map[string]interface{}) (protocols.Protocol, error) {
+		return NewClient(config)
+	})
+}
+
+// descriptorResolver finds the descriptors of proto files by full name
+type descriptorResolver interface {
+	FindDescriptorByName(protoreflect.FullName) (protoreflect.Descriptor, error)
+}
+
+// Client implements the Protocol interface for gRPC unary calls. Requests
+// are sent to URLs such as grpc://host:port/pkg.Service/Method, grpcs:// for
+// TLS, with a JSON body in the protobuf JSON mapping and headers as metadata.
+type Client struct {
+	config *Config
+	// files resolves the methods when proto files describe them
+	files descriptorResolver
+
+	mu      sync.RWMutex
+	servers map[string]*server
+
+	requests        int64
+	failed          int64
+	transportErrors int64
+}
+
+// server holds the connections to one server and the methods resolved there
+type server struct {
+	conns []*grpc.ClientConn
+	next  uint64
+
+	mu      sync.Mutex
+	methods map[string]protoreflect.MethodDescriptor
+}
+
+// NewClient creates a gRPC client from the protocol_config of a scenario,
+// compiling its proto files if any; connections are opened on first use
+func NewClient(config map[string]interface{}) (*Client, error) {
+	parsed, err := ParseConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{config: parsed, servers: make(map[string]*server)}
+	if !parsed.Reflection() {
+		client.files, err = compileProtoFiles(parsed.ProtoFiles, parsed.ImportPaths)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// Name returns the protocol name
+func (c *Client) Name() string {
+	return "gRPC"
+}
+
+// Version returns the version of grpc-go in use
+func (c *Client) Version() string {
+	return grpc.Version
+}
+
+// Execute performs a unary call. Calls the server answered with a status
+// other than OK get the HTTP status closest to it, see httpStatus; calls
+// that got no answer, such as refused connections, are transport errors.
+func (c *Client) Execute(ctx context.Context, req *protocols.Request) (*protocols.Response, error) {
+	start := time.Now()
+	resp := c.execute(ctx, req)
+	resp.ResponseTime = time.Since(start)
+
+	atomic.AddInt64(&c.requests, 1)
+	if resp.Failed() {
+		atomic.AddInt64(&c.failed, 1)
+	}
+	if resp.TransportError() {
+		atomic.AddInt64(&c.transportErrors, 1)
+	}
+	return resp, nil
+}
+
+// execute makes the call and converts its outcome into a protocol response
+func (c *Client) execute(ctx context.Context, req *protocols.Request) *protocols.Response {
+	conn, method, err := c.resolve(ctx, req.URL)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	input := dynamicpb.NewMessage(method.Input())
+	if len(req.Body) > 0 {
+		if err := protojson.Unmarshal(req.Body, input); err != nil {
+			return errorResponse(fmt.Errorf("invalid %s message: %w", method.Input().FullName(), err))
+		}
+	}
+
+	md := metadata.MD{}
+	for key, value := range req.Headers {
+		// The content type is gRPC's own; the body is JSON only here
+		if !strings.EqualFold(key, "Content-Type") {
+			md.Append(key, value)
+		}
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.Timeout)
+		defer cancel()
+	}
+
+	var answered int32
+	ctx = context.WithValue(ctx, answeredKey{}, &answered)
+
+	output := dynamicpb.NewMessage(method.Output())
+	var header, trailer metadata.MD
+	err = conn.Invoke(ctx, MethodPath(method), input, output, grpc.Header(&header), grpc.Trailer(&trailer))
+
+	st, isStatus := status.FromError(err)
+	if err != nil && (!isStatus || atomic.LoadInt32(&answered) == 0) {
+		return errorResponse(err)
+	}
+
+	resp := &protocols.Response{
+		StatusCode: httpStatus(st.Code()),
+		Headers:    make(map[string]string, len(header)+len(trailer)+2),
+		Body:       []byte{},
+	}
+	for _, md := range []metadata.MD{header, trailer} {
+		for key, values := range md {
+			if len(values) > 0 {
+				resp.Headers[key] = values[0]
+			}
+		}
+	}
+	resp.Headers["grpc-status"] = strconv.Itoa(int(st.Code()))
+	if st.Message() != "" {
+		resp.Headers["grpc-message"] = st.Message()
+	}
+
+	if err == nil {
+		body, err := protojson.Marshal(output)
+		if err != nil {
+			return errorResponse(fmt.Errorf("failed to encode %s message: %w", method.Output().FullName(), err))
+		}
+		resp.Body = body
+	}
+	resp.ContentLength = int64(len(resp.Body))
+
+	return resp
+}
+
+// resolve returns a connection to the server of a call URL and the method
+// it calls
+func (c *Client) resolve(ctx context.Context, rawURL string) (*grpc.ClientConn, protoreflect.MethodDescriptor, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid gRPC URL: %w", err)
+	}
+	if target.Scheme != "grpc" && target.Scheme != "grpcs" {
+		return nil, nil, fmt.Errorf("invalid gRPC URL %s: use grpc://host:port or grpcs://host:port", rawURL)
+	}
+	path := target.Path
+	if service, name, found := strings.Cut(strings.TrimPrefix(path, "/"), "/"); !found || service == "" || name == "" || strings.Contains(name, "/") {
+		return nil, nil, fmt.Errorf("invalid gRPC method %s: expected /package.Service/Method", path)
+	}
+
+	srv, err := c.server(target.Scheme, target.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+	method, err := srv.method(ctx, path, c.files)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	next := atomic.AddUint64(&srv.next, 1)
+	return srv.conns[next%uint64(len(srv.conns))], method, nil
+}
+
+// server returns the connections to a server, opening them on first use
+func (c *Client) server(scheme, address string) (*server, error) {
+	key := scheme + "://" + address
+
+	c.mu.RLock()
+	srv := c.servers[key]
+	c.mu.RUnlock()
+	if srv != nil {
+		return srv, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if srv := c.servers[key]; srv != nil {
+		return srv, nil
+	}
+
+	dialConfig := DialConfig{Plaintext: scheme == "grpc", TLSSkipVerify: c.config.TLSSkipVerify}
+	srv = &server{methods: make(map[string]protoreflect.MethodDescriptor)}
+	for i := 0; i < c.config.Connections; i++ {
+		conn, err := Dial(address, dialConfig, grpc.WithStatsHandler(answerHandler{}))
+		if err != nil {
+			srv.close()
+			return nil, err
+		}
+		srv.conns = append(srv.conns, conn)
+	}
+	c.servers[key] = srv
+	return srv, nil
+}
+
+// method returns the descriptor of the method on path, from the proto
+// files or, when files is nil, from the server reflection of the server
+func (s *server) method(ctx context.Context, path string, files descriptorResolver) (protoreflect.MethodDescriptor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if method, exists := s.methods[path]; exists {
+		return method, nil
+	}
+
+	if files != nil {
+		name := protoreflect.FullName(strings.Replace(strings.TrimPrefix(path, "/"), "/", ".", 1))
+		descriptor, err := files.FindDescriptorByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("method %s not found in the proto files: %w", name, err)
+		}
+		method, ok := descriptor.(protoreflect.MethodDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a method", name)
+		}
+		s.methods[path] = method
+		return method, nil
+	}
+
+	// Reflection describes every service at once; calls wait for it once
+	services, err := Describe(ctx, s.conns[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, service := range services {
+		methods := service.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			s.methods[MethodPath(methods.Get(i))] = methods.Get(i)
+		}
+	}
+
+	method, exists := s.methods[path]
+	if !exists {
+		return nil, fmt.Errorf("method %s not found through server reflection", path)
+	}
+	return method, nil
+}
+
+// close closes the connections to the server
+func (s *server) close() error {
+	var firstErr error
+	for _, conn := range s.conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ValidateConfig validates protocol-specific configuration
+func (c *Client) ValidateConfig(config map[string]interface{}) error {
+	_, err := ParseConfig(config)
+	return err
+}
+
+// GetMetrics returns gRPC-specific metrics
+func (c *Client) GetMetrics() map[string]interface{} {
+	c.mu.RLock()
+	connections := 0
+	for _, srv := range c.servers {
+		connections += len(srv.conns)
+	}
+	c.mu.RUnlock()
+
+	requests := atomic.LoadInt64(&c.requests)
+	failed := atomic.LoadInt64(&c.failed)
+	return map[string]interface{}{
+		"total_requests":      requests,
+		"successful_requests": requests - failed,
+		"failed_requests":     failed,
+		"transport_errors":    atomic.LoadInt64(&c.transportErrors),
+		"connections":         connections,
+	}
+}
+
+// Close closes the connections to every server
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for key, srv := range c.servers {
+		if err := srv.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(c.servers, key)
+	}
+	return firstErr
+}
+
+// errorResponse creates the response of a call that got no answer
+func errorResponse(err error) *protocols.Response {
+	return &protocols.Response{
+		Headers: make(map[string]string),
+		Body:    []byte{},
+		Error:   err,
+	}
+}
+
+// httpStatus maps a gRPC status code to the HTTP status closest to it, as
+// the gRPC-HTTP gateways do, so status validation and reports treat both
+// protocols alike
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// answeredKey marks the calls whose answer answerHandler watches for
+type answeredKey struct{}
+
+// answerHandler flags the calls the server answered, with headers or just
+// trailers, telling a status the server returned from one gRPC made up
+// after the call failed on the way
+type answerHandler struct{}
+
+func (answerHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (answerHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	switch s.(type) {
+	case *stats.InHeader, *stats.InTrailer:
+		if answered, ok := ctx.Value(answeredKey{}).(*int32); ok {
+			atomic.StoreInt32(answered, 1)
+		}
+	}
+}
+
+func (answerHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (answerHandler) HandleConn(context.Context, stats.ConnStats) {}
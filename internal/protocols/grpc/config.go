@@ -0,0 +1,124 @@
+package grpc
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Config holds the gRPC settings of a scenario, read from its
+// protocol_config
+type Config struct {
+	// ProtoFiles describe the services called; without them, the
+	// descriptors come from server reflection
+	ProtoFiles []string
+	// ImportPaths are searched for the proto files and their imports
+	ImportPaths []string
+	// TLSSkipVerify accepts any server certificate
+	TLSSkipVerify bool
+	// Connections is how many connections are opened to each server
+	Connections int
+}
+
+// Reflection reports whether the descriptors come from server reflection
+func (c *Config) Reflection() bool {
+	return len(c.ProtoFiles) == 0
+}
+
+// ParseConfig reads the protocol_config of a gRPC scenario:
+//
+//	proto            proto file, or list of files, describing the services
+//	import_paths     directories searched for the proto files and imports
+//	reflection       true to describe the services through server reflection
+//	tls_skip_verify  accept any server certificate
+//	connections      connections opened to each server, 1 by default
+func ParseConfig(config map[string]interface{}) (*Config, error) {
+	parsed := &Config{Connections: 1}
+	reflection, reflectionSet := false, false
+
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := config[key]
+		var err error
+		switch key {
+		case "proto":
+			parsed.ProtoFiles, err = stringList(value)
+		case "import_paths":
+			parsed.ImportPaths, err = stringList(value)
+		case "reflection":
+			reflectionSet = true
+			reflection, err = boolValue(value)
+		case "tls_skip_verify":
+			parsed.TLSSkipVerify, err = boolValue(value)
+		case "connections":
+			parsed.Connections, err = intValue(value)
+			if err == nil && parsed.Connections < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		default:
+			return nil, fmt.Errorf("unknown gRPC setting %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid gRPC setting %s: %w", key, err)
+		}
+	}
+
+	switch {
+	case reflection && !parsed.Reflection():
+		return nil, fmt.Errorf("gRPC services are described by proto files or server reflection, not both")
+	case reflectionSet && !reflection && parsed.Reflection():
+		return nil, fmt.Errorf("gRPC services must be described by proto files when reflection is disabled")
+	}
+
+	return parsed, nil
+}
+
+// stringList reads a string or a list of strings
+func stringList(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		list := make([]string, len(v))
+		for i, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected strings, got %v", item)
+			}
+			list[i] = str
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("expected a string or a list of strings, got %v", value)
+	}
+}
+
+// boolValue reads a boolean
+func boolValue(value interface{}) (bool, error) {
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected true or false, got %v", value)
+	}
+	return b, nil
+}
+
+// intValue reads a whole number, decoded from JSON or YAML
+func intValue(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("expected a whole number, got %v", value)
+}
@@ -0,0 +1,20 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// CheckHealth asks the standard health service for the status of service,
+// or of the whole server when service is empty
+func CheckHealth(ctx context.Context, conn grpc.ClientConnInterface, service string) (string, error) {
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return "", fmt.Errorf("health check failed: %w", err)
+	}
+
+	return resp.GetStatus().String(), nil
+}
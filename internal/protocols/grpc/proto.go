@@ -0,0 +1,24 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bufbuild/protocompile"
+)
+
+// compileProtoFiles parses and links proto files, found in importPaths or
+// the working directory, like protoc; the well-known types need no import
+// path
+func compileProtoFiles(files, importPaths []string) (descriptorResolver, error) {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: importPaths}),
+	}
+
+	compiled, err := compiler.Compile(context.Background(), files...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile proto files: %w", err)
+	}
+
+	return compiled.AsResolver(), nil
+}
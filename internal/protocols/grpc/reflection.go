@@ -0,0 +1,286 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Reflection is served under two names; v1alpha is still the only one
+// offered by many servers, and both use the same messages on the wire
+const (
+	reflectionMethod      = "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"
+	reflectionAlphaMethod = "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"
+)
+
+// DialConfig holds the connection settings used to reach a gRPC server
+type DialConfig struct {
+	// Plaintext disables TLS
+	Plaintext bool
+	// TLSSkipVerify accepts any server certificate
+	TLSSkipVerify bool
+}
+
+// Dial opens a client connection to target (host:port) with any further
+// options
+func Dial(target string, config DialConfig, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if !config.Plaintext {
+		creds = credentials.NewTLS(&tls.Config{InsecureSkipVerify: config.TLSSkipVerify})
+	}
+
+	conn, err := grpc.Dial(target, append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", target, err)
+	}
+
+	return conn, nil
+}
+
+// Describe lists the services exposed through server reflection, with the
+// full descriptors of their methods and messages, sorted by name. The
+// reflection services themselves are left out.
+func Describe(ctx context.Context, conn grpc.ClientConnInterface) ([]protoreflect.ServiceDescriptor, error) {
+	client, names, err := newReflectionClient(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer client.close()
+
+	for _, name := range names {
+		if err := client.loadSymbol(name); err != nil {
+			return nil, fmt.Errorf("failed to describe %s: %w", name, err)
+		}
+	}
+
+	files, err := client.registry()
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]protoreflect.ServiceDescriptor, 0, len(names))
+	for _, name := range names {
+		descriptor, err := files.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe %s: %w", name, err)
+		}
+		service, ok := descriptor.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a service", name)
+		}
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+// MethodPath returns the path a method is called on, e.g. /pkg.Service/Method
+func MethodPath(method protoreflect.MethodDescriptor) string {
+	return fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name())
+}
+
+// reflectionClient resolves descriptors over a server reflection stream
+type reflectionClient struct {
+	stream grpc.ClientStream
+	cancel context.CancelFunc
+	files  map[string]*descriptorpb.FileDescriptorProto
+}
+
+// newReflectionClient opens a reflection stream and lists the services of
+// the server, falling back to v1alpha when the server does not offer v1
+func newReflectionClient(ctx context.Context, conn grpc.ClientConnInterface) (*reflectionClient, []string, error) {
+	var lastErr error
+	for _, method := range []string{reflectionMethod, reflectionAlphaMethod} {
+		client, err := openReflection(ctx, conn, method)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Unimplemented only shows up on the first response
+		names, err := client.listServices()
+		if err == nil {
+			return client, names, nil
+		}
+		client.close()
+
+		if status.Code(err) != codes.Unimplemented {
+			return nil, nil, err
+		}
+		lastErr = err
+	}
+
+	return nil, nil, fmt.Errorf("server reflection is not enabled: %w", lastErr)
+}
+
+// openReflection opens a reflection stream on method
+func openReflection(ctx context.Context, conn grpc.ClientConnInterface, method string) (*reflectionClient, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, method)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to open reflection stream: %w", err)
+	}
+
+	return &reflectionClient{
+		stream: stream,
+		cancel: cancel,
+		files:  make(map[string]*descriptorpb.FileDescriptorProto),
+	}, nil
+}
+
+// close ends the reflection stream
+func (c *reflectionClient) close() {
+	c.stream.CloseSend()
+	c.cancel()
+}
+
+// request sends a reflection request and waits for its response
+func (c *reflectionClient) request(req *rpb.ServerReflectionRequest) (*rpb.ServerReflectionResponse, error) {
+	if err := c.stream.SendMsg(req); err != nil {
+		return nil, c.streamError(err)
+	}
+
+	resp := &rpb.ServerReflectionResponse{}
+	if err := c.stream.RecvMsg(resp); err != nil {
+		return nil, c.streamError(err)
+	}
+
+	if failure := resp.GetErrorResponse(); failure != nil {
+		return nil, status.Error(codes.Code(failure.ErrorCode), failure.ErrorMessage)
+	}
+
+	return resp, nil
+}
+
+// streamError returns the status behind a failed send, which is only
+// reported by the next receive
+func (c *reflectionClient) streamError(err error) error {
+	if errors.Is(err, io.EOF) {
+		if recvErr := c.stream.RecvMsg(&rpb.ServerReflectionResponse{}); recvErr != nil {
+			err = recvErr
+		}
+	}
+	if status.Code(err) == codes.Unimplemented {
+		return err
+	}
+	return fmt.Errorf("server reflection failed: %w", err)
+}
+
+// listServices returns the names of the services offered by the server
+func (c *reflectionClient) listServices() ([]string, error) {
+	resp, err := c.request(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, service := range resp.GetListServicesResponse().GetService() {
+		if strings.HasPrefix(service.Name, "grpc.reflection.") {
+			continue
+		}
+		names = append(names, service.Name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// loadSymbol fetches the file defining symbol and everything it imports
+func (c *reflectionClient) loadSymbol(symbol string) error {
+	resp, err := c.request(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.addFiles(resp.GetFileDescriptorResponse().GetFileDescriptorProto())
+}
+
+// loadFile fetches a file by name, falling back to the descriptors compiled
+// into this binary for well-known types the server does not serve
+func (c *reflectionClient) loadFile(name string) error {
+	resp, err := c.request(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: name},
+	})
+	if err == nil {
+		return c.addFiles(resp.GetFileDescriptorResponse().GetFileDescriptorProto())
+	}
+
+	known, findErr := protoregistry.GlobalFiles.FindFileByPath(name)
+	if findErr != nil {
+		return fmt.Errorf("failed to load %s: %w", name, err)
+	}
+	c.files[name] = protodesc.ToFileDescriptorProto(known)
+
+	return c.addDependencies(c.files[name])
+}
+
+// addFiles decodes serialized file descriptors and loads their imports
+func (c *reflectionClient) addFiles(encoded [][]byte) error {
+	var added []*descriptorpb.FileDescriptorProto
+	for _, data := range encoded {
+		file := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(data, file); err != nil {
+			return fmt.Errorf("failed to decode file descriptor: %w", err)
+		}
+		if _, exists := c.files[file.GetName()]; !exists {
+			c.files[file.GetName()] = file
+			added = append(added, file)
+		}
+	}
+
+	for _, file := range added {
+		if err := c.addDependencies(file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addDependencies loads the imports of file that are still missing
+func (c *reflectionClient) addDependencies(file *descriptorpb.FileDescriptorProto) error {
+	for _, dependency := range file.GetDependency() {
+		if _, exists := c.files[dependency]; exists {
+			continue
+		}
+		if err := c.loadFile(dependency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registry links every loaded file into a descriptor registry
+func (c *reflectionClient) registry() (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, file := range c.files {
+		set.File = append(set.File, file)
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptors from server reflection: %w", err)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,116 @@
+package grpc
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// SampleMessage returns a JSON template for message in the protobuf JSON
+// mapping: every field set to its zero value, lists and maps with a single
+// entry and only the first field of each oneof. Recursive messages are cut
+// short with an empty object.
+func SampleMessage(message protoreflect.MessageDescriptor) interface{} {
+	return sampleMessage(message, make(map[protoreflect.FullName]bool))
+}
+
+// sampleMessage builds the template of message; visiting holds the messages
+// being expanded on the current path
+func sampleMessage(message protoreflect.MessageDescriptor, visiting map[protoreflect.FullName]bool) interface{} {
+	if sample, ok := wellKnownSample(message, visiting); ok {
+		return sample
+	}
+
+	sample := make(map[string]interface{})
+	if visiting[message.FullName()] {
+		return sample
+	}
+	visiting[message.FullName()] = true
+	defer delete(visiting, message.FullName())
+
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if oneof := field.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() && oneof.Fields().Get(0) != field {
+			continue
+		}
+
+		switch {
+		case field.IsMap():
+			key := sampleScalar(field.MapKey())
+			sample[field.JSONName()] = map[string]interface{}{
+				mapKey(key): sampleField(field.MapValue(), visiting),
+			}
+		case field.IsList():
+			sample[field.JSONName()] = []interface{}{sampleField(field, visiting)}
+		default:
+			sample[field.JSONName()] = sampleField(field, visiting)
+		}
+	}
+
+	return sample
+}
+
+// sampleField returns the template of a single value of field
+func sampleField(field protoreflect.FieldDescriptor, visiting map[protoreflect.FullName]bool) interface{} {
+	if field.Kind() == protoreflect.MessageKind || field.Kind() == protoreflect.GroupKind {
+		return sampleMessage(field.Message(), visiting)
+	}
+	return sampleScalar(field)
+}
+
+// sampleScalar returns the JSON zero value of a scalar field
+func sampleScalar(field protoreflect.FieldDescriptor) interface{} {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return false
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		return ""
+	case protoreflect.EnumKind:
+		return string(field.Enum().Values().Get(0).Name())
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// 64-bit integers are strings in the JSON mapping
+		return "0"
+	default:
+		return 0
+	}
+}
+
+// mapKey renders a map key sample as a JSON object key
+func mapKey(key interface{}) string {
+	switch v := key.(type) {
+	case string:
+		return v
+	case bool:
+		return "false"
+	default:
+		return "0"
+	}
+}
+
+// wellKnownSample returns the template of well-known types that have a
+// special JSON form
+func wellKnownSample(message protoreflect.MessageDescriptor, visiting map[protoreflect.FullName]bool) (interface{}, bool) {
+	switch message.FullName() {
+	case "google.protobuf.Timestamp":
+		return "1970-01-01T00:00:00Z", true
+	case "google.protobuf.Duration":
+		return "0s", true
+	case "google.protobuf.FieldMask":
+		return "", true
+	case "google.protobuf.Struct":
+		return map[string]interface{}{}, true
+	case "google.protobuf.ListValue":
+		return []interface{}{}, true
+	case "google.protobuf.Value":
+		return nil, true
+	case "google.protobuf.Any":
+		return map[string]interface{}{"@type": ""}, true
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		// Wrappers are written as their bare value
+		return sampleField(message.Fields().ByName("value"), visiting), true
+	}
+	return nil, false
+}
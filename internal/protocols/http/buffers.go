@@ -0,0 +1,64 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"net/textproto"
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooledBuffer is the capacity above which a buffer is left to the
+// garbage collector rather than pooled, so one huge response does not pin
+// its memory for the rest of the test
+const maxPooledBuffer = 1 << 20
+
+// bodyBuffers holds the buffers response bodies are read into
+var bodyBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// readBody reads r to the end into a pooled buffer and returns a copy of
+// exactly its size. io.ReadAll would grow a new slice several times for
+// every response; here the only allocation is the body handed back.
+func readBody(r io.Reader) ([]byte, error) {
+	buf := bodyBuffers.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			buf.Reset()
+			bodyBuffers.Put(buf)
+		}
+	}()
+
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+// maxHeaderKeys is how many header names are cached. Names past it, such as
+// names expanded from a template on every request, are canonicalized each
+// time rather than growing the cache for the rest of the process.
+const maxHeaderKeys = 1024
+
+// headerKeys caches the canonical form of the header names requests use, so
+// names written in another case are canonicalized once per test, not once
+// per request; headerKeyCount is how many it holds
+var (
+	headerKeys     sync.Map
+	headerKeyCount atomic.Int64
+)
+
+// canonicalHeaderKey returns the canonical form of a header name
+func canonicalHeaderKey(name string) string {
+	if key, ok := headerKeys.Load(name); ok {
+		return key.(string)
+	}
+	key := textproto.CanonicalMIMEHeaderKey(name)
+	if headerKeyCount.Load() < maxHeaderKeys {
+		if _, loaded := headerKeys.LoadOrStore(name, key); !loaded {
+			headerKeyCount.Add(1)
+		}
+	}
+	return key
+}
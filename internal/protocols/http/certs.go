@@ -0,0 +1,57 @@
+package http
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// certificateExtensions are the extensions a certificate may have, in the
+// order they are looked for next to its key
+var certificateExtensions = []string{".crt", ".pem"}
+
+// LoadClientCertificates loads the client certificates of a directory: every
+// <name>.key with its certificate in <name>.crt or <name>.pem, in order of
+// name so the same VU presents the same identity on every run
+func LoadClientCertificates(dir string) ([]tls.Certificate, error) {
+	keys, err := filepath.Glob(filepath.Join(dir, "*.key"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	certificates := make([]tls.Certificate, 0, len(keys))
+	for _, key := range keys {
+		base := strings.TrimSuffix(key, ".key")
+		cert := ""
+		for _, ext := range certificateExtensions {
+			if _, err := os.Stat(base + ext); err == nil {
+				cert = base + ext
+				break
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+		if cert == "" {
+			return nil, fmt.Errorf("client key %s has no certificate (%s.crt or %s.pem)", key, base, base)
+		}
+
+		certificate, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate %s: %w", cert, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	if len(certificates) == 0 {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("failed to read client certificates: %w", err)
+		}
+		return nil, fmt.Errorf("no client certificates in %s (expected <name>.key with <name>.crt or <name>.pem)", dir)
+	}
+	return certificates, nil
+}
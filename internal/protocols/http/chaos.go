@@ -0,0 +1,127 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Errors returned for injected faults
+var (
+	ErrChaosDropped   = errors.New("chaos: connection dropped")
+	ErrChaosTruncated = errors.New("chaos: send truncated")
+)
+
+// ChaosConfig configures client-side fault injection. Rates are
+// probabilities between 0 and 1 evaluated per read or write.
+type ChaosConfig struct {
+	Latency      time.Duration // maximum extra latency added to a write
+	LatencyRate  float64
+	DropRate     float64
+	TruncateRate float64
+	Seed         int64 // seeds the per-connection random sources
+}
+
+// Enabled reports whether any fault is configured
+func (c *ChaosConfig) Enabled() bool {
+	return c != nil && ((c.Latency > 0 && c.LatencyRate > 0) || c.DropRate > 0 || c.TruncateRate > 0)
+}
+
+// dialFunc dials a network connection
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// chaos injects faults into the connections dialed by the HTTP transport
+type chaos struct {
+	config *ChaosConfig
+	dial   dialFunc
+
+	connections int64
+	delayed     int64
+	dropped     int64
+	truncated   int64
+}
+
+// dialContext dials a connection wrapped with fault injection
+func (c *chaos) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := c.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	// Reads and writes happen on different goroutines, so each direction
+	// gets its own source
+	seed := c.config.Seed + atomic.AddInt64(&c.connections, 1)*2
+	return &chaosConn{
+		Conn:      conn,
+		chaos:     c,
+		readRand:  rand.New(rand.NewSource(seed)),
+		writeRand: rand.New(rand.NewSource(seed + 1)),
+	}, nil
+}
+
+// metrics returns the number of faults injected so far
+func (c *chaos) metrics() map[string]int64 {
+	return map[string]int64{
+		"delayed":   atomic.LoadInt64(&c.delayed),
+		"dropped":   atomic.LoadInt64(&c.dropped),
+		"truncated": atomic.LoadInt64(&c.truncated),
+	}
+}
+
+// chaosConn is a connection that randomly delays writes, truncates sends and
+// drops mid-read
+type chaosConn struct {
+	net.Conn
+	chaos     *chaos
+	readRand  *rand.Rand
+	writeRand *rand.Rand
+	truncated atomic.Bool
+}
+
+// Write delays or truncates the write according to the configured rates
+func (c *chaosConn) Write(b []byte) (int, error) {
+	config := c.chaos.config
+
+	if config.Latency > 0 && c.writeRand.Float64() < config.LatencyRate {
+		atomic.AddInt64(&c.chaos.delayed, 1)
+		time.Sleep(time.Duration(c.writeRand.Int63n(int64(config.Latency)) + 1))
+	}
+
+	if c.truncated.Load() {
+		return 0, ErrChaosTruncated
+	}
+
+	if len(b) > 1 && c.writeRand.Float64() < config.TruncateRate {
+		atomic.AddInt64(&c.chaos.truncated, 1)
+		c.truncated.Store(true)
+
+		// Half-close so the peer sees the partial request followed by EOF
+		n, _ := c.Conn.Write(b[:len(b)/2])
+		if tcp, ok := c.Conn.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		} else {
+			c.Conn.Close()
+		}
+		return n, ErrChaosTruncated
+	}
+
+	return c.Conn.Write(b)
+}
+
+// Read drops the connection according to the configured rate
+func (c *chaosConn) Read(b []byte) (int, error) {
+	if c.readRand.Float64() < c.chaos.config.DropRate {
+		atomic.AddInt64(&c.chaos.dropped, 1)
+		c.Conn.Close()
+		return 0, ErrChaosDropped
+	}
+
+	n, err := c.Conn.Read(b)
+	if c.truncated.Load() {
+		return 0, ErrChaosTruncated
+	}
+
+	return n, err
+}
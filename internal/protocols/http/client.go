@@ -1,13 +1,16 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"fmt"
-	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alexandredias/gotsunami/internal/protocols"
@@ -19,6 +22,11 @@ type HTTPClient struct {
 	transport *http.Transport
 	config    *Config
 	metrics   *Metrics
+	chaos     *chaos
+	pipeline  *pipelineTransport
+	http2     *http2Transport
+	http3     *http3Transport
+	pool      *pool
 }
 
 // Config holds HTTP client configuration
@@ -26,32 +34,73 @@ type Config struct {
 	Timeout        time.Duration
 	KeepAlive      bool
 	MaxConnections int
-	TLSSkipVerify  bool
-	Proxy          string
-	UserAgent      string
+	// MaxConnsPerHost limits connections per host, including busy ones; 0 means no limit
+	MaxConnsPerHost int
+	TLSSkipVerify   bool
+	Proxy           string
+	UserAgent       string
+	Chaos           *ChaosConfig
+	Bandwidth       *BandwidthConfig
+	SoftStart       *SoftStartConfig
+
+	// MaxRequestsPerConn closes each connection after it carried this many
+	// requests; 0 means no limit
+	MaxRequestsPerConn int
+	// Pipeline is how many requests may be outstanding on a connection;
+	// above 1, requests are pipelined (experimental)
+	Pipeline int
+
+	// HTTPVersion is Version11 (also when empty), Version2, Version3 or
+	// VersionAuto
+	HTTPVersion string
+
+	// Decompression limits compressed response bodies; nil means no limit
+	Decompression *DecompressionConfig
+
+	// Certificates are presented to servers asking for a client
+	// certificate (mTLS)
+	Certificates []tls.Certificate
 }
 
-// Metrics holds HTTP-specific metrics
+// tlsConfig returns the TLS settings of the client's connections
+func (c *Config) tlsConfig() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: c.TLSSkipVerify,
+		Certificates:       c.Certificates,
+	}
+}
+
+// Metrics holds HTTP-specific metrics. Requests are classified with the same
+// rules as the metrics collector, see protocols.Response.Failed.
 type Metrics struct {
+	mu                 sync.Mutex
 	TotalRequests      int64
 	SuccessfulRequests int64
 	FailedRequests     int64
+	TransportErrors    int64
+	HTTPErrors         int64
 	TotalBytes         int64
 	AverageLatency     time.Duration
 	MaxLatency         time.Duration
 	MinLatency         time.Duration
+	// Versions counts the responses by the protocol version negotiated,
+	// such as HTTP/1.1 or HTTP/2.0
+	Versions map[string]int64
 }
 
 // NewHTTPClient creates a new HTTP client
 func NewHTTPClient(config *Config) *HTTPClient {
 	transport := &http.Transport{
-		MaxIdleConns:        config.MaxConnections,
-		MaxIdleConnsPerHost: config.MaxConnections / 2,
+		MaxIdleConns: config.MaxConnections,
+		// Load usually targets a single host, so the whole pool can stay
+		// idle there instead of reconnecting between requests
+		MaxIdleConnsPerHost: config.MaxConnections,
+		MaxConnsPerHost:     config.MaxConnsPerHost,
 		IdleConnTimeout:     90 * time.Second,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: config.TLSSkipVerify,
-		},
-		DisableKeepAlives: !config.KeepAlive,
+		TLSClientConfig:     config.tlsConfig(),
+		DisableKeepAlives:   !config.KeepAlive,
+		// Bodies are decompressed by the client, within its limits
+		DisableCompression: true,
 	}
 
 	// Configure proxy if provided
@@ -62,16 +111,62 @@ func NewHTTPClient(config *Config) *HTTPClient {
 		})
 	}
 
+	// Throttling and fault injection wrap the raw connection, below TLS, so
+	// they behave like the network itself
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	dial := dialFunc(dialer.DialContext)
+	if config.Bandwidth.Enabled() {
+		dial = throttleDialer(config.Bandwidth, dial)
+	}
+
+	var faults *chaos
+	if config.Chaos.Enabled() {
+		faults = &chaos{config: config.Chaos, dial: dial}
+		dial = faults.dialContext
+	}
+
+	// Count connections as the transport sees them, faults included
+	connections := &pool{softStart: config.SoftStart}
+	dial = connections.dial(dial)
+	transport.DialContext = dial
+
 	client := &http.Client{
 		Transport: transport,
 		Timeout:   config.Timeout,
 	}
 
+	// net/http cannot pipeline nor cap the requests of a connection
+	var pipeline *pipelineTransport
+	if config.MaxRequestsPerConn > 0 || config.Pipeline > 1 {
+		pipeline = newPipelineTransport(config, dial)
+		client.Transport = pipeline
+	}
+
+	// With its own TLS settings and dialer, net/http only speaks HTTP/2
+	// when asked to
+	var h2 *http2Transport
+	var h3 *http3Transport
+	switch config.HTTPVersion {
+	case VersionAuto:
+		transport.ForceAttemptHTTP2 = true
+	case Version2:
+		h2 = newHTTP2Transport(config, dial)
+		client.Transport = h2
+	case Version3:
+		h3 = newHTTP3Transport(config, connections)
+		client.Transport = h3
+	}
+
 	return &HTTPClient{
 		client:    client,
 		transport: transport,
 		config:    config,
 		metrics:   &Metrics{},
+		chaos:     faults,
+		pipeline:  pipeline,
+		http2:     h2,
+		http3:     h3,
+		pool:      connections,
 	}
 }
 
@@ -80,42 +175,70 @@ func (c *HTTPClient) Name() string {
 	return "HTTP"
 }
 
-// Version returns the protocol version
+// Version returns the protocol version the client was configured for
 func (c *HTTPClient) Version() string {
-	return "1.1"
+	if c.config.HTTPVersion == "" {
+		return Version11
+	}
+	return c.config.HTTPVersion
 }
 
 // Execute performs an HTTP request
 func (c *HTTPClient) Execute(ctx context.Context, req *protocols.Request) (*protocols.Response, error) {
-	start := time.Now()
+	resp := c.execute(ctx, req, time.Now())
+	c.updateMetrics(resp)
+
+	return resp, nil
+}
 
-	// Create HTTP request
+// execute sends the request and converts the outcome into a protocol response
+func (c *HTTPClient) execute(ctx context.Context, req *protocols.Request, start time.Time) *protocols.Response {
 	httpReq, err := c.createHTTPRequest(ctx, req)
 	if err != nil {
-		return c.createErrorResponse(err, time.Since(start)), nil
+		return c.createErrorResponse(err, time.Since(start))
 	}
 
-	// Execute request
+	ctx, use := c.pool.track(httpReq.Context())
+	httpReq = httpReq.WithContext(ctx)
+	defer use.end()
+
+	var recorder *phaseRecorder
+	if protocols.PhasesRequested(ctx) {
+		recorder = newPhaseRecorder(start)
+		ctx = withRecorder(httptrace.WithClientTrace(httpReq.Context(), recorder.trace()), recorder)
+		httpReq = httpReq.WithContext(ctx)
+	}
+
+	// Execute request; a soft start pause is not the target's latency
 	httpResp, err := c.client.Do(httpReq)
-	responseTime := time.Since(start)
+	responseTime := time.Since(start) - use.paused
 
 	if err != nil {
-		c.metrics.FailedRequests++
-		return c.createErrorResponse(err, responseTime), nil
+		resp := c.createErrorResponse(err, responseTime)
+		if recorder != nil {
+			resp.Phases = recorder.phases()
+		}
+		return resp
 	}
 	defer httpResp.Body.Close()
-
-	// Read response body
-	body, err := io.ReadAll(httpResp.Body)
-	if err != nil {
-		c.metrics.FailedRequests++
-		return c.createErrorResponse(err, responseTime), nil
+	c.countVersion(httpResp.Proto)
+
+	// A successful CONNECT turns the connection into a tunnel; there is no
+	// body to read, and closing it unread tears the tunnel down
+	var body []byte
+	if req.Method != http.MethodConnect || httpResp.StatusCode/100 != 2 {
+		var decoded bool
+		body, decoded, err = decodeBody(httpResp, c.config.Decompression)
+		if err != nil {
+			return c.createErrorResponse(err, responseTime)
+		}
+		if decoded {
+			// As net/http does, the headers describe the body handed back
+			httpResp.Header.Del("Content-Encoding")
+			httpResp.Header.Del("Content-Length")
+		}
 	}
 
-	// Update metrics
-	c.updateMetrics(responseTime, len(body), httpResp.StatusCode)
-
-	// Create response
 	resp := &protocols.Response{
 		StatusCode:    httpResp.StatusCode,
 		Headers:       c.extractHeaders(httpResp.Header),
@@ -123,8 +246,11 @@ func (c *HTTPClient) Execute(ctx context.Context, req *protocols.Request) (*prot
 		ResponseTime:  responseTime,
 		ContentLength: int64(len(body)),
 	}
+	if recorder != nil {
+		resp.Phases = recorder.phases()
+	}
 
-	return resp, nil
+	return resp
 }
 
 // createHTTPRequest creates an HTTP request from a protocol request
@@ -135,15 +261,23 @@ func (c *HTTPClient) createHTTPRequest(ctx context.Context, req *protocols.Reque
 		url = c.buildURLWithParams(url, req.QueryParams)
 	}
 
-	// Create request
-	httpReq, err := http.NewRequestWithContext(ctx, req.Method, url, strings.NewReader(string(req.Body)))
+	// Create request; the body is read in place, never copied
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, url, bytes.NewReader(req.Body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
-	// Set headers
+	// Set headers, with the values of all of them in a single allocation
+	httpReq.Header = make(http.Header, len(req.Headers)+1)
+	values := make([]string, 0, len(req.Headers))
 	for key, value := range req.Headers {
-		httpReq.Header.Set(key, value)
+		values = append(values, value)
+		httpReq.Header[canonicalHeaderKey(key)] = values[len(values)-1 : len(values) : len(values)]
+	}
+
+	// Compressed responses are decoded by the client, see decodeBody
+	if _, set := httpReq.Header["Accept-Encoding"]; !set && req.Method != http.MethodHead && httpReq.Header.Get("Range") == "" {
+		httpReq.Header["Accept-Encoding"] = acceptEncoding
 	}
 
 	// Set User-Agent if not provided
@@ -160,22 +294,30 @@ func (c *HTTPClient) buildURLWithParams(baseURL string, params map[string]interf
 		return baseURL
 	}
 
-	query := make([]string, 0, len(params))
-	for key, value := range params {
-		query = append(query, fmt.Sprintf("%s=%v", key, value))
-	}
-
-	separator := "?"
+	var b strings.Builder
+	b.Grow(len(baseURL) + 16*len(params))
+	b.WriteString(baseURL)
+	separator := byte('?')
 	if strings.Contains(baseURL, "?") {
-		separator = "&"
+		separator = '&'
 	}
-
-	return baseURL + separator + strings.Join(query, "&")
+	for key, value := range params {
+		b.WriteByte(separator)
+		separator = '&'
+		b.WriteString(url.QueryEscape(key))
+		b.WriteByte('=')
+		if s, ok := value.(string); ok {
+			b.WriteString(url.QueryEscape(s))
+		} else {
+			b.WriteString(url.QueryEscape(fmt.Sprint(value)))
+		}
+	}
+	return b.String()
 }
 
 // extractHeaders extracts headers from HTTP response
 func (c *HTTPClient) extractHeaders(headers http.Header) map[string]string {
-	result := make(map[string]string)
+	result := make(map[string]string, len(headers))
 	for key, values := range headers {
 		if len(values) > 0 {
 			result[key] = values[0]
@@ -196,16 +338,26 @@ func (c *HTTPClient) createErrorResponse(err error, responseTime time.Duration)
 }
 
 // updateMetrics updates client metrics
-func (c *HTTPClient) updateMetrics(responseTime time.Duration, bodySize int, statusCode int) {
+func (c *HTTPClient) updateMetrics(resp *protocols.Response) {
+	c.metrics.mu.Lock()
+	defer c.metrics.mu.Unlock()
+
 	c.metrics.TotalRequests++
-	c.metrics.TotalBytes += int64(bodySize)
+	c.metrics.TotalBytes += resp.ContentLength
 
-	if statusCode >= 200 && statusCode < 400 {
-		c.metrics.SuccessfulRequests++
-	} else {
+	switch {
+	case resp.TransportError():
+		c.metrics.FailedRequests++
+		c.metrics.TransportErrors++
+	case resp.HTTPError():
 		c.metrics.FailedRequests++
+		c.metrics.HTTPErrors++
+	default:
+		c.metrics.SuccessfulRequests++
 	}
 
+	responseTime := resp.ResponseTime
+
 	// Update latency metrics
 	if c.metrics.MinLatency == 0 || responseTime < c.metrics.MinLatency {
 		c.metrics.MinLatency = responseTime
@@ -221,6 +373,29 @@ func (c *HTTPClient) updateMetrics(responseTime time.Duration, bodySize int, sta
 	}
 }
 
+// countVersion counts a response under the protocol version it came with
+func (c *HTTPClient) countVersion(proto string) {
+	c.metrics.mu.Lock()
+	defer c.metrics.mu.Unlock()
+
+	if c.metrics.Versions == nil {
+		c.metrics.Versions = make(map[string]int64)
+	}
+	c.metrics.Versions[proto]++
+}
+
+// Versions returns how many responses came with each protocol version
+func (c *HTTPClient) Versions() map[string]int64 {
+	c.metrics.mu.Lock()
+	defer c.metrics.mu.Unlock()
+
+	versions := make(map[string]int64, len(c.metrics.Versions))
+	for proto, count := range c.metrics.Versions {
+		versions[proto] = count
+	}
+	return versions
+}
+
 // ValidateConfig validates HTTP client configuration
 func (c *HTTPClient) ValidateConfig(config map[string]interface{}) error {
 	// TODO: Implement configuration validation
@@ -229,15 +404,37 @@ func (c *HTTPClient) ValidateConfig(config map[string]interface{}) error {
 
 // GetMetrics returns HTTP-specific metrics
 func (c *HTTPClient) GetMetrics() map[string]interface{} {
-	return map[string]interface{}{
+	c.metrics.mu.Lock()
+	metrics := map[string]interface{}{
 		"total_requests":      c.metrics.TotalRequests,
 		"successful_requests": c.metrics.SuccessfulRequests,
 		"failed_requests":     c.metrics.FailedRequests,
+		"transport_errors":    c.metrics.TransportErrors,
+		"http_errors":         c.metrics.HTTPErrors,
 		"total_bytes":         c.metrics.TotalBytes,
 		"average_latency":     c.metrics.AverageLatency.String(),
 		"max_latency":         c.metrics.MaxLatency.String(),
 		"min_latency":         c.metrics.MinLatency.String(),
 	}
+	if len(c.metrics.Versions) > 0 {
+		versions := make(map[string]int64, len(c.metrics.Versions))
+		for proto, count := range c.metrics.Versions {
+			versions[proto] = count
+		}
+		metrics["versions"] = versions
+	}
+	c.metrics.mu.Unlock()
+
+	if c.chaos != nil {
+		metrics["chaos"] = c.chaos.metrics()
+	}
+
+	return metrics
+}
+
+// PoolStats returns the stats of the client's connection pool
+func (c *HTTPClient) PoolStats() PoolStats {
+	return c.pool.stats()
 }
 
 // Close cleans up HTTP client resources
@@ -245,5 +442,14 @@ func (c *HTTPClient) Close() error {
 	if c.transport != nil {
 		c.transport.CloseIdleConnections()
 	}
+	if c.pipeline != nil {
+		c.pipeline.Close()
+	}
+	if c.http2 != nil {
+		c.http2.CloseIdleConnections()
+	}
+	if c.http3 != nil {
+		return c.http3.Close()
+	}
 	return nil
 }
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Decompression defaults, so a zip-bomb-like response from an untrusted or
+// buggy endpoint cannot exhaust the memory of the generator
+const (
+	DefaultMaxDecompressedSize   = 64 << 20
+	DefaultMaxDecompressionRatio = 100
+
+	// ratioFloor is the decompressed size below which the ratio is not
+	// enforced: small, repetitive bodies such as JSON often compress beyond
+	// any sensible ratio
+	ratioFloor = 1 << 20
+)
+
+// ErrDecompressionLimit is wrapped by the error of a response whose body
+// expands past the decompression limits
+var ErrDecompressionLimit = errors.New("decompression limit exceeded")
+
+// acceptEncoding is sent by requests that set no Accept-Encoding, as
+// net/http did before the client took over decompression
+var acceptEncoding = []string{"gzip"}
+
+// DecompressionConfig caps how far compressed response bodies may expand
+type DecompressionConfig struct {
+	// MaxSize is the most bytes a body may decompress to (0 = no limit)
+	MaxSize int64
+	// MaxRatio is the most a body may expand, its decompressed size over
+	// its compressed size, once past 1MB (0 = no limit)
+	MaxRatio float64
+}
+
+// decodeBody reads the body of a response, decompressing gzip and deflate
+// within the limits, and reports whether it was decompressed. Other
+// encodings, such as br, are read as they are.
+func decodeBody(resp *http.Response, limits *DecompressionConfig) ([]byte, bool, error) {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding != "gzip" && encoding != "x-gzip" && encoding != "deflate" {
+		body, err := readBody(resp.Body)
+		return body, false, err
+	}
+
+	compressed := &countingReader{r: resp.Body}
+	var decoder io.ReadCloser
+	var err error
+	if encoding == "deflate" {
+		decoder, err = zlib.NewReader(compressed)
+	} else {
+		decoder, err = gzip.NewReader(compressed)
+	}
+	if err == io.EOF {
+		// No body, as with 204 and 304
+		return []byte{}, true, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decompress %s response body: %w", encoding, err)
+	}
+	defer decoder.Close()
+
+	if limits == nil {
+		limits = &DecompressionConfig{}
+	}
+	body, err := readBody(&limitedReader{r: decoder, compressed: compressed, limits: limits})
+	if err != nil {
+		if !errors.Is(err, ErrDecompressionLimit) {
+			err = fmt.Errorf("failed to decompress %s response body: %w", encoding, err)
+		}
+		return nil, false, err
+	}
+	return body, true, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read reads from the underlying reader
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// limitedReader fails once the decompressed body passes the limits, before
+// it is read any further
+type limitedReader struct {
+	r          io.Reader
+	compressed *countingReader
+	limits     *DecompressionConfig
+	n          int64
+}
+
+// Read reads decompressed bytes, checking them against the limits
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+
+	if max := l.limits.MaxSize; max > 0 && l.n > max {
+		return n, fmt.Errorf("%w: response body decompresses to more than %d bytes", ErrDecompressionLimit, max)
+	}
+	if ratio := l.limits.MaxRatio; ratio > 0 && l.n > ratioFloor && float64(l.n) > ratio*float64(l.compressed.n) {
+		return n, fmt.Errorf("%w: response body expands more than %gx", ErrDecompressionLimit, ratio)
+	}
+	return n, err
+}
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+)
+
+// HTTP versions a client may speak
+const (
+	// Version11 speaks HTTP/1.1 only, the default
+	Version11 = "1.1"
+	// Version2 speaks HTTP/2 only: h2 over TLS, h2c with prior knowledge
+	// over plain connections
+	Version2 = "2"
+	// Version3 speaks HTTP/3 over QUIC, for https:// URLs only
+	Version3 = "3"
+	// VersionAuto negotiates h2 over TLS through ALPN, falling back to
+	// HTTP/1.1 when the server does not offer it or the URL is http://
+	VersionAuto = "auto"
+)
+
+// http2Transport sends every request over HTTP/2. Requests to https://
+// URLs negotiate h2 through ALPN and fail if the server does not agree;
+// requests to http:// URLs speak h2c with prior knowledge.
+type http2Transport struct {
+	tls   *http2.Transport
+	plain *http2.Transport
+}
+
+// newHTTP2Transport creates an HTTP/2 transport dialing through dial, so
+// throttling, faults and pool stats apply as with HTTP/1.1
+func newHTTP2Transport(config *Config, dial dialFunc) *http2Transport {
+	return &http2Transport{
+		tls: &http2.Transport{
+			TLSClientConfig:    config.tlsConfig(),
+			DisableCompression: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, tlsConfig *tls.Config) (net.Conn, error) {
+				conn, err := dial(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				tlsConn := tls.Client(conn, tlsConfig)
+				if err := tlsConn.HandshakeContext(ctx); err != nil {
+					conn.Close()
+					return nil, err
+				}
+				if protocol := tlsConn.ConnectionState().NegotiatedProtocol; protocol != http2.NextProtoTLS {
+					conn.Close()
+					return nil, fmt.Errorf("server at %s does not support HTTP/2 (negotiated %q)", addr, protocol)
+				}
+				return tlsConn, nil
+			},
+		},
+		plain: &http2.Transport{
+			AllowHTTP:          true,
+			DisableCompression: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			},
+		},
+	}
+}
+
+// RoundTrip sends a request on the transport of its scheme
+func (t *http2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.plain.RoundTrip(req)
+	}
+	return t.tls.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the connections no request is using
+func (t *http2Transport) CloseIdleConnections() {
+	t.tls.CloseIdleConnections()
+	t.plain.CloseIdleConnections()
+}
@@ -0,0 +1,160 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3Transport sends every request over HTTP/3. QUIC runs over UDP, so
+// the dial chain of TCP connections, with throttling and faults, does not
+// apply; the pool only counts the dials and open connections.
+//
+// Requests whose phases are recorded get dns, tls and wait phases: tls is
+// the whole QUIC handshake, which carries TLS 1.3, and wait runs from the
+// end of the handshake, or the start of a request on an open connection,
+// to the response headers, sending included.
+type http3Transport struct {
+	roundTripper *http3.RoundTripper
+	pool         *pool
+
+	mu     sync.Mutex
+	socket *net.UDPConn
+	udp    *quic.Transport
+}
+
+// newHTTP3Transport creates an HTTP/3 transport counting its connections
+// in connections
+func newHTTP3Transport(config *Config, connections *pool) *http3Transport {
+	t := &http3Transport{pool: connections}
+	t.roundTripper = &http3.RoundTripper{
+		TLSClientConfig:    config.tlsConfig(),
+		Dial:               t.dial,
+		DisableCompression: true,
+	}
+	return t
+}
+
+// RoundTrip sends a request and records its wait phase
+func (t *http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.roundTripper.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if recorder := recorderFrom(req.Context()); recorder != nil {
+		// The handshake of a new connection comes before the request
+		if handshake, ok := recorder.ended(phaseTLS); ok && handshake.After(start) {
+			start = handshake
+		}
+		headers := time.Now()
+		recorder.span(phaseWait, start, headers)
+		recorder.begin(phaseReceive)
+	}
+	return resp, nil
+}
+
+// dial opens a QUIC connection to addr, waiting for its handshake so the
+// handshake is timed apart from the first request
+func (t *http3Transport) dial(ctx context.Context, addr string, tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlyConnection, error) {
+	recorder := recorderFrom(ctx)
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	portNumber, err := net.LookupPort("udp", port)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		start := time.Now()
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if recorder != nil {
+			recorder.span(phaseDNS, start, time.Now())
+		}
+		if err != nil {
+			return nil, err
+		}
+		ip = ips[0]
+	}
+
+	udp, err := t.transport()
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&t.pool.dials, 1)
+	start := time.Now()
+	conn, err := udp.DialEarly(ctx, &net.UDPAddr{IP: ip, Port: portNumber}, tlsConfig, quicConfig)
+	if err == nil {
+		select {
+		case <-conn.HandshakeComplete():
+		case <-conn.Context().Done():
+			err = fmt.Errorf("QUIC handshake with %s failed: %w", addr, context.Cause(conn.Context()))
+		case <-ctx.Done():
+			conn.CloseWithError(0, "")
+			err = ctx.Err()
+		}
+	}
+	if recorder != nil {
+		recorder.span(phaseTLS, start, time.Now())
+	}
+	if err != nil {
+		// Dials abandoned with their request are not the target's fault
+		if ctx.Err() == nil {
+			atomic.AddInt64(&t.pool.dialFailures, 1)
+		}
+		return nil, err
+	}
+
+	t.pool.open.add(1)
+	go func() {
+		<-conn.Context().Done()
+		t.pool.open.add(-1)
+	}()
+	return conn, nil
+}
+
+// transport returns the UDP socket every connection is multiplexed on,
+// opening it on first use
+func (t *http3Transport) transport() (*quic.Transport, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.udp == nil {
+		conn, err := net.ListenUDP("udp", nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open UDP socket: %w", err)
+		}
+		t.socket = conn
+		t.udp = &quic.Transport{Conn: conn}
+	}
+	return t.udp, nil
+}
+
+// Close closes every connection and the UDP socket
+func (t *http3Transport) Close() error {
+	err := t.roundTripper.Close()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.udp != nil {
+		t.udp.Close()
+		if closeErr := t.socket.Close(); err == nil {
+			err = closeErr
+		}
+		t.socket, t.udp = nil, nil
+	}
+	return err
+}
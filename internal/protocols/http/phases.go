@@ -0,0 +1,133 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/protocols"
+)
+
+// Request phases, in the order they happen
+const (
+	phaseDNS     = "dns"
+	phaseConnect = "connect"
+	phaseTLS     = "tls"
+	phaseSend    = "send"
+	phaseWait    = "wait"
+	phaseReceive = "receive"
+)
+
+// phaseRecorder times the phases of one request with net/http/httptrace.
+// Phases of a reused connection, such as DNS, are absent; with happy
+// eyeballs the connect phase spans every dial attempt.
+type phaseRecorder struct {
+	mu     sync.Mutex
+	start  time.Time
+	starts map[string]time.Time
+	ends   map[string]time.Time
+}
+
+// newPhaseRecorder creates a recorder for a request started at start
+func newPhaseRecorder(start time.Time) *phaseRecorder {
+	return &phaseRecorder{
+		start:  start,
+		starts: make(map[string]time.Time),
+		ends:   make(map[string]time.Time),
+	}
+}
+
+// begin marks the first start of a phase
+func (r *phaseRecorder) begin(phase string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.starts[phase]; !exists {
+		r.starts[phase] = time.Now()
+	}
+}
+
+// end marks the last end of a phase
+func (r *phaseRecorder) end(phase string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ends[phase] = time.Now()
+}
+
+// span records a phase that started and ended at the given times
+func (r *phaseRecorder) span(phase string, start, end time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.starts[phase] = start
+	r.ends[phase] = end
+}
+
+// ended returns when a phase last ended, if it did
+func (r *phaseRecorder) ended(phase string) (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	end, ok := r.ends[phase]
+	return end, ok
+}
+
+// recorderKey is the context key of the recorder of a request
+type recorderKey struct{}
+
+// withRecorder returns ctx carrying r, for transports httptrace does not
+// reach, such as HTTP/3
+func withRecorder(ctx context.Context, r *phaseRecorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// recorderFrom returns the recorder of a request, or nil
+func recorderFrom(ctx context.Context) *phaseRecorder {
+	r, _ := ctx.Value(recorderKey{}).(*phaseRecorder)
+	return r
+}
+
+// trace returns the hooks feeding the recorder
+func (r *phaseRecorder) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { r.begin(phaseDNS) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { r.end(phaseDNS) },
+		ConnectStart:      func(string, string) { r.begin(phaseConnect) },
+		ConnectDone:       func(string, string, error) { r.end(phaseConnect) },
+		TLSHandshakeStart: func() { r.begin(phaseTLS) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { r.end(phaseTLS) },
+		GotConn:           func(httptrace.GotConnInfo) { r.begin(phaseSend) },
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			r.end(phaseSend)
+			r.begin(phaseWait)
+		},
+		GotFirstResponseByte: func() {
+			r.end(phaseWait)
+			r.begin(phaseReceive)
+		},
+	}
+}
+
+// phases returns the phases that completed, ending the receive phase now
+func (r *phaseRecorder) phases() []protocols.Phase {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, receiving := r.starts[phaseReceive]; receiving {
+		r.ends[phaseReceive] = time.Now()
+	}
+
+	var phases []protocols.Phase
+	for _, name := range []string{phaseDNS, phaseConnect, phaseTLS, phaseSend, phaseWait, phaseReceive} {
+		start, started := r.starts[name]
+		end, ended := r.ends[name]
+		if !started || !ended || end.Before(start) {
+			continue
+		}
+		phases = append(phases, protocols.Phase{
+			Name:  name,
+			Start: start.Sub(r.start),
+			End:   end.Sub(r.start),
+		})
+	}
+	return phases
+}
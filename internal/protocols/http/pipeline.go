@@ -0,0 +1,420 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// pipelineRetry is how long a request waits for a connection to retire
+// when every allowed connection is in use up to its request limit
+const pipelineRetry = 5 * time.Millisecond
+
+// Errors returned by the pipelining transport
+var (
+	ErrConnectionRetired = errors.New("connection closed with pipelined requests pending")
+	errTransportClosed   = errors.New("http client closed")
+)
+
+// pipelineTransport sends HTTP/1.1 requests over connections it manages
+// itself, so it controls how many requests each connection carries before
+// it is replaced, and how many may be outstanding on it at once. Above one,
+// requests are pipelined: sent without waiting for earlier responses, which
+// come back in order. net/http supports neither.
+type pipelineTransport struct {
+	dial dialFunc
+	// tls is cloned for each connection to an https host
+	tls *tls.Config
+	// depth is the most requests outstanding on a connection before another
+	// one is opened
+	depth int
+	// maxRequests is the most requests a connection carries; 0 = no limit
+	maxRequests int
+	// maxConns is the most connections per host; 0 = no limit
+	maxConns int
+
+	mu      sync.Mutex
+	conns   map[string][]*pipeConn
+	dialing map[string]int
+	closed  bool
+}
+
+// pipeConn is a connection of the pipelining transport. Requests are
+// written in the order they are queued in pending, and a single reader
+// matches responses to them in that order.
+type pipeConn struct {
+	t    *pipelineTransport
+	key  string
+	conn net.Conn
+	br   *bufio.Reader
+	bw   *bufio.Writer
+
+	// assigned and outstanding are guarded by t.mu
+	assigned    int
+	outstanding int
+
+	// writeMu serializes writes and keeps pending in write order; a request
+	// holds one of the depth slots from its write until its response is read
+	writeMu sync.Mutex
+	written int
+	slots   chan struct{}
+	pending chan *pipeCall
+
+	once sync.Once
+	dead chan struct{}
+	err  error
+}
+
+// pipeCall is a request waiting for its response
+type pipeCall struct {
+	req  *http.Request
+	done chan pipeResult
+}
+
+// pipeResult is the outcome of a pipelined request
+type pipeResult struct {
+	resp *http.Response
+	err  error
+}
+
+// newPipelineTransport creates a transport opening connections with dial
+func newPipelineTransport(config *Config, dial dialFunc) *pipelineTransport {
+	depth := config.Pipeline
+	if depth < 1 {
+		depth = 1
+	}
+	maxRequests := config.MaxRequestsPerConn
+	if !config.KeepAlive {
+		maxRequests = 1
+	}
+
+	return &pipelineTransport{
+		dial:        dial,
+		tls:         config.tlsConfig(),
+		depth:       depth,
+		maxRequests: maxRequests,
+		maxConns:    config.MaxConnsPerHost,
+		conns:       make(map[string][]*pipeConn),
+		dialing:     make(map[string]int),
+	}
+}
+
+// RoundTrip sends a request on the least busy connection to its host
+func (t *pipelineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported protocol scheme %q", req.URL.Scheme)
+	}
+
+	pc, err := t.conn(req)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	defer t.done(pc)
+
+	call := &pipeCall{req: req, done: make(chan pipeResult, 1)}
+	if err := pc.send(call); err != nil {
+		return nil, err
+	}
+
+	select {
+	case result := <-call.done:
+		return result.resp, result.err
+	case <-req.Context().Done():
+		// Every later response on the connection is stuck behind this one
+		pc.fail(fmt.Errorf("earlier pipelined request canceled: %w", req.Context().Err()))
+		return nil, req.Context().Err()
+	}
+}
+
+// conn assigns the request to a connection with room for it, opening a new
+// one when every connection is at the pipelining depth. With every allowed
+// connection retiring, it waits for one to close.
+func (t *pipelineTransport) conn(req *http.Request) (*pipeConn, error) {
+	key := req.URL.Scheme + "://" + canonicalAddr(req)
+
+	for {
+		pc, dial, err := t.assign(key)
+		if err != nil || pc != nil {
+			return pc, err
+		}
+		if dial {
+			return t.dialAssigned(req, key)
+		}
+
+		timer := time.NewTimer(pipelineRetry)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// assign picks the least busy connection to key that may carry another
+// request, or reports whether a new one may be dialed
+func (t *pipelineTransport) assign(key string) (*pipeConn, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, false, errTransportClosed
+	}
+
+	var best *pipeConn
+	for _, pc := range t.conns[key] {
+		if t.maxRequests > 0 && pc.assigned >= t.maxRequests {
+			continue
+		}
+		if best == nil || pc.outstanding < best.outstanding {
+			best = pc
+		}
+	}
+	canDial := t.maxConns == 0 || len(t.conns[key])+t.dialing[key] < t.maxConns
+	if best != nil && (best.outstanding < t.depth || !canDial) {
+		best.assigned++
+		best.outstanding++
+		return best, false, nil
+	}
+	if canDial {
+		t.dialing[key]++
+	}
+
+	return nil, canDial, nil
+}
+
+// dialAssigned opens a connection to key and assigns the request to it
+func (t *pipelineTransport) dialAssigned(req *http.Request, key string) (*pipeConn, error) {
+	pc, err := t.dialConn(req.Context(), req, key)
+
+	t.mu.Lock()
+	t.dialing[key]--
+	if err != nil {
+		t.mu.Unlock()
+		return nil, err
+	}
+	if t.closed {
+		t.mu.Unlock()
+		pc.fail(errTransportClosed)
+		return nil, errTransportClosed
+	}
+	pc.assigned++
+	pc.outstanding++
+	t.conns[key] = append(t.conns[key], pc)
+	t.mu.Unlock()
+
+	return pc, nil
+}
+
+// done marks a request assigned to pc as finished
+func (t *pipelineTransport) done(pc *pipeConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pc.outstanding--
+}
+
+// dialConn opens a connection, with TLS for https
+func (t *pipelineTransport) dialConn(ctx context.Context, req *http.Request, key string) (*pipeConn, error) {
+	conn, err := t.dial(ctx, "tcp", canonicalAddr(req))
+	if err != nil {
+		return nil, err
+	}
+
+	if req.URL.Scheme == "https" {
+		tlsConfig := t.tls.Clone()
+		tlsConfig.ServerName = req.URL.Hostname()
+		tlsConfig.NextProtos = []string{"http/1.1"}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	pc := &pipeConn{
+		t:       t,
+		key:     key,
+		conn:    conn,
+		br:      bufio.NewReader(conn),
+		bw:      bufio.NewWriter(conn),
+		slots:   make(chan struct{}, t.depth),
+		pending: make(chan *pipeCall, t.depth),
+		dead:    make(chan struct{}),
+	}
+	go pc.readLoop()
+
+	return pc, nil
+}
+
+// remove drops a failed connection from the pool
+func (t *pipelineTransport) remove(pc *pipeConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	conns := t.conns[pc.key]
+	for i, other := range conns {
+		if other == pc {
+			t.conns[pc.key] = append(conns[:i:i], conns[i+1:]...)
+			break
+		}
+	}
+	if len(t.conns[pc.key]) == 0 {
+		delete(t.conns, pc.key)
+	}
+}
+
+// Close closes every connection, failing the requests still pending
+func (t *pipelineTransport) Close() {
+	t.mu.Lock()
+	t.closed = true
+	var conns []*pipeConn
+	for _, pool := range t.conns {
+		conns = append(conns, pool...)
+	}
+	t.mu.Unlock()
+
+	for _, pc := range conns {
+		pc.fail(errTransportClosed)
+	}
+}
+
+// send writes the request after those queued before it. The last request
+// a connection may carry asks the server to close it.
+func (pc *pipeConn) send(call *pipeCall) error {
+	pc.writeMu.Lock()
+	defer pc.writeMu.Unlock()
+
+	select {
+	case <-pc.dead:
+		return pc.err
+	default:
+	}
+
+	select {
+	case pc.slots <- struct{}{}:
+	case <-pc.dead:
+		return pc.err
+	case <-call.req.Context().Done():
+		return call.req.Context().Err()
+	}
+	pc.pending <- call
+
+	req := call.req
+	pc.written++
+	if pc.t.maxRequests > 0 && pc.written >= pc.t.maxRequests {
+		req = req.Clone(req.Context())
+		req.Close = true
+	}
+
+	// A failed write closes the connection; the reader then fails the call
+	err := req.Write(pc.bw)
+	if err == nil {
+		err = pc.bw.Flush()
+	}
+	if err != nil {
+		pc.fail(err)
+	}
+
+	return nil
+}
+
+// readLoop reads responses in order and hands each to its request, until
+// the connection fails or has carried all the requests it may
+func (pc *pipeConn) readLoop() {
+	received := 0
+	for {
+		// Notice a connection closed by the server while idle
+		if _, err := pc.br.Peek(1); err != nil {
+			pc.fail(err)
+			break
+		}
+
+		var call *pipeCall
+		select {
+		case call = <-pc.pending:
+		case <-pc.dead:
+		}
+		if call == nil {
+			break
+		}
+
+		resp, err := pc.readResponse(call.req)
+		call.done <- pipeResult{resp: resp, err: err}
+		<-pc.slots
+		if err != nil {
+			pc.fail(err)
+			break
+		}
+
+		received++
+		if resp.Close || (pc.t.maxRequests > 0 && received >= pc.t.maxRequests) {
+			pc.fail(ErrConnectionRetired)
+			break
+		}
+	}
+
+	// No request is queued once writers see the connection is dead
+	pc.writeMu.Lock()
+	defer pc.writeMu.Unlock()
+	for {
+		select {
+		case call := <-pc.pending:
+			call.done <- pipeResult{err: pc.err}
+		default:
+			return
+		}
+	}
+}
+
+// readResponse reads a response and its whole body, so the next response
+// can be read right away
+func (pc *pipeConn) readResponse(req *http.Request) (*http.Response, error) {
+	resp, err := http.ReadResponse(pc.br, req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := readBody(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	return resp, nil
+}
+
+// fail closes the connection once, failing the requests still pending
+func (pc *pipeConn) fail(err error) {
+	pc.once.Do(func() {
+		pc.err = err
+		close(pc.dead)
+		pc.conn.Close()
+		pc.t.remove(pc)
+	})
+}
+
+// canonicalAddr returns the host:port of the request, with the default port
+// of its scheme when none is set
+func canonicalAddr(req *http.Request) string {
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(req.URL.Hostname(), port)
+}
@@ -0,0 +1,236 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PoolStats describes the connection pool of a client. Open, InUse and
+// Waiting are current; the rest add up since the client was created. A
+// request holds its connection until its response is read, so a connection
+// handed to the next request may briefly count for both. With pipelining,
+// connections are counted but not requests holding or waiting for them.
+type PoolStats struct {
+	Dials        int64
+	DialFailures int64
+	Open         int64
+	PeakOpen     int64
+	InUse        int64
+	PeakInUse    int64
+	Waiting      int64
+	PeakWaiting  int64
+	// Reused counts requests sent on a connection opened earlier
+	Reused int64
+	// Waits counts requests that found no idle connection and waited for a
+	// new one or one another request released, for WaitTime in total
+	Waits    int64
+	WaitTime time.Duration
+	MaxWait  time.Duration
+}
+
+// Idle returns the open connections no request holds
+func (s PoolStats) Idle() int64 {
+	return max(s.Open-s.InUse, 0)
+}
+
+// Add sums the stats of another client; peaks add up to an upper bound
+func (s *PoolStats) Add(other PoolStats) {
+	s.Dials += other.Dials
+	s.DialFailures += other.DialFailures
+	s.Open += other.Open
+	s.PeakOpen += other.PeakOpen
+	s.InUse += other.InUse
+	s.PeakInUse += other.PeakInUse
+	s.Waiting += other.Waiting
+	s.PeakWaiting += other.PeakWaiting
+	s.Reused += other.Reused
+	s.Waits += other.Waits
+	s.WaitTime += other.WaitTime
+	s.MaxWait = max(s.MaxWait, other.MaxWait)
+}
+
+// gauge is a current value that remembers its peak
+type gauge struct {
+	value int64
+	peak  int64
+}
+
+func (g *gauge) add(n int64) {
+	value := atomic.AddInt64(&g.value, n)
+	for {
+		peak := atomic.LoadInt64(&g.peak)
+		if value <= peak || atomic.CompareAndSwapInt64(&g.peak, peak, value) {
+			return
+		}
+	}
+}
+
+// pool tracks the connections of a client: dials through the wrapped dial
+// function, and the requests holding or waiting for connections through
+// httptrace
+type pool struct {
+	dials        int64
+	dialFailures int64
+	reused       int64
+	waits        int64
+	waitTime     int64
+	maxWait      int64
+	open         gauge
+	inUse        gauge
+	waiting      gauge
+
+	// softStart paces the requests of new connections when set
+	softStart *SoftStartConfig
+}
+
+// dial wraps next, counting dials and the connections left open
+func (p *pool) dial(next dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		atomic.AddInt64(&p.dials, 1)
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			// Dials abandoned with their request are not the target's fault
+			if ctx.Err() == nil {
+				atomic.AddInt64(&p.dialFailures, 1)
+			}
+			return nil, err
+		}
+		p.open.add(1)
+		return &pooledConn{Conn: conn, pool: p, opened: time.Now()}, nil
+	}
+}
+
+// pooledConn is an open connection of the pool
+type pooledConn struct {
+	net.Conn
+	pool   *pool
+	closed sync.Once
+	opened time.Time
+
+	// lastSlot is when the last request paced by soft start was sent
+	mu       sync.Mutex
+	lastSlot time.Time
+}
+
+func (c *pooledConn) Close() error {
+	c.closed.Do(func() { c.pool.open.add(-1) })
+	return c.Conn.Close()
+}
+
+// Request states of a connUse
+const (
+	connIdle int32 = iota
+	connWaiting
+	connHeld
+	connDone
+)
+
+// connUse follows one request getting and releasing a connection
+type connUse struct {
+	pool  *pool
+	ctx   context.Context
+	state int32
+	start time.Time
+	// paused is how long soft start held the request back
+	paused time.Duration
+}
+
+// track returns ctx with hooks following the connection of a request, and
+// the use to end once the response is read
+func (p *pool) track(ctx context.Context) (context.Context, *connUse) {
+	use := &connUse{pool: p, ctx: ctx}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: use.getConn,
+		GotConn: use.gotConn,
+	}), use
+}
+
+func (u *connUse) getConn(string) {
+	if atomic.CompareAndSwapInt32(&u.state, connIdle, connWaiting) {
+		u.start = time.Now()
+		u.pool.waiting.add(1)
+	}
+}
+
+func (u *connUse) gotConn(info httptrace.GotConnInfo) {
+	if !atomic.CompareAndSwapInt32(&u.state, connWaiting, connHeld) {
+		return
+	}
+	u.pool.waiting.add(-1)
+	u.pool.inUse.add(1)
+
+	if info.Reused {
+		atomic.AddInt64(&u.pool.reused, 1)
+	}
+	u.pace(info.Conn)
+	if info.WasIdle {
+		return
+	}
+
+	wait := int64(time.Since(u.start))
+	atomic.AddInt64(&u.pool.waits, 1)
+	atomic.AddInt64(&u.pool.waitTime, wait)
+	for {
+		longest := atomic.LoadInt64(&u.pool.maxWait)
+		if wait <= longest || atomic.CompareAndSwapInt64(&u.pool.maxWait, longest, wait) {
+			return
+		}
+	}
+}
+
+// pace holds the request back while soft start paces its connection
+func (u *connUse) pace(conn net.Conn) {
+	if !u.pool.softStart.Enabled() {
+		return
+	}
+	pooled := pooledConnOf(conn)
+	if pooled == nil {
+		return
+	}
+
+	pause := u.pool.softStart.pause(pooled, time.Now())
+	if pause <= 0 {
+		return
+	}
+	timer := time.NewTimer(pause)
+	defer timer.Stop()
+
+	start := time.Now()
+	select {
+	case <-timer.C:
+	case <-u.ctx.Done():
+	}
+	u.paused = time.Since(start)
+}
+
+// end releases the connection of the request, or stops its wait
+func (u *connUse) end() {
+	switch atomic.SwapInt32(&u.state, connDone) {
+	case connWaiting:
+		u.pool.waiting.add(-1)
+	case connHeld:
+		u.pool.inUse.add(-1)
+	}
+}
+
+// stats returns the current stats of the pool
+func (p *pool) stats() PoolStats {
+	return PoolStats{
+		Dials:        atomic.LoadInt64(&p.dials),
+		DialFailures: atomic.LoadInt64(&p.dialFailures),
+		Open:         atomic.LoadInt64(&p.open.value),
+		PeakOpen:     atomic.LoadInt64(&p.open.peak),
+		InUse:        atomic.LoadInt64(&p.inUse.value),
+		PeakInUse:    atomic.LoadInt64(&p.inUse.peak),
+		Waiting:      atomic.LoadInt64(&p.waiting.value),
+		PeakWaiting:  atomic.LoadInt64(&p.waiting.peak),
+		Reused:       atomic.LoadInt64(&p.reused),
+		Waits:        atomic.LoadInt64(&p.waits),
+		WaitTime:     time.Duration(atomic.LoadInt64(&p.waitTime)),
+		MaxWait:      time.Duration(atomic.LoadInt64(&p.maxWait)),
+	}
+}
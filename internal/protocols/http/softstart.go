@@ -0,0 +1,51 @@
+package http
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// SoftStartConfig paces the requests of new connections, so they do not
+// burst at full rate before the server has grown its flow-control windows:
+// a new connection carries Rate requests per second, and the gap between
+// its requests shrinks linearly to none once it is Duration old
+type SoftStartConfig struct {
+	Duration time.Duration
+	Rate     float64
+}
+
+// Enabled reports whether new connections are paced
+func (s *SoftStartConfig) Enabled() bool {
+	return s != nil && s.Duration > 0 && s.Rate > 0
+}
+
+// pause reserves the next request slot of conn and returns how long the
+// request must wait for it
+func (s *SoftStartConfig) pause(conn *pooledConn, now time.Time) time.Duration {
+	age := now.Sub(conn.opened)
+	if age >= s.Duration {
+		return 0
+	}
+	gap := time.Duration(float64(time.Second) / s.Rate * (1 - float64(age)/float64(s.Duration)))
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	slot := conn.lastSlot.Add(gap)
+	if conn.lastSlot.IsZero() || slot.Before(now) {
+		slot = now
+	}
+	conn.lastSlot = slot
+	return slot.Sub(now)
+}
+
+// pooledConnOf returns the pool connection under conn, as handed to
+// httptrace, or nil if it is not one
+func pooledConnOf(conn net.Conn) *pooledConn {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	pooled, _ := conn.(*pooledConn)
+	return pooled
+}
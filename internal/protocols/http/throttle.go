@@ -0,0 +1,119 @@
+package http
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// BandwidthConfig limits the bandwidth of every connection, in bytes per
+// second; 0 means unlimited
+type BandwidthConfig struct {
+	Download int64
+	Upload   int64
+}
+
+// Enabled reports whether any limit is configured
+func (b *BandwidthConfig) Enabled() bool {
+	return b != nil && (b.Download > 0 || b.Upload > 0)
+}
+
+// throttleDialer wraps dialed connections with bandwidth limits
+func throttleDialer(config *BandwidthConfig, dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &throttledConn{
+			Conn:     conn,
+			download: newRateLimiter(config.Download),
+			upload:   newRateLimiter(config.Upload),
+		}, nil
+	}
+}
+
+// throttledConn paces reads and writes to the configured rates
+type throttledConn struct {
+	net.Conn
+	download *rateLimiter
+	upload   *rateLimiter
+}
+
+// Read reads at most one pacing chunk and waits for it to be "received"
+func (c *throttledConn) Read(b []byte) (int, error) {
+	if c.download == nil {
+		return c.Conn.Read(b)
+	}
+
+	n, err := c.Conn.Read(b[:c.download.chunk(len(b))])
+	c.download.wait(n)
+	return n, err
+}
+
+// Write sends in pacing chunks
+func (c *throttledConn) Write(b []byte) (int, error) {
+	if c.upload == nil {
+		return c.Conn.Write(b)
+	}
+
+	written := 0
+	for written < len(b) {
+		size := c.upload.chunk(len(b) - written)
+		c.upload.wait(size)
+
+		n, err := c.Conn.Write(b[written : written+size])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// rateLimiter paces a byte stream to a fixed rate
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate int64
+	next time.Time
+}
+
+// newRateLimiter returns a limiter for rate bytes per second, or nil if unlimited
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate}
+}
+
+// chunk limits an I/O size to about 1/10s of transfer so pacing stays smooth
+func (l *rateLimiter) chunk(size int) int {
+	limit := int(l.rate / 10)
+	if limit < 1 {
+		limit = 1
+	}
+	if size > limit {
+		return limit
+	}
+	return size
+}
+
+// wait blocks until n more bytes fit in the rate
+func (l *rateLimiter) wait(n int) {
+	if n <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.rate) * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
@@ -23,6 +23,54 @@ type Response struct {
 	ResponseTime  time.Duration
 	ContentLength int64
 	Error         error
+
+	// FailedCheck names a check the protocol made on the response itself,
+	// such as the echo of a WebSocket frame, that it failed with
+	// CheckError; the response counts as failing validation of that type
+	FailedCheck string
+	CheckError  error
+
+	// Phases break the request down when the caller asked for them with
+	// WithPhases and the protocol records them
+	Phases []Phase
+}
+
+// Phase is a part of a request, with offsets from the request start
+type Phase struct {
+	Name  string
+	Start time.Duration
+	End   time.Duration
+}
+
+// phasesKey marks a context asking for request phases
+type phasesKey struct{}
+
+// WithPhases asks the protocol to record the phases of requests made with
+// the returned context, such as DNS, connect and time to first byte
+func WithPhases(ctx context.Context) context.Context {
+	return context.WithValue(ctx, phasesKey{}, true)
+}
+
+// PhasesRequested reports whether phases were asked for with WithPhases
+func PhasesRequested(ctx context.Context) bool {
+	requested, _ := ctx.Value(phasesKey{}).(bool)
+	return requested
+}
+
+// TransportError reports whether the request failed without producing a
+// response, e.g. a connection, timeout or request build error
+func (r *Response) TransportError() bool {
+	return r.Error != nil
+}
+
+// HTTPError reports whether a response was received with an error status
+func (r *Response) HTTPError() bool {
+	return r.Error == nil && r.StatusCode >= 400
+}
+
+// Failed reports whether the request counts as failed in every metric
+func (r *Response) Failed() bool {
+	return r.TransportError() || r.HTTPError()
 }
 
 // Protocol defines the interface for different protocols
@@ -46,6 +94,16 @@ type Protocol interface {
 	Close() error
 }
 
+// PerVU is implemented by protocols that keep state for each virtual user,
+// such as an open WebSocket; the engine then gives every VU an instance of
+// its own
+type PerVU interface {
+	Protocol
+
+	// PerVU reports whether each VU needs its own instance
+	PerVU() bool
+}
+
 // ProtocolFactory creates protocol instances
 type ProtocolFactory interface {
 	CreateProtocol(config map[string]interface{}) (Protocol, error)
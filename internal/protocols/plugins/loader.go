@@ -0,0 +1,231 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/alexandredias/gotsunami/pkg/plugin"
+	"github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultDirs returns the directories searched for protocol plugins. The
+// working directory is left out, so a binary in whatever directory a test
+// runs from is never launched unless asked for with --plugin-dir.
+func DefaultDirs() []string {
+	var dirs []string
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".gotsunami", "plugins"))
+	}
+	return dirs
+}
+
+var (
+	registeredMu sync.Mutex
+	// registered holds the names registered by plugins, told apart from
+	// built-in protocols when plugins are discovered again
+	registered = make(map[string]bool)
+)
+
+// Discover finds protocol plugin binaries in dirs. Plugins are named
+// gotsunami-protocol-<name>; the first match for a name wins.
+func Discover(dirs []string) (map[string]string, error) {
+	found := make(map[string]string)
+
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read plugin directory %s: %w", dir, err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasPrefix(entry.Name(), plugin.BinaryPrefix) {
+				continue
+			}
+			name := strings.TrimSuffix(strings.TrimPrefix(entry.Name(), plugin.BinaryPrefix), ".exe")
+			if _, exists := found[name]; exists || name == "" {
+				continue
+			}
+			found[name] = filepath.Join(dir, entry.Name())
+		}
+	}
+
+	return found, nil
+}
+
+// RegisterDiscovered registers every plugin found in dirs with the protocol
+// registry. Plugin processes are only launched when a scenario uses them.
+// Plugins named after a built-in protocol are skipped with a warning, so a
+// stray binary cannot take over http or grpc.
+func RegisterDiscovered(dirs []string) (map[string]string, error) {
+	found, err := Discover(dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	for name, path := range found {
+		if builtin(name) {
+			logrus.Warnf("Ignoring plugin %s: %s is a built-in protocol", path, name)
+			delete(found, name)
+			continue
+		}
+		path := path
+		protocols.Register(name, func(config map[string]interface{}) (protocols.Protocol, error) {
+			return Load(path, config)
+		})
+		registered[strings.ToLower(name)] = true
+	}
+
+	return found, nil
+}
+
+// builtin reports whether name is a protocol GoTsunami provides itself;
+// callers hold registeredMu
+func builtin(name string) bool {
+	name = strings.ToLower(name)
+	if name == "http" || name == "https" {
+		return true
+	}
+	return protocols.Registered(name) && !registered[name]
+}
+
+// Load launches the plugin binary at path and returns it as a Protocol
+func Load(path string, config map[string]interface{}) (protocols.Protocol, error) {
+	client := goplugin.NewClient(&goplugin.ClientConfig{
+		HandshakeConfig:  plugin.Handshake,
+		VersionedPlugins: plugin.PluginSets(nil),
+		Cmd:              exec.Command(path),
+		AllowedProtocols: []goplugin.Protocol{goplugin.ProtocolNetRPC},
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Name:   "plugin",
+			Output: os.Stderr,
+			Level:  hclog.Warn,
+		}),
+	})
+
+	rpcClient, err := client.Client()
+	if err != nil {
+		client.Kill()
+		return nil, fmt.Errorf("failed to start plugin %s: %w", path, err)
+	}
+
+	raw, err := rpcClient.Dispense(plugin.PluginName)
+	if err != nil {
+		client.Kill()
+		return nil, fmt.Errorf("failed to dispense plugin %s: %w", path, err)
+	}
+
+	remote := &Protocol{
+		client: client,
+		remote: raw.(*plugin.RPCClient),
+	}
+
+	if config != nil {
+		if err := remote.ValidateConfig(config); err != nil {
+			remote.Close()
+			return nil, fmt.Errorf("plugin %s rejected configuration: %w", path, err)
+		}
+	}
+
+	return remote, nil
+}
+
+// Protocol adapts a plugin RPC client to the protocols.Protocol interface
+type Protocol struct {
+	client *goplugin.Client
+	remote *plugin.RPCClient
+}
+
+// Name returns the protocol name
+func (p *Protocol) Name() string {
+	return p.remote.Name()
+}
+
+// Version returns the protocol version
+func (p *Protocol) Version() string {
+	return p.remote.Version()
+}
+
+// Execute performs a request through the plugin, returning a transport
+// error as soon as ctx is done, such as when the test is stopped
+func (p *Protocol) Execute(ctx context.Context, req *protocols.Request) (*protocols.Response, error) {
+	start := time.Now()
+
+	timeout := req.Timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); timeout == 0 || remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	queryParams := make(map[string]string, len(req.QueryParams))
+	for key, value := range req.QueryParams {
+		queryParams[key] = fmt.Sprintf("%v", value)
+	}
+
+	result, err := p.remote.ExecuteContext(ctx, &plugin.Request{
+		Method:      req.Method,
+		URL:         req.URL,
+		Headers:     req.Headers,
+		Body:        req.Body,
+		Timeout:     timeout,
+		QueryParams: queryParams,
+	})
+	if err != nil {
+		return &protocols.Response{
+			Headers:      make(map[string]string),
+			Body:         []byte{},
+			ResponseTime: time.Since(start),
+			Error:        err,
+		}, nil
+	}
+
+	resp := &protocols.Response{
+		StatusCode:    result.StatusCode,
+		Headers:       result.Headers,
+		Body:          result.Body,
+		ResponseTime:  result.ResponseTime,
+		ContentLength: result.ContentLength,
+	}
+	if resp.Headers == nil {
+		resp.Headers = make(map[string]string)
+	}
+	if resp.ResponseTime == 0 {
+		resp.ResponseTime = time.Since(start)
+	}
+	if result.Error != "" {
+		resp.Error = fmt.Errorf("%s", result.Error)
+	}
+
+	return resp, nil
+}
+
+// ValidateConfig validates protocol-specific configuration
+func (p *Protocol) ValidateConfig(config map[string]interface{}) error {
+	return p.remote.ValidateConfig(config)
+}
+
+// GetMetrics returns plugin metrics
+func (p *Protocol) GetMetrics() map[string]interface{} {
+	return p.remote.GetMetrics()
+}
+
+// Close releases plugin resources and stops the plugin process
+func (p *Protocol) Close() error {
+	err := p.remote.Close()
+	p.client.Kill()
+	return err
+}
@@ -0,0 +1,59 @@
+package protocols
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Factory creates a protocol instance from protocol-specific configuration
+type Factory func(config map[string]interface{}) (Protocol, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a protocol available under name. Registering the same name
+// twice replaces the previous factory.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(name)] = factory
+}
+
+// Registered reports whether a protocol is registered under name
+func Registered(name string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	_, exists := registry[strings.ToLower(name)]
+	return exists
+}
+
+// New creates a protocol registered under name
+func New(name string, config map[string]interface{}) (Protocol, error) {
+	registryMu.RLock()
+	factory, exists := registry[strings.ToLower(name)]
+	registryMu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("protocol not supported: %s (available: %s)", name, strings.Join(Names(), ", "))
+	}
+
+	return factory(config)
+}
+
+// Names returns the registered protocol names in alphabetical order
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
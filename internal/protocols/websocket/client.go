@@ -0,0 +1,448 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/gorilla/websocket"
+)
+
+// Protocol is the name scenarios select WebSocket with
+const Protocol = "websocket"
+
+func init() {
+	protocols.Register(Protocol, func(config map[string]interface{}) (protocols.Protocol, error) {
+		return NewClient(config)
+	})
+}
+
+// MaxMessageSize caps a reply, as the HTTP client caps decompressed bodies,
+// so a misbehaving server cannot exhaust the memory of the generator; a
+// larger reply is a transport error and closes the connection
+const MaxMessageSize = 64 << 20
+
+// Encodings of binary messages in request and response bodies
+const (
+	EncodingBase64 = "base64"
+	EncodingHex    = "hex"
+)
+
+// Config holds the WebSocket settings of a scenario, read from its
+// protocol_config
+type Config struct {
+	// Binary sends bodies, decoded from this encoding, as binary messages
+	// and encodes binary replies with it; bodies are text messages otherwise
+	Binary string
+	// Echo expects every reply to repeat the frame sent, bytes and type;
+	// other replies fail validation
+	Echo bool
+	// Subprotocols are offered in the handshake
+	Subprotocols []string
+	// TLSSkipVerify accepts any server certificate
+	TLSSkipVerify bool
+}
+
+// ParseConfig reads the protocol_config of a WebSocket scenario:
+//
+//	binary           base64 or hex: bodies are binary messages so encoded
+//	echo             check that every reply repeats the frame sent
+//	subprotocols     subprotocols offered in the handshake
+//	tls_skip_verify  accept any server certificate
+func ParseConfig(config map[string]interface{}) (*Config, error) {
+	parsed := &Config{}
+	for key, value := range config {
+		switch key {
+		case "binary":
+			encoding, ok := value.(string)
+			if !ok || (encoding != EncodingBase64 && encoding != EncodingHex) {
+				return nil, fmt.Errorf("invalid WebSocket setting binary: expected %s or %s, got %v", EncodingBase64, EncodingHex, value)
+			}
+			parsed.Binary = encoding
+		case "echo":
+			echo, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("invalid WebSocket setting echo: expected true or false, got %v", value)
+			}
+			parsed.Echo = echo
+		case "subprotocols":
+			list, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid WebSocket setting subprotocols: expected a list, got %v", value)
+			}
+			for _, item := range list {
+				subprotocol, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("invalid WebSocket setting subprotocols: expected strings, got %v", item)
+				}
+				parsed.Subprotocols = append(parsed.Subprotocols, subprotocol)
+			}
+		case "tls_skip_verify":
+			skip, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("invalid WebSocket setting tls_skip_verify: expected true or false, got %v", value)
+			}
+			parsed.TLSSkipVerify = skip
+		default:
+			return nil, fmt.Errorf("unknown WebSocket setting %q", key)
+		}
+	}
+	return parsed, nil
+}
+
+// Client implements the Protocol interface for WebSocket. Each request is a
+// round trip on the connection to its URL (ws:// or wss://), opened by the
+// first request with its headers: the body is sent as a message, then the
+// next message received is the response. A request without a body only
+// waits for the next message, such as one the server pushes.
+//
+// A client holds the connections of one virtual user, see PerVU.
+type Client struct {
+	config *Config
+	dialer *websocket.Dialer
+
+	mu       sync.Mutex
+	sessions map[string]*session
+
+	connections     int64
+	requests        int64
+	failed          int64
+	transportErrors int64
+	mismatches      int64
+}
+
+// session is an open connection and its handshake response headers
+type session struct {
+	conn    *websocket.Conn
+	headers map[string]string
+}
+
+// NewClient creates a WebSocket client from the protocol_config of a
+// scenario; connections are opened on first use
+func NewClient(config map[string]interface{}) (*Client, error) {
+	parsed, err := ParseConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		config: parsed,
+		dialer: &websocket.Dialer{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: parsed.TLSSkipVerify},
+			Subprotocols:    parsed.Subprotocols,
+		},
+		sessions: make(map[string]*session),
+	}, nil
+}
+
+// Name returns the protocol name
+func (c *Client) Name() string {
+	return "WebSocket"
+}
+
+// Version returns the protocol version
+func (c *Client) Version() string {
+	return "13"
+}
+
+// PerVU reports that every VU needs its own connections
+func (c *Client) PerVU() bool {
+	return true
+}
+
+// Execute performs a round trip. Its response time excludes the handshake
+// of a new connection; a handshake the server refuses is answered with the
+// HTTP status it returned. Any other failure is a transport error and
+// closes the connection, so a late reply is never taken for the next one.
+func (c *Client) Execute(ctx context.Context, req *protocols.Request) (*protocols.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	resp := c.roundTrip(ctx, req)
+
+	atomic.AddInt64(&c.requests, 1)
+	if resp.Failed() {
+		atomic.AddInt64(&c.failed, 1)
+	}
+	if resp.TransportError() {
+		atomic.AddInt64(&c.transportErrors, 1)
+	}
+	if resp.FailedCheck != "" {
+		atomic.AddInt64(&c.mismatches, 1)
+	}
+	return resp, nil
+}
+
+// roundTrip sends the message of req and reads the reply. The caller must
+// hold the lock.
+func (c *Client) roundTrip(ctx context.Context, req *protocols.Request) *protocols.Response {
+	messageType, message, err := c.encode(req.Body)
+	if err != nil {
+		return errorResponse(err, 0)
+	}
+
+	target, err := requestURL(req)
+	if err != nil {
+		return errorResponse(err, 0)
+	}
+
+	deadline := time.Time{}
+	if req.Timeout > 0 {
+		deadline = time.Now().Add(req.Timeout)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+		deadline = ctxDeadline
+	}
+
+	s, refused := c.session(ctx, target, req.Headers, deadline)
+	if refused != nil {
+		return refused
+	}
+
+	// Unblock the round trip when the request is cancelled
+	conn := s.conn
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	conn.SetWriteDeadline(deadline)
+	conn.SetReadDeadline(deadline)
+
+	start := time.Now()
+	if len(message) > 0 {
+		if err := conn.WriteMessage(messageType, message); err != nil {
+			c.closeSession(target)
+			return errorResponse(fmt.Errorf("failed to send message: %w", err), time.Since(start))
+		}
+	}
+	replyType, reply, err := conn.ReadMessage()
+	responseTime := time.Since(start)
+	if err != nil {
+		c.closeSession(target)
+		return errorResponse(fmt.Errorf("failed to receive message: %w", err), responseTime)
+	}
+
+	body := reply
+	if replyType == websocket.BinaryMessage {
+		body = c.encodeReply(reply)
+	}
+	headers := make(map[string]string, len(s.headers))
+	for key, value := range s.headers {
+		headers[key] = value
+	}
+
+	resp := &protocols.Response{
+		StatusCode:    http.StatusSwitchingProtocols,
+		Headers:       headers,
+		Body:          body,
+		ResponseTime:  responseTime,
+		ContentLength: int64(len(reply)),
+	}
+	if c.config.Echo && len(message) > 0 {
+		if err := checkEcho(messageType, message, replyType, reply); err != nil {
+			resp.FailedCheck, resp.CheckError = EchoCheck, err
+		}
+	}
+	return resp
+}
+
+// EchoCheck is the validation error type of replies that do not repeat
+// the frame sent
+const EchoCheck = "echo"
+
+// checkEcho compares a reply with the frame it should repeat
+func checkEcho(sentType int, sent []byte, replyType int, reply []byte) error {
+	if replyType != sentType {
+		return fmt.Errorf("sent a %s frame, received a %s frame", frameType(sentType), frameType(replyType))
+	}
+	if !bytes.Equal(reply, sent) {
+		return fmt.Errorf("reply of %d bytes differs from the %d-byte frame sent", len(reply), len(sent))
+	}
+	return nil
+}
+
+// frameType names the type of a data frame
+func frameType(messageType int) string {
+	if messageType == websocket.BinaryMessage {
+		return "binary"
+	}
+	return "text"
+}
+
+// session returns the connection to target, opening it with headers when
+// needed, or the response to a failed handshake. The caller must hold the
+// lock.
+func (c *Client) session(ctx context.Context, target string, headers map[string]string, deadline time.Time) (*session, *protocols.Response) {
+	if s, exists := c.sessions[target]; exists {
+		return s, nil
+	}
+
+	header := make(http.Header, len(headers))
+	for key, value := range headers {
+		// The handshake has no body; a body content type is the message's
+		if !strings.EqualFold(key, "Content-Type") {
+			header.Set(key, value)
+		}
+	}
+
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	start := time.Now()
+	conn, httpResp, err := c.dialer.DialContext(ctx, target, header)
+	if err != nil {
+		// A refused handshake is the server's answer, like an HTTP error
+		if httpResp != nil && httpResp.StatusCode >= 400 {
+			defer httpResp.Body.Close()
+			body, _ := io.ReadAll(io.LimitReader(httpResp.Body, 64*1024))
+			return nil, &protocols.Response{
+				StatusCode:    httpResp.StatusCode,
+				Headers:       responseHeaders(httpResp.Header),
+				Body:          body,
+				ResponseTime:  time.Since(start),
+				ContentLength: int64(len(body)),
+			}
+		}
+		return nil, errorResponse(fmt.Errorf("websocket handshake failed: %w", err), time.Since(start))
+	}
+	conn.SetReadLimit(MaxMessageSize)
+	atomic.AddInt64(&c.connections, 1)
+
+	s := &session{conn: conn, headers: responseHeaders(httpResp.Header)}
+	c.sessions[target] = s
+	return s, nil
+}
+
+// closeSession closes the connection to target, if open. The caller must
+// hold the lock.
+func (c *Client) closeSession(target string) error {
+	s, exists := c.sessions[target]
+	if !exists {
+		return nil
+	}
+	delete(c.sessions, target)
+
+	// Say goodbye, without waiting for the server to answer
+	s.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return s.conn.Close()
+}
+
+// encode returns the message a request body is sent as
+func (c *Client) encode(body []byte) (int, []byte, error) {
+	switch c.config.Binary {
+	case EncodingBase64:
+		message, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(body)))
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid base64 message: %w", err)
+		}
+		return websocket.BinaryMessage, message, nil
+	case EncodingHex:
+		message, err := hex.DecodeString(strings.TrimSpace(string(body)))
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid hex message: %w", err)
+		}
+		return websocket.BinaryMessage, message, nil
+	default:
+		return websocket.TextMessage, body, nil
+	}
+}
+
+// encodeReply returns the body of a binary reply, in the binary encoding
+// of the scenario
+func (c *Client) encodeReply(reply []byte) []byte {
+	switch c.config.Binary {
+	case EncodingBase64:
+		return []byte(base64.StdEncoding.EncodeToString(reply))
+	case EncodingHex:
+		return []byte(hex.EncodeToString(reply))
+	default:
+		return reply
+	}
+}
+
+// requestURL returns the URL of a request with its query parameters
+func requestURL(req *protocols.Request) (string, error) {
+	if len(req.QueryParams) == 0 {
+		return req.URL, nil
+	}
+
+	target, err := url.Parse(req.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid WebSocket URL: %w", err)
+	}
+	query := target.Query()
+	for key, value := range req.QueryParams {
+		query.Set(key, fmt.Sprint(value))
+	}
+	target.RawQuery = query.Encode()
+	return target.String(), nil
+}
+
+// ValidateConfig validates protocol-specific configuration
+func (c *Client) ValidateConfig(config map[string]interface{}) error {
+	_, err := ParseConfig(config)
+	return err
+}
+
+// GetMetrics returns WebSocket-specific metrics
+func (c *Client) GetMetrics() map[string]interface{} {
+	requests := atomic.LoadInt64(&c.requests)
+	failed := atomic.LoadInt64(&c.failed)
+	return map[string]interface{}{
+		"total_requests":      requests,
+		"successful_requests": requests - failed,
+		"failed_requests":     failed,
+		"transport_errors":    atomic.LoadInt64(&c.transportErrors),
+		"echo_mismatches":     atomic.LoadInt64(&c.mismatches),
+		"connections":         atomic.LoadInt64(&c.connections),
+	}
+}
+
+// Close closes every connection
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for target := range c.sessions {
+		if err := c.closeSession(target); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// responseHeaders keeps the first value of each header
+func responseHeaders(headers http.Header) map[string]string {
+	result := make(map[string]string, len(headers))
+	for key, values := range headers {
+		if len(values) > 0 {
+			result[key] = values[0]
+		}
+	}
+	return result
+}
+
+// errorResponse creates the response of a round trip that got no answer
+func errorResponse(err error, responseTime time.Duration) *protocols.Response {
+	return &protocols.Response{
+		Headers:      make(map[string]string),
+		Body:         []byte{},
+		ResponseTime: responseTime,
+		Error:        err,
+	}
+}
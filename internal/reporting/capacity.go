@@ -0,0 +1,130 @@
+package reporting
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+)
+
+// Capacity estimate statuses
+const (
+	// CapacityInterpolated means the goal was crossed between two stages
+	CapacityInterpolated = "interpolated"
+	// CapacityNotReached means every stage met the goal, so the target
+	// sustains at least the highest rate tested
+	CapacityNotReached = "not_reached"
+	// CapacityExceeded means even the lowest rate tested missed the goal
+	CapacityExceeded = "exceeded"
+)
+
+// ReportCapacity answers how much load the target sustains under a latency
+// goal, from the rate and latency of each stage. MaxRPS is interpolated
+// linearly between the last stage meeting the goal and the first missing
+// it, in order of rate; Below and Above describe those stages.
+type ReportCapacity struct {
+	Goal       string         `json:"goal"`
+	Percentile float64        `json:"percentile"`
+	Max        string         `json:"max"`
+	Status     string         `json:"status"`
+	MaxRPS     float64        `json:"max_rps,omitempty"`
+	Below      *CapacityPoint `json:"below,omitempty"`
+	Above      *CapacityPoint `json:"above,omitempty"`
+}
+
+// CapacityPoint is the rate and latency percentile of a stage
+type CapacityPoint struct {
+	Stage             int     `json:"stage"`
+	Name              string  `json:"name,omitempty"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Latency           string  `json:"latency"`
+	latency           time.Duration
+}
+
+// EstimateCapacity estimates the rate sustainable under each goal from the
+// stages of a report. Stages without requests or a histogram are ignored,
+// and at least two are needed for the rate to vary.
+func EstimateCapacity(stages []ReportStage, goals []config.LatencyObjective) []ReportCapacity {
+	if len(goals) == 0 {
+		return nil
+	}
+
+	var measured []ReportStage
+	for _, stage := range stages {
+		if stage.RequestsPerSecond > 0 && stage.Histogram != nil && stage.Histogram.Count > 0 {
+			measured = append(measured, stage)
+		}
+	}
+	if len(measured) < 2 {
+		return nil
+	}
+	sort.SliceStable(measured, func(i, j int) bool { return measured[i].RequestsPerSecond < measured[j].RequestsPerSecond })
+
+	histograms := make([]*metrics.Histogram, len(measured))
+	for i, stage := range measured {
+		histograms[i] = metrics.NewHistogramFromSnapshot(stage.Histogram)
+	}
+
+	estimates := make([]ReportCapacity, 0, len(goals))
+	for _, goal := range goals {
+		limit, err := time.ParseDuration(goal.Max)
+		if err != nil {
+			continue
+		}
+		percentile := strconv.FormatFloat(goal.Percentile, 'f', -1, 64)
+		estimate := ReportCapacity{
+			Goal:       fmt.Sprintf("p%s <= %s", percentile, goal.Max),
+			Percentile: goal.Percentile,
+			Max:        goal.Max,
+		}
+
+		points := make([]CapacityPoint, len(measured))
+		for i, stage := range measured {
+			latency := histograms[i].Percentile(goal.Percentile)
+			points[i] = CapacityPoint{Stage: stage.Stage, Name: stage.Name, RequestsPerSecond: stage.RequestsPerSecond,
+				Latency: latency.String(), latency: latency}
+		}
+
+		// The first stage missing the goal, in order of rate, bounds it
+		crossed := 0
+		for crossed < len(points) && points[crossed].latency <= limit {
+			crossed++
+		}
+
+		switch crossed {
+		case 0:
+			estimate.Status = CapacityExceeded
+			estimate.Above = &points[0]
+		case len(points):
+			estimate.Status = CapacityNotReached
+			estimate.MaxRPS = roundRate(points[crossed-1].RequestsPerSecond)
+			estimate.Below = &points[crossed-1]
+		default:
+			below, above := points[crossed-1], points[crossed]
+			estimate.Status = CapacityInterpolated
+			estimate.MaxRPS = roundRate(interpolateRate(below, above, limit))
+			estimate.Below, estimate.Above = &below, &above
+		}
+		estimates = append(estimates, estimate)
+	}
+	return estimates
+}
+
+// interpolateRate returns the rate at which latency reaches limit on the
+// line between two stages
+func interpolateRate(below, above CapacityPoint, limit time.Duration) float64 {
+	if above.latency <= below.latency {
+		return below.RequestsPerSecond
+	}
+	share := float64(limit-below.latency) / float64(above.latency-below.latency)
+	return below.RequestsPerSecond + share*(above.RequestsPerSecond-below.RequestsPerSecond)
+}
+
+// roundRate rounds a rate to two decimals
+func roundRate(rate float64) float64 {
+	return math.Round(rate*100) / 100
+}
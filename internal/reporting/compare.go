@@ -0,0 +1,84 @@
+package reporting
+
+import (
+	"fmt"
+	"time"
+)
+
+// Comparison is one metric of a baseline report next to a candidate
+type Comparison struct {
+	Metric    string
+	Baseline  string
+	Candidate string
+	Delta     string
+}
+
+// CompareReports lines up the headline metrics of two reports, typically a
+// run of a legacy tool against a GoTsunami run of the same test. Latency
+// deltas are relative; metrics missing from either report show as n/a.
+func CompareReports(baseline, candidate *Report) []Comparison {
+	rows := []Comparison{
+		{
+			Metric:    "Requests",
+			Baseline:  fmt.Sprintf("%d", baseline.Summary.TotalRequests),
+			Candidate: fmt.Sprintf("%d", candidate.Summary.TotalRequests),
+			Delta:     relativeDelta(float64(baseline.Summary.TotalRequests), float64(candidate.Summary.TotalRequests)),
+		},
+		{
+			Metric:    "Success rate",
+			Baseline:  fmt.Sprintf("%.2f%%", baseline.Summary.SuccessRate),
+			Candidate: fmt.Sprintf("%.2f%%", candidate.Summary.SuccessRate),
+			Delta:     fmt.Sprintf("%+.2fpp", candidate.Summary.SuccessRate-baseline.Summary.SuccessRate),
+		},
+		{
+			Metric:    "Requests/sec",
+			Baseline:  fmt.Sprintf("%.2f", baseline.Throughput.RequestsPerSecond),
+			Candidate: fmt.Sprintf("%.2f", candidate.Throughput.RequestsPerSecond),
+			Delta:     relativeDelta(baseline.Throughput.RequestsPerSecond, candidate.Throughput.RequestsPerSecond),
+		},
+	}
+
+	latencies := []struct {
+		metric              string
+		baseline, candidate string
+	}{
+		{"Latency mean", baseline.Latency.Mean, candidate.Latency.Mean},
+		{"Latency p50", baseline.Latency.Median, candidate.Latency.Median},
+		{"Latency p90", baseline.Latency.P90, candidate.Latency.P90},
+		{"Latency p95", baseline.Latency.P95, candidate.Latency.P95},
+		{"Latency p99", baseline.Latency.P99, candidate.Latency.P99},
+		{"Latency max", baseline.Latency.Max, candidate.Latency.Max},
+	}
+	for _, latency := range latencies {
+		rows = append(rows, compareLatency(latency.metric, latency.baseline, latency.candidate))
+	}
+
+	return rows
+}
+
+// compareLatency compares two latencies formatted as durations
+func compareLatency(metric, baseline, candidate string) Comparison {
+	row := Comparison{Metric: metric, Baseline: "n/a", Candidate: "n/a", Delta: "n/a"}
+
+	base, baseErr := time.ParseDuration(baseline)
+	if baseErr == nil {
+		row.Baseline = base.String()
+	}
+	cand, candErr := time.ParseDuration(candidate)
+	if candErr == nil {
+		row.Candidate = cand.String()
+	}
+	if baseErr == nil && candErr == nil {
+		row.Delta = relativeDelta(float64(base), float64(cand))
+	}
+
+	return row
+}
+
+// relativeDelta formats the change from baseline to candidate in percent
+func relativeDelta(baseline, candidate float64) string {
+	if baseline == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", (candidate-baseline)/baseline*100)
+}
@@ -0,0 +1,75 @@
+package reporting
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+)
+
+// CSVReporter generates flat metric,value CSV reports
+type CSVReporter struct {
+	*JSONReporter
+}
+
+// NewCSVReporter creates a new CSV reporter
+func NewCSVReporter(config *config.LoadTestConfig) *CSVReporter {
+	return &CSVReporter{
+		JSONReporter: NewJSONReporter(config),
+	}
+}
+
+// WriteReport writes the report as CSV rows of dotted metric names and values
+func (r *CSVReporter) WriteReport(report *Report, outfile string) error {
+	data, err := reportToMap(report)
+	if err != nil {
+		return err
+	}
+
+	// Raw histogram buckets are not meaningful as flat rows
+	delete(data, "latency_histogram")
+
+	rows := make([][]string, 0)
+	flattenReport("", data, &rows)
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i][0] < rows[j][0]
+	})
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"metric", "value"})
+	writer.WriteAll(rows)
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV report: %w", err)
+	}
+
+	return writeOutput(bytes.TrimRight(buf.Bytes(), "\n"), outfile)
+}
+
+// flattenReport appends one row per leaf value with a dotted key path
+func flattenReport(prefix string, value interface{}, rows *[][]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			flattenReport(joinKey(prefix, key), child, rows)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flattenReport(joinKey(prefix, fmt.Sprintf("%d", i)), child, rows)
+		}
+	case nil:
+		*rows = append(*rows, []string{prefix, ""})
+	default:
+		*rows = append(*rows, []string{prefix, fmt.Sprintf("%v", v)})
+	}
+}
+
+// joinKey joins a key path segment
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
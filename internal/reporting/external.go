@@ -0,0 +1,285 @@
+package reporting
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of reports that can be compared
+const (
+	FormatGoTsunami = "gotsunami"
+	FormatK6        = "k6"
+	FormatWrk       = "wrk"
+)
+
+// LoadAnyReport reads a GoTsunami JSON report, a k6 summary JSON or wrk
+// output, normalized into a Report. An empty format detects it from the
+// content. Imported reports have no latency histograms, so they can be
+// compared but not merged.
+func LoadAnyReport(filename, format string) (*Report, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report file: %w", err)
+	}
+
+	if format == "" {
+		format = DetectReportFormat(data)
+	}
+
+	switch format {
+	case FormatGoTsunami:
+		var report Report
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, fmt.Errorf("failed to parse report JSON: %w", err)
+		}
+		return &report, nil
+	case FormatK6:
+		return ImportK6(data)
+	case FormatWrk:
+		return ImportWrk(data)
+	default:
+		return nil, fmt.Errorf("unsupported report format: %s (use %s, %s or %s)", format, FormatGoTsunami, FormatK6, FormatWrk)
+	}
+}
+
+// DetectReportFormat guesses the tool that produced a report
+func DetectReportFormat(data []byte) string {
+	var probe struct {
+		Metrics  map[string]json.RawMessage `json:"metrics"`
+		Metadata *ReportMetadata            `json:"metadata"`
+	}
+	if json.Unmarshal(data, &probe) == nil {
+		if _, ok := probe.Metrics["http_reqs"]; ok {
+			return FormatK6
+		}
+		if probe.Metadata != nil {
+			return FormatGoTsunami
+		}
+	}
+	if bytes.Contains(data, []byte("Requests/sec:")) {
+		return FormatWrk
+	}
+	return ""
+}
+
+// k6Summary is the JSON written by k6 --summary-export, or the data passed
+// to handleSummary, where metric values are nested under "values"
+type k6Summary struct {
+	Metrics map[string]map[string]json.RawMessage `json:"metrics"`
+	State   struct {
+		TestRunDurationMs float64 `json:"testRunDurationMs"`
+	} `json:"state"`
+}
+
+// value returns a value of a k6 metric
+func (s *k6Summary) value(metric, key string) (float64, bool) {
+	fields, ok := s.Metrics[metric]
+	if !ok {
+		return 0, false
+	}
+	if nested, ok := fields["values"]; ok {
+		var values map[string]float64
+		if json.Unmarshal(nested, &values) != nil {
+			return 0, false
+		}
+		value, ok := values[key]
+		return value, ok
+	}
+
+	var value float64
+	if raw, ok := fields[key]; !ok || json.Unmarshal(raw, &value) != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// ImportK6 normalizes a k6 summary JSON into a Report
+func ImportK6(data []byte) (*Report, error) {
+	var summary k6Summary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, fmt.Errorf("failed to parse k6 summary: %w", err)
+	}
+	if _, ok := summary.Metrics["http_reqs"]; !ok {
+		return nil, fmt.Errorf("k6 summary has no http_reqs metric")
+	}
+
+	report := &Report{Metadata: ReportMetadata{Tool: "k6"}}
+
+	count, _ := summary.value("http_reqs", "count")
+	rate, _ := summary.value("http_reqs", "rate")
+	report.Summary.TotalRequests = int64(count)
+	report.Throughput.RequestsPerSecond = rate
+
+	// http_req_failed is a rate metric: its passes are the failed requests
+	if failed, ok := summary.value("http_req_failed", "passes"); ok {
+		report.Summary.FailedRequests = int64(failed)
+	} else if failedRate, ok := summary.value("http_req_failed", "value"); ok {
+		report.Summary.FailedRequests = int64(math.Round(failedRate * count))
+	} else if failedRate, ok := summary.value("http_req_failed", "rate"); ok {
+		report.Summary.FailedRequests = int64(math.Round(failedRate * count))
+	}
+	report.Summary.SuccessfulRequests = report.Summary.TotalRequests - report.Summary.FailedRequests
+	report.Summary.HTTPErrors = report.Summary.FailedRequests
+
+	if received, ok := summary.value("data_received", "rate"); ok {
+		report.Throughput.BytesPerSecond = received
+	}
+	if vus, ok := summary.value("vus_max", "max"); ok {
+		report.Configuration.VirtualUsers = int(vus)
+	} else if vus, ok := summary.value("vus_max", "value"); ok {
+		report.Configuration.VirtualUsers = int(vus)
+	}
+
+	var duration time.Duration
+	if summary.State.TestRunDurationMs > 0 {
+		duration = time.Duration(summary.State.TestRunDurationMs * float64(time.Millisecond))
+	} else if rate > 0 {
+		duration = time.Duration(count / rate * float64(time.Second))
+	}
+
+	// k6 trends are in milliseconds; p(99) is only there when configured
+	trend := func(key string) string {
+		value, ok := summary.value("http_req_duration", key)
+		if !ok {
+			return ""
+		}
+		return time.Duration(value * float64(time.Millisecond)).String()
+	}
+	report.Latency = ReportLatency{
+		Mean:   trend("avg"),
+		Median: trend("med"),
+		P90:    trend("p(90)"),
+		P95:    trend("p(95)"),
+		P99:    trend("p(99)"),
+		P99_9:  trend("p(99.9)"),
+		Min:    trend("min"),
+		Max:    trend("max"),
+	}
+
+	finishImport(report, duration)
+	return report, nil
+}
+
+// Lines of wrk output
+var (
+	wrkRunning      = regexp.MustCompile(`Running (\S+) test @ (\S+)`)
+	wrkConnections  = regexp.MustCompile(`(\d+) threads and (\d+) connections`)
+	wrkLatency      = regexp.MustCompile(`Latency\s+([\d.]+\S*)\s+(\S+)\s+(\S+)`)
+	wrkPercentile   = regexp.MustCompile(`^\s*([\d.]+)%\s+(\S+)\s*$`)
+	wrkRequests     = regexp.MustCompile(`(\d+) requests in (\S+), (\S+) read`)
+	wrkSocketErrors = regexp.MustCompile(`Socket errors: connect (\d+), read (\d+), write (\d+), timeout (\d+)`)
+	wrkNon2xx       = regexp.MustCompile(`Non-2xx or 3xx responses: (\d+)`)
+	wrkRate         = regexp.MustCompile(`Requests/sec:\s+([\d.]+)`)
+	wrkTransfer     = regexp.MustCompile(`Transfer/sec:\s+(\S+)`)
+)
+
+// ImportWrk normalizes the text output of wrk into a Report. Percentiles
+// other than the mean and max need wrk --latency.
+func ImportWrk(data []byte) (*Report, error) {
+	text := string(data)
+	report := &Report{Metadata: ReportMetadata{Tool: "wrk"}}
+
+	match := wrkRequests.FindStringSubmatch(text)
+	if match == nil {
+		return nil, fmt.Errorf("wrk output has no request count")
+	}
+	report.Summary.TotalRequests, _ = strconv.ParseInt(match[1], 10, 64)
+	duration, err := time.ParseDuration(match[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrk duration: %s", match[2])
+	}
+
+	if match := wrkRunning.FindStringSubmatch(text); match != nil {
+		report.Metadata.Scenario = match[2]
+	}
+	if match := wrkConnections.FindStringSubmatch(text); match != nil {
+		report.Configuration.VirtualUsers, _ = strconv.Atoi(match[2])
+	}
+	if match := wrkSocketErrors.FindStringSubmatch(text); match != nil {
+		for _, count := range match[1:] {
+			errors, _ := strconv.ParseInt(count, 10, 64)
+			report.Summary.TransportErrors += errors
+		}
+	}
+	if match := wrkNon2xx.FindStringSubmatch(text); match != nil {
+		report.Summary.HTTPErrors, _ = strconv.ParseInt(match[1], 10, 64)
+	}
+	report.Summary.FailedRequests = report.Summary.TransportErrors + report.Summary.HTTPErrors
+	report.Summary.SuccessfulRequests = max(report.Summary.TotalRequests-report.Summary.FailedRequests, 0)
+
+	if match := wrkRate.FindStringSubmatch(text); match != nil {
+		report.Throughput.RequestsPerSecond, _ = strconv.ParseFloat(match[1], 64)
+	}
+	if match := wrkTransfer.FindStringSubmatch(text); match != nil {
+		report.Throughput.BytesPerSecond = parseWrkBytes(match[1])
+	}
+
+	if match := wrkLatency.FindStringSubmatch(text); match != nil {
+		report.Latency.Mean = wrkDuration(match[1])
+		report.Latency.Max = wrkDuration(match[3])
+	}
+	for _, line := range strings.Split(text, "\n") {
+		match := wrkPercentile.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		latency := wrkDuration(match[2])
+		switch match[1] {
+		case "50", "50.000":
+			report.Latency.Median = latency
+		case "90", "90.000":
+			report.Latency.P90 = latency
+		case "95", "95.000":
+			report.Latency.P95 = latency
+		case "99", "99.000":
+			report.Latency.P99 = latency
+		case "99.900":
+			report.Latency.P99_9 = latency
+		}
+	}
+
+	finishImport(report, duration)
+	return report, nil
+}
+
+// wrkDuration normalizes a wrk latency such as 635.91us, or returns "" when
+// it cannot be parsed
+func wrkDuration(value string) string {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return ""
+	}
+	return duration.String()
+}
+
+// parseWrkBytes parses a wrk byte count such as 606.33MB (powers of 1024)
+func parseWrkBytes(value string) float64 {
+	units := []string{"TB", "GB", "MB", "KB", "B"}
+	for i, unit := range units {
+		if number, found := strings.CutSuffix(value, unit); found {
+			bytes, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return 0
+			}
+			return bytes * math.Pow(1024, float64(len(units)-1-i))
+		}
+	}
+	return 0
+}
+
+// finishImport fills the fields every imported report derives the same way
+func finishImport(report *Report, duration time.Duration) {
+	report.Metadata.Duration = duration.String()
+	report.Configuration.Duration = duration.String()
+	report.Summary.TotalDuration = duration.String()
+	if report.Summary.TotalRequests > 0 {
+		report.Summary.SuccessRate = float64(report.Summary.SuccessfulRequests) / float64(report.Summary.TotalRequests) * 100
+	}
+}
@@ -0,0 +1,418 @@
+package reporting
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/alexandredias/gotsunami/internal/metrics"
+)
+
+// MinSuccessRate is the success rate (in percent) below which a run fails
+const MinSuccessRate = 95.0
+
+// CheckThresholds returns a description of every threshold the run violated
+func CheckThresholds(summary *metrics.Summary) []string {
+	var failures []string
+
+	if summary.SuccessRate < MinSuccessRate {
+		failures = append(failures, fmt.Sprintf("success rate %.2f%% is below %.2f%%", summary.SuccessRate, MinSuccessRate))
+	}
+
+	failures = append(failures, summary.SLOViolations...)
+
+	if summary.Idempotency != nil && summary.Idempotency.Duplicates > 0 {
+		failures = append(failures, fmt.Sprintf("%d of %d operations checked created duplicate resources despite their idempotency key",
+			summary.Idempotency.Duplicates, summary.Idempotency.Checked))
+	}
+
+	if summary.Consistency != nil && summary.Consistency.Inconsistent > 0 {
+		failures = append(failures, fmt.Sprintf("%d of %d URLs checked returned differing content",
+			summary.Consistency.Inconsistent, summary.Consistency.Checked))
+	}
+
+	for _, hook := range summary.Hooks {
+		if hook.Required && !hook.Success {
+			failures = append(failures, fmt.Sprintf("%s hook %s failed: %s", hook.Event, hook.Name, hook.Error))
+		}
+	}
+
+	return failures
+}
+
+// IsGitHubActions reports whether GoTsunami is running inside a GitHub Actions job
+func IsGitHubActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// GitHubReporter publishes results to the GitHub Actions job summary, as
+// step outputs and as workflow annotations
+type GitHubReporter struct {
+	summaryFile string
+	outputFile  string
+	out         io.Writer
+}
+
+// NewGitHubReporter creates a reporter writing to $GITHUB_STEP_SUMMARY and
+// $GITHUB_OUTPUT. Annotations go to stderr so they never mix with a report
+// written to stdout.
+func NewGitHubReporter() *GitHubReporter {
+	return &GitHubReporter{
+		summaryFile: os.Getenv("GITHUB_STEP_SUMMARY"),
+		outputFile:  os.Getenv("GITHUB_OUTPUT"),
+		out:         os.Stderr,
+	}
+}
+
+// Publish writes the job summary and step outputs, and emits annotations
+// for threshold failures, a saturated generator and clock trouble
+func (r *GitHubReporter) Publish(report *Report, failures []string) error {
+	for _, failure := range failures {
+		fmt.Fprintln(r.out, FormatAnnotation("error", "GoTsunami threshold failed", failure))
+	}
+	if report.Generator != nil && report.Generator.Warning != "" {
+		fmt.Fprintln(r.out, FormatAnnotation("warning", "GoTsunami generator saturated", report.Generator.Warning))
+	}
+	if report.Clock != nil && report.Clock.Warning != "" {
+		fmt.Fprintln(r.out, FormatAnnotation("warning", "GoTsunami clock", report.Clock.Warning))
+	}
+
+	if err := appendFile(r.summaryFile, FormatMarkdownSummary(report, failures)); err != nil {
+		return fmt.Errorf("failed to write GitHub step summary: %w", err)
+	}
+	if err := appendFile(r.outputFile, formatOutputs(report, failures)); err != nil {
+		return fmt.Errorf("failed to write GitHub step outputs: %w", err)
+	}
+
+	return nil
+}
+
+// appendFile appends content to the file at path, if any
+func appendFile(path, content string) error {
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.WriteString(file, content)
+	return err
+}
+
+// formatOutputs renders the step outputs later steps of the job can read
+// as steps.<id>.outputs.<name>
+func formatOutputs(report *Report, failures []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "passed=%t\n", len(failures) == 0)
+	fmt.Fprintf(&b, "total_requests=%d\n", report.Summary.TotalRequests)
+	fmt.Fprintf(&b, "success_rate=%.2f\n", report.Summary.SuccessRate)
+	fmt.Fprintf(&b, "requests_per_second=%.2f\n", report.Throughput.RequestsPerSecond)
+	fmt.Fprintf(&b, "p95=%s\n", report.Latency.P95)
+	fmt.Fprintf(&b, "p99=%s\n", report.Latency.P99)
+	return b.String()
+}
+
+// FormatAnnotation renders a workflow command annotating the run at level,
+// such as error or warning
+func FormatAnnotation(level, title, message string) string {
+	return fmt.Sprintf("::%s title=%s::%s", level, escapeProperty(title), escapeAnnotation(message))
+}
+
+// FormatMarkdownSummary renders the report as a GitHub-flavored markdown summary
+func FormatMarkdownSummary(report *Report, failures []string) string {
+	var b strings.Builder
+
+	status := "✅ Passed"
+	if len(failures) > 0 {
+		status = "❌ Failed"
+	}
+
+	fmt.Fprintf(&b, "## GoTsunami: %s — %s\n\n", report.Metadata.Scenario, status)
+
+	if len(report.Metadata.Labels) > 0 {
+		keys := make([]string, 0, len(report.Metadata.Labels))
+		for key := range report.Metadata.Labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		labels := make([]string, 0, len(keys))
+		for _, key := range keys {
+			labels = append(labels, fmt.Sprintf("`%s=%s`", key, report.Metadata.Labels[key]))
+		}
+		fmt.Fprintf(&b, "%s\n\n", strings.Join(labels, " "))
+	}
+
+	b.WriteString("| Metric | Value |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Virtual users | %d |\n", report.Configuration.VirtualUsers)
+	fmt.Fprintf(&b, "| Duration | %s |\n", report.Configuration.Duration)
+	fmt.Fprintf(&b, "| Pattern | %s |\n", report.Configuration.Pattern)
+	fmt.Fprintf(&b, "| Total requests | %d |\n", report.Summary.TotalRequests)
+	fmt.Fprintf(&b, "| Failed requests | %d |\n", report.Summary.FailedRequests)
+	fmt.Fprintf(&b, "| Transport errors | %d |\n", report.Summary.TransportErrors)
+	fmt.Fprintf(&b, "| HTTP error statuses | %d |\n", report.Summary.HTTPErrors)
+	if report.Summary.NotModified > 0 {
+		fmt.Fprintf(&b, "| Not modified (304) | %d |\n", report.Summary.NotModified)
+	}
+	if report.Summary.DroppedIterations > 0 {
+		fmt.Fprintf(&b, "| Dropped iterations | %d |\n", report.Summary.DroppedIterations)
+	}
+	fmt.Fprintf(&b, "| Success rate | %.2f%% |\n", report.Summary.SuccessRate)
+	fmt.Fprintf(&b, "| Requests/sec | %.2f |\n", report.Throughput.RequestsPerSecond)
+	for _, estimate := range report.Capacity {
+		switch estimate.Status {
+		case CapacityInterpolated:
+			fmt.Fprintf(&b, "| Capacity at %s | ~%.2f req/s |\n", estimate.Goal, estimate.MaxRPS)
+		case CapacityNotReached:
+			fmt.Fprintf(&b, "| Capacity at %s | above %.2f req/s (goal met at every stage) |\n", estimate.Goal, estimate.MaxRPS)
+		case CapacityExceeded:
+			fmt.Fprintf(&b, "| Capacity at %s | below %.2f req/s (goal missed at every stage) |\n", estimate.Goal, estimate.Above.RequestsPerSecond)
+		}
+	}
+	if report.Drain != nil && report.Drain.InFlight > 0 {
+		fmt.Fprintf(&b, "| In flight at end | %d (%d completed, %d abandoned) |\n",
+			report.Drain.InFlight, report.Drain.Completed, report.Drain.Abandoned)
+	}
+	if report.Warmup != nil {
+		state := "stable"
+		if !report.Warmup.Stable {
+			state = "not stable"
+		}
+		fmt.Fprintf(&b, "| Warm-up | %s, %d requests, p95 %s (%s) |\n",
+			report.Warmup.Duration, report.Warmup.Requests, report.Warmup.P95, state)
+	}
+	if report.Throttle != nil && report.Throttle.Responses > 0 {
+		fmt.Fprintf(&b, "| Throttled | %d responses, %s (%.1f%%) |\n",
+			report.Throttle.Responses, report.Throttle.Duration, report.Throttle.Percentage)
+	}
+	if pool := report.ConnectionPool; pool != nil && pool.Dials > 0 {
+		fmt.Fprintf(&b, "| Connections | %d dials (%d failed), peak %d open / %d in use / %d waiting |\n",
+			pool.Dials, pool.DialFailures, pool.PeakOpen, pool.PeakInUse, pool.PeakWaiting)
+		if pool.Waits > 0 {
+			fmt.Fprintf(&b, "| Connection waits | %d, %s in total (max %s) |\n", pool.Waits, pool.WaitTime, pool.MaxWait)
+		}
+	}
+	if generator := report.Generator; generator != nil {
+		state := ""
+		if generator.Warning != "" {
+			state = " ⚠️ saturated"
+		}
+		fmt.Fprintf(&b, "| Generator CPU | %.0f%% average, %.0f%% peak of GOMAXPROCS %d%s |\n",
+			generator.CPUUsage, generator.PeakUsage, generator.GOMAXPROCS, state)
+	}
+	if clock := report.Clock; clock != nil {
+		var parts []string
+		if clock.JumpCount > 0 {
+			parts = append(parts, fmt.Sprintf("%d jumps", clock.JumpCount))
+		}
+		if clock.Drift != "" {
+			parts = append(parts, fmt.Sprintf("drifted %s", clock.Drift))
+		}
+		if clock.StallCount > 0 {
+			parts = append(parts, fmt.Sprintf("%d generator stalls (%s)", clock.StallCount, clock.StalledTime))
+		}
+		fmt.Fprintf(&b, "| Clock | %s |\n", strings.Join(parts, ", "))
+	}
+	if len(report.HTTPVersions) > 0 {
+		fmt.Fprintf(&b, "| HTTP versions | %s |\n", formatHTTPVersions(report.HTTPVersions))
+	}
+	if report.Idempotency != nil {
+		fmt.Fprintf(&b, "| Idempotency duplicates | %d of %d checked (%d retries, %d replays) |\n",
+			report.Idempotency.Duplicates, report.Idempotency.Checked, report.Idempotency.Retries, report.Idempotency.Replays)
+	}
+	if report.Consistency != nil {
+		fmt.Fprintf(&b, "| Inconsistent URLs | %d of %d checked |\n", report.Consistency.Inconsistent, report.Consistency.Checked)
+	}
+	b.WriteString("\n")
+
+	b.WriteString("| Latency | Mean | Median | P90 | P95 | P99 | Max |\n|---|---|---|---|---|---|---|\n")
+	fmt.Fprintf(&b, "| | %s | %s | %s | %s | %s | %s |\n",
+		report.Latency.Mean, report.Latency.Median, report.Latency.P90,
+		report.Latency.P95, report.Latency.P99, report.Latency.Max)
+	if len(report.LatencyByStatus) > 1 {
+		keys := make([]string, 0, len(report.LatencyByStatus))
+		for key := range report.LatencyByStatus {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			latency := report.LatencyByStatus[key]
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s | %s |\n", key,
+				latency.Mean, latency.Median, latency.P90, latency.P95, latency.P99, latency.Max)
+		}
+	}
+	b.WriteString("\n")
+	if report.Latency.P99CI != nil {
+		fmt.Fprintf(&b, "Percentiles from %d samples; 95%% confidence: P95 %s, P99 %s\n\n",
+			report.Latency.Samples, report.Latency.P95CI, report.Latency.P99CI)
+	}
+
+	if len(report.Endpoints) > 0 {
+		endpoints := make([]string, 0, len(report.Endpoints))
+		for endpoint := range report.Endpoints {
+			endpoints = append(endpoints, endpoint)
+		}
+		sort.Strings(endpoints)
+
+		b.WriteString("| Endpoint | Requests | Success rate | Median | P95 | P99 |\n|---|---|---|---|---|---|\n")
+		for _, endpoint := range endpoints {
+			reportEndpoint := report.Endpoints[endpoint]
+			fmt.Fprintf(&b, "| %s | %d | %.2f%% | %s | %s | %s |\n", strings.ReplaceAll(endpoint, "|", "\\|"),
+				reportEndpoint.Requests, reportEndpoint.SuccessRate, reportEndpoint.Latency.Median,
+				reportEndpoint.Latency.P95, reportEndpoint.Latency.P99)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(report.SlowSteps) > 0 {
+		b.WriteString("| Step | Budget | Over budget | P95 | Share of P95 journey |\n|---|---|---|---|---|\n")
+		for _, step := range report.SlowSteps {
+			overBudget := ""
+			if step.Budget != "" {
+				overBudget = fmt.Sprintf("%d (%.2f%%)", step.OverBudget, step.OverBudgetPct)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %.2f%% |\n", strings.ReplaceAll(step.Step, "|", "\\|"),
+				step.Budget, overBudget, step.P95, step.Contribution)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(report.Headers) > 0 {
+		headers := make([]string, 0, len(report.Headers))
+		for header := range report.Headers {
+			headers = append(headers, header)
+		}
+		sort.Strings(headers)
+
+		b.WriteString("| Header | Value | Responses | Share | Success rate | P95 |\n|---|---|---|---|---|---|\n")
+		for _, header := range headers {
+			values := make([]string, 0, len(report.Headers[header]))
+			for value := range report.Headers[header] {
+				values = append(values, value)
+			}
+			// Most frequent values first
+			sort.Slice(values, func(i, j int) bool {
+				first, second := report.Headers[header][values[i]], report.Headers[header][values[j]]
+				if first.Responses != second.Responses {
+					return first.Responses > second.Responses
+				}
+				return values[i] < values[j]
+			})
+
+			for _, value := range values {
+				reportValue := report.Headers[header][value]
+				fmt.Fprintf(&b, "| %s | %s | %d | %.2f%% | %.2f%% | %s |\n", strings.ReplaceAll(header, "|", "\\|"),
+					strings.ReplaceAll(value, "|", "\\|"), reportValue.Responses, reportValue.Percentage,
+					reportValue.SuccessRate, reportValue.Latency.P95)
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	if len(report.Tenants) > 0 {
+		tenants := make([]string, 0, len(report.Tenants))
+		for tenant := range report.Tenants {
+			tenants = append(tenants, tenant)
+		}
+		sort.Strings(tenants)
+
+		b.WriteString("| Tenant | Requests | Success rate | Median | P95 | P99 |\n|---|---|---|---|---|---|\n")
+		for _, tenant := range tenants {
+			reportTenant := report.Tenants[tenant]
+			fmt.Fprintf(&b, "| %s | %d | %.2f%% | %s | %s | %s |\n", strings.ReplaceAll(tenant, "|", "\\|"),
+				reportTenant.Requests, reportTenant.SuccessRate, reportTenant.Latency.Median,
+				reportTenant.Latency.P95, reportTenant.Latency.P99)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(report.Stages) > 0 {
+		b.WriteString("| Stage | Intensity | Requests/sec | Success rate | Median | P95 | P99 |\n|---|---|---|---|---|---|---|\n")
+		for _, stage := range report.Stages {
+			name := fmt.Sprintf("%d", stage.Stage+1)
+			if stage.Name != "" {
+				name += " " + strings.ReplaceAll(stage.Name, "|", "\\|")
+			}
+			fmt.Fprintf(&b, "| %s | %.0f%% | %.2f | %.2f%% | %s | %s | %s |\n", name,
+				stage.Intensity*100, stage.RequestsPerSecond, stage.SuccessRate,
+				stage.Latency.Median, stage.Latency.P95, stage.Latency.P99)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(report.StatusCodes) > 0 {
+		codes := make([]string, 0, len(report.StatusCodes))
+		for code := range report.StatusCodes {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+
+		b.WriteString("| Status code | Count |\n|---|---|\n")
+		for _, code := range codes {
+			fmt.Fprintf(&b, "| %s | %d |\n", code, report.StatusCodes[code])
+		}
+		b.WriteString("\n")
+	}
+
+	if len(report.Errors) > 0 {
+		b.WriteString("| Error | Count | % |\n|---|---|---|\n")
+		for _, reportError := range report.Errors {
+			fmt.Fprintf(&b, "| %s | %d | %.2f%% |\n",
+				strings.ReplaceAll(reportError.Type, "|", "\\|"), reportError.Count, reportError.Percentage)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(failures) > 0 {
+		b.WriteString("**Threshold failures:**\n\n")
+		for _, failure := range failures {
+			fmt.Fprintf(&b, "- %s\n", failure)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// escapeAnnotation escapes characters with special meaning in workflow commands
+func escapeAnnotation(message string) string {
+	message = strings.ReplaceAll(message, "%", "%25")
+	message = strings.ReplaceAll(message, "\r", "%0D")
+	return strings.ReplaceAll(message, "\n", "%0A")
+}
+
+// escapeProperty escapes a property of a workflow command, where : and ,
+// also separate properties
+func escapeProperty(value string) string {
+	value = escapeAnnotation(value)
+	value = strings.ReplaceAll(value, ":", "%3A")
+	return strings.ReplaceAll(value, ",", "%2C")
+}
+
+// formatHTTPVersions lists the responses of each HTTP version, most common
+// first
+func formatHTTPVersions(versions map[string]int64) string {
+	protos := make([]string, 0, len(versions))
+	for proto := range versions {
+		protos = append(protos, proto)
+	}
+	sort.Slice(protos, func(i, j int) bool {
+		if versions[protos[i]] != versions[protos[j]] {
+			return versions[protos[i]] > versions[protos[j]]
+		}
+		return protos[i] < protos[j]
+	})
+
+	parts := make([]string, len(protos))
+	for i, proto := range protos {
+		parts[i] = fmt.Sprintf("%s: %d", proto, versions[proto])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,469 @@
+package reporting
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+)
+
+//go:embed html_report.tmpl
+var htmlReportTemplate string
+
+// htmlTemplate renders HTML reports
+var htmlTemplate = template.Must(template.New("report").Parse(htmlReportTemplate))
+
+// reportPercentiles are the percentiles charted from the latency histogram
+var reportPercentiles = []float64{50, 75, 90, 95, 99, 99.9}
+
+// HTMLReporter generates a single self-contained HTML page: styles and
+// charts are inline, so the file opens offline and can be mailed as is
+type HTMLReporter struct {
+	*JSONReporter
+}
+
+// NewHTMLReporter creates a new HTML reporter
+func NewHTMLReporter(config *config.LoadTestConfig) *HTMLReporter {
+	return &HTMLReporter{
+		JSONReporter: NewJSONReporter(config),
+	}
+}
+
+// WriteReport writes the report as HTML to a file or stdout
+func (r *HTMLReporter) WriteReport(report *Report, outfile string) error {
+	return streamOutput(outfile, func(w io.Writer) error {
+		return WriteHTML(w, report)
+	})
+}
+
+// WriteHTML renders a report as an HTML page
+func WriteHTML(w io.Writer, report *Report) error {
+	if err := htmlTemplate.Execute(w, newHTMLPage(report)); err != nil {
+		return fmt.Errorf("failed to render HTML report: %w", err)
+	}
+	return nil
+}
+
+// htmlPage is what the HTML template renders; charts are nil when the
+// report lacks their data
+type htmlPage struct {
+	*Report
+	Labels          []htmlRow
+	Cards           []htmlCard
+	PercentileChart *svgChart
+	ThroughputChart *svgChart
+	LatencyChart    *svgChart
+	StatusShares    []htmlShare
+	StatusRows      []htmlLatencyRow
+	ErrorRows       []ReportError
+	EndpointRows    []htmlLatencyRow
+}
+
+// htmlRow is a name and value
+type htmlRow struct {
+	Name  string
+	Value string
+}
+
+// htmlCard is a headline figure; Class flags it good or bad
+type htmlCard struct {
+	Label string
+	Value string
+	Class string
+}
+
+// htmlShare is a part of a total, drawn as a bar
+type htmlShare struct {
+	Label      string
+	Count      int64
+	Percentage float64
+	Class      string
+}
+
+// htmlLatencyRow is the latency of a breakdown of the requests
+type htmlLatencyRow struct {
+	Name        string
+	Requests    int64
+	SuccessRate float64
+	Latency     ReportLatency
+}
+
+// newHTMLPage prepares a report for the HTML template
+func newHTMLPage(report *Report) *htmlPage {
+	page := &htmlPage{
+		Report:          report,
+		Cards:           reportCards(report),
+		PercentileChart: percentileChart(report),
+		StatusShares:    statusShares(report.StatusCodes),
+		ErrorRows:       append([]ReportError(nil), report.Errors...),
+	}
+	if report.Series != nil {
+		page.ThroughputChart = throughputChart(report.Series)
+		page.LatencyChart = latencyChart(report.Series)
+	}
+
+	for _, key := range sortedKeys(report.Metadata.Labels) {
+		page.Labels = append(page.Labels, htmlRow{Name: key, Value: report.Metadata.Labels[key]})
+	}
+	sort.SliceStable(page.ErrorRows, func(i, j int) bool { return page.ErrorRows[i].Count > page.ErrorRows[j].Count })
+
+	for _, key := range sortedKeys(report.LatencyByStatus) {
+		page.StatusRows = append(page.StatusRows, htmlLatencyRow{Name: key, Requests: report.LatencyByStatus[key].Samples,
+			Latency: report.LatencyByStatus[key]})
+	}
+	for _, key := range sortedKeys(report.Endpoints) {
+		endpoint := report.Endpoints[key]
+		page.EndpointRows = append(page.EndpointRows, htmlLatencyRow{Name: key, Requests: endpoint.Requests,
+			SuccessRate: endpoint.SuccessRate, Latency: endpoint.Latency})
+	}
+
+	return page
+}
+
+// sortedKeys returns the keys of a string-keyed map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// reportCards picks the headline figures of a report
+func reportCards(report *Report) []htmlCard {
+	success := ""
+	switch {
+	case report.Summary.TotalRequests == 0:
+	case report.Summary.SuccessRate >= 99:
+		success = "good"
+	default:
+		success = "bad"
+	}
+	failed := ""
+	if report.Summary.FailedRequests > 0 {
+		failed = "bad"
+	}
+
+	return []htmlCard{
+		{Label: "Requests", Value: strconv.FormatInt(report.Summary.TotalRequests, 10)},
+		{Label: "Success rate", Value: fmt.Sprintf("%.2f%%", report.Summary.SuccessRate), Class: success},
+		{Label: "Failed", Value: strconv.FormatInt(report.Summary.FailedRequests, 10), Class: failed},
+		{Label: "Requests/sec", Value: fmt.Sprintf("%.2f", report.Throughput.RequestsPerSecond)},
+		{Label: "p50", Value: report.Latency.Median},
+		{Label: "p95", Value: report.Latency.P95},
+		{Label: "p99", Value: report.Latency.P99},
+		{Label: "Duration", Value: report.Summary.TotalDuration},
+	}
+}
+
+// statusShares breaks the responses down by status code, transport errors
+// (status 0) last
+func statusShares(statusCodes map[string]int64) []htmlShare {
+	var total int64
+	for _, count := range statusCodes {
+		total += count
+	}
+	if total == 0 {
+		return nil
+	}
+
+	codes := sortedKeys(statusCodes)
+	sort.SliceStable(codes, func(i, j int) bool { return codes[i] != "0" && codes[j] == "0" })
+
+	shares := make([]htmlShare, 0, len(codes))
+	for _, code := range codes {
+		share := htmlShare{
+			Label:      code,
+			Count:      statusCodes[code],
+			Percentage: float64(statusCodes[code]) / float64(total) * 100,
+		}
+		switch {
+		case code == "0":
+			share.Label, share.Class = "transport error", "bad"
+		case code >= "500":
+			share.Class = "bad"
+		case code >= "400":
+			share.Class = "warn"
+		case code < "300":
+			share.Class = "good"
+		}
+		shares = append(shares, share)
+	}
+	return shares
+}
+
+// percentileChart charts the latency percentiles from the histogram, or from
+// the summary statistics of reports without one
+func percentileChart(report *Report) *svgChart {
+	labels := make([]string, 0, len(reportPercentiles)+1)
+	values := make([]float64, 0, len(reportPercentiles)+1)
+
+	if report.LatencyHistogram != nil && report.LatencyHistogram.Count > 0 {
+		histogram := metrics.NewHistogramFromSnapshot(report.LatencyHistogram)
+		for _, percentile := range reportPercentiles {
+			labels = append(labels, "p"+strconv.FormatFloat(percentile, 'f', -1, 64))
+			values = append(values, millis(histogram.Percentile(percentile)))
+		}
+		labels = append(labels, "max")
+		values = append(values, millis(histogram.Max()))
+	} else {
+		latency := report.Latency
+		for _, stat := range []htmlRow{{"p50", latency.Median}, {"p90", latency.P90}, {"p95", latency.P95},
+			{"p99", latency.P99}, {"p99.9", latency.P99_9}, {"max", latency.Max}} {
+			if d, err := time.ParseDuration(stat.Value); err == nil {
+				labels = append(labels, stat.Name)
+				values = append(values, millis(d))
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+	return barChart(labels, values, formatMillis)
+}
+
+// throughputChart charts the rate of requests and failures over time
+func throughputChart(series *metrics.SeriesSummary) *svgChart {
+	interval, _ := time.ParseDuration(series.Interval)
+	xs := make([]float64, len(series.Points))
+	rates := make([]float64, len(series.Points))
+	failures := make([]float64, len(series.Points))
+	for i, point := range series.Points {
+		xs[i] = point.Offset
+		rates[i] = point.RequestsPerSecond
+		if point.Requests > 0 {
+			failures[i] = point.RequestsPerSecond * float64(point.Failed) / float64(point.Requests)
+		}
+	}
+	if interval > 0 && len(xs) == 1 {
+		// A single point still spans its interval
+		xs = append(xs, xs[0]+interval.Seconds())
+		rates = append(rates, rates[0])
+		failures = append(failures, failures[0])
+	}
+
+	return lineChart(xs, []chartSeries{
+		{Name: "requests/s", Class: "line-rps", Values: rates},
+		{Name: "failed/s", Class: "line-failed", Values: failures},
+	}, formatRate)
+}
+
+// latencyChart charts the latency percentiles over time, leaving out
+// intervals without requests
+func latencyChart(series *metrics.SeriesSummary) *svgChart {
+	var xs, p50, p95, p99 []float64
+	for _, point := range series.Points {
+		if point.Requests == 0 {
+			continue
+		}
+		xs = append(xs, point.Offset)
+		p50 = append(p50, point.P50)
+		p95 = append(p95, point.P95)
+		p99 = append(p99, point.P99)
+	}
+	if len(xs) < 2 {
+		return nil
+	}
+
+	return lineChart(xs, []chartSeries{
+		{Name: "p50", Class: "line-p50", Values: p50},
+		{Name: "p95", Class: "line-p95", Values: p95},
+		{Name: "p99", Class: "line-p99", Values: p99},
+	}, formatMillis)
+}
+
+// Chart geometry, in SVG units
+const (
+	chartWidth  = 760
+	chartHeight = 260
+	chartLeft   = 64
+	chartRight  = 16
+	chartTop    = 16
+	chartBottom = 36
+	chartYTicks = 5
+	chartXTicks = 8
+)
+
+// svgChart is a chart laid out for the HTML template
+type svgChart struct {
+	Width, Height            float64
+	Left, Top, Right, Bottom float64
+	XTicks, YTicks           []svgTick
+	Lines                    []svgLine
+	Bars                     []svgBar
+}
+
+// svgTick is an axis label at a position along the axis
+type svgTick struct {
+	Pos   float64
+	Label string
+}
+
+// svgLine is a series drawn as a polyline
+type svgLine struct {
+	Name   string
+	Class  string
+	Points string
+}
+
+// svgBar is a labelled bar
+type svgBar struct {
+	X, Y, Width, Height float64
+	Label               string
+	Value               string
+}
+
+// Center is the offset of the middle of the bar from its left edge
+func (b svgBar) Center() float64 {
+	return round2(b.Width / 2)
+}
+
+// chartSeries is a named series of values for lineChart
+type chartSeries struct {
+	Name   string
+	Class  string
+	Values []float64
+}
+
+// newSVGChart creates an empty chart of the default size
+func newSVGChart() *svgChart {
+	return &svgChart{
+		Width: chartWidth, Height: chartHeight,
+		Left: chartLeft, Top: chartTop, Right: chartWidth - chartRight, Bottom: chartHeight - chartBottom,
+	}
+}
+
+// yTicks labels the value axis up to max, returning the scaled maximum
+func (c *svgChart) yTicks(max float64, format func(float64) string) float64 {
+	max = niceCeil(max)
+	for i := 0; i <= chartYTicks; i++ {
+		value := max * float64(i) / chartYTicks
+		c.YTicks = append(c.YTicks, svgTick{Pos: c.y(value, max), Label: format(value)})
+	}
+	return max
+}
+
+// y returns the vertical position of value on an axis up to max
+func (c *svgChart) y(value, max float64) float64 {
+	return round2(c.Bottom - value/max*(c.Bottom-c.Top))
+}
+
+// lineChart lays out series of values over the offsets xs, in seconds
+func lineChart(xs []float64, series []chartSeries, format func(float64) string) *svgChart {
+	if len(xs) == 0 {
+		return nil
+	}
+
+	c := newSVGChart()
+	var maxY float64
+	for _, s := range series {
+		maxY = math.Max(maxY, maxValue(s.Values))
+	}
+	maxY = c.yTicks(maxY, format)
+
+	minX, maxX := xs[0], xs[len(xs)-1]
+	if maxX <= minX {
+		maxX = minX + 1
+	}
+	x := func(value float64) float64 {
+		return round2(c.Left + (value-minX)/(maxX-minX)*(c.Right-c.Left))
+	}
+	for i := 0; i <= chartXTicks; i++ {
+		value := minX + (maxX-minX)*float64(i)/chartXTicks
+		c.XTicks = append(c.XTicks, svgTick{Pos: x(value), Label: formatOffset(value)})
+	}
+
+	for _, s := range series {
+		points := make([]string, len(xs))
+		for i := range xs {
+			points[i] = fmt.Sprintf("%g,%g", x(xs[i]), c.y(s.Values[i], maxY))
+		}
+		c.Lines = append(c.Lines, svgLine{Name: s.Name, Class: s.Class, Points: strings.Join(points, " ")})
+	}
+	return c
+}
+
+// barChart lays out one bar per value
+func barChart(labels []string, values []float64, format func(float64) string) *svgChart {
+	c := newSVGChart()
+	maxY := c.yTicks(maxValue(values), format)
+
+	slot := (c.Right - c.Left) / float64(len(values))
+	for i, value := range values {
+		top := c.y(value, maxY)
+		c.Bars = append(c.Bars, svgBar{
+			X:      round2(c.Left + slot*float64(i) + slot*0.15),
+			Y:      top,
+			Width:  round2(slot * 0.7),
+			Height: round2(c.Bottom - top),
+			Label:  labels[i],
+			Value:  format(value),
+		})
+		c.XTicks = append(c.XTicks, svgTick{Pos: round2(c.Left + slot*(float64(i)+0.5)), Label: labels[i]})
+	}
+	return c
+}
+
+// niceCeil rounds a positive maximum up to 1, 2 or 5 times a power of ten,
+// or 1 when there is none
+func niceCeil(value float64) float64 {
+	if value <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(value)))
+	for _, step := range []float64{1, 2, 5, 10} {
+		if value <= step*magnitude {
+			return step * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// round2 rounds an SVG coordinate to two decimals
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// millis converts a duration to fractional milliseconds
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// formatMillis formats milliseconds as a duration of three significant
+// digits or so
+func formatMillis(value float64) string {
+	d := time.Duration(value * float64(time.Millisecond))
+	switch {
+	case d >= 10*time.Second:
+		d = d.Round(100 * time.Millisecond)
+	case d >= time.Second:
+		d = d.Round(10 * time.Millisecond)
+	case d >= 10*time.Millisecond:
+		d = d.Round(100 * time.Microsecond)
+	case d >= time.Millisecond:
+		d = d.Round(10 * time.Microsecond)
+	default:
+		d = d.Round(time.Microsecond)
+	}
+	return d.String()
+}
+
+// formatRate formats a rate for an axis
+func formatRate(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1000)/1000, 'f', -1, 64)
+}
+
+// formatOffset formats an offset into the test, in seconds
+func formatOffset(seconds float64) string {
+	return (time.Duration(seconds * float64(time.Second))).Round(time.Second).String()
+}
@@ -3,10 +3,10 @@ package reporting
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/hooks"
 	"github.com/alexandredias/gotsunami/internal/metrics"
 )
 
@@ -31,6 +31,7 @@ func (r *JSONReporter) GenerateReport(summary *metrics.Summary, scenario *config
 			Timestamp: time.Now().UTC().Format(time.RFC3339),
 			Duration:  r.config.Duration.String(),
 			Scenario:  scenario.Name,
+			Labels:    r.config.Labels,
 		},
 		Configuration: ReportConfiguration{
 			VirtualUsers: r.config.VirtualUsers,
@@ -39,46 +40,73 @@ func (r *JSONReporter) GenerateReport(summary *metrics.Summary, scenario *config
 			RampDown:     r.config.RampDown.String(),
 			Delay:        r.config.Delay.String(),
 			Pattern:      r.config.Pattern,
+			Seed:         r.config.Seed,
 		},
 		Summary: ReportSummary{
 			TotalRequests:      summary.TotalRequests,
 			SuccessfulRequests: summary.SuccessfulRequests,
 			FailedRequests:     summary.FailedRequests,
+			TransportErrors:    summary.TransportErrors,
+			HTTPErrors:         summary.HTTPErrors,
+			NotModified:        summary.NotModified,
+			DroppedIterations:  summary.DroppedIterations,
 			SuccessRate:        summary.SuccessRate,
 			TotalDuration:      r.config.Duration.String(),
 		},
-		Latency:           r.formatLatency(summary.Latency),
+		Latency:           formatLatency(summary.Latency),
+		LatencyHistogram:  summary.Histogram,
+		LatencyByStatus:   formatLatencyByStatus(summary.LatencyByStatus),
+		StatusHistograms:  summary.StatusHistograms,
 		Throughput:        r.formatThroughput(summary),
 		Errors:            r.formatErrors(summary.Errors),
 		StatusCodes:       r.formatStatusCodes(summary.StatusCodes),
 		ValidationResults: r.formatValidationResults(summary.ValidationResults),
+		Hooks:             summary.Hooks,
+		Cleanup:           summary.Cleanup,
+		Throttle:          summary.Throttle,
+		Drain:             summary.Drain,
+		Warmup:            summary.Warmup,
+		Idempotency:       summary.Idempotency,
+		Consistency:       summary.Consistency,
+		Annotations:       summary.Annotations,
+		MethodMetrics:     summary.MethodMetrics,
+		Tenants:           formatTenants(summary.Tenants),
+		Stages:            formatStages(summary.Stages),
+		Endpoints:         formatEndpoints(summary.Endpoints),
+		SLOViolations:     summary.SLOViolations,
+		ConnectionPool:    summary.ConnectionPool,
+		HTTPVersions:      summary.HTTPVersions,
+		Generator:         summary.Generator,
+		Clock:             summary.Clock,
+		Headers:           formatHeaders(summary.Headers),
+		Series:            summary.Series,
 	}
 
+	goals := r.config.LatencyGoals
+	if len(goals) == 0 && scenario.SLO != nil {
+		goals = scenario.SLO.Latency
+	}
+	report.Capacity = EstimateCapacity(report.Stages, goals)
+	report.SlowSteps = RankSlowSteps(report.Endpoints, ScenarioStepBudgets(scenario))
+
 	return report, nil
 }
 
-// WriteReport writes the report to a file or stdout
+// WriteReport writes the report to a file or stdout. The report is rendered
+// whole, but its size does not grow with the number of requests: latencies
+// are kept in fixed-size histograms and the time series in at most
+// metrics.MaxSeriesPoints points.
 func (r *JSONReporter) WriteReport(report *Report, outfile string) error {
 	jsonData, err := json.MarshalIndent(report, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal report to JSON: %w", err)
 	}
 
-	if outfile != "" {
-		err = os.WriteFile(outfile, jsonData, 0644)
-		if err != nil {
-			return fmt.Errorf("failed to write report to file: %w", err)
-		}
-		fmt.Printf("Report written to: %s\n", outfile)
-	} else {
-		fmt.Println(string(jsonData))
-	}
-
-	return nil
+	return writeOutput(jsonData, outfile)
 }
 
 // formatLatency formats latency statistics
-func (r *JSONReporter) formatLatency(latency *metrics.LatencyStats) ReportLatency {
+func formatLatency(latency *metrics.LatencyStats) ReportLatency {
 	if latency == nil {
 		return ReportLatency{}
 	}
@@ -92,7 +120,123 @@ func (r *JSONReporter) formatLatency(latency *metrics.LatencyStats) ReportLatenc
 		P99_9:  latency.P99_9.String(),
 		Min:    latency.Min.String(),
 		Max:    latency.Max.String(),
+
+		Samples: latency.Samples,
+		P95CI:   formatInterval(latency.P95CI),
+		P99CI:   formatInterval(latency.P99CI),
+	}
+}
+
+// formatInterval formats the confidence interval of a percentile
+func formatInterval(interval *metrics.PercentileInterval) *ReportInterval {
+	if interval == nil {
+		return nil
+	}
+	return &ReportInterval{Lower: interval.Lower.String(), Upper: interval.Upper.String(), Bounded: interval.Bounded}
+}
+
+// formatLatencyByStatus formats the latency statistics of each status code
+func formatLatencyByStatus(byStatus map[string]*metrics.LatencyStats) map[string]ReportLatency {
+	if len(byStatus) == 0 {
+		return nil
+	}
+
+	formatted := make(map[string]ReportLatency, len(byStatus))
+	for key, latency := range byStatus {
+		formatted[key] = formatLatency(latency)
 	}
+	return formatted
+}
+
+// formatTenants formats the breakdown of requests per tenant
+func formatTenants(tenants map[string]*metrics.TenantSummary) map[string]ReportTenant {
+	if len(tenants) == 0 {
+		return nil
+	}
+
+	formatted := make(map[string]ReportTenant, len(tenants))
+	for tenant, summary := range tenants {
+		formatted[tenant] = ReportTenant{
+			Requests:        summary.Requests,
+			Failed:          summary.Failed,
+			TransportErrors: summary.TransportErrors,
+			HTTPErrors:      summary.HTTPErrors,
+			SuccessRate:     summary.SuccessRate,
+			Latency:         formatLatency(summary.Latency),
+			Histogram:       summary.Histogram,
+		}
+	}
+	return formatted
+}
+
+// formatEndpoints formats the breakdown of requests per logical endpoint
+func formatEndpoints(endpoints map[string]*metrics.EndpointSummary) map[string]ReportEndpoint {
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	formatted := make(map[string]ReportEndpoint, len(endpoints))
+	for endpoint, summary := range endpoints {
+		formatted[endpoint] = ReportEndpoint{
+			Requests:        summary.Requests,
+			Failed:          summary.Failed,
+			TransportErrors: summary.TransportErrors,
+			HTTPErrors:      summary.HTTPErrors,
+			SuccessRate:     summary.SuccessRate,
+			Latency:         formatLatency(summary.Latency),
+			Histogram:       summary.Histogram,
+		}
+	}
+	return formatted
+}
+
+// formatHeaders formats the breakdown of responses per captured header value
+func formatHeaders(headers map[string]map[string]*metrics.HeaderValueSummary) map[string]map[string]ReportHeaderValue {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	formatted := make(map[string]map[string]ReportHeaderValue, len(headers))
+	for header, values := range headers {
+		formatted[header] = make(map[string]ReportHeaderValue, len(values))
+		for value, summary := range values {
+			formatted[header][value] = ReportHeaderValue{
+				Responses:   summary.Responses,
+				Failed:      summary.Failed,
+				Percentage:  summary.Percentage,
+				SuccessRate: summary.SuccessRate,
+				Latency:     formatLatency(summary.Latency),
+				Histogram:   summary.Histogram,
+			}
+		}
+	}
+	return formatted
+}
+
+// formatStages formats the breakdown of requests per load pattern stage
+func formatStages(stages []*metrics.StageSummary) []ReportStage {
+	if len(stages) == 0 {
+		return nil
+	}
+
+	formatted := make([]ReportStage, len(stages))
+	for i, stage := range stages {
+		formatted[i] = ReportStage{
+			Stage:             stage.Stage,
+			Name:              stage.Name,
+			Start:             stage.Start,
+			Duration:          stage.Duration,
+			Intensity:         stage.Intensity,
+			TargetRPS:         stage.TargetRPS,
+			Requests:          stage.Requests,
+			Failed:            stage.Failed,
+			SuccessRate:       stage.SuccessRate,
+			RequestsPerSecond: stage.RequestsPerSecond,
+			Latency:           formatLatency(stage.Latency),
+			Histogram:         stage.Histogram,
+		}
+	}
+	return formatted
 }
 
 // formatThroughput formats throughput statistics
@@ -157,28 +301,58 @@ func (r *JSONReporter) formatValidationResults(results *metrics.ValidationResult
 		ResponseTimeValidation: responseTimeValidation,
 		BodyValidation:         bodyValidation,
 		FailedValidations:      results.FailedValidations,
+		Unsampled:              results.Unsampled,
 	}
 }
 
 // Report represents the complete test report
 type Report struct {
-	Metadata          ReportMetadata          `json:"metadata"`
-	Configuration     ReportConfiguration     `json:"configuration"`
-	Summary           ReportSummary           `json:"summary"`
-	Latency           ReportLatency           `json:"latency"`
-	Throughput        ReportThroughput        `json:"throughput"`
-	Errors            []ReportError           `json:"errors"`
-	StatusCodes       map[string]int64        `json:"status_codes"`
-	ValidationResults ReportValidationResults `json:"validation_results"`
+	Metadata          ReportMetadata                        `json:"metadata"`
+	Configuration     ReportConfiguration                   `json:"configuration"`
+	Summary           ReportSummary                         `json:"summary"`
+	Latency           ReportLatency                         `json:"latency"`
+	LatencyHistogram  *metrics.HistogramSnapshot            `json:"latency_histogram,omitempty"`
+	LatencyByStatus   map[string]ReportLatency              `json:"latency_by_status,omitempty"`
+	StatusHistograms  map[string]*metrics.HistogramSnapshot `json:"latency_histograms_by_status,omitempty"`
+	Throughput        ReportThroughput                      `json:"throughput"`
+	Errors            []ReportError                         `json:"errors"`
+	StatusCodes       map[string]int64                      `json:"status_codes"`
+	ValidationResults ReportValidationResults               `json:"validation_results"`
+	Hooks             []hooks.Result                        `json:"hooks,omitempty"`
+	Cleanup           *metrics.CleanupSummary               `json:"cleanup,omitempty"`
+	Throttle          *metrics.ThrottleSummary              `json:"throttle,omitempty"`
+	Drain             *metrics.DrainSummary                 `json:"drain,omitempty"`
+	Warmup            *metrics.WarmupSummary                `json:"warmup,omitempty"`
+	Idempotency       *metrics.IdempotencySummary           `json:"idempotency,omitempty"`
+	Consistency       *metrics.ConsistencySummary           `json:"consistency,omitempty"`
+	MethodMetrics     *metrics.MethodSummary                `json:"method_metrics,omitempty"`
+	Tenants           map[string]ReportTenant               `json:"tenants,omitempty"`
+	Stages            []ReportStage                         `json:"stages,omitempty"`
+	Capacity          []ReportCapacity                      `json:"capacity,omitempty"`
+	SlowSteps         []ReportSlowStep                      `json:"slow_steps,omitempty"`
+	Endpoints         map[string]ReportEndpoint             `json:"endpoints,omitempty"`
+	SLOViolations     []string                              `json:"slo_violations,omitempty"`
+	Timeline          []ReportPhase                         `json:"timeline,omitempty"`
+	Annotations       []metrics.Annotation                  `json:"annotations,omitempty"`
+	Series            *metrics.SeriesSummary                `json:"series,omitempty"`
+
+	ConnectionPool *metrics.ConnectionPoolSummary `json:"connection_pool,omitempty"`
+	HTTPVersions   map[string]int64               `json:"http_versions,omitempty"`
+	Generator      *metrics.GeneratorSummary      `json:"generator,omitempty"`
+	Clock          *metrics.ClockSummary          `json:"clock,omitempty"`
+
+	Headers map[string]map[string]ReportHeaderValue `json:"headers,omitempty"`
 }
 
 // ReportMetadata contains report metadata
 type ReportMetadata struct {
-	Tool      string `json:"tool"`
-	Version   string `json:"version"`
-	Timestamp string `json:"timestamp"`
-	Duration  string `json:"duration"`
-	Scenario  string `json:"scenario"`
+	Tool      string            `json:"tool"`
+	Version   string            `json:"version"`
+	Timestamp string            `json:"timestamp"`
+	Duration  string            `json:"duration"`
+	Scenario  string            `json:"scenario"`
+	Sources   []string          `json:"sources,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
 }
 
 // ReportConfiguration contains test configuration
@@ -189,6 +363,7 @@ type ReportConfiguration struct {
 	RampDown     string `json:"ramp_down"`
 	Delay        string `json:"delay"`
 	Pattern      string `json:"pattern"`
+	Seed         int64  `json:"seed,omitempty"`
 }
 
 // ReportSummary contains test summary
@@ -196,6 +371,10 @@ type ReportSummary struct {
 	TotalRequests      int64   `json:"total_requests"`
 	SuccessfulRequests int64   `json:"successful_requests"`
 	FailedRequests     int64   `json:"failed_requests"`
+	TransportErrors    int64   `json:"transport_errors"`
+	HTTPErrors         int64   `json:"http_errors"`
+	NotModified        int64   `json:"not_modified,omitempty"`
+	DroppedIterations  int64   `json:"dropped_iterations,omitempty"`
 	SuccessRate        float64 `json:"success_rate"`
 	TotalDuration      string  `json:"total_duration"`
 }
@@ -210,6 +389,79 @@ type ReportLatency struct {
 	P99_9  string `json:"p99.9"`
 	Min    string `json:"min"`
 	Max    string `json:"max"`
+
+	Samples int64           `json:"samples,omitempty"`
+	P95CI   *ReportInterval `json:"p95_ci,omitempty"`
+	P99CI   *ReportInterval `json:"p99_ci,omitempty"`
+}
+
+// ReportInterval is a 95% confidence interval of a percentile; Bounded is
+// false when there were too few samples to bound it
+type ReportInterval struct {
+	Lower   string `json:"lower"`
+	Upper   string `json:"upper"`
+	Bounded bool   `json:"bounded"`
+}
+
+// String formats the interval, marking one left unbounded for lack of samples
+func (i *ReportInterval) String() string {
+	if i == nil {
+		return ""
+	}
+	if !i.Bounded {
+		return fmt.Sprintf("%s to %s (too few samples)", i.Lower, i.Upper)
+	}
+	return fmt.Sprintf("%s to %s", i.Lower, i.Upper)
+}
+
+// ReportTenant contains the requests made on behalf of one tenant
+type ReportTenant struct {
+	Requests        int64                      `json:"requests"`
+	Failed          int64                      `json:"failed"`
+	TransportErrors int64                      `json:"transport_errors"`
+	HTTPErrors      int64                      `json:"http_errors"`
+	SuccessRate     float64                    `json:"success_rate"`
+	Latency         ReportLatency              `json:"latency"`
+	Histogram       *metrics.HistogramSnapshot `json:"histogram,omitempty"`
+}
+
+// ReportEndpoint contains the requests to one logical endpoint
+type ReportEndpoint struct {
+	Requests        int64                      `json:"requests"`
+	Failed          int64                      `json:"failed"`
+	TransportErrors int64                      `json:"transport_errors"`
+	HTTPErrors      int64                      `json:"http_errors"`
+	SuccessRate     float64                    `json:"success_rate"`
+	Latency         ReportLatency              `json:"latency"`
+	Histogram       *metrics.HistogramSnapshot `json:"histogram,omitempty"`
+}
+
+// ReportHeaderValue contains the responses carrying one value of a captured
+// header
+type ReportHeaderValue struct {
+	Responses   int64                      `json:"responses"`
+	Failed      int64                      `json:"failed"`
+	Percentage  float64                    `json:"percentage"`
+	SuccessRate float64                    `json:"success_rate"`
+	Latency     ReportLatency              `json:"latency"`
+	Histogram   *metrics.HistogramSnapshot `json:"histogram,omitempty"`
+}
+
+// ReportStage contains the requests started during one stage of the load
+// pattern
+type ReportStage struct {
+	Stage             int                        `json:"stage"`
+	Name              string                     `json:"name,omitempty"`
+	Start             string                     `json:"start,omitempty"`
+	Duration          string                     `json:"duration,omitempty"`
+	Intensity         float64                    `json:"intensity,omitempty"`
+	TargetRPS         float64                    `json:"target_rps,omitempty"`
+	Requests          int64                      `json:"requests"`
+	Failed            int64                      `json:"failed"`
+	SuccessRate       float64                    `json:"success_rate"`
+	RequestsPerSecond float64                    `json:"requests_per_second,omitempty"`
+	Latency           ReportLatency              `json:"latency"`
+	Histogram         *metrics.HistogramSnapshot `json:"histogram,omitempty"`
 }
 
 // ReportThroughput contains throughput statistics
@@ -231,4 +483,7 @@ type ReportValidationResults struct {
 	ResponseTimeValidation string `json:"response_time_validation"`
 	BodyValidation         string `json:"body_validation"`
 	FailedValidations      int64  `json:"failed_validations"`
+	// Unsampled responses were outside the validation sample: only their
+	// status code and response time were validated
+	Unsampled int64 `json:"unsampled,omitempty"`
 }
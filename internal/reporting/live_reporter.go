@@ -1,18 +1,58 @@
 package reporting
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alexandredias/gotsunami/internal/metrics"
 )
 
+const (
+	// liveTrendIntervals is how many intervals the error-rate trend shows
+	liveTrendIntervals = 40
+	// minTrendScale is the error rate (in percent) drawn as a full bar when
+	// the recent peak is lower
+	minTrendScale = 5.0
+	// liveStepRows is how many steps the steps panel lists
+	liveStepRows = 8
+)
+
+// sparkLevels are the bars used to draw trends, lowest first
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
 // LiveReporter displays real-time metrics during load testing
 type LiveReporter struct {
 	collector *metrics.Collector
 	interval  time.Duration
-	stopChan  chan bool
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	// Error rate (in percent) of each recent interval, oldest first
+	errorTrend []float64
+	lastTotal  int64
+	lastFailed int64
+
+	// vus returns the active VUs when they can be changed during the run
+	vus func() int
+	// connections returns the client connection pool, when it is known
+	connections func() *metrics.ConnectionPoolSummary
+	// steps are the step names of the scenario, in the order they run
+	steps []string
+
+	// mu guards the display settings changed by typed commands
+	mu              sync.Mutex
+	hideErrors      bool
+	hideStatusCodes bool
+	hideSteps       bool
+	rateStart       time.Time
+	rateTotal       int64
+	rateBytes       int64
+	message         string
 }
 
 // NewLiveReporter creates a new live reporter
@@ -20,22 +60,87 @@ func NewLiveReporter(collector *metrics.Collector, interval time.Duration) *Live
 	return &LiveReporter{
 		collector: collector,
 		interval:  interval,
-		stopChan:  make(chan bool),
+		done:      make(chan struct{}),
 	}
 }
 
-// Start begins live reporting
-func (r *LiveReporter) Start() {
-	go r.reportLoop()
+// ShowVUs displays the active VUs returned by count, with how to change them
+func (r *LiveReporter) ShowVUs(count func() int) {
+	r.vus = count
+}
+
+// ShowConnections displays the connection pool returned by pool
+func (r *LiveReporter) ShowConnections(pool func() *metrics.ConnectionPoolSummary) {
+	r.connections = pool
+}
+
+// ShowSteps lists the steps panel in the order of steps, the step names of
+// the scenario
+func (r *LiveReporter) ShowSteps(steps []string) {
+	r.steps = steps
+}
+
+// ToggleErrors shows or hides the errors panel
+func (r *LiveReporter) ToggleErrors() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hideErrors = !r.hideErrors
+}
+
+// ToggleStatusCodes shows or hides the status codes panel
+func (r *LiveReporter) ToggleStatusCodes() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hideStatusCodes = !r.hideStatusCodes
+}
+
+// ToggleSteps shows or hides the steps panel
+func (r *LiveReporter) ToggleSteps() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hideSteps = !r.hideSteps
+}
+
+// ResetRate restarts the throughput window and the error-rate trend from
+// now, to watch the effect of a change without the history of the run
+func (r *LiveReporter) ResetRate() {
+	summary := r.collector.GetSummary()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rateStart = time.Now()
+	r.rateTotal = summary.TotalRequests
+	r.rateBytes = summary.TotalBytes
+	r.errorTrend = nil
 }
 
-// Stop stops live reporting
+// Notify shows a message below the panels until the next one
+func (r *LiveReporter) Notify(message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.message = message
+}
+
+// Start begins live reporting until ctx ends or Stop is called
+func (r *LiveReporter) Start(ctx context.Context) {
+	ctx, r.cancel = context.WithCancel(ctx)
+	go r.reportLoop(ctx)
+}
+
+// Stop stops live reporting and waits for the final summary to be printed.
+// It is safe to call more than once, and after the context has ended.
 func (r *LiveReporter) Stop() {
-	r.stopChan <- true
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
 }
 
 // reportLoop runs the reporting loop
-func (r *LiveReporter) reportLoop() {
+func (r *LiveReporter) reportLoop(ctx context.Context) {
+	defer close(r.done)
+
 	ticker := time.NewTicker(r.interval)
 	defer ticker.Stop()
 
@@ -47,13 +152,90 @@ func (r *LiveReporter) reportLoop() {
 		select {
 		case <-ticker.C:
 			r.updateDisplay()
-		case <-r.stopChan:
+		case <-ctx.Done():
 			r.printFinalSummary()
 			return
 		}
 	}
 }
 
+// recordErrorRate adds the error rate of the interval since the last update
+// to the trend and returns it
+func (r *LiveReporter) recordErrorRate() float64 {
+	total, failed := r.collector.Counts()
+
+	var rate float64
+	if requests := total - r.lastTotal; requests > 0 {
+		rate = float64(failed-r.lastFailed) / float64(requests) * 100
+	}
+	r.lastTotal, r.lastFailed = total, failed
+
+	r.errorTrend = append(r.errorTrend, rate)
+	if len(r.errorTrend) > liveTrendIntervals {
+		r.errorTrend = r.errorTrend[len(r.errorTrend)-liveTrendIntervals:]
+	}
+
+	return rate
+}
+
+// Sparkline draws values as a row of bars scaled from 0 to max
+func Sparkline(values []float64, max float64) string {
+	if max <= 0 {
+		return strings.Repeat(string(sparkLevels[0]), len(values))
+	}
+
+	var b strings.Builder
+	for _, value := range values {
+		level := int(value / max * float64(len(sparkLevels)-1))
+		if value > 0 && level == 0 {
+			level = 1 // keep any error visible
+		}
+		if level < 0 {
+			level = 0
+		}
+		if level >= len(sparkLevels) {
+			level = len(sparkLevels) - 1
+		}
+		b.WriteRune(sparkLevels[level])
+	}
+
+	return b.String()
+}
+
+// OrderSteps returns the names in the step breakdown of endpoints in the
+// order of steps, then any other endpoints by name
+func OrderSteps(endpoints map[string]*metrics.EndpointSummary, steps []string) []string {
+	names := make([]string, 0, len(endpoints))
+	listed := make(map[string]bool, len(steps))
+	for _, step := range steps {
+		if _, exists := endpoints[step]; exists && !listed[step] {
+			names = append(names, step)
+			listed[step] = true
+		}
+	}
+
+	var others []string
+	for name := range endpoints {
+		if !listed[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+
+	return append(names, others...)
+}
+
+// maxValue returns the largest of values, or 0
+func maxValue(values []float64) float64 {
+	var max float64
+	for _, value := range values {
+		if value > max {
+			max = value
+		}
+	}
+	return max
+}
+
 // clearScreen clears the terminal screen
 func (r *LiveReporter) clearScreen() {
 	fmt.Print("\033[2J\033[H")
@@ -73,6 +255,9 @@ func (r *LiveReporter) printHeader() {
 func (r *LiveReporter) updateDisplay() {
 	summary := r.collector.GetSummary()
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	// Move cursor to beginning of metrics area
 	fmt.Print("\033[5;1H")
 
@@ -80,6 +265,12 @@ func (r *LiveReporter) updateDisplay() {
 	fmt.Printf("┌─ Requests ──────────────────────────────────────────────────────────────────┐\n")
 	fmt.Printf("│  Total: %-10d  │  Success: %-10d  │  Failed: %-10d  │  Rate: %6.2f%% │\n",
 		summary.TotalRequests, summary.SuccessfulRequests, summary.FailedRequests, summary.SuccessRate)
+	// Scale the trend to its peak so small spikes stand out, but not below
+	// minTrendScale so noise stays flat
+	current := r.recordErrorRate()
+	peak := maxValue(r.errorTrend)
+	fmt.Printf("│  Errors/interval: %-*s  now %6.2f%%  peak %6.2f%% \033[K\n",
+		liveTrendIntervals, Sparkline(r.errorTrend, math.Max(peak, minTrendScale)), current, peak)
 	fmt.Printf("└─────────────────────────────────────────────────────────────────────────────┘\n")
 
 	if summary.Latency != nil {
@@ -90,13 +281,37 @@ func (r *LiveReporter) updateDisplay() {
 		fmt.Printf("└─────────────────────────────────────────────────────────────────────────────┘\n")
 	}
 
+	// After a reset, throughput covers the window since then
+	requestsPerSecond, bytesPerSecond, window := summary.RequestsPerSecond, summary.BytesPerSecond, ""
+	if !r.rateStart.IsZero() {
+		if elapsed := time.Since(r.rateStart).Seconds(); elapsed > 0 {
+			requestsPerSecond = float64(summary.TotalRequests-r.rateTotal) / elapsed
+			bytesPerSecond = float64(summary.TotalBytes-r.rateBytes) / elapsed
+		}
+		window = "since " + r.rateStart.Format("15:04:05")
+	}
 	fmt.Printf("┌─ Throughput ────────────────────────────────────────────────────────────────┐\n")
-	fmt.Printf("│  Requests/sec: %8.2f  │  Bytes/sec: %12.0f  │\n",
-		summary.RequestsPerSecond, summary.BytesPerSecond)
+	fmt.Printf("│  Requests/sec: %8.2f  │  Bytes/sec: %12.0f  │  %s\033[K\n",
+		requestsPerSecond, bytesPerSecond, window)
 	fmt.Printf("└─────────────────────────────────────────────────────────────────────────────┘\n")
 
+	if r.connections != nil {
+		if pool := r.connections(); pool != nil {
+			fmt.Printf("┌─ Connections ───────────────────────────────────────────────────────────────┐\n")
+			fmt.Printf("│  Open: %-6d  │  In use: %-6d  │  Idle: %-6d  │  Waiting: %-6d\033[K\n",
+				pool.Open, pool.InUse, pool.Idle, pool.Waiting)
+			wait := ""
+			if pool.Waits > 0 {
+				wait = fmt.Sprintf(" (max %s)", pool.MaxWait)
+			}
+			fmt.Printf("│  Dials: %d (%d failed)  │  Reused: %d  │  Waits: %d%s\033[K\n",
+				pool.Dials, pool.DialFailures, pool.Reused, pool.Waits, wait)
+			fmt.Printf("└─────────────────────────────────────────────────────────────────────────────┘\n")
+		}
+	}
+
 	// Print status codes
-	if len(summary.StatusCodes) > 0 {
+	if len(summary.StatusCodes) > 0 && !r.hideStatusCodes {
 		fmt.Printf("┌─ Status Codes ─────────────────────────────────────────────────────────────┐\n")
 		statusLine := "│  "
 		count := 0
@@ -115,8 +330,28 @@ func (r *LiveReporter) updateDisplay() {
 		fmt.Printf("└─────────────────────────────────────────────────────────────────────────────┘\n")
 	}
 
+	// Print the step breakdown
+	if len(summary.Endpoints) > 0 && !r.hideSteps {
+		fmt.Printf("┌─ Steps ─────────────────────────────────────────────────────────────────────┐\n")
+		names := OrderSteps(summary.Endpoints, r.steps)
+		for i, name := range names {
+			if i >= liveStepRows {
+				fmt.Printf("│  ... and %d more steps\033[K\n", len(names)-liveStepRows)
+				break
+			}
+			endpoint := summary.Endpoints[name]
+			p95 := "-"
+			if endpoint.Latency != nil {
+				p95 = endpoint.Latency.P95.String()
+			}
+			fmt.Printf("│  %-24.24s  Requests: %-8d  Failed: %-6d  Rate: %6.2f%%  P95: %s\033[K\n",
+				name, endpoint.Requests, endpoint.Failed, endpoint.SuccessRate, p95)
+		}
+		fmt.Printf("└─────────────────────────────────────────────────────────────────────────────┘\n")
+	}
+
 	// Print errors if any
-	if len(summary.Errors) > 0 {
+	if len(summary.Errors) > 0 && !r.hideErrors {
 		fmt.Printf("┌─ Errors ───────────────────────────────────────────────────────────────────┐\n")
 		errorCount := 0
 		for errorType, count := range summary.Errors {
@@ -131,7 +366,15 @@ func (r *LiveReporter) updateDisplay() {
 	}
 
 	fmt.Println()
-	fmt.Printf("Press Ctrl+C to stop...")
+	if r.vus != nil {
+		fmt.Printf("VUs: %d  (type +N, -N or N and Enter to scale)\033[K\n", r.vus())
+		fmt.Printf("Commands: e errors, s status codes, p steps, r reset rate, m <note> annotate\033[K\n")
+	}
+	if r.message != "" {
+		fmt.Printf("%s\033[K\n", r.message)
+	}
+	// Clear what hidden panels left below
+	fmt.Printf("Press Ctrl+C to stop...\033[J")
 }
 
 // printFinalSummary prints the final summary when stopping
@@ -145,12 +388,17 @@ func (r *LiveReporter) printFinalSummary() {
 
 	fmt.Printf("│  Total Requests: %d\n", summary.TotalRequests)
 	fmt.Printf("│  Successful: %d (%.2f%%)\n", summary.SuccessfulRequests, summary.SuccessRate)
-	fmt.Printf("│  Failed: %d\n", summary.FailedRequests)
+	fmt.Printf("│  Failed: %d (%d transport, %d HTTP status)\n",
+		summary.FailedRequests, summary.TransportErrors, summary.HTTPErrors)
 	fmt.Printf("│  Requests/sec: %.2f\n", summary.RequestsPerSecond)
 
 	if summary.Latency != nil {
 		fmt.Printf("│  Avg Latency: %s\n", summary.Latency.Mean.String())
 		fmt.Printf("│  P95 Latency: %s\n", summary.Latency.P95.String())
+		if ci := summary.Latency.P99CI; ci != nil {
+			fmt.Printf("│  P99 Latency: %s (95%% CI %s to %s, %d samples)\n",
+				summary.Latency.P99.String(), ci.Lower.String(), ci.Upper.String(), summary.Latency.Samples)
+		}
 	}
 
 	fmt.Println("└─────────────────────────────────────────────────────────────────────────────┘")
@@ -0,0 +1,527 @@
+package reporting
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+)
+
+// LoadReport reads a JSON report from a file
+func LoadReport(filename string) (*Report, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report file: %w", err)
+	}
+
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse report JSON: %w", err)
+	}
+
+	return &report, nil
+}
+
+// MergeReports statistically combines reports produced by independent
+// generators running concurrently. Counters and throughput are summed and
+// latency percentiles are recomputed from the merged histograms, never averaged.
+func MergeReports(reports []*Report, sources []string) (*Report, error) {
+	if len(reports) == 0 {
+		return nil, fmt.Errorf("no reports to merge")
+	}
+
+	// Merge at the finest precision among the reports so none loses accuracy
+	precision := uint(metrics.DefaultHistogramPrecision)
+	for _, report := range reports {
+		if report.LatencyHistogram != nil && report.LatencyHistogram.Precision > precision {
+			precision = report.LatencyHistogram.Precision
+		}
+	}
+
+	histogram := metrics.NewHistogram(precision)
+	statusHistograms := make(map[string]*metrics.Histogram)
+	tenantHistograms := make(map[string]*metrics.Histogram)
+	endpointHistograms := make(map[string]*metrics.Histogram)
+	headerHistograms := make(map[string]map[string]*metrics.Histogram)
+	stageHistograms := make(map[int]*metrics.Histogram)
+	stageIndex := make(map[int]int)
+	statusCodes := make(map[string]int64)
+	errorCounts := make(map[string]int64)
+	scenarios := make([]string, 0, len(reports))
+	seenScenarios := make(map[string]bool)
+
+	first := reports[0]
+	merged := &Report{
+		Metadata: ReportMetadata{
+			Tool:      "GoTsunami",
+			Version:   first.Metadata.Version,
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Sources:   sources,
+			Labels:    commonLabels(reports),
+		},
+		Configuration: first.Configuration,
+	}
+	merged.Configuration.VirtualUsers = 0
+
+	var longest, throttled, drained, warmedUp time.Duration
+	for i, report := range reports {
+		if report.LatencyHistogram == nil {
+			return nil, fmt.Errorf("report %s has no latency histogram; re-run it with a newer GoTsunami to merge it", sourceName(sources, i))
+		}
+		histogram.Merge(metrics.NewHistogramFromSnapshot(report.LatencyHistogram))
+		for key, snapshot := range report.StatusHistograms {
+			if statusHistograms[key] == nil {
+				statusHistograms[key] = metrics.NewHistogram(precision)
+			}
+			statusHistograms[key].Merge(metrics.NewHistogramFromSnapshot(snapshot))
+		}
+
+		if !seenScenarios[report.Metadata.Scenario] {
+			seenScenarios[report.Metadata.Scenario] = true
+			scenarios = append(scenarios, report.Metadata.Scenario)
+		}
+		if report.Configuration.Pattern != merged.Configuration.Pattern {
+			merged.Configuration.Pattern = "mixed"
+		}
+		if report.Configuration.Seed != merged.Configuration.Seed {
+			merged.Configuration.Seed = 0
+		}
+		if duration, err := time.ParseDuration(report.Configuration.Duration); err == nil && duration > longest {
+			longest = duration
+		}
+
+		merged.Configuration.VirtualUsers += report.Configuration.VirtualUsers
+		merged.Summary.TotalRequests += report.Summary.TotalRequests
+		merged.Summary.SuccessfulRequests += report.Summary.SuccessfulRequests
+		merged.Summary.FailedRequests += report.Summary.FailedRequests
+		merged.Summary.TransportErrors += report.Summary.TransportErrors
+		merged.Summary.HTTPErrors += report.Summary.HTTPErrors
+		merged.Summary.NotModified += report.Summary.NotModified
+		merged.Summary.DroppedIterations += report.Summary.DroppedIterations
+		merged.Throughput.RequestsPerSecond += report.Throughput.RequestsPerSecond
+		merged.Throughput.BytesPerSecond += report.Throughput.BytesPerSecond
+		merged.ValidationResults.FailedValidations += report.ValidationResults.FailedValidations
+		merged.ValidationResults.Unsampled += report.ValidationResults.Unsampled
+
+		for code, count := range report.StatusCodes {
+			statusCodes[code] += count
+		}
+		for _, reportError := range report.Errors {
+			errorCounts[reportError.Type] += reportError.Count
+		}
+		merged.Hooks = append(merged.Hooks, report.Hooks...)
+		merged.SLOViolations = append(merged.SLOViolations, report.SLOViolations...)
+		merged.Annotations = append(merged.Annotations, report.Annotations...)
+		if report.Cleanup != nil {
+			if merged.Cleanup == nil {
+				merged.Cleanup = &metrics.CleanupSummary{}
+			}
+			merged.Cleanup.Captured += report.Cleanup.Captured
+			merged.Cleanup.Deleted += report.Cleanup.Deleted
+			merged.Cleanup.Failed += report.Cleanup.Failed
+			merged.Cleanup.Remaining += report.Cleanup.Remaining
+		}
+		if report.Idempotency != nil {
+			if merged.Idempotency == nil {
+				merged.Idempotency = &metrics.IdempotencySummary{}
+			}
+			merged.Idempotency.Operations += report.Idempotency.Operations
+			merged.Idempotency.Retries += report.Idempotency.Retries
+			merged.Idempotency.Replays += report.Idempotency.Replays
+			merged.Idempotency.Checked += report.Idempotency.Checked
+			merged.Idempotency.Duplicates += report.Idempotency.Duplicates
+		}
+		if report.Consistency != nil {
+			merged.Consistency = mergeConsistency(merged.Consistency, report.Consistency)
+		}
+		if report.MethodMetrics != nil {
+			if merged.MethodMetrics == nil {
+				merged.MethodMetrics = &metrics.MethodSummary{Method: report.MethodMetrics.Method}
+			} else if merged.MethodMetrics.Method != report.MethodMetrics.Method {
+				merged.MethodMetrics.Method = "mixed"
+			}
+			merged.MethodMetrics.DeclaredBytes += report.MethodMetrics.DeclaredBytes
+			for value, count := range report.MethodMetrics.Allow {
+				if merged.MethodMetrics.Allow == nil {
+					merged.MethodMetrics.Allow = make(map[string]int64)
+				}
+				merged.MethodMetrics.Allow[value] += count
+			}
+		}
+		for tenant, reportTenant := range report.Tenants {
+			if merged.Tenants == nil {
+				merged.Tenants = make(map[string]ReportTenant)
+			}
+			mergedTenant := merged.Tenants[tenant]
+			mergedTenant.Requests += reportTenant.Requests
+			mergedTenant.Failed += reportTenant.Failed
+			mergedTenant.TransportErrors += reportTenant.TransportErrors
+			mergedTenant.HTTPErrors += reportTenant.HTTPErrors
+			merged.Tenants[tenant] = mergedTenant
+
+			if reportTenant.Histogram != nil {
+				if tenantHistograms[tenant] == nil {
+					tenantHistograms[tenant] = metrics.NewHistogram(precision)
+				}
+				tenantHistograms[tenant].Merge(metrics.NewHistogramFromSnapshot(reportTenant.Histogram))
+			}
+		}
+		for endpoint, reportEndpoint := range report.Endpoints {
+			if merged.Endpoints == nil {
+				merged.Endpoints = make(map[string]ReportEndpoint)
+			}
+			mergedEndpoint := merged.Endpoints[endpoint]
+			mergedEndpoint.Requests += reportEndpoint.Requests
+			mergedEndpoint.Failed += reportEndpoint.Failed
+			mergedEndpoint.TransportErrors += reportEndpoint.TransportErrors
+			mergedEndpoint.HTTPErrors += reportEndpoint.HTTPErrors
+			merged.Endpoints[endpoint] = mergedEndpoint
+
+			if reportEndpoint.Histogram != nil {
+				if endpointHistograms[endpoint] == nil {
+					endpointHistograms[endpoint] = metrics.NewHistogram(precision)
+				}
+				endpointHistograms[endpoint].Merge(metrics.NewHistogramFromSnapshot(reportEndpoint.Histogram))
+			}
+		}
+		for header, values := range report.Headers {
+			if merged.Headers == nil {
+				merged.Headers = make(map[string]map[string]ReportHeaderValue)
+			}
+			if merged.Headers[header] == nil {
+				merged.Headers[header] = make(map[string]ReportHeaderValue)
+				headerHistograms[header] = make(map[string]*metrics.Histogram)
+			}
+			for value, reportValue := range values {
+				mergedValue := merged.Headers[header][value]
+				mergedValue.Responses += reportValue.Responses
+				mergedValue.Failed += reportValue.Failed
+				merged.Headers[header][value] = mergedValue
+
+				if reportValue.Histogram != nil {
+					if headerHistograms[header][value] == nil {
+						headerHistograms[header][value] = metrics.NewHistogram(precision)
+					}
+					headerHistograms[header][value].Merge(metrics.NewHistogramFromSnapshot(reportValue.Histogram))
+				}
+			}
+		}
+		for _, reportStage := range report.Stages {
+			i, exists := stageIndex[reportStage.Stage]
+			if !exists {
+				// Runs of the same pattern share the layout of its stages
+				i = len(merged.Stages)
+				stageIndex[reportStage.Stage] = i
+				merged.Stages = append(merged.Stages, ReportStage{
+					Stage:     reportStage.Stage,
+					Name:      reportStage.Name,
+					Start:     reportStage.Start,
+					Duration:  reportStage.Duration,
+					Intensity: reportStage.Intensity,
+					TargetRPS: reportStage.TargetRPS,
+				})
+			}
+			mergedStage := &merged.Stages[i]
+			mergedStage.Requests += reportStage.Requests
+			mergedStage.Failed += reportStage.Failed
+			// Agents load the target in parallel, so their throughputs add up
+			mergedStage.RequestsPerSecond += reportStage.RequestsPerSecond
+
+			if reportStage.Histogram != nil {
+				if stageHistograms[reportStage.Stage] == nil {
+					stageHistograms[reportStage.Stage] = metrics.NewHistogram(precision)
+				}
+				stageHistograms[reportStage.Stage].Merge(metrics.NewHistogramFromSnapshot(reportStage.Histogram))
+			}
+		}
+		if report.Drain != nil {
+			if merged.Drain == nil {
+				merged.Drain = &metrics.DrainSummary{}
+			}
+			merged.Drain.InFlight += report.Drain.InFlight
+			merged.Drain.Completed += report.Drain.Completed
+			merged.Drain.Abandoned += report.Drain.Abandoned
+			if duration, err := time.ParseDuration(report.Drain.Duration); err == nil && duration > drained {
+				drained = duration
+			}
+		}
+		if report.Warmup != nil {
+			// Agents warm up in parallel; together they are stable only if
+			// each of them was
+			if merged.Warmup == nil {
+				merged.Warmup = &metrics.WarmupSummary{Stable: true}
+			}
+			merged.Warmup.Requests += report.Warmup.Requests
+			merged.Warmup.Stable = merged.Warmup.Stable && report.Warmup.Stable
+			if duration, err := time.ParseDuration(report.Warmup.Duration); err == nil && duration >= warmedUp {
+				warmedUp = duration
+				merged.Warmup.Duration = report.Warmup.Duration
+				merged.Warmup.P95 = report.Warmup.P95
+			}
+		}
+		if pool := report.ConnectionPool; pool != nil {
+			if merged.ConnectionPool == nil {
+				merged.ConnectionPool = &metrics.ConnectionPoolSummary{}
+			}
+			mergeConnectionPool(merged.ConnectionPool, pool)
+		}
+		// Agents run on their own machines; the busiest stands for all
+		if generator := report.Generator; generator != nil {
+			if merged.Generator == nil || generator.CPUUsage > merged.Generator.CPUUsage {
+				copied := *generator
+				merged.Generator = &copied
+			}
+		}
+		// Clocks too; the one with the most jumps and stalls stands for all
+		if clock := report.Clock; clock != nil {
+			if merged.Clock == nil || clock.JumpCount+clock.StallCount > merged.Clock.JumpCount+merged.Clock.StallCount {
+				copied := *clock
+				merged.Clock = &copied
+			}
+		}
+		for proto, count := range report.HTTPVersions {
+			if merged.HTTPVersions == nil {
+				merged.HTTPVersions = make(map[string]int64)
+			}
+			merged.HTTPVersions[proto] += count
+		}
+		if report.Throttle != nil {
+			if merged.Throttle == nil {
+				merged.Throttle = &metrics.ThrottleSummary{}
+			}
+			merged.Throttle.Responses += report.Throttle.Responses
+			// Runs back off in parallel, so the longest backoff held the test back
+			if duration, err := time.ParseDuration(report.Throttle.Duration); err == nil && duration > throttled {
+				throttled = duration
+			}
+		}
+	}
+
+	merged.Metadata.Scenario = strings.Join(scenarios, ", ")
+	merged.Metadata.Duration = longest.String()
+	merged.Configuration.Duration = longest.String()
+	merged.Summary.TotalDuration = longest.String()
+	if merged.Drain != nil {
+		merged.Drain.Duration = drained.String()
+	}
+	if merged.Throttle != nil {
+		merged.Throttle.Duration = throttled.String()
+		if longest > 0 {
+			merged.Throttle.Percentage = float64(throttled) / float64(longest) * 100
+		}
+	}
+
+	if merged.Summary.TotalRequests > 0 {
+		merged.Summary.SuccessRate = float64(merged.Summary.SuccessfulRequests) / float64(merged.Summary.TotalRequests) * 100
+	}
+
+	merged.LatencyHistogram = histogram.Snapshot()
+	merged.Latency = formatLatency(metrics.HistogramLatencyStats(histogram))
+	if len(statusHistograms) > 0 {
+		merged.LatencyByStatus = make(map[string]ReportLatency, len(statusHistograms))
+		merged.StatusHistograms = make(map[string]*metrics.HistogramSnapshot, len(statusHistograms))
+		for key, statusHistogram := range statusHistograms {
+			merged.LatencyByStatus[key] = formatLatency(metrics.HistogramLatencyStats(statusHistogram))
+			merged.StatusHistograms[key] = statusHistogram.Snapshot()
+		}
+	}
+
+	for tenant, mergedTenant := range merged.Tenants {
+		if mergedTenant.Requests > 0 {
+			mergedTenant.SuccessRate = float64(mergedTenant.Requests-mergedTenant.Failed) / float64(mergedTenant.Requests) * 100
+		}
+		if tenantHistogram := tenantHistograms[tenant]; tenantHistogram != nil {
+			mergedTenant.Latency = formatLatency(metrics.HistogramLatencyStats(tenantHistogram))
+			mergedTenant.Histogram = tenantHistogram.Snapshot()
+		}
+		merged.Tenants[tenant] = mergedTenant
+	}
+
+	for endpoint, mergedEndpoint := range merged.Endpoints {
+		if mergedEndpoint.Requests > 0 {
+			mergedEndpoint.SuccessRate = float64(mergedEndpoint.Requests-mergedEndpoint.Failed) / float64(mergedEndpoint.Requests) * 100
+		}
+		if endpointHistogram := endpointHistograms[endpoint]; endpointHistogram != nil {
+			mergedEndpoint.Latency = formatLatency(metrics.HistogramLatencyStats(endpointHistogram))
+			mergedEndpoint.Histogram = endpointHistogram.Snapshot()
+		}
+		merged.Endpoints[endpoint] = mergedEndpoint
+	}
+
+	for header, values := range merged.Headers {
+		var total int64
+		for _, mergedValue := range values {
+			total += mergedValue.Responses
+		}
+		for value, mergedValue := range values {
+			if total > 0 {
+				mergedValue.Percentage = float64(mergedValue.Responses) / float64(total) * 100
+			}
+			if mergedValue.Responses > 0 {
+				mergedValue.SuccessRate = float64(mergedValue.Responses-mergedValue.Failed) / float64(mergedValue.Responses) * 100
+			}
+			if valueHistogram := headerHistograms[header][value]; valueHistogram != nil {
+				mergedValue.Latency = formatLatency(metrics.HistogramLatencyStats(valueHistogram))
+				mergedValue.Histogram = valueHistogram.Snapshot()
+			}
+			values[value] = mergedValue
+		}
+	}
+
+	sort.Slice(merged.Stages, func(i, j int) bool { return merged.Stages[i].Stage < merged.Stages[j].Stage })
+	for i := range merged.Stages {
+		mergedStage := &merged.Stages[i]
+		if mergedStage.Requests > 0 {
+			mergedStage.SuccessRate = float64(mergedStage.Requests-mergedStage.Failed) / float64(mergedStage.Requests) * 100
+		}
+		if stageHistogram := stageHistograms[mergedStage.Stage]; stageHistogram != nil {
+			mergedStage.Latency = formatLatency(metrics.HistogramLatencyStats(stageHistogram))
+			mergedStage.Histogram = stageHistogram.Snapshot()
+		}
+	}
+	// Capacity under the goals of the reports, from the merged stages
+	var goals []config.LatencyObjective
+	for _, estimate := range reports[0].Capacity {
+		goals = append(goals, config.LatencyObjective{Percentile: estimate.Percentile, Max: estimate.Max})
+	}
+	merged.Capacity = EstimateCapacity(merged.Stages, goals)
+
+	// Slow steps under the budgets of the reports, from the merged endpoints
+	var budgets []StepBudget
+	for _, step := range reports[0].SlowSteps {
+		budgets = append(budgets, StepBudget{Step: step.Step, Budget: step.Budget})
+	}
+	merged.SlowSteps = RankSlowSteps(merged.Endpoints, budgets)
+
+	merged.StatusCodes = statusCodes
+	merged.Errors = mergeErrors(errorCounts)
+	merged.ValidationResults = ReportValidationResults{
+		StatusCodeValidation:   "passed",
+		ResponseTimeValidation: "passed",
+		BodyValidation:         "passed",
+		FailedValidations:      merged.ValidationResults.FailedValidations,
+		Unsampled:              merged.ValidationResults.Unsampled,
+	}
+	if merged.ValidationResults.FailedValidations > 0 {
+		merged.ValidationResults.BodyValidation = "failed"
+	}
+
+	return merged, nil
+}
+
+// commonLabels returns the labels shared, with the same value, by every report
+func commonLabels(reports []*Report) map[string]string {
+	var labels map[string]string
+	for key, value := range reports[0].Metadata.Labels {
+		shared := true
+		for _, report := range reports[1:] {
+			if other, exists := report.Metadata.Labels[key]; !exists || other != value {
+				shared = false
+				break
+			}
+		}
+		if shared {
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			labels[key] = value
+		}
+	}
+
+	return labels
+}
+
+// mergeErrors rebuilds the error list with percentages over the merged
+// totals, keeping it as bounded as the error list of each report
+func mergeErrors(errorCounts map[string]int64) []ReportError {
+	errorCounts = metrics.TopErrors(errorCounts, metrics.MaxErrors)
+
+	var total int64
+	for _, count := range errorCounts {
+		total += count
+	}
+
+	reportErrors := make([]ReportError, 0, len(errorCounts))
+	for errorType, count := range errorCounts {
+		reportErrors = append(reportErrors, ReportError{
+			Type:       errorType,
+			Count:      count,
+			Percentage: float64(count) / float64(total) * 100,
+		})
+	}
+	sort.Slice(reportErrors, func(i, j int) bool {
+		return reportErrors[i].Count > reportErrors[j].Count
+	})
+
+	return reportErrors
+}
+
+// sourceName returns a printable name for the i-th merged report
+func sourceName(sources []string, i int) string {
+	if i < len(sources) {
+		return sources[i]
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+// mergeConsistency adds the URLs an agent compared to the merged ones. A URL
+// compared by several agents is counted once per agent, but its listed
+// variants are combined.
+func mergeConsistency(merged, report *metrics.ConsistencySummary) *metrics.ConsistencySummary {
+	if merged == nil {
+		merged = &metrics.ConsistencySummary{}
+	}
+	merged.Checked += report.Checked
+	merged.Responses += report.Responses
+	merged.Inconsistent += report.Inconsistent
+
+	for _, url := range report.URLs {
+		index := -1
+		for i := range merged.URLs {
+			if merged.URLs[i].URL == url.URL {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			merged.URLs = append(merged.URLs, metrics.InconsistentURL{URL: url.URL, Variants: make(map[string]int64)})
+			index = len(merged.URLs) - 1
+		}
+		for hash, count := range url.Variants {
+			merged.URLs[index].Variants[hash] += count
+		}
+	}
+
+	return merged
+}
+
+// mergeConnectionPool adds the pool of another agent; agents have their own
+// pools, so their counts and peaks add up
+func mergeConnectionPool(merged, pool *metrics.ConnectionPoolSummary) {
+	merged.Dials += pool.Dials
+	merged.DialFailures += pool.DialFailures
+	merged.Reused += pool.Reused
+	merged.Open += pool.Open
+	merged.InUse += pool.InUse
+	merged.Idle += pool.Idle
+	merged.Waiting += pool.Waiting
+	merged.PeakOpen += pool.PeakOpen
+	merged.PeakInUse += pool.PeakInUse
+	merged.PeakWaiting += pool.PeakWaiting
+	merged.Waits += pool.Waits
+
+	if waited, err := time.ParseDuration(pool.WaitTime); err == nil {
+		total, _ := time.ParseDuration(merged.WaitTime)
+		merged.WaitTime = (total + waited).String()
+	}
+	if longest, err := time.ParseDuration(pool.MaxWait); err == nil {
+		if current, _ := time.ParseDuration(merged.MaxWait); longest > current {
+			merged.MaxWait = pool.MaxWait
+		}
+	}
+}
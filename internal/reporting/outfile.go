@@ -0,0 +1,55 @@
+package reporting
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexandredias/gotsunami/pkg/templates"
+)
+
+// unsafeNameChars matches characters replaced in names used inside file paths
+var unsafeNameChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// OutfileName expands templates in a report file name, so repeated runs can
+// write distinct files, e.g. reports/{{scenario}}-{{timestamp}}.json.
+// Available variables: scenario, timestamp, date, seed and label.<key>;
+// template functions such as {{timestamp "2006"}} work as well.
+func OutfileName(pattern string, report *Report) (string, error) {
+	if !strings.Contains(pattern, "{{") {
+		return pattern, nil
+	}
+
+	generated, err := time.Parse(time.RFC3339, report.Metadata.Timestamp)
+	if err != nil {
+		generated = time.Now().UTC()
+	}
+
+	vars := map[string]string{
+		"scenario":  safeName(report.Metadata.Scenario),
+		"timestamp": generated.Format("20060102-150405"),
+		"date":      generated.Format("2006-01-02"),
+		"seed":      strconv.FormatInt(report.Configuration.Seed, 10),
+	}
+	for key, value := range report.Metadata.Labels {
+		vars["label."+key] = safeName(value)
+	}
+
+	name, err := templates.Expand(pattern, vars)
+	if err != nil {
+		return "", fmt.Errorf("invalid outfile %q: %w", pattern, err)
+	}
+
+	return name, nil
+}
+
+// safeName turns a free-form value into a file name fragment
+func safeName(value string) string {
+	name := strings.Trim(unsafeNameChars.ReplaceAllString(strings.ToLower(value), "-"), "-")
+	if name == "" {
+		return "unnamed"
+	}
+	return name
+}
@@ -0,0 +1,210 @@
+package reporting
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// PrometheusContentType is the content type of the Prometheus text format
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// prometheusBuckets are the upper bounds, in seconds, of the latency
+// histogram buckets; Prometheus' defaults, stretched for slow targets
+var prometheusBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// PrometheusExporter serves the live metrics of a run on /metrics in the
+// Prometheus text format, so dashboards can follow long soak tests. Counters
+// start at zero with the run; every series carries the scenario and run
+// labels.
+type PrometheusExporter struct {
+	collector *metrics.Collector
+	labels    string
+	server    *http.Server
+
+	// vus returns the active VUs, when they are known
+	vus func() int
+	// connections returns the client connection pool, when it is known
+	connections func() *metrics.ConnectionPoolSummary
+}
+
+// NewPrometheusExporter creates an exporter of the metrics of collector for
+// scenario, labelling every series with labels
+func NewPrometheusExporter(collector *metrics.Collector, scenario string, labels map[string]string) *PrometheusExporter {
+	constant := []string{`scenario="` + escapeLabel(scenario) + `"`}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := prometheusName(key)
+		if name == "scenario" {
+			continue
+		}
+		constant = append(constant, name+`="`+escapeLabel(labels[key])+`"`)
+	}
+
+	e := &PrometheusExporter{collector: collector, labels: strings.Join(constant, ",")}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	e.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return e
+}
+
+// ShowVUs exports the active VUs returned by count
+func (e *PrometheusExporter) ShowVUs(count func() int) {
+	e.vus = count
+}
+
+// ShowConnections exports the connection pool returned by pool
+func (e *PrometheusExporter) ShowConnections(pool func() *metrics.ConnectionPoolSummary) {
+	e.connections = pool
+}
+
+// Start serves /metrics on addr until Stop is called. The address is bound
+// right away, so a port in use fails before the test starts.
+func (e *PrometheusExporter) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to serve metrics: %w", err)
+	}
+	logrus.Infof("Serving Prometheus metrics on http://%s/metrics", listener.Addr())
+
+	go func() {
+		if err := e.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.WithError(err).Warn("Prometheus metrics endpoint failed")
+		}
+	}()
+	return nil
+}
+
+// Stop closes the metrics endpoint, letting scrapes in progress finish
+func (e *PrometheusExporter) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	e.server.Shutdown(ctx)
+}
+
+// ServeHTTP writes the current metrics
+func (e *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", PrometheusContentType)
+	e.Write(w)
+}
+
+// Write writes the current metrics in the Prometheus text format
+func (e *PrometheusExporter) Write(w io.Writer) error {
+	summary := e.collector.GetSummary()
+	out := bufio.NewWriter(w)
+
+	e.family(out, "gotsunami_requests_total", "counter", "Requests sent")
+	e.sample(out, "gotsunami_requests_total", "", float64(summary.TotalRequests))
+	e.family(out, "gotsunami_requests_failed_total", "counter", "Requests that failed transport, status or validation checks")
+	e.sample(out, "gotsunami_requests_failed_total", "", float64(summary.FailedRequests))
+	e.family(out, "gotsunami_received_bytes_total", "counter", "Response bytes received")
+	e.sample(out, "gotsunami_received_bytes_total", "", float64(summary.TotalBytes))
+
+	e.family(out, "gotsunami_responses_total", "counter", "Responses by status code")
+	codes := make([]int, 0, len(summary.StatusCodes))
+	for code := range summary.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		e.sample(out, "gotsunami_responses_total", `code="`+strconv.Itoa(code)+`"`, float64(summary.StatusCodes[code]))
+	}
+
+	statuses := make([]string, 0, len(summary.StatusHistograms))
+	for key := range summary.StatusHistograms {
+		statuses = append(statuses, key)
+	}
+	sort.Strings(statuses)
+
+	// Requests without a status code, by error class (see metrics.ErrorClass)
+	e.family(out, "gotsunami_errors_total", "counter", "Requests that failed without a response, by error class")
+	for _, key := range statuses {
+		if class, isError := strings.CutPrefix(key, "error:"); isError {
+			e.sample(out, "gotsunami_errors_total", `class="`+escapeLabel(class)+`"`, float64(summary.StatusHistograms[key].Count))
+		}
+	}
+
+	e.family(out, "gotsunami_request_duration_seconds", "histogram", "Request latency by status code or error class")
+	for _, key := range statuses {
+		e.histogram(out, `status="`+escapeLabel(key)+`"`, summary.StatusHistograms[key])
+	}
+
+	if e.vus != nil {
+		e.family(out, "gotsunami_vus", "gauge", "Active virtual users")
+		e.sample(out, "gotsunami_vus", "", float64(e.vus()))
+	}
+	if e.connections != nil {
+		if pool := e.connections(); pool != nil {
+			e.family(out, "gotsunami_connections_dialed_total", "counter", "Connections dialed by the client")
+			e.sample(out, "gotsunami_connections_dialed_total", "", float64(pool.Dials))
+			e.family(out, "gotsunami_connections_open", "gauge", "Open client connections")
+			e.sample(out, "gotsunami_connections_open", "", float64(pool.Open))
+			e.family(out, "gotsunami_connections_waiting", "gauge", "Requests waiting for a connection")
+			e.sample(out, "gotsunami_connections_waiting", "", float64(pool.Waiting))
+		}
+	}
+
+	return out.Flush()
+}
+
+// histogram writes the cumulative buckets, sum and count of a latency
+// histogram. Counts are exact up to the precision of the histogram buckets.
+func (e *PrometheusExporter) histogram(w io.Writer, labels string, snapshot *metrics.HistogramSnapshot) {
+	h := metrics.NewHistogramFromSnapshot(snapshot)
+	for _, bound := range prometheusBuckets {
+		le := labels + `,le="` + strconv.FormatFloat(bound, 'g', -1, 64) + `"`
+		below := h.Count() - h.CountAbove(time.Duration(bound*float64(time.Second)))
+		e.sample(w, "gotsunami_request_duration_seconds_bucket", le, float64(below))
+	}
+	e.sample(w, "gotsunami_request_duration_seconds_bucket", labels+`,le="+Inf"`, float64(h.Count()))
+	e.sample(w, "gotsunami_request_duration_seconds_sum", labels, float64(snapshot.Sum)/1e6)
+	e.sample(w, "gotsunami_request_duration_seconds_count", labels, float64(h.Count()))
+}
+
+// family writes the help and type lines of a metric
+func (e *PrometheusExporter) family(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes a sample with the constant labels and labels
+func (e *PrometheusExporter) sample(w io.Writer, name, labels string, value float64) {
+	if labels != "" {
+		labels = "," + labels
+	}
+	fmt.Fprintf(w, "%s{%s%s} %s\n", name, e.labels, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// prometheusName turns a run label into a valid Prometheus label name
+func prometheusName(key string) string {
+	name := []rune(key)
+	for i, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
+
+// escapeLabel escapes a label value of the Prometheus text format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
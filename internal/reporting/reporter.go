@@ -0,0 +1,81 @@
+package reporting
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// writeOutput writes rendered report data to outfile, or stdout when empty
+func writeOutput(data []byte, outfile string) error {
+	return streamOutput(outfile, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// streamOutput writes a report to outfile, or stdout when empty, as write
+// produces it, so the rendered report never has to fit in memory at once.
+// The report goes to a temporary file renamed over outfile once complete, so
+// one that fails halfway leaves any previous report in place.
+func streamOutput(outfile string, write func(w io.Writer) error) error {
+	if outfile == "" {
+		out := bufio.NewWriter(os.Stdout)
+		if err := write(out); err != nil {
+			return err
+		}
+		out.WriteByte('\n')
+		return out.Flush()
+	}
+
+	dir := filepath.Dir(outfile)
+	if dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create report directory: %w", err)
+		}
+	}
+
+	file, err := os.CreateTemp(dir, "."+filepath.Base(outfile)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write report to file: %w", err)
+	}
+	out := bufio.NewWriter(file)
+	err = write(out)
+	if err == nil {
+		err = out.Flush()
+	}
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), outfile)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("failed to write report to file: %w", err)
+	}
+	fmt.Printf("Report written to: %s\n", outfile)
+
+	return nil
+}
+
+// reportToMap converts a report into generic maps using its JSON field names
+func reportToMap(report *Report) (map[string]interface{}, error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal report: %w", err)
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to convert report: %w", err)
+	}
+
+	return result, nil
+}
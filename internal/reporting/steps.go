@@ -0,0 +1,107 @@
+package reporting
+
+import (
+	"sort"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+)
+
+// ReportSlowStep ranks a step of the scenario by the responses over its
+// latency budget and its share of the journey time, so the steps worth
+// optimizing come first
+type ReportSlowStep struct {
+	Step          string  `json:"step"`
+	Budget        string  `json:"budget,omitempty"`
+	Requests      int64   `json:"requests"`
+	OverBudget    int64   `json:"over_budget"`
+	OverBudgetPct float64 `json:"over_budget_percentage"`
+	P95           string  `json:"p95"`
+	// Contribution is the step's p95 as a percentage of the sum of the p95
+	// of every step, the p95 journey
+	Contribution float64 `json:"p95_contribution"`
+	p95          time.Duration
+}
+
+// StepBudget is the latency budget of a step, empty when it has none
+type StepBudget struct {
+	Step   string
+	Budget string
+}
+
+// ScenarioStepBudgets returns the budget of every step of a scenario, or nil
+// unless at least one step has a budget
+func ScenarioStepBudgets(scenario *config.Scenario) []StepBudget {
+	if scenario == nil {
+		return nil
+	}
+
+	budgets := make([]StepBudget, len(scenario.Steps))
+	budgeted := false
+	for i, step := range scenario.Steps {
+		budgets[i] = StepBudget{Step: step.GetName(i), Budget: step.Budget}
+		budgeted = budgeted || step.Budget != ""
+	}
+	if !budgeted {
+		return nil
+	}
+	return budgets
+}
+
+// ScenarioStepNames returns the name of every step of a scenario, in order
+func ScenarioStepNames(scenario *config.Scenario) []string {
+	if scenario == nil {
+		return nil
+	}
+
+	names := make([]string, len(scenario.Steps))
+	for i, step := range scenario.Steps {
+		names[i] = step.GetName(i)
+	}
+	return names
+}
+
+// RankSlowSteps ranks steps from the endpoints of a report, where each step
+// is reported under its name: most responses over budget first, then the
+// largest share of the p95 journey. Steps without requests are left out.
+func RankSlowSteps(endpoints map[string]ReportEndpoint, budgets []StepBudget) []ReportSlowStep {
+	var ranked []ReportSlowStep
+	var journey time.Duration
+	seen := make(map[string]bool, len(budgets))
+	for _, budget := range budgets {
+		endpoint, exists := endpoints[budget.Step]
+		if !exists || seen[budget.Step] || endpoint.Histogram == nil || endpoint.Histogram.Count == 0 {
+			continue
+		}
+		seen[budget.Step] = true
+
+		histogram := metrics.NewHistogramFromSnapshot(endpoint.Histogram)
+		step := ReportSlowStep{
+			Step:     budget.Step,
+			Budget:   budget.Budget,
+			Requests: endpoint.Requests,
+			p95:      histogram.Percentile(95),
+		}
+		step.P95 = step.p95.String()
+		if limit, err := time.ParseDuration(budget.Budget); err == nil {
+			step.OverBudget = histogram.CountAbove(limit)
+			step.OverBudgetPct = roundRate(float64(step.OverBudget) / float64(histogram.Count()) * 100)
+		}
+		journey += step.p95
+		ranked = append(ranked, step)
+	}
+
+	for i := range ranked {
+		if journey > 0 {
+			ranked[i].Contribution = roundRate(float64(ranked[i].p95) / float64(journey) * 100)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].OverBudget != ranked[j].OverBudget {
+			return ranked[i].OverBudget > ranked[j].OverBudget
+		}
+		return ranked[i].p95 > ranked[j].p95
+	})
+	return ranked
+}
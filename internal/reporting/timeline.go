@@ -0,0 +1,72 @@
+package reporting
+
+import (
+	"fmt"
+	"time"
+)
+
+// ReportPhase summarizes one phase of a timeline run
+type ReportPhase struct {
+	Name              string  `json:"name"`
+	Scenario          string  `json:"scenario,omitempty"`
+	Start             string  `json:"start"`
+	Duration          string  `json:"duration,omitempty"`
+	VirtualUsers      int     `json:"virtual_users,omitempty"`
+	Pattern           string  `json:"pattern,omitempty"`
+	TotalRequests     int64   `json:"total_requests"`
+	SuccessRate       float64 `json:"success_rate"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	P95               string  `json:"p95,omitempty"`
+	Error             string  `json:"error,omitempty"`
+}
+
+// MergeTimeline combines the reports of the phases of a timeline into one
+// report listing every phase. phases carry the name, start and error of each
+// phase; reports[i] is nil for a phase that did not run. Phases do not all
+// run at once, so unlike MergeReports throughput is averaged over the whole
+// timeline.
+func MergeTimeline(name string, phases []ReportPhase, reports []*Report, elapsed time.Duration) (*Report, error) {
+	var ran []*Report
+	var sources []string
+	var bytes float64
+	for i, report := range reports {
+		if report == nil {
+			continue
+		}
+		ran = append(ran, report)
+		sources = append(sources, phases[i].Name)
+
+		phases[i].Scenario = report.Metadata.Scenario
+		phases[i].Duration = report.Summary.TotalDuration
+		phases[i].VirtualUsers = report.Configuration.VirtualUsers
+		phases[i].Pattern = report.Configuration.Pattern
+		phases[i].TotalRequests = report.Summary.TotalRequests
+		phases[i].SuccessRate = report.Summary.SuccessRate
+		phases[i].RequestsPerSecond = report.Throughput.RequestsPerSecond
+		phases[i].P95 = report.Latency.P95
+
+		if duration, err := time.ParseDuration(report.Summary.TotalDuration); err == nil {
+			bytes += report.Throughput.BytesPerSecond * duration.Seconds()
+		}
+	}
+	if len(ran) == 0 {
+		return nil, fmt.Errorf("no timeline phase ran")
+	}
+
+	merged, err := MergeReports(ran, sources)
+	if err != nil {
+		return nil, err
+	}
+
+	merged.Metadata.Scenario = name
+	merged.Metadata.Duration = elapsed.String()
+	merged.Configuration.Duration = elapsed.String()
+	merged.Summary.TotalDuration = elapsed.String()
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		merged.Throughput.RequestsPerSecond = float64(merged.Summary.TotalRequests) / seconds
+		merged.Throughput.BytesPerSecond = bytes / seconds
+	}
+	merged.Timeline = phases
+
+	return merged, nil
+}
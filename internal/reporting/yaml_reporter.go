@@ -0,0 +1,35 @@
+package reporting
+
+import (
+	"fmt"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLReporter generates YAML reports
+type YAMLReporter struct {
+	*JSONReporter
+}
+
+// NewYAMLReporter creates a new YAML reporter
+func NewYAMLReporter(config *config.LoadTestConfig) *YAMLReporter {
+	return &YAMLReporter{
+		JSONReporter: NewJSONReporter(config),
+	}
+}
+
+// WriteReport writes the report as YAML to a file or stdout
+func (r *YAMLReporter) WriteReport(report *Report, outfile string) error {
+	data, err := reportToMap(report)
+	if err != nil {
+		return err
+	}
+
+	yamlData, err := yaml.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal report to YAML: %w", err)
+	}
+
+	return writeOutput(yamlData, outfile)
+}
@@ -0,0 +1,287 @@
+package scripting
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// LuaScript runs wrk-compatible Lua scripts.
+//
+// The global "wrk" table exposes method, path, headers and body. Changes made
+// to it at load time become the defaults of every request. An optional
+// request() function returns a raw request built with wrk.format(), and an
+// optional response(status, headers, body) function can return false or an
+// error message to mark the response as failed.
+type LuaScript struct {
+	path     string
+	state    *lua.LState
+	defaults *luaDefaults
+}
+
+// luaDefaults holds request overrides set at script load time
+type luaDefaults struct {
+	method  string
+	path    string
+	body    string
+	headers map[string]string
+}
+
+// NewLuaScript loads a Lua script from path
+func NewLuaScript(path string) (*LuaScript, error) {
+	state := lua.NewState()
+
+	script := &LuaScript{
+		path:  path,
+		state: state,
+	}
+	script.registerWrkTable()
+
+	if err := state.DoFile(path); err != nil {
+		state.Close()
+		return nil, fmt.Errorf("failed to load Lua script %s: %w", path, err)
+	}
+
+	script.defaults = script.readWrkTable()
+
+	return script, nil
+}
+
+// TransformRequest applies load-time overrides and the request() hook
+func (s *LuaScript) TransformRequest(req *protocols.Request) error {
+	s.applyDefaults(req)
+
+	fn := s.state.GetGlobal("request")
+	if fn.Type() != lua.LTFunction {
+		return nil
+	}
+
+	s.writeWrkTable(req)
+	if err := s.state.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}); err != nil {
+		return fmt.Errorf("lua request() failed: %w", err)
+	}
+
+	result := s.state.Get(-1)
+	s.state.Pop(1)
+
+	if result.Type() != lua.LTString {
+		return fmt.Errorf("lua request() must return a string built with wrk.format()")
+	}
+
+	return applyRawRequest(req, result.String())
+}
+
+// ProcessResponse calls the response(status, headers, body) hook
+func (s *LuaScript) ProcessResponse(resp *protocols.Response) error {
+	fn := s.state.GetGlobal("response")
+	if fn.Type() != lua.LTFunction {
+		return nil
+	}
+
+	headers := s.state.NewTable()
+	for key, value := range resp.Headers {
+		headers.RawSetString(key, lua.LString(value))
+	}
+
+	err := s.state.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true},
+		lua.LNumber(resp.StatusCode), headers, lua.LString(resp.Body))
+	if err != nil {
+		return fmt.Errorf("lua response() failed: %w", err)
+	}
+
+	result := s.state.Get(-1)
+	s.state.Pop(1)
+
+	switch value := result.(type) {
+	case lua.LBool:
+		if !bool(value) {
+			return fmt.Errorf("lua response() rejected the response")
+		}
+	case lua.LString:
+		if value != "" {
+			return fmt.Errorf("%s", string(value))
+		}
+	}
+
+	return nil
+}
+
+// Close releases the Lua state
+func (s *LuaScript) Close() error {
+	s.state.Close()
+	return nil
+}
+
+// registerWrkTable installs the wrk compatibility table
+func (s *LuaScript) registerWrkTable() {
+	wrk := s.state.NewTable()
+	wrk.RawSetString("method", lua.LString(""))
+	wrk.RawSetString("path", lua.LString(""))
+	wrk.RawSetString("body", lua.LNil)
+	wrk.RawSetString("headers", s.state.NewTable())
+	wrk.RawSetString("format", s.state.NewFunction(luaFormat))
+	s.state.SetGlobal("wrk", wrk)
+}
+
+// readWrkTable captures the request fields the script set at load time
+func (s *LuaScript) readWrkTable() *luaDefaults {
+	wrk, ok := s.state.GetGlobal("wrk").(*lua.LTable)
+	if !ok {
+		return &luaDefaults{}
+	}
+
+	defaults := &luaDefaults{
+		method:  lua.LVAsString(wrk.RawGetString("method")),
+		path:    lua.LVAsString(wrk.RawGetString("path")),
+		body:    lua.LVAsString(wrk.RawGetString("body")),
+		headers: make(map[string]string),
+	}
+	if headers, ok := wrk.RawGetString("headers").(*lua.LTable); ok {
+		headers.ForEach(func(key, value lua.LValue) {
+			defaults.headers[key.String()] = value.String()
+		})
+	}
+
+	return defaults
+}
+
+// writeWrkTable exposes the current request through the wrk table
+func (s *LuaScript) writeWrkTable(req *protocols.Request) {
+	wrk, ok := s.state.GetGlobal("wrk").(*lua.LTable)
+	if !ok {
+		return
+	}
+
+	headers := s.state.NewTable()
+	for key, value := range req.Headers {
+		headers.RawSetString(key, lua.LString(value))
+	}
+
+	wrk.RawSetString("method", lua.LString(req.Method))
+	wrk.RawSetString("path", lua.LString(requestPath(req.URL)))
+	wrk.RawSetString("headers", headers)
+	wrk.RawSetString("body", lua.LString(req.Body))
+}
+
+// applyDefaults applies the load-time wrk table overrides to req
+func (s *LuaScript) applyDefaults(req *protocols.Request) {
+	if s.defaults.method != "" {
+		req.Method = s.defaults.method
+	}
+	if s.defaults.path != "" {
+		req.URL = replacePath(req.URL, s.defaults.path)
+	}
+	if s.defaults.body != "" {
+		req.Body = []byte(s.defaults.body)
+	}
+	if len(s.defaults.headers) > 0 {
+		headers := make(map[string]string, len(req.Headers)+len(s.defaults.headers))
+		for key, value := range req.Headers {
+			headers[key] = value
+		}
+		for key, value := range s.defaults.headers {
+			headers[key] = value
+		}
+		req.Headers = headers
+	}
+}
+
+// luaFormat implements wrk.format(method, path, headers, body); nil
+// arguments default to the current values of the wrk table
+func luaFormat(L *lua.LState) int {
+	wrk, ok := L.GetGlobal("wrk").(*lua.LTable)
+	if !ok {
+		wrk = L.NewTable()
+	}
+	defaultHeaders, ok := wrk.RawGetString("headers").(*lua.LTable)
+	if !ok {
+		defaultHeaders = L.NewTable()
+	}
+
+	method := L.OptString(1, lua.LVAsString(wrk.RawGetString("method")))
+	path := L.OptString(2, lua.LVAsString(wrk.RawGetString("path")))
+	headers := L.OptTable(3, defaultHeaders)
+	body := L.OptString(4, lua.LVAsString(wrk.RawGetString("body")))
+
+	if method == "" {
+		method = "GET"
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", method, path)
+
+	keys := make([]string, 0)
+	headers.ForEach(func(key, _ lua.LValue) {
+		keys = append(keys, key.String())
+	})
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.EqualFold(key, "Content-Length") {
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %s\r\n", key, headers.RawGetString(key).String())
+	}
+	if body != "" {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n", len(body))
+	}
+	b.WriteString("\r\n")
+	b.WriteString(body)
+
+	L.Push(lua.LString(b.String()))
+	return 1
+}
+
+// applyRawRequest replaces req fields with those of a raw HTTP/1.1 request
+func applyRawRequest(req *protocols.Request, raw string) error {
+	parsed, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		return fmt.Errorf("invalid request returned by lua request(): %w", err)
+	}
+
+	body, err := io.ReadAll(parsed.Body)
+	if err != nil {
+		return fmt.Errorf("invalid request body returned by lua request(): %w", err)
+	}
+
+	headers := make(map[string]string, len(parsed.Header))
+	for key, values := range parsed.Header {
+		if len(values) > 0 && key != "Content-Length" {
+			headers[key] = values[0]
+		}
+	}
+
+	req.Method = parsed.Method
+	req.URL = replacePath(req.URL, parsed.RequestURI)
+	req.Headers = headers
+	req.Body = body
+
+	return nil
+}
+
+// requestPath returns the path and query of a URL
+func requestPath(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return parsed.RequestURI()
+}
+
+// replacePath swaps the path and query of rawURL with path
+func replacePath(rawURL, path string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return path
+	}
+	return parsed.Scheme + "://" + parsed.Host + path
+}
@@ -0,0 +1,34 @@
+package scripting
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexandredias/gotsunami/internal/protocols"
+)
+
+// Script hooks into request construction and response handling. Script
+// instances are not safe for concurrent use; each worker loads its own.
+type Script interface {
+	// TransformRequest may modify the request before it is sent
+	TransformRequest(req *protocols.Request) error
+
+	// ProcessResponse inspects a response; a non-nil error marks it as failed
+	ProcessResponse(resp *protocols.Response) error
+
+	// Close releases script resources
+	Close() error
+}
+
+// Load loads a script, selecting the engine from the file extension
+func Load(path string) (Script, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".lua":
+		return NewLuaScript(path)
+	case ".wasm":
+		return NewWasmScript(path)
+	default:
+		return nil, fmt.Errorf("unsupported script type: %s", path)
+	}
+}
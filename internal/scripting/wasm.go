@@ -0,0 +1,281 @@
+package scripting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+const (
+	// wasmMemoryLimitPages caps guest memory at 64 MiB
+	wasmMemoryLimitPages = 1024
+
+	// wasmCallTimeout bounds a single hook call
+	wasmCallTimeout = time.Second
+)
+
+// wasmCompilationCache shares compiled modules between worker instances
+var wasmCompilationCache = wazero.NewCompilationCache()
+
+// WasmScript runs request and response hooks exported by a WASM module.
+//
+// Modules run sandboxed: no filesystem, network, environment or clock access
+// beyond what WASI exposes by default, bounded memory and a per-call timeout.
+// A module exports its linear memory and alloc(size) -> ptr. Hooks receive a
+// JSON document as (ptr, len) and return (ptr << 32 | len) of a JSON request
+// or an error message, or 0 for no change:
+//
+//	transform_request(ptr, len) -> i64
+//	validate_response(ptr, len) -> i64
+//
+// An optional free(ptr) export is called for every buffer the host is done with.
+// A call that times out closes the module, which is instantiated again
+// before the next call.
+type WasmScript struct {
+	path      string
+	runtime   wazero.Runtime
+	compiled  wazero.CompiledModule
+	module    api.Module
+	alloc     api.Function
+	free      api.Function
+	transform api.Function
+	validate  api.Function
+}
+
+// wasmRequest is the request document exchanged with WASM hooks
+type wasmRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// wasmResponse is the response document passed to validate_response
+type wasmResponse struct {
+	Status         int               `json:"status"`
+	Headers        map[string]string `json:"headers"`
+	Body           string            `json:"body"`
+	ResponseTimeMs float64           `json:"response_time_ms"`
+}
+
+// NewWasmScript loads a WASM module from path
+func NewWasmScript(path string) (*WasmScript, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WASM module %s: %w", path, err)
+	}
+
+	ctx := context.Background()
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCompilationCache(wasmCompilationCache).
+		WithMemoryLimitPages(wasmMemoryLimitPages).
+		WithCloseOnContextDone(true))
+
+	script := &WasmScript{path: path, runtime: runtime}
+	if err := script.instantiate(ctx, code); err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("failed to load WASM module %s: %w", path, err)
+	}
+
+	return script, nil
+}
+
+// instantiate compiles and starts the module
+func (s *WasmScript) instantiate(ctx context.Context, code []byte) error {
+	// WASI is needed by modules built with Go or TinyGo; it gets no
+	// filesystem, environment or arguments
+	wasi_snapshot_preview1.MustInstantiate(ctx, s.runtime)
+
+	compiled, err := s.runtime.CompileModule(ctx, code)
+	if err != nil {
+		return err
+	}
+	s.compiled = compiled
+
+	return s.start(ctx)
+}
+
+// start instantiates the compiled module, resolving its exports. Instances
+// are anonymous so a new one can replace a closed one.
+func (s *WasmScript) start(ctx context.Context) error {
+	module, err := s.runtime.InstantiateModule(ctx, s.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize"))
+	if err != nil {
+		return err
+	}
+	s.module = module
+
+	if module.Memory() == nil {
+		return errors.New("module must export its memory")
+	}
+	if s.alloc = module.ExportedFunction("alloc"); s.alloc == nil {
+		return errors.New("module must export alloc(size)")
+	}
+	s.free = module.ExportedFunction("free")
+	s.transform = module.ExportedFunction("transform_request")
+	s.validate = module.ExportedFunction("validate_response")
+
+	if s.transform == nil && s.validate == nil {
+		return errors.New("module exports neither transform_request nor validate_response")
+	}
+
+	return nil
+}
+
+// TransformRequest passes the request through transform_request
+func (s *WasmScript) TransformRequest(req *protocols.Request) error {
+	if s.transform == nil {
+		return nil
+	}
+
+	input, err := json.Marshal(wasmRequest{
+		Method:  req.Method,
+		URL:     req.URL,
+		Headers: req.Headers,
+		Body:    string(req.Body),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.restart(); err != nil {
+		return err
+	}
+	output, err := s.call(s.transform, input)
+	if err != nil {
+		return fmt.Errorf("wasm transform_request failed: %w", err)
+	}
+	if output == nil {
+		return nil
+	}
+
+	var transformed wasmRequest
+	if err := json.Unmarshal(output, &transformed); err != nil {
+		return fmt.Errorf("wasm transform_request returned invalid JSON: %w", err)
+	}
+
+	if transformed.Method != "" {
+		req.Method = transformed.Method
+	}
+	if transformed.URL != "" {
+		req.URL = transformed.URL
+	}
+	if transformed.Headers != nil {
+		req.Headers = transformed.Headers
+	}
+	req.Body = []byte(transformed.Body)
+
+	return nil
+}
+
+// ProcessResponse passes the response through validate_response
+func (s *WasmScript) ProcessResponse(resp *protocols.Response) error {
+	if s.validate == nil {
+		return nil
+	}
+
+	input, err := json.Marshal(wasmResponse{
+		Status:         resp.StatusCode,
+		Headers:        resp.Headers,
+		Body:           string(resp.Body),
+		ResponseTimeMs: float64(resp.ResponseTime) / float64(time.Millisecond),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.restart(); err != nil {
+		return err
+	}
+	output, err := s.call(s.validate, input)
+	if err != nil {
+		return fmt.Errorf("wasm validate_response failed: %w", err)
+	}
+	if output != nil {
+		return fmt.Errorf("wasm validation failed: %s", output)
+	}
+
+	return nil
+}
+
+// Close releases the module and its runtime
+func (s *WasmScript) Close() error {
+	return s.runtime.Close(context.Background())
+}
+
+// restart instantiates the module again when a call that exceeded its
+// timeout closed it, dropping whatever state the hook left half updated
+func (s *WasmScript) restart() error {
+	if !s.module.IsClosed() {
+		return nil
+	}
+	if err := s.start(context.Background()); err != nil {
+		return fmt.Errorf("failed to restart WASM module %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// call copies input into guest memory, invokes fn and returns a copy of the
+// result buffer, or nil when the hook returned 0
+func (s *WasmScript) call(fn api.Function, input []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), wasmCallTimeout)
+	defer cancel()
+
+	size := uint64(len(input))
+	if size == 0 {
+		size = 1
+	}
+
+	results, err := s.alloc.Call(ctx, size)
+	if err != nil {
+		return nil, err
+	}
+	inputPtr := uint32(results[0])
+	defer s.release(inputPtr)
+
+	memory := s.module.Memory()
+	if !memory.Write(inputPtr, input) {
+		return nil, errors.New("input buffer out of range")
+	}
+
+	results, err = fn.Call(ctx, uint64(inputPtr), uint64(len(input)))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("hook exceeded %v", wasmCallTimeout)
+		}
+		return nil, err
+	}
+	if results[0] == 0 {
+		return nil, nil
+	}
+
+	outputPtr := uint32(results[0] >> 32)
+	outputLen := uint32(results[0])
+	defer s.release(outputPtr)
+
+	output, ok := memory.Read(outputPtr, outputLen)
+	if !ok {
+		return nil, errors.New("output buffer out of range")
+	}
+
+	// Read returns a view of guest memory, which later calls may overwrite
+	return append([]byte(nil), output...), nil
+}
+
+// release frees a guest buffer when the module exports free. It runs
+// without the call's deadline, which would close the module once passed;
+// buffers of a module closed by a timeout go with it.
+func (s *WasmScript) release(ptr uint32) {
+	if s.free != nil && !s.module.IsClosed() {
+		s.free.Call(context.Background(), uint64(ptr))
+	}
+}
@@ -0,0 +1,182 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/tidwall/gjson"
+)
+
+// DefaultTimeout bounds each request to a remote secret provider
+const DefaultTimeout = 10 * time.Second
+
+// Resolver reads secrets from their providers
+type Resolver struct {
+	client *http.Client
+	// getenv reads the environment, including the provider settings such as
+	// VAULT_ADDR and the AWS credentials
+	getenv func(string) (string, bool)
+	now    func() time.Time
+}
+
+// NewResolver creates a resolver reading the process environment
+func NewResolver() *Resolver {
+	return &Resolver{
+		client: &http.Client{Timeout: DefaultTimeout},
+		getenv: os.LookupEnv,
+		now:    time.Now,
+	}
+}
+
+// Resolve reads every secret of a scenario by name. Errors name the secret
+// but never include a value.
+func (r *Resolver) Resolve(ctx context.Context, references map[string]string) (map[string]string, error) {
+	if len(references) == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(references))
+	for name := range references {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make(map[string]string, len(references))
+	for _, name := range names {
+		value, err := r.resolve(ctx, references[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret %s: %w", name, err)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// resolve reads one secret
+func (r *Resolver) resolve(ctx context.Context, reference string) (string, error) {
+	provider, location, key, err := config.ParseSecret(reference)
+	if err != nil {
+		return "", err
+	}
+
+	switch provider {
+	case config.SecretEnv:
+		value, exists := r.getenv(location)
+		if !exists {
+			return "", fmt.Errorf("environment variable %s is not set", location)
+		}
+		return value, nil
+	case config.SecretFile:
+		data, err := os.ReadFile(location)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case config.SecretVault:
+		return r.vault(ctx, location, key)
+	default:
+		return r.aws(ctx, location, key)
+	}
+}
+
+// vault reads a key of a Vault secret, from a KV version 2 engine or any
+// engine returning the key under data
+func (r *Resolver) vault(ctx context.Context, path, key string) (string, error) {
+	address, _ := r.getenv("VAULT_ADDR")
+	token, _ := r.getenv("VAULT_TOKEN")
+	if address == "" || token == "" {
+		return "", fmt.Errorf("VAULT_ADDR and VAULT_TOKEN must be set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(address, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace, _ := r.getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	body, err := r.do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	for _, field := range []string{"data.data.", "data."} {
+		if value := gjson.GetBytes(body, field+gjson.Escape(key)); value.Exists() {
+			return value.String(), nil
+		}
+	}
+	return "", fmt.Errorf("vault secret %s has no key %s", path, key)
+}
+
+// aws reads an AWS Secrets Manager secret, or a key of its JSON value
+func (r *Resolver) aws(ctx context.Context, secretID, key string) (string, error) {
+	credentials, err := r.awsCredentials()
+	if err != nil {
+		return "", err
+	}
+
+	endpoint, _ := r.getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER")
+	if endpoint == "" {
+		endpoint, _ = r.getenv("AWS_ENDPOINT_URL")
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", credentials.region)
+	}
+
+	payload, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", strings.NewReader(string(payload)))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	credentials.sign(req, payload, "secretsmanager", r.now())
+
+	body, err := r.do(req)
+	if err != nil {
+		return "", fmt.Errorf("aws secrets manager: %w", err)
+	}
+	secret := gjson.GetBytes(body, "SecretString")
+	if !secret.Exists() {
+		return "", fmt.Errorf("aws secret %s has no string value", secretID)
+	}
+	if key == "" {
+		return secret.String(), nil
+	}
+	value := gjson.Get(secret.String(), gjson.Escape(key))
+	if !value.Exists() {
+		return "", fmt.Errorf("aws secret %s has no key %s", secretID, key)
+	}
+	return value.String(), nil
+}
+
+// do sends a request to a provider and returns the response body, failing
+// on an error status
+func (r *Resolver) do(req *http.Request) ([]byte, error) {
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return body, nil
+}
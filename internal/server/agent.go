@@ -0,0 +1,320 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/cpu"
+	"github.com/alexandredias/gotsunami/internal/engine"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// Agent status values
+const (
+	AgentStatusIdle = "idle"
+	AgentStatusBusy = "busy"
+)
+
+// Agent is a load generator node taking instructions over HTTP, or gRPC
+// from a coordinator, so a single scenario can be run from several machines
+// when one generator cannot saturate the target. It runs one test at a time and keeps the report of
+// the last one until the next starts.
+type Agent struct {
+	name       string
+	version    string
+	token      string
+	addr       string
+	httpServer *http.Server
+	grpcServer *grpc.Server
+
+	// runs builds and runs the tests, like the API server does
+	runs *Server
+
+	mu      sync.Mutex
+	current *Run
+}
+
+// AgentInfo describes an agent and its current run
+type AgentInfo struct {
+	Name    string   `json:"name"`
+	Version string   `json:"version"`
+	Status  string   `json:"status"`
+	CPUs    float64  `json:"cpus"`
+	Run     *RunInfo `json:"run,omitempty"`
+}
+
+// AgentRunRequest is the payload accepted by POST /api/v1/agent/run: a run
+// request with its scenario inline, and the time every agent starts at
+type AgentRunRequest struct {
+	RunRequest
+	// StartAt delays the load until this time so the agents of a test
+	// start together; a past or missing time starts right away
+	StartAt time.Time `json:"start_at,omitempty"`
+}
+
+// NewAgent creates an agent named name listening on addr for HTTP; see
+// ListenAndServeGRPC for coordinators. When token is set, every request but the
+// health check must carry it as a bearer token.
+func NewAgent(addr, name, version, token string) *Agent {
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+
+	a := &Agent{
+		name:    name,
+		version: version,
+		token:   token,
+		addr:    addr,
+		runs:    NewServer(""),
+	}
+	a.httpServer = &http.Server{
+		Addr:              addr,
+		Handler:           a.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	a.grpcServer = a.newGRPCServer()
+	return a
+}
+
+// SetConfirmVUs changes the number of VUs, workers or connections above
+// which a run must set confirm; 0 disables the limit
+func (a *Agent) SetConfirmVUs(limit int) {
+	a.runs.SetConfirmVUs(limit)
+}
+
+// AllowHostAccess accepts scenarios that run code or read the environment,
+// files and credentials of the agent's host; only for trusted coordinators
+func (a *Agent) AllowHostAccess(allow bool) {
+	a.runs.AllowHostAccess(allow)
+}
+
+// Handler returns the HTTP handler serving the agent API
+func (a *Agent) Handler() http.Handler {
+	return a.httpServer.Handler
+}
+
+// ListenAndServe takes instructions until Shutdown is called
+func (a *Agent) ListenAndServe() error {
+	logrus.Infof("GoTsunami agent %s listening on %s", a.name, a.addr)
+	if err := a.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("agent failed: %w", err)
+	}
+	return nil
+}
+
+// Shutdown stops the current run and gracefully shuts down the agent
+func (a *Agent) Shutdown(ctx context.Context) error {
+	if run := a.Current(); run != nil {
+		run.Stop()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		a.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	err := a.httpServer.Shutdown(ctx)
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		a.grpcServer.Stop()
+	}
+	return err
+}
+
+// Current returns the current or last run, or nil before the first
+func (a *Agent) Current() *Run {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.current
+}
+
+// Info describes the agent and its current run
+func (a *Agent) Info() AgentInfo {
+	info := AgentInfo{
+		Name:    a.name,
+		Version: a.version,
+		Status:  AgentStatusIdle,
+		CPUs:    float64(runtime.NumCPU()),
+	}
+	if limit, ok := cpu.Limit(); ok {
+		info.CPUs = limit
+	}
+	if run := a.Current(); run != nil {
+		runInfo := run.Info()
+		info.Run = &runInfo
+		if runInfo.Status == RunStatusScheduled || runInfo.Status == RunStatusRunning {
+			info.Status = AgentStatusBusy
+		}
+	}
+	return info
+}
+
+// Start runs a test unless the agent is busy with another
+func (a *Agent) Start(req *AgentRunRequest) (*Run, error) {
+	if req.ScenarioID != "" || req.Scenario == nil {
+		return nil, fmt.Errorf("agents take the scenario inline, not scenario_id")
+	}
+	cfg, err := a.runs.buildLoadTestConfig(&req.RunRequest)
+	if err != nil {
+		return nil, err
+	}
+	// Reports of the agents of a test stay apart until merged
+	if _, labeled := cfg.Labels["agent"]; !labeled {
+		labels := make(map[string]string, len(cfg.Labels)+1)
+		for key, value := range cfg.Labels {
+			labels[key] = value
+		}
+		labels["agent"] = a.name
+		cfg.Labels = labels
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.current != nil {
+		if status := a.current.Info().Status; status == RunStatusScheduled || status == RunStatusRunning {
+			return nil, errAgentBusy
+		}
+	}
+
+	run, err := a.runs.ScheduleRun(cfg, req.StartAt)
+	if err != nil {
+		return nil, err
+	}
+	a.current = run
+	logrus.Infof("Agent %s: %s scheduled for %s", a.name, cfg.Scenario.Name, run.Info().StartedAt.Format(time.RFC3339))
+	return run, nil
+}
+
+// errAgentBusy is returned when a run is asked of an agent running another
+var errAgentBusy = errors.New("agent is busy with another run")
+
+// routes builds the agent API router
+func (a *Agent) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/health", a.runs.handleHealth)
+	mux.HandleFunc("/api/v1/agent", a.authorized(a.handleInfo))
+	mux.HandleFunc("/api/v1/agent/run", a.authorized(a.handleRun))
+	mux.HandleFunc("/api/v1/agent/run/", a.authorized(a.handleRunAction))
+	return mux
+}
+
+// authorized rejects requests without the agent token, when it has one
+func (a *Agent) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !validToken(r.Header.Get("Authorization"), a.token) {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid agent token"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// handleInfo describes the agent
+func (a *Agent) handleInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	writeJSON(w, http.StatusOK, a.Info())
+}
+
+// handleRun starts a run or returns the current one
+func (a *Agent) handleRun(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		run := a.Current()
+		if run == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no run yet"))
+			return
+		}
+		writeJSON(w, http.StatusOK, run.Info())
+	case http.MethodPost:
+		data, err := readBody(w, r)
+		if err != nil {
+			writeError(w, readStatus(err), fmt.Errorf("failed to read run request: %w", err))
+			return
+		}
+		var req AgentRunRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("failed to parse run request: %w", err))
+			return
+		}
+		run, err := a.Start(&req)
+		if errors.Is(err, errAgentBusy) {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, run.Info())
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// handleRunAction serves /api/v1/agent/run/{action} with the run endpoints
+// of the API server
+func (a *Agent) handleRunAction(w http.ResponseWriter, r *http.Request) {
+	run := a.Current()
+	if run == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no run yet"))
+		return
+	}
+
+	action := strings.TrimPrefix(r.URL.Path, "/api/v1/agent/run/")
+	switch {
+	case action == "stop" && r.Method == http.MethodPost:
+		run.Stop()
+		writeJSON(w, http.StatusAccepted, run.Info())
+	case action == "vus" && r.Method == http.MethodPost:
+		data, err := readBody(w, r)
+		if err != nil {
+			writeError(w, readStatus(err), fmt.Errorf("failed to read VUs request: %w", err))
+			return
+		}
+		var req struct {
+			VUs     int  `json:"vus"`
+			Confirm bool `json:"confirm"`
+		}
+		if err := json.Unmarshal(data, &req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("failed to parse VUs request: %w", err))
+			return
+		}
+		if err := a.runs.checkConfirmed("VUs", req.VUs, req.Confirm); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := run.SetVUs(req.VUs); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, engine.ErrNotRunning) {
+				status = http.StatusConflict
+			}
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, run.Info())
+	case action == "metrics" && r.Method == http.MethodGet:
+		a.runs.streamMetrics(w, r, run)
+	case action == "report" && r.Method == http.MethodGet:
+		report := run.Report()
+		if report == nil {
+			writeError(w, http.StatusConflict, fmt.Errorf("report not available, run is %s", run.Info().Status))
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown agent endpoint: %s %s", r.Method, r.URL.Path))
+	}
+}
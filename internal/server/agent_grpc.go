@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/reporting"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AgentService is the gRPC service agents expose to a coordinator. Its
+// messages are the JSON payloads of the HTTP agent API, sent with the
+// application/grpc+json content type, so no generated code is involved.
+const AgentService = "gotsunami.agent.v1.Agent"
+
+// jsonCodec encodes gRPC messages as JSON
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return "json" }
+
+// Empty is the message of calls without arguments
+type Empty struct{}
+
+// MetricsRequest asks for the live metrics of the current run every Interval
+// (default 1s)
+type MetricsRequest struct {
+	Interval string `json:"interval,omitempty"`
+}
+
+// AgentMetrics is a live snapshot of the current run of an agent. The last
+// message of a stream has Done set and the final run status.
+type AgentMetrics struct {
+	Run     RunInfo          `json:"run"`
+	Summary *metrics.Summary `json:"summary,omitempty"`
+	Done    bool             `json:"done,omitempty"`
+}
+
+// agentControl is implemented by the agent for the gRPC service
+type agentControl interface {
+	grpcInfo(ctx context.Context, req *Empty) (*AgentInfo, error)
+	grpcRun(ctx context.Context, req *AgentRunRequest) (*RunInfo, error)
+	grpcStop(ctx context.Context, req *Empty) (*RunInfo, error)
+	grpcReport(ctx context.Context, req *Empty) (*reporting.Report, error)
+	grpcMetrics(req *MetricsRequest, stream grpc.ServerStream) error
+}
+
+var agentServiceDesc = grpc.ServiceDesc{
+	ServiceName: AgentService,
+	HandlerType: (*agentControl)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Info", Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := new(Empty)
+			return unary(ctx, dec, req, interceptor, "Info", func(ctx context.Context) (interface{}, error) {
+				return srv.(agentControl).grpcInfo(ctx, req)
+			})
+		}},
+		{MethodName: "Run", Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := new(AgentRunRequest)
+			return unary(ctx, dec, req, interceptor, "Run", func(ctx context.Context) (interface{}, error) {
+				return srv.(agentControl).grpcRun(ctx, req)
+			})
+		}},
+		{MethodName: "Stop", Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := new(Empty)
+			return unary(ctx, dec, req, interceptor, "Stop", func(ctx context.Context) (interface{}, error) {
+				return srv.(agentControl).grpcStop(ctx, req)
+			})
+		}},
+		{MethodName: "Report", Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := new(Empty)
+			return unary(ctx, dec, req, interceptor, "Report", func(ctx context.Context) (interface{}, error) {
+				return srv.(agentControl).grpcReport(ctx, req)
+			})
+		}},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Metrics", ServerStreams: true, Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			req := new(MetricsRequest)
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			return srv.(agentControl).grpcMetrics(req, stream)
+		}},
+	},
+}
+
+// unary decodes the request of a unary call into req and runs call through
+// the interceptor of the server
+func unary(ctx context.Context, dec func(interface{}) error, req interface{}, interceptor grpc.UnaryServerInterceptor,
+	method string, call func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return call(ctx)
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/" + AgentService + "/" + method}
+	return interceptor(ctx, req, info, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return call(ctx)
+	})
+}
+
+// newGRPCServer creates the gRPC server of the agent, checking the token of
+// every call when the agent has one
+func (a *Agent) newGRPCServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(jsonCodec{}),
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := a.checkToken(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := a.checkToken(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	server.RegisterService(&agentServiceDesc, a)
+	return server
+}
+
+// ListenAndServeGRPC takes instructions from a coordinator on addr until
+// Shutdown is called
+func (a *Agent) ListenAndServeGRPC(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("agent failed: %w", err)
+	}
+	return a.ServeGRPC(listener)
+}
+
+// ServeGRPC takes instructions from a coordinator on listener until Shutdown
+func (a *Agent) ServeGRPC(listener net.Listener) error {
+	logrus.Infof("GoTsunami agent %s taking coordinator instructions on %s", a.name, listener.Addr())
+	if err := a.grpcServer.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return fmt.Errorf("agent failed: %w", err)
+	}
+	return nil
+}
+
+// checkToken rejects calls without the agent token, when it has one
+func (a *Agent) checkToken(ctx context.Context) error {
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+	if !validToken(authorization, a.token) {
+		return status.Error(codes.Unauthenticated, "missing or invalid agent token")
+	}
+	return nil
+}
+
+func (a *Agent) grpcInfo(ctx context.Context, req *Empty) (*AgentInfo, error) {
+	info := a.Info()
+	return &info, nil
+}
+
+func (a *Agent) grpcRun(ctx context.Context, req *AgentRunRequest) (*RunInfo, error) {
+	run, err := a.Start(req)
+	if errors.Is(err, errAgentBusy) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	info := run.Info()
+	return &info, nil
+}
+
+func (a *Agent) grpcStop(ctx context.Context, req *Empty) (*RunInfo, error) {
+	run := a.Current()
+	if run == nil {
+		return nil, status.Error(codes.NotFound, "no run yet")
+	}
+	run.Stop()
+	info := run.Info()
+	return &info, nil
+}
+
+func (a *Agent) grpcReport(ctx context.Context, req *Empty) (*reporting.Report, error) {
+	run := a.Current()
+	if run == nil {
+		return nil, status.Error(codes.NotFound, "no run yet")
+	}
+	report := run.Report()
+	if report == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "report not available, run is %s", run.Info().Status)
+	}
+	return report, nil
+}
+
+// grpcMetrics streams the live metrics of the current run until it ends
+func (a *Agent) grpcMetrics(req *MetricsRequest, stream grpc.ServerStream) error {
+	run := a.Current()
+	if run == nil {
+		return status.Error(codes.NotFound, "no run yet")
+	}
+
+	interval := time.Second
+	if req.Interval != "" {
+		parsed, err := time.ParseDuration(req.Interval)
+		if err != nil || parsed <= 0 {
+			return status.Errorf(codes.InvalidArgument, "invalid interval: %s", req.Interval)
+		}
+		interval = parsed
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := stream.SendMsg(&AgentMetrics{Run: run.Info(), Summary: run.Metrics()}); err != nil {
+			return err
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-run.Done():
+			return stream.SendMsg(&AgentMetrics{Run: run.Info(), Summary: run.Metrics(), Done: true})
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+)
+
+// validToken reports whether an Authorization value carries token as a
+// bearer token; any value is valid when there is no token
+func validToken(authorization, token string) bool {
+	if token == "" {
+		return true
+	}
+	given, _ := strings.CutPrefix(authorization, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// IsLoopback reports whether a listen address only accepts connections from
+// the local host; an address without a host listens on every interface
+func IsLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// CheckExposure refuses to listen on a non-loopback address without a
+// token, since scenarios received there run with the generator's network
+// access; insecure skips the check for trusted networks
+func CheckExposure(addr, token string, insecure bool) error {
+	if token != "" || insecure || IsLoopback(addr) {
+		return nil
+	}
+	return fmt.Errorf("refusing to listen on %s without --token; set one, listen on 127.0.0.1 or pass --insecure on a trusted network", addr)
+}
+
+// checkHostAccess rejects scenarios that reach into the host, unless allowed
+func checkHostAccess(scenario *config.Scenario, allowed bool) error {
+	if allowed {
+		return nil
+	}
+	if access := scenario.HostAccess(); len(access) > 0 {
+		return fmt.Errorf("scenario uses %s, which scenarios received over the network may not (see --allow-host-access)",
+			strings.Join(access, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,392 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/reporting"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// DefaultStartDelay is how far ahead a coordinator schedules the start, so
+// every agent has the run before the load begins
+const DefaultStartDelay = 5 * time.Second
+
+// AgentClient calls the gRPC service of an agent
+type AgentClient struct {
+	addr  string
+	token string
+	conn  *grpc.ClientConn
+}
+
+// DialAgent connects to the agent at addr; the connection is opened lazily
+func DialAgent(addr, token string) (*AgentClient, error) {
+	conn, err := grpc.Dial(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(jsonCodec{})),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial agent %s: %w", addr, err)
+	}
+	return &AgentClient{addr: addr, token: token, conn: conn}, nil
+}
+
+// Addr returns the address of the agent
+func (c *AgentClient) Addr() string {
+	return c.addr
+}
+
+// Close closes the connection to the agent
+func (c *AgentClient) Close() error {
+	return c.conn.Close()
+}
+
+// context adds the agent token to ctx
+func (c *AgentClient) context(ctx context.Context) context.Context {
+	if c.token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token)
+}
+
+// invoke calls a unary method of the agent service
+func (c *AgentClient) invoke(ctx context.Context, method string, req, resp interface{}) error {
+	if err := c.conn.Invoke(c.context(ctx), "/"+AgentService+"/"+method, req, resp); err != nil {
+		return fmt.Errorf("agent %s: %w", c.addr, err)
+	}
+	return nil
+}
+
+// Info describes the agent
+func (c *AgentClient) Info(ctx context.Context) (*AgentInfo, error) {
+	var info AgentInfo
+	return &info, c.invoke(ctx, "Info", &Empty{}, &info)
+}
+
+// Run starts a run on the agent
+func (c *AgentClient) Run(ctx context.Context, req *AgentRunRequest) (*RunInfo, error) {
+	var info RunInfo
+	return &info, c.invoke(ctx, "Run", req, &info)
+}
+
+// Stop stops the current run of the agent
+func (c *AgentClient) Stop(ctx context.Context) (*RunInfo, error) {
+	var info RunInfo
+	return &info, c.invoke(ctx, "Stop", &Empty{}, &info)
+}
+
+// Report fetches the report of the last run of the agent
+func (c *AgentClient) Report(ctx context.Context) (*reporting.Report, error) {
+	var report reporting.Report
+	return &report, c.invoke(ctx, "Report", &Empty{}, &report)
+}
+
+// Metrics calls fn with the live metrics of the current run every interval
+// until the run ends, returning its final status
+func (c *AgentClient) Metrics(ctx context.Context, interval time.Duration, fn func(*AgentMetrics)) (*RunInfo, error) {
+	desc := &grpc.StreamDesc{StreamName: "Metrics", ServerStreams: true}
+	stream, err := c.conn.NewStream(c.context(ctx), desc, "/"+AgentService+"/Metrics")
+	if err != nil {
+		return nil, fmt.Errorf("agent %s: %w", c.addr, err)
+	}
+	if err := stream.SendMsg(&MetricsRequest{Interval: interval.String()}); err != nil {
+		return nil, fmt.Errorf("agent %s: %w", c.addr, err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, fmt.Errorf("agent %s: %w", c.addr, err)
+	}
+
+	for {
+		var snapshot AgentMetrics
+		if err := stream.RecvMsg(&snapshot); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("agent %s: metrics stream ended: %w", c.addr, err)
+		}
+		fn(&snapshot)
+		if snapshot.Done {
+			return &snapshot.Run, nil
+		}
+	}
+}
+
+// Coordinator splits a test across agents, starts them together, follows
+// their live metrics and merges their reports into one
+type Coordinator struct {
+	agents []*AgentClient
+	// StartDelay is how long after the runs are sent the load starts
+	StartDelay time.Duration
+	// Interval is how often live metrics are aggregated and logged
+	Interval time.Duration
+	// OnMetrics, when set, receives the aggregated live metrics
+	OnMetrics func(*metrics.Summary)
+}
+
+// NewCoordinator creates a coordinator of the agents
+func NewCoordinator(agents []*AgentClient) *Coordinator {
+	return &Coordinator{agents: agents, StartDelay: DefaultStartDelay, Interval: time.Second}
+}
+
+// Run runs req, a run request with its scenario inline and the total VUs,
+// on the agents and returns their merged report. VUs and arrival rates are
+// split in proportion to the CPUs of each agent. Cancelling ctx stops every
+// agent; their partial reports are still merged.
+func (c *Coordinator) Run(ctx context.Context, req RunRequest) (*reporting.Report, error) {
+	if req.Scenario == nil {
+		return nil, fmt.Errorf("scenario is required")
+	}
+	if req.VirtualUsers <= 0 {
+		return nil, fmt.Errorf("virtual users must be positive")
+	}
+
+	infos := make([]*AgentInfo, len(c.agents))
+	cpus := make([]float64, len(c.agents))
+	for i, agent := range c.agents {
+		info, err := agent.Info(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if info.Status == AgentStatusBusy {
+			return nil, fmt.Errorf("agent %s (%s) is busy with another run", info.Name, agent.Addr())
+		}
+		infos[i], cpus[i] = info, info.CPUs
+	}
+
+	// Agents left without VUs sit this test out
+	shares := SplitVUs(req.VirtualUsers, cpus)
+	var agents []*AgentClient
+	var names []string
+	var requests []*AgentRunRequest
+	startAt := time.Now().Add(c.StartDelay).UTC()
+	for i, agent := range c.agents {
+		if shares[i] == 0 {
+			logrus.Infof("Agent %s gets no VUs and sits this test out", infos[i].Name)
+			continue
+		}
+		agentReq := &AgentRunRequest{RunRequest: req, StartAt: startAt}
+		agentReq.VirtualUsers = shares[i]
+		agentReq.Scenario = scaleStages(req.Scenario, float64(shares[i])/float64(req.VirtualUsers))
+		agents = append(agents, agent)
+		names = append(names, infos[i].Name)
+		requests = append(requests, agentReq)
+	}
+
+	// Send every run before the load starts; one refusal cancels the test
+	for i, agent := range agents {
+		if _, err := agent.Run(ctx, requests[i]); err != nil {
+			for _, started := range agents[:i] {
+				started.Stop(context.Background())
+			}
+			return nil, err
+		}
+		logrus.Infof("Agent %s: %d VUs starting at %s", names[i], requests[i].VirtualUsers, startAt.Format(time.RFC3339))
+	}
+
+	// Stop every agent when the coordinator is interrupted, or when it can
+	// no longer follow one of them
+	var stopOnce sync.Once
+	stopAgents := func() {
+		stopOnce.Do(func() {
+			logrus.Info("Stopping the agents...")
+			for _, agent := range agents {
+				if _, err := agent.Stop(context.Background()); err != nil {
+					logrus.WithError(err).Warn("Failed to stop agent")
+				}
+			}
+		})
+	}
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stopAgents()
+		case <-stopped:
+		}
+	}()
+
+	if err := c.follow(agents, names, stopAgents); err != nil {
+		stopAgents()
+		return nil, err
+	}
+
+	// An agent whose report cannot be fetched is left out of the merge
+	reports := make([]*reporting.Report, 0, len(agents))
+	sources := make([]string, 0, len(agents))
+	for i, agent := range agents {
+		report, err := agent.Report(context.Background())
+		if err != nil {
+			stopAgents()
+			logrus.WithError(err).Warnf("Failed to fetch the report of agent %s; it is left out", names[i])
+			continue
+		}
+		if report.LatencyHistogram == nil {
+			logrus.Warnf("Agent %s sent no requests; its report is left out", names[i])
+			continue
+		}
+		reports = append(reports, report)
+		sources = append(sources, names[i])
+	}
+	if len(reports) == 0 {
+		return nil, fmt.Errorf("no agent sent any request")
+	}
+	return reporting.MergeReports(reports, sources)
+}
+
+// follow aggregates the live metrics of the agents until every run ends.
+// When the run or the metrics stream of an agent fails, stop is called so
+// the others end rather than load the target with nobody following them.
+func (c *Coordinator) follow(agents []*AgentClient, names []string, stop func()) error {
+	var mu sync.Mutex
+	latest := make([]*metrics.Summary, len(agents))
+	failures := make([]error, len(agents))
+
+	var wg sync.WaitGroup
+	for i, agent := range agents {
+		wg.Add(1)
+		go func(i int, agent *AgentClient) {
+			defer wg.Done()
+			info, err := agent.Metrics(context.Background(), c.Interval, func(snapshot *AgentMetrics) {
+				mu.Lock()
+				latest[i] = snapshot.Summary
+				mu.Unlock()
+			})
+			if err == nil && info.Error != "" {
+				err = fmt.Errorf("agent %s: %s", names[i], info.Error)
+			}
+			if err != nil {
+				logrus.WithError(err).Warnf("Agent %s failed", names[i])
+				stop()
+			}
+			failures[i] = err
+		}(i, agent)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return errors.Join(failures...)
+		case <-ticker.C:
+			mu.Lock()
+			summary := AggregateSummaries(latest)
+			mu.Unlock()
+			if c.OnMetrics != nil {
+				c.OnMetrics(summary)
+				continue
+			}
+			if summary.TotalRequests > 0 && summary.Latency != nil {
+				logrus.Infof("%d agents: %d requests, %.2f%% success, %.1f req/s, p95 %v",
+					len(agents), summary.TotalRequests, summary.SuccessRate, summary.RequestsPerSecond, summary.Latency.P95)
+			}
+		}
+	}
+}
+
+// AggregateSummaries combines the live summaries of several agents: counts
+// and throughput are summed, latency comes from the merged histograms
+func AggregateSummaries(summaries []*metrics.Summary) *metrics.Summary {
+	aggregate := &metrics.Summary{StatusCodes: make(map[int]int64)}
+	var histogram *metrics.Histogram
+	for _, summary := range summaries {
+		if summary == nil {
+			continue
+		}
+		aggregate.TotalRequests += summary.TotalRequests
+		aggregate.SuccessfulRequests += summary.SuccessfulRequests
+		aggregate.FailedRequests += summary.FailedRequests
+		aggregate.TransportErrors += summary.TransportErrors
+		aggregate.HTTPErrors += summary.HTTPErrors
+		aggregate.TotalBytes += summary.TotalBytes
+		aggregate.RequestsPerSecond += summary.RequestsPerSecond
+		aggregate.BytesPerSecond += summary.BytesPerSecond
+		for code, count := range summary.StatusCodes {
+			aggregate.StatusCodes[code] += count
+		}
+		if summary.Histogram != nil {
+			if histogram == nil {
+				histogram = metrics.NewHistogram(summary.Histogram.Precision)
+			}
+			histogram.Merge(metrics.NewHistogramFromSnapshot(summary.Histogram))
+		}
+	}
+	if aggregate.TotalRequests > 0 {
+		aggregate.SuccessRate = float64(aggregate.SuccessfulRequests) / float64(aggregate.TotalRequests) * 100
+	}
+	if histogram != nil && histogram.Count() > 0 {
+		aggregate.Latency = metrics.HistogramLatencyStats(histogram)
+		aggregate.Histogram = histogram.Snapshot()
+	}
+	return aggregate
+}
+
+// SplitVUs splits vus among agents in proportion to their CPUs, giving the
+// remainder to the largest fractions. Agents reporting no CPUs count as one.
+func SplitVUs(vus int, cpus []float64) []int {
+	shares := make([]int, len(cpus))
+	if len(cpus) == 0 {
+		return shares
+	}
+
+	var total float64
+	weights := make([]float64, len(cpus))
+	for i, count := range cpus {
+		weights[i] = math.Max(count, 1)
+		total += weights[i]
+	}
+
+	remainders := make([]int, len(cpus))
+	assigned := 0
+	for i, weight := range weights {
+		exact := float64(vus) * weight / total
+		shares[i] = int(exact)
+		assigned += shares[i]
+		remainders[i] = i
+	}
+	sort.SliceStable(remainders, func(a, b int) bool {
+		fa := float64(vus)*weights[remainders[a]]/total - float64(shares[remainders[a]])
+		fb := float64(vus)*weights[remainders[b]]/total - float64(shares[remainders[b]])
+		return fa > fb
+	})
+	for i := 0; assigned < vus; i++ {
+		shares[remainders[i%len(remainders)]]++
+		assigned++
+	}
+	return shares
+}
+
+// scaleStages returns scenario with the targets of its arrival-rate stages
+// scaled by share, so the agents together start iterations at the full rate
+func scaleStages(scenario *config.Scenario, share float64) *config.Scenario {
+	if len(scenario.Stages) == 0 || share == 1 {
+		return scenario
+	}
+	scaled := *scenario
+	scaled.Stages = make([]config.StageConfig, len(scenario.Stages))
+	for i, stage := range scenario.Stages {
+		scaled.Stages[i] = stage
+		if rate, err := stage.GetTarget(); err == nil {
+			scaled.Stages[i].Target = strconv.FormatFloat(rate*share, 'f', -1, 64) + "/s"
+		}
+	}
+	return &scaled
+}
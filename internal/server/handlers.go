@@ -0,0 +1,453 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/engine"
+	"github.com/sirupsen/logrus"
+)
+
+// maxRequestSize caps the body of an API request, such as a scenario
+const maxRequestSize = 10 << 20
+
+// RunRequest is the payload accepted by POST /api/v1/runs
+type RunRequest struct {
+	ScenarioID    string            `json:"scenario_id,omitempty"`
+	Scenario      *config.Scenario  `json:"scenario,omitempty"`
+	VirtualUsers  int               `json:"vus,omitempty"`
+	Duration      string            `json:"duration,omitempty"`
+	RampUp        string            `json:"ramp_up,omitempty"`
+	RampDown      string            `json:"ramp_down,omitempty"`
+	Delay         string            `json:"delay,omitempty"`
+	MaxRequests   int               `json:"max_requests,omitempty"`
+	Timeout       string            `json:"timeout,omitempty"`
+	Drain         string            `json:"drain,omitempty"`
+	Pattern       string            `json:"pattern,omitempty"`
+	Seed          int64             `json:"seed,omitempty"`
+	SkipPreflight bool              `json:"skip_preflight,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Workers       int               `json:"workers,omitempty"`
+	Connections   int               `json:"connections,omitempty"`
+	KeepAlive     *bool             `json:"keep_alive,omitempty"`
+	TLSSkipVerify bool              `json:"tls_skip_verify,omitempty"`
+	Proxy         string            `json:"proxy,omitempty"`
+	UserAgent     string            `json:"user_agent,omitempty"`
+	Bandwidth     string            `json:"bandwidth,omitempty"`
+	GlobalLimit   string            `json:"global_limit,omitempty"`
+	// GlobalLimitToken is the token of the server serving GlobalLimit
+	GlobalLimitToken string `json:"global_limit_token,omitempty"`
+	// HistogramPrecision is the latency histogram precision in bits (0 = default)
+	HistogramPrecision uint `json:"histogram_precision,omitempty"`
+	// Confirm runs a test with more VUs, workers or connections than the
+	// server's --confirm-vus, like --yes on the command line
+	Confirm bool `json:"confirm,omitempty"`
+}
+
+// routes builds the API router
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/health", s.handleHealth)
+	mux.HandleFunc("/api/v1/scenarios", s.authorized(s.handleScenarios))
+	mux.HandleFunc("/api/v1/scenarios/", s.authorized(s.handleScenario))
+	mux.HandleFunc("/api/v1/runs", s.authorized(s.handleRuns))
+	mux.HandleFunc("/api/v1/runs/", s.authorized(s.handleRun))
+	mux.HandleFunc("/api/v1/limits", s.authorized(s.handleLimits))
+	mux.HandleFunc("/api/v1/limits/", s.authorized(s.handleLimit))
+	return mux
+}
+
+// authorized rejects requests without the API token, when it has one
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !validToken(r.Header.Get("Authorization"), s.token) {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid API token"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// handleHealth reports that the API is up
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleScenarios lists or submits scenarios
+func (s *Server) handleScenarios(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.RLock()
+		scenarios := make(map[string]*config.Scenario, len(s.scenarios))
+		for id, scenario := range s.scenarios {
+			scenarios[id] = scenario
+		}
+		s.mu.RUnlock()
+		writeJSON(w, http.StatusOK, scenarios)
+	case http.MethodPost:
+		data, err := readBody(w, r)
+		if err != nil {
+			writeError(w, readStatus(err), fmt.Errorf("failed to read scenario: %w", err))
+			return
+		}
+		if err := config.ValidateScenarioJSON(data); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("scenario does not match the schema: %w", err))
+			return
+		}
+		var scenario config.Scenario
+		if err := json.Unmarshal(data, &scenario); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("failed to parse scenario JSON: %w", err))
+			return
+		}
+		id, err := s.AddScenario(&scenario)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"id": id})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// handleScenario returns a single stored scenario
+func (s *Server) handleScenario(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/scenarios/")
+	scenario, exists := s.GetScenario(id)
+	if !exists {
+		writeError(w, http.StatusNotFound, fmt.Errorf("scenario not found: %s", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, scenario)
+}
+
+// handleRuns lists runs or starts a new one
+func (s *Server) handleRuns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		runs := s.ListRuns()
+		infos := make([]RunInfo, 0, len(runs))
+		for _, run := range runs {
+			infos = append(infos, run.Info())
+		}
+		writeJSON(w, http.StatusOK, infos)
+	case http.MethodPost:
+		data, err := readBody(w, r)
+		if err != nil {
+			writeError(w, readStatus(err), fmt.Errorf("failed to read run request: %w", err))
+			return
+		}
+		var req RunRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("failed to parse run request: %w", err))
+			return
+		}
+		// An inline scenario is checked like one sent to /scenarios
+		var inline struct {
+			Scenario json.RawMessage `json:"scenario"`
+		}
+		if err := json.Unmarshal(data, &inline); err == nil && req.Scenario != nil {
+			if err := config.ValidateScenarioJSON(inline.Scenario); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("scenario does not match the schema: %w", err))
+				return
+			}
+		}
+		cfg, err := s.buildLoadTestConfig(&req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		run, err := s.StartRun(cfg)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, run.Info())
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// handleRun dispatches /api/v1/runs/{id}[/action] requests
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/api/v1/runs/"), "/", 2)
+	run, exists := s.GetRun(parts[0])
+	if !exists {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run not found: %s", parts[0]))
+		return
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, run.Info())
+	case action == "stop" && r.Method == http.MethodPost:
+		run.Stop()
+		writeJSON(w, http.StatusAccepted, run.Info())
+	case action == "vus" && r.Method == http.MethodPost:
+		data, err := readBody(w, r)
+		if err != nil {
+			writeError(w, readStatus(err), fmt.Errorf("failed to read VUs request: %w", err))
+			return
+		}
+		var req struct {
+			VUs     int  `json:"vus"`
+			Confirm bool `json:"confirm"`
+		}
+		if err := json.Unmarshal(data, &req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("failed to parse VUs request: %w", err))
+			return
+		}
+		if err := s.checkConfirmed("VUs", req.VUs, req.Confirm); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := run.SetVUs(req.VUs); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, engine.ErrNotRunning) {
+				status = http.StatusConflict
+			}
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, run.Info())
+	case action == "metrics" && r.Method == http.MethodGet:
+		s.streamMetrics(w, r, run)
+	case action == "report" && r.Method == http.MethodGet:
+		report := run.Report()
+		if report == nil {
+			writeError(w, http.StatusConflict, fmt.Errorf("report not available, run is %s", run.Info().Status))
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown run endpoint: %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// streamMetrics streams live metrics as server-sent events until the run ends.
+// Passing ?stream=false returns a single snapshot instead.
+func (s *Server) streamMetrics(w http.ResponseWriter, r *http.Request, run *Run) {
+	if r.URL.Query().Get("stream") == "false" {
+		writeJSON(w, http.StatusOK, run.Metrics())
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	interval := time.Second
+	if value := r.URL.Query().Get("interval"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid interval: %s", value))
+			return
+		}
+		interval = parsed
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := writeEvent(w, "metrics", run.Metrics()); err != nil {
+			logrus.WithError(err).Debug("Metrics stream closed")
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-run.Done():
+			writeEvent(w, "end", run.Info())
+			flusher.Flush()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// buildLoadTestConfig converts an API run request into a load test configuration,
+// applying the same defaults and precedence as the run command
+func (s *Server) buildLoadTestConfig(req *RunRequest) (*config.LoadTestConfig, error) {
+	scenario := req.Scenario
+	if req.ScenarioID != "" {
+		stored, exists := s.GetScenario(req.ScenarioID)
+		if !exists {
+			return nil, fmt.Errorf("scenario not found: %s", req.ScenarioID)
+		}
+		scenario = stored
+	}
+	if scenario == nil {
+		return nil, fmt.Errorf("either scenario_id or scenario is required")
+	}
+	if err := scenario.Validate(); err != nil {
+		return nil, fmt.Errorf("scenario validation failed: %w", err)
+	}
+	if err := checkHostAccess(scenario, s.allowHostAccess); err != nil {
+		return nil, err
+	}
+
+	cfg := &config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  10,
+		Duration:      30 * time.Second,
+		RampUp:        10 * time.Second,
+		RampDown:      5 * time.Second,
+		Timeout:       30 * time.Second,
+		Drain:         5 * time.Second,
+		Pattern:       "steady",
+		ReportFormat:  "json",
+		Workers:       req.Workers,
+		Connections:   100,
+		KeepAlive:     true,
+		MaxRequests:   req.MaxRequests,
+		TLSSkipVerify: req.TLSSkipVerify,
+		Proxy:         req.Proxy,
+		UserAgent:     "GoTsunami/1.0",
+		GlobalLimit:   req.GlobalLimit,
+
+		GlobalLimitToken:   req.GlobalLimitToken,
+		HistogramPrecision: req.HistogramPrecision,
+	}
+
+	if req.VirtualUsers > 0 {
+		cfg.VirtualUsers = req.VirtualUsers
+	}
+	if req.Pattern != "" {
+		cfg.Pattern = req.Pattern
+	}
+	cfg.Seed = req.Seed
+	cfg.SkipPreflight = req.SkipPreflight
+	cfg.Labels = req.Labels
+	if req.Connections > 0 {
+		cfg.Connections = req.Connections
+	}
+	if req.KeepAlive != nil {
+		cfg.KeepAlive = *req.KeepAlive
+	}
+	if req.UserAgent != "" {
+		cfg.UserAgent = req.UserAgent
+	}
+
+	bandwidth, err := config.ParseBandwidthFlag(req.Bandwidth)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Bandwidth = bandwidth
+
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"duration", req.Duration, &cfg.Duration},
+		{"ramp_up", req.RampUp, &cfg.RampUp},
+		{"ramp_down", req.RampDown, &cfg.RampDown},
+		{"delay", req.Delay, &cfg.Delay},
+		{"timeout", req.Timeout, &cfg.Timeout},
+		{"drain", req.Drain, &cfg.Drain},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s format: %s", d.name, d.value)
+		}
+		*d.dest = parsed
+	}
+
+	// The fields of the request are the flags of the API: they take
+	// precedence over the scenario, which takes precedence over the
+	// defaults. The scenario is copied, as a stored one serves many runs.
+	sources := make(map[string]string)
+	for name, value := range map[string]string{"timeout": req.Timeout, "bandwidth": req.Bandwidth, "pattern": req.Pattern} {
+		if value != "" {
+			sources[name] = config.SourceFlag
+		}
+	}
+	resolved := *scenario
+	cfg.Scenario = &resolved
+	config.ResolveScenarioSettings(cfg, cfg.Scenario, sources)
+
+	// Like the plan limits of the run command, large tests need confirming
+	for _, size := range []struct {
+		name  string
+		value int
+	}{
+		{"VUs", cfg.VirtualUsers},
+		{"workers", cfg.Workers},
+		{"connections", cfg.Connections},
+	} {
+		if err := s.checkConfirmed(size.name, size.value, req.Confirm); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// readBody reads the body of a request, up to maxRequestSize
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	return io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+}
+
+// readStatus returns the status answering a body readBody failed to read
+func readStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// writeEvent writes a single server-sent event
+func writeEvent(w http.ResponseWriter, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logrus.WithError(err).Debug("Failed to write API response")
+	}
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,277 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLeaseTTL is how long an agent keeps its slots without contacting
+// the server. Agents renew well before it expires; a crashed agent's slots
+// return to the pool once it does.
+const DefaultLeaseTTL = 15 * time.Second
+
+// waitWindow is how long an agent denied slots counts as waiting for them
+const waitWindow = time.Second
+
+// LimitRequest is the payload accepted by the acquire and release endpoints
+type LimitRequest struct {
+	Agent string `json:"agent"`
+	Count int    `json:"count"`
+}
+
+// LimitResponse reports the slots an agent holds after a request. Share is
+// the most slots the agent should keep while other agents wait for some.
+type LimitResponse struct {
+	Granted  int    `json:"granted"`
+	Held     int    `json:"held"`
+	Share    int    `json:"share"`
+	LeaseTTL string `json:"lease_ttl"`
+}
+
+// LimitInfo describes a global in-flight limit
+type LimitInfo struct {
+	Name   string         `json:"name"`
+	Limit  int            `json:"limit"`
+	InUse  int            `json:"in_use"`
+	Agents map[string]int `json:"agents"`
+}
+
+// limit is a counting semaphore shared by load generators on several hosts.
+// Each agent leases slots and must hold one for every request in flight, so
+// the aggregate load never exceeds the limit. While some agents wait, slots
+// are shared evenly so a busy agent cannot starve the others.
+type limit struct {
+	mu       sync.Mutex
+	name     string
+	limit    int
+	leaseTTL time.Duration
+	held     map[string]int
+	lastSeen map[string]time.Time
+	waiting  map[string]time.Time
+}
+
+// newLimit creates a limit of size slots
+func newLimit(name string, size int, leaseTTL time.Duration) *limit {
+	return &limit{
+		name:     name,
+		limit:    size,
+		leaseTTL: leaseTTL,
+		held:     make(map[string]int),
+		lastSeen: make(map[string]time.Time),
+		waiting:  make(map[string]time.Time),
+	}
+}
+
+// acquire grants up to count slots to agent and renews its lease. A count of
+// zero only renews the lease.
+func (l *limit) acquire(agent string, count int) (granted, held, share int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.expire()
+	l.lastSeen[agent] = time.Now()
+
+	granted = count
+	if free := l.limit - l.inUse(); granted > free {
+		granted = free
+	}
+	share = l.share(agent)
+	if granted > share-l.held[agent] {
+		granted = share - l.held[agent]
+	}
+	if granted > 0 {
+		l.held[agent] += granted
+	} else {
+		granted = 0
+	}
+
+	if granted < count {
+		l.waiting[agent] = time.Now()
+	} else {
+		delete(l.waiting, agent)
+	}
+
+	return granted, l.held[agent], share
+}
+
+// share returns the most slots agent may hold: all of them, or an even split
+// between the agents holding or waiting for some while another agent waits.
+// The caller must hold the lock.
+func (l *limit) share(agent string) int {
+	active := map[string]bool{agent: true}
+	for other := range l.held {
+		active[other] = true
+	}
+	waiting := false
+	for other := range l.waiting {
+		active[other] = true
+		waiting = waiting || other != agent
+	}
+
+	if !waiting {
+		return l.limit
+	}
+	return (l.limit + len(active) - 1) / len(active)
+}
+
+// release returns up to count slots held by agent
+func (l *limit) release(agent string, count int) (held, share int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.expire()
+	if count > l.held[agent] {
+		count = l.held[agent]
+	}
+	l.held[agent] -= count
+	if l.held[agent] == 0 {
+		delete(l.held, agent)
+		delete(l.lastSeen, agent)
+	} else {
+		l.lastSeen[agent] = time.Now()
+	}
+
+	return l.held[agent], l.share(agent)
+}
+
+// expire reclaims the slots of agents whose lease ran out and forgets agents
+// that stopped waiting. The caller must hold the lock.
+func (l *limit) expire() {
+	for agent, seen := range l.lastSeen {
+		if time.Since(seen) > l.leaseTTL {
+			delete(l.held, agent)
+			delete(l.lastSeen, agent)
+		}
+	}
+	for agent, since := range l.waiting {
+		if time.Since(since) > waitWindow || time.Since(since) > l.leaseTTL {
+			delete(l.waiting, agent)
+		}
+	}
+}
+
+// inUse returns the number of leased slots. The caller must hold the lock.
+func (l *limit) inUse() int {
+	total := 0
+	for _, count := range l.held {
+		total += count
+	}
+	return total
+}
+
+// info returns the current state of the limit
+func (l *limit) info() LimitInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.expire()
+	agents := make(map[string]int, len(l.held))
+	for agent, count := range l.held {
+		agents[agent] = count
+	}
+
+	return LimitInfo{Name: l.name, Limit: l.limit, InUse: l.inUse(), Agents: agents}
+}
+
+// SetLimit declares a global in-flight limit shared by every agent using it.
+// Limits are set by whoever runs the server, not by the agents, so load
+// generators cannot raise a limit agreed with the target's owners.
+func (s *Server) SetLimit(name string, size int) error {
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid limit name: %q", name)
+	}
+	if size <= 0 {
+		return fmt.Errorf("limit %s must be positive", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits[name] = newLimit(name, size, s.leaseTTL)
+
+	return nil
+}
+
+// SetLeaseTTL changes the lease TTL of limits declared afterwards
+func (s *Server) SetLeaseTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leaseTTL = ttl
+}
+
+// handleLimits lists the declared limits
+func (s *Server) handleLimits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	s.mu.RLock()
+	infos := make([]LimitInfo, 0, len(s.limits))
+	for _, l := range s.limits {
+		infos = append(infos, l.info())
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// handleLimit serves a single limit and its acquire and release actions
+func (s *Server) handleLimit(w http.ResponseWriter, r *http.Request) {
+	name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/limits/"), "/")
+
+	s.mu.RLock()
+	l, exists := s.limits[name]
+	s.mu.RUnlock()
+	if !exists {
+		writeError(w, http.StatusNotFound, fmt.Errorf("limit not found: %s", name))
+		return
+	}
+
+	if action == "" {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		writeJSON(w, http.StatusOK, l.info())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	data, err := readBody(w, r)
+	if err != nil {
+		writeError(w, readStatus(err), fmt.Errorf("failed to read limit request: %w", err))
+		return
+	}
+	var req LimitRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to parse limit request: %w", err))
+		return
+	}
+	if req.Agent == "" || req.Count < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("agent and a non-negative count are required"))
+		return
+	}
+
+	resp := LimitResponse{LeaseTTL: l.leaseTTL.String()}
+	switch action {
+	case "acquire":
+		resp.Granted, resp.Held, resp.Share = l.acquire(req.Agent, req.Count)
+	case "release":
+		resp.Held, resp.Share = l.release(req.Agent, req.Count)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown limit action: %s", action))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,410 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/engine"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/reporting"
+	"github.com/sirupsen/logrus"
+)
+
+// Run status values
+const (
+	RunStatusScheduled = "scheduled"
+	RunStatusRunning   = "running"
+	RunStatusCompleted = "completed"
+	RunStatusStopped   = "stopped"
+	RunStatusFailed    = "failed"
+)
+
+// DefaultRunHistory is how many finished runs, with their reports, the
+// server keeps before forgetting the oldest
+const DefaultRunHistory = 100
+
+// DefaultConfirmVUs is the number of VUs, workers or connections above which
+// a run must be confirmed, like --confirm-vus of the run command
+const DefaultConfirmVUs = 1000
+
+// Server exposes GoTsunami functionality over a REST API
+type Server struct {
+	addr       string
+	httpServer *http.Server
+
+	mu        sync.RWMutex
+	scenarios map[string]*config.Scenario
+	runs      map[string]*Run
+	nextID    int
+	// runHistory is how many finished runs are kept
+	runHistory int
+
+	// Global in-flight limits shared by agents on other hosts
+	limits   map[string]*limit
+	leaseTTL time.Duration
+
+	// token is required as a bearer token on every request but the health
+	// check, when set
+	token string
+	// allowHostAccess accepts scenarios that reach into the host, such as
+	// command hooks, scripts or data files (see config.Scenario.HostAccess)
+	allowHostAccess bool
+	// confirmVUs is the number of VUs, workers or connections above which a
+	// run must set confirm; 0 disables the limit
+	confirmVUs int
+}
+
+// Run represents a load test started through the API
+type Run struct {
+	ID string
+
+	mu      sync.RWMutex
+	info    RunInfo
+	engine  *engine.LoadEngine
+	config  *config.LoadTestConfig
+	report  *reporting.Report
+	stopped bool
+	done    chan struct{}
+
+	// startAt delays the load until a time agreed with other agents;
+	// aborted is closed when the run is stopped before it
+	startAt time.Time
+	aborted chan struct{}
+}
+
+// NewServer creates a new API server listening on addr
+func NewServer(addr string) *Server {
+	s := &Server{
+		addr:       addr,
+		scenarios:  make(map[string]*config.Scenario),
+		runs:       make(map[string]*Run),
+		runHistory: DefaultRunHistory,
+		limits:     make(map[string]*limit),
+		leaseTTL:   DefaultLeaseTTL,
+		confirmVUs: DefaultConfirmVUs,
+	}
+
+	s.httpServer = &http.Server{
+		Addr:              addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s
+}
+
+// SetToken requires token as a bearer token on every request but the
+// health check
+func (s *Server) SetToken(token string) {
+	s.token = token
+}
+
+// AllowHostAccess accepts scenarios that run code or read the environment,
+// files and credentials of the host; only for trusted clients
+func (s *Server) AllowHostAccess(allow bool) {
+	s.allowHostAccess = allow
+}
+
+// SetConfirmVUs changes the number of VUs, workers or connections above
+// which a run must set confirm, the --yes of the API; 0 disables the limit
+func (s *Server) SetConfirmVUs(limit int) {
+	s.confirmVUs = limit
+}
+
+// checkConfirmed rejects a size over the confirmation limit unless the
+// request confirmed it
+func (s *Server) checkConfirmed(name string, size int, confirmed bool) error {
+	if confirmed || s.confirmVUs <= 0 || size <= s.confirmVUs {
+		return nil
+	}
+	return fmt.Errorf("%d %s exceeds the limit of %d (--confirm-vus): set \"confirm\": true to run it", size, name, s.confirmVUs)
+}
+
+// SetRunHistory changes how many finished runs are kept; older ones are
+// forgotten as new runs start
+func (s *Server) SetRunHistory(runs int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runHistory = runs
+}
+
+// Handler returns the HTTP handler serving the API
+func (s *Server) Handler() http.Handler {
+	return s.httpServer.Handler
+}
+
+// ListenAndServe starts serving the API until Shutdown is called
+func (s *Server) ListenAndServe() error {
+	logrus.Infof("GoTsunami API listening on %s", s.addr)
+	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("API server failed: %w", err)
+	}
+	return nil
+}
+
+// Shutdown stops active runs and gracefully shuts down the HTTP server
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.RLock()
+	for _, run := range s.runs {
+		run.Stop()
+	}
+	s.mu.RUnlock()
+
+	return s.httpServer.Shutdown(ctx)
+}
+
+// AddScenario stores a validated scenario and returns its identifier
+func (s *Server) AddScenario(scenario *config.Scenario) (string, error) {
+	if err := scenario.Validate(); err != nil {
+		return "", fmt.Errorf("scenario validation failed: %w", err)
+	}
+	if err := checkHostAccess(scenario, s.allowHostAccess); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	id := fmt.Sprintf("scn-%d", s.nextID)
+	s.scenarios[id] = scenario
+
+	return id, nil
+}
+
+// GetScenario returns a stored scenario
+func (s *Server) GetScenario(id string) (*config.Scenario, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	scenario, exists := s.scenarios[id]
+	return scenario, exists
+}
+
+// StartRun starts a load test in the background
+func (s *Server) StartRun(cfg *config.LoadTestConfig) (*Run, error) {
+	return s.ScheduleRun(cfg, time.Time{})
+}
+
+// ScheduleRun starts a load test in the background at startAt, or right
+// away when it is zero or past, so several agents load the target together
+func (s *Server) ScheduleRun(cfg *config.LoadTestConfig, startAt time.Time) (*Run, error) {
+	loadEngine, err := engine.NewLoadEngine(cfg, cfg.Scenario)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create load engine: %w", err)
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	id := fmt.Sprintf("run-%d", s.nextID)
+	run := &Run{
+		ID: id,
+		info: RunInfo{
+			ID:        id,
+			Scenario:  cfg.Scenario.Name,
+			Status:    RunStatusRunning,
+			StartedAt: time.Now().UTC(),
+		},
+		engine:  loadEngine,
+		config:  cfg,
+		done:    make(chan struct{}),
+		aborted: make(chan struct{}),
+	}
+	if time.Until(startAt) > 0 {
+		run.startAt = startAt
+		run.info.Status = RunStatusScheduled
+		run.info.StartedAt = startAt.UTC()
+	}
+	s.evictRuns()
+	s.runs[run.ID] = run
+	s.mu.Unlock()
+
+	go run.execute()
+
+	return run, nil
+}
+
+// GetRun returns a run by identifier
+func (s *Server) GetRun(id string) (*Run, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	run, exists := s.runs[id]
+	return run, exists
+}
+
+// ListRuns returns all known runs ordered by start time
+func (s *Server) ListRuns() []*Run {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// A scheduled run sets its start time when it starts, under its own lock
+	runs := make([]*Run, 0, len(s.runs))
+	startedAt := make(map[*Run]time.Time, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, run)
+		run.mu.RLock()
+		startedAt[run] = run.info.StartedAt
+		run.mu.RUnlock()
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return startedAt[runs[i]].Before(startedAt[runs[j]])
+	})
+
+	return runs
+}
+
+// evictRuns forgets the finished runs beyond the run history, those that
+// finished first. The caller must hold the lock.
+func (s *Server) evictRuns() {
+	var finished []*Run
+	for _, run := range s.runs {
+		select {
+		case <-run.done:
+			finished = append(finished, run)
+		default:
+		}
+	}
+	if len(finished) <= s.runHistory {
+		return
+	}
+
+	finishedAt := func(run *Run) time.Time {
+		run.mu.RLock()
+		defer run.mu.RUnlock()
+		return run.info.FinishedAt
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finishedAt(finished[i]).Before(finishedAt(finished[j]))
+	})
+	for _, run := range finished[:len(finished)-s.runHistory] {
+		delete(s.runs, run.ID)
+	}
+}
+
+// RunInfo describes the state of a run
+type RunInfo struct {
+	ID         string    `json:"id"`
+	Scenario   string    `json:"scenario"`
+	Status     string    `json:"status"`
+	VUs        int       `json:"vus"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// execute runs the load test and stores the resulting report
+func (r *Run) execute() {
+	defer close(r.done)
+
+	// A run stopped before it starts still holds what the engine set up
+	if !r.wait() {
+		r.engine.Close()
+		return
+	}
+	summary, err := r.engine.Run()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.info.FinishedAt = time.Now().UTC()
+	if err != nil {
+		r.info.Status = RunStatusFailed
+		r.info.Error = err.Error()
+		return
+	}
+
+	reporter := reporting.NewJSONReporter(r.config)
+	report, err := reporter.GenerateReport(summary, r.config.Scenario)
+	if err != nil {
+		r.info.Status = RunStatusFailed
+		r.info.Error = fmt.Sprintf("failed to generate report: %v", err)
+		return
+	}
+
+	r.report = report
+	if r.stopped {
+		r.info.Status = RunStatusStopped
+	} else {
+		r.info.Status = RunStatusCompleted
+	}
+}
+
+// wait holds a scheduled run until its start time, and reports whether it
+// should run; a run stopped before then never starts
+func (r *Run) wait() bool {
+	if wait := time.Until(r.startAt); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.aborted:
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		r.info.Status = RunStatusStopped
+		r.info.FinishedAt = time.Now().UTC()
+		return false
+	}
+	if r.info.Status == RunStatusScheduled {
+		r.info.Status = RunStatusRunning
+		r.info.StartedAt = time.Now().UTC()
+	}
+	return true
+}
+
+// Stop requests the run to stop early
+func (r *Run) Stop() {
+	r.mu.Lock()
+	if (r.info.Status != RunStatusRunning && r.info.Status != RunStatusScheduled) || r.stopped {
+		r.mu.Unlock()
+		return
+	}
+	r.stopped = true
+	close(r.aborted)
+	r.mu.Unlock()
+
+	r.engine.Stop()
+}
+
+// Done returns a channel closed when the run has finished
+func (r *Run) Done() <-chan struct{} {
+	return r.done
+}
+
+// Info returns a copy of the run state safe for serialization
+func (r *Run) Info() RunInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	info := r.info
+	info.VUs = r.engine.ActiveVUs()
+	return info
+}
+
+// Config returns the load test configuration the run was started with
+func (r *Run) Config() *config.LoadTestConfig {
+	return r.config
+}
+
+// SetVUs changes the number of active VUs of the run
+func (r *Run) SetVUs(vus int) error {
+	return r.engine.SetVUs(vus)
+}
+
+// Metrics returns the current metrics summary of the run
+func (r *Run) Metrics() *metrics.Summary {
+	return r.engine.GetCollector().GetSummary()
+}
+
+// Report returns the final report, or nil while the run is in progress
+func (r *Run) Report() *reporting.Report {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.report
+}
@@ -0,0 +1,221 @@
+package slo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Source provides the running request counts SLOs are evaluated against
+type Source interface {
+	// Counts returns the total and failed request counts so far
+	Counts() (total, failed int64)
+
+	// CountSlowerThan returns how many requests took longer than d so far
+	CountSlowerThan(d time.Duration) int64
+}
+
+// Objective is an SLO expressed as an error budget: the fraction of requests
+// allowed to be "bad"
+type Objective struct {
+	Name   string
+	Budget float64
+	bad    func(source Source) int64
+}
+
+// Alert describes a projected SLO violation
+type Alert struct {
+	Scenario  string            `json:"scenario"`
+	Objective string            `json:"objective"`
+	Status    string            `json:"status"` // "violating" or "recovered"
+	Projected float64           `json:"projected_bad_ratio"`
+	Budget    float64           `json:"budget"`
+	BurnRate  float64           `json:"burn_rate"`
+	Elapsed   string            `json:"elapsed"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// Monitor evaluates SLOs periodically and alerts when the projected
+// end-of-test result would violate one
+type Monitor struct {
+	config     *config.SLOConfig
+	objectives []Objective
+	scenario   string
+	labels     map[string]string
+	client     *http.Client
+	violating  map[string]bool
+}
+
+// NewMonitor creates a monitor for the scenario's SLOs
+func NewMonitor(cfg *config.SLOConfig, scenario string, labels map[string]string) *Monitor {
+	m := &Monitor{
+		config:    cfg,
+		scenario:  scenario,
+		labels:    labels,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		violating: make(map[string]bool),
+	}
+
+	if cfg.SuccessRate > 0 {
+		m.objectives = append(m.objectives, Objective{
+			Name:   fmt.Sprintf("success rate >= %g%%", cfg.SuccessRate),
+			Budget: 1 - cfg.SuccessRate/100,
+			bad: func(source Source) int64 {
+				_, failed := source.Counts()
+				return failed
+			},
+		})
+	}
+
+	for _, latency := range cfg.Latency {
+		max, _ := time.ParseDuration(latency.Max)
+		m.objectives = append(m.objectives, Objective{
+			Name:   fmt.Sprintf("p%g <= %s", latency.Percentile, latency.Max),
+			Budget: 1 - latency.Percentile/100,
+			bad: func(source Source) int64 {
+				return source.CountSlowerThan(max)
+			},
+		})
+	}
+
+	return m
+}
+
+// Run evaluates the SLOs every interval until ctx is done. The projection
+// extrapolates the latest interval's rates over the remaining duration.
+func (m *Monitor) Run(ctx context.Context, source Source, start time.Time, duration time.Duration) {
+	if len(m.objectives) == 0 {
+		return
+	}
+
+	interval := m.config.GetInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastTotal, _ := source.Counts()
+	lastBad := make([]int64, len(m.objectives))
+	for i, objective := range m.objectives {
+		lastBad[i] = objective.bad(source)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		elapsed := time.Since(start)
+		remaining := duration - elapsed
+		if remaining < 0 {
+			remaining = 0
+		}
+
+		total, _ := source.Counts()
+		windowTotal := total - lastTotal
+		lastTotal = total
+		if windowTotal <= 0 {
+			continue
+		}
+
+		// Requests expected before the end at the current rate
+		expected := float64(windowTotal) * float64(remaining) / float64(interval)
+
+		for i, objective := range m.objectives {
+			bad := objective.bad(source)
+			windowBad := bad - lastBad[i]
+			lastBad[i] = bad
+
+			windowRatio := float64(windowBad) / float64(windowTotal)
+			projected := (float64(bad) + windowRatio*expected) / (float64(total) + expected)
+
+			alert := Alert{
+				Scenario:  m.scenario,
+				Objective: objective.Name,
+				Projected: projected,
+				Budget:    objective.Budget,
+				BurnRate:  burnRate(windowRatio, objective.Budget),
+				Elapsed:   elapsed.Truncate(time.Second).String(),
+				Labels:    m.labels,
+			}
+
+			switch {
+			case projected > objective.Budget && !m.violating[objective.Name]:
+				m.violating[objective.Name] = true
+				alert.Status = "violating"
+				m.emit(ctx, alert)
+			case projected <= objective.Budget && m.violating[objective.Name]:
+				m.violating[objective.Name] = false
+				alert.Status = "recovered"
+				m.emit(ctx, alert)
+			}
+		}
+	}
+}
+
+// Evaluate returns the objectives violated by the final counts
+func (m *Monitor) Evaluate(source Source) []string {
+	total, _ := source.Counts()
+	if total == 0 {
+		return nil
+	}
+
+	var violations []string
+	for _, objective := range m.objectives {
+		ratio := float64(objective.bad(source)) / float64(total)
+		if ratio > objective.Budget {
+			violations = append(violations, fmt.Sprintf("SLO %s violated: %.2f%% of requests out of objective, budget %.2f%%",
+				objective.Name, ratio*100, objective.Budget*100))
+		}
+	}
+
+	return violations
+}
+
+// emit logs an alert and posts it to the webhook, if configured
+func (m *Monitor) emit(ctx context.Context, alert Alert) {
+	if alert.Status == "violating" {
+		logrus.Warnf("SLO at risk: %s projected at %.2f%% bad requests (budget %.2f%%, burn rate %.1fx) after %s",
+			alert.Objective, alert.Projected*100, alert.Budget*100, alert.BurnRate, alert.Elapsed)
+	} else {
+		logrus.Infof("SLO recovered: %s projected at %.2f%% bad requests (budget %.2f%%)",
+			alert.Objective, alert.Projected*100, alert.Budget*100)
+	}
+
+	if m.config.Webhook == "" {
+		return
+	}
+
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.config.Webhook, bytes.NewReader(payload))
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to build SLO webhook request")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to send SLO alert")
+		return
+	}
+	resp.Body.Close()
+}
+
+// burnRate is how many times faster than allowed the error budget is consumed
+func burnRate(ratio, budget float64) float64 {
+	if budget <= 0 {
+		return 0
+	}
+	return ratio / budget
+}
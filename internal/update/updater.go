@@ -0,0 +1,394 @@
+package update
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRepository is the GitHub repository releases are fetched from
+	DefaultRepository = "alexandrehpiva/gotsunami"
+
+	// DefaultAPIURL is the GitHub API base URL
+	DefaultAPIURL = "https://api.github.com"
+
+	// ChecksumsAsset is the release asset listing SHA-256 checksums
+	ChecksumsAsset = "checksums.txt"
+
+	// SignatureAsset is the release asset holding the ed25519 signature of ChecksumsAsset
+	SignatureAsset = "checksums.txt.sig"
+)
+
+// Config holds self-update configuration
+type Config struct {
+	Repository     string
+	APIURL         string
+	BinaryName     string
+	CurrentVersion string
+	PublicKey      string // base64-encoded ed25519 public key, optional
+	Timeout        time.Duration
+}
+
+// Release represents a GitHub release
+type Release struct {
+	TagName string  `json:"tag_name"`
+	Name    string  `json:"name"`
+	Assets  []Asset `json:"assets"`
+}
+
+// Asset represents a downloadable release asset
+type Asset struct {
+	Name        string `json:"name"`
+	DownloadURL string `json:"browser_download_url"`
+	Size        int64  `json:"size"`
+}
+
+// Updater checks for and installs new GoTsunami releases
+type Updater struct {
+	config *Config
+	client *http.Client
+}
+
+// NewUpdater creates a new updater
+func NewUpdater(config *Config) *Updater {
+	if config.Repository == "" {
+		config.Repository = DefaultRepository
+	}
+	if config.APIURL == "" {
+		config.APIURL = DefaultAPIURL
+	}
+	if config.BinaryName == "" {
+		config.BinaryName = "gotsunami"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Minute
+	}
+
+	return &Updater{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+}
+
+// FetchRelease fetches a release by tag, or the latest release when tag is empty
+func (u *Updater) FetchRelease(tag string) (*Release, error) {
+	endpoint := fmt.Sprintf("%s/repos/%s/releases/latest", strings.TrimRight(u.config.APIURL, "/"), u.config.Repository)
+	if tag != "" {
+		endpoint = fmt.Sprintf("%s/repos/%s/releases/tags/%s", strings.TrimRight(u.config.APIURL, "/"), u.config.Repository, tag)
+	}
+
+	resp, err := u.get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch release: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var release Release
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("failed to parse release: %w", err)
+	}
+
+	return &release, nil
+}
+
+// IsNewer reports whether the release is a later version than the running
+// one. Development builds and versions that are not semantic versions, such
+// as a commit hash, are always behind.
+func (u *Updater) IsNewer(release *Release) bool {
+	order, ok := CompareVersions(release.TagName, u.config.CurrentVersion)
+	if !ok {
+		return strings.TrimPrefix(release.TagName, "v") != strings.TrimPrefix(u.config.CurrentVersion, "v")
+	}
+	return order > 0
+}
+
+// IsOlder reports whether installing the release would downgrade the running
+// version, as when it is ahead of the latest release
+func (u *Updater) IsOlder(release *Release) bool {
+	order, ok := CompareVersions(release.TagName, u.config.CurrentVersion)
+	return ok && order < 0
+}
+
+// CompareVersions orders two semantic versions (v1.2.3, v1.3.0-rc.1),
+// returning -1, 0 or 1 as a is before, equal to or after b; ok is false
+// unless both are semantic versions. Pre-releases come before their release
+// and are ordered by their identifiers, as SemVer specifies; build metadata
+// is ignored.
+func CompareVersions(a, b string) (order int, ok bool) {
+	aCore, aPre, aOK := parseVersion(a)
+	bCore, bPre, bOK := parseVersion(b)
+	if !aOK || !bOK {
+		return 0, false
+	}
+
+	for i := range aCore {
+		if aCore[i] != bCore[i] {
+			if aCore[i] < bCore[i] {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0, true
+	case aPre == "":
+		return 1, true
+	case bPre == "":
+		return -1, true
+	default:
+		return comparePrerelease(aPre, bPre), true
+	}
+}
+
+// comparePrerelease orders two pre-releases by their dot-separated
+// identifiers: numeric ones by value and before alphanumeric ones, which
+// compare as strings, so rc.9 comes before rc.10. When every identifier
+// matches, the pre-release with fewer comes first.
+func comparePrerelease(a, b string) int {
+	aIDs := strings.Split(a, ".")
+	bIDs := strings.Split(b, ".")
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		aNum, aErr := strconv.ParseUint(aIDs[i], 10, 64)
+		bNum, bErr := strconv.ParseUint(bIDs[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNum != bNum {
+				return cmp.Compare(aNum, bNum)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if order := strings.Compare(aIDs[i], bIDs[i]); order != 0 {
+				return order
+			}
+		}
+	}
+	return cmp.Compare(len(aIDs), len(bIDs))
+}
+
+// parseVersion splits a semantic version into its major, minor and patch
+// numbers and its pre-release
+func parseVersion(version string) (core [3]int, pre string, ok bool) {
+	version = strings.TrimPrefix(version, "v")
+	version, _, _ = strings.Cut(version, "+")
+	version, pre, _ = strings.Cut(version, "-")
+
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return core, "", false
+	}
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return core, "", false
+		}
+		core[i] = number
+	}
+	return core, pre, true
+}
+
+// AssetName returns the binary asset name for the current platform
+func (u *Updater) AssetName(release *Release) string {
+	name := fmt.Sprintf("%s-%s-%s-%s", u.config.BinaryName, release.TagName, runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Install downloads the platform binary from the release, verifies it and
+// replaces the executable at target
+func (u *Updater) Install(release *Release, target string) error {
+	assetName := u.AssetName(release)
+	binaryAsset := findAsset(release, assetName)
+	if binaryAsset == nil {
+		return fmt.Errorf("release %s has no asset %s", release.TagName, assetName)
+	}
+
+	checksumsAsset := findAsset(release, ChecksumsAsset)
+	if checksumsAsset == nil {
+		return fmt.Errorf("release %s has no %s, refusing to install unverified binary", release.TagName, ChecksumsAsset)
+	}
+
+	checksums, err := u.download(checksumsAsset.DownloadURL)
+	if err != nil {
+		return fmt.Errorf("failed to download checksums: %w", err)
+	}
+
+	if u.config.PublicKey != "" {
+		signatureAsset := findAsset(release, SignatureAsset)
+		if signatureAsset == nil {
+			return fmt.Errorf("release %s has no %s but a public key is configured", release.TagName, SignatureAsset)
+		}
+		signature, err := u.download(signatureAsset.DownloadURL)
+		if err != nil {
+			return fmt.Errorf("failed to download signature: %w", err)
+		}
+		if err := VerifySignature(checksums, signature, u.config.PublicKey); err != nil {
+			return err
+		}
+	}
+
+	expected, err := ParseChecksum(checksums, assetName)
+	if err != nil {
+		return err
+	}
+
+	binary, err := u.download(binaryAsset.DownloadURL)
+	if err != nil {
+		return fmt.Errorf("failed to download binary: %w", err)
+	}
+
+	sum := sha256.Sum256(binary)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", assetName, expected, actual)
+	}
+
+	return ReplaceExecutable(target, binary)
+}
+
+// ParseChecksum finds the SHA-256 checksum of name in a sha256sum-formatted file
+func ParseChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(string(checksums)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+
+	return "", fmt.Errorf("no checksum found for %s", name)
+}
+
+// VerifySignature verifies an ed25519 signature (raw or base64) of data
+func VerifySignature(data, signature []byte, publicKey string) error {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid ed25519 public key")
+	}
+
+	if len(signature) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return fmt.Errorf("invalid signature encoding: %w", err)
+		}
+		signature = decoded
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(key), data, signature) {
+		return fmt.Errorf("signature verification failed for %s", ChecksumsAsset)
+	}
+
+	return nil
+}
+
+// ReplaceExecutable atomically swaps the binary at target with data, keeping
+// the previous binary as target.old
+func ReplaceExecutable(target string, data []byte) error {
+	info, err := os.Stat(target)
+	if err != nil {
+		return fmt.Errorf("failed to stat executable: %w", err)
+	}
+
+	dir := filepath.Dir(target)
+	tmp, err := os.CreateTemp(dir, ".gotsunami-update-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write new binary: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write new binary: %w", err)
+	}
+	if err := os.Chmod(tmpName, info.Mode().Perm()|0o111); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+
+	backup := target + ".old"
+	os.Remove(backup)
+	if err := os.Rename(target, backup); err != nil {
+		return fmt.Errorf("failed to back up current binary: %w", err)
+	}
+	if err := os.Rename(tmpName, target); err != nil {
+		// Try to restore the previous binary
+		os.Rename(backup, target)
+		return fmt.Errorf("failed to install new binary: %w", err)
+	}
+
+	// Windows cannot remove a running executable; keep the backup there
+	if runtime.GOOS != "windows" {
+		os.Remove(backup)
+	}
+
+	return nil
+}
+
+// findAsset looks up a release asset by name
+func findAsset(release *Release, name string) *Asset {
+	for i := range release.Assets {
+		if release.Assets[i].Name == name {
+			return &release.Assets[i]
+		}
+	}
+	return nil
+}
+
+// download fetches a URL into memory
+func (u *Updater) download(url string) ([]byte, error) {
+	resp, err := u.get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+// get performs a GET request and checks the response status
+func (u *Updater) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "GoTsunami-Updater/"+u.config.CurrentVersion)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" && strings.HasPrefix(url, u.config.APIURL) {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+
+	return resp, nil
+}
@@ -2,7 +2,9 @@ package validation
 
 import (
 	"fmt"
+	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,6 +16,8 @@ import (
 // ResponseValidator validates HTTP responses against configured rules
 type ResponseValidator struct {
 	config *config.ValidationConfig
+	// method is the request method, which decides whether responses carry a body
+	method string
 }
 
 // ValidationResult represents the result of a validation
@@ -32,6 +36,41 @@ func NewResponseValidator(config *config.ValidationConfig) *ResponseValidator {
 
 // Validate validates a response against all configured rules
 func (v *ResponseValidator) Validate(resp *protocols.Response) *ValidationResult {
+	if result := v.ValidateStatus(resp); !result.Passed {
+		return result
+	}
+
+	if v.hasBody(resp.StatusCode) {
+		// Validate response size
+		if result := v.validateResponseSize(resp.ContentLength); !result.Passed {
+			return result
+		}
+
+		// Validate body content
+		if result := v.validateBody(resp.Body); !result.Passed {
+			return result
+		}
+	} else if size, err := strconv.ParseInt(resp.Headers["Content-Length"], 10, 64); err == nil {
+		// A HEAD response declares the size of the body a GET would return
+		if result := v.validateResponseSize(size); !result.Passed {
+			return result
+		}
+	}
+
+	// Validate headers
+	if result := v.validateHeaders(resp.Headers); !result.Passed {
+		return result
+	}
+
+	return &ValidationResult{
+		Passed: true,
+	}
+}
+
+// ValidateStatus validates a response against the rules every response is
+// held to, even outside the validation sample: it must have arrived, with an
+// expected status code, in time
+func (v *ResponseValidator) ValidateStatus(resp *protocols.Response) *ValidationResult {
 	// Check for request errors first
 	if resp.Error != nil {
 		return &ValidationResult{
@@ -47,33 +86,47 @@ func (v *ResponseValidator) Validate(resp *protocols.Response) *ValidationResult
 	}
 
 	// Validate response time
-	if result := v.validateResponseTime(resp.ResponseTime); !result.Passed {
-		return result
-	}
-
-	// Validate response size
-	if result := v.validateResponseSize(resp.ContentLength); !result.Passed {
-		return result
-	}
+	return v.validateResponseTime(resp.ResponseTime)
+}
 
-	// Validate body content
-	if result := v.validateBody(resp.Body); !result.Passed {
-		return result
+// SampleRate returns the share of responses Validate should check in full,
+// leaving ValidateStatus to the others; 1 means all of them
+func (v *ResponseValidator) SampleRate() float64 {
+	if v.config.SampleRate <= 0 || v.config.SampleRate > 1 {
+		return 1
 	}
+	return v.config.SampleRate
+}
 
-	// Validate headers
-	if result := v.validateHeaders(resp.Headers); !result.Passed {
-		return result
-	}
+// WithMethod returns a validator for responses to requests with the given
+// method, so responses that never carry a body are not failed for lacking one
+func (v *ResponseValidator) WithMethod(method string) *ResponseValidator {
+	return &ResponseValidator{config: v.config, method: method}
+}
 
-	return &ValidationResult{
-		Passed: true,
+// hasBody reports whether a response carries a body: responses to HEAD and
+// successful CONNECTs never do
+func (v *ResponseValidator) hasBody(statusCode int) bool {
+	switch v.method {
+	case http.MethodHead:
+		return false
+	case http.MethodConnect:
+		return statusCode/100 != 2
 	}
+	return true
 }
 
 // validateStatusCode validates the HTTP status code
 func (v *ResponseValidator) validateStatusCode(statusCode int) *ValidationResult {
+	// Without expected codes, error statuses fail
 	if len(v.config.StatusCodes) == 0 {
+		if statusCode >= 400 {
+			return &ValidationResult{
+				Passed:    false,
+				ErrorType: "status_code",
+				Message:   fmt.Sprintf("unexpected error status %d", statusCode),
+			}
+		}
 		return &ValidationResult{Passed: true}
 	}
 
@@ -237,7 +290,16 @@ func (v *ResponseValidator) validateHeaders(headers map[string]string) *Validati
 
 // ValidateWithOverrides validates a response with CLI flag overrides
 func (v *ResponseValidator) ValidateWithOverrides(resp *protocols.Response, overrides *ValidationOverrides) *ValidationResult {
-	// Create temporary config with overrides
+	return v.WithOverrides(overrides).Validate(resp)
+}
+
+// WithOverrides returns a validator whose rules are replaced by the CLI
+// flag overrides that are set
+func (v *ResponseValidator) WithOverrides(overrides *ValidationOverrides) *ResponseValidator {
+	if overrides == nil {
+		return v
+	}
+
 	tempConfig := *v.config
 
 	if len(overrides.ExpectStatus) > 0 {
@@ -256,9 +318,7 @@ func (v *ResponseValidator) ValidateWithOverrides(resp *protocols.Response, over
 		tempConfig.BodyNotContains = []string{overrides.ExpectBodyNot}
 	}
 
-	// Create temporary validator
-	tempValidator := &ResponseValidator{config: &tempConfig}
-	return tempValidator.Validate(resp)
+	return &ResponseValidator{config: &tempConfig, method: v.method}
 }
 
 // ValidationOverrides represents CLI flag overrides for validation
@@ -0,0 +1,84 @@
+// Package loadpattern is the registry of load patterns selected with
+// --pattern. Embedding applications and plugins add patterns of their own
+// with Register:
+//
+//	type wave struct{ period time.Duration }
+//
+//	func (w wave) Name() string { return "wave" }
+//
+//	func (w wave) Intensity(elapsed time.Duration) float64 {
+//		return 1 + math.Sin(2*math.Pi*elapsed.Seconds()/w.period.Seconds())/2
+//	}
+//
+//	loadpattern.Register("wave", func(cfg *loadpattern.Config) loadpattern.Pattern {
+//		return wave{period: cfg.Duration / 4}
+//	})
+package loadpattern
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+)
+
+// Config is the configuration of a test, named here so code outside the
+// module can implement Factory
+type Config = config.LoadTestConfig
+
+// Pattern determines the load intensity over the course of a test
+type Pattern interface {
+	// Name returns the pattern name
+	Name() string
+
+	// Intensity returns the load intensity at the given elapsed time,
+	// where 1.0 is the configured base load
+	Intensity(elapsed time.Duration) float64
+}
+
+// Staged is implemented by load patterns made of discrete stages
+type Staged interface {
+	// Stage returns the index of the stage active at elapsed, or -1 once
+	// the pattern is over
+	Stage(elapsed time.Duration) int
+}
+
+// Factory creates a load pattern for a test configuration
+type Factory func(cfg *Config) Pattern
+
+var (
+	patternsMu sync.RWMutex
+	patterns   = map[string]Factory{}
+)
+
+// Register makes a load pattern available to --pattern. Registering an
+// existing name replaces it.
+func Register(name string, factory Factory) {
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+	patterns[strings.ToLower(name)] = factory
+}
+
+// Lookup returns the factory registered for name
+func Lookup(name string) (Factory, bool) {
+	patternsMu.RLock()
+	defer patternsMu.RUnlock()
+	factory, exists := patterns[strings.ToLower(name)]
+	return factory, exists
+}
+
+// Names returns the registered pattern names in alphabetical order
+func Names() []string {
+	patternsMu.RLock()
+	defer patternsMu.RUnlock()
+
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,108 @@
+// Package plugin is the SDK for building GoTsunami protocol plugins.
+//
+// A protocol plugin is a standalone executable named gotsunami-protocol-<name>
+// placed in a plugin directory. GoTsunami discovers it at runtime, launches it
+// as a subprocess and talks to it over a versioned RPC interface. A plugin
+// binary only needs to implement Protocol and call Serve from main:
+//
+//	func main() {
+//		plugin.Serve(&MyProtocol{})
+//	}
+package plugin
+
+import (
+	"net/rpc"
+	"time"
+
+	goplugin "github.com/hashicorp/go-plugin"
+)
+
+// ProtocolVersion is the version of the plugin RPC interface. It is bumped on
+// every incompatible change so mismatched plugins are rejected at handshake.
+const ProtocolVersion = 1
+
+// PluginName is the name under which the protocol implementation is dispensed
+const PluginName = "protocol"
+
+// BinaryPrefix is the file name prefix used to discover protocol plugins
+const BinaryPrefix = "gotsunami-protocol-"
+
+// Handshake is shared by GoTsunami and its plugins. It is not a security
+// measure, it only prevents plugins from being executed directly by users.
+var Handshake = goplugin.HandshakeConfig{
+	ProtocolVersion:  ProtocolVersion,
+	MagicCookieKey:   "GOTSUNAMI_PLUGIN",
+	MagicCookieValue: "7c5b9f1e-protocol",
+}
+
+// Request is a protocol request sent to a plugin
+type Request struct {
+	Method      string
+	URL         string
+	Headers     map[string]string
+	Body        []byte
+	Timeout     time.Duration
+	QueryParams map[string]string
+}
+
+// Response is a protocol response returned by a plugin
+type Response struct {
+	StatusCode    int
+	Headers       map[string]string
+	Body          []byte
+	ResponseTime  time.Duration
+	ContentLength int64
+	Error         string // empty when the request succeeded
+}
+
+// Protocol is implemented by plugin authors
+type Protocol interface {
+	// Name returns the protocol name
+	Name() string
+
+	// Version returns the protocol version
+	Version() string
+
+	// Execute performs a request. Failures should be reported in
+	// Response.Error; a returned error aborts the request as a transport error.
+	Execute(req *Request) (*Response, error)
+
+	// ValidateConfig validates the scenario's protocol_config block
+	ValidateConfig(config map[string]interface{}) error
+
+	// GetMetrics returns protocol-specific metrics
+	GetMetrics() map[string]interface{}
+
+	// Close cleans up protocol resources
+	Close() error
+}
+
+// PluginSets returns the versioned plugin sets served by plugins and expected by the engine
+func PluginSets(impl Protocol) map[int]goplugin.PluginSet {
+	return map[int]goplugin.PluginSet{
+		ProtocolVersion: {PluginName: &ProtocolPlugin{Impl: impl}},
+	}
+}
+
+// Serve runs impl as a plugin; it must be called from the plugin's main function
+func Serve(impl Protocol) {
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig:  Handshake,
+		VersionedPlugins: PluginSets(impl),
+	})
+}
+
+// ProtocolPlugin adapts Protocol to go-plugin's net/rpc transport
+type ProtocolPlugin struct {
+	Impl Protocol
+}
+
+// Server returns the RPC server side of the plugin
+func (p *ProtocolPlugin) Server(*goplugin.MuxBroker) (interface{}, error) {
+	return &RPCServer{impl: p.Impl}, nil
+}
+
+// Client returns the RPC client side of the plugin
+func (p *ProtocolPlugin) Client(_ *goplugin.MuxBroker, client *rpc.Client) (interface{}, error) {
+	return &RPCClient{client: client}, nil
+}
@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/rpc"
+)
+
+// Free-form maps are exchanged as JSON since gob cannot encode arbitrary
+// interface{} values without registering every concrete type.
+
+// InfoReply carries the protocol name and version
+type InfoReply struct {
+	Name    string
+	Version string
+}
+
+// RPCClient is the engine-side implementation of Protocol talking to a plugin
+type RPCClient struct {
+	client *rpc.Client
+}
+
+// Name returns the protocol name reported by the plugin
+func (c *RPCClient) Name() string {
+	return c.info().Name
+}
+
+// Version returns the protocol version reported by the plugin
+func (c *RPCClient) Version() string {
+	return c.info().Version
+}
+
+// info fetches name and version from the plugin
+func (c *RPCClient) info() InfoReply {
+	var reply InfoReply
+	if err := c.client.Call("Plugin.Info", struct{}{}, &reply); err != nil {
+		return InfoReply{Name: "unknown", Version: "unknown"}
+	}
+	return reply
+}
+
+// Execute performs a request through the plugin
+func (c *RPCClient) Execute(req *Request) (*Response, error) {
+	return c.ExecuteContext(context.Background(), req)
+}
+
+// ExecuteContext performs a request through the plugin, giving up on it
+// when ctx is done; the plugin may still finish it, but its reply is dropped
+func (c *RPCClient) ExecuteContext(ctx context.Context, req *Request) (*Response, error) {
+	var resp Response
+	call := c.client.Go("Plugin.Execute", req, &resp, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			return nil, call.Error
+		}
+		return &resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ValidateConfig validates protocol configuration through the plugin
+func (c *RPCClient) ValidateConfig(config map[string]interface{}) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	var reply string
+	if err := c.client.Call("Plugin.ValidateConfig", data, &reply); err != nil {
+		return err
+	}
+	if reply != "" {
+		return errors.New(reply)
+	}
+	return nil
+}
+
+// GetMetrics returns plugin metrics
+func (c *RPCClient) GetMetrics() map[string]interface{} {
+	var data []byte
+	if err := c.client.Call("Plugin.GetMetrics", struct{}{}, &data); err != nil {
+		return map[string]interface{}{}
+	}
+
+	result := make(map[string]interface{})
+	if err := json.Unmarshal(data, &result); err != nil {
+		return map[string]interface{}{}
+	}
+	return result
+}
+
+// Close asks the plugin to release its resources
+func (c *RPCClient) Close() error {
+	var reply string
+	if err := c.client.Call("Plugin.Close", struct{}{}, &reply); err != nil {
+		return err
+	}
+	if reply != "" {
+		return errors.New(reply)
+	}
+	return nil
+}
+
+// RPCServer is the plugin-side RPC server wrapping a Protocol implementation
+type RPCServer struct {
+	impl Protocol
+}
+
+// Info returns the protocol name and version
+func (s *RPCServer) Info(_ struct{}, reply *InfoReply) error {
+	*reply = InfoReply{Name: s.impl.Name(), Version: s.impl.Version()}
+	return nil
+}
+
+// Execute performs a request
+func (s *RPCServer) Execute(req *Request, resp *Response) error {
+	result, err := s.impl.Execute(req)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return errors.New("plugin returned no response")
+	}
+	*resp = *result
+	return nil
+}
+
+// ValidateConfig validates configuration, returning the error message in reply
+func (s *RPCServer) ValidateConfig(data []byte, reply *string) error {
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	if err := s.impl.ValidateConfig(config); err != nil {
+		*reply = err.Error()
+	}
+	return nil
+}
+
+// GetMetrics returns protocol metrics
+func (s *RPCServer) GetMetrics(_ struct{}, reply *[]byte) error {
+	data, err := json.Marshal(s.impl.GetMetrics())
+	if err != nil {
+		return err
+	}
+	*reply = data
+	return nil
+}
+
+// Close releases protocol resources
+func (s *RPCServer) Close(_ struct{}, reply *string) error {
+	if err := s.impl.Close(); err != nil {
+		*reply = err.Error()
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Package reporter is the registry of report formats selected with
+// --report-format. Embedding applications and plugins add formats of their
+// own with Register, usually on top of the JSON report:
+//
+//	type junit struct{ reporter.Reporter }
+//
+//	func (j junit) WriteReport(report *reporter.Report, outfile string) error { ... }
+//
+//	reporter.Register("junit", func(cfg *reporter.Config) reporter.Reporter {
+//		return junit{reporter.NewJSON(cfg)}
+//	})
+package reporter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/reporting"
+)
+
+// Types a reporter works with, named here so code outside the module can
+// implement Reporter
+type (
+	// Report is the report of a test, as the json format writes it
+	Report = reporting.Report
+	// Summary holds the metrics collected during a test
+	Summary = metrics.Summary
+	// Scenario is the scenario a test ran
+	Scenario = config.Scenario
+	// Config is the configuration of a test
+	Config = config.LoadTestConfig
+)
+
+// Reporter generates and writes reports in a specific format
+type Reporter interface {
+	// GenerateReport builds the report from collected metrics
+	GenerateReport(summary *Summary, scenario *Scenario) (*Report, error)
+
+	// WriteReport writes the report to outfile, or stdout when outfile is empty
+	WriteReport(report *Report, outfile string) error
+}
+
+// Factory creates a reporter for a load test configuration
+type Factory func(cfg *Config) Reporter
+
+var (
+	reportersMu sync.RWMutex
+	reporters   = map[string]Factory{
+		"json": NewJSON,
+		"yaml": func(cfg *Config) Reporter { return reporting.NewYAMLReporter(cfg) },
+		"csv":  func(cfg *Config) Reporter { return reporting.NewCSVReporter(cfg) },
+		"html": func(cfg *Config) Reporter { return reporting.NewHTMLReporter(cfg) },
+	}
+)
+
+// NewJSON creates the JSON reporter, whose GenerateReport other formats
+// can reuse
+func NewJSON(cfg *Config) Reporter {
+	return reporting.NewJSONReporter(cfg)
+}
+
+// Register makes a report format available to --report-format.
+// Registering an existing format replaces it.
+func Register(format string, factory Factory) {
+	reportersMu.Lock()
+	defer reportersMu.Unlock()
+	reporters[strings.ToLower(format)] = factory
+}
+
+// New creates the reporter registered for format
+func New(format string, cfg *Config) (Reporter, error) {
+	reportersMu.RLock()
+	factory, exists := reporters[strings.ToLower(format)]
+	reportersMu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unsupported report format: %s (available: %s)", format, strings.Join(Formats(), ", "))
+	}
+
+	return factory(cfg), nil
+}
+
+// Formats returns the registered report formats in alphabetical order
+func Formats() []string {
+	reportersMu.RLock()
+	defer reportersMu.RUnlock()
+
+	formats := make([]string, 0, len(reporters))
+	for format := range reporters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	return formats
+}
@@ -0,0 +1,141 @@
+package templates
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const randomAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// maxRandomString caps random.string, which runs for every request, so a
+// template cannot make the generator allocate gigabytes
+const maxRandomString = 1 << 20
+
+// registerBuiltins registers the functions available to every scenario
+func registerBuiltins() {
+	funcs["random.uuid"] = randomUUID
+	funcs["random.string"] = randomString
+	funcs["random.int"] = randomInt
+
+	Register("timestamp", timestamp)
+	Register("hmac", hmacSHA256)
+	Register("sha256", sha256Hex)
+	Register("base64", base64Encode)
+	Register("upper", func(args ...string) (string, error) { return strings.ToUpper(strings.Join(args, " ")), nil })
+	Register("lower", func(args ...string) (string, error) { return strings.ToLower(strings.Join(args, " ")), nil })
+}
+
+// timestamp returns the current Unix time in seconds, or formatted with the
+// Go layout given as first argument
+func timestamp(args ...string) (string, error) {
+	now := time.Now()
+	if len(args) > 0 {
+		return now.Format(args[0]), nil
+	}
+	return strconv.FormatInt(now.Unix(), 10), nil
+}
+
+// randomUUID returns a random version 4 UUID
+func randomUUID(r *rand.Rand, args ...string) (string, error) {
+	var b [16]byte
+	r.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// randomString returns a random alphanumeric string, 16 characters by default
+func randomString(r *rand.Rand, args ...string) (string, error) {
+	length := 16
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("invalid length: %s", args[0])
+		}
+		if n > maxRandomString {
+			return "", fmt.Errorf("length %d exceeds the maximum of %d", n, maxRandomString)
+		}
+		length = n
+	}
+
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = randomAlphabet[r.Intn(len(randomAlphabet))]
+	}
+
+	return string(b), nil
+}
+
+// randomInt returns a random integer in [min, max], [0, 1000000) by default
+func randomInt(r *rand.Rand, args ...string) (string, error) {
+	minValue, maxValue := int64(0), int64(999999)
+	if len(args) == 2 {
+		var err error
+		if minValue, err = strconv.ParseInt(args[0], 10, 64); err != nil {
+			return "", fmt.Errorf("invalid min: %s", args[0])
+		}
+		if maxValue, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+			return "", fmt.Errorf("invalid max: %s", args[1])
+		}
+	} else if len(args) != 0 {
+		return "", fmt.Errorf("expected min and max arguments")
+	}
+	if maxValue < minValue {
+		return "", fmt.Errorf("max must not be less than min")
+	}
+
+	// A span past math.MaxInt64, such as 0 to math.MaxInt64, overflows
+	// Int63n; it is drawn from the full 64 bits instead
+	span := uint64(maxValue) - uint64(minValue)
+	if span < math.MaxInt64 {
+		return strconv.FormatInt(minValue+r.Int63n(int64(span)+1), 10), nil
+	}
+	return strconv.FormatInt(minValue+int64(uint64n(r, span)), 10), nil
+}
+
+// uint64n returns a random number in [0, span], rejecting the draws that
+// would favour low values when span+1 does not divide 2^64
+func uint64n(r *rand.Rand, span uint64) uint64 {
+	if span == math.MaxUint64 {
+		return r.Uint64()
+	}
+	n := span + 1
+	threshold := -n % n
+	for {
+		if v := r.Uint64(); v >= threshold {
+			return v % n
+		}
+	}
+}
+
+// hmacSHA256 returns the hex HMAC-SHA256 of a payload with a secret
+func hmacSHA256(args ...string) (string, error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("expected payload and secret arguments")
+	}
+
+	mac := hmac.New(sha256.New, []byte(args[1]))
+	mac.Write([]byte(args[0]))
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// sha256Hex returns the hex SHA-256 of its arguments joined by spaces
+func sha256Hex(args ...string) (string, error) {
+	sum := sha256.Sum256([]byte(strings.Join(args, " ")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// base64Encode returns the standard base64 encoding of its arguments joined by spaces
+func base64Encode(args ...string) (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Join(args, " "))), nil
+}
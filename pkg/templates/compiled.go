@@ -0,0 +1,119 @@
+package templates
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Template is a string split once into its static text and placeholders, so
+// expanding it for every request neither scans nor tokenizes it again.
+// Functions are looked up when compiling: register them beforehand.
+type Template struct {
+	source string
+	parts  []templatePart
+	// static is the length of the static text, to size the output
+	static int
+}
+
+// templatePart is either static text or a placeholder
+type templatePart struct {
+	text        string
+	placeholder *placeholder
+}
+
+// Compile parses the placeholders of s, failing on calls to unknown
+// functions like Validate
+func Compile(s string) (*Template, error) {
+	t := &Template{source: s}
+	if !strings.Contains(s, "{{") {
+		return t, nil
+	}
+
+	rest := s
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			break
+		}
+		end += start
+
+		p, err := parsePlaceholder(rest[start:end+2], rest[start+2:end])
+		if err != nil {
+			return nil, err
+		}
+		if len(p.tokens) > 1 && p.fn == nil {
+			return nil, fmt.Errorf("unknown template function: %s", p.tokens[0].text)
+		}
+		t.addText(rest[:start])
+		t.parts = append(t.parts, templatePart{placeholder: p})
+		rest = rest[end+2:]
+	}
+	if len(t.parts) == 0 {
+		// Unterminated braces are kept as written
+		return t, nil
+	}
+	t.addText(rest)
+
+	return t, nil
+}
+
+// addText appends static text, skipping empty runs
+func (t *Template) addText(text string) {
+	if text != "" {
+		t.parts = append(t.parts, templatePart{text: text})
+		t.static += len(text)
+	}
+}
+
+// Static reports whether the template has no placeholders, so it always
+// expands to its source
+func (t *Template) Static() bool {
+	return len(t.parts) == 0
+}
+
+// String returns the template as written
+func (t *Template) String() string {
+	return t.source
+}
+
+// Expand is like ExpandRand on the template's source
+func (t *Template) Expand(vars map[string]string, r *rand.Rand) (string, error) {
+	if len(t.parts) == 0 {
+		return t.source, nil
+	}
+	// A single placeholder needs no copy
+	if len(t.parts) == 1 {
+		return t.expandPart(t.parts[0], vars, r)
+	}
+
+	var b strings.Builder
+	b.Grow(t.static + 16*len(t.parts))
+	for _, part := range t.parts {
+		value, err := t.expandPart(part, vars, r)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
+
+// expandPart returns the text of a part
+func (t *Template) expandPart(part templatePart, vars map[string]string, r *rand.Rand) (string, error) {
+	if part.placeholder == nil {
+		return part.text, nil
+	}
+	value, err := part.placeholder.evaluate(vars, r)
+	if err != nil {
+		return "", err
+	}
+	if value == nil {
+		return part.placeholder.source, nil
+	}
+	return *value, nil
+}
@@ -0,0 +1,281 @@
+// Package templates expands {{...}} placeholders in scenario headers and
+// bodies. Extensions can register their own template functions:
+//
+//	templates.Register("hmac", func(args ...string) (string, error) { ... })
+//
+// and use them in a scenario as {{hmac payload secret}}.
+package templates
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Func is a template function. Arguments arrive already resolved: quoted
+// strings as literals, variable names as their values.
+type Func func(args ...string) (string, error)
+
+// RandFunc is a template function drawing from the caller's random source,
+// so its output is reproducible under --seed
+type RandFunc func(r *rand.Rand, args ...string) (string, error)
+
+var (
+	mu    sync.RWMutex
+	funcs = map[string]RandFunc{}
+
+	// defaultRand serves expansions without their own random source
+	defaultRand = rand.New(&lockedSource{src: rand.NewSource(time.Now().UnixNano())})
+)
+
+// lockedSource makes a rand.Source safe for concurrent use
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+func init() {
+	registerBuiltins()
+}
+
+// Register makes a template function available to scenarios. Registering an
+// existing name replaces it.
+func Register(name string, fn Func) {
+	RegisterRand(name, func(_ *rand.Rand, args ...string) (string, error) {
+		return fn(args...)
+	})
+}
+
+// RegisterRand registers a template function that generates random data
+func RegisterRand(name string, fn RandFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	funcs[name] = fn
+}
+
+// Lookup returns the template function registered under name
+func Lookup(name string) (RandFunc, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	fn, exists := funcs[name]
+	return fn, exists
+}
+
+// Names returns the registered function names in alphabetical order
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Expand replaces every {{...}} placeholder in s. A placeholder is either a
+// variable name or a function call with space-separated arguments. Unknown
+// single-word placeholders are left untouched.
+func Expand(s string, vars map[string]string) (string, error) {
+	return ExpandRand(s, vars, defaultRand)
+}
+
+// ExpandRand is like Expand but draws random values from r, which must not
+// be shared between goroutines
+func ExpandRand(s string, vars map[string]string, r *rand.Rand) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			b.WriteString(s)
+			break
+		}
+		end := strings.Index(s[start:], "}}")
+		if end < 0 {
+			b.WriteString(s)
+			break
+		}
+		end += start
+
+		b.WriteString(s[:start])
+		value, err := evaluate(s[start+2:end], vars, r)
+		if err != nil {
+			return "", err
+		}
+		if value == nil {
+			b.WriteString(s[start : end+2])
+		} else {
+			b.WriteString(*value)
+		}
+		s = s[end+2:]
+	}
+
+	return b.String(), nil
+}
+
+// Validate checks that every function call in s refers to a registered
+// function, without evaluating anything
+func Validate(s string) error {
+	for {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			return nil
+		}
+		end := strings.Index(s[start:], "}}")
+		if end < 0 {
+			return nil
+		}
+		end += start
+
+		tokens, err := tokenize(s[start+2 : end])
+		if err != nil {
+			return err
+		}
+		if len(tokens) > 1 {
+			if _, exists := Lookup(tokens[0].text); !exists {
+				return fmt.Errorf("unknown template function: %s", tokens[0].text)
+			}
+		}
+		s = s[end+2:]
+	}
+}
+
+// token is a placeholder word, remembering whether it was quoted
+type token struct {
+	text   string
+	quoted bool
+}
+
+// placeholder is a parsed {{...}} expression
+type placeholder struct {
+	source string
+	tokens []token
+	fn     RandFunc
+}
+
+// parsePlaceholder tokenizes expr, the text between the braces of source,
+// and looks up the function it calls
+func parsePlaceholder(source, expr string) (*placeholder, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &placeholder{source: source, tokens: tokens}
+	if len(tokens) > 0 {
+		p.fn, _ = Lookup(tokens[0].text)
+	}
+	return p, nil
+}
+
+// evaluate resolves a single placeholder expression. A nil result means the
+// placeholder should be kept as is.
+func evaluate(expr string, vars map[string]string, r *rand.Rand) (*string, error) {
+	p, err := parsePlaceholder("", expr)
+	if err != nil {
+		return nil, err
+	}
+	return p.evaluate(vars, r)
+}
+
+// evaluate resolves the placeholder against vars
+func (p *placeholder) evaluate(vars map[string]string, r *rand.Rand) (*string, error) {
+	tokens := p.tokens
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	name := tokens[0].text
+	if len(tokens) == 1 && !tokens[0].quoted {
+		if value, exists := resolve(name, vars); exists {
+			return &value, nil
+		}
+		if p.fn == nil {
+			return nil, nil
+		}
+	}
+
+	if p.fn == nil {
+		return nil, fmt.Errorf("unknown template function: %s", name)
+	}
+
+	args := make([]string, 0, len(tokens)-1)
+	for _, arg := range tokens[1:] {
+		if arg.quoted {
+			args = append(args, arg.text)
+			continue
+		}
+		value, exists := resolve(arg.text, vars)
+		if !exists {
+			value = arg.text
+		}
+		args = append(args, value)
+	}
+
+	value, err := p.fn(r, args...)
+	if err != nil {
+		return nil, fmt.Errorf("template function %s failed: %w", name, err)
+	}
+
+	return &value, nil
+}
+
+// resolve looks up a variable, falling back to the process environment for
+// env.NAME references
+func resolve(name string, vars map[string]string) (string, bool) {
+	if value, exists := vars[name]; exists {
+		return value, true
+	}
+	if key, isEnv := strings.CutPrefix(name, "env."); isEnv {
+		return os.LookupEnv(key)
+	}
+	return "", false
+}
+
+// tokenize splits an expression on whitespace, honouring double quotes
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	expr = strings.TrimSpace(expr)
+
+	for len(expr) > 0 {
+		if expr[0] == '"' {
+			end := strings.IndexByte(expr[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string in template: %s", expr)
+			}
+			tokens = append(tokens, token{text: expr[1 : end+1], quoted: true})
+			expr = strings.TrimSpace(expr[end+2:])
+			continue
+		}
+
+		end := strings.IndexAny(expr, " \t")
+		if end < 0 {
+			end = len(expr)
+		}
+		tokens = append(tokens, token{text: expr[:end]})
+		expr = strings.TrimSpace(expr[end:])
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,301 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/reporting"
+	"github.com/alexandredias/gotsunami/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func agentRequest(t *testing.T, method, url, token string, body interface{}) *http.Response {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&payload).Encode(body))
+	}
+	req, err := http.NewRequest(method, url, &payload)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestAgentScheduledRun(t *testing.T) {
+	var hits atomic.Int64
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer target.Close()
+
+	agent := server.NewAgent("", "gen-1", "test", "s3cret")
+	ts := httptest.NewServer(agent.Handler())
+	defer ts.Close()
+
+	// Health stays open, everything else needs the token
+	resp := agentRequest(t, http.MethodGet, ts.URL+"/api/v1/health", "", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = agentRequest(t, http.MethodGet, ts.URL+"/api/v1/agent", "wrong", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	startAt := time.Now().Add(300 * time.Millisecond)
+	run := server.AgentRunRequest{
+		RunRequest: server.RunRequest{
+			Scenario:      &config.Scenario{Name: "agent", Method: "GET", URL: "/", BaseURL: target.URL},
+			VirtualUsers:  2,
+			MaxRequests:   5,
+			Duration:      "5s",
+			SkipPreflight: true,
+		},
+		StartAt: startAt,
+	}
+	resp = agentRequest(t, http.MethodPost, ts.URL+"/api/v1/agent/run", "s3cret", run)
+	var info server.RunInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, server.RunStatusScheduled, info.Status)
+
+	// Nothing is sent before the start time, and a second run is refused
+	resp = agentRequest(t, http.MethodPost, ts.URL+"/api/v1/agent/run", "s3cret", run)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, server.AgentStatusBusy, agent.Info().Status)
+	assert.Zero(t, hits.Load())
+
+	select {
+	case <-agent.Current().Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("run did not finish")
+	}
+	assert.Equal(t, int64(10), hits.Load(), "5 requests per VU")
+	assert.False(t, agent.Current().Info().StartedAt.Before(startAt))
+	assert.Equal(t, server.AgentStatusIdle, agent.Info().Status)
+
+	resp = agentRequest(t, http.MethodGet, ts.URL+"/api/v1/agent/run/report", "s3cret", nil)
+	var report reporting.Report
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "gen-1", report.Metadata.Labels["agent"])
+}
+
+func TestAgentStopScheduledRun(t *testing.T) {
+	agent := server.NewAgent("", "gen-1", "test", "")
+	run, err := agent.Start(&server.AgentRunRequest{
+		RunRequest: server.RunRequest{
+			Scenario:      &config.Scenario{Name: "agent", Method: "GET", URL: "/", BaseURL: "http://127.0.0.1:1"},
+			VirtualUsers:  1,
+			Duration:      "1s",
+			SkipPreflight: true,
+		},
+		StartAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	run.Stop()
+	select {
+	case <-run.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("stopped run did not finish")
+	}
+	assert.Equal(t, server.RunStatusStopped, run.Info().Status)
+	assert.Nil(t, run.Report())
+
+	_, err = agent.Start(&server.AgentRunRequest{RunRequest: server.RunRequest{ScenarioID: "scn-1"}})
+	assert.Error(t, err)
+}
+
+func TestAgentCapsRunRequests(t *testing.T) {
+	agent := server.NewAgent("", "gen-1", "test", "")
+	ts := httptest.NewServer(agent.Handler())
+	defer ts.Close()
+
+	huge := &config.Scenario{Name: "agent", Method: "POST", URL: "/", BaseURL: "http://127.0.0.1:1", Body: strings.Repeat("x", 11<<20)}
+	resp := agentRequest(t, http.MethodPost, ts.URL+"/api/v1/agent/run", "", server.AgentRunRequest{
+		RunRequest: server.RunRequest{Scenario: huge, Duration: "1s", SkipPreflight: true},
+		StartAt:    time.Now().Add(time.Hour),
+	})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.Nil(t, agent.Current())
+}
+
+func TestSplitVUs(t *testing.T) {
+	assert.Equal(t, []int{5, 5}, server.SplitVUs(10, []float64{2, 2}))
+	assert.Equal(t, []int{3, 7}, server.SplitVUs(10, []float64{1.5, 3.5}))
+	assert.Equal(t, []int{1, 1, 0}, server.SplitVUs(2, []float64{4, 4, 4}))
+	// Agents reporting no CPUs count as one
+	assert.Equal(t, []int{2, 2}, server.SplitVUs(4, []float64{0, 1}))
+}
+
+func TestCoordinatorRun(t *testing.T) {
+	var hits atomic.Int64
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer target.Close()
+
+	var clients []*server.AgentClient
+	for _, name := range []string{"gen-1", "gen-2"} {
+		agent := server.NewAgent("", name, "test", "s3cret")
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		go agent.ServeGRPC(listener)
+		defer agent.Shutdown(context.Background())
+
+		client, err := server.DialAgent(listener.Addr().String(), "s3cret")
+		require.NoError(t, err)
+		defer client.Close()
+		clients = append(clients, client)
+	}
+
+	// A wrong token is refused
+	intruder, err := server.DialAgent(clients[0].Addr(), "wrong")
+	require.NoError(t, err)
+	defer intruder.Close()
+	_, err = intruder.Info(context.Background())
+	assert.Error(t, err)
+
+	coordinator := server.NewCoordinator(clients)
+	coordinator.StartDelay = 200 * time.Millisecond
+	coordinator.Interval = 100 * time.Millisecond
+	var live atomic.Int64
+	coordinator.OnMetrics = func(summary *metrics.Summary) {
+		live.Store(summary.TotalRequests)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	report, err := coordinator.Run(ctx, server.RunRequest{
+		Scenario:      &config.Scenario{Name: "distributed", Method: "GET", URL: "/", BaseURL: target.URL},
+		VirtualUsers:  4,
+		MaxRequests:   3,
+		Duration:      "10s",
+		SkipPreflight: true,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(12), hits.Load(), "3 requests per VU")
+	assert.Equal(t, int64(12), report.Summary.TotalRequests)
+	assert.Equal(t, 4, report.Configuration.VirtualUsers)
+	assert.ElementsMatch(t, []string{"gen-1", "gen-2"}, report.Metadata.Sources)
+	assert.NotContains(t, report.Metadata.Labels, "agent")
+	assert.Positive(t, live.Load())
+}
+
+func TestCoordinatorStopsAgentsWhenOneFails(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer target.Close()
+
+	var agents []*server.Agent
+	var clients []*server.AgentClient
+	for _, name := range []string{"gen-1", "gen-2"} {
+		agent := server.NewAgent("", name, "test", "")
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		go agent.ServeGRPC(listener)
+		defer agent.Shutdown(context.Background())
+		agents = append(agents, agent)
+
+		client, err := server.DialAgent(listener.Addr().String(), "")
+		require.NoError(t, err)
+		defer client.Close()
+		clients = append(clients, client)
+	}
+
+	// gen-2 goes away once the load is under way, breaking its stream
+	coordinator := server.NewCoordinator(clients)
+	coordinator.StartDelay = 200 * time.Millisecond
+	coordinator.Interval = 100 * time.Millisecond
+	var lost sync.Once
+	coordinator.OnMetrics = func(summary *metrics.Summary) {
+		if summary.TotalRequests == 0 {
+			return
+		}
+		lost.Do(func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			agents[1].Shutdown(ctx)
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := coordinator.Run(ctx, server.RunRequest{
+		Scenario:      &config.Scenario{Name: "distributed", Method: "GET", URL: "/", BaseURL: target.URL},
+		VirtualUsers:  2,
+		Duration:      "1m",
+		SkipPreflight: true,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "metrics stream ended")
+	assert.Less(t, time.Since(start), 15*time.Second, "gen-1 ran on after gen-2 was lost")
+
+	// gen-1 was stopped rather than left loading the target
+	run := agents[0].Current()
+	require.NotNil(t, run)
+	select {
+	case <-run.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("gen-1 still running")
+	}
+	assert.Equal(t, server.RunStatusStopped, run.Info().Status)
+}
+
+func TestAgentRejectsHostAccess(t *testing.T) {
+	agent := server.NewAgent("", "gen-1", "test", "")
+	ts := httptest.NewServer(agent.Handler())
+	defer ts.Close()
+
+	scenario := &config.Scenario{Name: "agent", Method: "GET", URL: "/", BaseURL: "http://127.0.0.1:1",
+		Hooks: &config.HooksConfig{OnStart: []config.HookConfig{{Command: "id"}}}}
+	run := server.AgentRunRequest{RunRequest: server.RunRequest{Scenario: scenario, Duration: "1s", SkipPreflight: true},
+		StartAt: time.Now().Add(time.Hour)}
+
+	resp := agentRequest(t, http.MethodPost, ts.URL+"/api/v1/agent/run", "", run)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Nil(t, agent.Current())
+
+	// A data file would send the agent's files to the target, over HTTP or
+	// from a coordinator over gRPC
+	leak := &config.Scenario{Name: "agent", Method: "GET", URL: "/", BaseURL: "http://127.0.0.1:1",
+		Headers: map[string]string{"X-Leak": "{{csv.root}}"},
+		Data:    &config.DataConfig{File: "/etc/passwd", Delimiter: ":"}}
+	leakRun := server.AgentRunRequest{RunRequest: server.RunRequest{Scenario: leak, Duration: "1s", SkipPreflight: true},
+		StartAt: time.Now().Add(time.Hour)}
+	resp = agentRequest(t, http.MethodPost, ts.URL+"/api/v1/agent/run", "", leakRun)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	_, err := agent.Start(&leakRun)
+	assert.ErrorContains(t, err, "data file /etc/passwd")
+	assert.Nil(t, agent.Current())
+
+	agent.AllowHostAccess(true)
+	started, err := agent.Start(&run)
+	require.NoError(t, err)
+	started.Stop()
+	<-started.Done()
+}
@@ -0,0 +1,96 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/assets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssets(t *testing.T) {
+	files := map[string]string{
+		"/static/app.js":        strings.Repeat("j", 300),
+		"/static/img/logo.png":  strings.Repeat("p", 1200),
+		"/static/img/hero.webp": strings.Repeat("w", 5000),
+	}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/assets.xml</loc></sitemap></sitemapindex>`, server.URL)
+		case "/assets.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%[1]s/static/app.js</loc></url><url><loc>%[1]s/static/img/logo.png</loc></url>`+
+				`<url><loc>https://elsewhere.example.com/x.css</loc></url></urlset>`, server.URL)
+		case "/static/":
+			fmt.Fprint(w, `<a href="../">../</a><a href="?C=N;O=D">Name</a><a href="app.js">app.js</a><a href="img/">img/</a>`)
+		case "/static/img/":
+			fmt.Fprint(w, `<a href="/static/">up</a><a href="logo.png">logo.png</a><a href="hero.webp">hero.webp</a>`)
+		case "/static/img/hero.webp":
+			// Only a range request tells the size of a chunked response
+			if r.Header.Get("Range") == "bytes=0-0" {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-0/%d", len(files[r.URL.Path])))
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte("w"))
+				return
+			}
+			w.(http.Flusher).Flush()
+			fmt.Fprint(w, files[r.URL.Path])
+		default:
+			http.ServeContent(w, r, r.URL.Path, time.Time{}, strings.NewReader(files[r.URL.Path]))
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	urls, err := assets.FromSitemap(ctx, server.Client(), server.URL+"/sitemap.xml")
+	require.NoError(t, err)
+	origin, relative, others := assets.Relative(assets.Sizes(ctx, server.Client(), urls, 2))
+	assert.Equal(t, server.URL, origin)
+	assert.Equal(t, []assets.Asset{{Path: "/static/app.js", Size: 300}, {Path: "/static/img/logo.png", Size: 1200}}, relative)
+	assert.Len(t, others, 1)
+
+	// Listings are followed down, never up nor to their sort links
+	urls, err = assets.FromListing(ctx, server.Client(), server.URL+"/static", 5)
+	require.NoError(t, err)
+	_, relative, _ = assets.Relative(assets.Sizes(ctx, server.Client(), urls, 4))
+	assert.Equal(t, []assets.Asset{
+		{Path: "/static/app.js", Size: 300},
+		{Path: "/static/img/logo.png", Size: 1200},
+		{Path: "/static/img/hero.webp", Size: 5000},
+	}, relative)
+
+	urls, err = assets.FromListing(ctx, server.Client(), server.URL+"/static/", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{server.URL + "/static/app.js"}, urls)
+
+	_, err = assets.FromSitemap(ctx, server.Client(), server.URL+"/missing.xml")
+	assert.Error(t, err)
+
+	// Local directories skip hidden files
+	found, err := assets.FromDirectory(fstest.MapFS{
+		"index.html":    {Data: []byte("<html></html>")},
+		"css/site.css":  {Data: []byte("body{}")},
+		"my docs/a.pdf": {Data: []byte("%PDF")},
+		".git/config":   {Data: []byte("[core]")},
+		".htaccess":     {Data: []byte("deny")},
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []assets.Asset{
+		{Path: "/index.html", Size: 13},
+		{Path: "/css/site.css", Size: 6},
+		{Path: "/my%20docs/a.pdf", Size: 4},
+	}, found)
+
+	var data bytes.Buffer
+	require.NoError(t, assets.WriteCSV(&data, append(found, assets.Asset{Path: "/unknown", Size: -1})))
+	assert.Equal(t, "path,size\n/index.html,13\n/css/site.css,6\n/my%20docs/a.pdf,4\n/unknown,0\n", data.String())
+}
@@ -0,0 +1,67 @@
+package unit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/alexandredias/gotsunami/internal/cli"
+	"github.com/alexandredias/gotsunami/pkg/plugin"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildInfoCommand(t *testing.T) {
+	// Plugins are only started when used, so any executable is listed
+	dir := t.TempDir()
+	fake := filepath.Join(dir, plugin.BinaryPrefix+"buildinfo")
+	require.NoError(t, os.WriteFile(fake, []byte("#!/bin/sh\n"), 0o755))
+	viper.Set("plugin_dirs", []string{dir})
+	defer viper.Set("plugin_dirs", nil)
+
+	cmd := cli.NewBuildInfoCommand("1.2.3", "2026-01-01T00:00:00Z")
+	cmd.SetArgs(nil)
+
+	stdout := os.Stdout
+	read, write, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stdout = write
+	err = cmd.Execute()
+	os.Stdout = stdout
+	write.Close()
+	require.NoError(t, err)
+	output, err := io.ReadAll(read)
+	require.NoError(t, err)
+
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(output, &fields))
+	for _, key := range []string{"version", "build_time", "go_version", "platform", "compiler", "protocols", "plugins"} {
+		assert.Contains(t, fields, key)
+	}
+
+	var info cli.BuildInfo
+	require.NoError(t, json.Unmarshal(output, &info))
+	assert.Equal(t, "1.2.3", info.Version)
+	assert.Equal(t, "2026-01-01T00:00:00Z", info.BuildTime)
+	assert.Equal(t, runtime.GOOS+"/"+runtime.GOARCH, info.Platform)
+	assert.Subset(t, info.Protocols, []string{"http", "grpc", "websocket", "buildinfo"})
+	assert.Equal(t, map[string]string{"buildinfo": fake}, info.Plugins)
+}
+
+func TestImportStaticRejectsCSVOutput(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log(1)"), 0o644))
+	output := filepath.Join(t.TempDir(), "assets.csv")
+
+	// The data file would take the name of the scenario
+	cmd := cli.NewImportCommand()
+	cmd.SetArgs([]string{"static", "--dir", dir, "--base-url", "https://cdn.example.com", "--output", output})
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	assert.ErrorContains(t, cmd.Execute(), "the data file would overwrite the scenario")
+	assert.NoFileExists(t, output)
+}
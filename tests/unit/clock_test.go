@@ -0,0 +1,89 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClockMonitorAgrees(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := clock.NewMonitor(start)
+	for i := 1; i <= 10; i++ {
+		now := start.Add(time.Duration(i) * time.Second)
+		m.CheckReadings(now, now)
+	}
+	assert.Nil(t, m.Summary())
+}
+
+func TestClockMonitorJump(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := clock.NewMonitor(start)
+	m.CheckReadings(start.Add(time.Second), start.Add(time.Second))
+	// The system clock is stepped back 2s during the second window
+	m.CheckReadings(start.Add(2*time.Second), start)
+	m.CheckReadings(start.Add(3*time.Second), start.Add(time.Second))
+
+	summary := m.Summary()
+	require.NotNil(t, summary)
+	assert.Equal(t, 1, summary.JumpCount)
+	require.Len(t, summary.Jumps, 1)
+	assert.Equal(t, "-2s", summary.Jumps[0].Shift)
+	assert.Equal(t, "2s", summary.Jumps[0].Offset)
+	assert.Zero(t, summary.StallCount)
+	assert.Empty(t, summary.Drift)
+	assert.Contains(t, summary.Warning, "the system clock jumped 1 times")
+}
+
+func TestClockMonitorStall(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := clock.NewMonitor(start)
+	m.CheckReadings(start.Add(time.Second), start.Add(time.Second))
+	// The next check wakes up 1.5s late, on both clocks
+	late := start.Add(3500 * time.Millisecond)
+	m.CheckReadings(late, late)
+	// A check 100ms late is within the threshold
+	late = late.Add(1100 * time.Millisecond)
+	m.CheckReadings(late, late)
+
+	summary := m.Summary()
+	require.NotNil(t, summary)
+	assert.Equal(t, 1, summary.StallCount)
+	assert.Equal(t, "1.5s", summary.StalledTime)
+	assert.Equal(t, "1.5s", summary.LongestStall)
+	assert.Zero(t, summary.JumpCount)
+	assert.Contains(t, summary.Warning, "the load generator stalled 1 times for 1.5s")
+}
+
+func TestClockMonitorDrift(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := clock.NewMonitor(start)
+	// The wall clock gains 2ms a second: under the jump threshold, but it
+	// adds up to 20ms over the test
+	for i := 1; i <= 10; i++ {
+		now := start.Add(time.Duration(i) * time.Second)
+		m.CheckReadings(now, now.Add(time.Duration(i)*2*time.Millisecond))
+	}
+
+	summary := m.Summary()
+	require.NotNil(t, summary)
+	assert.Equal(t, "+20ms", summary.Drift)
+	assert.Zero(t, summary.JumpCount)
+	assert.Zero(t, summary.StallCount)
+	assert.Empty(t, summary.Warning)
+}
+
+func TestClockMonitorNoStallAfterRun(t *testing.T) {
+	m := clock.NewMonitor(time.Now())
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	m.Run(ctx)
+
+	// The drain period and teardown after the run are not checked
+	time.Sleep(1500 * time.Millisecond)
+	assert.Nil(t, m.Summary())
+}
@@ -1,11 +1,15 @@
 package unit
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/alexandredias/gotsunami/internal/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestScenarioValidation(t *testing.T) {
@@ -43,6 +47,71 @@ func TestScenarioValidation(t *testing.T) {
 			},
 			wantError: true,
 		},
+		{
+			name: "trace method",
+			scenario: &config.Scenario{
+				Name:    "test",
+				Method:  "TRACE",
+				URL:     "/test",
+				BaseURL: "https://example.com",
+			},
+			wantError: false,
+		},
+		{
+			name: "custom method without opt-in",
+			scenario: &config.Scenario{
+				Name:    "test",
+				Method:  "PURGE",
+				URL:     "/test",
+				BaseURL: "https://example.com",
+			},
+			wantError: true,
+		},
+		{
+			name: "custom method",
+			scenario: &config.Scenario{
+				Name:               "test",
+				Method:             "PURGE",
+				URL:                "/test",
+				BaseURL:            "https://example.com",
+				AllowCustomMethods: true,
+			},
+			wantError: false,
+		},
+		{
+			name: "custom method that is not a token",
+			scenario: &config.Scenario{
+				Name:               "test",
+				Method:             "PURGE ALL",
+				URL:                "/test",
+				BaseURL:            "https://example.com",
+				AllowCustomMethods: true,
+			},
+			wantError: true,
+		},
+		{
+			name: "scope of undefined variable",
+			scenario: &config.Scenario{
+				Name:           "test",
+				Method:         "GET",
+				URL:            "/test",
+				BaseURL:        "https://example.com",
+				VariableScopes: map[string]string{"token": config.ScopeVU},
+			},
+			wantError: true,
+		},
+		{
+			name: "invalid variable scope",
+			scenario: &config.Scenario{
+				Name:           "test",
+				Method:         "GET",
+				URL:            "/test",
+				BaseURL:        "https://example.com",
+				Variables:      map[string]string{"token": "{{random.uuid}}"},
+				VariableScopes: map[string]string{"token": "session"},
+			},
+			wantError: true,
+		},
 		{
 			name: "invalid timeout",
 			scenario: &config.Scenario{
@@ -214,3 +283,404 @@ func TestScenarioGetValidationConfig(t *testing.T) {
 	validation := scenario.GetValidationConfig()
 	assert.Equal(t, []int{200}, validation.StatusCodes)
 }
+
+func TestParseBandwidth(t *testing.T) {
+	rate, err := config.ParseBandwidth("1.5mbps")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(187500), rate)
+
+	rate, err = config.ParseBandwidth("")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), rate)
+
+	_, err = config.ParseBandwidth("fast")
+	assert.Error(t, err)
+
+	bandwidth, err := config.ParseBandwidthFlag("dsl")
+	assert.NoError(t, err)
+	download, upload, err := bandwidth.Rates()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(187500), download)
+	assert.Equal(t, int64(48000), upload)
+
+	_, err = config.ParseBandwidthFlag("carrier-pigeon")
+	assert.Error(t, err)
+}
+
+func TestParseLatencyGoal(t *testing.T) {
+	goal, err := config.ParseLatencyGoal("p95=200ms")
+	require.NoError(t, err)
+	assert.Equal(t, config.LatencyObjective{Percentile: 95, Max: "200ms"}, goal)
+
+	goal, err = config.ParseLatencyGoal("P99.9=1s")
+	require.NoError(t, err)
+	assert.Equal(t, 99.9, goal.Percentile)
+
+	for _, invalid := range []string{"95=200ms", "p95", "p100=1s", "p95=fast", "p95=0s"} {
+		_, err := config.ParseLatencyGoal(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestResolveKeepAlive(t *testing.T) {
+	on, off := true, false
+	tests := []struct {
+		name             string
+		keepAlive        *bool
+		disableKeepAlive *bool
+		want             bool
+		wantErr          bool
+	}{
+		{name: "default", want: true},
+		{name: "keep-alive", keepAlive: &on, want: true},
+		{name: "keep-alive=false", keepAlive: &off, want: false},
+		{name: "disable-keep-alive", disableKeepAlive: &on, want: false},
+		{name: "disable-keep-alive=false", disableKeepAlive: &off, want: true},
+		{name: "both agree on disabling", keepAlive: &off, disableKeepAlive: &on, want: false},
+		{name: "both agree on keeping", keepAlive: &on, disableKeepAlive: &off, want: true},
+		{name: "conflict", keepAlive: &on, disableKeepAlive: &on, wantErr: true},
+		{name: "conflict disabled", keepAlive: &off, disableKeepAlive: &off, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keepAlive, err := config.ResolveKeepAlive(tt.keepAlive, tt.disableKeepAlive)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "conflicting keep-alive settings")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, keepAlive)
+		})
+	}
+}
+
+func TestSettingPrecedence(t *testing.T) {
+	assert.Equal(t, "GOTSUNAMI_RUN_RAMP_UP", config.SettingEnv("run.ramp_up"))
+	assert.Equal(t, "GOTSUNAMI_RUN_HTTP_VERSION", config.SettingEnv("run.http-version"))
+
+	// Each source overrides those before it
+	for i, source := range config.SettingSources {
+		for _, other := range config.SettingSources[:i] {
+			assert.True(t, config.Overrides(source, other), "%s over %s", source, other)
+			assert.False(t, config.Overrides(other, source), "%s over %s", other, source)
+		}
+		assert.False(t, config.Overrides(source, source))
+	}
+}
+
+func TestResolveScenarioSettings(t *testing.T) {
+	newScenario := func() *config.Scenario {
+		return &config.Scenario{
+			Timeout:     "5s",
+			HTTPVersion: "2",
+			Outfile:     "scenario.json",
+			Bandwidth:   &config.BandwidthConfig{Profile: "3g"},
+			Stages:      []config.StageConfig{{Duration: "1m", Target: "10rps"}},
+			LoadPattern: &config.LoadPatternConfig{Phases: []config.PhaseConfig{{Duration: "1m", Intensity: 1}}},
+			Validation:  &config.ValidationConfig{StatusCodes: []int{201}, ResponseTimeMax: "1s"},
+		}
+	}
+	newConfig := func() *config.LoadTestConfig {
+		return &config.LoadTestConfig{
+			Timeout:            10 * time.Second,
+			HTTPVersion:        "1.1",
+			Outfile:            "flag.json",
+			Bandwidth:          &config.BandwidthConfig{Profile: "dsl"},
+			Stages:             []config.StageConfig{{Duration: "30s", Target: "5rps"}},
+			Pattern:            "spike",
+			ExpectStatus:       []int{200},
+			ExpectResponseTime: 2 * time.Second,
+		}
+	}
+
+	// The scenario replaces values from the config file and defaults
+	for _, source := range []string{"", config.SourceDefault, config.SourceConfigFile} {
+		sources := map[string]string{}
+		for _, name := range config.ScenarioSettings {
+			sources[name] = source
+		}
+		cfg, scenario := newConfig(), newScenario()
+		config.ResolveScenarioSettings(cfg, scenario, sources)
+
+		assert.Equal(t, 5*time.Second, cfg.Timeout, source)
+		assert.Equal(t, "5s", scenario.Timeout, source)
+		assert.Equal(t, "2", cfg.HTTPVersion, source)
+		assert.Equal(t, "scenario.json", cfg.Outfile, source)
+		assert.Nil(t, cfg.Bandwidth, source)
+		assert.Nil(t, cfg.Stages, source)
+		assert.NotNil(t, scenario.LoadPattern, source)
+		assert.Nil(t, cfg.ExpectStatus, source)
+		assert.Zero(t, cfg.ExpectResponseTime, source)
+	}
+
+	// Environment variables and flags replace the scenario's values
+	for _, source := range []string{config.SourceEnv, config.SourceFlag} {
+		sources := map[string]string{}
+		for _, name := range config.ScenarioSettings {
+			sources[name] = source
+		}
+		cfg, scenario := newConfig(), newScenario()
+		config.ResolveScenarioSettings(cfg, scenario, sources)
+
+		assert.Equal(t, 10*time.Second, cfg.Timeout, source)
+		assert.Equal(t, "10s", scenario.Timeout, source)
+		assert.Equal(t, "1.1", cfg.HTTPVersion, source)
+		assert.Equal(t, "flag.json", cfg.Outfile, source)
+		assert.Equal(t, "dsl", cfg.Bandwidth.Profile, source)
+		assert.Len(t, cfg.Stages, 1, source)
+		assert.Nil(t, scenario.LoadPattern, source)
+		assert.Equal(t, []int{200}, cfg.ExpectStatus, source)
+		assert.Equal(t, 2*time.Second, cfg.ExpectResponseTime, source)
+	}
+
+	// Settings the scenario leaves out keep their value from any source
+	cfg, scenario := newConfig(), &config.Scenario{}
+	config.ResolveScenarioSettings(cfg, scenario, nil)
+	assert.Equal(t, 10*time.Second, cfg.Timeout)
+	assert.Equal(t, "10s", scenario.Timeout)
+	assert.Equal(t, "1.1", cfg.HTTPVersion)
+	assert.Equal(t, []int{200}, cfg.ExpectStatus)
+
+	value, set := newScenario().RunSetting("expect_status")
+	assert.True(t, set)
+	assert.Equal(t, []int{201}, value)
+	_, set = (&config.Scenario{}).RunSetting("expect_status")
+	assert.False(t, set)
+}
+
+func TestParseStages(t *testing.T) {
+	rate, err := config.ParseRate("30/m")
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.5, rate, 0.001)
+
+	rate, err = config.ParseRate("500rps")
+	assert.NoError(t, err)
+	assert.InDelta(t, 500, rate, 0.001)
+
+	_, err = config.ParseRate("-1rps")
+	assert.Error(t, err)
+
+	stage, err := config.ParseStageFlag("2m:500rps")
+	assert.NoError(t, err)
+	assert.Equal(t, config.StageConfig{Duration: "2m", Target: "500rps"}, stage)
+
+	_, err = config.ParseStageFlag("500rps")
+	assert.Error(t, err)
+	_, err = config.ParseStageFlag("2m:fast")
+	assert.Error(t, err)
+
+	assert.Error(t, config.ValidateStages([]config.StageConfig{{Duration: "0s", Target: "10rps"}}))
+
+	scenario := &config.Scenario{
+		Name:        "stages",
+		Method:      "GET",
+		URL:         "/",
+		BaseURL:     "http://localhost",
+		Stages:      []config.StageConfig{{Duration: "1m", Target: "10rps"}},
+		LoadPattern: &config.LoadPatternConfig{Phases: []config.PhaseConfig{{Duration: "1m", Intensity: 1}}},
+	}
+	assert.ErrorContains(t, scenario.Validate(), "mutually exclusive")
+	scenario.LoadPattern = nil
+	assert.NoError(t, scenario.Validate())
+}
+
+func TestCollectLabels(t *testing.T) {
+	t.Setenv("GOTSUNAMI_LABEL_ENVIRONMENT", "staging")
+	t.Setenv("GOTSUNAMI_LABEL_GIT_SHA", "from-env")
+
+	labels, err := config.CollectLabels(map[string]string{"git_sha": "abc123"})
+	assert.NoError(t, err)
+	assert.Equal(t, "staging", labels["environment"])
+	assert.Equal(t, "abc123", labels["git_sha"])
+}
+
+func TestLoadScenarioFromStdin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "generated.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"name": "piped", "method": "GET", "url": "/", "base_url": "https://example.com", "script": "hooks.lua"}`), 0644))
+
+	stdin, err := os.Open(path)
+	require.NoError(t, err)
+	defer stdin.Close()
+
+	original := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = original }()
+
+	scenario, err := config.LoadScenarioFromFile(config.StdinScenario)
+	require.NoError(t, err)
+	assert.Equal(t, "piped", scenario.Name)
+	assert.Equal(t, "hooks.lua", scenario.Script)
+}
+
+func TestLoadScenarioResolvesFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tenants.csv"), []byte("acme\nglobex\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "users.csv"), []byte("user\nalice\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "scenario.json"), []byte(`{
+  "name": "files",
+  "method": "GET",
+  "url": "/",
+  "base_url": "https://example.com",
+  "data": {"file": "users.csv"},
+  "tenants": {"file": "tenants.csv"}
+}`), 0644))
+
+	// Loaded from another working directory, the files are still found next
+	// to the scenario
+	original, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	defer func() { require.NoError(t, os.Chdir(original)) }()
+
+	scenario, err := config.LoadScenarioFromFile(filepath.Join(dir, "scenario.json"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "tenants.csv"), scenario.Tenants.File)
+	assert.Equal(t, filepath.Join(dir, "users.csv"), scenario.Data.File)
+	assert.FileExists(t, scenario.Tenants.File)
+}
+
+func TestScenarioSchemaUpToDate(t *testing.T) {
+	generated, err := config.GenerateScenarioSchema()
+	require.NoError(t, err)
+	assert.Equal(t, string(generated), string(config.ScenarioSchema()), "run go generate ./internal/config")
+}
+
+func TestValidateScenarioJSON(t *testing.T) {
+	valid := `{
+  "$schema": "scenario.schema.json",
+  "name": "schema",
+  "method": "GET",
+  "url": "/",
+  "base_url": "https://example.com",
+  "variable_scopes": {"token": "vu"},
+  "validation": {"status_codes": [200]}
+}`
+	assert.NoError(t, config.ValidateScenarioJSON([]byte(valid)))
+
+	invalid := `{
+  "name": "schema",
+  "method": "GET",
+  "url": "/",
+  "retry": {"backoff": "cubic"},
+  "validation": {"status_codes": ["200"]},
+  "vus": 2
+}`
+	err := config.ValidateScenarioJSON([]byte(invalid))
+	var schemaErrors config.SchemaErrors
+	require.ErrorAs(t, err, &schemaErrors)
+	require.Len(t, schemaErrors, 4)
+
+	assert.Equal(t, config.SchemaError{Line: 5, Column: 24, Field: "retry.backoff", Message: `"cubic" is not one of linear, exponential, fixed`}, schemaErrors[0])
+	assert.Equal(t, config.SchemaError{Line: 6, Column: 35, Field: "validation.status_codes[0]", Message: "expected integer, got string"}, schemaErrors[1])
+	assert.Equal(t, config.SchemaError{Line: 7, Column: 3, Field: "vus", Message: "unknown field"}, schemaErrors[2])
+	assert.Equal(t, "base_url", schemaErrors[3].Field)
+
+	err = config.ValidateScenarioJSON([]byte("{\n  \"name\": \"schema\",\n  \"method\": \n}"))
+	var syntaxError config.SchemaError
+	require.ErrorAs(t, err, &syntaxError)
+	assert.Equal(t, 4, syntaxError.Line)
+}
+
+func TestLoadTimelineFromFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "browse.json"), []byte(`{"name": "browse", "method": "GET", "url": "/", "base_url": "https://example.com"}`), 0644))
+	timelineFile := filepath.Join(dir, "sale.json")
+	require.NoError(t, os.WriteFile(timelineFile, []byte(`{
+  "name": "sale",
+  "phases": [
+    {"scenario": "browse.json", "duration": "30m"},
+    {"name": "rush", "scenario": "browse.json", "start": "10m", "duration": "5m", "vus": 100, "pattern": "spike"}
+  ]
+}`), 0644))
+
+	data, err := os.ReadFile(timelineFile)
+	require.NoError(t, err)
+	assert.True(t, config.IsTimeline(data))
+
+	timeline, err := config.LoadTimelineFromFile(timelineFile)
+	require.NoError(t, err)
+	require.Len(t, timeline.Phases, 2)
+	assert.Equal(t, "browse", timeline.Phases[0].Name)
+	assert.Equal(t, time.Duration(0), timeline.Phases[0].GetStart())
+	assert.Equal(t, 10*time.Minute, timeline.Phases[1].GetStart())
+	assert.Equal(t, 5*time.Minute, timeline.Phases[1].GetDuration())
+	assert.Equal(t, "browse", timeline.Phases[1].Scenario.Name)
+
+	// Phases sharing a scenario need distinct names
+	require.NoError(t, os.WriteFile(timelineFile, []byte(`{"phases": [
+    {"scenario": "browse.json", "duration": "1m"},
+    {"scenario": "browse.json", "start": "30s", "duration": "1m"}
+  ]}`), 0644))
+	_, err = config.LoadTimelineFromFile(timelineFile)
+	assert.ErrorContains(t, err, "duplicate phase name")
+
+	// The mix refers to phases by name and owns their VUs
+	mixed := `{"vus": 50, "phases": [
+    {"name": "reads", "scenario": "browse.json", "duration": "1h"},
+    {"name": "writes", "scenario": "browse.json", "duration": "1h"%s}
+  ], "mix": [
+    {"duration": "0s", "weights": {"reads": 9, "writes": 1}},
+    {"duration": "%s", "weights": {"%s": 4, "writes": 6}}
+  ]}`
+	require.NoError(t, os.WriteFile(timelineFile, []byte(fmt.Sprintf(mixed, "", "40m", "reads")), 0644))
+	timeline, err = config.LoadTimelineFromFile(timelineFile)
+	require.NoError(t, err)
+	assert.Equal(t, 50, timeline.VUs)
+	require.Len(t, timeline.Mix, 2)
+	assert.Equal(t, 40*time.Minute, timeline.Mix[1].GetDuration())
+
+	for _, tc := range []struct{ vus, duration, name, want string }{
+		{"", "40m", "read", `unknown phase "read"`},
+		{`, "vus": 5`, "40m", "reads", "vus is set by the mix"},
+		{"", "soon", "reads", "invalid duration"},
+	} {
+		require.NoError(t, os.WriteFile(timelineFile, []byte(fmt.Sprintf(mixed, tc.vus, tc.duration, tc.name)), 0644))
+		_, err = config.LoadTimelineFromFile(timelineFile)
+		assert.ErrorContains(t, err, tc.want)
+	}
+}
+
+func TestEnvironmentInterpolate(t *testing.T) {
+	t.Setenv("GOTSUNAMI_TEST_DIR", "/reports")
+	t.Setenv("GOTSUNAMI_TEST_EMPTY", "")
+	env := config.NewEnvironment()
+	env.Set("GOTSUNAMI_TEST_HOST", "api.example.com")
+
+	for value, want := range map[string]string{
+		"${GOTSUNAMI_TEST_DIR}/run.json":           "/reports/run.json",
+		"https://${GOTSUNAMI_TEST_HOST}/v1":        "https://api.example.com/v1",
+		"${GOTSUNAMI_TEST_UNSET:-staging}":         "staging",
+		"${GOTSUNAMI_TEST_EMPTY:-fallback}":        "fallback",
+		"[${GOTSUNAMI_TEST_EMPTY}]":                "[]",
+		"$${GOTSUNAMI_TEST_DIR} and $HOME":         "${GOTSUNAMI_TEST_DIR} and $HOME",
+		"{{env.GOTSUNAMI_TEST_DIR}} is left as is": "{{env.GOTSUNAMI_TEST_DIR}} is left as is",
+	} {
+		got, err := env.Interpolate(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+
+	_, err := env.Interpolate("${GOTSUNAMI_TEST_UNSET}/run.json")
+	assert.ErrorContains(t, err, "undefined environment variable GOTSUNAMI_TEST_UNSET")
+	_, err = env.Interpolate("${GOTSUNAMI_TEST_DIR")
+	assert.ErrorContains(t, err, "unterminated")
+
+	// Scenario files are interpolated when loaded, naming the failing field
+	scenarioFile := filepath.Join(t.TempDir(), "scenario.json")
+	require.NoError(t, os.WriteFile(scenarioFile, []byte(`{
+  "name": "interpolated",
+  "method": "GET",
+  "url": "/items",
+  "base_url": "https://${GOTSUNAMI_TEST_HOST:-localhost}",
+  "headers": {"X-Report-Dir": "${GOTSUNAMI_TEST_DIR}"}
+}`), 0644))
+	scenario, err := config.LoadScenarioFromFile(scenarioFile)
+	require.NoError(t, err)
+	assert.Equal(t, "https://localhost", scenario.BaseURL)
+	assert.Equal(t, "/reports", scenario.Headers["X-Report-Dir"])
+
+	require.NoError(t, os.WriteFile(scenarioFile, []byte(`{"name": "x", "method": "GET", "url": "/", "base_url": "${GOTSUNAMI_TEST_UNSET}"}`), 0644))
+	_, err = config.LoadScenarioFromFile(scenarioFile)
+	assert.ErrorContains(t, err, "base_url: undefined environment variable GOTSUNAMI_TEST_UNSET")
+}
@@ -0,0 +1,51 @@
+package unit
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/cpu"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCgroupLimit(t *testing.T) {
+	// cgroup v2, with the host's cgroup path not mounted in the container
+	v2 := fstest.MapFS{
+		"proc/self/cgroup":       {Data: []byte("0::/kubepods/pod42/c1\n")},
+		"sys/fs/cgroup/cpu.max":  {Data: []byte("250000 100000\n")},
+		"sys/fs/cgroup/cpu.stat": {Data: []byte("usage_usec 900\nnr_throttled 3\nthrottled_usec 1500000\n")},
+	}
+	limit, ok := cpu.CgroupLimit(v2)
+	assert.True(t, ok)
+	assert.InDelta(t, 2.5, limit, 0.001)
+	throttled, ok := cpu.CgroupThrottled(v2)
+	assert.True(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, throttled)
+
+	v2["sys/fs/cgroup/cpu.max"] = &fstest.MapFile{Data: []byte("max 100000\n")}
+	_, ok = cpu.CgroupLimit(v2)
+	assert.False(t, ok)
+
+	// cgroup v1, in a hybrid setup whose v2 hierarchy has no CPU controller
+	v1 := fstest.MapFS{
+		"proc/self/cgroup": {Data: []byte("4:cpu,cpuacct:/docker/abc\n0::/\n")},
+		"sys/fs/cgroup/cpu,cpuacct/docker/abc/cpu.cfs_quota_us":  {Data: []byte("50000\n")},
+		"sys/fs/cgroup/cpu,cpuacct/docker/abc/cpu.cfs_period_us": {Data: []byte("100000\n")},
+		"sys/fs/cgroup/cpu,cpuacct/docker/abc/cpu.stat":          {Data: []byte("nr_periods 10\nthrottled_time 2000000\n")},
+		"sys/fs/cgroup/unified/cpu.stat":                         {Data: []byte("usage_usec 900\n")},
+	}
+	limit, ok = cpu.CgroupLimit(v1)
+	assert.True(t, ok)
+	assert.InDelta(t, 0.5, limit, 0.001)
+	throttled, ok = cpu.CgroupThrottled(v1)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Millisecond, throttled)
+
+	v1["sys/fs/cgroup/cpu,cpuacct/docker/abc/cpu.cfs_quota_us"] = &fstest.MapFile{Data: []byte("-1\n")}
+	_, ok = cpu.CgroupLimit(v1)
+	assert.False(t, ok)
+
+	_, ok = cpu.CgroupLimit(fstest.MapFS{})
+	assert.False(t, ok)
+}
@@ -0,0 +1,2667 @@
+package unit
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/engine"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/alexandredias/gotsunami/internal/reporting"
+	"github.com/alexandredias/gotsunami/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineIdentityHeaders(t *testing.T) {
+	var mu sync.Mutex
+	requestIDs := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requestIDs[r.Header.Get("X-Request-Id")] = r.Header.Get("X-Client-Id")
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{Name: "identity", Method: "GET", URL: "/", BaseURL: server.URL}
+	rawOut := filepath.Join(t.TempDir(), "raw.jsonl")
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:        scenario,
+		VirtualUsers:    2,
+		Duration:        500 * time.Millisecond,
+		Timeout:         time.Second,
+		Pattern:         "steady",
+		Connections:     2,
+		IdentityHeaders: true,
+		ClientIDHeader:  "X-Client-Id",
+		RequestIDHeader: "X-Request-Id",
+		RawOut:          rawOut,
+	}, scenario)
+	require.NoError(t, err)
+
+	_, err = e.Run()
+	require.NoError(t, err)
+
+	file, err := os.Open(rawOut)
+	require.NoError(t, err)
+	defer file.Close()
+
+	clients := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var result metrics.RawResult
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &result))
+		// Offsets come from the monotonic clock, within the run and its drain
+		assert.Positive(t, result.OffsetMs)
+		assert.Less(t, result.OffsetMs, float64(2*time.Second/time.Millisecond))
+		if result.Error != "" {
+			continue
+		}
+
+		mu.Lock()
+		assert.Equal(t, result.ClientID, requestIDs[result.RequestID])
+		mu.Unlock()
+		clients[result.ClientID] = true
+	}
+
+	assert.Len(t, clients, 2)
+}
+
+func TestEnginePreflight(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name    string
+		baseURL string
+		message string
+	}{
+		{name: "auth rejected", baseURL: server.URL, message: "authentication rejected"},
+		{name: "connection refused", baseURL: closed.URL, message: "connection refused"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scenario := &config.Scenario{Name: "preflight", Method: "GET", URL: "/", BaseURL: tt.baseURL}
+			e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+				Scenario:     scenario,
+				VirtualUsers: 1,
+				Duration:     time.Minute,
+				Timeout:      time.Second,
+				Connections:  1,
+			}, scenario)
+			require.NoError(t, err)
+
+			start := time.Now()
+			_, err = e.Run()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.message)
+			assert.Less(t, time.Since(start), 10*time.Second)
+		})
+	}
+}
+
+func TestEngineCleanup(t *testing.T) {
+	var mu sync.Mutex
+	created, deleted := 0, map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.Method {
+		case http.MethodPost:
+			created++
+			fmt.Fprintf(w, `{"data":{"id":"item-%d"}}`, created)
+		case http.MethodDelete:
+			deleted[strings.TrimPrefix(r.URL.Path, "/items/")] = true
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{
+		Name:    "cleanup",
+		Method:  "POST",
+		URL:     "/items",
+		BaseURL: server.URL,
+		Cleanup: &config.CleanupConfig{
+			Capture: "data.id",
+			URL:     "/items/{{id}}",
+			Rate:    1000,
+		},
+	}
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:     scenario,
+		VirtualUsers: 2,
+		Duration:     300 * time.Millisecond,
+		Timeout:      time.Second,
+		Connections:  2,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+	require.NotNil(t, summary.Cleanup)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, created, summary.Cleanup.Captured)
+	assert.Equal(t, created, summary.Cleanup.Deleted)
+	assert.Len(t, deleted, created)
+}
+
+func TestEngineStopsWhenWorkersFinish(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	scenario := &config.Scenario{Name: "max-requests", Method: "GET", URL: "/", BaseURL: server.URL}
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  2,
+		Duration:      time.Minute,
+		MaxRequests:   3,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   2,
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	start := time.Now()
+	summary, err := e.Run()
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(6), summary.TotalRequests)
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.Error(t, e.GetContext().Err())
+}
+
+func TestEngineArrivalRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{Name: "arrival-rate", Method: "GET", URL: "/", BaseURL: server.URL}
+	cfg := &config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  2,
+		Duration:      time.Minute,
+		Timeout:       time.Second,
+		Pattern:       "steady",
+		Connections:   2,
+		SkipPreflight: true,
+		Stages: []config.StageConfig{
+			{Duration: "0s", Target: "100rps"},
+			{Duration: "1s", Target: "100rps"},
+		},
+	}
+	e, err := engine.NewLoadEngine(cfg, scenario)
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, cfg.Duration)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+
+	// Two VUs finishing an iteration every 50ms keep up with 40 of the 100
+	// arrivals per second; the rest are dropped, not queued
+	assert.Greater(t, summary.TotalRequests, int64(20))
+	assert.Less(t, summary.TotalRequests, int64(60))
+	assert.InDelta(t, 100, summary.TotalRequests+summary.DroppedIterations, 10)
+
+	_, err = engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario: scenario,
+		Delay:    time.Second,
+		Stages:   []config.StageConfig{{Duration: "1s", Target: "10rps"}},
+	}, scenario)
+	assert.Error(t, err)
+}
+
+func TestEngineRequestBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        interface{}
+		contentType string
+		wantBody    string
+		wantType    string
+		wantErr     bool
+	}{
+		{
+			name:     "object as JSON",
+			body:     map[string]interface{}{"name": "{{name}}", "tags": []interface{}{"a", 1.0}},
+			wantBody: `{"name":"say \"hi\"","tags":["a",1]}`,
+			wantType: "application/json",
+		},
+		{
+			name:     "raw string untouched",
+			body:     "name={{name}}&raw=%20",
+			wantBody: `name=say "hi"&raw=%20`,
+			wantType: "text/plain; charset=utf-8",
+		},
+		{
+			name:        "object as form",
+			body:        map[string]interface{}{"name": "{{name}}", "n": 2.0},
+			contentType: "application/x-www-form-urlencoded",
+			wantBody:    "n=2&name=say+%22hi%22",
+			wantType:    "application/x-www-form-urlencoded",
+		},
+		{
+			name:        "object with unsupported content type",
+			body:        map[string]interface{}{"name": "x"},
+			contentType: "text/xml",
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scenario := &config.Scenario{
+				Name:      "body",
+				Method:    "POST",
+				URL:       "/",
+				BaseURL:   "http://localhost",
+				Body:      tt.body,
+				Variables: map[string]string{"name": `say "hi"`},
+				Headers:   map[string]string{},
+			}
+			if tt.contentType != "" {
+				scenario.Headers["content-type"] = tt.contentType
+			}
+
+			e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+				Scenario:     scenario,
+				VirtualUsers: 1,
+				Duration:     time.Second,
+				Pattern:      "steady",
+			}, scenario)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			req, err := e.CreateRequest(e.VURand(1))
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBody, string(req.Body))
+
+			contentType := req.Headers["Content-Type"]
+			if tt.contentType != "" {
+				contentType = req.Headers["content-type"]
+			}
+			assert.Equal(t, tt.wantType, contentType)
+		})
+	}
+}
+
+func TestEngineExpandsTemplatesPerRequest(t *testing.T) {
+	scenario := &config.Scenario{
+		Name:        "templates",
+		Method:      "GET",
+		URL:         "/users/{{user}}",
+		BaseURL:     "http://{{env.HOST}}",
+		Headers:     map[string]string{"X-User": "{{user}}"},
+		QueryParams: map[string]interface{}{"id": "{{user}}", "limit": 10.0},
+		Variables:   map[string]string{"user": "{{random.int 1 1000000}}"},
+		Environment: map[string]string{"HOST": "api.local"},
+	}
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:     scenario,
+		VirtualUsers: 1,
+		Duration:     time.Second,
+		Pattern:      "steady",
+		Seed:         42,
+	}, scenario)
+	require.NoError(t, err)
+
+	rng := e.VURand(1)
+	first, err := e.CreateRequest(rng)
+	require.NoError(t, err)
+	second, err := e.CreateRequest(rng)
+	require.NoError(t, err)
+
+	user := first.Headers["X-User"]
+	assert.Equal(t, "http://api.local/users/"+user, first.URL)
+	assert.Equal(t, user, first.QueryParams["id"])
+	assert.Equal(t, 10.0, first.QueryParams["limit"])
+	assert.NotEqual(t, first.URL, second.URL)
+
+	replay, err := e.CreateRequest(e.VURand(1))
+	require.NoError(t, err)
+	assert.Equal(t, first.URL, replay.URL)
+
+	scenario.URL = "/{{unknown.func 1}}"
+	_, err = engine.NewLoadEngine(&config.LoadTestConfig{Scenario: scenario, Duration: time.Second, Pattern: "steady"}, scenario)
+	assert.Error(t, err)
+}
+
+func TestEngineValidationOverrides(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{Name: "overrides", Method: "POST", URL: "/", BaseURL: server.URL}
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  1,
+		Duration:      300 * time.Millisecond,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   1,
+		SkipPreflight: true,
+		ExpectStatus:  []int{201},
+		ExpectBodyNot: "created",
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+	require.Positive(t, summary.TotalRequests)
+
+	// The status override replaces the scenario default of 200, and the body
+	// override rejects every response
+	assert.Equal(t, summary.TotalRequests, summary.ValidationResults.FailedValidations)
+	assert.Equal(t, summary.TotalRequests, summary.ValidationResults.ValidationErrors["body_content"])
+}
+
+func TestEngineClientPerVU(t *testing.T) {
+	var mu sync.Mutex
+	conns := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		conns[r.RemoteAddr] = true
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{Name: "per-vu", Method: "GET", URL: "/", BaseURL: server.URL}
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  3,
+		Duration:      time.Minute,
+		MaxRequests:   5,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   30,
+		KeepAlive:     true,
+		ClientPerVU:   true,
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	assert.NotSame(t, e.ProtocolFor(0), e.ProtocolFor(1))
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), summary.TotalRequests)
+
+	// Requests from one VU are sequential and reuse its client's connection
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, conns, 3)
+}
+
+func TestEngineClientCertificates(t *testing.T) {
+	// Three identities: two .crt certificates and one .pem
+	dir := t.TempDir()
+	for i, name := range []string{"alpha.crt", "bravo.pem", "charlie.crt"} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		base := strings.TrimSuffix(name, filepath.Ext(name))
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 1)),
+			Subject:      pkix.Name{CommonName: base},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		require.NoError(t, err)
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, base+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	}
+
+	var mu sync.Mutex
+	identities := map[string]int{}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		identities[r.TLS.PeerCertificates[0].Subject.CommonName]++
+		mu.Unlock()
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	scenario := &config.Scenario{Name: "mtls", Method: "GET", URL: "/", BaseURL: server.URL}
+	newEngine := func(vus int, certs string) (*engine.LoadEngine, error) {
+		return engine.NewLoadEngine(&config.LoadTestConfig{
+			Scenario:      scenario,
+			VirtualUsers:  vus,
+			Duration:      time.Minute,
+			MaxRequests:   2,
+			Timeout:       5 * time.Second,
+			Pattern:       "stress",
+			Connections:   30,
+			KeepAlive:     true,
+			TLSSkipVerify: true,
+			ClientCerts:   certs,
+			SkipPreflight: true,
+		}, scenario)
+	}
+
+	// Four VUs share three certificates in turn
+	e, err := newEngine(4, dir)
+	require.NoError(t, err)
+	summary, err := e.Run()
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), summary.TotalRequests)
+	assert.Equal(t, int64(8), summary.SuccessfulRequests)
+
+	mu.Lock()
+	assert.Equal(t, map[string]int{"alpha": 4, "bravo": 2, "charlie": 2}, identities)
+	identities = map[string]int{}
+	mu.Unlock()
+
+	// VUs added while running take the next certificates in turn
+	e, err = engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  1,
+		Duration:      time.Minute,
+		Delay:         10 * time.Millisecond,
+		Timeout:       5 * time.Second,
+		Pattern:       "steady",
+		KeepAlive:     true,
+		TLSSkipVerify: true,
+		ClientCerts:   dir,
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run()
+	}()
+	seen := func(name string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return identities[name] > 0
+	}
+	require.Eventually(t, func() bool { return seen("alpha") }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, e.SetVUs(3))
+	require.Eventually(t, func() bool { return seen("bravo") && seen("charlie") }, 5*time.Second, 10*time.Millisecond)
+	e.Stop()
+	<-done
+
+	// A key without its certificate is an error, as is an empty directory
+	require.NoError(t, os.Remove(filepath.Join(dir, "bravo.pem")))
+	_, err = newEngine(1, dir)
+	assert.ErrorContains(t, err, "bravo.key has no certificate")
+	_, err = newEngine(1, t.TempDir())
+	assert.ErrorContains(t, err, "no client certificates")
+}
+
+func TestEngineDrainsInFlightRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(400 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name  string
+		drain time.Duration
+	}{
+		{name: "in-flight requests finish", drain: 2 * time.Second},
+		{name: "in-flight requests aborted", drain: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scenario := &config.Scenario{Name: "drain", Method: "GET", URL: "/", BaseURL: server.URL}
+			e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+				Scenario:      scenario,
+				VirtualUsers:  2,
+				Duration:      300 * time.Millisecond,
+				Drain:         tt.drain,
+				Timeout:       5 * time.Second,
+				Pattern:       "stress",
+				Connections:   2,
+				SkipPreflight: true,
+			}, scenario)
+			require.NoError(t, err)
+
+			summary, err := e.Run()
+			require.NoError(t, err)
+
+			// Requests still running at the deadline are either recorded in
+			// full or dropped, never counted as failures
+			assert.Zero(t, summary.FailedRequests)
+			if tt.drain > 0 {
+				assert.Equal(t, int64(2), summary.TotalRequests)
+			} else {
+				assert.Zero(t, summary.TotalRequests)
+			}
+
+			// Either way, the report says what happened to them
+			require.NotNil(t, summary.Drain)
+			assert.Equal(t, int64(2), summary.Drain.InFlight)
+			assert.Equal(t, summary.TotalRequests, summary.Drain.Completed)
+			assert.Equal(t, 2-summary.TotalRequests, summary.Drain.Abandoned)
+		})
+	}
+}
+
+func TestEngineSuccessFollowsValidation(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	scenario := &config.Scenario{
+		Name:       "expected-404",
+		Method:     "GET",
+		URL:        "/missing",
+		BaseURL:    server.URL,
+		Validation: &config.ValidationConfig{StatusCodes: []int{404}},
+	}
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:     scenario,
+		VirtualUsers: 1,
+		Duration:     time.Minute,
+		MaxRequests:  5,
+		Timeout:      time.Second,
+		Pattern:      "stress",
+		Connections:  1,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(5), summary.SuccessfulRequests)
+	assert.InDelta(t, 100.0, summary.SuccessRate, 0.001)
+	assert.Equal(t, int64(5), summary.HTTPErrors)
+	assert.Equal(t, int64(5), summary.StatusCodes[404])
+}
+
+func TestEngineValidationSampling(t *testing.T) {
+	// Every fourth response is an error; none has the expected body
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&requests, 1)%4 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte("unexpected"))
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{
+		Name:       "sampled",
+		Method:     "GET",
+		URL:        "/",
+		BaseURL:    server.URL,
+		Validation: &config.ValidationConfig{BodyContains: []string{"ok"}, SampleRate: 0.25},
+	}
+	require.NoError(t, scenario.Validate())
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  4,
+		Duration:      time.Minute,
+		MaxRequests:   10,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Seed:          42,
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+
+	// Errors fail whether sampled or not; a bad body only when sampled
+	results := summary.ValidationResults
+	assert.Equal(t, int64(40), results.TotalValidations)
+	assert.Equal(t, int64(10), results.ValidationErrors["status_code"])
+	bodyFailures := results.ValidationErrors["body_content"]
+	assert.Greater(t, bodyFailures, int64(0))
+	assert.Greater(t, results.PassedValidations, int64(0))
+	assert.Equal(t, int64(30), bodyFailures+results.PassedValidations)
+	assert.GreaterOrEqual(t, results.Unsampled, results.PassedValidations)
+	assert.Equal(t, results.PassedValidations, summary.SuccessfulRequests)
+
+	scenario.Validation.SampleRate = 1.5
+	assert.Error(t, scenario.Validate())
+}
+
+func TestEngineConditionalRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("fresh"))
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{
+		Name:       "cache",
+		Method:     "GET",
+		URL:        "/",
+		BaseURL:    server.URL,
+		Cache:      &config.CacheConfig{ETag: true},
+		Validation: &config.ValidationConfig{StatusCodes: []int{200}, BodyContains: []string{"fresh"}},
+	}
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  2,
+		Duration:      time.Minute,
+		MaxRequests:   5,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   2,
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+
+	// Each VU fetches once, then revalidates
+	assert.Equal(t, int64(10), summary.SuccessfulRequests)
+	assert.Equal(t, int64(2), summary.StatusCodes[200])
+	assert.Equal(t, int64(8), summary.NotModified)
+}
+
+func TestEngineGlobalLimit(t *testing.T) {
+	var inFlight, peak int64
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt64(&peak)
+			if current <= seen || atomic.CompareAndSwapInt64(&peak, seen, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer target.Close()
+
+	api := server.NewServer("")
+	require.NoError(t, api.SetLimit("target", 3))
+	limits := httptest.NewServer(api.Handler())
+	defer limits.Close()
+
+	// Two agents with 5 VUs each share a limit of 3 requests in flight
+	summaries := make([]*metrics.Summary, 2)
+	var wg sync.WaitGroup
+	for i := range summaries {
+		scenario := &config.Scenario{Name: "limited", Method: "GET", URL: "/", BaseURL: target.URL}
+		e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+			Scenario:      scenario,
+			VirtualUsers:  5,
+			Duration:      time.Minute,
+			MaxRequests:   10,
+			Timeout:       time.Second,
+			Pattern:       "stress",
+			Connections:   10,
+			KeepAlive:     true,
+			SkipPreflight: true,
+			GlobalLimit:   limits.URL + "/api/v1/limits/target",
+		}, scenario)
+		require.NoError(t, err)
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			summaries[i], _ = e.Run()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, summary := range summaries {
+		require.NotNil(t, summary)
+		assert.Equal(t, int64(50), summary.TotalRequests)
+	}
+	assert.LessOrEqual(t, atomic.LoadInt64(&peak), int64(3))
+
+	// Every slot is handed back when the agents finish
+	resp, err := http.Get(limits.URL + "/api/v1/limits/target")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var info server.LimitInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	assert.Equal(t, 0, info.InUse)
+
+	// An unknown limit fails before the test starts
+	scenario := &config.Scenario{Name: "limited", Method: "GET", URL: "/", BaseURL: target.URL}
+	_, err = engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:     scenario,
+		VirtualUsers: 1,
+		GlobalLimit:  limits.URL + "/api/v1/limits/missing",
+	}, scenario)
+	assert.Error(t, err)
+}
+
+func TestGlobalLimitLeaseExpires(t *testing.T) {
+	api := server.NewServer("")
+	api.SetLeaseTTL(50 * time.Millisecond)
+	require.NoError(t, api.SetLimit("target", 2))
+	limits := httptest.NewServer(api.Handler())
+	defer limits.Close()
+
+	acquire := func(agent string, count int) server.LimitResponse {
+		body := strings.NewReader(fmt.Sprintf(`{"agent": %q, "count": %d}`, agent, count))
+		resp, err := http.Post(limits.URL+"/api/v1/limits/target/acquire", "application/json", body)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var result server.LimitResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result
+	}
+
+	assert.Equal(t, 2, acquire("a", 5).Granted)
+	assert.Equal(t, 0, acquire("b", 1).Granted)
+
+	// Slots of an agent that stopped renewing go back to the pool
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, acquire("b", 1).Granted)
+
+	// Requests are capped like every other body of the API
+	body := strings.NewReader(`{"agent": "` + strings.Repeat("x", 11<<20) + `", "count": 1}`)
+	resp, err := http.Post(limits.URL+"/api/v1/limits/target/acquire", "application/json", body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestEngineBacksOffWhenRateLimited(t *testing.T) {
+	var mu sync.Mutex
+	var sent []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sent = append(sent, time.Now())
+		first := len(sent) == 1
+		mu.Unlock()
+
+		if first {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{
+		Name:      "rate-limited",
+		Method:    "GET",
+		URL:       "/",
+		BaseURL:   server.URL,
+		RateLimit: &config.RateLimitConfig{Backoff: "10ms"},
+	}
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  1,
+		Duration:      time.Minute,
+		MaxRequests:   3,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   1,
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+
+	// Retry-After takes precedence over the configured backoff
+	require.Len(t, sent, 3)
+	assert.GreaterOrEqual(t, sent[1].Sub(sent[0]), 900*time.Millisecond)
+	assert.Less(t, sent[2].Sub(sent[1]), 500*time.Millisecond)
+
+	require.NotNil(t, summary.Throttle)
+	assert.Equal(t, int64(1), summary.Throttle.Responses)
+	throttled, err := time.ParseDuration(summary.Throttle.Duration)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Second.Seconds(), throttled.Seconds(), 0.1)
+	assert.Greater(t, summary.Throttle.Percentage, 50.0)
+}
+
+func TestEngineConsistency(t *testing.T) {
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&requests, 1)
+		// Every third response comes from a stale replica; the timestamp
+		// differs every time and is left out of the comparison
+		value := "fresh"
+		if n%3 == 0 {
+			value = "stale"
+		}
+		fmt.Fprintf(w, `{"items":[{"value":%q,"updated_at":%d}],"generated_at":%d}`, value, n, n)
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{
+		Name:        "consistency",
+		Method:      "GET",
+		URL:         "/page",
+		BaseURL:     server.URL,
+		Consistency: &config.ConsistencyConfig{Ignore: []string{"generated_at", "items.updated_at"}},
+	}
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  2,
+		Duration:      time.Minute,
+		MaxRequests:   6,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   2,
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+
+	require.NotNil(t, summary.Consistency)
+	assert.Equal(t, int64(1), summary.Consistency.Checked)
+	assert.Equal(t, int64(12), summary.Consistency.Responses)
+	assert.Equal(t, int64(1), summary.Consistency.Inconsistent)
+	require.Len(t, summary.Consistency.URLs, 1)
+	assert.Equal(t, server.URL+"/page", summary.Consistency.URLs[0].URL)
+
+	counts := make([]int64, 0, 2)
+	for _, count := range summary.Consistency.URLs[0].Variants {
+		counts = append(counts, count)
+	}
+	assert.ElementsMatch(t, []int64{8, 4}, counts)
+}
+
+func TestTimelinePhases(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	phase := func(name string, start time.Duration) engine.TimelinePhase {
+		scenario := &config.Scenario{Name: name, Method: "GET", URL: "/" + name, BaseURL: server.URL}
+		return engine.TimelinePhase{
+			Name:     name,
+			Start:    start,
+			Scenario: scenario,
+			Config: &config.LoadTestConfig{
+				Scenario:      scenario,
+				VirtualUsers:  1,
+				Duration:      time.Minute,
+				MaxRequests:   2,
+				Timeout:       time.Second,
+				Pattern:       "stress",
+				Connections:   1,
+				SkipPreflight: true,
+			},
+		}
+	}
+
+	timeline := engine.NewTimeline([]engine.TimelinePhase{
+		phase("background", 0),
+		phase("burst", 200*time.Millisecond),
+		phase("late", time.Hour),
+	})
+	go func() {
+		time.Sleep(time.Second)
+		timeline.Stop()
+	}()
+
+	results, elapsed := timeline.Run()
+	require.Len(t, results, 3)
+	assert.Less(t, elapsed, time.Minute)
+
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, int64(2), results[0].Summary.TotalRequests)
+
+	require.NoError(t, results[1].Err)
+	assert.GreaterOrEqual(t, results[1].Started, 200*time.Millisecond)
+	assert.Equal(t, int64(2), results[1].Summary.TotalRequests)
+
+	// The timeline stopped before the last phase was due
+	assert.ErrorIs(t, results[2].Err, engine.ErrPhaseSkipped)
+	assert.Nil(t, results[2].Summary)
+}
+
+func TestTimelineMix(t *testing.T) {
+	stages := []engine.MixStage{
+		{Duration: 0, Weights: map[string]float64{"reads": 9, "writes": 1}},
+		{Duration: 10 * time.Minute, Weights: map[string]float64{"reads": 3, "writes": 7}},
+	}
+
+	// Weights ramp linearly and hold after the last stage
+	assert.Equal(t, map[string]float64{"reads": 9, "writes": 1}, engine.MixWeights(stages, 0))
+	assert.InDeltaMapValues(t, map[string]float64{"reads": 6, "writes": 4}, engine.MixWeights(stages, 5*time.Minute), 1e-9)
+	assert.Equal(t, map[string]float64{"reads": 3, "writes": 7}, engine.MixWeights(stages, time.Hour))
+
+	assert.Equal(t, map[string]int{"reads": 60, "writes": 40}, engine.SplitByWeight(100, map[string]float64{"reads": 6, "writes": 4}))
+	assert.Equal(t, map[string]int{"a": 2, "b": 1, "c": 1}, engine.SplitByWeight(4, map[string]float64{"a": 1, "b": 1, "c": 1}))
+	// Phases weighing nothing keep one VU so they don't stop
+	assert.Equal(t, map[string]int{"reads": 10, "writes": 1}, engine.SplitByWeight(10, map[string]float64{"reads": 1, "writes": 0}))
+	assert.Nil(t, engine.SplitByWeight(10, nil))
+}
+
+func TestEngineIdempotencyKeys(t *testing.T) {
+	for _, honoured := range []bool{true, false} {
+		t.Run(fmt.Sprintf("honoured=%v", honoured), func(t *testing.T) {
+			var mu sync.Mutex
+			attempts := make(map[string]int)
+			created := make(map[string]string)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				key := r.Header.Get("Idempotency-Key")
+				mu.Lock()
+				defer mu.Unlock()
+				attempts[key]++
+
+				// Every first attempt fails, so each operation is retried
+				if attempts[key] == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				id, exists := created[key]
+				if !exists || !honoured {
+					id = fmt.Sprintf("res-%d", len(created)+attempts[key])
+					created[key] = id
+				}
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprintf(w, `{"id":%q}`, id)
+			}))
+			defer server.Close()
+
+			scenario := &config.Scenario{
+				Name:        "idempotent",
+				Method:      "POST",
+				URL:         "/orders",
+				BaseURL:     server.URL,
+				Retry:       &config.RetryConfig{Attempts: 2, Backoff: "fixed", MaxDelay: "1ms"},
+				Idempotency: &config.IdempotencyConfig{Capture: "id", Replay: 1},
+				Validation:  &config.ValidationConfig{StatusCodes: []int{201}},
+			}
+			e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+				Scenario:      scenario,
+				VirtualUsers:  2,
+				Duration:      time.Minute,
+				MaxRequests:   3,
+				Timeout:       time.Second,
+				Pattern:       "stress",
+				Connections:   2,
+				SkipPreflight: true,
+			}, scenario)
+			require.NoError(t, err)
+
+			summary, err := e.Run()
+			require.NoError(t, err)
+
+			// Each operation: a failed attempt, a retry and a replay, all
+			// with the same key
+			assert.Len(t, attempts, 6)
+			for key, count := range attempts {
+				assert.Equal(t, 3, count, key)
+			}
+			assert.Equal(t, int64(18), summary.TotalRequests)
+
+			require.NotNil(t, summary.Idempotency)
+			assert.Equal(t, int64(6), summary.Idempotency.Operations)
+			assert.Equal(t, int64(6), summary.Idempotency.Retries)
+			assert.Equal(t, int64(6), summary.Idempotency.Replays)
+			assert.Equal(t, int64(6), summary.Idempotency.Checked)
+			if honoured {
+				assert.Zero(t, summary.Idempotency.Duplicates)
+			} else {
+				assert.Equal(t, int64(6), summary.Idempotency.Duplicates)
+			}
+		})
+	}
+}
+
+func TestEngineBodylessMethods(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("Content-Length", "500")
+		case http.MethodOptions:
+			w.Header().Set("Allow", "GET,HEAD, OPTIONS")
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodConnect:
+			// Establish the tunnel and keep it open, like a proxy would
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				return
+			}
+			buf.WriteString("HTTP/1.1 200 Connection established\r\n\r\n")
+			buf.Flush()
+			time.Sleep(2 * time.Second)
+			conn.Close()
+		}
+	}))
+	defer server.Close()
+
+	run := func(method string, validation *config.ValidationConfig) *metrics.Summary {
+		scenario := &config.Scenario{
+			Name:       method,
+			Method:     method,
+			URL:        "/",
+			BaseURL:    server.URL,
+			Validation: validation,
+		}
+		e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+			Scenario:      scenario,
+			VirtualUsers:  1,
+			Duration:      time.Minute,
+			MaxRequests:   3,
+			Timeout:       5 * time.Second,
+			Pattern:       "stress",
+			Connections:   1,
+			SkipPreflight: true,
+		}, scenario)
+		require.NoError(t, err)
+
+		summary, err := e.Run()
+		require.NoError(t, err)
+		return summary
+	}
+
+	// HEAD responses are checked against the size they declare, and body
+	// rules do not apply
+	summary := run(http.MethodHead, &config.ValidationConfig{MinResponseSize: 100, BodyContains: []string{"ok"}})
+	assert.Equal(t, int64(3), summary.SuccessfulRequests)
+	require.NotNil(t, summary.MethodMetrics)
+	assert.Equal(t, int64(1500), summary.MethodMetrics.DeclaredBytes)
+
+	summary = run(http.MethodHead, &config.ValidationConfig{MaxResponseSize: 100})
+	assert.Equal(t, int64(3), summary.FailedRequests)
+
+	summary = run(http.MethodOptions, &config.ValidationConfig{StatusCodes: []int{204}})
+	assert.Equal(t, int64(3), summary.SuccessfulRequests)
+	require.NotNil(t, summary.MethodMetrics)
+	assert.Equal(t, map[string]int64{"GET, HEAD, OPTIONS": 3}, summary.MethodMetrics.Allow)
+
+	// A CONNECT completes once the tunnel is up instead of reading it to the end
+	start := time.Now()
+	summary = run(http.MethodConnect, nil)
+	assert.Equal(t, int64(3), summary.SuccessfulRequests)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Nil(t, summary.MethodMetrics)
+}
+
+func TestEngineVariableScopes(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string]map[string]int{"X-Run": {}, "X-Session": {}, "X-Nonce": {}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		for header := range seen {
+			seen[header][r.Header.Get(header)]++
+		}
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{
+		Name:    "scopes",
+		Method:  "GET",
+		URL:     "/",
+		BaseURL: server.URL,
+		Headers: map[string]string{"X-Run": "{{run}}", "X-Session": "{{session}}", "X-Nonce": "{{nonce}}"},
+		Variables: map[string]string{
+			"run":     "{{random.uuid}}",
+			"session": "{{random.uuid}}",
+			"nonce":   "{{random.uuid}}",
+		},
+		VariableScopes: map[string]string{"run": config.ScopeGlobal, "session": config.ScopeVU},
+	}
+	require.NoError(t, scenario.Validate())
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  3,
+		Duration:      time.Minute,
+		MaxRequests:   4,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   3,
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	_, err = e.Run()
+	require.NoError(t, err)
+
+	assert.Len(t, seen["X-Run"], 1)
+	assert.Len(t, seen["X-Session"], 3)
+	for session, count := range seen["X-Session"] {
+		assert.Equal(t, 4, count, session)
+	}
+	assert.Len(t, seen["X-Nonce"], 12)
+}
+
+func TestEngineTenantBreakdown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// acme is the noisy neighbor: slow and failing
+		if r.Header.Get("X-Tenant") == "acme" {
+			time.Sleep(20 * time.Millisecond)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Query().Get("tenant") != r.Header.Get("X-Tenant") {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	tenantsFile := filepath.Join(t.TempDir(), "tenants.csv")
+	require.NoError(t, os.WriteFile(tenantsFile, []byte("id,name\nacme,Acme\nglobex,Globex\ninitech,Initech\n"), 0644))
+
+	scenario := &config.Scenario{
+		Name:        "tenants",
+		Method:      "GET",
+		URL:         "/",
+		BaseURL:     server.URL,
+		QueryParams: map[string]interface{}{"tenant": "{{tenant}}"},
+		Tenants:     &config.TenantConfig{File: tenantsFile, Column: "id", Header: "X-Tenant"},
+	}
+	require.NoError(t, scenario.Validate())
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  3,
+		Duration:      time.Minute,
+		MaxRequests:   4,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   3,
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+
+	require.Len(t, summary.Tenants, 3)
+	acme := summary.Tenants["acme"]
+	assert.Equal(t, int64(4), acme.Requests)
+	assert.Equal(t, int64(4), acme.HTTPErrors)
+	assert.Zero(t, acme.SuccessRate)
+	assert.GreaterOrEqual(t, acme.Latency.Median, 20*time.Millisecond)
+	for _, tenant := range []string{"globex", "initech"} {
+		assert.Equal(t, int64(4), summary.Tenants[tenant].Requests, tenant)
+		assert.Equal(t, 100.0, summary.Tenants[tenant].SuccessRate, tenant)
+	}
+}
+
+func TestEngineTraceVUs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{
+		Name:           "trace",
+		Method:         "GET",
+		URL:            "/items/{{item}}",
+		BaseURL:        server.URL,
+		Variables:      map[string]string{"item": "{{random.int 1 9}}"},
+		VariableScopes: map[string]string{"item": config.ScopeIteration},
+	}
+	require.NoError(t, scenario.Validate())
+
+	traceFile := filepath.Join(t.TempDir(), "trace.jsonl")
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  2,
+		Duration:      time.Minute,
+		MaxRequests:   2,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   2,
+		SkipPreflight: true,
+		TraceVUs:      1,
+		TraceOut:      traceFile,
+	}, scenario)
+	require.NoError(t, err)
+
+	_, err = e.Run()
+	require.NoError(t, err)
+
+	file, err := os.Open(traceFile)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var events []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event struct {
+			VU        int               `json:"vu"`
+			Event     string            `json:"event"`
+			Variables map[string]string `json:"variables"`
+			URL       string            `json:"url"`
+			Passed    *bool             `json:"passed"`
+		}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		assert.Equal(t, 1, event.VU)
+		switch event.Event {
+		case "iteration":
+			assert.NotEmpty(t, event.Variables["item"])
+		case "request":
+			assert.Contains(t, event.URL, server.URL+"/items/")
+		case "response":
+			require.NotNil(t, event.Passed)
+			assert.True(t, *event.Passed)
+		}
+		events = append(events, event.Event)
+	}
+
+	assert.Equal(t, []string{"start", "iteration", "request", "response", "iteration", "request", "response", "stop"}, events)
+}
+
+func TestEngineOTLPExport(t *testing.T) {
+	var parentsMu sync.Mutex
+	var parents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parentsMu.Lock()
+		parents = append(parents, r.Header.Get("traceparent"))
+		parentsMu.Unlock()
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	type span struct {
+		TraceID      string `json:"traceId"`
+		SpanID       string `json:"spanId"`
+		ParentSpanID string `json:"parentSpanId"`
+		Name         string `json:"name"`
+		Kind         int    `json:"kind"`
+		Status       struct {
+			Code int `json:"code"`
+		} `json:"status"`
+	}
+	var spansMu sync.Mutex
+	var spans []span
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		var payload struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []span `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		spansMu.Lock()
+		defer spansMu.Unlock()
+		for _, resource := range payload.ResourceSpans {
+			for _, scope := range resource.ScopeSpans {
+				spans = append(spans, scope.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	scenario := &config.Scenario{
+		Name:    "otlp",
+		Method:  "GET",
+		URL:     "/items",
+		BaseURL: server.URL,
+	}
+	require.NoError(t, scenario.Validate())
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  1,
+		Duration:      time.Minute,
+		MaxRequests:   2,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   1,
+		SkipPreflight: true,
+		OTLPEndpoint:  collector.URL,
+	}, scenario)
+	require.NoError(t, err)
+
+	_, err = e.Run()
+	require.NoError(t, err)
+
+	// Two iterations, each a root span and a request span with its phases
+	roots := map[string]span{}
+	requests := map[string]span{}
+	phases := map[string][]string{}
+	for _, s := range spans {
+		switch {
+		case s.ParentSpanID == "":
+			roots[s.TraceID] = s
+		case s.Kind == 3:
+			requests[s.SpanID] = s
+		default:
+			phases[s.ParentSpanID] = append(phases[s.ParentSpanID], s.Name)
+		}
+	}
+	require.Len(t, roots, 2)
+	require.Len(t, requests, 2)
+	for _, request := range requests {
+		root := roots[request.TraceID]
+		assert.Equal(t, "otlp", root.Name)
+		assert.Equal(t, root.SpanID, request.ParentSpanID)
+		assert.Equal(t, "GET /items", request.Name)
+		assert.Equal(t, 1, request.Status.Code)
+		assert.Contains(t, phases[request.SpanID], "wait")
+		assert.Contains(t, parents, "00-"+request.TraceID+"-"+request.SpanID+"-01")
+	}
+}
+
+func TestEngineOTLPRequestAttributes(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt fails, so the operation is retried
+		if atomic.AddInt64(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	type span struct {
+		Kind       int `json:"kind"`
+		Attributes []struct {
+			Key   string                 `json:"key"`
+			Value map[string]interface{} `json:"value"`
+		} `json:"attributes"`
+	}
+	var spansMu sync.Mutex
+	var requests []map[string]interface{}
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []span `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		spansMu.Lock()
+		defer spansMu.Unlock()
+		for _, resource := range payload.ResourceSpans {
+			for _, scope := range resource.ScopeSpans {
+				for _, s := range scope.Spans {
+					if s.Kind != 3 {
+						continue
+					}
+					attributes := map[string]interface{}{}
+					for _, attribute := range s.Attributes {
+						for _, value := range attribute.Value {
+							attributes[attribute.Key] = value
+						}
+					}
+					requests = append(requests, attributes)
+				}
+			}
+		}
+	}))
+	defer collector.Close()
+
+	scenario := &config.Scenario{
+		Name:        "otlp",
+		Method:      "POST",
+		URL:         "/orders",
+		BaseURL:     server.URL,
+		Retry:       &config.RetryConfig{Attempts: 2, Backoff: "fixed", MaxDelay: "1ms"},
+		Idempotency: &config.IdempotencyConfig{},
+	}
+	require.NoError(t, scenario.Validate())
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  1,
+		Duration:      time.Minute,
+		MaxRequests:   1,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   1,
+		SkipPreflight: true,
+		OTLPEndpoint:  collector.URL,
+	}, scenario)
+	require.NoError(t, err)
+
+	_, err = e.Run()
+	require.NoError(t, err)
+
+	// Both attempts of the operation are spans of the iteration
+	require.Len(t, requests, 2)
+	for i, attributes := range requests {
+		assert.Equal(t, fmt.Sprint(i+1), attributes["gotsunami.attempt"])
+		assert.Equal(t, "/orders", attributes["http.route"])
+		assert.Greater(t, attributes["gotsunami.latency_ms"], 0.0)
+	}
+	assert.Equal(t, "503", requests[0]["http.response.status_code"])
+	assert.Nil(t, requests[0]["http.request.resend_count"])
+	assert.Equal(t, "200", requests[1]["http.response.status_code"])
+	assert.Equal(t, "1", requests[1]["http.request.resend_count"])
+}
+
+func TestEngineSetVUs(t *testing.T) {
+	var mu sync.Mutex
+	clients := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		clients[r.Header.Get("X-Client-Id")] = true
+		mu.Unlock()
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{Name: "scale", Method: "GET", URL: "/", BaseURL: server.URL}
+	require.NoError(t, scenario.Validate())
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:        scenario,
+		VirtualUsers:    1,
+		Duration:        time.Minute,
+		Timeout:         time.Second,
+		Pattern:         "stress",
+		Connections:     4,
+		SkipPreflight:   true,
+		IdentityHeaders: true,
+		ClientIDHeader:  "X-Client-Id",
+		RequestIDHeader: "X-Request-Id",
+	}, scenario)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, e.SetVUs(2), engine.ErrNotRunning)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run()
+	}()
+
+	seen := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(clients)
+	}
+	require.Eventually(t, func() bool { return seen() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	assert.Error(t, e.SetVUs(0))
+	require.NoError(t, e.SetVUs(3))
+	assert.Equal(t, 3, e.ActiveVUs())
+	require.Eventually(t, func() bool { return seen() == 3 }, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, e.SetVUs(1))
+	assert.Equal(t, 1, e.ActiveVUs())
+
+	e.Stop()
+	<-done
+	assert.ErrorIs(t, e.SetVUs(2), engine.ErrNotRunning)
+}
+
+func TestEngineAnnotate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{Name: "annotate", Method: "GET", URL: "/", BaseURL: server.URL}
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  1,
+		Duration:      time.Minute,
+		Delay:         10 * time.Millisecond,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   1,
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	_, err = e.Annotate("too early")
+	assert.ErrorIs(t, err, engine.ErrNotRunning)
+
+	summaries := make(chan *metrics.Summary, 1)
+	go func() {
+		summary, _ := e.Run()
+		summaries <- summary
+	}()
+	require.Eventually(t, func() bool { return e.GetCollector().GetSummary().TotalRequests > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	_, err = e.Annotate("  ")
+	assert.Error(t, err)
+	annotation, err := e.Annotate("deploy happened here")
+	require.NoError(t, err)
+	assert.NotEmpty(t, annotation.Offset)
+
+	e.Stop()
+	summary := <-summaries
+	require.NotNil(t, summary)
+	require.Len(t, summary.Annotations, 1)
+	assert.Equal(t, "deploy happened here", summary.Annotations[0].Text)
+}
+
+func TestEngineRedaction(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=s3cr3t-session")
+		w.Write([]byte(`{"token":"s3cr3t-token","users":[{"name":"Ana","email":"ana@example.com"}]}`))
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{
+		Name:    "redaction",
+		Method:  "GET",
+		URL:     "/users?api_key=s3cr3t-key",
+		BaseURL: server.URL,
+		Headers: map[string]string{"Authorization": "Bearer s3cr3t-bearer"},
+		Redaction: &config.RedactionConfig{
+			Headers:  []string{"authorization", "set-cookie"},
+			Fields:   []string{"token", "users.email"},
+			Patterns: []string{`api_key=[^&"]+`},
+		},
+	}
+	require.NoError(t, scenario.Validate())
+
+	dir := t.TempDir()
+	rawFile := filepath.Join(dir, "raw.jsonl")
+	traceFile := filepath.Join(dir, "trace.jsonl")
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  1,
+		Duration:      time.Minute,
+		MaxRequests:   2,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   1,
+		SkipPreflight: true,
+		RawOut:        rawFile,
+		TraceVUs:      1,
+		TraceOut:      traceFile,
+	}, scenario)
+	require.NoError(t, err)
+
+	_, err = e.Run()
+	require.NoError(t, err)
+
+	for _, file := range []string{rawFile, traceFile} {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "s3cr3t", file)
+		assert.Contains(t, string(data), "[REDACTED]", file)
+	}
+
+	// Fields other than the redacted ones are kept
+	trace, err := os.ReadFile(traceFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(trace), `\"name\":\"Ana\"`)
+	assert.NotContains(t, string(trace), "ana@example.com")
+}
+
+func TestEngineWarmup(t *testing.T) {
+	var hits int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		time.Sleep(2 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{Name: "warmup", Method: "GET", URL: "/", BaseURL: server.URL}
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:        scenario,
+		VirtualUsers:    1,
+		Duration:        time.Minute,
+		MaxRequests:     5,
+		Timeout:         time.Second,
+		Pattern:         "stress",
+		Connections:     1,
+		SkipPreflight:   true,
+		Warmup:          10 * time.Second,
+		WarmupWindow:    100 * time.Millisecond,
+		WarmupTolerance: 0.5,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+
+	// A steady target is stable after three windows, long before the limit
+	require.NotNil(t, summary.Warmup)
+	assert.True(t, summary.Warmup.Stable)
+	assert.NotEmpty(t, summary.Warmup.P95)
+	warmup, err := time.ParseDuration(summary.Warmup.Duration)
+	require.NoError(t, err)
+	assert.Less(t, warmup, 5*time.Second)
+
+	// Warm-up requests are not part of the results
+	assert.Positive(t, summary.Warmup.Requests)
+	assert.Equal(t, int64(5), summary.TotalRequests)
+	assert.GreaterOrEqual(t, atomic.LoadInt64(&hits), summary.Warmup.Requests+5)
+}
+
+func TestEngineSigning(t *testing.T) {
+	// The target recomputes the signature the way an HMAC API would
+	key := []byte("top secret")
+	var verified int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+		canonical := strings.Join([]string{
+			r.Method,
+			r.URL.EscapedPath(),
+			"a=1&b=2&b=3",
+			r.Header.Get("X-Api-Timestamp"),
+			hex.EncodeToString(sum[:]),
+			r.Header.Get("X-Tenant"),
+		}, "\n")
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(canonical))
+		expected := "v1=" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+		if r.Header.Get("X-Api-Timestamp") == "" || !hmac.Equal([]byte(r.Header.Get("Authorization")), []byte(expected)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		atomic.AddInt64(&verified, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{
+		Name:        "signing",
+		Method:      "POST",
+		URL:         "/orders?b=3",
+		BaseURL:     server.URL,
+		Headers:     map[string]string{"X-Tenant": "acme"},
+		QueryParams: map[string]interface{}{"b": 2, "a": 1},
+		Body:        map[string]interface{}{"item": "book"},
+		Signing: &config.SigningConfig{
+			Secret:          hex.EncodeToString(key),
+			SecretEncoding:  "hex",
+			Header:          "Authorization",
+			Prefix:          "v1=",
+			Encoding:        "base64",
+			Components:      []string{"method", "path", "query", "timestamp", "body_sha256", "header:x-tenant"},
+			TimestampHeader: "X-Api-Timestamp",
+		},
+	}
+	require.NoError(t, scenario.Validate())
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:     scenario,
+		VirtualUsers: 2,
+		Duration:     time.Minute,
+		MaxRequests:  3,
+		Timeout:      time.Second,
+		Pattern:      "stress",
+		Connections:  2,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), summary.TotalRequests)
+	assert.Equal(t, int64(0), summary.FailedRequests)
+	// The preflight request is signed too
+	assert.Equal(t, int64(7), atomic.LoadInt64(&verified))
+
+	scenario.Signing.Components = []string{"method", "cookies"}
+	assert.ErrorContains(t, scenario.Validate(), "invalid component")
+}
+
+func TestEngineStageMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{
+		Name:    "stages",
+		Method:  "GET",
+		URL:     "/",
+		BaseURL: server.URL,
+		LoadPattern: &config.LoadPatternConfig{Phases: []config.PhaseConfig{
+			{Name: "light", Duration: "500ms", Intensity: 0.5},
+			{Name: "heavy", Duration: "500ms", Intensity: 2},
+		}},
+	}
+	require.NoError(t, scenario.Validate())
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  2,
+		Duration:      time.Second,
+		Timeout:       time.Second,
+		Connections:   2,
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+
+	require.Len(t, summary.Stages, 2)
+	light, heavy := summary.Stages[0], summary.Stages[1]
+	assert.Equal(t, "light", light.Name)
+	assert.Equal(t, "0s", light.Start)
+	assert.Equal(t, "heavy", heavy.Name)
+	assert.Equal(t, "500ms", heavy.Start)
+	assert.Equal(t, 2.0, heavy.Intensity)
+	require.NotNil(t, heavy.Latency)
+
+	// Four times the intensity sends several times the requests
+	assert.Greater(t, heavy.RequestsPerSecond, 2*light.RequestsPerSecond)
+	assert.LessOrEqual(t, light.Requests+heavy.Requests, summary.TotalRequests)
+}
+
+func TestEngineEndpointBreakdown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	rawFile := filepath.Join(t.TempDir(), "raw.jsonl")
+	scenario := &config.Scenario{
+		Name:         "endpoints",
+		Method:       "GET",
+		URL:          "/users/{{random.int 1 100000}}/orders/{{random.uuid}}",
+		BaseURL:      server.URL,
+		URLTemplates: []string{"/users/:user/orders/:order"},
+	}
+	require.NoError(t, scenario.Validate())
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  2,
+		Duration:      time.Minute,
+		MaxRequests:   10,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   2,
+		SkipPreflight: true,
+		RawOut:        rawFile,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+
+	// Twenty distinct URLs, one endpoint
+	require.Len(t, summary.Endpoints, 1)
+	endpoint := summary.Endpoints["GET /users/:user/orders/:order"]
+	require.NotNil(t, endpoint)
+	assert.Equal(t, int64(20), endpoint.Requests)
+	assert.Equal(t, 100.0, endpoint.SuccessRate)
+
+	raw, err := os.ReadFile(rawFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), `"endpoint":"GET /users/:user/orders/:order"`)
+
+	// Paths no template matches have their identifiers normalized, and a
+	// group names every request of the scenario
+	assert.Equal(t, "/users/:id/orders/:id", config.NormalizePath("/users/42/orders/9b2f0c3e-4d5a-4b6c-8d7e-0f1a2b3c4d5e"))
+	assert.Equal(t, "/users/me", config.NormalizePath("/users/me"))
+	assert.True(t, config.MatchURLTemplate("/files/*", "/files/a/b"))
+	assert.False(t, config.MatchURLTemplate("/users/:id", "/users/1/orders"))
+	assert.Error(t, (&config.Scenario{Name: "bad", Method: "GET", URL: "/", URLTemplates: []string{"users/:id"}}).Validate())
+}
+
+func TestEngineCaptureHeaders(t *testing.T) {
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// One response in four misses the cache; the backend is in the ray ID
+		if atomic.AddInt64(&requests, 1)%4 == 0 {
+			w.Header().Set("X-Cache", "MISS")
+			w.Header().Set("CF-Ray", "8a1b2c3d-GRU")
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("X-Cache", "HIT")
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{
+		Name:           "headers",
+		Method:         "GET",
+		URL:            "/",
+		BaseURL:        server.URL,
+		CaptureHeaders: []string{"X-Cache", "cf-ray:-(\\w+)$", "x-cache"},
+	}
+	require.NoError(t, scenario.Validate())
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  1,
+		Duration:      time.Minute,
+		MaxRequests:   20,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+
+	require.Len(t, summary.Headers, 2)
+	cache := summary.Headers["X-Cache"]
+	require.Len(t, cache, 2)
+	assert.Equal(t, int64(15), cache["HIT"].Responses)
+	assert.Equal(t, 75.0, cache["HIT"].Percentage)
+	assert.Equal(t, 100.0, cache["HIT"].SuccessRate)
+	assert.Equal(t, int64(5), cache["MISS"].Responses)
+	assert.Equal(t, 0.0, cache["MISS"].SuccessRate)
+	require.NotNil(t, cache["MISS"].Latency)
+
+	ray := summary.Headers["cf-ray"]
+	require.Len(t, ray, 2)
+	assert.Equal(t, int64(5), ray["GRU"].Responses)
+	assert.Equal(t, int64(15), ray[metrics.MissingHeader].Responses)
+
+	assert.Error(t, (&config.Scenario{Name: "bad", Method: "GET", URL: "/", CaptureHeaders: []string{"X Cache"}}).Validate())
+	assert.Error(t, (&config.Scenario{Name: "bad", Method: "GET", URL: "/", CaptureHeaders: []string{"CF-Ray:("}}).Validate())
+}
+
+func TestEngineSteps(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.Method+" "+r.URL.Path]++
+		mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/login":
+			w.Write([]byte(`{"data": {"token": "t-42"}}`))
+		case r.Header.Get("Authorization") != "Bearer t-42":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 7}`))
+		case r.URL.Path != "/items/7":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{
+		Name:    "steps",
+		BaseURL: server.URL,
+		Headers: map[string]string{"Authorization": "Bearer {{token}}"},
+		Variables: map[string]string{
+			"token": "none",
+		},
+		Steps: []config.StepConfig{
+			{Name: "login", Method: "POST", URL: "/login", Extract: map[string]string{"token": "data.token"}},
+			{Name: "create", Method: "POST", URL: "/items", Body: map[string]interface{}{"name": "x"}, Extract: map[string]string{"item": "id"}},
+			{Name: "update", Method: "PUT", URL: "/items/{{item}}"},
+			{Name: "delete", Method: "DELETE", URL: "/items/{{item}}", Validation: &config.ValidationConfig{StatusCodes: []int{204}}},
+		},
+	}
+	require.NoError(t, scenario.Validate())
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  2,
+		Duration:      time.Minute,
+		MaxRequests:   3,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   2,
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+
+	// Six iterations of four steps; the last fails its own validation
+	assert.Equal(t, int64(24), summary.TotalRequests)
+	assert.Equal(t, int64(6), summary.FailedRequests)
+	require.Len(t, summary.Endpoints, 4)
+	for _, name := range []string{"login", "create", "update"} {
+		assert.Equal(t, 100.0, summary.Endpoints[name].SuccessRate, name)
+	}
+	assert.Zero(t, summary.Endpoints["delete"].SuccessRate)
+	assert.Equal(t, 6, hits["DELETE /items/7"])
+
+	// A step that fails ends the iteration: nothing follows a failed login
+	scenario.Steps[0].Extract = map[string]string{"token": "data.missing"}
+	e, err = engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  1,
+		Duration:      time.Minute,
+		MaxRequests:   2,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   1,
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err = e.Run()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), summary.TotalRequests)
+	assert.Equal(t, int64(2), summary.ValidationResults.ValidationErrors["extract"])
+
+	// Steps replace the scenario's method and URL, but need their own
+	assert.Error(t, (&config.Scenario{Name: "bad", BaseURL: "http://x", Steps: []config.StepConfig{{Method: "GET"}}}).Validate())
+}
+
+func TestEngineStepsRunInOrderAndStopWhenCancelled(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	firstHit := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.RequestURI())
+		count := len(paths)
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/first":
+			fmt.Fprintf(w, `{"n": "%d"}`, count)
+		case "/slow":
+			select {
+			case firstHit <- struct{}{}:
+			default:
+			}
+			<-release
+		}
+	}))
+	defer server.Close()
+
+	// Steps run in order, each seeing the values captured before it
+	scenario := &config.Scenario{
+		Name:    "ordered",
+		BaseURL: server.URL,
+		Steps: []config.StepConfig{
+			{Name: "first", Method: "GET", URL: "/first", Extract: map[string]string{"n": "n"}},
+			{Name: "second", Method: "GET", URL: "/second?n={{n}}"},
+			{Name: "third", Method: "GET", URL: "/third?n={{n}}"},
+		},
+	}
+	require.NoError(t, scenario.Validate())
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  1,
+		Duration:      time.Minute,
+		MaxRequests:   2,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   1,
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+	summary, err := e.Run()
+	require.NoError(t, err)
+	assert.Zero(t, summary.FailedRequests)
+	assert.Equal(t, []string{"/first", "/second?n=1", "/third?n=1", "/first", "/second?n=4", "/third?n=4"}, paths)
+
+	// Stopping the test while a step is in flight lets it finish within the
+	// drain period, but sends none of the steps after it
+	paths = nil
+	scenario.Steps[0] = config.StepConfig{Name: "slow", Method: "GET", URL: "/slow"}
+	e, err = engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  1,
+		Duration:      time.Minute,
+		Timeout:       5 * time.Second,
+		Drain:         5 * time.Second,
+		Pattern:       "stress",
+		Connections:   1,
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		summary, err = e.Run()
+	}()
+	select {
+	case <-firstHit:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first step never sent")
+	}
+	e.Stop()
+	close(release)
+	<-done
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), summary.TotalRequests)
+	assert.Zero(t, summary.FailedRequests)
+	assert.Equal(t, []string{"/slow"}, paths)
+}
+
+func TestEngineStepTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	run := func(scenarioTimeout, stepTimeout string) *metrics.Summary {
+		scenario := &config.Scenario{
+			Name:    "timeouts",
+			BaseURL: server.URL,
+			Timeout: scenarioTimeout,
+			Steps: []config.StepConfig{
+				{Name: "fast", Method: "GET", URL: "/fast"},
+				{Name: "slow", Method: "GET", URL: "/slow", Timeout: stepTimeout},
+			},
+		}
+		require.NoError(t, scenario.Validate())
+		e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+			Scenario:      scenario,
+			VirtualUsers:  1,
+			Duration:      time.Minute,
+			MaxRequests:   2,
+			Timeout:       scenario.GetTimeout(),
+			Pattern:       "stress",
+			Connections:   1,
+			SkipPreflight: true,
+		}, scenario)
+		require.NoError(t, err)
+		summary, err := e.Run()
+		require.NoError(t, err)
+		return summary
+	}
+
+	// A step may wait longer than the scenario and global timeouts
+	summary := run("100ms", "2s")
+	assert.Equal(t, int64(4), summary.TotalRequests)
+	assert.Zero(t, summary.FailedRequests)
+
+	// Or give up sooner, while the other steps keep the scenario's
+	summary = run("5s", "50ms")
+	assert.Equal(t, int64(4), summary.TotalRequests)
+	assert.Equal(t, int64(2), summary.FailedRequests)
+	assert.Equal(t, 100.0, summary.Endpoints["fast"].SuccessRate)
+	assert.Zero(t, summary.Endpoints["slow"].SuccessRate)
+
+	// Without one, a step keeps the scenario timeout
+	summary = run("100ms", "")
+	assert.Equal(t, int64(2), summary.FailedRequests)
+
+	for _, timeout := range []string{"soon", "0s", "-1s"} {
+		scenario := &config.Scenario{Name: "bad", BaseURL: server.URL, Steps: []config.StepConfig{{Method: "GET", URL: "/", Timeout: timeout}}}
+		assert.ErrorContains(t, scenario.Validate(), "invalid timeout: "+timeout)
+	}
+}
+
+func TestEngineStepBudgets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search":
+			time.Sleep(60 * time.Millisecond)
+		case "/cart":
+			time.Sleep(20 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	scenario := &config.Scenario{
+		Name:    "journey",
+		BaseURL: server.URL,
+		Steps: []config.StepConfig{
+			{Name: "home", Method: "GET", URL: "/", Budget: "1s"},
+			{Name: "search", Method: "GET", URL: "/search", Budget: "10ms"},
+			{Name: "cart", Method: "GET", URL: "/cart"},
+		},
+	}
+	require.NoError(t, scenario.Validate())
+	cfg := &config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  1,
+		Duration:      time.Minute,
+		MaxRequests:   4,
+		Timeout:       time.Second,
+		Pattern:       "stress",
+		Connections:   1,
+		SkipPreflight: true,
+	}
+	e, err := engine.NewLoadEngine(cfg, scenario)
+	require.NoError(t, err)
+	summary, err := e.Run()
+	require.NoError(t, err)
+
+	report, err := reporting.NewJSONReporter(cfg).GenerateReport(summary, scenario)
+	require.NoError(t, err)
+
+	// Steps over budget first, then by their share of the journey
+	require.Len(t, report.SlowSteps, 3)
+	search, cart, home := report.SlowSteps[0], report.SlowSteps[1], report.SlowSteps[2]
+	assert.Equal(t, "search", search.Step)
+	assert.Equal(t, "10ms", search.Budget)
+	assert.Equal(t, int64(4), search.Requests)
+	assert.Equal(t, int64(4), search.OverBudget)
+	assert.Equal(t, 100.0, search.OverBudgetPct)
+	assert.Equal(t, "cart", cart.Step)
+	assert.Empty(t, cart.Budget)
+	assert.Zero(t, cart.OverBudget)
+	assert.Equal(t, "home", home.Step)
+	assert.Zero(t, home.OverBudget)
+	assert.Greater(t, search.Contribution, cart.Contribution)
+	assert.Greater(t, cart.Contribution, home.Contribution)
+	assert.InDelta(t, 100, search.Contribution+cart.Contribution+home.Contribution, 0.1)
+
+	// Merging reports ranks the steps again under the same budgets
+	merged, err := reporting.MergeReports([]*reporting.Report{report, report}, []string{"a", "b"})
+	require.NoError(t, err)
+	require.Len(t, merged.SlowSteps, 3)
+	assert.Equal(t, "search", merged.SlowSteps[0].Step)
+	assert.Equal(t, int64(8), merged.SlowSteps[0].OverBudget)
+	assert.Equal(t, "10ms", merged.SlowSteps[0].Budget)
+
+	assert.Contains(t, reporting.FormatMarkdownSummary(report, nil), "| search | 10ms | 4 (100.00%) |")
+
+	// Without budgets there is no ranking
+	for i := range scenario.Steps {
+		scenario.Steps[i].Budget = ""
+	}
+	report, err = reporting.NewJSONReporter(cfg).GenerateReport(summary, scenario)
+	require.NoError(t, err)
+	assert.Empty(t, report.SlowSteps)
+
+	for _, budget := range []string{"fast", "0s", "-5ms"} {
+		scenario := &config.Scenario{Name: "bad", BaseURL: server.URL, Steps: []config.StepConfig{{Method: "GET", URL: "/", Budget: budget}}}
+		assert.ErrorContains(t, scenario.Validate(), "invalid budget: "+budget)
+	}
+}
+
+func TestEngineStepRate(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	run := func(steps []config.StepConfig) map[string]int {
+		mu.Lock()
+		hits = map[string]int{}
+		mu.Unlock()
+
+		scenario := &config.Scenario{Name: "paced", BaseURL: server.URL, Steps: steps}
+		require.NoError(t, scenario.Validate())
+		e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+			Scenario:      scenario,
+			VirtualUsers:  1,
+			Duration:      2 * time.Second,
+			Timeout:       time.Second,
+			Pattern:       "stress",
+			Connections:   1,
+			SkipPreflight: true,
+		}, scenario)
+		require.NoError(t, err)
+		_, err = e.Run()
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		return hits
+	}
+
+	// The status is polled at 2 per second while uploads run at full speed
+	sent := run([]config.StepConfig{
+		{Name: "upload", Method: "POST", URL: "/upload"},
+		{Name: "status", Method: "GET", URL: "/status", Rate: 2},
+	})
+	assert.InDelta(t, 4, sent["/status"], 1)
+	assert.Greater(t, sent["/upload"], 3*sent["/status"])
+
+	// With every step paced, the VU waits for the next one due
+	sent = run([]config.StepConfig{
+		{Name: "fast", Method: "GET", URL: "/fast", Rate: 5},
+		{Name: "slow", Method: "GET", URL: "/slow", Rate: 1},
+	})
+	assert.InDelta(t, 10, sent["/fast"], 2)
+	assert.InDelta(t, 2, sent["/slow"], 1)
+
+	scenario := &config.Scenario{Name: "bad", BaseURL: server.URL, Steps: []config.StepConfig{{Method: "GET", URL: "/", Rate: -1}}}
+	assert.ErrorContains(t, scenario.Validate(), "invalid rate: -1")
+}
+
+func TestEngineExtract(t *testing.T) {
+	var mu sync.Mutex
+	var sessions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("X-Token", "t-1")
+			w.Write([]byte(`<input name="csrf" value="c9f"> {"items": [{"id": "a"}, {"id": "b"}]}`))
+		case "/session":
+			mu.Lock()
+			sessions = append(sessions, r.Header.Get("X-Session"))
+			mu.Unlock()
+			w.Write([]byte(fmt.Sprintf(`{"session": "s-%d"}`, len(sessions))))
+		default:
+			if r.Header.Get("X-Token") != "t-1" || r.URL.Query().Get("csrf") != "c9f" || r.URL.Path != "/items/b" {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}
+	}))
+	defer server.Close()
+
+	newEngine := func(scenario *config.Scenario) *engine.LoadEngine {
+		require.NoError(t, scenario.Validate())
+		e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+			Scenario:      scenario,
+			VirtualUsers:  1,
+			Duration:      time.Minute,
+			MaxRequests:   3,
+			Timeout:       time.Second,
+			Pattern:       "stress",
+			Connections:   1,
+			SkipPreflight: true,
+		}, scenario)
+		require.NoError(t, err)
+		return e
+	}
+
+	// Header, regex and JSONPath values feed the following step
+	summary, err := newEngine(&config.Scenario{
+		Name:    "extract",
+		BaseURL: server.URL,
+		Steps: []config.StepConfig{
+			{Name: "login", Method: "GET", URL: "/login", Extract: map[string]string{
+				"token": "header:x-token",
+				"csrf":  `regex:name="csrf" value="(\w+)"`,
+				"item":  "json:$.items[1].id",
+			}},
+			{Name: "fetch", Method: "GET", URL: "/items/{{item}}", Headers: map[string]string{"X-Token": "{{token}}"}, QueryParams: map[string]interface{}{"csrf": "{{csrf}}"}},
+		},
+	}).Run()
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), summary.TotalRequests)
+	assert.Zero(t, summary.FailedRequests)
+
+	// Values extracted by the scenario's own request carry over to the VU's
+	// next iterations
+	summary, err = newEngine(&config.Scenario{
+		Name:      "session",
+		Method:    "GET",
+		URL:       "/session",
+		BaseURL:   server.URL,
+		Headers:   map[string]string{"X-Session": "{{session}}"},
+		Variables: map[string]string{"session": "none"},
+		Extract:   map[string]string{"session": "session"},
+	}).Run()
+	require.NoError(t, err)
+	assert.Zero(t, summary.FailedRequests)
+	assert.Equal(t, []string{"none", "s-1", "s-2"}, sessions)
+
+	assert.Error(t, (&config.Scenario{Name: "bad", Method: "GET", URL: "/", BaseURL: "http://x", Extract: map[string]string{"id": "regex:("}}).Validate())
+	assert.Error(t, (&config.Scenario{Name: "bad", Method: "GET", URL: "/", BaseURL: "http://x", Extract: map[string]string{"id": "header:"}}).Validate())
+}
+
+func TestEngineSecrets(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/secret/data/load" && r.Header.Get("X-Vault-Token") == "vt":
+			w.Write([]byte(`{"data": {"data": {"password": "vault-pass"}}}`))
+		case r.Header.Get("X-Amz-Target") == "secretsmanager.GetSecretValue" &&
+			strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"):
+			w.Write([]byte(`{"SecretString": "{\"token\": \"aws-token\"}"}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer provider.Close()
+
+	t.Setenv("GOTSUNAMI_TEST_API_KEY", "env-key")
+	t.Setenv("VAULT_ADDR", provider.URL)
+	t.Setenv("VAULT_TOKEN", "vt")
+	t.Setenv("AWS_ENDPOINT_URL", provider.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cert_pass"), []byte("file-pass\n"), 0o600))
+
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.URL.Query().Get("key"), r.Header.Get("X-Pass"), r.Header.Get("X-Vault"), r.Header.Get("X-Token"))
+	}))
+	defer server.Close()
+
+	rawFile := filepath.Join(dir, "raw.jsonl")
+	scenario := &config.Scenario{
+		Name:    "secrets",
+		Method:  "GET",
+		URL:     "/items?key={{secret.api_key}}",
+		BaseURL: server.URL,
+		Headers: map[string]string{"X-Pass": "{{secret.cert}}", "X-Vault": "{{secret.db}}", "X-Token": "{{secret.token}}"},
+		Secrets: map[string]string{
+			"api_key": "env:GOTSUNAMI_TEST_API_KEY",
+			"cert":    "file:" + filepath.Join(dir, "cert_pass"),
+			"db":      "vault:secret/data/load#password",
+			"token":   "aws:load/api#token",
+		},
+	}
+	require.NoError(t, scenario.Validate())
+
+	newConfig := func() *config.LoadTestConfig {
+		return &config.LoadTestConfig{
+			Scenario:      scenario,
+			VirtualUsers:  1,
+			Duration:      time.Minute,
+			MaxRequests:   1,
+			Timeout:       time.Second,
+			Pattern:       "stress",
+			Connections:   1,
+			SkipPreflight: true,
+			RawOut:        rawFile,
+		}
+	}
+	e, err := engine.NewLoadEngine(newConfig(), scenario)
+	require.NoError(t, err)
+	_, err = e.Run()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"env-key", "file-pass", "vault-pass", "aws-token"}, received)
+
+	// Secret values never reach the artifacts
+	raw, err := os.ReadFile(rawFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "env-key")
+	assert.Contains(t, string(raw), "[REDACTED]")
+
+	// A secret that cannot be read stops the test before it starts
+	scenario.Secrets["db"] = "vault:secret/data/missing#password"
+	_, err = engine.NewLoadEngine(newConfig(), scenario)
+	assert.ErrorContains(t, err, "secret db")
+
+	scenario.Secrets = map[string]string{"x": "ssm:param"}
+	assert.Error(t, scenario.Validate())
+	scenario.Secrets = map[string]string{"x": "vault:secret/data/load"}
+	assert.Error(t, scenario.Validate())
+}
+
+func TestEngineData(t *testing.T) {
+	var mu sync.Mutex
+	users := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		users[body["user"]+":"+r.URL.Query().Get("pass")]++
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "users.csv")
+	require.NoError(t, os.WriteFile(file, []byte("user;pass\nana;a1\nbia;b2\n\ncai;c3\ndan;d4\neva;e5\n"), 0o600))
+
+	run := func(data *config.DataConfig, maxRequests int) *metrics.Summary {
+		scenario := &config.Scenario{
+			Name:        "data",
+			Method:      "POST",
+			URL:         "/login",
+			BaseURL:     server.URL,
+			Headers:     map[string]string{"Content-Type": "application/json"},
+			QueryParams: map[string]interface{}{"pass": "{{csv.pass}}"},
+			Body:        map[string]interface{}{"user": "{{csv.user}}"},
+			Data:        data,
+		}
+		require.NoError(t, scenario.Validate())
+
+		e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+			Scenario:      scenario,
+			VirtualUsers:  2,
+			Duration:      time.Minute,
+			MaxRequests:   maxRequests,
+			Timeout:       time.Second,
+			Pattern:       "stress",
+			Connections:   2,
+			SkipPreflight: true,
+		}, scenario)
+		require.NoError(t, err)
+
+		summary, err := e.Run()
+		require.NoError(t, err)
+		return summary
+	}
+
+	// Unique rows are each sent once, then the VUs stop
+	summary := run(&config.DataConfig{File: file, Strategy: config.DataUnique, Delimiter: ";"}, 0)
+	assert.Equal(t, int64(5), summary.TotalRequests)
+	assert.Equal(t, map[string]int{"ana:a1": 1, "bia:b2": 1, "cai:c3": 1, "dan:d4": 1, "eva:e5": 1}, users)
+
+	// Sequential rows start over after the last
+	users = make(map[string]int)
+	summary = run(&config.DataConfig{File: file, Strategy: config.DataSequential, Delimiter: ";"}, 4)
+	assert.Equal(t, int64(8), summary.TotalRequests)
+	assert.Equal(t, map[string]int{"ana:a1": 2, "bia:b2": 2, "cai:c3": 2, "dan:d4": 1, "eva:e5": 1}, users)
+
+	// Weighed rows are picked in proportion to their weight
+	weighed := filepath.Join(t.TempDir(), "weighed.csv")
+	require.NoError(t, os.WriteFile(weighed, []byte("user,pass,weight\nana,a1,0\nbia,b2,3\ncai,c3,1\n"), 0o600))
+	users = make(map[string]int)
+	summary = run(&config.DataConfig{File: weighed, Strategy: config.DataRandom, Weight: "weight"}, 50)
+	assert.Equal(t, int64(100), summary.TotalRequests)
+	assert.Zero(t, users["ana:a1"])
+	assert.InDelta(t, 75, users["bia:b2"], 20)
+	assert.InDelta(t, 25, users["cai:c3"], 20)
+
+	_, err := engine.NewLoadEngine(&config.LoadTestConfig{VirtualUsers: 1, Duration: time.Second}, &config.Scenario{
+		Name: "data", Method: "GET", URL: "/", BaseURL: server.URL,
+		Data: &config.DataConfig{File: weighed, Strategy: config.DataRandom, Weight: "user"},
+	})
+	assert.Error(t, err)
+
+	assert.Error(t, (&config.DataConfig{File: file, Strategy: "shuffle"}).Validate())
+	assert.Error(t, (&config.DataConfig{File: file, Delimiter: ";;"}).Validate())
+	assert.Error(t, (&config.DataConfig{File: file, Weight: "weight"}).Validate())
+}
+
+func TestEngineConnectionPool(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	run := func(baseURL string) *metrics.Summary {
+		scenario := &config.Scenario{Name: "pool", Method: "GET", URL: "/", BaseURL: baseURL}
+		e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+			Scenario:        scenario,
+			VirtualUsers:    4,
+			Duration:        time.Minute,
+			MaxRequests:     3,
+			Timeout:         time.Second,
+			Pattern:         "stress",
+			Connections:     4,
+			MaxConnsPerHost: 1,
+			KeepAlive:       true,
+			SkipPreflight:   true,
+		}, scenario)
+		require.NoError(t, err)
+
+		summary, err := e.Run()
+		require.NoError(t, err)
+		return summary
+	}
+
+	// Four VUs share one connection, so they queue for it
+	pool := run(server.URL).ConnectionPool
+	require.NotNil(t, pool)
+	assert.Equal(t, int64(1), pool.Dials)
+	assert.Equal(t, int64(1), pool.PeakOpen)
+	assert.Greater(t, pool.PeakWaiting, int64(1))
+	assert.Equal(t, int64(11), pool.Reused)
+	assert.Greater(t, pool.Waits, int64(1))
+	assert.NotEmpty(t, pool.MaxWait)
+	assert.Zero(t, pool.InUse)
+	assert.Zero(t, pool.Waiting)
+
+	// Nothing listens on a closed server
+	server.Close()
+	pool = run(server.URL).ConnectionPool
+	assert.Equal(t, int64(12), pool.DialFailures)
+	assert.Zero(t, pool.Open)
+}
+
+func BenchmarkCreateRequest(b *testing.B) {
+	scenario := &config.Scenario{
+		Name:    "bench",
+		Method:  "POST",
+		URL:     "/users/{{user}}",
+		BaseURL: "http://localhost",
+		Headers: map[string]string{
+			"Accept":        "application/json",
+			"Authorization": "Bearer token",
+			"X-Request":     "{{random.uuid}}",
+			"X-Tenant":      "acme",
+		},
+		QueryParams: map[string]interface{}{"page": "1", "user": "{{user}}", "limit": 10.0},
+		Body:        map[string]interface{}{"name": "{{user}}", "active": true},
+		Variables:   map[string]string{"user": "{{random.int 1 1000000}}"},
+	}
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:     scenario,
+		VirtualUsers: 1,
+		Duration:     time.Second,
+		Pattern:      "steady",
+		Seed:         1,
+	}, scenario)
+	require.NoError(b, err)
+
+	rng := e.VURand(1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := e.CreateRequest(rng); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// probeProtocol is a registered protocol answering every request with 200,
+// counting the instances closed
+type probeProtocol struct {
+	perVU  bool
+	closed *atomic.Int64
+}
+
+func (p *probeProtocol) Name() string    { return "probe" }
+func (p *probeProtocol) Version() string { return "test" }
+func (p *probeProtocol) PerVU() bool     { return p.perVU }
+func (p *probeProtocol) Close() error {
+	p.closed.Add(1)
+	return nil
+}
+func (p *probeProtocol) ValidateConfig(map[string]interface{}) error { return nil }
+func (p *probeProtocol) GetMetrics() map[string]interface{}          { return map[string]interface{}{} }
+func (p *probeProtocol) Execute(ctx context.Context, req *protocols.Request) (*protocols.Response, error) {
+	return &protocols.Response{StatusCode: 200, Headers: map[string]string{}, Body: []byte{}}, nil
+}
+
+// registerProbe registers a probe protocol under name, returning the count
+// of instances closed
+func registerProbe(name string, perVU bool) *atomic.Int64 {
+	closed := &atomic.Int64{}
+	protocols.Register(name, func(map[string]interface{}) (protocols.Protocol, error) {
+		return &probeProtocol{perVU: perVU, closed: closed}, nil
+	})
+	return closed
+}
+
+func TestEngineReleasesProtocolsOnSetupError(t *testing.T) {
+	closed := registerProbe("probe-setup", true)
+	scenario := &config.Scenario{Name: "probe", Protocol: "probe-setup", Method: "SEND", URL: "probe://local/"}
+
+	// The protocol is created before the histogram precision is checked
+	_, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:           scenario,
+		VirtualUsers:       3,
+		Duration:           time.Second,
+		Pattern:            "steady",
+		HistogramPrecision: 1,
+	}, scenario)
+	require.Error(t, err)
+	assert.Equal(t, int64(1), closed.Load())
+
+	// A failed start hook releases the shared and per-VU instances
+	closed.Store(0)
+	scenario.Hooks = &config.HooksConfig{OnStart: []config.HookConfig{{Webhook: "http://127.0.0.1:1/", FailOnError: true, Timeout: "1s"}}}
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  3,
+		Duration:      time.Second,
+		Pattern:       "steady",
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+	_, err = e.Run()
+	require.Error(t, err)
+	assert.Equal(t, int64(4), closed.Load())
+}
+
+func TestEngineSetVUsCreatesPerVUClients(t *testing.T) {
+	closed := registerProbe("probe-scale", true)
+	scenario := &config.Scenario{Name: "probe", Protocol: "probe-scale", Method: "SEND", URL: "probe://local/"}
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  1,
+		Duration:      time.Minute,
+		Delay:         10 * time.Millisecond,
+		Pattern:       "steady",
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+	shared := e.ProtocolFor(2)
+	assert.NotSame(t, shared, e.ProtocolFor(0))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run()
+	}()
+	require.Eventually(t, func() bool { return e.ActiveVUs() == 1 && e.SetVUs(3) == nil }, 5*time.Second, 10*time.Millisecond)
+
+	// VUs added while running get an instance of their own
+	assert.NotSame(t, shared, e.ProtocolFor(1))
+	assert.NotSame(t, shared, e.ProtocolFor(2))
+	assert.NotSame(t, e.ProtocolFor(1), e.ProtocolFor(2))
+	assert.Same(t, shared, e.ProtocolFor(3))
+
+	e.Stop()
+	<-done
+	assert.Equal(t, int64(4), closed.Load())
+}
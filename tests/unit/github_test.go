@@ -0,0 +1,154 @@
+package unit
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/hooks"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/reporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// githubReport builds the report of sampleSummary for the github tests
+func githubReport(t *testing.T) *reporting.Report {
+	t.Helper()
+	scenario := &config.Scenario{Name: "checkout"}
+	report, err := reporting.NewJSONReporter(&config.LoadTestConfig{
+		Scenario:     scenario,
+		VirtualUsers: 5,
+		Duration:     time.Minute,
+		Pattern:      "steady",
+		Labels:       map[string]string{"env": "staging", "branch": "main"},
+	}).GenerateReport(sampleSummary(), scenario)
+	require.NoError(t, err)
+	return report
+}
+
+func TestCheckThresholds(t *testing.T) {
+	assert.Empty(t, reporting.CheckThresholds(&metrics.Summary{SuccessRate: 99.5}))
+
+	failures := reporting.CheckThresholds(&metrics.Summary{
+		SuccessRate:   90,
+		SLOViolations: []string{"p95 250ms exceeds 200ms"},
+		Idempotency:   &metrics.IdempotencySummary{Checked: 10, Duplicates: 2},
+		Consistency:   &metrics.ConsistencySummary{Checked: 4, Inconsistent: 1},
+		Hooks: []hooks.Result{
+			{Name: "seed", Event: "start", Required: true, Success: false, Error: "exit status 1"},
+			{Name: "notify", Event: "end", Required: false, Success: false, Error: "timeout"},
+			{Name: "migrate", Event: "start", Required: true, Success: true},
+		},
+	})
+	assert.Equal(t, []string{
+		"success rate 90.00% is below 95.00%",
+		"p95 250ms exceeds 200ms",
+		"2 of 10 operations checked created duplicate resources despite their idempotency key",
+		"1 of 4 URLs checked returned differing content",
+		"start hook seed failed: exit status 1",
+	}, failures)
+
+	// Checked operations without duplicates pass
+	assert.Empty(t, reporting.CheckThresholds(&metrics.Summary{
+		SuccessRate: 100,
+		Idempotency: &metrics.IdempotencySummary{Checked: 10},
+		Consistency: &metrics.ConsistencySummary{Checked: 4},
+	}))
+}
+
+func TestFormatMarkdownSummary(t *testing.T) {
+	report := githubReport(t)
+	report.Endpoints = map[string]reporting.ReportEndpoint{"GET /a|b": {Requests: 10, SuccessRate: 90}}
+
+	passed := reporting.FormatMarkdownSummary(report, nil)
+	assert.True(t, strings.HasPrefix(passed, "## GoTsunami: checkout — ✅ Passed\n\n"))
+	assert.Contains(t, passed, "`branch=main` `env=staging`")
+	assert.Contains(t, passed, "| Virtual users | 5 |\n")
+	assert.Contains(t, passed, "| Total requests | 10 |\n")
+	assert.Contains(t, passed, "| Success rate | 90.00% |\n")
+	assert.Contains(t, passed, "| 200 | 9 |\n| 500 | 1 |\n")
+	// Pipes would split the table cell
+	assert.Contains(t, passed, "| GET /a\\|b | 10 |")
+	assert.NotContains(t, passed, "Threshold failures")
+
+	failed := reporting.FormatMarkdownSummary(report, []string{"success rate 90.00% is below 95.00%"})
+	assert.Contains(t, failed, "❌ Failed")
+	assert.Contains(t, failed, "**Threshold failures:**\n\n- success rate 90.00% is below 95.00%\n")
+}
+
+func TestFormatAnnotation(t *testing.T) {
+	tests := []struct {
+		name    string
+		title   string
+		message string
+		want    string
+	}{
+		{name: "plain", title: "GoTsunami", message: "all good", want: "::error title=GoTsunami::all good"},
+		{name: "percent", title: "GoTsunami", message: "success rate 90% is below 95%", want: "::error title=GoTsunami::success rate 90%25 is below 95%25"},
+		{name: "newlines", title: "GoTsunami", message: "first\r\nsecond\nthird", want: "::error title=GoTsunami::first%0D%0Asecond%0Athird"},
+		{name: "colon and comma in message", title: "GoTsunami", message: "p95: 250ms, p99: 1s", want: "::error title=GoTsunami::p95: 250ms, p99: 1s"},
+		{name: "colon and comma in property", title: "GoTsunami: checkout, eu", message: "failed", want: "::error title=GoTsunami%3A checkout%2C eu::failed"},
+		{name: "percent and newline in property", title: "100%\nsure", message: "failed", want: "::error title=100%25%0Asure::failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, reporting.FormatAnnotation("error", tt.title, tt.message))
+		})
+	}
+}
+
+func TestGitHubReporterPublish(t *testing.T) {
+	dir := t.TempDir()
+	summaryFile := filepath.Join(dir, "summary.md")
+	outputFile := filepath.Join(dir, "output")
+	// Earlier steps may have written to both files already
+	require.NoError(t, os.WriteFile(summaryFile, []byte("# Build\n"), 0o644))
+	require.NoError(t, os.WriteFile(outputFile, []byte("version=1.2.3\n"), 0o644))
+	t.Setenv("GITHUB_STEP_SUMMARY", summaryFile)
+	t.Setenv("GITHUB_OUTPUT", outputFile)
+
+	// Annotations go to stderr
+	stderr := os.Stderr
+	read, write, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stderr = write
+	publisher := reporting.NewGitHubReporter()
+	os.Stderr = stderr
+
+	report := githubReport(t)
+	report.Generator = &metrics.GeneratorSummary{Warning: "generator saturated 40% of the test"}
+	failures := reporting.CheckThresholds(&metrics.Summary{SuccessRate: report.Summary.SuccessRate})
+	require.NoError(t, publisher.Publish(report, failures))
+	write.Close()
+	annotations, err := io.ReadAll(read)
+	require.NoError(t, err)
+	assert.Equal(t, "::error title=GoTsunami threshold failed::success rate 90.00%25 is below 95.00%25\n"+
+		"::warning title=GoTsunami generator saturated::generator saturated 40%25 of the test\n", string(annotations))
+
+	summary, err := os.ReadFile(summaryFile)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(summary), "# Build\n## GoTsunami: checkout — ❌ Failed"))
+
+	outputs, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, "version=1.2.3\n"+
+		"passed=false\n"+
+		"total_requests=10\n"+
+		"success_rate=90.00\n"+
+		fmt.Sprintf("requests_per_second=%.2f\n", report.Throughput.RequestsPerSecond)+
+		"p95="+report.Latency.P95+"\n"+
+		"p99="+report.Latency.P99+"\n", string(outputs))
+
+	// Without the environment variables there is nothing to write
+	report.Generator = nil
+	t.Setenv("GITHUB_STEP_SUMMARY", "")
+	t.Setenv("GITHUB_OUTPUT", "")
+	assert.NoError(t, reporting.NewGitHubReporter().Publish(report, nil))
+}
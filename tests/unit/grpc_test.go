@@ -0,0 +1,246 @@
+package unit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/engine"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/alexandredias/gotsunami/internal/protocols/grpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGRPCReflection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := gogrpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.DialConfig{Plaintext: true})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status, err := grpc.CheckHealth(ctx, conn, "")
+	require.NoError(t, err)
+	assert.Equal(t, "SERVING", status)
+
+	// Reflection services are left out
+	services, err := grpc.Describe(ctx, conn)
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, protoreflect.FullName("grpc.health.v1.Health"), services[0].FullName())
+
+	check := services[0].Methods().ByName("Check")
+	require.NotNil(t, check)
+	assert.Equal(t, "/grpc.health.v1.Health/Check", grpc.MethodPath(check))
+	assert.Equal(t, map[string]interface{}{"service": ""}, grpc.SampleMessage(check.Input()))
+}
+
+func TestGRPCSampleMessage(t *testing.T) {
+	// Struct is recursive through Value and has a special JSON form
+	assert.Equal(t, map[string]interface{}{}, grpc.SampleMessage((&structpb.Struct{}).ProtoReflect().Descriptor()))
+
+	sample := grpc.SampleMessage((&structpb.ListValue{}).ProtoReflect().Descriptor())
+	assert.Equal(t, []interface{}{}, sample)
+}
+
+// healthProto declares the health service like its upstream definition
+const healthProto = `syntax = "proto3";
+package grpc.health.v1;
+
+message HealthCheckRequest {
+  string service = 1;
+}
+
+message HealthCheckResponse {
+  enum ServingStatus {
+    UNKNOWN = 0;
+    SERVING = 1;
+    NOT_SERVING = 2;
+    SERVICE_UNKNOWN = 3;
+  }
+  ServingStatus status = 1;
+}
+
+service Health {
+  rpc Check(HealthCheckRequest) returns (HealthCheckResponse);
+}
+`
+
+func TestGRPCProtocol(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var tagged int64
+	server := gogrpc.NewServer(gogrpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *gogrpc.UnaryServerInfo, handler gogrpc.UnaryHandler) (interface{}, error) {
+		if md, _ := metadata.FromIncomingContext(ctx); len(md.Get("x-tenant")) > 0 && md.Get("x-tenant")[0] == "acme" {
+			atomic.AddInt64(&tagged, 1)
+		}
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	go server.Serve(listener)
+	defer server.Stop()
+	baseURL := "grpc://" + listener.Addr().String()
+
+	// Through the engine, describing the service by reflection
+	scenario := &config.Scenario{
+		Name:           "health",
+		Protocol:       "grpc",
+		Method:         "grpc.health.v1.Health/Check",
+		URL:            "/grpc.health.v1.Health/Check",
+		BaseURL:        baseURL,
+		Headers:        map[string]string{"X-Tenant": "acme"},
+		Body:           map[string]interface{}{"service": ""},
+		ProtocolConfig: map[string]interface{}{"reflection": true, "connections": float64(2)},
+		Validation:     &config.ValidationConfig{StatusCodes: []int{200}, BodyContains: []string{`"status":"SERVING"`}},
+	}
+	require.NoError(t, scenario.Validate())
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  2,
+		Duration:      time.Minute,
+		MaxRequests:   5,
+		Timeout:       5 * time.Second,
+		Pattern:       "stress",
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), summary.TotalRequests)
+	assert.Equal(t, int64(10), summary.SuccessfulRequests)
+	assert.Equal(t, int64(10), atomic.LoadInt64(&tagged))
+
+	// Directly, describing the service with a proto file
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "health.proto"), []byte(healthProto), 0o600))
+	client, err := protocols.New("grpc", map[string]interface{}{"proto": "health.proto", "import_paths": []interface{}{dir}})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+	resp, err := client.Execute(ctx, &protocols.Request{URL: baseURL + "/grpc.health.v1.Health/Check", Body: []byte(`{"service": "missing"}`), Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	require.NoError(t, resp.Error)
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Equal(t, "5", resp.Headers["grpc-status"])
+	assert.True(t, resp.HTTPError())
+
+	resp, err = client.Execute(ctx, &protocols.Request{URL: baseURL + "/grpc.health.v1.Health/Check", Body: []byte(`{"service": 1}`)})
+	require.NoError(t, err)
+	assert.True(t, resp.TransportError())
+
+	// Calls that get no answer are transport errors
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed.Close()
+	resp, err = client.Execute(ctx, &protocols.Request{URL: "grpc://" + closed.Addr().String() + "/grpc.health.v1.Health/Check", Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	assert.True(t, resp.TransportError())
+
+	_, err = grpc.ParseConfig(map[string]interface{}{"proto": "health.proto", "reflection": true})
+	assert.Error(t, err)
+	_, err = grpc.ParseConfig(map[string]interface{}{"reflection": false})
+	assert.Error(t, err)
+	_, err = grpc.ParseConfig(map[string]interface{}{"timeout": "1s"})
+	assert.Error(t, err)
+}
+
+func TestGRPCMixedSteps(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var authorized int64
+	server := gogrpc.NewServer(gogrpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *gogrpc.UnaryServerInfo, handler gogrpc.UnaryHandler) (interface{}, error) {
+		if md, _ := metadata.FromIncomingContext(ctx); len(md.Get("authorization")) > 0 && md.Get("authorization")[0] == "Bearer abc" {
+			atomic.AddInt64(&authorized, 1)
+		}
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	login := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"token": "abc"}`))
+	}))
+	defer login.Close()
+
+	// A REST login hands its token to a gRPC call
+	scenario := &config.Scenario{
+		Name:      "mixed",
+		BaseURL:   login.URL,
+		Variables: map[string]string{"token": ""},
+		Steps: []config.StepConfig{
+			{Name: "login", Method: "POST", URL: "/login", Extract: map[string]string{"token": "token"}},
+			{
+				Name:           "check",
+				Protocol:       "grpc",
+				BaseURL:        "grpc://" + listener.Addr().String(),
+				ProtocolConfig: map[string]interface{}{"reflection": true},
+				Method:         "grpc.health.v1.Health/Check",
+				URL:            "/grpc.health.v1.Health/Check",
+				Headers:        map[string]string{"Authorization": "Bearer {{token}}"},
+				Body:           map[string]interface{}{"service": ""},
+			},
+		},
+	}
+	require.NoError(t, scenario.Validate())
+	assert.True(t, scenario.SendsHTTP())
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  1,
+		Duration:      time.Minute,
+		MaxRequests:   3,
+		Timeout:       5 * time.Second,
+		Pattern:       "stress",
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), summary.TotalRequests)
+	assert.Equal(t, int64(6), summary.SuccessfulRequests)
+	assert.Equal(t, int64(3), atomic.LoadInt64(&authorized))
+	assert.Equal(t, int64(3), summary.Endpoints["check"].Requests)
+
+	// Custom methods are only checked on steps sent over HTTP
+	scenario.Steps[0].Method = "LOGIN"
+	assert.Error(t, scenario.Validate())
+
+	// A step of the scenario's protocol uses the scenario's settings
+	scenario.Steps[0].Method = "POST"
+	scenario.Steps[0].ProtocolConfig = map[string]interface{}{"reflection": true}
+	assert.Error(t, scenario.Validate())
+}
@@ -0,0 +1,61 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/hooks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHooksConfigValidation(t *testing.T) {
+	valid := &config.HooksConfig{
+		OnStart: []config.HookConfig{{Command: "true"}},
+		OnEnd:   []config.HookConfig{{Webhook: "https://example.com/hook", Timeout: "5s"}},
+	}
+	assert.NoError(t, valid.Validate())
+
+	both := &config.HooksConfig{OnStage: []config.HookConfig{{Command: "true", Webhook: "https://example.com"}}}
+	assert.Error(t, both.Validate())
+
+	badTimeout := &config.HooksConfig{OnEnd: []config.HookConfig{{Command: "true", Timeout: "soon"}}}
+	assert.Error(t, badTimeout.Validate())
+}
+
+func TestHookRunner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell hooks use sh")
+	}
+
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Method
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	runner := hooks.NewRunner(&config.HooksConfig{
+		OnEnd: []config.HookConfig{
+			{Name: "echo", Command: "echo $GOTSUNAMI_EVENT $GOTSUNAMI_SCENARIO"},
+			{Name: "notify", Webhook: server.URL, FailOnError: true},
+		},
+	})
+
+	results := runner.Run(context.Background(), hooks.Event{Type: hooks.EventEnd, Scenario: "demo"})
+	require.Len(t, results, 2)
+
+	assert.True(t, results[0].Success)
+	assert.Equal(t, "end demo", results[0].Output)
+
+	assert.False(t, results[1].Success)
+	assert.Equal(t, http.MethodPost, received)
+
+	failed := hooks.Failed(results)
+	require.NotNil(t, failed)
+	assert.Equal(t, "notify", failed.Name)
+}
@@ -0,0 +1,479 @@
+package unit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	httpclient "github.com/alexandredias/gotsunami/internal/protocols/http"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestHTTPClientChaos(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		chaos     *httpclient.ChaosConfig
+		wantError error
+	}{
+		{name: "no faults", chaos: &httpclient.ChaosConfig{}},
+		{name: "dropped", chaos: &httpclient.ChaosConfig{DropRate: 1}, wantError: httpclient.ErrChaosDropped},
+		{name: "truncated", chaos: &httpclient.ChaosConfig{TruncateRate: 1}, wantError: httpclient.ErrChaosTruncated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := httpclient.NewHTTPClient(&httpclient.Config{
+				Timeout:        5 * time.Second,
+				MaxConnections: 2,
+				Chaos:          tt.chaos,
+			})
+			defer client.Close()
+
+			resp, err := client.Execute(context.Background(), &protocols.Request{Method: "GET", URL: server.URL})
+			require.NoError(t, err)
+
+			if tt.wantError == nil {
+				assert.NoError(t, resp.Error)
+				assert.Equal(t, 200, resp.StatusCode)
+			} else {
+				assert.ErrorIs(t, resp.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestHTTPClientDecompression(t *testing.T) {
+	compress := func(encoding string, data []byte) []byte {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		if encoding == "deflate" {
+			w = zlib.NewWriter(&buf)
+		} else {
+			w = gzip.NewWriter(&buf)
+		}
+		w.Write(data)
+		w.Close()
+		return buf.Bytes()
+	}
+	// 8MB of zeros compress to a few KB, like a decompression bomb
+	bomb := compress("gzip", make([]byte, 8<<20))
+	text := bytes.Repeat([]byte(`{"id":1,"name":"item"},`), 4096)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bomb":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(bomb)
+		case "/empty":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			encoding := r.Header.Get("Accept-Encoding")
+			w.Header().Set("Content-Encoding", encoding)
+			w.Write(compress(encoding, text))
+		}
+	}))
+	defer server.Close()
+
+	execute := func(limits *httpclient.DecompressionConfig, path string, headers map[string]string) *protocols.Response {
+		client := httpclient.NewHTTPClient(&httpclient.Config{Timeout: 5 * time.Second, MaxConnections: 2, Decompression: limits})
+		defer client.Close()
+		resp, err := client.Execute(context.Background(), &protocols.Request{Method: "GET", URL: server.URL + path, Headers: headers})
+		require.NoError(t, err)
+		return resp
+	}
+	defaults := &httpclient.DecompressionConfig{MaxSize: httpclient.DefaultMaxDecompressedSize, MaxRatio: httpclient.DefaultMaxDecompressionRatio}
+
+	// gzip is asked for by default; deflate when the request says so
+	for _, headers := range []map[string]string{nil, {"Accept-Encoding": "deflate"}} {
+		resp := execute(defaults, "/text", headers)
+		require.NoError(t, resp.Error)
+		assert.Equal(t, text, resp.Body)
+		assert.Equal(t, int64(len(text)), resp.ContentLength)
+		assert.NotContains(t, resp.Headers, "Content-Encoding")
+	}
+
+	resp := execute(defaults, "/empty", nil)
+	require.NoError(t, resp.Error)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// The bomb expands far more than 100x, and past a size limit
+	resp = execute(defaults, "/bomb", nil)
+	assert.ErrorIs(t, resp.Error, httpclient.ErrDecompressionLimit)
+	assert.Contains(t, resp.Error.Error(), "expands more than 100x")
+
+	resp = execute(&httpclient.DecompressionConfig{MaxSize: 1 << 20}, "/bomb", nil)
+	assert.ErrorIs(t, resp.Error, httpclient.ErrDecompressionLimit)
+	assert.Contains(t, resp.Error.Error(), "more than 1048576 bytes")
+
+	resp = execute(&httpclient.DecompressionConfig{}, "/bomb", nil)
+	require.NoError(t, resp.Error)
+	assert.Len(t, resp.Body, 8<<20)
+}
+
+func TestHTTPClientBandwidth(t *testing.T) {
+	payload := make([]byte, 20*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload)
+	}))
+	defer server.Close()
+
+	client := httpclient.NewHTTPClient(&httpclient.Config{
+		Timeout:        5 * time.Second,
+		MaxConnections: 2,
+		Bandwidth:      &httpclient.BandwidthConfig{Download: 100 * 1024},
+	})
+	defer client.Close()
+
+	start := time.Now()
+	resp, err := client.Execute(context.Background(), &protocols.Request{Method: "GET", URL: server.URL})
+	require.NoError(t, err)
+	require.NoError(t, resp.Error)
+
+	assert.Len(t, resp.Body, len(payload))
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+}
+
+func TestHTTPClientMetricsMatchCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := httpclient.NewHTTPClient(&httpclient.Config{Timeout: 5 * time.Second, MaxConnections: 2})
+	defer client.Close()
+	collector := metrics.NewCollector()
+
+	for _, url := range []string{server.URL, server.URL + "/missing", "http://127.0.0.1:1"} {
+		resp, err := client.Execute(context.Background(), &protocols.Request{Method: "GET", URL: url})
+		require.NoError(t, err)
+		collector.RecordResponse(resp)
+	}
+
+	summary := collector.GetSummary()
+	assert.Equal(t, int64(1), summary.SuccessfulRequests)
+	assert.Equal(t, int64(2), summary.FailedRequests)
+	assert.Equal(t, int64(1), summary.TransportErrors)
+	assert.Equal(t, int64(1), summary.HTTPErrors)
+
+	clientMetrics := client.GetMetrics()
+	assert.Equal(t, summary.TotalRequests, clientMetrics["total_requests"])
+	assert.Equal(t, summary.FailedRequests, clientMetrics["failed_requests"])
+	assert.Equal(t, summary.TransportErrors, clientMetrics["transport_errors"])
+	assert.Equal(t, summary.HTTPErrors, clientMetrics["http_errors"])
+}
+
+// BenchmarkHTTPClientConcurrency compares one shared client with a client per
+// virtual user. Run with: go test ./tests/unit -run '^$' -bench HTTPClientConcurrency -cpu 8
+func BenchmarkHTTPClientConcurrency(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	const connections = 256
+	newClient := func(maxConnections int) *httpclient.HTTPClient {
+		return httpclient.NewHTTPClient(&httpclient.Config{
+			Timeout:        5 * time.Second,
+			KeepAlive:      true,
+			MaxConnections: maxConnections,
+		})
+	}
+	req := &protocols.Request{Method: "GET", URL: server.URL}
+
+	b.Run("shared", func(b *testing.B) {
+		client := newClient(connections)
+		defer client.Close()
+
+		b.SetParallelism(32)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				client.Execute(context.Background(), req)
+			}
+		})
+	})
+
+	b.Run("per-vu", func(b *testing.B) {
+		b.SetParallelism(32)
+		b.RunParallel(func(pb *testing.PB) {
+			client := newClient(2)
+			defer client.Close()
+			for pb.Next() {
+				client.Execute(context.Background(), req)
+			}
+		})
+	})
+}
+
+func BenchmarkHTTPClientExecute(b *testing.B) {
+	payload := bytes.Repeat([]byte(`{"id":42,"name":"gotsunami"},`), 512)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(payload)
+	}))
+	defer server.Close()
+
+	client := httpclient.NewHTTPClient(&httpclient.Config{Timeout: 5 * time.Second, KeepAlive: true, MaxConnections: 64})
+	defer client.Close()
+	req := &protocols.Request{
+		Method: "POST",
+		URL:    server.URL + "/users",
+		Headers: map[string]string{
+			"accept":        "application/json",
+			"authorization": "Bearer token",
+			"content-type":  "application/json",
+			"x-request-id":  "d2f1c3b0",
+		},
+		QueryParams: map[string]interface{}{"page": "1", "limit": 10.0},
+		Body:        []byte(`{"name":"gotsunami","active":true}`),
+	}
+
+	b.ReportAllocs()
+	b.SetParallelism(8)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			resp, _ := client.Execute(context.Background(), req)
+			if resp.Error != nil || len(resp.Body) != len(payload) {
+				b.Errorf("unexpected response: %v, %d bytes", resp.Error, len(resp.Body))
+				return
+			}
+		}
+	})
+}
+
+func TestHTTPClientMaxRequestsPerConn(t *testing.T) {
+	var mu sync.Mutex
+	conns := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		conns[r.RemoteAddr]++
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	client := httpclient.NewHTTPClient(&httpclient.Config{
+		Timeout:            5 * time.Second,
+		KeepAlive:          true,
+		MaxConnections:     2,
+		MaxRequestsPerConn: 3,
+	})
+	defer client.Close()
+
+	for i := 0; i < 9; i++ {
+		resp, err := client.Execute(context.Background(), &protocols.Request{Method: "GET", URL: server.URL})
+		require.NoError(t, err)
+		require.NoError(t, resp.Error)
+	}
+
+	assert.Len(t, conns, 3)
+	for addr, count := range conns {
+		assert.Equal(t, 3, count, addr)
+	}
+}
+
+func TestHTTPClientSoftStart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// A new connection starts at 5 requests per second, full speed after 1s
+	client := httpclient.NewHTTPClient(&httpclient.Config{
+		Timeout:        5 * time.Second,
+		KeepAlive:      true,
+		MaxConnections: 1,
+		SoftStart:      &httpclient.SoftStartConfig{Duration: time.Second, Rate: 5},
+	})
+	defer client.Close()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := client.Execute(context.Background(), &protocols.Request{Method: "GET", URL: server.URL})
+		require.NoError(t, err)
+		require.NoError(t, resp.Error)
+
+		// The pause is not part of the latency
+		assert.Less(t, resp.ResponseTime, 100*time.Millisecond)
+	}
+	// Gaps of about 200ms and 160ms
+	assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+
+	time.Sleep(time.Second)
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := client.Execute(context.Background(), &protocols.Request{Method: "GET", URL: server.URL})
+		require.NoError(t, err)
+		require.NoError(t, resp.Error)
+	}
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestHTTPClientHTTPVersion(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	h2 := httptest.NewUnstartedServer(handler)
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+	h1 := httptest.NewTLSServer(handler)
+	defer h1.Close()
+	cleartext := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer cleartext.Close()
+
+	tests := []struct {
+		version string
+		url     string
+		want    string
+	}{
+		{httpclient.Version11, h2.URL, "HTTP/1.1"},
+		{httpclient.VersionAuto, h2.URL, "HTTP/2.0"},
+		{httpclient.VersionAuto, h1.URL, "HTTP/1.1"},
+		{httpclient.VersionAuto, cleartext.URL, "HTTP/1.1"},
+		{httpclient.Version2, h2.URL, "HTTP/2.0"},
+		{httpclient.Version2, cleartext.URL, "HTTP/2.0"},
+	}
+	for _, tt := range tests {
+		client := httpclient.NewHTTPClient(&httpclient.Config{
+			Timeout:        5 * time.Second,
+			KeepAlive:      true,
+			MaxConnections: 1,
+			TLSSkipVerify:  true,
+			HTTPVersion:    tt.version,
+		})
+
+		resp, err := client.Execute(context.Background(), &protocols.Request{Method: "GET", URL: tt.url})
+		require.NoError(t, err)
+		require.NoError(t, resp.Error, "%s against %s", tt.version, tt.url)
+		assert.Equal(t, tt.want, string(resp.Body), "%s against %s", tt.version, tt.url)
+		assert.Equal(t, map[string]int64{tt.want: 1}, client.Versions())
+		assert.Equal(t, int64(1), client.PoolStats().Dials)
+		client.Close()
+	}
+
+	// HTTP/2 only fails against a server that does not speak it
+	client := httpclient.NewHTTPClient(&httpclient.Config{Timeout: 5 * time.Second, KeepAlive: true, TLSSkipVerify: true, HTTPVersion: httpclient.Version2})
+	defer client.Close()
+	resp, err := client.Execute(context.Background(), &protocols.Request{Method: "GET", URL: h1.URL})
+	require.NoError(t, err)
+	assert.True(t, resp.TransportError())
+	assert.Empty(t, client.Versions())
+}
+
+func TestHTTPClientHTTP3(t *testing.T) {
+	// Borrow the certificate of a TLS test server
+	certificates := httptest.NewTLSServer(http.NotFoundHandler())
+	certificates.Close()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	server := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(certificates.TLS),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		}),
+	}
+	go server.Serve(conn)
+	defer server.Close()
+	url := fmt.Sprintf("https://localhost:%d/", conn.LocalAddr().(*net.UDPAddr).Port)
+
+	client := httpclient.NewHTTPClient(&httpclient.Config{
+		Timeout:       5 * time.Second,
+		KeepAlive:     true,
+		TLSSkipVerify: true,
+		HTTPVersion:   httpclient.Version3,
+	})
+	defer client.Close()
+
+	// The first request times the handshake, the second reuses its connection
+	for i, phases := range [][]string{{"dns", "tls", "wait", "receive"}, {"wait", "receive"}} {
+		resp, err := client.Execute(protocols.WithPhases(context.Background()), &protocols.Request{Method: "GET", URL: url})
+		require.NoError(t, err)
+		require.NoError(t, resp.Error)
+		assert.Equal(t, "HTTP/3.0", string(resp.Body))
+
+		var names []string
+		for _, phase := range resp.Phases {
+			names = append(names, phase.Name)
+		}
+		assert.Equal(t, phases, names, "request %d", i+1)
+	}
+	assert.Equal(t, map[string]int64{"HTTP/3.0": 2}, client.Versions())
+	assert.Equal(t, int64(1), client.PoolStats().Dials)
+	assert.Equal(t, int64(1), client.PoolStats().Open)
+}
+
+func TestHTTPClientPipelining(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	// Only answers once both requests arrived on the same connection, which
+	// a client waiting for each response never does
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		var paths []string
+		for len(paths) < 2 {
+			req, err := http.ReadRequest(reader)
+			if err != nil {
+				return
+			}
+			paths = append(paths, req.URL.Path)
+		}
+		for _, path := range paths {
+			fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(path), path)
+		}
+	}()
+
+	client := httpclient.NewHTTPClient(&httpclient.Config{
+		Timeout:         5 * time.Second,
+		KeepAlive:       true,
+		MaxConnections:  1,
+		MaxConnsPerHost: 1,
+		Pipeline:        2,
+	})
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for _, path := range []string{"/a", "/b"} {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			resp, err := client.Execute(context.Background(), &protocols.Request{
+				Method: "GET",
+				URL:    "http://" + listener.Addr().String() + path,
+			})
+			if assert.NoError(t, err) && assert.NoError(t, resp.Error) {
+				assert.Equal(t, path, string(resp.Body))
+			}
+		}(path)
+	}
+	wg.Wait()
+}
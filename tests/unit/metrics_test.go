@@ -0,0 +1,426 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/alexandredias/gotsunami/internal/reporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramPercentiles(t *testing.T) {
+	h := metrics.NewHistogram(metrics.DefaultHistogramPrecision)
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+
+	assert.Equal(t, int64(10000), h.Count())
+	assert.Equal(t, time.Microsecond, h.Min())
+	assert.Equal(t, 10000*time.Microsecond, h.Max())
+	assert.InDelta(t, float64(5000*time.Microsecond), float64(h.Percentile(50)), float64(5000*time.Microsecond)*0.01)
+	assert.InDelta(t, float64(9900*time.Microsecond), float64(h.Percentile(99)), float64(9900*time.Microsecond)*0.01)
+}
+
+func TestHistogramPercentileInterval(t *testing.T) {
+	// Fine enough buckets to tell the bounds from p99
+	h := metrics.NewHistogram(metrics.HighHistogramPrecision)
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+
+	// About 2 standard deviations of the rank, 10 samples, on each side
+	lower, upper, bounded := h.PercentileInterval(99)
+	assert.True(t, bounded)
+	assert.Less(t, lower, h.Percentile(99))
+	assert.Greater(t, upper, h.Percentile(99))
+	assert.InDelta(t, float64(9880*time.Microsecond), float64(lower), float64(9880*time.Microsecond)*0.002)
+	assert.InDelta(t, float64(9921*time.Microsecond), float64(upper), float64(9921*time.Microsecond)*0.002)
+
+	// A p99 from 40 samples cannot be bounded: it runs into the maximum
+	collector := metrics.NewCollector()
+	for i := 1; i <= 40; i++ {
+		collector.RecordResponse(&protocols.Response{StatusCode: 200, ResponseTime: time.Duration(i) * time.Millisecond})
+	}
+	summary := collector.GetSummary()
+	assert.Equal(t, int64(40), summary.Latency.Samples)
+	require.NotNil(t, summary.Latency.P99CI)
+	assert.False(t, summary.Latency.P99CI.Bounded)
+	assert.Equal(t, summary.Latency.Max, summary.Latency.P99CI.Upper)
+
+	report, err := reporting.NewJSONReporter(&config.LoadTestConfig{}).GenerateReport(summary, &config.Scenario{Name: "smoke"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(40), report.Latency.Samples)
+	assert.Equal(t, "40ms", report.Latency.P99CI.Upper)
+	assert.False(t, report.Latency.P99CI.Bounded)
+}
+
+func TestHistogramPrecisionBoundsError(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, precision := range []uint{metrics.DefaultHistogramPrecision, metrics.HighHistogramPrecision, metrics.MaxHistogramPrecision} {
+		bound := 1 / float64(uint(1)<<precision)
+		for i := 0; i < 1000; i++ {
+			value := time.Duration(rng.Int63n(int64(time.Minute)))
+			// Surround the value so min and max do not clamp the median to it
+			h := metrics.NewHistogram(precision)
+			h.Record(0)
+			h.Record(value)
+			h.Record(2 * time.Minute)
+			// Recorded in microseconds, so sub-microsecond digits are lost too
+			expected := value.Truncate(time.Microsecond)
+			assert.InDelta(t, float64(expected), float64(h.Percentile(50)), float64(expected)*bound+1, "precision %d", precision)
+		}
+	}
+
+	collector := metrics.NewCollectorWithPrecision(metrics.HighHistogramPrecision)
+	collector.RecordResponse(&protocols.Response{StatusCode: 200, ResponseTime: time.Millisecond})
+	summary := collector.GetSummary()
+	assert.Equal(t, uint(metrics.HighHistogramPrecision), summary.Histogram.Precision)
+	assert.Equal(t, uint(metrics.HighHistogramPrecision), summary.StatusHistograms["200"].Precision)
+}
+
+func TestHistogramSnapshotRoundTrip(t *testing.T) {
+	h := metrics.NewHistogram(metrics.DefaultHistogramPrecision)
+	for i := 1; i <= 500; i++ {
+		h.Record(time.Duration(i*37) * time.Microsecond)
+	}
+
+	restored := metrics.NewHistogramFromSnapshot(h.Snapshot())
+	assert.Equal(t, h.Count(), restored.Count())
+	assert.Equal(t, h.Mean(), restored.Mean())
+	assert.Equal(t, h.Percentile(95), restored.Percentile(95))
+}
+
+func TestMergeReports(t *testing.T) {
+	fast := metrics.NewHistogram(metrics.DefaultHistogramPrecision)
+	slow := metrics.NewHistogram(metrics.DefaultHistogramPrecision)
+	for i := 0; i < 900; i++ {
+		fast.Record(10 * time.Millisecond)
+	}
+	for i := 0; i < 100; i++ {
+		slow.Record(500 * time.Millisecond)
+	}
+
+	first := &reporting.Report{
+		Metadata:         reporting.ReportMetadata{Scenario: "checkout", Labels: map[string]string{"git_sha": "abc", "region": "us"}},
+		Configuration:    reporting.ReportConfiguration{VirtualUsers: 10, Duration: "30s", Pattern: "steady"},
+		Summary:          reporting.ReportSummary{TotalRequests: 900, SuccessfulRequests: 890, FailedRequests: 10},
+		Throughput:       reporting.ReportThroughput{RequestsPerSecond: 30},
+		StatusCodes:      map[string]int64{"200": 890, "500": 10},
+		Errors:           []reporting.ReportError{{Type: "timeout", Count: 10}},
+		LatencyHistogram: fast.Snapshot(),
+	}
+	second := &reporting.Report{
+		Metadata:         reporting.ReportMetadata{Scenario: "checkout", Labels: map[string]string{"git_sha": "abc", "region": "eu"}},
+		Configuration:    reporting.ReportConfiguration{VirtualUsers: 5, Duration: "1m", Pattern: "steady"},
+		Summary:          reporting.ReportSummary{TotalRequests: 100, SuccessfulRequests: 100},
+		Throughput:       reporting.ReportThroughput{RequestsPerSecond: 2},
+		StatusCodes:      map[string]int64{"200": 100},
+		LatencyHistogram: slow.Snapshot(),
+	}
+
+	merged, err := reporting.MergeReports([]*reporting.Report{first, second}, []string{"a.json", "b.json"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "checkout", merged.Metadata.Scenario)
+	assert.Equal(t, map[string]string{"git_sha": "abc"}, merged.Metadata.Labels)
+	assert.Equal(t, 15, merged.Configuration.VirtualUsers)
+	assert.Equal(t, "1m0s", merged.Configuration.Duration)
+	assert.Equal(t, int64(1000), merged.Summary.TotalRequests)
+	assert.InDelta(t, 99.0, merged.Summary.SuccessRate, 0.001)
+	assert.InDelta(t, 32.0, merged.Throughput.RequestsPerSecond, 0.001)
+	assert.Equal(t, int64(990), merged.StatusCodes["200"])
+	assert.Equal(t, int64(1000), merged.LatencyHistogram.Count)
+
+	// p95 must come from the slow generator's samples, not an average of p95s
+	p95, err := time.ParseDuration(merged.Latency.P95)
+	require.NoError(t, err)
+	assert.InDelta(t, float64(500*time.Millisecond), float64(p95), float64(500*time.Millisecond)*0.01)
+}
+
+func TestMergeReportsRequiresHistograms(t *testing.T) {
+	_, err := reporting.MergeReports([]*reporting.Report{{}}, []string{"old.json"})
+	assert.Error(t, err)
+}
+
+func TestCollectorLatencyByStatus(t *testing.T) {
+	collector := metrics.NewCollector()
+	for i := 0; i < 90; i++ {
+		collector.RecordResponse(&protocols.Response{StatusCode: 200, ResponseTime: 300 * time.Millisecond})
+	}
+	for i := 0; i < 10; i++ {
+		collector.RecordResponse(&protocols.Response{StatusCode: 500, ResponseTime: 2 * time.Millisecond})
+	}
+	collector.RecordResponse(&protocols.Response{ResponseTime: time.Second, Error: context.DeadlineExceeded})
+
+	summary := collector.GetSummary()
+	require.Len(t, summary.LatencyByStatus, 3)
+
+	// Fast 500s do not pull down the latency of successful requests
+	assert.InDelta(t, float64(300*time.Millisecond), float64(summary.LatencyByStatus["200"].Median), float64(3*time.Millisecond))
+	assert.InDelta(t, float64(2*time.Millisecond), float64(summary.LatencyByStatus["500"].P99), float64(20*time.Microsecond))
+	assert.Equal(t, int64(1), summary.StatusHistograms["error:timeout"].Count)
+
+	report, err := reporting.NewJSONReporter(&config.LoadTestConfig{}).GenerateReport(summary, &config.Scenario{Name: "status"})
+	require.NoError(t, err)
+	merged, err := reporting.MergeReports([]*reporting.Report{report, report}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(180), merged.StatusHistograms["200"].Count)
+	assert.Equal(t, report.LatencyByStatus["500"].P99, merged.LatencyByStatus["500"].P99)
+}
+
+func TestCollectorMergeMatchesSingleCollector(t *testing.T) {
+	single := metrics.NewCollector()
+	workers := make([]*metrics.Collector, 4)
+	for i := range workers {
+		workers[i] = metrics.NewCollector()
+	}
+
+	// Each worker sees a different latency profile, so averaging their
+	// percentiles would be visibly wrong
+	rng := rand.New(rand.NewSource(7))
+	for i := 0; i < 20000; i++ {
+		worker := i % len(workers)
+		latency := time.Duration(rng.ExpFloat64()*float64(worker+1)*float64(20*time.Millisecond)) + time.Millisecond
+		resp := &protocols.Response{StatusCode: 200, ResponseTime: latency}
+		if rng.Intn(50) == 0 {
+			resp.StatusCode = 503
+		}
+		single.RecordResponse(resp)
+		workers[worker].RecordResponse(resp)
+	}
+
+	merged := metrics.NewCollector()
+	for _, worker := range workers {
+		merged.Merge(worker)
+	}
+
+	want, got := single.GetSummary(), merged.GetSummary()
+	assert.Equal(t, want.TotalRequests, got.TotalRequests)
+	assert.Equal(t, want.FailedRequests, got.FailedRequests)
+	assert.Equal(t, want.StatusCodes, got.StatusCodes)
+	assert.Equal(t, want.Latency, got.Latency)
+	assert.Equal(t, want.Histogram, got.Histogram)
+	assert.Equal(t, want.LatencyByStatus, got.LatencyByStatus)
+
+	// Merging the per-worker reports gives the same percentiles as well
+	reporter := reporting.NewJSONReporter(&config.LoadTestConfig{})
+	reports := make([]*reporting.Report, len(workers))
+	for i, worker := range workers {
+		report, err := reporter.GenerateReport(worker.GetSummary(), &config.Scenario{Name: "merge"})
+		require.NoError(t, err)
+		reports[i] = report
+	}
+	wantReport, err := reporter.GenerateReport(want, &config.Scenario{Name: "merge"})
+	require.NoError(t, err)
+	mergedReport, err := reporting.MergeReports(reports, nil)
+	require.NoError(t, err)
+	assert.Equal(t, wantReport.Latency, mergedReport.Latency)
+	assert.Equal(t, wantReport.LatencyByStatus, mergedReport.LatencyByStatus)
+}
+
+func TestJSONReportWrite(t *testing.T) {
+	collector := metrics.NewCollector()
+	collector.Start()
+	for i := 0; i < 50; i++ {
+		collector.RecordResponse(&protocols.Response{StatusCode: 200, ResponseTime: time.Duration(i+1) * time.Millisecond, ContentLength: 512})
+	}
+	collector.RecordResponse(&protocols.Response{StatusCode: 503, ResponseTime: time.Millisecond})
+	collector.Stop()
+
+	reporter := reporting.NewJSONReporter(&config.LoadTestConfig{VirtualUsers: 2, Duration: time.Second})
+	report, err := reporter.GenerateReport(collector.GetSummary(), &config.Scenario{Name: "stream <&>"})
+	require.NoError(t, err)
+
+	outfile := filepath.Join(t.TempDir(), "report.json")
+	require.NoError(t, reporter.WriteReport(report, outfile))
+
+	// The file holds the report as indented JSON
+	written, err := os.ReadFile(outfile)
+	require.NoError(t, err)
+	want, err := json.MarshalIndent(report, "", "  ")
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(written))
+}
+
+func TestCollectorTimeSeries(t *testing.T) {
+	collector := metrics.NewCollector()
+	collector.RecordResponse(&protocols.Response{StatusCode: 200, ResponseTime: time.Millisecond})
+	assert.Nil(t, collector.GetSummary().Series, "requests before the start are not in the series")
+
+	collector.Start()
+	for i := 0; i < 20; i++ {
+		collector.RecordResponse(&protocols.Response{StatusCode: 200, ResponseTime: 10 * time.Millisecond, ContentLength: 100})
+	}
+	collector.RecordResponse(&protocols.Response{StatusCode: 500, ResponseTime: 100 * time.Millisecond})
+	collector.Stop()
+
+	series := collector.GetSummary().Series
+	require.NotNil(t, series)
+	assert.Equal(t, metrics.SeriesInterval.String(), series.Interval)
+	require.Len(t, series.Points, 1)
+
+	point := series.Points[0]
+	assert.Equal(t, int64(21), point.Requests)
+	assert.Equal(t, int64(1), point.Failed)
+	assert.Equal(t, int64(2000), point.Bytes)
+	assert.InDelta(t, 10, point.P50, 1)
+	assert.InDelta(t, 100, point.P99, 7)
+	// The rate is over the part of the interval the test lasted
+	assert.Greater(t, point.RequestsPerSecond, float64(21))
+
+	// Merging keeps the points of both collectors
+	merged := metrics.NewCollector()
+	merged.Merge(collector)
+	merged.Merge(collector)
+	require.NotNil(t, merged.GetSummary().Series)
+	assert.Equal(t, int64(42), merged.GetSummary().Series.Points[0].Requests)
+}
+
+func TestCollectorBoundsErrors(t *testing.T) {
+	collector := metrics.NewCollector()
+
+	// An error storm with a unique message per request, recorded concurrently
+	// alongside a frequent error
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				collector.RecordResponse(&protocols.Response{Error: fmt.Errorf("dial 10.0.%d.%d: refused", worker, i)})
+				collector.RecordResponse(&protocols.Response{Error: errors.New("connection reset")})
+				collector.RecordResponse(&protocols.Response{StatusCode: 200})
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	summary := collector.GetSummary()
+	assert.Equal(t, int64(8000), summary.StatusCodes[200])
+	assert.Equal(t, int64(16000), summary.StatusCodes[0])
+	assert.LessOrEqual(t, len(summary.Errors), metrics.MaxErrors+1)
+	assert.Equal(t, int64(8000), summary.Errors["connection reset"])
+
+	var total int64
+	for _, count := range summary.Errors {
+		total += count
+	}
+	assert.Equal(t, summary.TransportErrors, total)
+	assert.Greater(t, summary.Errors[metrics.OtherErrors], int64(0))
+
+	// Merged collectors stay bounded and keep every occurrence
+	merged := metrics.NewCollector()
+	merged.Merge(collector)
+	merged.Merge(collector)
+	assert.LessOrEqual(t, len(merged.GetSummary().Errors), metrics.MaxErrors+1)
+	assert.Equal(t, int64(16000), merged.GetSummary().Errors["connection reset"])
+}
+
+func TestStatsDSink(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer server.Close()
+
+	sink, err := metrics.NewSink("statsd://"+server.LocalAddr().String()+"?prefix=loadtest&tag=env:staging",
+		[]string{"scenario:checkout", "team:pay|ments"})
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(metrics.RawResult{Method: "GET", Status: 200, LatencyMs: 12.5, Bytes: 512, Endpoint: "cart"}))
+	require.NoError(t, sink.Write(metrics.RawResult{Method: "POST", LatencyMs: 1000, Error: "timeout"}))
+	require.NoError(t, sink.Close())
+
+	// Both requests fit in one packet, sent on close
+	buffer := make([]byte, 2048)
+	require.NoError(t, server.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := server.ReadFrom(buffer)
+	require.NoError(t, err)
+
+	tags := "scenario:checkout,team:pay_ments,env:staging"
+	assert.Equal(t, []string{
+		"loadtest.request.duration:12.500|ms|#" + tags + ",status:200,method:GET,endpoint:cart",
+		"loadtest.requests:1|c|#" + tags + ",status:200,method:GET,endpoint:cart",
+		"loadtest.bytes:512|c|#" + tags + ",status:200,method:GET,endpoint:cart",
+		"loadtest.request.duration:1000.000|ms|#" + tags + ",status:error,method:POST",
+		"loadtest.requests:1|c|#" + tags + ",status:error,method:POST",
+		"loadtest.errors:1|c|#" + tags + ",status:error,method:POST",
+	}, strings.Split(string(buffer[:n]), "\n"))
+
+	// k6 style
+	sink, err = metrics.NewSink("statsd="+server.LocalAddr().String(), nil)
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+
+	_, err = metrics.NewSink("influx://localhost:8086", nil)
+	assert.ErrorContains(t, err, "unknown output")
+	_, err = metrics.NewSink("localhost:8125", nil)
+	assert.ErrorContains(t, err, "invalid output")
+}
+
+func TestInfluxDBSink(t *testing.T) {
+	var mu sync.Mutex
+	var writes []*http.Request
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		writes = append(writes, r)
+		body += string(data)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	target := strings.Replace(server.URL, "http://", "http://k6:secret@", 1) + "/loadtests?interval=1h&tag=env:staging"
+	sink, err := metrics.NewSink("influxdb="+target, []string{"scenario:checkout api"})
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(metrics.RawResult{Method: "GET", Status: 200, LatencyMs: 10, Bytes: 100, Endpoint: "cart"}))
+	require.NoError(t, sink.Write(metrics.RawResult{Method: "GET", Status: 200, LatencyMs: 30, Bytes: 100, Endpoint: "cart"}))
+	require.NoError(t, sink.Write(metrics.RawResult{Method: "POST", Status: 503, LatencyMs: 5}))
+	require.NoError(t, sink.Close())
+
+	// The bucket is written on close, stamped with its start
+	require.Len(t, writes, 1)
+	assert.Equal(t, "/write", writes[0].URL.Path)
+	assert.Equal(t, "loadtests", writes[0].URL.Query().Get("db"))
+	assert.Equal(t, "ms", writes[0].URL.Query().Get("precision"))
+	username, password, _ := writes[0].BasicAuth()
+	assert.Equal(t, "k6:secret", username+":"+password)
+
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	require.Len(t, lines, 8)
+	for _, line := range lines {
+		assert.Regexp(t, ` \d{13}$`, line)
+	}
+	cart := `env=staging,scenario=checkout\ api,method=GET,status=200,endpoint=cart `
+	assert.True(t, strings.HasPrefix(lines[0], "http_reqs,"+cart+"value=2 "), lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "http_req_duration,"+cart+"value=20.000,min=10.000,max=30.000,"), lines[1])
+	assert.True(t, strings.HasPrefix(lines[2], "http_req_failed,"+cart+"value=0 "), lines[2])
+	assert.True(t, strings.HasPrefix(lines[3], "data_received,"+cart+"value=200 "), lines[3])
+	assert.True(t, strings.HasPrefix(lines[6], `http_req_failed,env=staging,scenario=checkout\ api,method=POST,status=503 value=1 `), lines[6])
+
+	// Failed writes are reported on close
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database not found", http.StatusNotFound)
+	}))
+	defer failing.Close()
+	sink, err = metrics.NewSink("influxdb="+failing.URL+"/missing", nil)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(metrics.RawResult{Method: "GET", Status: 200, LatencyMs: 1}))
+	assert.ErrorContains(t, sink.Close(), "4 InfluxDB points failed to write, last: InfluxDB returned status 404: database not found")
+}
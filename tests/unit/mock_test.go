@@ -0,0 +1,99 @@
+package unit
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockServerEndpoints(t *testing.T) {
+	cfg := &mock.Config{Endpoints: []mock.Endpoint{
+		{Method: "GET", Path: "/users", Body: map[string]int{"count": 2}, Headers: map[string]string{"X-Mock": "yes"}},
+		{Path: "/slow", Latency: &mock.LatencyConfig{Mean: "50ms"}},
+		{Path: "/broken", Errors: []mock.ErrorConfig{{Rate: 1, Status: 503, Body: "down"}}},
+		{Path: "/echo/*", Echo: true, Status: 202},
+	}}
+	srv, err := mock.NewServer("", cfg)
+	require.NoError(t, err)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/users")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "yes", resp.Header.Get("X-Mock"))
+	assert.JSONEq(t, `{"count":2}`, string(body))
+
+	// Method mismatch falls through to no endpoint
+	resp, err = http.Post(ts.URL+"/users", "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	start := time.Now()
+	resp, err = http.Get(ts.URL + "/slow")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	resp, err = http.Get(ts.URL + "/broken")
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "down", string(body))
+
+	resp, err = http.Post(ts.URL+"/echo/orders?page=2", "text/plain", strings.NewReader("hello"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var echo struct {
+		Method string              `json:"method"`
+		Path   string              `json:"path"`
+		Query  map[string][]string `json:"query"`
+		Body   string              `json:"body"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&echo))
+	assert.Equal(t, "POST", echo.Method)
+	assert.Equal(t, "/echo/orders", echo.Path)
+	assert.Equal(t, []string{"2"}, echo.Query["page"])
+	assert.Equal(t, "hello", echo.Body)
+}
+
+func TestMockServerDropsConnection(t *testing.T) {
+	srv, err := mock.NewServer("", mock.EchoConfig(nil, []mock.ErrorConfig{{Rate: 1, Status: 0}}))
+	require.NoError(t, err)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	_, err = http.Get(ts.URL + "/anything")
+	assert.Error(t, err)
+}
+
+func TestMockConfigValidation(t *testing.T) {
+	cfg, err := mock.LoadConfig(filepath.Join("..", "..", "examples", "mock", "endpoints.json"))
+	require.NoError(t, err)
+	assert.NoError(t, cfg.Validate())
+
+	invalid := []mock.Endpoint{
+		{Path: "users"},
+		{Path: "/x", Latency: &mock.LatencyConfig{Distribution: "pareto"}},
+		{Path: "/x", Latency: &mock.LatencyConfig{Distribution: mock.LatencyUniform, Min: "10ms"}},
+		{Path: "/x", Errors: []mock.ErrorConfig{{Rate: 0.7, Status: 500}, {Rate: 0.5, Status: 503}}},
+	}
+	for _, endpoint := range invalid {
+		cfg := &mock.Config{Endpoints: []mock.Endpoint{endpoint}}
+		assert.Error(t, cfg.Validate(), "%+v", endpoint)
+	}
+}
@@ -0,0 +1,213 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/engine"
+	"github.com/alexandredias/gotsunami/pkg/loadpattern"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPhasedPatternIntensity(t *testing.T) {
+	pattern := &engine.PhasedPattern{
+		Type: "custom",
+		Phases: []engine.LoadPhase{
+			{Duration: 10 * time.Second, Intensity: 1.0, Ramp: true},
+			{Duration: 10 * time.Second, Intensity: 0.5},
+		},
+	}
+
+	assert.InDelta(t, 0.0, pattern.Intensity(0), 0.001)
+	assert.InDelta(t, 0.5, pattern.Intensity(5*time.Second), 0.001)
+	assert.InDelta(t, 0.5, pattern.Intensity(15*time.Second), 0.001)
+	assert.InDelta(t, 1.0, pattern.Intensity(30*time.Second), 0.001)
+}
+
+func TestNewLoadPattern(t *testing.T) {
+	cfg := &config.LoadTestConfig{Pattern: "stress", Duration: 30 * time.Second}
+
+	pattern, err := engine.NewLoadPattern(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "stress", pattern.Name())
+
+	cfg.Scenario = &config.Scenario{
+		LoadPattern: &config.LoadPatternConfig{
+			Phases: []config.PhaseConfig{{Duration: "10s", Intensity: 0.8}},
+		},
+	}
+	pattern, err = engine.NewLoadPattern(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "custom", pattern.Name())
+	assert.InDelta(t, 0.8, pattern.Intensity(time.Second), 0.001)
+
+	cfg.Scenario = nil
+	cfg.Pattern = "unknown"
+	_, err = engine.NewLoadPattern(cfg)
+	assert.Error(t, err)
+}
+
+func TestPatternDelayFollowsPhases(t *testing.T) {
+	pattern := &engine.PhasedPattern{
+		Type: "custom",
+		Phases: []engine.LoadPhase{
+			{Duration: 10 * time.Second, Intensity: 0.1},
+			{Duration: 10 * time.Second, Intensity: 1.0},
+			{Duration: 10 * time.Second, Intensity: 0},
+		},
+	}
+
+	assert.Equal(t, time.Second, engine.PatternDelay(pattern, 0))
+	assert.Equal(t, time.Second, engine.PatternDelay(pattern, 9*time.Second))
+	assert.Equal(t, 100*time.Millisecond, engine.PatternDelay(pattern, 10*time.Second))
+	assert.Equal(t, 100*time.Millisecond, engine.PatternDelay(pattern, 19*time.Second))
+	assert.Equal(t, time.Second, engine.PatternDelay(pattern, 25*time.Second))
+	assert.Equal(t, 100*time.Millisecond, engine.PatternDelay(pattern, time.Minute))
+}
+
+func TestNewPlan(t *testing.T) {
+	scenario := &config.Scenario{
+		Name:    "plan",
+		Method:  "POST",
+		URL:     "/orders",
+		BaseURL: "http://localhost",
+		Body:    "hello",
+		LoadPattern: &config.LoadPatternConfig{
+			Phases: []config.PhaseConfig{
+				{Duration: "5s", Intensity: 0.5, Name: "warm"},
+				{Duration: "10s", Intensity: 1.0},
+			},
+		},
+	}
+	cfg := &config.LoadTestConfig{Scenario: scenario, VirtualUsers: 4, Duration: 10 * time.Second}
+
+	// Instant responses bound what the pattern lets through: 10 req/s per VU
+	// at full intensity, 5 at half
+	plan, err := engine.NewPlan(cfg, scenario, engine.PlanAssumptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 4, plan.VUs)
+	assert.Equal(t, int64(4*(25+49)), plan.Requests)
+	assert.InDelta(t, 40, plan.PeakRPS, 0.001)
+	assert.Equal(t, plan.Requests*plan.RequestSize, plan.BytesSent)
+	assert.Zero(t, plan.BytesReceived)
+
+	require.Len(t, plan.Phases, 2)
+	assert.Equal(t, "warm", plan.Phases[0].Name)
+	assert.InDelta(t, 20, plan.Phases[0].PeakRPS, 0.001)
+	assert.Equal(t, 5*time.Second, plan.Phases[1].Duration)
+
+	// Response times and per-VU caps lower the estimates
+	plan, err = engine.NewPlan(cfg, scenario, engine.PlanAssumptions{Latency: 100 * time.Millisecond, ResponseSize: 100})
+	require.NoError(t, err)
+	assert.InDelta(t, 20, plan.PeakRPS, 0.001)
+	assert.Equal(t, plan.Requests*100, plan.BytesReceived)
+
+	cfg.MaxRequests = 10
+	plan, err = engine.NewPlan(cfg, scenario, engine.PlanAssumptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(40), plan.Requests)
+}
+
+func TestRatePattern(t *testing.T) {
+	pattern, err := engine.NewRatePattern([]config.StageConfig{
+		{Duration: "10s", Target: "100rps"},
+		{Duration: "10s", Target: "100/s", Name: "plateau"},
+		{Duration: "0s", Target: "50"},
+		{Duration: "10s", Target: "0rps"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "arrival-rate", pattern.Name())
+	assert.Equal(t, 30*time.Second, pattern.Duration())
+	assert.InDelta(t, 100, pattern.Peak(), 0.001)
+
+	assert.InDelta(t, 0, pattern.Rate(0), 0.001)
+	assert.InDelta(t, 50, pattern.Rate(5*time.Second), 0.001)
+	assert.InDelta(t, 100, pattern.Rate(15*time.Second), 0.001)
+	// A stage of 0s jumps to its target, from which the next one ramps
+	assert.InDelta(t, 25, pattern.Rate(25*time.Second), 0.001)
+	assert.InDelta(t, 0, pattern.Rate(time.Minute), 0.001)
+	assert.InDelta(t, 0.5, pattern.Intensity(5*time.Second), 0.001)
+
+	assert.Equal(t, 1, pattern.Stage(15*time.Second))
+	assert.Equal(t, 3, pattern.Stage(20*time.Second))
+	assert.Equal(t, -1, pattern.Stage(time.Minute))
+	assert.InDelta(t, 500+1000+250, pattern.Arrivals(), 0.001)
+
+	cfg := &config.LoadTestConfig{
+		Pattern:  "spike",
+		Scenario: &config.Scenario{Stages: []config.StageConfig{{Duration: "1m", Target: "30/m"}}},
+	}
+	resolved, err := engine.NewLoadPattern(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "arrival-rate", resolved.Name())
+	assert.InDelta(t, 0.5, resolved.(*engine.RatePattern).Peak(), 0.001)
+
+	// Stages given on the command line replace the scenario's
+	cfg.Stages = []config.StageConfig{{Duration: "5s", Target: "10rps"}}
+	resolved, err = engine.NewLoadPattern(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, resolved.(*engine.RatePattern).Duration())
+
+	_, err = engine.NewRatePattern([]config.StageConfig{{Duration: "10s", Target: "0rps"}})
+	assert.Error(t, err)
+}
+
+func TestNewPlanStages(t *testing.T) {
+	scenario := &config.Scenario{
+		Name:    "plan",
+		Method:  "GET",
+		URL:     "/",
+		BaseURL: "http://localhost",
+		Stages: []config.StageConfig{
+			{Duration: "10s", Target: "100rps", Name: "ramp"},
+			{Duration: "20s", Target: "100rps"},
+		},
+	}
+	cfg := &config.LoadTestConfig{Scenario: scenario, VirtualUsers: 4, Duration: time.Minute}
+
+	// Stages decide the duration and the rate, whatever the VUs
+	plan, err := engine.NewPlan(cfg, scenario, engine.PlanAssumptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "arrival-rate", plan.Pattern)
+	assert.Equal(t, 30*time.Second, plan.Duration)
+	assert.Equal(t, int64(500+2000), plan.Requests)
+	assert.InDelta(t, 100, plan.PeakRPS, 0.001)
+	require.Len(t, plan.Phases, 2)
+	assert.Equal(t, "ramp", plan.Phases[0].Name)
+	assert.InDelta(t, 0, plan.Phases[0].From, 0.001)
+	assert.InDelta(t, 1, plan.Phases[0].To, 0.001)
+	assert.Equal(t, "stage 2", plan.Phases[1].Name)
+
+	// 4 VUs taking 100ms per iteration keep up with 40 iterations per second
+	plan, err = engine.NewPlan(cfg, scenario, engine.PlanAssumptions{Latency: 100 * time.Millisecond})
+	require.NoError(t, err)
+	assert.InDelta(t, 40, plan.PeakRPS, 0.001)
+	// The ramp reaches 40/s after 4s: 80 + 240 iterations, then 800 more
+	assert.InDelta(t, 80+240+800, float64(plan.Requests), 2)
+}
+
+// halfPattern runs at half the base load for the whole test
+type halfPattern struct{}
+
+func (halfPattern) Name() string                    { return "half" }
+func (halfPattern) Intensity(time.Duration) float64 { return 0.5 }
+
+func TestLoadPatternRegistry(t *testing.T) {
+	loadpattern.Register("Half", func(cfg *loadpattern.Config) loadpattern.Pattern { return halfPattern{} })
+
+	names := loadpattern.Names()
+	assert.Contains(t, names, "half")
+	assert.Contains(t, names, "steady")
+
+	pattern, err := engine.NewLoadPattern(&config.LoadTestConfig{Pattern: "HALF", Duration: time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, "half", pattern.Name())
+	assert.Equal(t, 0.5, pattern.Intensity(30*time.Second))
+
+	_, err = engine.NewLoadPattern(&config.LoadTestConfig{Pattern: "wave"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown load pattern: wave")
+	assert.Contains(t, err.Error(), "half")
+}
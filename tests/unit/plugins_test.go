@@ -0,0 +1,116 @@
+package unit
+
+import (
+	"context"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	_ "github.com/alexandredias/gotsunami/internal/protocols/grpc"
+	"github.com/alexandredias/gotsunami/internal/protocols/plugins"
+	"github.com/alexandredias/gotsunami/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginDiscovery(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the echo plugin")
+	}
+
+	dir := t.TempDir()
+	echo := filepath.Join(dir, plugin.BinaryPrefix+"echo")
+	build := exec.Command("go", "build", "-o", echo, "../../examples/plugins/echo")
+	output, err := build.CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	// A plugin named after a built-in protocol must not replace it
+	data, err := os.ReadFile(echo)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, plugin.BinaryPrefix+"grpc"), data, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, plugin.BinaryPrefix+"http"), data, 0o755))
+	// Nor are other files picked up
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0o644))
+
+	found, err := plugins.Discover([]string{dir, filepath.Join(dir, "missing")})
+	require.NoError(t, err)
+	assert.Len(t, found, 3)
+
+	registered, err := plugins.RegisterDiscovered([]string{dir})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"echo": echo}, registered)
+	assert.True(t, protocols.Registered("echo"))
+
+	// Discovering again keeps the plugin rather than taking it for a built-in
+	registered, err = plugins.RegisterDiscovered([]string{dir})
+	require.NoError(t, err)
+	assert.Contains(t, registered, "echo")
+
+	grpcProtocol, err := protocols.New("grpc", nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, "echo", grpcProtocol.Name())
+	grpcProtocol.Close()
+
+	echoProtocol, err := protocols.New("echo", map[string]interface{}{"latency": "1ms"})
+	require.NoError(t, err)
+	defer echoProtocol.Close()
+	assert.Equal(t, "echo", echoProtocol.Name())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := echoProtocol.Execute(ctx, &protocols.Request{Method: "SEND", URL: "echo://local/", Body: []byte("ping")})
+	require.NoError(t, err)
+	require.NoError(t, resp.Error)
+	assert.Equal(t, []byte("ping"), resp.Body)
+
+	// Stopping the test cuts a slow request short rather than waiting for it
+	slowProtocol, err := protocols.New("echo", map[string]interface{}{"latency": "10s"})
+	require.NoError(t, err)
+	defer slowProtocol.Close()
+	stop, cancelStop := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancelStop)
+	start := time.Now()
+	resp, err = slowProtocol.Execute(stop, &protocols.Request{Method: "SEND", URL: "echo://local/", Body: []byte("ping")})
+	require.NoError(t, err)
+	assert.ErrorIs(t, resp.Error, context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+// nilProtocol is a plugin implementation answering every request with nothing
+type nilProtocol struct{}
+
+func (nilProtocol) Name() string                                      { return "nil" }
+func (nilProtocol) Version() string                                   { return "1" }
+func (nilProtocol) Execute(*plugin.Request) (*plugin.Response, error) { return nil, nil }
+func (nilProtocol) ValidateConfig(map[string]interface{}) error       { return nil }
+func (nilProtocol) GetMetrics() map[string]interface{}                { return nil }
+func (nilProtocol) Close() error                                      { return nil }
+
+func TestPluginRPCRejectsNilResponse(t *testing.T) {
+	p := &plugin.ProtocolPlugin{Impl: nilProtocol{}}
+	impl, err := p.Server(nil)
+	require.NoError(t, err)
+	server := rpc.NewServer()
+	require.NoError(t, server.RegisterName("Plugin", impl))
+
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	client := rpc.NewClient(clientConn)
+	defer client.Close()
+
+	raw, err := p.Client(nil, client)
+	require.NoError(t, err)
+	_, err = raw.(*plugin.RPCClient).Execute(&plugin.Request{Method: "SEND"})
+	assert.EqualError(t, err, "plugin returned no response")
+}
+
+func TestPluginDefaultDirsSkipWorkingDirectory(t *testing.T) {
+	for _, dir := range plugins.DefaultDirs() {
+		assert.True(t, filepath.IsAbs(dir), dir)
+	}
+}
@@ -0,0 +1,400 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/alexandredias/gotsunami/internal/reporting"
+	"github.com/alexandredias/gotsunami/pkg/reporter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSparkline(t *testing.T) {
+	assert.Equal(t, "▁▁█▄▂▁", reporting.Sparkline([]float64{0, 0, 10, 5, 1, 0}, 10))
+	assert.Equal(t, "█", reporting.Sparkline([]float64{50}, 10))
+	assert.Equal(t, "▁▁", reporting.Sparkline([]float64{0, 0}, 0))
+	assert.Empty(t, reporting.Sparkline(nil, 10))
+}
+
+func TestOrderSteps(t *testing.T) {
+	scenario := &config.Scenario{Steps: []config.StepConfig{
+		{Name: "login"}, {Name: "browse"}, {Name: "checkout"},
+	}}
+	steps := reporting.ScenarioStepNames(scenario)
+	assert.Equal(t, []string{"login", "browse", "checkout"}, steps)
+
+	endpoints := map[string]*metrics.EndpointSummary{
+		"checkout": {Requests: 1},
+		"login":    {Requests: 3},
+		"GET /z":   {Requests: 2},
+		"GET /a":   {Requests: 2},
+	}
+	// Steps without requests are left out, other endpoints follow by name
+	assert.Equal(t, []string{"login", "checkout", "GET /a", "GET /z"}, reporting.OrderSteps(endpoints, steps))
+	assert.Empty(t, reporting.OrderSteps(nil, steps))
+}
+
+func TestOutfileName(t *testing.T) {
+	report := &reporting.Report{
+		Metadata: reporting.ReportMetadata{
+			Scenario:  "Checkout API",
+			Timestamp: "2024-01-15T10:30:00Z",
+			Labels:    map[string]string{"branch": "feature/cart"},
+		},
+		Configuration: reporting.ReportConfiguration{Seed: 42},
+	}
+
+	name, err := reporting.OutfileName("reports/{{date}}/{{scenario}}-{{timestamp}}-{{label.branch}}-{{seed}}.json", report)
+	require.NoError(t, err)
+	assert.Equal(t, "reports/2024-01-15/checkout-api-20240115-103000-feature-cart-42.json", name)
+
+	name, err = reporting.OutfileName("plain.json", report)
+	require.NoError(t, err)
+	assert.Equal(t, "plain.json", name)
+
+	outfile := filepath.Join(t.TempDir(), "nested", "dir", "report.json")
+	require.NoError(t, reporting.NewJSONReporter(nil).WriteReport(report, outfile))
+	assert.FileExists(t, outfile)
+}
+
+func TestImportK6Summary(t *testing.T) {
+	summary := `{
+  "metrics": {
+    "http_reqs": {"count": 1000, "rate": 50},
+    "http_req_failed": {"passes": 10, "fails": 990, "value": 0.01},
+    "http_req_duration": {"avg": 12.5, "min": 1, "med": 10, "max": 250, "p(90)": 20, "p(95)": 30},
+    "data_received": {"count": 2048000, "rate": 102400},
+    "vus_max": {"value": 25, "min": 25, "max": 25}
+  }
+}`
+	assert.Equal(t, reporting.FormatK6, reporting.DetectReportFormat([]byte(summary)))
+
+	report, err := reporting.ImportK6([]byte(summary))
+	require.NoError(t, err)
+
+	assert.Equal(t, "k6", report.Metadata.Tool)
+	assert.Equal(t, int64(1000), report.Summary.TotalRequests)
+	assert.Equal(t, int64(10), report.Summary.FailedRequests)
+	assert.InDelta(t, 99.0, report.Summary.SuccessRate, 0.001)
+	assert.Equal(t, 25, report.Configuration.VirtualUsers)
+	assert.Equal(t, "20s", report.Summary.TotalDuration)
+	assert.Equal(t, "12.5ms", report.Latency.Mean)
+	assert.Equal(t, "30ms", report.Latency.P95)
+	assert.Empty(t, report.Latency.P99)
+}
+
+func TestImportWrkOutput(t *testing.T) {
+	output := `Running 30s test @ http://127.0.0.1:8080/index.html
+  12 threads and 400 connections
+  Thread Stats   Avg      Stdev     Max   +/- Stdev
+    Latency   635.91us    0.89ms  12.92ms   93.69%
+    Req/Sec    56.20k     8.07k   62.00k    86.54%
+  Latency Distribution
+     50%  250.00us
+     75%  491.00us
+     90%  700.00us
+     99%    5.80ms
+  22464657 requests in 30.00s, 17.76GB read
+  Socket errors: connect 0, read 2, write 0, timeout 3
+  Non-2xx or 3xx responses: 5
+Requests/sec: 748868.53
+Transfer/sec:    606.33MB
+`
+	assert.Equal(t, reporting.FormatWrk, reporting.DetectReportFormat([]byte(output)))
+
+	report, err := reporting.ImportWrk([]byte(output))
+	require.NoError(t, err)
+
+	assert.Equal(t, "http://127.0.0.1:8080/index.html", report.Metadata.Scenario)
+	assert.Equal(t, 400, report.Configuration.VirtualUsers)
+	assert.Equal(t, int64(22464657), report.Summary.TotalRequests)
+	assert.Equal(t, int64(5), report.Summary.TransportErrors)
+	assert.Equal(t, int64(5), report.Summary.HTTPErrors)
+	assert.Equal(t, int64(22464647), report.Summary.SuccessfulRequests)
+	assert.InDelta(t, 748868.53, report.Throughput.RequestsPerSecond, 0.001)
+	assert.InDelta(t, 606.33*1024*1024, report.Throughput.BytesPerSecond, 1)
+	assert.Equal(t, "635.91µs", report.Latency.Mean)
+	assert.Equal(t, "250µs", report.Latency.Median)
+	assert.Equal(t, "5.8ms", report.Latency.P99)
+	assert.Equal(t, "12.92ms", report.Latency.Max)
+}
+
+func TestCompareReports(t *testing.T) {
+	baseline := &reporting.Report{}
+	baseline.Summary.TotalRequests = 100
+	baseline.Throughput.RequestsPerSecond = 10
+	baseline.Latency.P95 = "100ms"
+
+	candidate := &reporting.Report{}
+	candidate.Summary.TotalRequests = 120
+	candidate.Throughput.RequestsPerSecond = 12
+	candidate.Latency.P95 = "80ms"
+
+	rows := map[string]reporting.Comparison{}
+	for _, row := range reporting.CompareReports(baseline, candidate) {
+		rows[row.Metric] = row
+	}
+
+	assert.Equal(t, "+20.0%", rows["Requests"].Delta)
+	assert.Equal(t, "+20.0%", rows["Requests/sec"].Delta)
+	assert.Equal(t, "-20.0%", rows["Latency p95"].Delta)
+	assert.Equal(t, "n/a", rows["Latency p99"].Delta)
+}
+
+func TestPrometheusExporter(t *testing.T) {
+	collector := metrics.NewCollector()
+	collector.Start()
+	collector.RecordResponse(&protocols.Response{StatusCode: 200, ResponseTime: 3 * time.Millisecond, ContentLength: 100})
+	collector.RecordResponse(&protocols.Response{StatusCode: 200, ResponseTime: 300 * time.Millisecond, ContentLength: 100})
+	collector.RecordResponse(&protocols.Response{StatusCode: 503, ResponseTime: 20 * time.Millisecond})
+	collector.RecordResponse(&protocols.Response{ResponseTime: time.Second, Error: context.DeadlineExceeded})
+
+	exporter := reporting.NewPrometheusExporter(collector, "checkout", map[string]string{"build-id": "42", "env": `a"b`})
+	exporter.ShowVUs(func() int { return 7 })
+
+	server := httptest.NewServer(exporter)
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, reporting.PrometheusContentType, resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	output := string(body)
+
+	labels := `scenario="checkout",build_id="42",env="a\"b"`
+	assert.Contains(t, output, "# TYPE gotsunami_requests_total counter\ngotsunami_requests_total{"+labels+"} 4\n")
+	assert.Contains(t, output, "gotsunami_requests_failed_total{"+labels+"} 2\n")
+	assert.Contains(t, output, "gotsunami_received_bytes_total{"+labels+"} 200\n")
+	assert.Contains(t, output, "gotsunami_responses_total{"+labels+`,code="503"} 1`+"\n")
+	assert.Contains(t, output, "gotsunami_errors_total{"+labels+`,class="timeout"} 1`+"\n")
+	assert.Contains(t, output, "gotsunami_vus{"+labels+"} 7\n")
+
+	// Buckets are cumulative
+	assert.Contains(t, output, "gotsunami_request_duration_seconds_bucket{"+labels+`,status="200",le="0.005"} 1`+"\n")
+	assert.Contains(t, output, "gotsunami_request_duration_seconds_bucket{"+labels+`,status="200",le="0.25"} 1`+"\n")
+	assert.Contains(t, output, "gotsunami_request_duration_seconds_bucket{"+labels+`,status="200",le="0.5"} 2`+"\n")
+	assert.Contains(t, output, "gotsunami_request_duration_seconds_bucket{"+labels+`,status="200",le="+Inf"} 2`+"\n")
+	assert.Contains(t, output, "gotsunami_request_duration_seconds_sum{"+labels+`,status="200"} 0.303`+"\n")
+	assert.Contains(t, output, "gotsunami_request_duration_seconds_count{"+labels+`,status="error:timeout"} 1`+"\n")
+}
+
+func TestEstimateCapacity(t *testing.T) {
+	stage := func(stage int, rps float64, latency time.Duration) reporting.ReportStage {
+		histogram := metrics.NewHistogram(metrics.DefaultHistogramPrecision)
+		for i := 0; i < 100; i++ {
+			histogram.Record(latency)
+		}
+		return reporting.ReportStage{Stage: stage, Name: fmt.Sprintf("stage %d", stage), RequestsPerSecond: rps, Histogram: histogram.Snapshot()}
+	}
+	// Stages out of rate order, as when a test ramps down
+	stages := []reporting.ReportStage{
+		stage(1, 100, 50*time.Millisecond),
+		stage(2, 400, 150*time.Millisecond),
+		stage(3, 200, 100*time.Millisecond),
+		{Stage: 4, RequestsPerSecond: 0},
+	}
+
+	estimates := reporting.EstimateCapacity(stages, []config.LatencyObjective{
+		{Percentile: 95, Max: "125ms"},
+		{Percentile: 99.9, Max: "1s"},
+		{Percentile: 50, Max: "10ms"},
+	})
+	require.Len(t, estimates, 3)
+
+	// Halfway between 100ms at 200 req/s and 150ms at 400 req/s
+	assert.Equal(t, "p95 <= 125ms", estimates[0].Goal)
+	assert.Equal(t, reporting.CapacityInterpolated, estimates[0].Status)
+	assert.InDelta(t, 300, estimates[0].MaxRPS, 5)
+	assert.Equal(t, 3, estimates[0].Below.Stage)
+	assert.Equal(t, 2, estimates[0].Above.Stage)
+
+	assert.Equal(t, reporting.CapacityNotReached, estimates[1].Status)
+	assert.Equal(t, 400.0, estimates[1].MaxRPS)
+
+	assert.Equal(t, reporting.CapacityExceeded, estimates[2].Status)
+	assert.Zero(t, estimates[2].MaxRPS)
+	assert.Equal(t, 1, estimates[2].Above.Stage)
+
+	// One stage cannot tell how latency grows with the rate
+	assert.Nil(t, reporting.EstimateCapacity(stages[:1], []config.LatencyObjective{{Percentile: 95, Max: "125ms"}}))
+	assert.Nil(t, reporting.EstimateCapacity(stages, nil))
+}
+
+func TestHTMLReport(t *testing.T) {
+	collector := metrics.NewCollector()
+	collector.Start()
+	for i := 0; i < 200; i++ {
+		collector.RecordResponse(&protocols.Response{StatusCode: 200, ResponseTime: time.Duration(i+1) * time.Millisecond})
+	}
+	collector.RecordResponse(&protocols.Response{StatusCode: 503, ResponseTime: 5 * time.Millisecond})
+	collector.RecordResponse(&protocols.Response{ResponseTime: time.Second, Error: fmt.Errorf("dial tcp: connection refused")})
+	collector.Stop()
+
+	reporter, err := reporter.New("html", &config.LoadTestConfig{VirtualUsers: 2, Duration: time.Second,
+		Labels: map[string]string{"env": "staging"}})
+	require.NoError(t, err)
+	report, err := reporter.GenerateReport(collector.GetSummary(), &config.Scenario{Name: "Checkout <script>"})
+	require.NoError(t, err)
+	// A second point charts the rate over time
+	report.Series.Points = append(report.Series.Points, metrics.SeriesPoint{Offset: 1, Requests: 10, RequestsPerSecond: 10, P50: 2, P95: 3, P99: 4})
+
+	outfile := filepath.Join(t.TempDir(), "report.html")
+	require.NoError(t, reporter.WriteReport(report, outfile))
+	data, err := os.ReadFile(outfile)
+	require.NoError(t, err)
+	html := string(data)
+
+	assert.True(t, strings.HasPrefix(html, "<!DOCTYPE html>"))
+	for _, section := range []string{"Latency percentiles", "Requests per second", "Latency over time", "Status codes", "Errors"} {
+		assert.Contains(t, html, "<h2>"+section+"</h2>")
+	}
+	assert.Contains(t, html, "Checkout &lt;script&gt;", "report text is escaped")
+	assert.NotContains(t, html, "<script")
+	assert.Contains(t, html, "env=staging")
+	assert.Contains(t, html, "transport error")
+	assert.Contains(t, html, "dial tcp: connection refused")
+	assert.Contains(t, html, ">p99.9</text>")
+	assert.Contains(t, html, `<polyline class="line-rps"`)
+	assert.Contains(t, html, `<polyline class="line-p50"`)
+
+	// Self-contained: nothing is loaded from elsewhere
+	assert.NotContains(t, html, "src=")
+	assert.NotContains(t, html, "<link")
+	assert.NotContains(t, html, "https://")
+}
+
+// sampleSummary collects a few responses for the reporter tests
+func sampleSummary() *metrics.Summary {
+	collector := metrics.NewCollector()
+	collector.Start()
+	for i := 0; i < 9; i++ {
+		collector.RecordResponse(&protocols.Response{StatusCode: 200, ResponseTime: time.Duration(i+1) * time.Millisecond})
+	}
+	collector.RecordResponse(&protocols.Response{StatusCode: 500, ResponseTime: 20 * time.Millisecond})
+	collector.Stop()
+	return collector.GetSummary()
+}
+
+// markdownReporter is a report format registered from outside the module,
+// reusing the JSON report
+type markdownReporter struct {
+	reporter.Reporter
+}
+
+func (m markdownReporter) WriteReport(report *reporter.Report, outfile string) error {
+	return os.WriteFile(outfile, []byte(fmt.Sprintf("# %s\n\n%d requests\n", report.Metadata.Scenario, report.Summary.TotalRequests)), 0644)
+}
+
+func TestReporterRegistry(t *testing.T) {
+	assert.Subset(t, reporter.Formats(), []string{"csv", "html", "json", "yaml"})
+
+	// Formats resolve regardless of case
+	for _, format := range []string{"json", "JSON", "Yaml", "csv", "html"} {
+		_, err := reporter.New(format, &config.LoadTestConfig{})
+		assert.NoError(t, err, format)
+	}
+
+	_, err := reporter.New("pdf", &config.LoadTestConfig{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported report format: pdf")
+	assert.Contains(t, err.Error(), "csv, html, json")
+
+	reporter.Register("Markdown", func(cfg *reporter.Config) reporter.Reporter {
+		return markdownReporter{reporter.NewJSON(cfg)}
+	})
+	assert.Contains(t, reporter.Formats(), "markdown")
+
+	custom, err := reporter.New("markdown", &config.LoadTestConfig{VirtualUsers: 1, Duration: time.Second})
+	require.NoError(t, err)
+	report, err := custom.GenerateReport(sampleSummary(), &config.Scenario{Name: "checkout"})
+	require.NoError(t, err)
+	outfile := filepath.Join(t.TempDir(), "report.md")
+	require.NoError(t, custom.WriteReport(report, outfile))
+	data, err := os.ReadFile(outfile)
+	require.NoError(t, err)
+	assert.Equal(t, "# checkout\n\n10 requests\n", string(data))
+}
+
+func TestCSVReport(t *testing.T) {
+	csvReporter, err := reporter.New("csv", &config.LoadTestConfig{VirtualUsers: 2, Duration: time.Second})
+	require.NoError(t, err)
+	report, err := csvReporter.GenerateReport(sampleSummary(), &config.Scenario{Name: "checkout"})
+	require.NoError(t, err)
+
+	outfile := filepath.Join(t.TempDir(), "report.csv")
+	require.NoError(t, csvReporter.WriteReport(report, outfile))
+	data, err := os.ReadFile(outfile)
+	require.NoError(t, err)
+
+	lines := strings.Split(string(data), "\n")
+	assert.Equal(t, "metric,value", lines[0])
+	assert.Contains(t, lines, "summary.total_requests,10")
+	assert.Contains(t, lines, "summary.failed_requests,1")
+	assert.Contains(t, lines, "metadata.scenario,checkout")
+	assert.Contains(t, lines, "status_codes.500,1")
+	assert.True(t, sort.StringsAreSorted(lines[1:]), "rows are sorted by metric")
+	for _, line := range lines {
+		assert.False(t, strings.HasPrefix(line, "latency_histogram."), "histogram buckets are left out")
+	}
+}
+
+func TestYAMLReport(t *testing.T) {
+	yamlReporter, err := reporter.New("yaml", &config.LoadTestConfig{VirtualUsers: 2, Duration: time.Second})
+	require.NoError(t, err)
+	report, err := yamlReporter.GenerateReport(sampleSummary(), &config.Scenario{Name: "checkout"})
+	require.NoError(t, err)
+
+	outfile := filepath.Join(t.TempDir(), "report.yaml")
+	require.NoError(t, yamlReporter.WriteReport(report, outfile))
+	data, err := os.ReadFile(outfile)
+	require.NoError(t, err)
+
+	// Fields keep their JSON names
+	var decoded map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(data, &decoded))
+	summary := decoded["summary"].(map[string]interface{})
+	assert.Equal(t, 10, summary["total_requests"])
+	assert.Equal(t, "checkout", decoded["metadata"].(map[string]interface{})["scenario"])
+}
+
+func TestFailedReportKeepsPreviousFile(t *testing.T) {
+	jsonReporter := reporting.NewJSONReporter(&config.LoadTestConfig{VirtualUsers: 2, Duration: time.Second})
+	report, err := jsonReporter.GenerateReport(sampleSummary(), &config.Scenario{Name: "checkout"})
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	outfile := filepath.Join(dir, "report.json")
+	require.NoError(t, jsonReporter.WriteReport(report, outfile))
+	previous, err := os.ReadFile(outfile)
+	require.NoError(t, err)
+	info, err := os.Stat(outfile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	// JSON cannot encode NaN, so this report fails to write
+	report.Summary.SuccessRate = math.NaN()
+	require.Error(t, jsonReporter.WriteReport(report, outfile))
+
+	data, err := os.ReadFile(outfile)
+	require.NoError(t, err)
+	assert.Equal(t, string(previous), string(data))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary file is left behind")
+}
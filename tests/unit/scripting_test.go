@@ -0,0 +1,134 @@
+package unit
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/alexandredias/gotsunami/internal/scripting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeScript(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLuaScriptWrkDefaults(t *testing.T) {
+	path := writeScript(t, "defaults.lua", `
+wrk.method = "POST"
+wrk.body = '{"a":1}'
+wrk.headers["Content-Type"] = "application/json"
+`)
+
+	script, err := scripting.Load(path)
+	require.NoError(t, err)
+	defer script.Close()
+
+	req := &protocols.Request{Method: "GET", URL: "https://example.com/api", Headers: map[string]string{"X-Test": "1"}}
+	require.NoError(t, script.TransformRequest(req))
+
+	assert.Equal(t, "POST", req.Method)
+	assert.Equal(t, `{"a":1}`, string(req.Body))
+	assert.Equal(t, "application/json", req.Headers["Content-Type"])
+	assert.Equal(t, "1", req.Headers["X-Test"])
+}
+
+func TestLuaScriptRequestAndResponseHooks(t *testing.T) {
+	path := writeScript(t, "hooks.lua", `
+counter = 0
+request = function()
+  counter = counter + 1
+  return wrk.format("PUT", "/items/" .. counter, nil, "payload")
+end
+response = function(status, headers, body)
+  if status ~= 200 then
+    return "bad status " .. status
+  end
+end
+`)
+
+	script, err := scripting.Load(path)
+	require.NoError(t, err)
+	defer script.Close()
+
+	req := &protocols.Request{Method: "GET", URL: "https://example.com/api", Headers: map[string]string{"Accept": "text/plain"}}
+	require.NoError(t, script.TransformRequest(req))
+	assert.Equal(t, "PUT", req.Method)
+	assert.Equal(t, "https://example.com/items/1", req.URL)
+	assert.Equal(t, "payload", string(req.Body))
+	assert.Equal(t, "text/plain", req.Headers["Accept"])
+
+	assert.NoError(t, script.ProcessResponse(&protocols.Response{StatusCode: 200}))
+	assert.EqualError(t, script.ProcessResponse(&protocols.Response{StatusCode: 500}), "bad status 500")
+}
+
+func TestLoadScriptRejectsUnknownType(t *testing.T) {
+	_, err := scripting.Load("script.py")
+	assert.Error(t, err)
+}
+
+func TestWasmScriptHooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "validator.wasm")
+	build := exec.Command("go", "build", "-buildmode=c-shared", "-o", path, "../../examples/wasm/validator")
+	build.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Skipf("cannot build example WASM module: %s", output)
+	}
+
+	script, err := scripting.Load(path)
+	require.NoError(t, err)
+	defer script.Close()
+
+	req := &protocols.Request{Method: "GET", URL: "https://example.com/", Headers: map[string]string{}}
+	require.NoError(t, script.TransformRequest(req))
+	assert.Equal(t, "validator", req.Headers["X-Wasm-Extension"])
+
+	assert.NoError(t, script.ProcessResponse(&protocols.Response{StatusCode: 200, Body: []byte(`{"ok":true}`)}))
+	assert.Error(t, script.ProcessResponse(&protocols.Response{StatusCode: 200, Body: []byte("oops")}))
+}
+
+// hangingWasm is a module whose transform_request never returns for inputs
+// over 100 bytes and leaves smaller ones unchanged:
+//
+//	(module
+//	  (memory (export "memory") 1)
+//	  (func (export "alloc") (param i32) (result i32) i32.const 1024)
+//	  (func (export "transform_request") (param i32 i32) (result i64)
+//	    (if (i32.gt_u (local.get 1) (i32.const 100)) (then (loop br 0)))
+//	    i64.const 0))
+var hangingWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x01, 0x0c, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f,
+	0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e, 0x03, 0x03, 0x02, 0x00, 0x01, 0x05, 0x03, 0x01, 0x00, 0x01,
+	0x07, 0x26, 0x03, 0x06, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x02, 0x00, 0x05, 0x61, 0x6c, 0x6c,
+	0x6f, 0x63, 0x00, 0x00, 0x11, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x6f, 0x72, 0x6d, 0x5f, 0x72,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x00, 0x01, 0x0a, 0x1a, 0x02, 0x05, 0x00, 0x41, 0x80, 0x08,
+	0x0b, 0x12, 0x00, 0x20, 0x01, 0x41, 0xe4, 0x00, 0x4b, 0x04, 0x40, 0x03, 0x40, 0x0c, 0x00, 0x0b,
+	0x0b, 0x42, 0x00, 0x0b,
+}
+
+func TestWasmScriptRecoversFromTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hanging.wasm")
+	require.NoError(t, os.WriteFile(path, hangingWasm, 0o644))
+
+	script, err := scripting.Load(path)
+	require.NoError(t, err)
+	defer script.Close()
+
+	slow := &protocols.Request{Method: "POST", URL: "https://example.com/", Body: []byte(strings.Repeat("x", 200))}
+	err = script.TransformRequest(slow)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeded")
+
+	// The next calls run on a fresh instance of the module
+	for i := 0; i < 2; i++ {
+		req := &protocols.Request{Method: "GET", URL: "https://example.com/"}
+		require.NoError(t, script.TransformRequest(req))
+		assert.Equal(t, "GET", req.Method)
+	}
+}
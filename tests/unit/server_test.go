@@ -0,0 +1,471 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/reporting"
+	"github.com/alexandredias/gotsunami/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitRun polls a run of the API until it leaves the running states
+func waitRun(t *testing.T, url, token string) server.RunInfo {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		resp := agentRequest(t, http.MethodGet, url, token, nil)
+		var info server.RunInfo
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+		resp.Body.Close()
+		if info.Status != server.RunStatusRunning && info.Status != server.RunStatusScheduled {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run still %s", info.Status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestServerRunLifecycle(t *testing.T) {
+	var hits atomic.Int64
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer target.Close()
+
+	srv := server.NewServer("")
+	srv.SetToken("s3cret")
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	scenario := &config.Scenario{Name: "api", Method: "GET", URL: "/", BaseURL: target.URL}
+	resp := agentRequest(t, http.MethodPost, ts.URL+"/api/v1/scenarios", "s3cret", scenario)
+	var created map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.NotEmpty(t, created["id"])
+
+	resp = agentRequest(t, http.MethodGet, ts.URL+"/api/v1/scenarios/"+created["id"], "s3cret", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = agentRequest(t, http.MethodPost, ts.URL+"/api/v1/runs", "s3cret", server.RunRequest{
+		ScenarioID:    created["id"],
+		VirtualUsers:  2,
+		MaxRequests:   5,
+		Duration:      "5s",
+		SkipPreflight: true,
+	})
+	var info server.RunInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "api", info.Scenario)
+
+	info = waitRun(t, ts.URL+"/api/v1/runs/"+info.ID, "s3cret")
+	assert.Equal(t, server.RunStatusCompleted, info.Status)
+	assert.Equal(t, int64(10), hits.Load(), "5 requests per VU")
+
+	resp = agentRequest(t, http.MethodGet, ts.URL+"/api/v1/runs/"+info.ID+"/report", "s3cret", nil)
+	var report reporting.Report
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(10), report.Summary.TotalRequests)
+
+	resp = agentRequest(t, http.MethodGet, ts.URL+"/api/v1/runs/run-404", "s3cret", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServerStopRun(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+
+	ts := httptest.NewServer(server.NewServer("").Handler())
+	defer ts.Close()
+
+	resp := agentRequest(t, http.MethodPost, ts.URL+"/api/v1/runs", "", server.RunRequest{
+		Scenario:      &config.Scenario{Name: "api", Method: "GET", URL: "/", BaseURL: target.URL},
+		VirtualUsers:  1,
+		Duration:      "1m",
+		SkipPreflight: true,
+	})
+	var info server.RunInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	// No report until the run ends
+	resp = agentRequest(t, http.MethodGet, ts.URL+"/api/v1/runs/"+info.ID+"/report", "", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// VU changes are capped like every other body
+	resp = agentRequest(t, http.MethodPost, ts.URL+"/api/v1/runs/"+info.ID+"/vus", "",
+		json.RawMessage(`{"vus": 2, "pad": "`+strings.Repeat("x", 11<<20)+`"}`))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	resp = agentRequest(t, http.MethodPost, ts.URL+"/api/v1/runs/"+info.ID+"/vus", "", map[string]int{"vus": 2})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = agentRequest(t, http.MethodPost, ts.URL+"/api/v1/runs/"+info.ID+"/stop", "", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	info = waitRun(t, ts.URL+"/api/v1/runs/"+info.ID, "")
+	assert.Equal(t, server.RunStatusStopped, info.Status)
+
+	resp = agentRequest(t, http.MethodGet, ts.URL+"/api/v1/runs/"+info.ID+"/report", "", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestServerStopScheduledRunClosesEngine(t *testing.T) {
+	closed := registerProbe("probe-scheduled", true)
+	scenario := &config.Scenario{Name: "probe", Protocol: "probe-scheduled", Method: "SEND", URL: "probe://local/"}
+
+	srv := server.NewServer("")
+	run, err := srv.ScheduleRun(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  2,
+		Duration:      time.Second,
+		Pattern:       "steady",
+		SkipPreflight: true,
+	}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, server.RunStatusScheduled, run.Info().Status)
+
+	// Stopped before its start, the run never runs but releases the shared
+	// and per-VU clients the engine opened
+	run.Stop()
+	select {
+	case <-run.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduled run did not finish when stopped")
+	}
+	assert.Equal(t, server.RunStatusStopped, run.Info().Status)
+	assert.Equal(t, int64(3), closed.Load())
+}
+
+func TestServerListRunsWhileScheduledRunStarts(t *testing.T) {
+	registerProbe("probe-listed", false)
+	scenario := &config.Scenario{Name: "probe", Protocol: "probe-listed", Method: "SEND", URL: "probe://local/"}
+
+	// Listing sorts on start times that scheduled runs set as they start;
+	// run with -race to catch unguarded reads
+	srv := server.NewServer("")
+	var runs []*server.Run
+	for i := 0; i < 4; i++ {
+		run, err := srv.ScheduleRun(&config.LoadTestConfig{
+			Scenario:      scenario,
+			VirtualUsers:  1,
+			Duration:      time.Second,
+			MaxRequests:   1,
+			Pattern:       "steady",
+			SkipPreflight: true,
+		}, time.Now().Add(time.Duration(20+10*i)*time.Millisecond))
+		require.NoError(t, err)
+		runs = append(runs, run)
+	}
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	for _, run := range runs {
+		for done := false; !done; {
+			select {
+			case <-run.Done():
+				done = true
+			default:
+				assert.Len(t, srv.ListRuns(), len(runs))
+				resp := agentRequest(t, http.MethodGet, ts.URL+"/api/v1/runs", "", nil)
+				resp.Body.Close()
+			}
+		}
+	}
+	for _, run := range runs {
+		assert.Equal(t, server.RunStatusCompleted, run.Info().Status)
+	}
+}
+
+func TestServerRunSettingsPrecedence(t *testing.T) {
+	srv := server.NewServer("")
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	start := func(req server.RunRequest) *server.Run {
+		t.Helper()
+		req.Duration, req.SkipPreflight = "1m", true
+		resp := agentRequest(t, http.MethodPost, ts.URL+"/api/v1/runs", "", req)
+		var info server.RunInfo
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+		resp.Body.Close()
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		run, exists := srv.GetRun(info.ID)
+		require.True(t, exists)
+		t.Cleanup(func() {
+			run.Stop()
+			<-run.Done()
+		})
+		return run
+	}
+
+	// The scenario timeout beats the 30s default, as with the run command
+	scenario := &config.Scenario{Name: "slow", Method: "GET", URL: "/", BaseURL: "http://127.0.0.1:1", Timeout: "60s"}
+	run := start(server.RunRequest{Scenario: scenario})
+	assert.Equal(t, 60*time.Second, run.Config().Timeout)
+	assert.Equal(t, "60s", run.Config().Scenario.Timeout)
+
+	// A timeout in the request beats the scenario's
+	run = start(server.RunRequest{Scenario: scenario, Timeout: "5s"})
+	assert.Equal(t, 5*time.Second, run.Config().Timeout)
+	assert.Equal(t, "5s", run.Config().Scenario.Timeout)
+
+	// Stored scenarios are left as they were for later runs
+	id, err := srv.AddScenario(&config.Scenario{Name: "stored", Method: "GET", URL: "/", BaseURL: "http://127.0.0.1:1"})
+	require.NoError(t, err)
+	run = start(server.RunRequest{ScenarioID: id, Timeout: "5s"})
+	assert.Equal(t, "5s", run.Config().Scenario.Timeout)
+	stored, _ := srv.GetScenario(id)
+	assert.Empty(t, stored.Timeout)
+}
+
+func TestServerChecksRunRequests(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+
+	srv := server.NewServer("")
+	srv.SetRunHistory(1)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// Inline scenarios are checked against the schema like stored ones
+	resp := agentRequest(t, http.MethodPost, ts.URL+"/api/v1/runs", "", json.RawMessage(
+		`{"scenario": {"name": "api", "method": "GET", "url": "/", "base_url": "`+target.URL+`", "retires": 3}, "skip_preflight": true}`))
+	var failure map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&failure))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, failure["error"], "scenario does not match the schema")
+
+	// Bodies are capped
+	huge := config.Scenario{Name: "api", Method: "POST", URL: "/", BaseURL: target.URL, Body: strings.Repeat("x", 11<<20)}
+	for _, path := range []string{"/api/v1/scenarios", "/api/v1/runs"} {
+		var body interface{} = huge
+		if path == "/api/v1/runs" {
+			body = server.RunRequest{Scenario: &huge}
+		}
+		resp = agentRequest(t, http.MethodPost, ts.URL+path, "", body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode, path)
+	}
+	assert.Empty(t, srv.ListRuns())
+
+	// Only the latest finished runs are kept
+	var ids []string
+	for i := 0; i < 3; i++ {
+		resp = agentRequest(t, http.MethodPost, ts.URL+"/api/v1/runs", "", server.RunRequest{
+			Scenario:      &config.Scenario{Name: "api", Method: "GET", URL: "/", BaseURL: target.URL},
+			VirtualUsers:  1,
+			MaxRequests:   1,
+			SkipPreflight: true,
+		})
+		var info server.RunInfo
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+		resp.Body.Close()
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		waitRun(t, ts.URL+"/api/v1/runs/"+info.ID, "")
+		ids = append(ids, info.ID)
+	}
+	runs := srv.ListRuns()
+	require.Len(t, runs, 2)
+	assert.Equal(t, ids[1:], []string{runs[0].ID, runs[1].ID})
+	_, exists := srv.GetRun(ids[0])
+	assert.False(t, exists)
+}
+
+func TestServerConfirmsLargeRuns(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+
+	srv := server.NewServer("")
+	srv.SetConfirmVUs(5)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	scenario := &config.Scenario{Name: "api", Method: "GET", URL: "/", BaseURL: target.URL}
+	for name, req := range map[string]server.RunRequest{
+		"VUs":         {VirtualUsers: 6},
+		"workers":     {VirtualUsers: 1, Workers: 6},
+		"connections": {VirtualUsers: 1, Connections: 6},
+	} {
+		req.Scenario = scenario
+		req.SkipPreflight = true
+		resp := agentRequest(t, http.MethodPost, ts.URL+"/api/v1/runs", "", req)
+		var failure map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&failure))
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, name)
+		assert.Contains(t, failure["error"], "6 "+name+" exceeds the limit of 5", name)
+	}
+	assert.Empty(t, srv.ListRuns())
+
+	// A confirmed run starts, but scaling it past the limit needs confirming
+	// again
+	resp := agentRequest(t, http.MethodPost, ts.URL+"/api/v1/runs", "", server.RunRequest{
+		Scenario:      scenario,
+		VirtualUsers:  6,
+		Duration:      "10s",
+		SkipPreflight: true,
+		Confirm:       true,
+	})
+	var info server.RunInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	resp = agentRequest(t, http.MethodPost, ts.URL+"/api/v1/runs/"+info.ID+"/vus", "", map[string]int{"vus": 7})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = agentRequest(t, http.MethodPost, ts.URL+"/api/v1/runs/"+info.ID+"/vus", "", map[string]interface{}{"vus": 7, "confirm": true})
+	resp.Body.Close()
+	assert.NotEqual(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = agentRequest(t, http.MethodPost, ts.URL+"/api/v1/runs/"+info.ID+"/stop", "", nil)
+	resp.Body.Close()
+	waitRun(t, ts.URL+"/api/v1/runs/"+info.ID, "")
+}
+
+func TestServerRejectsMissingToken(t *testing.T) {
+	srv := server.NewServer("")
+	srv.SetToken("s3cret")
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// Health stays open, everything else needs the token
+	resp := agentRequest(t, http.MethodGet, ts.URL+"/api/v1/health", "", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	scenario := &config.Scenario{Name: "api", Method: "GET", URL: "/", BaseURL: "http://127.0.0.1:1"}
+	for _, token := range []string{"", "wrong"} {
+		for _, call := range []struct {
+			method, path string
+			body         interface{}
+		}{
+			{http.MethodPost, "/api/v1/scenarios", scenario},
+			{http.MethodGet, "/api/v1/scenarios", nil},
+			{http.MethodPost, "/api/v1/runs", server.RunRequest{Scenario: scenario}},
+			{http.MethodPost, "/api/v1/runs/run-1/stop", nil},
+			{http.MethodGet, "/api/v1/runs/run-1/report", nil},
+			{http.MethodPost, "/api/v1/limits/checkout/acquire", server.LimitRequest{Agent: "a", Count: 1}},
+		} {
+			resp := agentRequest(t, call.method, ts.URL+call.path, token, call.body)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "%s %s with token %q", call.method, call.path, token)
+		}
+	}
+	assert.Empty(t, srv.ListRuns())
+}
+
+func TestServerRejectsHostAccess(t *testing.T) {
+	srv := server.NewServer("")
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	base := config.Scenario{Name: "api", Method: "GET", URL: "/", BaseURL: "http://127.0.0.1:1"}
+	withCommand, withEnv, withSecret := base, base, base
+	withCommand.Hooks = &config.HooksConfig{OnStart: []config.HookConfig{{Command: "id"}}}
+	withEnv.Headers = map[string]string{"X-Leak": "{{env.HOME}}"}
+	withSecret.Secrets = map[string]string{"key": "file:/etc/passwd"}
+	// Files are read on the host and sent to the target by {{csv.COL}}
+	withData, withTenants := base, base
+	withData.Data = &config.DataConfig{File: "/etc/passwd", Delimiter: ":"}
+	withData.Headers = map[string]string{"X-Leak": "{{csv.root}}"}
+	withTenants.Tenants = &config.TenantConfig{File: "/etc/hostname"}
+	// Lua scripts can use os and io, and both kinds load a host file
+	withLua, withWasm := base, base
+	withLua.Script = "/tmp/os.lua"
+	withWasm.Script = "/opt/plugins/transform.wasm"
+	// Vault and AWS secrets resolve with the host's credentials
+	withVault, withAWS := base, base
+	withVault.Secrets = map[string]string{"token": "vault:secret/data/ci#token"}
+	withAWS.Secrets = map[string]string{"key": "aws:prod/api#key"}
+
+	// gRPC proto files and their imports are parsed from the host, for the
+	// scenario or one of its steps
+	withProto, withProtoStep := base, base
+	withProto.Protocol, withProto.Method, withProto.URL = "grpc", "greeter.Greeter/SayHello", "grpc://127.0.0.1:1"
+	withProto.ProtocolConfig = map[string]interface{}{"proto": "/etc/passwd", "import_paths": []interface{}{"/etc"}}
+	withProtoStep.Steps = []config.StepConfig{{Name: "greet", Protocol: "grpc", Method: "greeter.Greeter/SayHello",
+		URL: "grpc://127.0.0.1:1", ProtocolConfig: map[string]interface{}{"proto": []interface{}{"/root/secret.proto"}}}}
+
+	scenarios := map[string]*config.Scenario{
+		"command": &withCommand,
+		"proto":   &withProto,
+		"steps":   &withProtoStep,
+		"env":     &withEnv,
+		"secret":  &withSecret,
+		"data":    &withData,
+		"tenants": &withTenants,
+		"lua":     &withLua,
+		"wasm":    &withWasm,
+		"vault":   &withVault,
+		"aws":     &withAWS,
+	}
+	assert.Equal(t, []string{"data file /etc/passwd"}, withData.HostAccess())
+	assert.Equal(t, []string{"tenants file /etc/hostname"}, withTenants.HostAccess())
+	assert.Equal(t, []string{"script /tmp/os.lua"}, withLua.HostAccess())
+	assert.Equal(t, []string{"script /opt/plugins/transform.wasm"}, withWasm.HostAccess())
+	assert.Equal(t, []string{"secret token from vault:secret/data/ci#token"}, withVault.HostAccess())
+	assert.Equal(t, []string{"secret key from aws:prod/api#key"}, withAWS.HostAccess())
+	assert.Equal(t, []string{"proto file /etc/passwd", "proto import path /etc"}, withProto.HostAccess())
+	assert.Equal(t, []string{"steps[0] proto file /root/secret.proto"}, withProtoStep.HostAccess())
+	_, err := srv.AddScenario(&withProto)
+	assert.ErrorContains(t, err, "proto file /etc/passwd")
+
+	for name, scenario := range scenarios {
+		resp := agentRequest(t, http.MethodPost, ts.URL+"/api/v1/scenarios", "", scenario)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, name)
+
+		resp = agentRequest(t, http.MethodPost, ts.URL+"/api/v1/runs", "", server.RunRequest{Scenario: scenario, SkipPreflight: true})
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, name)
+	}
+	assert.Empty(t, srv.ListRuns())
+
+	// Webhooks and plain templates stay allowed
+	allowed := base
+	allowed.Hooks = &config.HooksConfig{OnEnd: []config.HookConfig{{Webhook: "http://127.0.0.1:1/done"}}}
+	allowed.Headers = map[string]string{"X-Id": "{{uuid}}"}
+	assert.Empty(t, allowed.HostAccess())
+	_, err = srv.AddScenario(&allowed)
+	assert.NoError(t, err)
+
+	srv.AllowHostAccess(true)
+	_, err = srv.AddScenario(&withCommand)
+	assert.NoError(t, err)
+}
+
+func TestCheckExposure(t *testing.T) {
+	assert.NoError(t, server.CheckExposure("127.0.0.1:8080", "", false))
+	assert.NoError(t, server.CheckExposure("localhost:8080", "", false))
+	assert.NoError(t, server.CheckExposure("[::1]:8080", "", false))
+	assert.Error(t, server.CheckExposure(":8080", "", false))
+	assert.Error(t, server.CheckExposure("0.0.0.0:8080", "", false))
+	assert.NoError(t, server.CheckExposure(":8080", "s3cret", false))
+	assert.NoError(t, server.CheckExposure(":8080", "", true))
+}
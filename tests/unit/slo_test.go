@@ -0,0 +1,81 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/slo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource reports request counts driven by the test
+type fakeSource struct {
+	total  int64
+	failed int64
+}
+
+func (s *fakeSource) Counts() (int64, int64) {
+	return atomic.LoadInt64(&s.total), atomic.LoadInt64(&s.failed)
+}
+
+func (s *fakeSource) CountSlowerThan(d time.Duration) int64 {
+	return 0
+}
+
+func (s *fakeSource) add(total, failed int64) {
+	atomic.AddInt64(&s.total, total)
+	atomic.AddInt64(&s.failed, failed)
+}
+
+func TestSLOMonitorAlertsOnProjectedViolation(t *testing.T) {
+	var mu sync.Mutex
+	var alerts []slo.Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert slo.Alert
+		json.NewDecoder(r.Body).Decode(&alert)
+		mu.Lock()
+		alerts = append(alerts, alert)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	monitor := slo.NewMonitor(&config.SLOConfig{
+		SuccessRate: 99,
+		Interval:    "20ms",
+		Webhook:     server.URL,
+	}, "checkout", nil)
+
+	source := &fakeSource{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		monitor.Run(ctx, source, time.Now(), time.Second)
+		close(done)
+	}()
+
+	// A healthy start followed by 10% errors
+	source.add(1000, 0)
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		source.add(100, 10)
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotEmpty(t, alerts)
+	assert.Equal(t, "violating", alerts[0].Status)
+	assert.Greater(t, alerts[0].BurnRate, 1.0)
+
+	assert.NotEmpty(t, monitor.Evaluate(source))
+}
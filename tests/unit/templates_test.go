@@ -0,0 +1,161 @@
+package unit
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alexandredias/gotsunami/pkg/templates"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplatesExpand(t *testing.T) {
+	vars := map[string]string{"payload": "hello", "secret": "key"}
+
+	result, err := templates.Expand(`sig={{hmac payload secret}} name={{payload}} keep={{unknown}}`, vars)
+	require.NoError(t, err)
+	assert.Equal(t, "sig=9307b3b915efb5171ff14d8cb55fbcc798c6c0ef1456d66ded1a6aa723a58b7b name=hello keep={{unknown}}", result)
+
+	result, err = templates.Expand(`{{upper "quoted value"}}`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "QUOTED VALUE", result)
+
+	_, err = templates.Expand(`{{nope a b}}`, nil)
+	assert.Error(t, err)
+	assert.Error(t, templates.Validate(`{{nope a b}}`))
+}
+
+func TestTemplatesRegister(t *testing.T) {
+	templates.Register("reverse", func(args ...string) (string, error) {
+		runes := []rune(strings.Join(args, " "))
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes), nil
+	})
+
+	assert.Contains(t, templates.Names(), "reverse")
+
+	result, err := templates.Expand(`{{reverse "abc"}}`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "cba", result)
+}
+
+func TestTemplatesExpandRandSeeded(t *testing.T) {
+	template := `{{random.uuid}} {{random.string 8}} {{random.int 1 1000}}`
+
+	first, err := templates.ExpandRand(template, nil, rand.New(rand.NewSource(42)))
+	require.NoError(t, err)
+	second, err := templates.ExpandRand(template, nil, rand.New(rand.NewSource(42)))
+	require.NoError(t, err)
+	other, err := templates.ExpandRand(template, nil, rand.New(rand.NewSource(7)))
+	require.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, other)
+}
+
+func TestTemplatesRandomBounds(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, bounds := range [][2]int64{
+		{0, math.MaxInt64},
+		{-1, math.MaxInt64},
+		{math.MinInt64, math.MaxInt64},
+		{math.MinInt64, 0},
+		{math.MinInt64, math.MinInt64},
+		{math.MaxInt64, math.MaxInt64},
+		{-5, 5},
+	} {
+		template := fmt.Sprintf("{{random.int %d %d}}", bounds[0], bounds[1])
+		for i := 0; i < 100; i++ {
+			result, err := templates.ExpandRand(template, nil, r)
+			require.NoError(t, err, template)
+			value, err := strconv.ParseInt(result, 10, 64)
+			require.NoError(t, err, template)
+			assert.GreaterOrEqual(t, value, bounds[0], template)
+			assert.LessOrEqual(t, value, bounds[1], template)
+		}
+	}
+
+	_, err := templates.ExpandRand("{{random.int 5 4}}", nil, r)
+	assert.Error(t, err)
+
+	// random.string is capped at 1MiB
+	result, err := templates.ExpandRand("{{random.string 1048576}}", nil, r)
+	require.NoError(t, err)
+	assert.Len(t, result, 1<<20)
+	_, err = templates.ExpandRand("{{random.string 1048577}}", nil, r)
+	assert.Error(t, err)
+}
+
+func TestTemplatesCompile(t *testing.T) {
+	vars := map[string]string{"payload": "hello", "secret": "key"}
+
+	// A compiled template expands exactly like ExpandRand
+	for _, source := range []string{
+		"plain",
+		"",
+		`sig={{hmac payload secret}} name={{payload}} keep={{unknown}}`,
+		`{{payload}}`,
+		`{{upper "quoted value"}}!`,
+		`open {{payload`,
+		`{{random.uuid}}-{{random.int 1 1000}}`,
+	} {
+		compiled, err := templates.Compile(source)
+		require.NoError(t, err, source)
+		assert.Equal(t, source, compiled.String())
+
+		want, err := templates.ExpandRand(source, vars, rand.New(rand.NewSource(42)))
+		require.NoError(t, err, source)
+		got, err := compiled.Expand(vars, rand.New(rand.NewSource(42)))
+		require.NoError(t, err, source)
+		assert.Equal(t, want, got, source)
+	}
+
+	static, err := templates.Compile("application/json")
+	require.NoError(t, err)
+	assert.True(t, static.Static())
+	unterminated, err := templates.Compile("{{payload")
+	require.NoError(t, err)
+	assert.True(t, unterminated.Static())
+	dynamic, err := templates.Compile("Bearer {{token}}")
+	require.NoError(t, err)
+	assert.False(t, dynamic.Static())
+
+	_, err = templates.Compile(`x {{nope a b}}`)
+	assert.ErrorContains(t, err, "unknown template function: nope")
+	_, err = templates.Compile(`{{upper "open}}`)
+	assert.Error(t, err)
+}
+
+// BenchmarkTemplatesExpand compares parsing a header on every request with
+// expanding it compiled
+func BenchmarkTemplatesExpand(b *testing.B) {
+	source := `Bearer {{token}} {{random.int 1 1000}}`
+	vars := map[string]string{"token": "abc"}
+	rng := rand.New(rand.NewSource(1))
+
+	b.Run("parsed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := templates.ExpandRand(source, vars, rng); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("compiled", func(b *testing.B) {
+		compiled, err := templates.Compile(source)
+		require.NoError(b, err)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := compiled.Expand(vars, rng); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
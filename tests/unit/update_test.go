@@ -0,0 +1,110 @@
+package unit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexandredias/gotsunami/internal/update"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChecksum(t *testing.T) {
+	checksums := []byte("abc123  gotsunami-v1.2.0-linux-amd64\nDEF456 *gotsunami-v1.2.0-darwin-amd64\n")
+
+	sum, err := update.ParseChecksum(checksums, "gotsunami-v1.2.0-linux-amd64")
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", sum)
+
+	sum, err = update.ParseChecksum(checksums, "gotsunami-v1.2.0-darwin-amd64")
+	require.NoError(t, err)
+	assert.Equal(t, "def456", sum)
+
+	_, err = update.ParseChecksum(checksums, "gotsunami-v1.2.0-windows-amd64.exe")
+	assert.Error(t, err)
+}
+
+func TestVerifySignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	data := []byte("abc123  gotsunami-v1.2.0-linux-amd64\n")
+	signature := ed25519.Sign(privateKey, data)
+	encodedKey := base64.StdEncoding.EncodeToString(publicKey)
+
+	assert.NoError(t, update.VerifySignature(data, signature, encodedKey))
+	assert.NoError(t, update.VerifySignature(data, []byte(base64.StdEncoding.EncodeToString(signature)), encodedKey))
+	assert.Error(t, update.VerifySignature([]byte("tampered"), signature, encodedKey))
+	assert.Error(t, update.VerifySignature(data, signature, "not-a-key"))
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "gotsunami")
+	require.NoError(t, os.WriteFile(target, []byte("old"), 0o755))
+
+	require.NoError(t, update.ReplaceExecutable(target, []byte("new")))
+
+	data, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+
+	info, err := os.Stat(target)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode().Perm()&0o111)
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		order int
+		ok    bool
+	}{
+		{"v1.2.3", "v1.2.3", 0, true},
+		{"v1.2.4", "v1.2.3", 1, true},
+		{"1.10.0", "v1.9.0", 1, true},
+		{"v1.3.0-rc.9", "v1.3.0-rc.10", -1, true},
+		{"v1.3.0-rc.10", "v1.3.0-rc.9", 1, true},
+		{"v1.3.0", "v1.3.0-rc.10", 1, true},
+		{"v1.3.0-rc.1", "v1.2.9", 1, true},
+		{"v1.3.0-alpha", "v1.3.0-alpha.1", -1, true},
+		{"v1.3.0-alpha.1", "v1.3.0-alpha.beta", -1, true},
+		{"v1.3.0-beta", "v1.3.0-alpha.beta", 1, true},
+		{"v1.3.0+build.5", "v1.3.0+build.7", 0, true},
+		{"v1.3.0-rc.1+build.5", "v1.3.0-rc.1", 0, true},
+		{"dev", "v1.3.0", 0, false},
+		{"v1.3.0", "3f2a9c1", 0, false},
+		{"v1.3", "v1.3.0", 0, false},
+	}
+	for _, tt := range tests {
+		order, ok := update.CompareVersions(tt.a, tt.b)
+		assert.Equal(t, tt.ok, ok, "%s vs %s", tt.a, tt.b)
+		assert.Equal(t, tt.order, order, "%s vs %s", tt.a, tt.b)
+	}
+}
+
+func TestUpdaterVersionOrder(t *testing.T) {
+	tests := []struct {
+		current, release string
+		newer, older     bool
+	}{
+		{"v1.3.0-rc.10", "v1.3.0-rc.9", false, true},
+		{"v1.3.0-rc.9", "v1.3.0-rc.10", true, false},
+		{"v1.3.0-rc.10", "v1.3.0", true, false},
+		{"v1.3.0", "v1.3.0-rc.10", false, true},
+		{"v1.3.0", "v1.3.0+build.2", false, false},
+		{"v1.3.0", "v1.3.0", false, false},
+		// Development builds and commit hashes are always behind
+		{"dev", "v1.3.0", true, false},
+		{"3f2a9c1", "v1.3.0", true, false},
+	}
+	for _, tt := range tests {
+		updater := update.NewUpdater(&update.Config{CurrentVersion: tt.current})
+		release := &update.Release{TagName: tt.release}
+		assert.Equal(t, tt.newer, updater.IsNewer(release), "IsNewer(%s) at %s", tt.release, tt.current)
+		assert.Equal(t, tt.older, updater.IsOlder(release), "IsOlder(%s) at %s", tt.release, tt.current)
+	}
+}
@@ -0,0 +1,239 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gorilla "github.com/gorilla/websocket"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+	"github.com/alexandredias/gotsunami/internal/engine"
+	"github.com/alexandredias/gotsunami/internal/metrics"
+	"github.com/alexandredias/gotsunami/internal/protocols"
+	"github.com/alexandredias/gotsunami/internal/protocols/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocketProtocol(t *testing.T) {
+	var connections int64
+	upgrader := gorilla.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t-42" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, http.Header{"X-Backend": {"ws-1"}})
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		atomic.AddInt64(&connections, 1)
+
+		if r.URL.Path == "/push" {
+			conn.WriteMessage(gorilla.TextMessage, []byte("tick"))
+		}
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(messageType, message)
+		}
+	}))
+	defer server.Close()
+	baseURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	// Every VU keeps its own connection for all of its round trips
+	scenario := &config.Scenario{
+		Name:       "echo",
+		Protocol:   "websocket",
+		Method:     "SEND",
+		URL:        "/echo",
+		BaseURL:    baseURL,
+		Headers:    map[string]string{"Authorization": "Bearer t-42"},
+		Body:       `{"ping": {{random.int 1 9}}}`,
+		Validation: &config.ValidationConfig{BodyContains: []string{`"ping"`}},
+	}
+	require.NoError(t, scenario.Validate())
+
+	e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+		Scenario:      scenario,
+		VirtualUsers:  2,
+		Duration:      time.Minute,
+		MaxRequests:   5,
+		Timeout:       5 * time.Second,
+		Pattern:       "stress",
+		SkipPreflight: true,
+	}, scenario)
+	require.NoError(t, err)
+
+	summary, err := e.Run()
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), summary.TotalRequests)
+	assert.Equal(t, int64(10), summary.SuccessfulRequests)
+	assert.Equal(t, int64(10), summary.StatusCodes[http.StatusSwitchingProtocols])
+	assert.Equal(t, int64(2), atomic.LoadInt64(&connections))
+
+	ctx := context.Background()
+	client, err := protocols.New("websocket", map[string]interface{}{"binary": "hex"})
+	require.NoError(t, err)
+	defer client.Close()
+
+	// Refused handshakes answer with their HTTP status
+	resp, err := client.Execute(ctx, &protocols.Request{URL: baseURL + "/echo", Body: []byte("cafe")})
+	require.NoError(t, err)
+	require.NoError(t, resp.Error)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	headers := map[string]string{"Authorization": "Bearer t-42"}
+	resp, err = client.Execute(ctx, &protocols.Request{URL: baseURL + "/echo", Headers: headers, Body: []byte("cafe")})
+	require.NoError(t, err)
+	require.NoError(t, resp.Error)
+	assert.Equal(t, "cafe", string(resp.Body))
+	assert.Equal(t, "ws-1", resp.Headers["X-Backend"])
+
+	// Without a body, a round trip waits for a message the server pushes
+	resp, err = client.Execute(ctx, &protocols.Request{URL: baseURL + "/push", Headers: headers, Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	require.NoError(t, resp.Error)
+	assert.Equal(t, "tick", string(resp.Body))
+
+	resp, err = client.Execute(ctx, &protocols.Request{URL: baseURL + "/push", Headers: headers, Timeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+	assert.True(t, resp.TransportError())
+
+	_, err = protocols.New("websocket", map[string]interface{}{"binary": "utf-16"})
+	assert.Error(t, err)
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	upgrader := gorilla.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			switch r.URL.Path {
+			case "/upper":
+				message = []byte(strings.ToUpper(string(message)))
+			case "/text":
+				messageType = gorilla.TextMessage
+			}
+			conn.WriteMessage(messageType, message)
+		}
+	}))
+	defer server.Close()
+	baseURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	ctx := context.Background()
+	client, err := protocols.New("websocket", map[string]interface{}{"binary": "hex", "echo": true})
+	require.NoError(t, err)
+	defer client.Close()
+
+	// An echo repeats the bytes and type of the frame sent
+	resp, err := client.Execute(ctx, &protocols.Request{URL: baseURL + "/echo", Body: []byte("cafe")})
+	require.NoError(t, err)
+	require.NoError(t, resp.Error)
+	assert.Empty(t, resp.FailedCheck)
+	assert.Equal(t, "cafe", string(resp.Body))
+
+	resp, err = client.Execute(ctx, &protocols.Request{URL: baseURL + "/text", Body: []byte("cafe")})
+	require.NoError(t, err)
+	require.NoError(t, resp.Error)
+	assert.Equal(t, "echo", resp.FailedCheck)
+	assert.EqualError(t, resp.CheckError, "sent a binary frame, received a text frame")
+	assert.Equal(t, int64(1), client.GetMetrics()["echo_mismatches"])
+
+	// Through the engine, a reply that is not an echo fails validation
+	run := func(path string) *metrics.Summary {
+		scenario := &config.Scenario{
+			Name:           "echo",
+			Protocol:       "websocket",
+			Method:         "SEND",
+			URL:            path,
+			BaseURL:        baseURL,
+			Body:           `frame {{random.int 1 9}}`,
+			ProtocolConfig: map[string]interface{}{"echo": true},
+		}
+		require.NoError(t, scenario.Validate())
+		e, err := engine.NewLoadEngine(&config.LoadTestConfig{
+			Scenario:      scenario,
+			VirtualUsers:  1,
+			Duration:      time.Minute,
+			MaxRequests:   4,
+			Timeout:       5 * time.Second,
+			Pattern:       "stress",
+			SkipPreflight: true,
+		}, scenario)
+		require.NoError(t, err)
+		summary, err := e.Run()
+		require.NoError(t, err)
+		return summary
+	}
+
+	summary := run("/echo")
+	assert.Equal(t, int64(4), summary.SuccessfulRequests)
+	assert.Zero(t, summary.ValidationResults.FailedValidations)
+
+	summary = run("/upper")
+	assert.Zero(t, summary.SuccessfulRequests)
+	assert.Equal(t, int64(4), summary.ValidationResults.ValidationErrors["echo"])
+
+	_, err = protocols.New("websocket", map[string]interface{}{"echo": "yes"})
+	assert.Error(t, err)
+}
+
+func TestWebSocketReadLimit(t *testing.T) {
+	upgrader := gorilla.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		// Reply with a frame one byte over the limit, in chunks
+		writer, err := conn.NextWriter(gorilla.BinaryMessage)
+		if err != nil {
+			return
+		}
+		chunk := make([]byte, 1<<20)
+		for written := 0; written <= websocket.MaxMessageSize; written += len(chunk) {
+			if _, err := writer.Write(chunk[:min(len(chunk), websocket.MaxMessageSize+1-written)]); err != nil {
+				return
+			}
+		}
+		writer.Close()
+	}))
+	defer server.Close()
+
+	client, err := protocols.New("websocket", nil)
+	require.NoError(t, err)
+	defer client.Close()
+
+	resp, err := client.Execute(context.Background(), &protocols.Request{
+		URL:  "ws" + strings.TrimPrefix(server.URL, "http") + "/huge",
+		Body: []byte("ping"),
+	})
+	require.NoError(t, err)
+	require.Error(t, resp.Error)
+	assert.ErrorIs(t, resp.Error, gorilla.ErrReadLimit)
+	assert.Zero(t, resp.StatusCode)
+	assert.Empty(t, resp.Body)
+}
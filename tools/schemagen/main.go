@@ -0,0 +1,26 @@
+// Command schemagen writes the JSON Schema of scenario files, generated from
+// the config.Scenario type. It runs through go generate in internal/config.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/alexandredias/gotsunami/internal/config"
+)
+
+func main() {
+	out := flag.String("out", "scenario.schema.json", "file receiving the schema")
+	flag.Parse()
+
+	schema, err := config.GenerateScenarioSchema()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to generate schema: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*out, schema, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write schema: %v\n", err)
+		os.Exit(1)
+	}
+}